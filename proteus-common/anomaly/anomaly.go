@@ -0,0 +1,246 @@
+// Package anomaly spots the probes that don't behave like the apps do: ones
+// polling for tasks much more often than they are told to, rejecting almost
+// every task, or checking in from another country minutes after the
+// previous time. These are the marks of scripted fake probes and of
+// credentials shared between devices. The anomalies are stored for the
+// admins to look into, nothing is blocked automatically.
+package anomaly
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "anomaly",
+})
+
+// The kinds of Anomaly
+const (
+	PollRate		= "poll_rate"
+	RejectRatio		= "reject_ratio"
+	LocationJump	= "location_jump"
+)
+
+// Anomaly is something odd a probe did
+type Anomaly struct {
+	Id				string `json:"id"`
+	ProbeId			string `json:"probe_id"`
+	Kind			string `json:"kind"`
+	Detail			string `json:"detail"`
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+// probeStats is what a Detector knows of a probe over the current window
+type probeStats struct {
+	start		time.Time
+	polls		int
+	accepted	int
+	rejected	int
+	country		string
+	seenAt		time.Time
+	// When the anomalies of every kind were last reported
+	reported	map[string]time.Time
+}
+
+// Detector keeps the recent requests of the probes in memory, every
+// instance of the services looks at the requests it serves. A nil Detector
+// doesn't look at anything.
+type Detector struct {
+	db				*sqlx.DB
+	// The period over which the requests are counted
+	Window			time.Duration
+	// The most polls of a probe within a Window
+	MaxPolls		int
+	// The share of rejected tasks over MinDecisions accepted or rejected
+	// ones within a Window that is suspicious
+	MaxRejectRatio	float64
+	MinDecisions	int
+	// A probe seen in two countries less than this apart moved too fast
+	MinTravelTime	time.Duration
+
+	mu				sync.Mutex
+	probes			map[string]*probeStats
+	swept			time.Time
+}
+
+// DetectorFromConfig returns the Detector of the anomaly section, or nil when
+// anomaly.enabled is false.
+func DetectorFromConfig(db *sqlx.DB) *Detector {
+	if !viper.GetBool("anomaly.enabled") {
+		return nil
+	}
+	return &Detector{
+		db: db,
+		Window: viper.GetDuration("anomaly.window"),
+		MaxPolls: viper.GetInt("anomaly.max-polls"),
+		MaxRejectRatio: viper.GetFloat64("anomaly.max-reject-ratio"),
+		MinDecisions: viper.GetInt("anomaly.min-decisions"),
+		MinTravelTime: viper.GetDuration("anomaly.min-travel-time"),
+	}
+}
+
+// stats returns the stats of the probe in the window of now, d.mu is held
+func (d *Detector) stats(probeID string, now time.Time) *probeStats {
+	if d.probes == nil {
+		d.probes = map[string]*probeStats{}
+	}
+	if now.Sub(d.swept) > d.Window {
+		for id, s := range d.probes {
+			if now.Sub(s.start) > 2 * d.Window && now.Sub(s.seenAt) > d.MinTravelTime {
+				delete(d.probes, id)
+			}
+		}
+		d.swept = now
+	}
+	s, ok := d.probes[probeID]
+	if !ok {
+		s = &probeStats{start: now, reported: map[string]time.Time{}}
+		d.probes[probeID] = s
+	}
+	if now.Sub(s.start) > d.Window {
+		s.start = now
+		s.polls, s.accepted, s.rejected = 0, 0, 0
+	}
+	return s
+}
+
+// flag returns the anomaly of the probe unless it was reported within the
+// window already, d.mu is held
+func (d *Detector) flag(s *probeStats, probeID string, kind string,
+						detail string, now time.Time) *Anomaly {
+	if last, ok := s.reported[kind]; ok && now.Sub(last) < d.Window {
+		return nil
+	}
+	s.reported[kind] = now
+	return &Anomaly{
+		Id: uuid.NewV4().String(),
+		ProbeId: probeID,
+		Kind: kind,
+		Detail: detail,
+		CreationTime: now.UTC(),
+	}
+}
+
+// record stores the anomaly, outside of d.mu
+func (d *Detector) record(a *Anomaly) {
+	if a == nil {
+		return
+	}
+	ctx.WithFields(log.Fields{
+		"probe_id": a.ProbeId,
+		"kind": a.Kind,
+	}).Warn(a.Detail)
+	if d.db == nil {
+		return
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, probe_id, kind, detail, creation_time
+	) VALUES ($1, $2, $3, $4, $5)`,
+		pq.QuoteIdentifier(viper.GetString("database.anomalies-table")))
+	_, err := d.db.Exec(query, a.Id, a.ProbeId, a.Kind, a.Detail, a.CreationTime)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into anomalies table")
+	}
+}
+
+// ObservePoll counts a poll of the probe for tasks
+func (d *Detector) ObservePoll(probeID string, now time.Time) *Anomaly {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	s := d.stats(probeID, now)
+	s.polls++
+	var a *Anomaly
+	if d.MaxPolls > 0 && s.polls > d.MaxPolls {
+		a = d.flag(s, probeID, PollRate, fmt.Sprintf(
+				"polled more than %d times in %s", d.MaxPolls, d.Window), now)
+	}
+	d.mu.Unlock()
+	d.record(a)
+	return a
+}
+
+// ObserveDecision counts a task the probe accepted or rejected
+func (d *Detector) ObserveDecision(probeID string, accepted bool,
+									now time.Time) *Anomaly {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	s := d.stats(probeID, now)
+	if accepted {
+		s.accepted++
+	} else {
+		s.rejected++
+	}
+	var a *Anomaly
+	decisions := s.accepted + s.rejected
+	if d.MaxRejectRatio > 0 && decisions >= d.MinDecisions &&
+			float64(s.rejected) / float64(decisions) > d.MaxRejectRatio {
+		a = d.flag(s, probeID, RejectRatio, fmt.Sprintf(
+				"rejected %d of %d tasks in %s", s.rejected, decisions, d.Window), now)
+	}
+	d.mu.Unlock()
+	d.record(a)
+	return a
+}
+
+// ObserveLocation records the country the probe made a request from
+func (d *Detector) ObserveLocation(probeID string, country string,
+									now time.Time) *Anomaly {
+	if d == nil || country == "" {
+		return nil
+	}
+	d.mu.Lock()
+	s := d.stats(probeID, now)
+	var a *Anomaly
+	if s.country != "" && s.country != country && now.Sub(s.seenAt) < d.MinTravelTime {
+		a = d.flag(s, probeID, LocationJump, fmt.Sprintf(
+				"seen in %s and %s %s apart", s.country, country,
+				now.Sub(s.seenAt).Round(time.Second)), now)
+	}
+	s.country = country
+	s.seenAt = now
+	d.mu.Unlock()
+	d.record(a)
+	return a
+}
+
+// ListAnomalies returns the anomalies since the time, of the probe unless
+// probeID is empty, the most recent first.
+func ListAnomalies(db *sqlx.DB, probeID string, since time.Time,
+					limit int) ([]Anomaly, error) {
+	var anomalies = make([]Anomaly, 0)
+	query := fmt.Sprintf(`SELECT
+		id, probe_id, kind, detail, creation_time
+		FROM %s
+		WHERE creation_time >= $1 AND ($2 = '' OR probe_id = $2)
+		ORDER BY creation_time DESC
+		LIMIT $3`,
+		pq.QuoteIdentifier(viper.GetString("database.anomalies-table")))
+	rows, err := db.Query(query, since, probeID, limit)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list anomalies")
+		return anomalies, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Anomaly
+		err = rows.Scan(&a.Id, &a.ProbeId, &a.Kind, &a.Detail, &a.CreationTime)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over anomalies")
+			return anomalies, err
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
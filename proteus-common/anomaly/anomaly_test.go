@@ -0,0 +1,90 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+)
+
+func testDetector() *Detector {
+	return &Detector{
+		Window: time.Hour,
+		MaxPolls: 3,
+		MaxRejectRatio: 0.5,
+		MinDecisions: 4,
+		MinTravelTime: 2 * time.Hour,
+	}
+}
+
+func TestPollRate(t *testing.T) {
+	d := testDetector()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if a := d.ObservePoll("probe", now); a != nil {
+			t.Fatalf("poll %d flagged: %s", i, a.Detail)
+		}
+	}
+	a := d.ObservePoll("probe", now)
+	if a == nil || a.Kind != PollRate || a.ProbeId != "probe" {
+		t.Fatalf("expected a poll rate anomaly (got: %v)", a)
+	}
+	if d.ObservePoll("probe", now) != nil {
+		t.Error("expected the anomaly to be reported once per window")
+	}
+	if d.ObservePoll("other", now) != nil {
+		t.Error("expected the probes to be counted apart")
+	}
+	if d.ObservePoll("probe", now.Add(2 * time.Hour)) != nil {
+		t.Error("expected the count to start over in the next window")
+	}
+}
+
+func TestRejectRatio(t *testing.T) {
+	d := testDetector()
+	now := time.Now()
+	for _, accepted := range []bool{false, false, false} {
+		if a := d.ObserveDecision("probe", accepted, now); a != nil {
+			t.Fatalf("flagged before min-decisions: %s", a.Detail)
+		}
+	}
+	a := d.ObserveDecision("probe", true, now)
+	if a == nil || a.Kind != RejectRatio {
+		t.Fatalf("expected a reject ratio anomaly (got: %v)", a)
+	}
+
+	for i := 0; i < 4; i++ {
+		if a := d.ObserveDecision("fine", i % 2 == 0, now); a != nil {
+			t.Fatalf("flagged half rejected tasks: %s", a.Detail)
+		}
+	}
+}
+
+func TestLocationJump(t *testing.T) {
+	d := testDetector()
+	now := time.Now()
+	if d.ObserveLocation("probe", "IT", now) != nil {
+		t.Fatal("flagged the first location")
+	}
+	if d.ObserveLocation("probe", "", now) != nil {
+		t.Fatal("flagged an unknown location")
+	}
+	if d.ObserveLocation("probe", "IT", now.Add(time.Minute)) != nil {
+		t.Fatal("flagged the same country")
+	}
+	a := d.ObserveLocation("probe", "BR", now.Add(10 * time.Minute))
+	if a == nil || a.Kind != LocationJump {
+		t.Fatalf("expected a location jump anomaly (got: %v)", a)
+	}
+	if d.ObserveLocation("travel", "IT", now) != nil ||
+			d.ObserveLocation("travel", "FR", now.Add(3 * time.Hour)) != nil {
+		t.Error("flagged a probe that had time to travel")
+	}
+}
+
+func TestNilDetector(t *testing.T) {
+	var d *Detector
+	if d.ObservePoll("probe", time.Now()) != nil ||
+			d.ObserveDecision("probe", false, time.Now()) != nil ||
+			d.ObserveLocation("probe", "IT", time.Now()) != nil {
+		t.Error("expected a nil detector to flag nothing")
+	}
+}
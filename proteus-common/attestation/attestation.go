@@ -0,0 +1,113 @@
+// Package attestation verifies the proofs probes can send when registering
+// that they run a genuine build of the app, possibly on a genuine device.
+// Each kind of proof is checked by a Verifier, which rates it with a Level.
+package attestation
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "attestation",
+})
+
+// Level values, from the weakest to the strongest
+const (
+	// Nothing was attested
+	LevelNone	= "none"
+	// The registration was signed by the app
+	LevelApp	= "app"
+	// The platform vouched for both the app and the device
+	LevelDevice	= "device"
+)
+
+var levelRanks = map[string]int{LevelNone: 0, LevelApp: 1, LevelDevice: 2}
+
+var ErrUnknownType = errors.New("unknown attestation type")
+var ErrNotConfigured = errors.New("attestation type is not configured")
+var ErrExpired = errors.New("attestation is too old")
+var ErrFailed = errors.New("attestation failed")
+
+// Attestation is sent by a probe along with its registration. Token is the
+// proof itself, Timestamp the Unix time at which it was made.
+type Attestation struct {
+	Type		string `json:"type" binding:"required"`
+	Token		string `json:"token" binding:"required"`
+	Timestamp	int64 `json:"timestamp"`
+}
+
+// Subject is the registration being attested
+type Subject struct {
+	Platform		string
+	SoftwareName	string
+	SoftwareVersion	string
+}
+
+// Message is what the app signs, or hashes into the nonce of the platform
+// attestation, to bind the proof to the registration.
+func (s Subject) Message(timestamp int64) []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s:%s", timestamp, s.Platform,
+								s.SoftwareName, s.SoftwareVersion))
+}
+
+// Nonce is the SHA-256 of the Message
+func (s Subject) Nonce(timestamp int64) []byte {
+	sum := sha256.Sum256(s.Message(timestamp))
+	return sum[:]
+}
+
+// Verifier checks a kind of attestation, returning the Level it's worth
+type Verifier interface {
+	Verify(a Attestation, s Subject) (string, error)
+}
+
+var verifiers = map[string]Verifier{}
+
+// Register makes the verifier check the attestations of the given type
+func Register(attestationType string, v Verifier) {
+	verifiers[attestationType] = v
+}
+
+// Verify checks the attestation of the registration. Probes may not send
+// any, which is worth LevelNone.
+func Verify(a *Attestation, s Subject) (string, error) {
+	if a == nil {
+		return LevelNone, nil
+	}
+	v, ok := verifiers[a.Type]
+	if !ok {
+		return LevelNone, ErrUnknownType
+	}
+	level, err := v.Verify(*a, s)
+	if err != nil {
+		ctx.WithError(err).Warnf("%s attestation failed", a.Type)
+		return LevelNone, err
+	}
+	return level, nil
+}
+
+// AtLeast tells whether level is as strong as min
+func AtLeast(level string, min string) bool {
+	return levelRanks[level] >= levelRanks[min]
+}
+
+// fresh makes sure the attestation was made within attestation.max-age
+func fresh(t time.Time, now time.Time) error {
+	maxAge := viper.GetDuration("attestation.max-age")
+	if t.Before(now.Add(-maxAge)) || t.After(now.Add(maxAge)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func init() {
+	Register("hmac", HMACVerifier{})
+	Register("safetynet", &SafetyNetVerifier{})
+	Register("devicecheck", &DeviceCheckVerifier{})
+}
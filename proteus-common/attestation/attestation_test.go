@@ -0,0 +1,68 @@
+package attestation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestHMAC(t *testing.T) {
+	viper.Set("attestation.max-age", "10m")
+	viper.Set("attestation.app-secrets", map[string]string{"android": "secret"})
+	s := Subject{
+		Platform: "android",
+		SoftwareName: "ooniprobe-android",
+		SoftwareVersion: "2.0.0",
+	}
+	now := time.Now().Unix()
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(s.Message(now))
+	a := Attestation{
+		Type: "hmac",
+		Token: hex.EncodeToString(mac.Sum(nil)),
+		Timestamp: now,
+	}
+
+	level, err := Verify(&a, s)
+	if err != nil || level != LevelApp {
+		t.Errorf("expected a valid signature to be worth app (got: %s, %v)",
+				level, err)
+	}
+	other := s
+	other.SoftwareVersion = "2.0.1"
+	if _, err = Verify(&a, other); err != ErrFailed {
+		t.Errorf("expected the signature of another registration to fail (got: %v)", err)
+	}
+	old := a
+	old.Timestamp = now - 3600
+	if _, err = Verify(&old, s); err != ErrExpired {
+		t.Errorf("expected an old signature to be expired (got: %v)", err)
+	}
+	other.Platform = "ios"
+	if _, err = Verify(&a, other); err != ErrNotConfigured {
+		t.Errorf("expected a platform without secret to fail (got: %v)", err)
+	}
+	if level, err = Verify(nil, s); err != nil || level != LevelNone {
+		t.Errorf("expected no attestation to be worth none (got: %s, %v)",
+				level, err)
+	}
+	if _, err = Verify(&Attestation{Type: "unknown"}, s); err != ErrUnknownType {
+		t.Errorf("expected an unknown type to fail (got: %v)", err)
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	if !AtLeast(LevelDevice, LevelApp) || !AtLeast(LevelApp, LevelApp) {
+		t.Error("expected stronger levels to be at least as strong")
+	}
+	if AtLeast(LevelNone, LevelApp) || AtLeast("", LevelDevice) {
+		t.Error("expected weaker levels not to be at least as strong")
+	}
+	if !AtLeast(LevelNone, "") {
+		t.Error("expected any level to be enough when none is required")
+	}
+}
@@ -0,0 +1,108 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	deviceCheckURL				= "https://api.devicecheck.apple.com/v1/validate_device_token"
+	deviceCheckDevelopmentURL	= "https://api.development.devicecheck.apple.com/v1/validate_device_token"
+)
+
+// DeviceCheckVerifier checks the device tokens of the DeviceCheck framework
+// of iOS devices with Apple, which tells whether they come from a genuine
+// device running our app. The tokens don't carry the registration, so only
+// their age is checked.
+type DeviceCheckVerifier struct {
+	// The Apple endpoint, set by attestation.devicecheck.development when
+	// empty
+	URL		string
+	Client	*http.Client
+}
+
+// deviceCheckKey loads the private key of attestation.devicecheck, the .p8
+// file downloaded from the Apple developer account
+func deviceCheckKey() (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(viper.GetString("attestation.devicecheck.private-key")))
+	if block == nil {
+		return nil, ErrNotConfigured
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotConfigured
+	}
+	return ecKey, nil
+}
+
+func (v *DeviceCheckVerifier) Verify(a Attestation, s Subject) (string, error) {
+	if err := fresh(time.Unix(a.Timestamp, 0), time.Now()); err != nil {
+		return LevelNone, err
+	}
+	key, err := deviceCheckKey()
+	if err != nil {
+		return LevelNone, err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": viper.GetString("attestation.devicecheck.team-id"),
+		"iat": time.Now().Unix(),
+	})
+	token.Header["kid"] = viper.GetString("attestation.devicecheck.key-id")
+	authorization, err := token.SignedString(key)
+	if err != nil {
+		return LevelNone, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"device_token": a.Token,
+		"transaction_id": uuid.NewV4().String(),
+		"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return LevelNone, err
+	}
+	url := v.URL
+	if url == "" {
+		url = deviceCheckURL
+		if viper.GetBool("attestation.devicecheck.development") {
+			url = deviceCheckDevelopmentURL
+		}
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return LevelNone, err
+	}
+	req.Header.Set("Authorization", "Bearer " + authorization)
+	req.Header.Set("Content-Type", "application/json")
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return LevelNone, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return LevelDevice, nil
+	case http.StatusBadRequest:
+		// Apple rejected the device token
+		return LevelNone, ErrFailed
+	}
+	return LevelNone, fmt.Errorf("devicecheck returned %d", resp.StatusCode)
+}
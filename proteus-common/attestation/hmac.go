@@ -0,0 +1,36 @@
+package attestation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// HMACVerifier checks registrations signed with the secret shipped with the
+// app of the platform, in attestation.app-secrets. The Token is the hex
+// encoded HMAC-SHA256 of the Message of the registration. Anyone extracting
+// the secret from the app can forge it, so it's only worth LevelApp.
+type HMACVerifier struct{}
+
+func (HMACVerifier) Verify(a Attestation, s Subject) (string, error) {
+	secret := viper.GetStringMapString("attestation.app-secrets")[s.Platform]
+	if secret == "" {
+		return LevelNone, ErrNotConfigured
+	}
+	if err := fresh(time.Unix(a.Timestamp, 0), time.Now()); err != nil {
+		return LevelNone, err
+	}
+	signature, err := hex.DecodeString(a.Token)
+	if err != nil {
+		return LevelNone, ErrFailed
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(s.Message(a.Timestamp))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return LevelNone, ErrFailed
+	}
+	return LevelApp, nil
+}
@@ -0,0 +1,126 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// The host the certificate signing SafetyNet attestations is issued to
+const safetyNetHost = "attest.android.com"
+
+// SafetyNetVerifier checks the attestations made by the SafetyNet API of
+// Android devices, whose nonce is the Nonce of the registration. It checks
+// them offline as documented by Google: the JWS has to be signed by a
+// certificate for attest.android.com.
+type SafetyNetVerifier struct {
+	// The system roots when nil
+	Roots	*x509.CertPool
+}
+
+type safetyNetHeader struct {
+	Alg	string `json:"alg"`
+	X5c	[]string `json:"x5c"`
+}
+
+type safetyNetPayload struct {
+	Nonce			string `json:"nonce"`
+	TimestampMs		int64 `json:"timestampMs"`
+	ApkPackageName	string `json:"apkPackageName"`
+	CtsProfileMatch	bool `json:"ctsProfileMatch"`
+	BasicIntegrity	bool `json:"basicIntegrity"`
+}
+
+func decodeJWSPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (v *SafetyNetVerifier) Verify(a Attestation, s Subject) (string, error) {
+	parts := strings.Split(a.Token, ".")
+	if len(parts) != 3 {
+		return LevelNone, ErrFailed
+	}
+	var header safetyNetHeader
+	if err := decodeJWSPart(parts[0], &header); err != nil {
+		return LevelNone, ErrFailed
+	}
+	if header.Alg != "RS256" || len(header.X5c) == 0 {
+		return LevelNone, ErrFailed
+	}
+
+	var certs []*x509.Certificate
+	for _, encoded := range header.X5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return LevelNone, ErrFailed
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return LevelNone, ErrFailed
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName: safetyNetHost,
+		Roots: v.Roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return LevelNone, err
+	}
+	publicKey, ok := certs[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return LevelNone, ErrFailed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(
+							strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return LevelNone, ErrFailed
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return LevelNone, ErrFailed
+	}
+
+	var payload safetyNetPayload
+	if err = decodeJWSPart(parts[1], &payload); err != nil {
+		return LevelNone, ErrFailed
+	}
+	nonce, err := base64.StdEncoding.DecodeString(payload.Nonce)
+	if err != nil || !bytes.Equal(nonce, s.Nonce(a.Timestamp)) {
+		return LevelNone, ErrFailed
+	}
+	if err = fresh(time.Unix(0, payload.TimestampMs * int64(time.Millisecond)),
+					time.Now()); err != nil {
+		return LevelNone, err
+	}
+	packageName := viper.GetString("attestation.safetynet.package-name")
+	if packageName != "" && payload.ApkPackageName != packageName {
+		return LevelNone, ErrFailed
+	}
+	switch {
+	case payload.CtsProfileMatch && payload.BasicIntegrity:
+		return LevelDevice, nil
+	case payload.BasicIntegrity:
+		// A rooted or uncertified device running the genuine app
+		return LevelApp, nil
+	}
+	return LevelNone, ErrFailed
+}
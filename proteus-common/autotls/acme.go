@@ -0,0 +1,327 @@
+package autotls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// The ACME protocol of RFC 8555, only as much of it as getting a
+// certificate with the http-01 challenge takes.
+
+var ErrChallengeFailed = errors.New("acme challenge failed")
+
+type acmeDirectory struct {
+	NewNonce	string `json:"newNonce"`
+	NewAccount	string `json:"newAccount"`
+	NewOrder	string `json:"newOrder"`
+}
+
+type acmeProblem struct {
+	Type	string `json:"type"`
+	Detail	string `json:"detail"`
+}
+
+func (p acmeProblem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", p.Type, p.Detail)
+}
+
+type acmeOrder struct {
+	Status			string `json:"status"`
+	Authorizations	[]string `json:"authorizations"`
+	Finalize		string `json:"finalize"`
+	Certificate		string `json:"certificate"`
+}
+
+type acmeChallenge struct {
+	Type	string `json:"type"`
+	URL		string `json:"url"`
+	Token	string `json:"token"`
+	Status	string `json:"status"`
+}
+
+type acmeAuthorization struct {
+	Status		string `json:"status"`
+	Challenges	[]acmeChallenge `json:"challenges"`
+}
+
+// acmeClient talks to the ACME server on behalf of the account with key
+type acmeClient struct {
+	directoryURL	string
+	key				*ecdsa.PrivateKey
+	http			*http.Client
+
+	dir				*acmeDirectory
+	kid				string
+	nonce			string
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwk is the public key of the account as a JSON Web Key, with its members
+// in the lexicographic order RFC 7638 thumbprints are computed with.
+func jwk(key *ecdsa.PrivateKey) string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, size)
+	y := make([]byte, size)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, b64(x), b64(y))
+}
+
+// keyAuthorization is what the http-01 challenge of the token has to serve
+func keyAuthorization(key *ecdsa.PrivateKey, token string) string {
+	thumbprint := sha256.Sum256([]byte(jwk(key)))
+	return token + "." + b64(thumbprint[:])
+}
+
+func (c *acmeClient) directory() (*acmeDirectory, error) {
+	if c.dir != nil {
+		return c.dir, nil
+	}
+	resp, err := c.http.Get(c.directoryURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var dir acmeDirectory
+	if err = json.NewDecoder(resp.Body).Decode(&dir); err != nil {
+		return nil, err
+	}
+	c.dir = &dir
+	return c.dir, nil
+}
+
+func (c *acmeClient) fetchNonce() (string, error) {
+	if c.nonce != "" {
+		nonce := c.nonce
+		c.nonce = ""
+		return nonce, nil
+	}
+	dir, err := c.directory()
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Head(dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Replay-Nonce"), nil
+}
+
+// signedBody is the JWS of the payload for url. Requests made before the
+// account exists carry its key, the others its URL. A nil payload is a
+// POST-as-GET.
+func (c *acmeClient) signedBody(url string, payload []byte) ([]byte, error) {
+	nonce, err := c.fetchNonce()
+	if err != nil {
+		return nil, err
+	}
+	var protected string
+	if c.kid == "" {
+		protected = fmt.Sprintf(`{"alg":"ES256","jwk":%s,"nonce":%q,"url":%q}`,
+								jwk(c.key), nonce, url)
+	} else {
+		protected = fmt.Sprintf(`{"alg":"ES256","kid":%q,"nonce":%q,"url":%q}`,
+								c.kid, nonce, url)
+	}
+	encodedPayload := ""
+	if payload != nil {
+		encodedPayload = b64(payload)
+	}
+	signingInput := b64([]byte(protected)) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return json.Marshal(map[string]string{
+		"protected": b64([]byte(protected)),
+		"payload": encodedPayload,
+		"signature": b64(signature),
+	})
+}
+
+// post sends the payload to url, trying again once when the server
+// rejected the nonce. It returns the body and the Location of the response.
+func (c *acmeClient) post(url string, payload []byte) ([]byte, string, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := c.signedBody(url, payload)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := c.http.Post(url, "application/jose+json", bytes.NewReader(body))
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		c.nonce = resp.Header.Get("Replay-Nonce")
+		if resp.StatusCode < 400 {
+			return data, resp.Header.Get("Location"), nil
+		}
+		var problem acmeProblem
+		json.Unmarshal(data, &problem)
+		if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+			continue
+		}
+		if problem.Type == "" {
+			problem.Type = fmt.Sprintf("status %d", resp.StatusCode)
+		}
+		return nil, "", problem
+	}
+}
+
+func (c *acmeClient) postJSON(url string, payload interface{}, v interface{}) (string, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return "", err
+		}
+	}
+	data, location, err := c.post(url, body)
+	if err != nil {
+		return "", err
+	}
+	if v != nil {
+		if err = json.Unmarshal(data, v); err != nil {
+			return "", err
+		}
+	}
+	return location, nil
+}
+
+// register creates the account, or finds it if the key already has one
+func (c *acmeClient) register(email string) error {
+	dir, err := c.directory()
+	if err != nil {
+		return err
+	}
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		account["contact"] = []string{"mailto:" + email}
+	}
+	kid, err := c.postJSON(dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	c.kid = kid
+	return nil
+}
+
+// poll fetches url until its status is no longer pending or processing
+func (c *acmeClient) poll(url string, v interface{}, status func() string,
+							timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := c.postJSON(url, nil, v); err != nil {
+			return err
+		}
+		switch status() {
+		case "pending", "processing":
+		default:
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("acme: timed out waiting for %s", url)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// obtain gets a certificate for the domain. The challenges are answered by
+// serving the key authorizations passed to respond.
+func (c *acmeClient) obtain(domain string, certKey crypto.Signer,
+							respond func(token string, keyAuth string),
+							timeout time.Duration) ([]byte, error) {
+	dir, err := c.directory()
+	if err != nil {
+		return nil, err
+	}
+	var order acmeOrder
+	orderURL, err := c.postJSON(dir.NewOrder, map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": domain}},
+	}, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authzURL := range order.Authorizations {
+		var authz acmeAuthorization
+		if _, err = c.postJSON(authzURL, nil, &authz); err != nil {
+			return nil, err
+		}
+		if authz.Status == "valid" {
+			continue
+		}
+		var challenge *acmeChallenge
+		for i := range authz.Challenges {
+			if authz.Challenges[i].Type == "http-01" {
+				challenge = &authz.Challenges[i]
+			}
+		}
+		if challenge == nil {
+			return nil, ErrChallengeFailed
+		}
+		respond(challenge.Token, keyAuthorization(c.key, challenge.Token))
+		if _, err = c.postJSON(challenge.URL, struct{}{}, nil); err != nil {
+			return nil, err
+		}
+		err = c.poll(authzURL, &authz, func() string { return authz.Status }, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if authz.Status != "valid" {
+			return nil, ErrChallengeFailed
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.postJSON(order.Finalize, map[string]string{"csr": b64(csr)},
+							&order); err != nil {
+		return nil, err
+	}
+	err = c.poll(orderURL, &order, func() string { return order.Status }, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "valid" {
+		return nil, fmt.Errorf("acme: order for %s is %s", domain, order.Status)
+	}
+	chain, _, err := c.post(order.Certificate, nil)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(chain); block == nil {
+		return nil, errors.New("acme: invalid certificate chain")
+	}
+	return chain, nil
+}
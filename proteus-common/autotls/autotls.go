@@ -0,0 +1,369 @@
+// Package autotls lets the services terminate TLS themselves, with
+// certificates from Let's Encrypt (or any ACME server) obtained and renewed
+// on the fly, for the deployments without a proxy in front of them.
+//
+// Its Manager works like the one of golang.org/x/crypto/acme/autocert with
+// the http-01 challenge only: the certificates are requested on the first
+// TLS handshake for a domain and the challenges are answered by the plain
+// HTTP server, which otherwise redirects to HTTPS.
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "autotls",
+})
+
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// Manager gets the certificates of Domains from the ACME server at
+// DirectoryURL and keeps them, and the key of the account, in CacheDir.
+type Manager struct {
+	DirectoryURL	string
+	Email			string
+	Domains			[]string
+	CacheDir		string
+	// How long before they expire certificates are renewed
+	RenewBefore		time.Duration
+	Client			*http.Client
+
+	mu				sync.Mutex
+	acme			*acmeClient
+	certs			map[string]*tls.Certificate
+	renewing		map[string]bool
+	// The key authorizations the challenges are answered with, by token
+	challenges		map[string]string
+	// Held while getting a certificate, the ACME client isn't concurrent
+	obtainMu		sync.Mutex
+}
+
+func (m *Manager) allowed(domain string) bool {
+	for _, d := range m.Domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) cachePath(name string) string {
+	return filepath.Join(m.CacheDir, name)
+}
+
+// client returns the ACME client of the account, whose key is created the
+// first time.
+func (m *Manager) client() (*acmeClient, error) {
+	if m.acme != nil {
+		return m.acme, nil
+	}
+	key, err := loadKey(m.cachePath("acme_account.key"))
+	if os.IsNotExist(err) {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err == nil {
+			err = saveKey(m.cachePath("acme_account.key"), key)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	httpClient := m.Client
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	client := &acmeClient{
+		directoryURL: m.DirectoryURL,
+		key: key,
+		http: httpClient,
+	}
+	if err = client.register(m.Email); err != nil {
+		return nil, err
+	}
+	m.acme = client
+	return m.acme, nil
+}
+
+func loadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func saveKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type: "EC PRIVATE KEY",
+		Bytes: der,
+	}), 0600)
+}
+
+// loadCertificate reads the certificate of the domain from the cache
+func (m *Manager) loadCertificate(domain string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(m.cachePath(domain + ".crt"),
+										m.cachePath(domain + ".key"))
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// obtain gets a new certificate for the domain and caches it
+func (m *Manager) obtain(domain string) (*tls.Certificate, error) {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+
+	// Another handshake may have got it in the meantime
+	m.mu.Lock()
+	cert, ok := m.certs[domain]
+	m.mu.Unlock()
+	if ok && !m.expiring(cert) {
+		return cert, nil
+	}
+
+	client, err := m.client()
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Infof("requesting a certificate for %s", domain)
+	chain, err := client.obtain(domain, key, func(token string, keyAuth string) {
+		m.mu.Lock()
+		m.challenges[token] = keyAuth
+		m.mu.Unlock()
+	}, 2 * time.Minute)
+	if err != nil {
+		ctx.WithError(err).Errorf("failed to get a certificate for %s", domain)
+		return nil, err
+	}
+	if err = ioutil.WriteFile(m.cachePath(domain + ".crt"), chain, 0600); err != nil {
+		return nil, err
+	}
+	if err = saveKey(m.cachePath(domain + ".key"), key); err != nil {
+		return nil, err
+	}
+	cert, err = m.loadCertificate(domain)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.certs[domain] = cert
+	m.mu.Unlock()
+	return cert, nil
+}
+
+func (m *Manager) expiring(cert *tls.Certificate) bool {
+	return time.Now().Add(m.RenewBefore).After(cert.Leaf.NotAfter)
+}
+
+// renew gets a new certificate for the domain in the background, the
+// current one is served until then.
+func (m *Manager) renew(domain string) {
+	m.mu.Lock()
+	if m.renewing[domain] {
+		m.mu.Unlock()
+		return
+	}
+	m.renewing[domain] = true
+	m.mu.Unlock()
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.renewing, domain)
+			m.mu.Unlock()
+		}()
+		m.obtain(domain)
+	}()
+}
+
+// GetCertificate is the GetCertificate of the tls.Config of the server
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if !m.allowed(domain) {
+		return nil, ErrDomainNotAllowed
+	}
+
+	m.mu.Lock()
+	cert, ok := m.certs[domain]
+	m.mu.Unlock()
+	if !ok {
+		if loaded, err := m.loadCertificate(domain); err == nil {
+			m.mu.Lock()
+			m.certs[domain] = loaded
+			m.mu.Unlock()
+			cert, ok = loaded, true
+		}
+	}
+	if !ok || time.Now().After(cert.Leaf.NotAfter) {
+		return m.obtain(domain)
+	}
+	if m.expiring(cert) {
+		m.renew(domain)
+	}
+	return cert, nil
+}
+
+// HTTPHandler answers the http-01 challenges and hands the other requests
+// to fallback, or redirects them to HTTPS when it's nil.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(redirectToHTTPS)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/.well-known/acme-challenge/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		keyAuth, ok := m.challenges[strings.TrimPrefix(r.URL.Path, prefix)]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := viper.GetInt("api.port"); port != 443 {
+		host = fmt.Sprintf("%s:%d", host, port)
+	}
+	http.Redirect(w, r, "https://" + host + r.URL.RequestURI(),
+					http.StatusMovedPermanently)
+}
+
+// NewManager returns the manager configured in the api.tls section
+func NewManager() (*Manager, error) {
+	m := &Manager{
+		DirectoryURL: viper.GetString("api.tls.directory-url"),
+		Email: viper.GetString("api.tls.email"),
+		Domains: viper.GetStringSlice("api.tls.domains"),
+		CacheDir: viper.GetString("api.tls.cache-dir"),
+		RenewBefore: viper.GetDuration("api.tls.renew-before"),
+		certs: map[string]*tls.Certificate{},
+		renewing: map[string]bool{},
+		challenges: map[string]string{},
+	}
+	if len(m.Domains) == 0 {
+		return nil, errors.New("api.tls.domains is empty")
+	}
+	if err := os.MkdirAll(m.CacheDir, 0700); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ClientCAs returns the CAs of api.tls.client-ca, which sign the client
+// certificates of the staff, or nil when it isn't set.
+func ClientCAs() (*x509.CertPool, error) {
+	path := viper.GetString("api.tls.client-ca")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return pool, nil
+}
+
+// Servers returns the servers of the service listening on addr: only the
+// plain HTTP one unless api.tls.enabled. With TLS the handler is served
+// over HTTPS on addr, and api.tls.http-port answers the challenges and
+// redirects to HTTPS. They go to gracehttp.Serve, which sets up the TLS
+// listener itself so that restarts keep working.
+//
+// The client certificates signed by api.tls.client-ca are verified when
+// the clients send one, the routes requiring them check it afterwards.
+func Servers(addr string, handler http.Handler) ([]*http.Server, error) {
+	clientCAs, err := ClientCAs()
+	if err != nil {
+		return nil, err
+	}
+	if !viper.GetBool("api.tls.enabled") {
+		if clientCAs != nil {
+			return nil, errors.New("api.tls.client-ca requires api.tls.enabled")
+		}
+		return []*http.Server{{Addr: addr, Handler: handler}}, nil
+	}
+	m, err := NewManager()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		GetCertificate: m.GetCertificate,
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if clientCAs != nil {
+		// Devices don't have certificates, so they can't be required
+		// for the whole listener
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConfig.ClientCAs = clientCAs
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []*http.Server{
+		{
+			Addr: addr,
+			Handler: handler,
+			TLSConfig: tlsConfig,
+		},
+		{
+			Addr: net.JoinHostPort(host,
+									fmt.Sprintf("%d", viper.GetInt("api.tls.http-port"))),
+			Handler: m.HTTPHandler(nil),
+		},
+	}, nil
+}
@@ -0,0 +1,267 @@
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeACME is an ACME server checking the signatures of the requests and
+// the answers to the http-01 challenges, which it fetches from challenges.
+type fakeACME struct {
+	t			*testing.T
+	server		*httptest.Server
+	challenges	http.Handler
+	caKey		*ecdsa.PrivateKey
+	caCert		*x509.Certificate
+
+	mu			sync.Mutex
+	accountKey	*ecdsa.PublicKey
+	validated	bool
+	chain		[]byte
+	orders		int
+}
+
+func b64decode(s string) []byte {
+	data, _ := base64.RawURLEncoding.DecodeString(s)
+	return data
+}
+
+// verify checks the JWS and returns its payload
+func (f *fakeACME) verify(r *http.Request) []byte {
+	var jws struct {
+		Protected	string `json:"protected"`
+		Payload		string `json:"payload"`
+		Signature	string `json:"signature"`
+	}
+	json.NewDecoder(r.Body).Decode(&jws)
+	var protected struct {
+		Alg	string `json:"alg"`
+		Jwk	*struct {
+			X	string `json:"x"`
+			Y	string `json:"y"`
+		} `json:"jwk"`
+		Kid		string `json:"kid"`
+		URL		string `json:"url"`
+	}
+	json.Unmarshal(b64decode(jws.Protected), &protected)
+	if protected.URL != f.server.URL + r.URL.Path {
+		f.t.Errorf("expected the url %s to be signed (got: %s)", r.URL.Path, protected.URL)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if protected.Jwk != nil {
+		f.accountKey = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X: new(big.Int).SetBytes(b64decode(protected.Jwk.X)),
+			Y: new(big.Int).SetBytes(b64decode(protected.Jwk.Y)),
+		}
+	} else if protected.Kid != f.server.URL + "/account/1" {
+		f.t.Errorf("expected the account url as kid (got: %s)", protected.Kid)
+	}
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	signature := b64decode(jws.Signature)
+	if len(signature) != 64 || !ecdsa.Verify(f.accountKey, digest[:],
+			new(big.Int).SetBytes(signature[:32]),
+			new(big.Int).SetBytes(signature[32:])) {
+		f.t.Errorf("invalid signature of %s", r.URL.Path)
+	}
+	return b64decode(jws.Payload)
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	f := &fakeACME{t: t}
+	var err error
+	f.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(24 * time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template,
+									&f.caKey.PublicKey, f.caKey)
+	f.caCert, _ = x509.ParseCertificate(der)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce": f.server.URL + "/nonce",
+			"newAccount": f.server.URL + "/account",
+			"newOrder": f.server.URL + "/order",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		w.Header().Set("Location", f.server.URL + "/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		f.mu.Lock()
+		f.orders++
+		f.mu.Unlock()
+		w.Header().Set("Location", f.server.URL + "/order/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(acmeOrder{
+			Status: "pending",
+			Authorizations: []string{f.server.URL + "/authz/1"},
+			Finalize: f.server.URL + "/finalize/1",
+		})
+	})
+	mux.HandleFunc("/authz/1", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		f.mu.Lock()
+		status := "pending"
+		if f.validated {
+			status = "valid"
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(acmeAuthorization{
+			Status: status,
+			Challenges: []acmeChallenge{
+				{Type: "dns-01", URL: f.server.URL + "/dns", Token: "dns"},
+				{Type: "http-01", URL: f.server.URL + "/challenge/1", Token: "token1"},
+			},
+		})
+	})
+	mux.HandleFunc("/challenge/1", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		req := httptest.NewRequest("GET", "/.well-known/acme-challenge/token1", nil)
+		rec := httptest.NewRecorder()
+		f.challenges.ServeHTTP(rec, req)
+		f.mu.Lock()
+		thumbprint := sha256.Sum256([]byte(jwk(&ecdsa.PrivateKey{PublicKey: *f.accountKey})))
+		f.validated = rec.Body.String() ==
+			"token1." + base64.RawURLEncoding.EncodeToString(thumbprint[:])
+		f.mu.Unlock()
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/finalize/1", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			CSR	string `json:"csr"`
+		}
+		json.Unmarshal(f.verify(r), &req)
+		csr, err := x509.ParseCertificateRequest(b64decode(req.CSR))
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject: csr.Subject,
+			DNSNames: csr.DNSNames,
+			NotBefore: time.Now().Add(-time.Hour),
+			NotAfter: time.Now().Add(90 * 24 * time.Hour),
+		}, f.caCert, csr.PublicKey, f.caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.mu.Lock()
+		f.chain = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(acmeOrder{Status: "processing"})
+	})
+	mux.HandleFunc("/order/1", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		json.NewEncoder(w).Encode(acmeOrder{
+			Status: "valid",
+			Certificate: f.server.URL + "/cert/1",
+		})
+	})
+	mux.HandleFunc("/cert/1", func(w http.ResponseWriter, r *http.Request) {
+		f.verify(r)
+		f.mu.Lock()
+		w.Write(f.chain)
+		f.mu.Unlock()
+	})
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func TestManager(t *testing.T) {
+	acme := newFakeACME(t)
+	defer acme.server.Close()
+	cacheDir, err := ioutil.TempDir("", "autotls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newManager := func() *Manager {
+		return &Manager{
+			DirectoryURL: acme.server.URL + "/directory",
+			Domains: []string{"proteus.example.org"},
+			CacheDir: cacheDir,
+			RenewBefore: 30 * 24 * time.Hour,
+			certs: map[string]*tls.Certificate{},
+			renewing: map[string]bool{},
+			challenges: map[string]string{},
+		}
+	}
+	m := newManager()
+	acme.challenges = m.HTTPHandler(nil)
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example.org"}); err != ErrDomainNotAllowed {
+		t.Errorf("expected other domains to be refused (got: %v)", err)
+	}
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Proteus.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.DNSNames[0] != "proteus.example.org" {
+		t.Errorf("expected a certificate for the domain (got: %v)", cert.Leaf.DNSNames)
+	}
+
+	// Another instance, or the same one once restarted, uses the cache
+	other := newManager()
+	if _, err := other.GetCertificate(&tls.ClientHelloInfo{ServerName: "proteus.example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	if acme.orders != 1 {
+		t.Errorf("expected a single certificate to be ordered (got: %d)", acme.orders)
+	}
+}
+
+func TestHTTPHandlerRedirects(t *testing.T) {
+	m := &Manager{challenges: map[string]string{}}
+	req := httptest.NewRequest("GET", "http://proteus.example.org/api/v1/tasks?wait=10", nil)
+	w := httptest.NewRecorder()
+	m.HTTPHandler(nil).ServeHTTP(w, req)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusMovedPermanently ||
+			!strings.HasPrefix(location, "https://proteus.example.org") ||
+			!strings.HasSuffix(location, "/api/v1/tasks?wait=10") {
+		t.Errorf("expected a redirect to https (got: %d %s)", w.Code, location)
+	}
+
+	req = httptest.NewRequest("GET", "/.well-known/acme-challenge/unknown", nil)
+	w = httptest.NewRecorder()
+	m.HTTPHandler(nil).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected unknown challenges not to be found (got: %d)", w.Code)
+	}
+}
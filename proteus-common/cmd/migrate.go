@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/thetorproject/proteus/proteus-common/schema"
+	"github.com/spf13/cobra"
+)
+
+// MigrateCmd returns the migrate command of a service, open connects to its
+// database.
+func MigrateCmd(open func() (*schema.Migrator, error)) *cobra.Command {
+	var steps int
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the schema of the database",
+		Long: `The migrations are embedded in the binary, they are applied when
+the server starts unless database.auto-migrate is false.`,
+	}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they were applied",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := open()
+			if err != nil {
+				return err
+			}
+			defer m.DB.Close()
+			statuses, err := m.Status()
+			if err != nil {
+				return err
+			}
+			for _, s := range statuses {
+				state := "pending"
+				if s.Unknown {
+					state = "unknown, applied at " + s.AppliedAt
+				} else if s.Applied {
+					state = "applied at " + s.AppliedAt
+				}
+				fmt.Printf("%-48s %s\n", s.Id, state)
+			}
+			return nil
+		},
+	}
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := open()
+			if err != nil {
+				return err
+			}
+			defer m.DB.Close()
+			n, err := m.Up(steps)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("applied %d migrations\n", n)
+			return nil
+		},
+	}
+	upCmd.Flags().IntVarP(&steps, "steps", "n", 0, "How many migrations to apply, all of them if 0")
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the last migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps < 1 {
+				return fmt.Errorf("invalid number of steps: %d", steps)
+			}
+			m, err := open()
+			if err != nil {
+				return err
+			}
+			defer m.DB.Close()
+			n, err := m.Down(steps)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("reverted %d migrations\n", n)
+			return nil
+		},
+	}
+	downCmd.Flags().IntVarP(&steps, "steps", "n", 1, "How many migrations to revert")
+	migrateCmd.AddCommand(statusCmd, upCmd, downCmd)
+	return migrateCmd
+}
@@ -0,0 +1,96 @@
+// Package dbconn sets up the connection pool of the database the services
+// share and waits for the database to be up.
+package dbconn
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "dbconn",
+})
+
+// The longest wait between two connection attempts
+const maxBackoff = 16 * time.Second
+
+// Configure applies the database.max-open-conns, max-idle-conns and
+// conn-max-lifetime settings to the pool, 0 leaving the default of
+// database/sql.
+func Configure(db *sql.DB) {
+	if n := viper.GetInt("database.max-open-conns"); n > 0 {
+		db.SetMaxOpenConns(n)
+	}
+	if n := viper.GetInt("database.max-idle-conns"); n > 0 {
+		db.SetMaxIdleConns(n)
+	}
+	if d := viper.GetDuration("database.conn-max-lifetime"); d > 0 {
+		db.SetConnMaxLifetime(d)
+	}
+}
+
+// Ping waits for the database to accept connections, for at most
+// database.connect-timeout, backing off between the attempts.
+func Ping(db *sql.DB) error {
+	return ping(db, viper.GetDuration("database.connect-timeout"), time.Second)
+}
+
+func ping(db *sql.DB, timeout time.Duration, backoff time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			ctx.WithError(err).Error("giving up on connecting to the database")
+			return err
+		}
+		ctx.WithError(err).Warnf("failed to connect to the database, retrying in %s",
+									backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Open opens the database at database.url, sets up its pool and waits
+// for it to be up. Its queries are timed, see instrumentedDriver.
+func Open(driver string) (*sql.DB, error) {
+	db, err := openInstrumented(driver, viper.GetString("database.url"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to open database")
+		return nil, err
+	}
+	Configure(db)
+	if err = Ping(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenReplica opens the read-only replica at database.replica-url, or
+// returns nil when there is none. The replica not being up is not an error,
+// the reads go to the primary until it is.
+func OpenReplica(driver string) (*sql.DB, error) {
+	url := viper.GetString("database.replica-url")
+	if url == "" {
+		return nil, nil
+	}
+	db, err := openInstrumented(driver, url)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open the read replica")
+		return nil, err
+	}
+	Configure(db)
+	if err = db.Ping(); err != nil {
+		ctx.WithError(err).Warn("the read replica is unreachable")
+	}
+	return db, nil
+}
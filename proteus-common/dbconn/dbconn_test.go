@@ -0,0 +1,236 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+var errDown = errors.New("database is down")
+
+// flakyDriver refuses the first failures connections
+type flakyDriver struct {
+	failures	int
+	attempts	int
+}
+
+type flakyConn struct {
+	driver.Conn
+}
+
+func (c flakyConn) Close() error {
+	return nil
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.attempts++
+	if d.attempts <= d.failures {
+		return nil, errDown
+	}
+	return flakyConn{}, nil
+}
+
+func TestPing(t *testing.T) {
+	flaky := &flakyDriver{failures: 2}
+	sql.Register("flaky", flaky)
+	db, err := sql.Open("flaky", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = ping(db, time.Second, time.Millisecond); err != nil {
+		t.Fatalf("expected to connect on the third attempt (got: %v)", err)
+	}
+	if flaky.attempts != 3 {
+		t.Errorf("expected 3 attempts (got: %d)", flaky.attempts)
+	}
+
+	down := &flakyDriver{failures: 1000}
+	sql.Register("down", down)
+	db, err = sql.Open("down", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = ping(db, 20 * time.Millisecond, time.Millisecond); err != errDown {
+		t.Errorf("expected %v (got: %v)", errDown, err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.max-open-conns", 7)
+	sql.Register("configure", &flakyDriver{})
+	db, err := sql.Open("configure", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	Configure(db)
+	if max := db.Stats().MaxOpenConnections; max != 7 {
+		t.Errorf("expected 7 open connections at most (got: %d)", max)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err			error
+		transient	bool
+	}{
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{driver.ErrBadConn, true},
+		{context.DeadlineExceeded, false},
+		{sql.ErrNoRows, false},
+		{errDown, false},
+	}
+	for _, test := range tests {
+		if Transient(test.err) != test.transient {
+			t.Errorf("%v: expected transient to be %v", test.err, test.transient)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	serialization := &pq.Error{Code: "40001"}
+	attempts := 0
+	err := retry(context.Background(), "test", func() error {
+		attempts++
+		if attempts < 3 {
+			return serialization
+		}
+		return nil
+	}, 5, time.Millisecond)
+	if err != nil || attempts != 3 {
+		t.Errorf("expected to succeed on the third attempt (got: %v, %d)", err, attempts)
+	}
+
+	attempts = 0
+	err = retry(context.Background(), "test", func() error {
+		attempts++
+		return serialization
+	}, 2, time.Millisecond)
+	if err != serialization || attempts != 2 {
+		t.Errorf("expected to give up after 2 attempts (got: %v, %d)", err, attempts)
+	}
+
+	attempts = 0
+	err = retry(context.Background(), "test", func() error {
+		attempts++
+		return errDown
+	}, 5, time.Millisecond)
+	if err != errDown || attempts != 1 {
+		t.Errorf("expected other errors not to be retried (got: %v, %d)", err, attempts)
+	}
+
+	cx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	retry(cx, "test", func() error {
+		attempts++
+		return serialization
+	}, 5, time.Hour)
+	if attempts != 1 {
+		t.Errorf("expected no retry once the context is done (got: %d)", attempts)
+	}
+}
+
+// slowConn takes delay to run every query, failing the ones saying "fail"
+type slowConn struct {
+	flakyConn
+	delay	time.Duration
+}
+
+func (c slowConn) ExecContext(cx context.Context, query string,
+								args []driver.NamedValue) (driver.Result, error) {
+	time.Sleep(c.delay)
+	if strings.Contains(query, "fail") {
+		return nil, errDown
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type slowDriver struct {
+	delay	time.Duration
+}
+
+func (d slowDriver) Open(name string) (driver.Conn, error) {
+	return slowConn{delay: d.delay}, nil
+}
+
+func TestInstrument(t *testing.T) {
+	sql.Register("slow", slowDriver{delay: 2 * time.Millisecond})
+	db, err := openInstrumented("slow", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err = db.Exec(`UPDATE jobs
+			SET state = $1 WHERE id = $2`, "deleted", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.Exec("SELECT fail"); err != errDown {
+		t.Errorf("expected %v (got: %v)", errDown, err)
+	}
+
+	snapshot := stats.snapshot()
+	h, ok := snapshot["UPDATE jobs SET state = $1 WHERE id = $2"]
+	if !ok || h.Count != 3 || h.Errors != 0 {
+		t.Fatalf("expected the update to be timed 3 times (got: %+v)", h)
+	}
+	if h.Buckets["1ms"] != 0 || h.Buckets["5s"] != 3 || h.Buckets["+Inf"] != 3 {
+		t.Errorf("unexpected buckets %v", h.Buckets)
+	}
+	if h.Sum < 0.006 {
+		t.Errorf("expected the time of the queries to add up (got: %f)", h.Sum)
+	}
+	if failed := snapshot["SELECT fail"]; failed.Count != 1 || failed.Errors != 1 {
+		t.Errorf("expected the failed query to be counted (got: %+v)", failed)
+	}
+
+	// The driver is only registered once
+	if _, err = openInstrumented("slow", ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryStatsOverflow(t *testing.T) {
+	s := &queryStats{byStatement: make(map[string]*histogram)}
+	for i := 0; i < maxStatements + 10; i++ {
+		s.observe(fmt.Sprintf("SELECT %d", i), time.Millisecond, false)
+	}
+	snapshot := s.snapshot()
+	if len(snapshot) != maxStatements + 1 {
+		t.Errorf("expected %d statements (got: %d)", maxStatements + 1, len(snapshot))
+	}
+	if other := snapshot[otherStatements]; other.Count != 10 {
+		t.Errorf("expected 10 statements counted together (got: %d)", other.Count)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: "device-token"},
+		{Ordinal: 2, Value: int64(42)},
+		{Ordinal: 3, Value: nil},
+	}
+	redacted := redact(args)
+	if redacted != "$1 string, $2 int64, $3 NULL" {
+		t.Errorf("unexpected redacted arguments %q", redacted)
+	}
+}
@@ -0,0 +1,248 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+// The upper bounds of the buckets of the latency histograms
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// How many statements get a histogram of their own, the ones past it are
+// counted together under otherStatements
+const maxStatements = 500
+const otherStatements = "other"
+
+// histogram is the latency of a statement. Buckets counts the queries which
+// took at most every bound of latencyBuckets, and "+Inf" all of them.
+type histogram struct {
+	Count	int64 `json:"count"`
+	Errors	int64 `json:"errors"`
+	// The total time taken, in seconds
+	Sum		float64 `json:"sum"`
+	Buckets	map[string]int64 `json:"buckets"`
+}
+
+func newHistogram() *histogram {
+	h := &histogram{Buckets: make(map[string]int64)}
+	for _, bound := range latencyBuckets {
+		h.Buckets[bound.String()] = 0
+	}
+	h.Buckets["+Inf"] = 0
+	return h
+}
+
+func (h *histogram) observe(d time.Duration, failed bool) {
+	h.Count++
+	if failed {
+		h.Errors++
+	}
+	h.Sum += d.Seconds()
+	for _, bound := range latencyBuckets {
+		if d <= bound {
+			h.Buckets[bound.String()]++
+		}
+	}
+	h.Buckets["+Inf"]++
+}
+
+// queryStats are the histograms of the queries by statement
+type queryStats struct {
+	lock	sync.Mutex
+	byStatement	map[string]*histogram
+}
+
+func (s *queryStats) observe(statement string, d time.Duration, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, ok := s.byStatement[statement]
+	if !ok {
+		if len(s.byStatement) >= maxStatements {
+			statement = otherStatements
+			h = s.byStatement[statement]
+		}
+		if h == nil {
+			h = newHistogram()
+			s.byStatement[statement] = h
+		}
+	}
+	h.observe(d, failed)
+}
+
+func (s *queryStats) snapshot() map[string]histogram {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snapshot := make(map[string]histogram, len(s.byStatement))
+	for statement, h := range s.byStatement {
+		copied := *h
+		copied.Buckets = make(map[string]int64, len(h.Buckets))
+		for bound, n := range h.Buckets {
+			copied.Buckets[bound] = n
+		}
+		snapshot[statement] = copied
+	}
+	return snapshot
+}
+
+// stats are published with expvar as "db_queries"
+var stats = &queryStats{byStatement: make(map[string]*histogram)}
+
+func init() {
+	expvar.Publish("db_queries", expvar.Func(func() interface{} {
+		return stats.snapshot()
+	}))
+}
+
+// normalize collapses the whitespace of the query, the statements being
+// the same whichever way they are indented
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// redact describes the arguments of a query by their type only, their
+// values may be personal data such as the tokens of the devices
+func redact(args []driver.NamedValue) string {
+	described := make([]string, len(args))
+	for i, arg := range args {
+		if arg.Value == nil {
+			described[i] = fmt.Sprintf("$%d NULL", arg.Ordinal)
+		} else {
+			described[i] = fmt.Sprintf("$%d %T", arg.Ordinal, arg.Value)
+		}
+	}
+	return strings.Join(described, ", ")
+}
+
+// observe records the query in the histograms, and logs it when it took
+// longer than database.slow-query-threshold
+func observe(query string, args []driver.NamedValue, start time.Time, err error) {
+	// The driver wants database/sql to prepare the query instead
+	if err == driver.ErrSkip {
+		return
+	}
+	d := time.Since(start)
+	statement := normalize(query)
+	stats.observe(statement, d, err != nil)
+	threshold := viper.GetDuration("database.slow-query-threshold")
+	if threshold > 0 && d > threshold {
+		ctx.WithFields(log.Fields{
+			"query": statement,
+			"args": redact(args),
+			"duration": d.String(),
+		}).Warn("slow query")
+	}
+}
+
+// instrumentedDriver times the queries run on the connections of the
+// driver it wraps. The queries of the statements prepared explicitly, e.g.
+// by pq.CopyIn, aren't timed.
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) QueryContext(cx context.Context, query string,
+										args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(cx, query, args)
+	observe(query, args, start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) ExecContext(cx context.Context, query string,
+										args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := execer.ExecContext(cx, query, args)
+	observe(query, args, start, err)
+	return res, err
+}
+
+func (c *instrumentedConn) BeginTx(cx context.Context,
+									opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(cx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(cx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(cx)
+	}
+	return nil
+}
+
+var (
+	instrumentedLock	sync.Mutex
+	instrumented		= make(map[string]bool)
+)
+
+// instrument registers the driver wrapped by an instrumentedDriver, under
+// its name with an "-instrumented" suffix which it returns
+func instrument(name string) (string, error) {
+	instrumentedLock.Lock()
+	defer instrumentedLock.Unlock()
+	wrapped := name + "-instrumented"
+	if instrumented[name] {
+		return wrapped, nil
+	}
+	// Opening doesn't connect, it only looks up the driver
+	db, err := sql.Open(name, "")
+	if err != nil {
+		return "", err
+	}
+	sql.Register(wrapped, instrumentedDriver{db.Driver()})
+	db.Close()
+	instrumented[name] = true
+	return wrapped, nil
+}
+
+// openInstrumented opens the database with the driver wrapped by an
+// instrumentedDriver
+func openInstrumented(name string, url string) (*sql.DB, error) {
+	wrapped, err := instrument(name)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open(wrapped, url)
+}
@@ -0,0 +1,102 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// retryStats counts the retries of the operations failing with a transient
+// error, published with expvar as "db_retries".
+var retryStats = expvar.NewMap("db_retries")
+
+// The longest wait between two attempts of an operation
+const maxRetryBackoff = 2 * time.Second
+
+// transientCodes are the SQLSTATE codes of the errors worth retrying,
+// besides the connection exceptions of class 08
+var transientCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// Transient tells whether the operation failing with err may succeed if
+// it's tried again: the transaction lost a serialization conflict, or the
+// connection was lost to a restart or a failover.
+func Transient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return transientCodes[pqErr.Code] ||
+				strings.HasPrefix(string(pqErr.Code), "08")
+	}
+	// A query running out of time will do so again
+	if errors.Is(err, context.Canceled) ||
+			errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.As(err, &netErr)
+}
+
+// Retry runs op until it succeeds, fails with an error which isn't
+// transient, or has been tried database.retry-attempts times. The attempts
+// are spaced by a jittered backoff starting at database.retry-backoff, and
+// stop as soon as cx is done.
+func Retry(cx context.Context, name string, op func() error) error {
+	return retry(cx, name, op, viper.GetInt("database.retry-attempts"),
+					viper.GetDuration("database.retry-backoff"))
+}
+
+func retry(cx context.Context, name string, op func() error,
+			attempts int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			if attempt > 1 {
+				retryStats.Add("recovered", 1)
+			}
+			return nil
+		}
+		if !Transient(err) {
+			return err
+		}
+		if attempt >= attempts {
+			retryStats.Add("exhausted", 1)
+			ctx.WithError(err).Errorf("%s failed after %d attempts", name, attempt)
+			return err
+		}
+		// Half of the backoff is random so that the instances hit by the
+		// same failover don't all come back at once
+		wait := backoff / 2
+		if wait > 0 {
+			wait += time.Duration(rand.Int63n(int64(wait)))
+		}
+		ctx.WithError(err).Warnf("%s failed, retrying in %s", name, wait)
+		retryStats.Add("retries", 1)
+		select {
+		case <-time.After(wait):
+		case <-cx.Done():
+			return err
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
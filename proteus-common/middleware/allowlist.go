@@ -0,0 +1,153 @@
+package proteus_mw
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// IPAllowlist only lets through the requests of the Allowed networks. The
+// address of the client is taken from X-Forwarded-For when the request
+// comes from one of the TrustedProxies, and only then, since anyone can
+// send the header.
+type IPAllowlist struct {
+	Allowed			[]*net.IPNet
+	TrustedProxies	[]*net.IPNet
+}
+
+// parseNetworks parses CIDRs, plain IP addresses being networks of one
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8 * net.IPv4len
+			}
+			networks = append(networks,
+								&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPAllowlistFromConfig reads the allowed-ips and trusted-proxies of the
+// config section, it returns nil, which lets every request through, when
+// allowed-ips is empty.
+func IPAllowlistFromConfig(section string) (*IPAllowlist, error) {
+	allowed := viper.GetStringSlice(section + ".allowed-ips")
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+	var (
+		l	IPAllowlist
+		err	error
+	)
+	l.Allowed, err = parseNetworks(allowed)
+	if err != nil {
+		return nil, err
+	}
+	l.TrustedProxies, err = parseNetworks(
+					viper.GetStringSlice(section + ".trusted-proxies"))
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ClientIP returns the address of the client of the request: the peer, or
+// when it's a trusted proxy the last address of X-Forwarded-For that isn't
+// one, the addresses before it are whatever the client sent.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(trustedProxies, ip) {
+		return ip
+	}
+	var hops []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// Can't tell who sent the rest
+			return ip
+		}
+		ip = hop
+		if !contains(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// clientAddress is ClientIP as a string, the peer as is when it isn't an
+// address, to key the clients of the limits by.
+func clientAddress(r *http.Request, trustedProxies []*net.IPNet) string {
+	if ip := ClientIP(r, trustedProxies); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// TrustedProxiesFromConfig reads api.trusted-proxies, the proxies whose
+// X-Forwarded-For the limits believe. A broken list trusts none, the
+// clients are then told apart by the address of their peer.
+func TrustedProxiesFromConfig() []*net.IPNet {
+	proxies, err := parseNetworks(viper.GetStringSlice("api.trusted-proxies"))
+	if err != nil {
+		ctx.WithError(err).Error("invalid api.trusted-proxies, trusting none")
+		return nil
+	}
+	return proxies
+}
+
+// ClientIP returns the address of the client of the request, see ClientIP
+func (l *IPAllowlist) ClientIP(r *http.Request) net.IP {
+	return ClientIP(r, l.TrustedProxies)
+}
+
+// Handler refuses the requests of the addresses that aren't allowed
+func (l *IPAllowlist) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+		ip := l.ClientIP(c.Request)
+		if ip == nil || !contains(l.Allowed, ip) {
+			ctx.WithField("ip", ip.String()).Warn("address not allowed")
+			c.JSON(http.StatusForbidden, gin.H{"error": "address not allowed"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
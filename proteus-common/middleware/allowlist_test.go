@@ -0,0 +1,64 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	viper.Set("admin.allowed-ips", []string{"10.1.0.0/16", "2001:db8::1"})
+	viper.Set("admin.trusted-proxies", []string{"192.168.0.1"})
+	defer viper.Set("admin.allowed-ips", nil)
+	defer viper.Set("admin.trusted-proxies", nil)
+	allowlist, err := IPAllowlistFromConfig("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/admin", allowlist.Handler(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	for _, tc := range []struct {
+		remoteAddr		string
+		forwardedFor	string
+		code			int
+	}{
+		{"10.1.2.3:1234", "", http.StatusOK},
+		{"[2001:db8::1]:1234", "", http.StatusOK},
+		{"10.2.2.3:1234", "", http.StatusForbidden},
+		// Only the trusted proxies can forward
+		{"10.2.2.3:1234", "10.1.2.3", http.StatusForbidden},
+		{"192.168.0.1:1234", "10.1.2.3", http.StatusOK},
+		{"192.168.0.1:1234", "10.2.2.3", http.StatusForbidden},
+		// The client can prepend what it wants
+		{"192.168.0.1:1234", "10.1.2.3, 10.2.2.3", http.StatusForbidden},
+		{"192.168.0.1:1234", "10.2.2.3, 10.1.2.3, 192.168.0.1", http.StatusOK},
+		{"192.168.0.1:1234", "", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s forwarding for %q: expected %d (got: %d)",
+						tc.remoteAddr, tc.forwardedFor, tc.code, w.Code)
+		}
+	}
+
+	viper.Set("admin.allowed-ips", []string{"10.1.0.0/33"})
+	if _, err := IPAllowlistFromConfig("admin"); err == nil {
+		t.Error("expected an invalid network to be refused")
+	}
+	viper.Set("admin.allowed-ips", nil)
+	if allowlist, _ := IPAllowlistFromConfig("admin"); allowlist != nil {
+		t.Error("expected no allowlist without allowed-ips")
+	}
+}
@@ -0,0 +1,170 @@
+package proteus_mw
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "middleware",
+})
+
+// APIKeyPrefix starts every API key, telling them apart from the JWT tokens
+// sent in the same Authorization header.
+const APIKeyPrefix = "proteus_"
+
+// APIKey lets scripts use the admin API without logging in. Its Scopes are
+// the roles it acts with, which can't go beyond the role of the account
+// that created it. Only a hash of the key is stored, the key itself is only
+// returned when it's created.
+type APIKey struct {
+	Id				string `json:"id"`
+	Name			string `json:"name" binding:"required"`
+	// The beginning of the key, to tell which key is which
+	Prefix			string `json:"prefix"`
+	Scopes			[]string `json:"scopes" binding:"required"`
+	CreatedBy		string `json:"created_by"`
+	CreationTime	time.Time `json:"creation_time"`
+	LastUsed		*time.Time `json:"last_used"`
+	RevokedAt		*time.Time `json:"revoked_at"`
+}
+
+var ErrInvalidScope = errors.New("invalid api key scope")
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// hashSecret is how the API keys and the refresh tokens are stored, they
+// are random enough not to need a salt
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// scopeRole is the strongest of the roles in scopes
+func scopeRole(scopes []string) string {
+	role := ""
+	for _, s := range scopes {
+		if staffRoleRanks[s] > staffRoleRanks[role] {
+			role = s
+		}
+	}
+	return role
+}
+
+// CreateAPIKey stores a new key for the account and returns it
+func CreateAPIKey(db *sqlx.DB, k APIKey, creator Account) (string, APIKey, error) {
+	if len(k.Scopes) == 0 {
+		return "", k, ErrInvalidScope
+	}
+	for _, s := range k.Scopes {
+		if !IsStaffRole(s) || !HasRole(creator, s) {
+			return "", k, ErrInvalidScope
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", k, err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	k.Id = uuid.NewV4().String()
+	k.Prefix = key[:len(APIKeyPrefix) + 6]
+	k.CreatedBy = creator.Username
+	k.CreationTime = time.Now().UTC()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, name, key_prefix, key_hash, scopes, created_by, creation_time
+	) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		pq.QuoteIdentifier(viper.GetString("database.api-keys-table")))
+	_, err := db.Exec(query, k.Id, k.Name, k.Prefix, hashSecret(key),
+						pq.Array(k.Scopes), k.CreatedBy, k.CreationTime)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into api keys table")
+		return "", k, err
+	}
+	return key, k, nil
+}
+
+// ListAPIKeys returns the keys, including the revoked ones, the most recent
+// first.
+func ListAPIKeys(db *sqlx.DB) ([]APIKey, error) {
+	var keys = make([]APIKey, 0)
+	query := fmt.Sprintf(`SELECT
+		id, name, key_prefix, scopes, COALESCE(created_by, ''),
+		creation_time, last_used, revoked_at
+		FROM %s ORDER BY creation_time DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.api-keys-table")))
+	rows, err := db.Query(query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list api keys")
+		return keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k APIKey
+		err = rows.Scan(&k.Id, &k.Name, &k.Prefix, pq.Array(&k.Scopes),
+						&k.CreatedBy, &k.CreationTime, &k.LastUsed, &k.RevokedAt)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over api keys")
+			return keys, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops accepting the key
+func RevokeAPIKey(db *sqlx.DB, id string) error {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.api-keys-table")))
+	res, err := db.Exec(query, id, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to revoke api key")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// authenticateAPIKey returns the account the key acts as, named after the
+// key so that what it does can be told apart from its creator.
+func authenticateAPIKey(db *sqlx.DB, key string) (Account, bool) {
+	var (
+		account Account
+		id string
+		scopes []string
+	)
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return account, false
+	}
+	query := fmt.Sprintf(`UPDATE %s SET last_used = $2
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING id, scopes`,
+		pq.QuoteIdentifier(viper.GetString("database.api-keys-table")))
+	err := db.QueryRow(query, hashSecret(key), time.Now().UTC()).Scan(
+		&id, pq.Array(&scopes))
+	if err != nil {
+		return account, false
+	}
+	account.Username = "apikey:" + id
+	account.Role = scopeRole(scopes)
+	account.Scopes = ScopesForRole(account.Role)
+	return account, true
+}
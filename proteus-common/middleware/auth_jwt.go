@@ -9,9 +9,12 @@ import (
 	"net/http"
 	"database/sql"
 
+	"github.com/thetorproject/proteus/proteus-common/probes"
+
 	"github.com/lib/pq"
 	"github.com/jmoiron/sqlx"
 	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
 	"github.com/spf13/viper"
 	"gopkg.in/dgrijalva/jwt-go.v3"
 	"golang.org/x/crypto/bcrypt"
@@ -25,12 +28,17 @@ import (
 type ProteusClaims struct {
 	Role string `json:"role"`
 	User string `json:"user"`
+	Scopes []string `json:"scopes,omitempty"`
+	// The session the token was issued to, see Session
+	Session string `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
 type Account struct {
 	Username string
 	Role string
+	// The scopes granted to the token, see RequireScope
+	Scopes []string
 }
 // GinJWTMiddleware provides a Json-Web-Token authentication implementation. On failure, a 401 HTTP response
 // is returned. On success, the wrapped middleware is called, and the userID is made available as
@@ -51,11 +59,30 @@ type GinJWTMiddleware struct {
 	// Duration that a jwt token is valid. Optional, defaults to one hour.
 	Timeout time.Duration
 
-	// This field allows clients to refresh their token until MaxRefresh has passed.
-	// Note that clients can refresh their token in the last moment of MaxRefresh.
-	// This means that the maximum validity timespan for a token is MaxRefresh + Timeout.
-	// Optional, defaults to 0 meaning not refreshable.
-	MaxRefresh time.Duration
+	// Duration that a refresh token is valid. Every refresh returns a new
+	// refresh token, so clients refreshing often enough stay logged in.
+	// Optional, defaults to 30 days.
+	RefreshTimeout time.Duration
+
+	// Lets the requests to the admin API in without auth, see AuthEnforced.
+	DisableStaffAuth bool
+
+	// Checks the requests probes signed instead of sending a token.
+	// Optional, signed requests are refused when not set.
+	Signatures *SignatureVerifier
+
+	// The OpenID Connect provider the staff can log in with. Optional.
+	OIDC *OIDCProvider
+
+	// Delays and locks out the logins after failed ones. Optional.
+	Throttle *LoginThrottle
+
+	// The second factor of the staff logins. Optional.
+	TOTP *TOTPStore
+
+	// Where the refresh tokens and the revoked tokens are kept. Optional,
+	// no refresh token is issued when not set.
+	Tokens *TokenStore
 
 	// Callback function that should perform the authentication of the user based on userID and
 	// password. Must return true on success, false on failure. Required.
@@ -72,6 +99,11 @@ type GinJWTMiddleware struct {
 	// Set the identity handler function
 	IdentityHandler func(*ProteusClaims) Account
 
+	// Callback function that should return the account an API key acts as,
+	// sent instead of a token by scripts. Optional, API keys are refused
+	// when not set.
+	APIKeyAuthenticator func(key string, c *gin.Context) (Account, bool)
+
 	// TokenLookup is a string in the form of "<source>:<name>" that is used
 	// to extract token from the request.
 	// Optional. Default value "header:Authorization".
@@ -97,6 +129,8 @@ type Authorizator func(account Account, c *gin.Context) bool
 type Login struct {
 	Username string `form:"username" json:"username" binding:"required"`
 	Password string `form:"password" json:"password" binding:"required"`
+	// The TOTP or recovery code of the staff accounts with TOTP
+	OTP string `form:"otp" json:"otp"`
 }
 
 // MiddlewareInit initialize jwt configs.
@@ -114,6 +148,10 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		mw.Timeout = time.Hour
 	}
 
+	if mw.RefreshTimeout == 0 {
+		mw.RefreshTimeout = 30 * 24 * time.Hour
+	}
+
 	if mw.TimeFunc == nil {
 		mw.TimeFunc = time.Now
 	}
@@ -137,6 +175,7 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 			return Account{
 				Username: claims.User,
 				Role: claims.Role,
+				Scopes: claims.Scopes,
 			}
 		}
 	}
@@ -168,18 +207,50 @@ func (mw *GinJWTMiddleware) MiddlewareFunc(auth Authorizator) gin.HandlerFunc {
 }
 
 func (mw *GinJWTMiddleware) middlewareImpl(auth Authorizator, c *gin.Context) {
-	token, err := mw.parseToken(c)
+	var account Account
 
-	if err != nil {
-		mw.unauthorized(c, http.StatusUnauthorized, err.Error())
-		return
-	}
+	key, err := mw.jwtFromHeader(c, "Authorization")
+	if strings.HasPrefix(c.Request.Header.Get("Authorization"), SignatureScheme + " ") {
+		if mw.Signatures == nil {
+			mw.unauthorized(c, http.StatusUnauthorized, ErrInvalidSignature.Error())
+			return
+		}
+		account, err = mw.Signatures.Verify(c, mw.TimeFunc())
+		if err != nil {
+			mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+	} else if err == nil && strings.HasPrefix(key, APIKeyPrefix) {
+		ok := false
+		if mw.APIKeyAuthenticator != nil {
+			account, ok = mw.APIKeyAuthenticator(key, c)
+		}
+		if !ok {
+			mw.unauthorized(c, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+	} else {
+		token, err := mw.parseToken(c)
+
+		if err != nil {
+			mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+			return
+		}
 
-	claims := token.Claims.(*ProteusClaims)
+		claims := token.Claims.(*ProteusClaims)
+		if mw.Tokens != nil && (claims.Id != "" || claims.Session != "") {
+			revoked, err := mw.Tokens.IsRevoked(claims)
+			if err != nil || revoked {
+				mw.unauthorized(c, http.StatusUnauthorized, "Token is revoked.")
+				return
+			}
+		}
 
-	account := mw.IdentityHandler(claims)
-	c.Set("JWT_PAYLOAD", claims)
+		account = mw.IdentityHandler(claims)
+		c.Set("JWT_PAYLOAD", claims)
+	}
 	c.Set("userID", account.Username)
+	c.Set("account", account)
 
 	if !auth(account, c) {
 		mw.unauthorized(c, http.StatusForbidden, "You don't have permission to access.")
@@ -209,19 +280,145 @@ func (mw *GinJWTMiddleware) LoginHandler(c *gin.Context) {
 		return
 	}
 
+	account, ok := mw.checkPassword(c, loginVals)
+	if !ok {
+		return
+	}
+	if err := mw.TOTP.Check(account, loginVals.OTP); err != nil {
+		mw.refuseOTP(c, loginVals, err)
+		return
+	}
+	mw.Throttle.Succeed(loginVals.Username)
+
+	mw.respondWithTokens(c, account, "")
+}
+
+// checkPassword authenticates the username and password of the login, and
+// replies when they are wrong.
+func (mw *GinJWTMiddleware) checkPassword(c *gin.Context, loginVals Login) (Account, bool) {
+	if wait := mw.Throttle.Wait(loginVals.Username, mw.Throttle.clientIP(c), mw.TimeFunc()); wait > 0 {
+		mw.Throttle.refuse(c, wait)
+		return Account{}, false
+	}
+
 	account, ok := mw.Authenticator(loginVals.Username, loginVals.Password, c)
 
 	if !ok {
+		mw.Throttle.Fail(loginVals.Username, mw.Throttle.clientIP(c), mw.TimeFunc())
 		mw.unauthorized(c, http.StatusUnauthorized, "wrong-username-password")
+		return account, false
+	}
+	return account, true
+}
+
+// refuseOTP replies to a login whose second factor is missing or wrong, the
+// wrong codes count as failed logins.
+func (mw *GinJWTMiddleware) refuseOTP(c *gin.Context, loginVals Login, err error) {
+	switch err {
+	case ErrInvalidOTP:
+		mw.Throttle.Fail(loginVals.Username, mw.Throttle.clientIP(c), mw.TimeFunc())
+		mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+	case ErrOTPRequired, ErrOTPEnrollmentRequired:
+		mw.unauthorized(c, http.StatusUnauthorized, err.Error())
+	case ErrOTPNotEnrolling:
+		mw.unauthorized(c, http.StatusConflict, err.Error())
+	default:
+		mw.unauthorized(c, http.StatusInternalServerError, "Check otp failed")
+	}
+}
+
+// TOTPEnrollHandler gives the staff account of the login a new TOTP secret.
+// Payload needs to be json in the form of {"username": "USERNAME", "password": "PASSWORD"}.
+// Reply will be of the form {"secret": "SECRET", "otpauth_url": "URL"}, the
+// URL is the one of the QR code to scan with an authenticator app.
+func (mw *GinJWTMiddleware) TOTPEnrollHandler(c *gin.Context) {
+	mw.MiddlewareInit()
+
+	var loginVals Login
+	if c.BindJSON(&loginVals) != nil {
+		mw.unauthorized(c, http.StatusBadRequest, "missing-username-password")
+		return
+	}
+	if mw.TOTP == nil || mw.Authenticator == nil {
+		mw.unauthorized(c, http.StatusInternalServerError, "Missing define totp store")
+		return
+	}
+	account, ok := mw.checkPassword(c, loginVals)
+	if !ok {
+		return
+	}
+	// The admin account of the configuration uses auth.admin-totp-secret
+	if !IsStaffRole(account.Role) || account.Username == "admin" {
+		mw.unauthorized(c, http.StatusForbidden, "otp-not-available")
+		return
+	}
+	secret, otpURL, err := mw.TOTP.Enroll(account.Username)
+	if err != nil {
+		mw.refuseOTP(c, loginVals, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_url": otpURL})
+}
+
+// TOTPConfirmHandler turns TOTP on for the staff account of the login, once
+// it sends a code of the secret it got from TOTPEnrollHandler.
+// Payload needs to be json in the form of {"username": "USERNAME", "password": "PASSWORD", "otp": "CODE"}.
+// Reply will be of the form {"recovery_codes": ["CODE", ...]}, to log in
+// without the authenticator app, once each.
+func (mw *GinJWTMiddleware) TOTPConfirmHandler(c *gin.Context) {
+	mw.MiddlewareInit()
+
+	var loginVals Login
+	if c.BindJSON(&loginVals) != nil {
+		mw.unauthorized(c, http.StatusBadRequest, "missing-username-password")
+		return
+	}
+	if mw.TOTP == nil || mw.Authenticator == nil {
+		mw.unauthorized(c, http.StatusInternalServerError, "Missing define totp store")
 		return
 	}
+	account, ok := mw.checkPassword(c, loginVals)
+	if !ok {
+		return
+	}
+	codes, err := mw.TOTP.Confirm(account.Username, loginVals.OTP)
+	if err != nil {
+		mw.refuseOTP(c, loginVals, err)
+		return
+	}
+	mw.Throttle.Succeed(loginVals.Username)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// respondWithTokens replies with a new access token for the account and,
+// when there is a TokenStore, a new refresh token of the family.
+func (mw *GinJWTMiddleware) respondWithTokens(c *gin.Context, account Account,
+												familyID string) {
+	refreshExpire := mw.TimeFunc().Add(mw.RefreshTimeout)
+	if mw.Tokens != nil {
+		var err error
+		if familyID == "" {
+			familyID, err = mw.Tokens.StartSession(account,
+							c.Request.UserAgent(), c.ClientIP(), refreshExpire)
+		} else {
+			err = mw.Tokens.touchSession(familyID, refreshExpire)
+		}
+		if err != nil {
+			mw.unauthorized(c, http.StatusInternalServerError,
+							"Create session failed")
+			return
+		}
+	}
 
 	// Create the token
 	expire := mw.TimeFunc().Add(mw.Timeout)
 	claims := ProteusClaims{
 		Role: account.Role,
 		User: account.Username,
+		Scopes: ScopesForRole(account.Role),
+		Session: familyID,
 		StandardClaims: jwt.StandardClaims{
+			Id: uuid.NewV4().String(),
 			ExpiresAt: expire.Unix(),
 			IssuedAt: mw.TimeFunc().Unix(),
 		},
@@ -235,49 +432,95 @@ func (mw *GinJWTMiddleware) LoginHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	reply := gin.H{
 		"token":  tokenString,
 		"expire": expire.Format(time.RFC3339),
-	})
+	}
+	if mw.Tokens != nil {
+		refreshToken, err := mw.Tokens.Issue(account, familyID, refreshExpire)
+		if err != nil {
+			mw.unauthorized(c, http.StatusInternalServerError,
+							"Create refresh token failed")
+			return
+		}
+		reply["refresh_token"] = refreshToken
+		reply["refresh_expire"] = refreshExpire.Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, reply)
 }
 
-// RefreshHandler can be used to refresh a token. The token still needs to be valid on refresh.
-// Shall be put under an endpoint that is using the GinJWTMiddleware.
-// Reply will be of the form {"token": "TOKEN"}.
+// Refresh request structure.
+type Refresh struct {
+	RefreshToken string `form:"refresh_token" json:"refresh_token" binding:"required"`
+}
+
+// RefreshHandler can be used by clients to trade their refresh token for a
+// new access token and a new refresh token, the old one can't be used again.
+// Payload needs to be json in the form of {"refresh_token": "REFRESH_TOKEN"}.
+// Reply will be of the form {"token": "TOKEN", "refresh_token": "REFRESH_TOKEN"}.
 func (mw *GinJWTMiddleware) RefreshHandler(c *gin.Context) {
-	token, _ := mw.parseToken(c)
-	claims := token.Claims.(*ProteusClaims)
+	mw.MiddlewareInit()
 
-	origIat := int64(claims.StandardClaims.IssuedAt)
+	var refreshVals Refresh
 
-	if origIat < mw.TimeFunc().Add(-mw.MaxRefresh).Unix() {
-		mw.unauthorized(c, http.StatusUnauthorized, "Token is expired.")
+	if c.BindJSON(&refreshVals) != nil {
+		mw.unauthorized(c, http.StatusBadRequest, "missing-refresh-token")
 		return
 	}
 
-	// Create the token
-	expire := mw.TimeFunc().Add(mw.Timeout)
-	newClaims := ProteusClaims{
-		Role: claims.Role,
-		User: claims.User,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expire.Unix(),
-			IssuedAt: origIat,
-		},
+	if mw.Tokens == nil {
+		mw.unauthorized(c, http.StatusInternalServerError, "Missing define token store")
+		return
 	}
-	newToken := jwt.NewWithClaims(jwt.GetSigningMethod(mw.SigningAlgorithm), newClaims)
-
-	tokenString, err := newToken.SignedString(mw.Key)
 
+	account, familyID, err := mw.Tokens.Use(refreshVals.RefreshToken)
 	if err != nil {
-		mw.unauthorized(c, http.StatusUnauthorized, "Create JWT Token faild")
+		mw.unauthorized(c, http.StatusUnauthorized, "invalid-refresh-token")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":  tokenString,
-		"expire": expire.Format(time.RFC3339),
-	})
+	mw.respondWithTokens(c, account, familyID)
+}
+
+// LogoutHandler revokes the access token in the Authorization header and
+// the family of the refresh token in the payload, both are optional.
+// Payload needs to be json in the form of {"refresh_token": "REFRESH_TOKEN"}.
+func (mw *GinJWTMiddleware) LogoutHandler(c *gin.Context) {
+	mw.MiddlewareInit()
+
+	if mw.Tokens == nil {
+		mw.unauthorized(c, http.StatusInternalServerError, "Missing define token store")
+		return
+	}
+
+	if token, err := mw.parseToken(c); err == nil {
+		claims := token.Claims.(*ProteusClaims)
+		if claims.Id != "" {
+			err = mw.Tokens.RevokeAccessToken(claims.Id,
+										time.Unix(claims.ExpiresAt, 0).UTC())
+			if err != nil {
+				mw.unauthorized(c, http.StatusInternalServerError, "Revoke token failed")
+				return
+			}
+		}
+		if claims.Session != "" {
+			err = mw.Tokens.RevokeSession(claims.Session)
+			if err != nil && err != ErrSessionNotFound {
+				mw.unauthorized(c, http.StatusInternalServerError, "Revoke token failed")
+				return
+			}
+		}
+	}
+
+	var refreshVals Refresh
+	if c.BindJSON(&refreshVals) == nil {
+		if err := mw.Tokens.RevokeToken(refreshVals.RefreshToken); err != nil {
+			mw.unauthorized(c, http.StatusInternalServerError, "Revoke token failed")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
 }
 
 // ExtractClaims help to extract the JWT claims
@@ -389,11 +632,23 @@ func (mw *GinJWTMiddleware) unauthorized(c *gin.Context, code int, message strin
 }
 
 func InitAuthMiddleware(db *sqlx.DB) (*GinJWTMiddleware, error) {
+	enforced, err := AuthEnforced()
+	if err != nil {
+		return nil, err
+	}
 	return &GinJWTMiddleware{
 		Realm:      "Proteus Realm",
 		Key:        []byte(viper.GetString("auth.jwt-token")),
-		Timeout:    time.Hour,
-		MaxRefresh: time.Hour,
+		Timeout:    viper.GetDuration("auth.access-token-lifetime"),
+		RefreshTimeout: viper.GetDuration("auth.refresh-token-lifetime"),
+		Tokens:     NewTokenStore(db),
+		DisableStaffAuth: !enforced,
+		OIDC:       NewOIDCProvider(),
+		Throttle:   LoginThrottleFromConfig(),
+		TOTP:       NewTOTPStore(db),
+		Signatures: NewSignatureVerifier(func(clientID string) (string, error) {
+			return probes.RequestSecret(db, clientID)
+		}, viper.GetDuration("auth.signature-max-skew")),
 		Authenticator: func(userId string, password string, c *gin.Context) (Account, bool) {
 			var (
 				passwordHash string
@@ -406,7 +661,7 @@ func InitAuthMiddleware(db *sqlx.DB) (*GinJWTMiddleware, error) {
 				}
 				adminPassword := []byte(viper.GetString("auth.admin-password"))
 				if (subtle.ConstantTimeCompare([]byte(password), adminPassword) == 1) {
-					account.Role = "admin"
+					account.Role = AdminRole
 					return account, true
 				}
 				return account, false
@@ -429,8 +684,14 @@ func InitAuthMiddleware(db *sqlx.DB) (*GinJWTMiddleware, error) {
 			if err != nil {
 				return account, false
 			}
+			if blocked, _ := probes.IsBlocked(db, userId); blocked {
+				return account, false
+			}
 			return account, true
 		},
+		APIKeyAuthenticator: func(key string, c *gin.Context) (Account, bool) {
+			return authenticateAPIKey(db, key)
+		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
 			c.JSON(code, gin.H{
 				"code":    code,
@@ -444,14 +705,14 @@ func InitAuthMiddleware(db *sqlx.DB) (*GinJWTMiddleware, error) {
 }
 
 func AdminAuthorizor(account Account, c *gin.Context) bool {
-	if account.Role == "admin" {
+	if account.Role == AdminRole {
 		return true
 	}
 	return false
 }
 
 func DeviceAuthorizor(account Account, c *gin.Context) bool {
-	if account.Role == "device" {
+	if account.Role == DeviceRole {
 		return true
 	}
 	return false
@@ -0,0 +1,85 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func testMiddleware() *GinJWTMiddleware {
+	return &GinJWTMiddleware{
+		Realm: "Proteus Test Realm",
+		Key: []byte("secret"),
+		Timeout: time.Hour,
+		TimeFunc: time.Now,
+	}
+}
+
+// testRouter mimics the admin API of the services
+func testRouter(mw *GinJWTMiddleware) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := router.Group("/api/v1/admin")
+	admin.Use(mw.StaffMiddlewareFunc(StaffAuthorizor),
+				RequireScope(JobsAdminScope))
+	{
+		operator := RequireRole(OperatorRole)
+		admin.GET("/jobs", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"jobs": []string{}})
+		})
+		admin.POST("/job", operator, func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"id": "job"})
+		})
+	}
+	return router
+}
+
+func testToken(t *testing.T, mw *GinJWTMiddleware, role string, expires time.Time) string {
+	return testScopedToken(t, mw, role, ScopesForRole(role), expires)
+}
+
+func testScopedToken(t *testing.T, mw *GinJWTMiddleware, role string,
+						scopes []string, expires time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, ProteusClaims{
+		Role: role,
+		User: role + "-user",
+		Scopes: scopes,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: expires.Unix()},
+	})
+	signed, err := token.SignedString(mw.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthEnforced(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("auth.enforce", true)
+	if enforced, err := AuthEnforced(); !enforced || err != nil {
+		t.Errorf("expected auth to be enforced (got: %v, %v)", enforced, err)
+	}
+
+	viper.Set("auth.enforce", false)
+	viper.Set("core.environment", "production")
+	viper.Set("auth.dev-disable-auth", true)
+	if _, err := AuthEnforced(); err != ErrAuthNotEnforced {
+		t.Error("expected disabling auth in production to fail")
+	}
+
+	viper.Set("core.environment", "development")
+	viper.Set("auth.dev-disable-auth", false)
+	if _, err := AuthEnforced(); err != ErrAuthNotEnforced {
+		t.Error("expected disabling auth without the dev flag to fail")
+	}
+
+	viper.Set("auth.dev-disable-auth", true)
+	if enforced, err := AuthEnforced(); enforced || err != nil {
+		t.Errorf("expected auth to be disabled (got: %v, %v)", enforced, err)
+	}
+}
@@ -0,0 +1,28 @@
+package proteus_mw
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RejectBlocked refuses the requests of the probes isBlocked tells are in
+// the blocklist, it goes after the DeviceAuthorizor middleware.
+func RejectBlocked(isBlocked func(cx context.Context,
+									clientID string) (bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID, ok := c.Get("userID"); ok {
+			blocked, err := isBlocked(c.Request.Context(), userID.(string))
+			if err == nil && blocked {
+				c.JSON(http.StatusForbidden,
+						gin.H{"error": probes.ErrBlocked.Error()})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
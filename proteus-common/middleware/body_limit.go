@@ -0,0 +1,86 @@
+package proteus_mw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+var ErrBodyTooLarge = errors.New("request body too large")
+var ErrJSONTooDeep = errors.New("request body nested too deeply")
+
+// jsonDepth checks that the JSON document isn't nested deeper than max. It
+// stops at the first syntax error, BindJSON reports those.
+func jsonDepth(data []byte, max int) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > max {
+				return ErrJSONTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// LimitBody refuses the requests whose body is larger than maxSize bytes, or
+// is JSON nested deeper than maxDepth, before the handlers decode them. The
+// body is read in memory for that, which maxSize bounds.
+func LimitBody(maxSize int64, maxDepth int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge,
+					gin.H{"error": ErrBodyTooLarge.Error()})
+			c.Abort()
+			return
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxSize + 1))
+		c.Request.Body.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			c.Abort()
+			return
+		}
+		if int64(len(data)) > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge,
+					gin.H{"error": ErrBodyTooLarge.Error()})
+			c.Abort()
+			return
+		}
+		if maxDepth > 0 {
+			if err := jsonDepth(data, maxDepth); err != nil {
+				ctx.WithField("ip", c.ClientIP()).Warn("refused deeply nested request body")
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+		c.Next()
+	}
+}
+
+// LimitBodyFromConfig is LimitBody with api.max-body-size and
+// api.max-json-depth
+func LimitBodyFromConfig() gin.HandlerFunc {
+	return LimitBody(viper.GetInt64("api.max-body-size"),
+						viper.GetInt("api.max-json-depth"))
+}
@@ -0,0 +1,55 @@
+package proteus_mw
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(LimitBody(64, 3))
+	router.POST("/task", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	for _, tc := range []struct {
+		name	string
+		body	string
+		status	int
+	}{
+		{"small", `{"args": {"urls": ["a"]}}`, http.StatusOK},
+		{"too deep", `{"args": {"urls": [["a"]]}}`, http.StatusBadRequest},
+		{"brackets in strings", `{"args": "[[[[[[{{{{"}`, http.StatusOK},
+		{"too large", `{"args": "` + strings.Repeat("a", 64) + `"}`,
+			http.StatusRequestEntityTooLarge},
+		{"not json", `[[[[`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/task", strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d (got: %d)", tc.name, tc.status, w.Code)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != tc.body {
+			t.Errorf("%s: expected the handler to read the body (got: %s)",
+						tc.name, w.Body.String())
+		}
+	}
+
+	// Without a Content-Length the body is only read up to the limit
+	req := httptest.NewRequest("POST", "/task",
+					ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 1000))))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a chunked large body to be refused (got: %d)", w.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package proteus_mw
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// RequireClientCert requires the requests to come with a client certificate
+// signed by api.tls.client-ca, for the deployments where the admin API is
+// only for the holders of one. The TLS listener verifies the certificates
+// the clients send without requiring them, since the devices have none.
+// Without api.tls.client-ca it lets every request through.
+func RequireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if viper.GetString("api.tls.client-ca") == "" {
+			c.Next()
+			return
+		}
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 {
+			c.JSON(http.StatusForbidden,
+					gin.H{"error": "client certificate required"})
+			c.Abort()
+			return
+		}
+		c.Set("clientCert", state.VerifiedChains[0][0].Subject.CommonName)
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package proteus_mw
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	router := gin.New()
+	router.GET("/admin", RequireClientCert(), func(c *gin.Context) {
+		cn, _ := c.Get("clientCert")
+		c.String(http.StatusOK, "%v", cn)
+	})
+	request := func(state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.TLS = state
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	viper.Set("api.tls.client-ca", "")
+	if w := request(nil); w.Code != http.StatusOK {
+		t.Errorf("expected no certificate to be required (got: %d)", w.Code)
+	}
+
+	viper.Set("api.tls.client-ca", "/etc/proteus/admin-ca.pem")
+	defer viper.Set("api.tls.client-ca", "")
+	if w := request(nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected plain HTTP to be refused (got: %d)", w.Code)
+	}
+	if w := request(&tls.ConnectionState{}); w.Code != http.StatusForbidden {
+		t.Errorf("expected a missing certificate to be refused (got: %d)", w.Code)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	w := request(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	})
+	if w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Errorf("expected the certificate to be accepted (got: %d %s)",
+					w.Code, w.Body.String())
+	}
+}
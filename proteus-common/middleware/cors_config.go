@@ -1,17 +1,40 @@
 package proteus_mw
 
 import (
+	"errors"
 	"time"
+
+	"github.com/spf13/viper"
 	"gopkg.in/gin-contrib/cors.v1"
 )
 
-func CorsConfig() cors.Config {
-	return cors.Config{
+// CorsConfig lets the web apps of api.cors.allowed-origins use the API from
+// the browser, e.g. the admin dashboard. Without any origin the browsers
+// only let the pages of the API itself use it, "*" allows every origin.
+func CorsConfig() (cors.Config, error) {
+	config := cors.Config{
 		AllowMethods:		[]string{"GET", "POST", "PUT", "HEAD", "DELETE"},
 		AllowHeaders:		[]string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		AllowAllOrigins:	true,
+		ExposeHeaders:		[]string{"Retry-After"},
 		AllowCredentials:	false,
 		MaxAge:				12 * time.Hour,
 	}
+	origins := viper.GetStringSlice("api.cors.allowed-origins")
+	for _, origin := range origins {
+		if origin == "*" {
+			if len(origins) > 1 {
+				return config, errors.New("api.cors.allowed-origins has * and other origins")
+			}
+			config.AllowAllOrigins = true
+			return config, nil
+		}
+	}
+	if len(origins) == 0 {
+		config.AllowOriginFunc = func(origin string) bool {
+			return false
+		}
+		return config, nil
+	}
+	config.AllowOrigins = origins
+	return config, config.Validate()
 }
-
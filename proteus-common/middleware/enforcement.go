@@ -0,0 +1,46 @@
+package proteus_mw
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+var ErrAuthNotEnforced = errors.New("admin auth can only be disabled in development with --dev-disable-auth")
+
+// The account the admin requests act as when auth isn't enforced
+var devAccount = Account{
+	Username: "dev",
+	Role: AdminRole,
+	Scopes: ScopesForRole(AdminRole),
+}
+
+// AuthEnforced tells whether the admin API requires auth. It can only be
+// turned off with auth.enforce when core.environment is development and the
+// service was started with --dev-disable-auth, anything else is an error
+// so that a production instance never runs without it.
+func AuthEnforced() (bool, error) {
+	if viper.GetBool("auth.enforce") {
+		return true, nil
+	}
+	if viper.GetString("core.environment") != "development" ||
+			!viper.GetBool("auth.dev-disable-auth") {
+		return true, ErrAuthNotEnforced
+	}
+	return false, nil
+}
+
+// StaffMiddlewareFunc is MiddlewareFunc for the admin API, which lets every
+// request in as an admin when auth isn't enforced.
+func (mw *GinJWTMiddleware) StaffMiddlewareFunc(auth Authorizator) gin.HandlerFunc {
+	if !mw.DisableStaffAuth {
+		return mw.MiddlewareFunc(auth)
+	}
+	ctx.Warn("admin auth is DISABLED, do not expose this instance")
+	return func(c *gin.Context) {
+		c.Set("userID", devAccount.Username)
+		c.Set("account", devAccount)
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package proteus_mw
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrackLastSeen has touch record that the probes making authenticated
+// requests were seen, it goes after the DeviceAuthorizor middleware.
+func TrackLastSeen(touch func(cx context.Context, clientID string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID, ok := c.Get("userID"); ok {
+			touch(c.Request.Context(), userID.(string))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,166 @@
+package proteus_mw
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// LoginThrottle slows down the guessing of passwords. After every failed
+// login of an account, or from an IP address, the next attempt has to wait
+// twice as long as the previous one, up to MaxDelay, and after MaxFailures
+// the account or the address is locked out for Lockout. The failures are
+// forgotten after Window without any.
+//
+// The failures are kept in memory, so every instance of the services counts
+// them on its own. The address is only taken from X-Forwarded-For when the
+// peer is one of TrustedProxies.
+type LoginThrottle struct {
+	BaseDelay		time.Duration
+	MaxDelay		time.Duration
+	MaxFailures		int
+	Lockout			time.Duration
+	Window			time.Duration
+	TrustedProxies	[]*net.IPNet
+
+	mu			sync.Mutex
+	failures	map[string]*loginFailures
+	swept		time.Time
+}
+
+type loginFailures struct {
+	count		int
+	last		time.Time
+	// No attempt is allowed before then
+	until		time.Time
+	// The accounts an address failed to log in as
+	usernames	map[string]bool
+	reported	bool
+}
+
+// LoginThrottleFromConfig returns the LoginThrottle of auth.lockout, or nil,
+// which lets every attempt through, when auth.lockout.max-failures is 0.
+func LoginThrottleFromConfig() *LoginThrottle {
+	maxFailures := viper.GetInt("auth.lockout.max-failures")
+	if maxFailures <= 0 {
+		return nil
+	}
+	return &LoginThrottle{
+		BaseDelay: viper.GetDuration("auth.lockout.base-delay"),
+		MaxDelay: viper.GetDuration("auth.lockout.max-delay"),
+		MaxFailures: maxFailures,
+		Lockout: viper.GetDuration("auth.lockout.duration"),
+		Window: viper.GetDuration("auth.lockout.window"),
+		TrustedProxies: TrustedProxiesFromConfig(),
+	}
+}
+
+// clientIP returns the address the login is throttled by
+func (t *LoginThrottle) clientIP(c *gin.Context) string {
+	if t == nil {
+		return ""
+	}
+	return clientAddress(c.Request, t.TrustedProxies)
+}
+
+func throttleKeys(username string, ip string) []string {
+	return []string{"user:" + username, "ip:" + ip}
+}
+
+// Wait returns how long the account has to wait before logging in from the
+// address, 0 if it can now.
+func (t *LoginThrottle) Wait(username string, ip string, now time.Time) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range throttleKeys(username, ip) {
+		if f, ok := t.failures[key]; ok && f.until.Sub(now) > wait {
+			wait = f.until.Sub(now)
+		}
+	}
+	return wait
+}
+
+// Fail records a failed login of the account from the address
+func (t *LoginThrottle) Fail(username string, ip string, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures == nil {
+		t.failures = map[string]*loginFailures{}
+	}
+	if now.Sub(t.swept) > t.Window {
+		for key, f := range t.failures {
+			if now.Sub(f.last) > t.Window && now.After(f.until) {
+				delete(t.failures, key)
+			}
+		}
+		t.swept = now
+	}
+
+	logCtx := ctx.WithFields(log.Fields{"username": username, "ip": ip})
+	for _, key := range throttleKeys(username, ip) {
+		f, ok := t.failures[key]
+		if !ok || (now.Sub(f.last) > t.Window && now.After(f.until)) {
+			f = &loginFailures{usernames: map[string]bool{}}
+			t.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		f.usernames[username] = true
+
+		if f.count >= t.MaxFailures {
+			f.until = now.Add(t.Lockout)
+			if f.count == t.MaxFailures {
+				logCtx.WithField("key", key).Errorf(
+					"locked out for %s after %d failed logins", t.Lockout, f.count)
+			}
+		} else {
+			delay := float64(t.BaseDelay) * math.Pow(2, float64(f.count - 1))
+			f.until = now.Add(time.Duration(math.Min(delay, float64(t.MaxDelay))))
+		}
+		// An address trying many accounts is guessing the passwords of
+		// users rather than forgetting its own
+		if !f.reported && len(f.usernames) >= t.MaxFailures {
+			logCtx.WithField("accounts", len(f.usernames)).Error(
+				"failed logins to many accounts from one address")
+			f.reported = true
+		}
+	}
+}
+
+// Succeed forgets the failed logins of the account, the failures of the
+// address still count since it could be guessing the passwords of others.
+func (t *LoginThrottle) Succeed(username string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, "user:" + username)
+}
+
+// refuse replies that the login has to wait
+func (t *LoginThrottle) refuse(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code": http.StatusTooManyRequests,
+		"error": "too-many-failed-logins",
+	})
+	c.Abort()
+}
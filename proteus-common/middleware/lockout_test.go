@@ -0,0 +1,140 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		BaseDelay: time.Second,
+		MaxDelay: 4 * time.Second,
+		MaxFailures: 5,
+		Lockout: 15 * time.Minute,
+		Window: time.Hour,
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := testThrottle()
+	now := time.Now()
+
+	// The delays double up to the max
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second,
+											4 * time.Second, 4 * time.Second} {
+		throttle.Fail("alice", "10.0.0.1", now)
+		if wait := throttle.Wait("alice", "10.0.0.1", now); wait != delay {
+			t.Errorf("failure %d: expected to wait %s (got: %s)", i + 1, delay, wait)
+		}
+		now = now.Add(delay)
+	}
+	if wait := throttle.Wait("alice", "10.0.0.1", now); wait != 0 {
+		t.Errorf("expected to try again once waited (got: %s)", wait)
+	}
+
+	throttle.Fail("alice", "10.0.0.2", now)
+	if wait := throttle.Wait("alice", "10.0.0.3", now); wait != 15 * time.Minute {
+		t.Errorf("expected the account to be locked out (got: %s)", wait)
+	}
+	if wait := throttle.Wait("bob", "10.0.0.1", now); wait != 0 {
+		t.Errorf("expected others to log in from the address (got: %s)", wait)
+	}
+	now = now.Add(15 * time.Minute)
+	throttle.Succeed("alice")
+	if wait := throttle.Wait("alice", "10.0.0.1", now); wait != 0 {
+		t.Errorf("expected the lockout to end (got: %s)", wait)
+	}
+
+	// The failures are forgotten after the window
+	throttle.Fail("carol", "10.0.0.4", now)
+	now = now.Add(2 * time.Hour)
+	throttle.Fail("carol", "10.0.0.4", now)
+	if wait := throttle.Wait("carol", "10.0.0.4", now); wait != time.Second {
+		t.Errorf("expected the old failures to be forgotten (got: %s)", wait)
+	}
+
+	// Addresses are locked out too
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		throttle.Fail(username, "10.0.0.5", now)
+	}
+	if wait := throttle.Wait("f", "10.0.0.5", now); wait != 15 * time.Minute {
+		t.Errorf("expected the address to be locked out (got: %s)", wait)
+	}
+
+	var none *LoginThrottle
+	none.Fail("alice", "10.0.0.1", now)
+	if wait := none.Wait("alice", "10.0.0.1", now); wait != 0 {
+		t.Errorf("expected no throttle to let every login through (got: %s)", wait)
+	}
+}
+
+func TestLoginHandlerThrottle(t *testing.T) {
+	mw := testMiddleware()
+	mw.Throttle = testThrottle()
+	mw.Authenticator = func(username string, password string, c *gin.Context) (Account, bool) {
+		return Account{Username: username, Role: AdminRole}, password == "right"
+	}
+	now := time.Now()
+	mw.TimeFunc = func() time.Time {
+		return now
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", mw.LoginHandler)
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+						`{"username": "alice", "password": "` + password + `"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := login("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong password to be refused (got: %d)", w.Code)
+	}
+	w := login("right")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected to wait after a failure (got: %d %s)",
+					w.Code, w.Header().Get("Retry-After"))
+	}
+	now = now.Add(time.Second)
+	if w := login("right"); w.Code != http.StatusOK {
+		t.Errorf("expected to log in once waited (got: %d)", w.Code)
+	}
+}
+
+func TestLoginThrottleForwardedFor(t *testing.T) {
+	mw := testMiddleware()
+	mw.Throttle = testThrottle()
+	mw.Authenticator = func(username string, password string, c *gin.Context) (Account, bool) {
+		return Account{Username: username, Role: AdminRole}, password == "right"
+	}
+	now := time.Now()
+	mw.TimeFunc = func() time.Time {
+		return now
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", mw.LoginHandler)
+	login := func(username string, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(
+						`{"username": "` + username + `", "password": "wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	login("alice", "198.51.100.1")
+	// Another account from the same peer, claiming to be someone else
+	if code := login("bob", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the address of the peer to be throttled (got: %d)", code)
+	}
+}
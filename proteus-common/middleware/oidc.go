@@ -0,0 +1,369 @@
+package proteus_mw
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+var ErrOIDCNotConfigured = errors.New("oidc is not configured")
+var ErrInvalidOIDCState = errors.New("invalid oidc state")
+var ErrInvalidIDToken = errors.New("invalid id token")
+var ErrNoOIDCRole = errors.New("no role for the oidc account")
+
+// How long the admin has to log in with the provider
+const oidcStateLifetime = 10 * time.Minute
+
+// OIDCProvider lets the staff log in to the admin API with an OpenID
+// Connect provider, e.g. the SSO of the organisation. It implements the
+// authorization code flow: OIDCLoginHandler redirects to the provider, which
+// redirects back to OIDCCallbackHandler with a code traded for an ID token.
+// The claims of the ID token are mapped to a role.
+type OIDCProvider struct {
+	Issuer			string
+	ClientID		string
+	ClientSecret	string
+	RedirectURL		string
+	// The claim holding the username, e.g. "email"
+	UsernameClaim	string
+	// The claim holding the groups of the user, e.g. "groups", whose
+	// values are mapped to roles by RoleMapping
+	RoleClaim		string
+	RoleMapping		map[string]string
+	// The role of the users in none of the mapped groups, none when empty
+	DefaultRole		string
+
+	Client			*http.Client
+
+	mu				sync.Mutex
+	discovery		*oidcDiscovery
+	keys			map[string]*rsa.PublicKey
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint	string `json:"authorization_endpoint"`
+	TokenEndpoint			string `json:"token_endpoint"`
+	JwksURI					string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid	string `json:"kid"`
+	Kty	string `json:"kty"`
+	N	string `json:"n"`
+	E	string `json:"e"`
+}
+
+// NewOIDCProvider returns the provider in the auth.oidc section of the
+// configuration, nil when there is no issuer.
+func NewOIDCProvider() *OIDCProvider {
+	if viper.GetString("auth.oidc.issuer") == "" {
+		return nil
+	}
+	return &OIDCProvider{
+		Issuer: strings.TrimRight(viper.GetString("auth.oidc.issuer"), "/"),
+		ClientID: viper.GetString("auth.oidc.client-id"),
+		ClientSecret: viper.GetString("auth.oidc.client-secret"),
+		RedirectURL: viper.GetString("auth.oidc.redirect-url"),
+		UsernameClaim: viper.GetString("auth.oidc.username-claim"),
+		RoleClaim: viper.GetString("auth.oidc.role-claim"),
+		RoleMapping: viper.GetStringMapString("auth.oidc.role-mapping"),
+		DefaultRole: viper.GetString("auth.oidc.default-role"),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) getJSON(u string, v interface{}) error {
+	resp, err := p.Client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover fetches the endpoints of the provider the first time they are
+// needed
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d oidcDiscovery
+	err := p.getJSON(p.Issuer + "/.well-known/openid-configuration", &d)
+	if err != nil {
+		ctx.WithError(err).Error("failed to discover the oidc provider")
+		return nil, err
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the key the provider signs ID tokens with, the keys are
+// fetched again when the provider rotated them.
+func (p *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	var jwks struct {
+		Keys	[]jsonWebKey `json:"keys"`
+	}
+	if err = p.getJSON(d.JwksURI, &jwks); err != nil {
+		ctx.WithError(err).Error("failed to fetch the oidc keys")
+		return nil, err
+	}
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// signState makes the state of a login, which carries its nonce and when it
+// expires and is signed with key, so that no session has to be kept.
+func signState(key []byte, nonce string, expires time.Time) string {
+	payload := fmt.Sprintf("%s.%d", nonce, expires.Unix())
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyState returns the nonce of a state made by signState
+func verifyState(key []byte, state string, now time.Time) (string, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidOIDCState
+	}
+	var expires int64
+	if _, err := fmt.Sscanf(parts[1], "%d", &expires); err != nil {
+		return "", ErrInvalidOIDCState
+	}
+	expected := signState(key, parts[0], time.Unix(expires, 0))
+	if !hmac.Equal([]byte(expected), []byte(state)) {
+		return "", ErrInvalidOIDCState
+	}
+	if now.Unix() > expires {
+		return "", ErrInvalidOIDCState
+	}
+	return parts[0], nil
+}
+
+// authorizationURL is where the admin logs in with the provider
+func (p *OIDCProvider) authorizationURL(state string, nonce string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id": {p.ClientID},
+		"redirect_uri": {p.RedirectURL},
+		"scope": {"openid email profile"},
+		"state": {state},
+		"nonce": {nonce},
+	}
+	return d.AuthorizationEndpoint + "?" + query.Encode(), nil
+}
+
+// exchange trades the code for the ID token of the user
+func (p *OIDCProvider) exchange(code string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.Client.PostForm(d.TokenEndpoint, url.Values{
+		"grant_type": {"authorization_code"},
+		"code": {code},
+		"redirect_uri": {p.RedirectURL},
+		"client_id": {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token endpoint returned %d", resp.StatusCode)
+	}
+	var tokens struct {
+		IDToken	string `json:"id_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	return tokens.IDToken, nil
+}
+
+// audienceContains tells whether the aud claim, a string or an array of
+// strings, has the client
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verify checks the ID token was issued by the provider to us for the
+// login with the nonce, and returns its claims.
+func (p *OIDCProvider) verify(idToken string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrInvalidIDToken
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(p.Issuer, true) ||
+			!audienceContains(claims["aud"], p.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// account maps the claims of the ID token to the account of the user
+func (p *OIDCProvider) account(claims jwt.MapClaims) (Account, error) {
+	var account Account
+	username, _ := claims[p.UsernameClaim].(string)
+	if username == "" {
+		return account, ErrInvalidIDToken
+	}
+	// Kept apart from the local accounts with the same name
+	account.Username = "oidc:" + username
+
+	var groups []string
+	switch v := claims[p.RoleClaim].(type) {
+	case string:
+		groups = []string{v}
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	role := p.DefaultRole
+	for _, g := range groups {
+		if mapped, ok := p.RoleMapping[g]; ok &&
+				staffRoleRanks[mapped] > staffRoleRanks[role] {
+			role = mapped
+		}
+	}
+	if !IsStaffRole(role) {
+		return account, ErrNoOIDCRole
+	}
+	account.Role = role
+	account.Scopes = ScopesForRole(role)
+	return account, nil
+}
+
+// OIDCLoginHandler redirects the admin to the OIDC provider
+func (mw *GinJWTMiddleware) OIDCLoginHandler(c *gin.Context) {
+	mw.MiddlewareInit()
+
+	if mw.OIDC == nil {
+		mw.unauthorized(c, http.StatusNotFound, ErrOIDCNotConfigured.Error())
+		return
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		mw.unauthorized(c, http.StatusInternalServerError, "Create OIDC state failed")
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+	state := signState(mw.Key, nonce, mw.TimeFunc().Add(oidcStateLifetime))
+	authURL, err := mw.OIDC.authorizationURL(state, nonce)
+	if err != nil {
+		mw.unauthorized(c, http.StatusBadGateway, "OIDC provider unavailable")
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackHandler is where the OIDC provider sends the admin back to,
+// replying with tokens like LoginHandler.
+func (mw *GinJWTMiddleware) OIDCCallbackHandler(c *gin.Context) {
+	mw.MiddlewareInit()
+
+	if mw.OIDC == nil {
+		mw.unauthorized(c, http.StatusNotFound, ErrOIDCNotConfigured.Error())
+		return
+	}
+	nonce, err := verifyState(mw.Key, c.Query("state"), mw.TimeFunc())
+	if err != nil {
+		mw.unauthorized(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	idToken, err := mw.OIDC.exchange(c.Query("code"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to exchange the oidc code")
+		mw.unauthorized(c, http.StatusUnauthorized, "invalid-oidc-code")
+		return
+	}
+	claims, err := mw.OIDC.verify(idToken, nonce)
+	if err != nil {
+		ctx.WithError(err).Warn("invalid oidc id token")
+		mw.unauthorized(c, http.StatusUnauthorized, ErrInvalidIDToken.Error())
+		return
+	}
+	account, err := mw.OIDC.account(claims)
+	if err != nil {
+		mw.unauthorized(c, http.StatusForbidden, err.Error())
+		return
+	}
+	mw.respondWithTokens(c, account, "")
+}
@@ -0,0 +1,136 @@
+package proteus_mw
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// testOIDCServer is a provider issuing ID tokens with the claims
+func testOIDCServer(t *testing.T, claims jwt.MapClaims) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint": server.URL + "/token",
+			"jwks_uri": server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jsonWebKey{{
+				Kid: "test",
+				Kty: "RSA",
+				N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		claims["iss"] = server.URL
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func TestOIDCLogin(t *testing.T) {
+	claims := jwt.MapClaims{
+		"aud": []string{"proteus"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"email": "alice@example.org",
+		"groups": []string{"staff", "probe-operators"},
+	}
+	server := testOIDCServer(t, claims)
+	defer server.Close()
+
+	mw := testMiddleware()
+	mw.OIDC = &OIDCProvider{
+		Issuer: server.URL,
+		ClientID: "proteus",
+		RedirectURL: "https://proteus.example.org/api/v1/oidc/callback",
+		UsernameClaim: "email",
+		RoleClaim: "groups",
+		RoleMapping: map[string]string{"probe-operators": OperatorRole},
+		Client: server.Client(),
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/login", mw.OIDCLoginHandler)
+	router.GET("/callback", mw.OIDCCallbackHandler)
+
+	req, _ := http.NewRequest("GET", "/login", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider (got: %d)", w.Code)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	state := location.Query().Get("state")
+	claims["nonce"] = location.Query().Get("nonce")
+
+	callback := func(code string, state string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/callback?" + url.Values{
+			"code": {code}, "state": {state}}.Encode(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := callback("code", state + "x"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a tampered state to be refused (got: %d)", w.Code)
+	}
+	if w := callback("wrong", state); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong code to be refused (got: %d)", w.Code)
+	}
+	w = callback("code", state)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected to be logged in (got: %d %s)", w.Code, w.Body.String())
+	}
+	var reply struct {
+		Token	string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	token, err := jwt.ParseWithClaims(reply.Token, &ProteusClaims{},
+		func(*jwt.Token) (interface{}, error) { return mw.Key, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := token.Claims.(*ProteusClaims)
+	if issued.User != "oidc:alice@example.org" || issued.Role != OperatorRole {
+		t.Errorf("expected an operator token for alice (got: %s %s)",
+				issued.User, issued.Role)
+	}
+
+	claims["groups"] = []string{"staff"}
+	if w := callback("code", state); w.Code != http.StatusForbidden {
+		t.Errorf("expected users in no mapped group to be refused (got: %d)", w.Code)
+	}
+	claims["groups"] = []string{"probe-operators"}
+	claims["nonce"] = "replayed"
+	if w := callback("code", state); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a token for another login to be refused (got: %d)", w.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package proteus_mw
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type bucket struct {
+	tokens	float64
+	last	time.Time
+}
+
+// RateLimit keeps a token bucket per client, refilled at Rate tokens per
+// second up to Burst tokens. Every request takes a token, the clients that
+// have none left are told to come back later. The address of a client is
+// only taken from X-Forwarded-For when its peer is one of TrustedProxies,
+// or it could get a new bucket for every request.
+type RateLimit struct {
+	Rate			float64
+	Burst			float64
+	TrustedProxies	[]*net.IPNet
+
+	mu		sync.Mutex
+	buckets	map[string]*bucket
+	swept	time.Time
+}
+
+func NewRateLimit(rate float64, burst float64) *RateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimit{
+		Rate: rate,
+		Burst: burst,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// RateLimitFromConfig returns the limit in the rate and burst keys of the
+// section, e.g. rate-limit.tasks.ip, behind api.trusted-proxies. A zero or
+// unset rate is no limit, which is nil.
+func RateLimitFromConfig(section string) *RateLimit {
+	rate := viper.GetFloat64(section + ".rate")
+	if rate <= 0 {
+		return nil
+	}
+	l := NewRateLimit(rate, viper.GetFloat64(section + ".burst"))
+	l.TrustedProxies = TrustedProxiesFromConfig()
+	return l
+}
+
+// take takes a token of the client at time now, returning how long to wait
+// before there is one when there are none left.
+func (l *RateLimit) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The buckets that have been refilled are the same as new ones
+	full := time.Duration(l.Burst / l.Rate * float64(time.Second))
+	if now.Sub(l.swept) > full {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, key)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.Burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.Burst, b.tokens + now.Sub(b.last).Seconds() * l.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+func (l *RateLimit) handler(client func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+		ok, wait := l.take(client(c), time.Now())
+		if !ok {
+			c.Header("Retry-After",
+					fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests,
+					gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByIP limits the requests of every IP address. It can go before the auth
+// middleware, so that clients that fail to authenticate are limited too.
+func (l *RateLimit) ByIP() gin.HandlerFunc {
+	return l.handler(func(c *gin.Context) string {
+		return clientAddress(c.Request, l.TrustedProxies)
+	})
+}
+
+// ByIdentity limits the requests of every account, many probes can share an
+// IP address behind a NAT. It goes after the auth middleware, the requests
+// without an account are limited by IP address.
+func (l *RateLimit) ByIdentity() gin.HandlerFunc {
+	return l.handler(func(c *gin.Context) string {
+		if userID, ok := c.Get("userID"); ok {
+			return "user:" + userID.(string)
+		}
+		return "ip:" + clientAddress(c.Request, l.TrustedProxies)
+	})
+}
@@ -0,0 +1,115 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitTake(t *testing.T) {
+	l := NewRateLimit(1, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.take("a", now); !ok {
+			t.Fatalf("expected request %d to be within the burst", i)
+		}
+	}
+	ok, wait := l.take("a", now)
+	if ok || wait != time.Second {
+		t.Errorf("expected to wait a second (got: %v, %s)", ok, wait)
+	}
+	if ok, _ := l.take("b", now); !ok {
+		t.Error("expected other clients to have their own bucket")
+	}
+	if ok, _ := l.take("a", now.Add(time.Second)); !ok {
+		t.Error("expected the bucket to be refilled")
+	}
+	l.take("b", now.Add(time.Hour))
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("expected the idle buckets to be dropped")
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/tasks", NewRateLimit(0.5, 1).ByIP(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tasks": []string{}})
+	})
+	router.GET("/unlimited", RateLimitFromConfig("rate-limit.none").ByIP(),
+		func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{})
+		})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("/tasks"); w.Code != http.StatusOK {
+		t.Errorf("expected the first request to go through (got: %d)", w.Code)
+	}
+	w := get("/tasks")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the second request to be limited (got: %d)", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected to retry after 2 seconds (got: %s)",
+				w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("/unlimited"); w.Code != http.StatusOK {
+			t.Errorf("expected no limit without configuration (got: %d)", w.Code)
+		}
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxies, _ := parseNetworks([]string{"10.0.0.1"})
+	direct := NewRateLimit(0.5, 1)
+	proxied := NewRateLimit(0.5, 1)
+	proxied.TrustedProxies = proxies
+	router := gin.New()
+	router.GET("/direct", direct.ByIP(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.GET("/proxied", proxied.ByIP(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	get := func(path string, peer string, forwardedFor string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = peer + ":1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-Ip", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Rotating the headers doesn't get a client a new bucket
+	if code := get("/direct", "192.0.2.1", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("expected the first request to go through (got: %d)", code)
+	}
+	if code := get("/direct", "192.0.2.1", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the spoofed address to be ignored (got: %d)", code)
+	}
+
+	// Behind the proxy the clients have their own bucket, whatever they
+	// prepend to the header
+	if code := get("/proxied", "10.0.0.1", "203.0.113.1"); code != http.StatusOK {
+		t.Errorf("expected the first client to go through (got: %d)", code)
+	}
+	if code := get("/proxied", "10.0.0.1", "203.0.113.2"); code != http.StatusOK {
+		t.Errorf("expected the second client to go through (got: %d)", code)
+	}
+	if code := get("/proxied", "10.0.0.1", "198.51.100.3, 203.0.113.1");
+			code != http.StatusTooManyRequests {
+		t.Errorf("expected the spoofed hop to be ignored (got: %d)", code)
+	}
+}
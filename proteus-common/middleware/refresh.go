@@ -0,0 +1,155 @@
+package proteus_mw
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// TokenStore keeps the sessions, their refresh tokens and the revoked access
+// tokens.
+//
+// Refresh tokens can only be used once: refreshing returns a new one of the
+// same family. A token used twice means it leaked, so its whole family is
+// revoked and both the thief and the legitimate client have to log in again.
+type TokenStore struct {
+	db	*sqlx.DB
+}
+
+func NewTokenStore(db *sqlx.DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+// Issue stores a new refresh token of the family for the account
+func (s *TokenStore) Issue(account Account, familyID string,
+							expires time.Time) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	if familyID == "" {
+		familyID = uuid.NewV4().String()
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, token_hash, family_id, username, role, creation_time, expires_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		pq.QuoteIdentifier(viper.GetString("database.refresh-tokens-table")))
+	_, err := s.db.Exec(query, uuid.NewV4().String(), hashSecret(token),
+						familyID, account.Username, account.Role,
+						time.Now().UTC(), expires)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into refresh tokens table")
+		return "", err
+	}
+	return token, nil
+}
+
+// Use spends the refresh token, returning the account it was issued to and
+// its family.
+func (s *TokenStore) Use(token string) (Account, string, error) {
+	var (
+		account Account
+		familyID string
+	)
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL
+		AND expires_at > $2
+		RETURNING username, role, family_id`,
+		pq.QuoteIdentifier(viper.GetString("database.refresh-tokens-table")))
+	err := s.db.QueryRow(query, hashSecret(token), now).Scan(
+		&account.Username, &account.Role, &familyID)
+	if err == nil {
+		return account, familyID, nil
+	}
+	if err != sql.ErrNoRows {
+		ctx.WithError(err).Error("failed to use refresh token")
+		return account, "", err
+	}
+
+	query = fmt.Sprintf(`SELECT family_id FROM %s
+		WHERE token_hash = $1 AND used_at IS NOT NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.refresh-tokens-table")))
+	err = s.db.QueryRow(query, hashSecret(token)).Scan(&familyID)
+	if err == nil {
+		ctx.Warnf("refresh token of family %s was reused, revoking it", familyID)
+		s.RevokeFamily(familyID)
+	}
+	return account, "", ErrInvalidRefreshToken
+}
+
+func (s *TokenStore) revokeWhere(condition string, arg interface{}) error {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = $2
+		WHERE %s = $1 AND revoked_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.refresh-tokens-table")),
+		condition)
+	_, err := s.db.Exec(query, arg, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to revoke refresh tokens")
+	}
+	return err
+}
+
+// RevokeFamily revokes the refresh token and the ones it was rotated from
+// or to
+func (s *TokenStore) RevokeFamily(familyID string) error {
+	return s.revokeWhere("family_id", familyID)
+}
+
+// RevokeToken revokes the session of the refresh token
+func (s *TokenStore) RevokeToken(token string) error {
+	var familyID string
+	query := fmt.Sprintf(`SELECT family_id FROM %s WHERE token_hash = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.refresh-tokens-table")))
+	err := s.db.QueryRow(query, hashSecret(token)).Scan(&familyID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up refresh token")
+		return err
+	}
+	err = s.RevokeSession(familyID)
+	if err == ErrSessionNotFound {
+		return nil
+	}
+	return err
+}
+
+// RevokeUser revokes all the sessions and refresh tokens of the user, e.g.
+// when their role changes.
+func (s *TokenStore) RevokeUser(username string) error {
+	if _, err := s.revokeSessionsWhere("username", username); err != nil {
+		return err
+	}
+	return s.revokeWhere("username", username)
+}
+
+// RevokeAccessToken refuses the access token with the jti until it
+// expires. The expired ones are dropped from the list along the way.
+func (s *TokenStore) RevokeAccessToken(jti string, expires time.Time) error {
+	table := pq.QuoteIdentifier(viper.GetString("database.revoked-tokens-table"))
+	query := fmt.Sprintf(`INSERT INTO %s (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, table)
+	if _, err := s.db.Exec(query, jti, expires); err != nil {
+		ctx.WithError(err).Error("failed to insert into revoked tokens table")
+		return err
+	}
+	revocations.add(revocations.tokens, jti, expires)
+	query = fmt.Sprintf(`DELETE FROM %s WHERE expires_at < $1`, table)
+	if _, err := s.db.Exec(query, time.Now().UTC()); err != nil {
+		ctx.WithError(err).Warn("failed to purge expired revoked tokens")
+	}
+	return nil
+}
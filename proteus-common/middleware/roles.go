@@ -0,0 +1,59 @@
+package proteus_mw
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The roles of the accounts. Probes have the device role, the other roles
+// are for the staff using the admin API, each allowed to do what the ones
+// before it can.
+const (
+	DeviceRole		= "device"
+	// Can look at jobs, probes and their results
+	ViewerRole		= "viewer"
+	// Can also schedule jobs, send alerts and manage the probes
+	OperatorRole	= "operator"
+	// Can also manage the accounts
+	AdminRole		= "admin"
+)
+
+var staffRoleRanks = map[string]int{
+	ViewerRole: 1,
+	OperatorRole: 2,
+	AdminRole: 3,
+}
+
+// IsStaffRole tells whether role is allowed to use the admin API
+func IsStaffRole(role string) bool {
+	_, ok := staffRoleRanks[role]
+	return ok
+}
+
+// HasRole tells whether the account is allowed to do what role can
+func HasRole(account Account, role string) bool {
+	return IsStaffRole(account.Role) &&
+			staffRoleRanks[account.Role] >= staffRoleRanks[role]
+}
+
+// StaffAuthorizor lets in the accounts of any staff role, the routes then
+// require the role they need with RequireRole.
+func StaffAuthorizor(account Account, c *gin.Context) bool {
+	return IsStaffRole(account.Role)
+}
+
+// RequireRole refuses the requests of the accounts that don't have role, it
+// goes after the StaffAuthorizor middleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := c.Get("account")
+		if !ok || !HasRole(account.(Account), role) {
+			c.JSON(http.StatusForbidden,
+					gin.H{"error": "You don't have permission to access."})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
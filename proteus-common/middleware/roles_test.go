@@ -0,0 +1,34 @@
+package proteus_mw
+
+import (
+	"testing"
+)
+
+func TestHasRole(t *testing.T) {
+	viewer := Account{Username: "alice", Role: ViewerRole}
+	operator := Account{Username: "bob", Role: OperatorRole}
+	device := Account{Username: "d0c5c5c4", Role: DeviceRole}
+
+	if !HasRole(viewer, ViewerRole) || HasRole(viewer, OperatorRole) {
+		t.Error("expected viewers to only be allowed to view")
+	}
+	if !HasRole(operator, ViewerRole) || !HasRole(operator, OperatorRole) ||
+			HasRole(operator, AdminRole) {
+		t.Error("expected operators to be allowed to view and operate")
+	}
+	if HasRole(device, ViewerRole) || StaffAuthorizor(device, nil) {
+		t.Error("expected devices not to be allowed in the admin API")
+	}
+	if !StaffAuthorizor(viewer, nil) {
+		t.Error("expected viewers to be allowed in the admin API")
+	}
+}
+
+func TestScopeRole(t *testing.T) {
+	if role := scopeRole([]string{ViewerRole, OperatorRole}); role != OperatorRole {
+		t.Errorf("expected the strongest scope to be the role (got: %s)", role)
+	}
+	if role := scopeRole([]string{DeviceRole}); role != "" {
+		t.Errorf("expected a device scope not to give a role (got: %s)", role)
+	}
+}
@@ -0,0 +1,68 @@
+package proteus_mw
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The scopes of the tokens, checked by RequireScope on top of the roles so
+// that a token minted for a probe can't reach the admin API even if a role
+// check is missing.
+const (
+	// Fetching the tasks of the probe
+	TasksReadScope	= "tasks:read"
+	// Updating the state and the results of the tasks of the probe
+	TasksWriteScope	= "tasks:write"
+	// Using the admin API
+	JobsAdminScope	= "jobs:admin"
+)
+
+// ScopesForRole returns the scopes of the tokens of the accounts with role
+func ScopesForRole(role string) []string {
+	if role == DeviceRole {
+		return []string{TasksReadScope, TasksWriteScope}
+	}
+	if IsStaffRole(role) {
+		return []string{JobsAdminScope}
+	}
+	return []string{}
+}
+
+// HasScope tells whether the account was granted the scope
+func HasScope(account Account, scope string) bool {
+	for _, s := range account.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope refuses the requests whose token wasn't granted the scope, it
+// goes after the auth middleware. Tokens issued before scopes existed have
+// none, their clients are told to log in again.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("account")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing account"})
+			c.Abort()
+			return
+		}
+		account := value.(Account)
+		if account.Scopes == nil {
+			c.JSON(http.StatusUnauthorized,
+					gin.H{"error": "token has no scopes, log in again"})
+			c.Abort()
+			return
+		}
+		if !HasScope(account, scope) {
+			c.JSON(http.StatusForbidden,
+					gin.H{"error": "token is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/gin-contrib/cors.v1"
+)
+
+func corsRouter(t *testing.T) *gin.Engine {
+	config, err := CorsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SecurityHeaders(), cors.New(config))
+	router.GET("/api/v1/jobs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	return router
+}
+
+func TestCorsConfig(t *testing.T) {
+	defer viper.Set("api.cors.allowed-origins", nil)
+	get := func(router *gin.Engine, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	viper.Set("api.cors.allowed-origins", []string{})
+	if w := get(corsRouter(t), "https://evil.example.org"); w.Code != http.StatusForbidden {
+		t.Errorf("expected other origins to be refused (got: %d)", w.Code)
+	}
+
+	viper.Set("api.cors.allowed-origins", []string{"https://dashboard.example.org"})
+	router := corsRouter(t)
+	w := get(router, "https://dashboard.example.org")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.org" {
+		t.Errorf("expected the dashboard to be allowed (got: %q)",
+					w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w := get(router, "https://evil.example.org"); w.Code != http.StatusForbidden {
+		t.Errorf("expected other origins to be refused (got: %d)", w.Code)
+	}
+
+	viper.Set("api.cors.allowed-origins", []string{"*"})
+	w = get(corsRouter(t), "https://any.example.org")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("expected every origin to be allowed (got: %q)",
+					w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	for _, origins := range [][]string{{"*", "https://dashboard.example.org"},
+										{"dashboard.example.org"}} {
+		viper.Set("api.cors.allowed-origins", origins)
+		if _, err := CorsConfig(); err == nil {
+			t.Errorf("expected %v to be refused", origins)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	viper.Set("api.hsts-max-age", "8760h")
+	defer viper.Set("api.hsts-max-age", nil)
+	req := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+	w := httptest.NewRecorder()
+	corsRouter(t).ServeHTTP(w, req)
+	for header, value := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options": "DENY",
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	} {
+		if w.Header().Get(header) != value {
+			t.Errorf("expected %s: %s (got: %q)", header, value, w.Header().Get(header))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package proteus_mw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+// Session is a login of an account, on a device or in a browser. Its id is
+// the family of its refresh tokens and the sid claim of its access tokens,
+// so revoking it logs it out at once.
+type Session struct {
+	Id				string `json:"id"`
+	Username		string `json:"username"`
+	Role			string `json:"role"`
+	UserAgent		string `json:"user_agent"`
+	IPAddress		string `json:"ip_address"`
+	CreationTime	time.Time `json:"creation_time"`
+	LastUsed		*time.Time `json:"last_used"`
+	ExpiresAt		time.Time `json:"expires_at"`
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// revocationCache keeps the revoked access tokens and sessions in memory, so
+// that they aren't looked up in the database on every request. It's shared
+// by the TokenStores of the process and reloaded every
+// auth.revocation-refresh for the revocations of the other instances.
+type revocationCache struct {
+	mu			sync.RWMutex
+	// The ids of the revoked access tokens and sessions, to when they expire
+	tokens		map[string]time.Time
+	sessions	map[string]time.Time
+	loaded		time.Time
+}
+
+var revocations = &revocationCache{
+	tokens: map[string]time.Time{},
+	sessions: map[string]time.Time{},
+}
+
+func (r *revocationCache) add(ids map[string]time.Time, id string, expires time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids[id] = expires
+}
+
+// StartSession records a new login of the account, until the expiry of its
+// first refresh token.
+func (s *TokenStore) StartSession(account Account, userAgent string,
+									ip string, expires time.Time) (string, error) {
+	id := uuid.NewV4().String()
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, username, role, user_agent, ip_address,
+		creation_time, last_used, expires_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $6, $7)`,
+		pq.QuoteIdentifier(viper.GetString("database.sessions-table")))
+	_, err := s.db.Exec(query, id, account.Username, account.Role,
+						userAgent, ip, now, expires)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into sessions table")
+		return "", err
+	}
+	return id, nil
+}
+
+// touchSession extends the session to the expiry of its new refresh token
+func (s *TokenStore) touchSession(id string, expires time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET last_used = $2, expires_at = $3
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.sessions-table")))
+	_, err := s.db.Exec(query, id, time.Now().UTC(), expires)
+	if err != nil {
+		ctx.WithError(err).Error("failed to update sessions table")
+	}
+	return err
+}
+
+// ListSessions returns the sessions of the account that are neither revoked
+// nor expired, of every account when username is empty, the most recently
+// used first.
+func (s *TokenStore) ListSessions(username string) ([]Session, error) {
+	var sessions = make([]Session, 0)
+	query := fmt.Sprintf(`SELECT
+		id, username, role, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		creation_time, last_used, expires_at
+		FROM %s
+		WHERE revoked_at IS NULL AND expires_at > $1
+		AND ($2 = '' OR username = $2)
+		ORDER BY last_used DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.sessions-table")))
+	rows, err := s.db.Query(query, time.Now().UTC(), username)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list sessions")
+		return sessions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(&session.Id, &session.Username, &session.Role,
+						&session.UserAgent, &session.IPAddress,
+						&session.CreationTime, &session.LastUsed,
+						&session.ExpiresAt)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over sessions")
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// revokeSessionsWhere revokes the sessions matching the condition along with
+// their refresh tokens, and refuses their access tokens from now on.
+func (s *TokenStore) revokeSessionsWhere(condition string, arg interface{}) (int, error) {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = $2
+		WHERE %s = $1 AND revoked_at IS NULL
+		RETURNING id, expires_at`,
+		pq.QuoteIdentifier(viper.GetString("database.sessions-table")),
+		condition)
+	rows, err := s.db.Query(query, arg, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to revoke sessions")
+		return 0, err
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		var (
+			id string
+			expires time.Time
+		)
+		if err = rows.Scan(&id, &expires); err != nil {
+			ctx.WithError(err).Error("failed to iterate over revoked sessions")
+			return count, err
+		}
+		revocations.add(revocations.sessions, id, expires)
+		count++
+	}
+	return count, rows.Err()
+}
+
+// RevokeSession logs the session out
+func (s *TokenStore) RevokeSession(id string) error {
+	if _, err := uuid.FromString(id); err != nil {
+		return ErrSessionNotFound
+	}
+	count, err := s.revokeSessionsWhere("id", id)
+	if err != nil {
+		return err
+	}
+	if err = s.RevokeFamily(id); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// loadRevocations replaces the cache with the revocations in the database
+// that haven't expired yet
+func (s *TokenStore) loadRevocations(now time.Time) error {
+	load := func(query string) (map[string]time.Time, error) {
+		ids := map[string]time.Time{}
+		rows, err := s.db.Query(query, now)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				id string
+				expires time.Time
+			)
+			if err = rows.Scan(&id, &expires); err != nil {
+				return nil, err
+			}
+			ids[id] = expires
+		}
+		return ids, rows.Err()
+	}
+	tokens, err := load(fmt.Sprintf(`SELECT jti, expires_at FROM %s
+		WHERE expires_at > $1`,
+		pq.QuoteIdentifier(viper.GetString("database.revoked-tokens-table"))))
+	if err != nil {
+		return err
+	}
+	sessions, err := load(fmt.Sprintf(`SELECT id, expires_at FROM %s
+		WHERE revoked_at IS NOT NULL AND expires_at > $1`,
+		pq.QuoteIdentifier(viper.GetString("database.sessions-table"))))
+	if err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	revocations.tokens = tokens
+	revocations.sessions = sessions
+	revocations.loaded = now
+	return nil
+}
+
+// IsRevoked tells whether the access token, or its session, was revoked.
+// Until the first load of the revocations succeeds every token is refused,
+// afterwards a failed reload keeps the revocations known so far.
+func (s *TokenStore) IsRevoked(claims *ProteusClaims) (bool, error) {
+	now := time.Now()
+	revocations.mu.RLock()
+	loaded := revocations.loaded
+	revocations.mu.RUnlock()
+	if now.Sub(loaded) > viper.GetDuration("auth.revocation-refresh") {
+		if err := s.loadRevocations(now); err != nil {
+			ctx.WithError(err).Error("failed to load the revocations")
+			if loaded.IsZero() {
+				return true, err
+			}
+		}
+	}
+
+	revocations.mu.RLock()
+	defer revocations.mu.RUnlock()
+	if _, ok := revocations.tokens[claims.Id]; ok && claims.Id != "" {
+		return true, nil
+	}
+	if _, ok := revocations.sessions[claims.Session]; ok && claims.Session != "" {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,60 @@
+package proteus_mw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func TestRevokedSessions(t *testing.T) {
+	// A fresh cache, so that the database isn't reached
+	viper.Set("auth.revocation-refresh", time.Hour)
+	defer viper.Set("auth.revocation-refresh", nil)
+	revocations.mu.Lock()
+	revocations.loaded = time.Now()
+	revocations.mu.Unlock()
+	expires := time.Now().Add(time.Hour)
+	revocations.add(revocations.sessions, "revoked-session", expires)
+	revocations.add(revocations.tokens, "revoked-token", expires)
+
+	mw := testMiddleware()
+	mw.Tokens = &TokenStore{}
+	router := testRouter(mw)
+	for _, tc := range []struct {
+		name	string
+		jti		string
+		sid		string
+		status	int
+	}{
+		{"no session", "", "", http.StatusOK},
+		{"active session", "token", "session", http.StatusOK},
+		{"revoked session", "token", "revoked-session", http.StatusUnauthorized},
+		{"revoked token", "revoked-token", "session", http.StatusUnauthorized},
+	} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, ProteusClaims{
+			Role: AdminRole,
+			User: "alice",
+			Scopes: ScopesForRole(AdminRole),
+			Session: tc.sid,
+			StandardClaims: jwt.StandardClaims{
+				Id: tc.jti,
+				ExpiresAt: expires.Unix(),
+			},
+		})
+		signed, err := token.SignedString(mw.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/api/v1/admin/jobs", nil)
+		req.Header.Set("Authorization", "Bearer " + signed)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d (got: %d)", tc.name, tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package proteus_mw
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignatureScheme starts the Authorization header of the signed requests:
+//
+//   Authorization: Proteus-HMAC client_id=ID, timestamp=UNIX_TIME, signature=HEX
+//
+// where the signature is the HMAC-SHA256, keyed with the request secret of
+// the probe, of the method, the path with the query, the timestamp and the
+// hex encoded SHA-256 of the body, one per line.
+const SignatureScheme = "Proteus-HMAC"
+
+var ErrInvalidSignature = errors.New("invalid request signature")
+var ErrReplayedSignature = errors.New("replayed request signature")
+
+// SignRequest returns the signature of a request, for the probes
+func SignRequest(secret string, method string, uri string,
+					body []byte, timestamp int64) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", method, uri, timestamp,
+				hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type signedRequest struct {
+	clientID	string
+	timestamp	int64
+	signature	string
+}
+
+func parseSignatureHeader(header string) (signedRequest, error) {
+	var req signedRequest
+	if !strings.HasPrefix(header, SignatureScheme + " ") {
+		return req, ErrInvalidSignature
+	}
+	for _, param := range strings.Split(header[len(SignatureScheme) + 1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			return req, ErrInvalidSignature
+		}
+		switch kv[0] {
+		case "client_id":
+			req.clientID = kv[1]
+		case "timestamp":
+			ts, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return req, ErrInvalidSignature
+			}
+			req.timestamp = ts
+		case "signature":
+			req.signature = kv[1]
+		}
+	}
+	if req.clientID == "" || req.signature == "" {
+		return req, ErrInvalidSignature
+	}
+	return req, nil
+}
+
+// SignatureVerifier checks the signed requests of the probes. A signature is
+// only accepted within MaxSkew of its timestamp and only once, the ones
+// seen are remembered until they expire. They are remembered by every
+// instance on its own, so a replay can only reach the other instances.
+type SignatureVerifier struct {
+	// Returns the request secret of the probe
+	Secret	func(clientID string) (string, error)
+	MaxSkew	time.Duration
+
+	mu		sync.Mutex
+	seen	map[string]time.Time
+}
+
+func NewSignatureVerifier(secret func(string) (string, error),
+							maxSkew time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{
+		Secret: secret,
+		MaxSkew: maxSkew,
+		seen: map[string]time.Time{},
+	}
+}
+
+// remember tells whether the signature is new, remembering it if it is
+func (v *SignatureVerifier) remember(signature string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for s, expires := range v.seen {
+		if now.After(expires) {
+			delete(v.seen, s)
+		}
+	}
+	if _, ok := v.seen[signature]; ok {
+		return false
+	}
+	v.seen[signature] = now.Add(2 * v.MaxSkew)
+	return true
+}
+
+// Verify returns the account of the probe that signed the request. The body
+// is read to be hashed and put back for the handlers.
+func (v *SignatureVerifier) Verify(c *gin.Context, now time.Time) (Account, error) {
+	var account Account
+	req, err := parseSignatureHeader(c.Request.Header.Get("Authorization"))
+	if err != nil {
+		return account, err
+	}
+	skew := now.Sub(time.Unix(req.timestamp, 0))
+	if skew > v.MaxSkew || skew < -v.MaxSkew {
+		return account, ErrInvalidSignature
+	}
+	secret, err := v.Secret(req.clientID)
+	if err != nil || secret == "" {
+		return account, ErrInvalidSignature
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		body, err = ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return account, err
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	expected := SignRequest(secret, c.Request.Method, c.Request.URL.RequestURI(),
+							body, req.timestamp)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.signature))) {
+		return account, ErrInvalidSignature
+	}
+	if !v.remember(expected, now) {
+		return account, ErrReplayedSignature
+	}
+	account.Username = req.clientID
+	account.Role = DeviceRole
+	account.Scopes = ScopesForRole(DeviceRole)
+	return account, nil
+}
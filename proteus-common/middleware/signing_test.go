@@ -0,0 +1,72 @@
+package proteus_mw
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRequestSecret = "0123456789abcdef0123456789abcdef"
+
+func TestSignedRequests(t *testing.T) {
+	mw := testMiddleware()
+	mw.Signatures = NewSignatureVerifier(func(clientID string) (string, error) {
+		if clientID == "probe" {
+			return testRequestSecret, nil
+		}
+		return "", nil
+	}, 5 * time.Minute)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	device := router.Group("/api/v1")
+	device.Use(mw.MiddlewareFunc(DeviceAuthorizor))
+	device.POST("/task/:task_id/done", RequireScope(TasksWriteScope),
+		func(c *gin.Context) {
+			body, _ := ioutil.ReadAll(c.Request.Body)
+			c.JSON(http.StatusOK, gin.H{"user": c.MustGet("userID"),
+										"body": string(body)})
+		})
+
+	send := func(clientID string, uri string, signedBody string, body string,
+					timestamp int64) *httptest.ResponseRecorder {
+		signature := SignRequest(testRequestSecret, "POST", uri,
+								[]byte(signedBody), timestamp)
+		req, _ := http.NewRequest("POST", uri, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", fmt.Sprintf(
+			"%s client_id=%s, timestamp=%d, signature=%s",
+			SignatureScheme, clientID, timestamp, signature))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	now := time.Now().Unix()
+	uri := "/api/v1/task/1/done"
+	body := `{"result":"ok"}`
+
+	w := send("probe", uri, body, body, now)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a signed request to go through (got: %d)", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"body":"{\"result\":\"ok\"}"`)) {
+		t.Errorf("expected the handler to get the body (got: %s)", w.Body.String())
+	}
+	if w := send("probe", uri, body, body, now); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed request to be refused (got: %d)", w.Code)
+	}
+	if w := send("probe", uri, body, `{"result":"forged"}`, now + 1); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a tampered body to be refused (got: %d)", w.Code)
+	}
+	if w := send("probe", uri, body, body, now - 3600); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an old request to be refused (got: %d)", w.Code)
+	}
+	if w := send("other", uri, body, body, now + 2); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a probe without secret to be refused (got: %d)", w.Code)
+	}
+}
@@ -0,0 +1,292 @@
+package proteus_mw
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// The codes of the authenticator apps (RFC 6238): 6 digits changing every
+// 30 seconds, the ones of the previous and the next period are accepted
+// too for the clocks that drift.
+const (
+	totpPeriod	= 30
+	totpDigits	= 6
+	totpSkew	= 1
+	// How many recovery codes are given at enrollment
+	recoveryCodeCount	= 10
+)
+
+var (
+	ErrOTPRequired				= errors.New("otp-required")
+	ErrInvalidOTP				= errors.New("invalid-otp")
+	ErrOTPEnrollmentRequired	= errors.New("otp-enrollment-required")
+	ErrOTPNotEnrolling			= errors.New("otp-not-enrolling")
+	ErrUnknownAccount			= errors.New("account not found")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode returns the code of the secret for the period counter
+func totpCode(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum) - 1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset + 4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value % 1000000)
+}
+
+// validateTOTP returns the period counter of the code if it is valid now
+func validateTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	counter := now.Unix() / totpPeriod
+	for i := counter - totpSkew; i <= counter + totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(i))), []byte(code)) == 1 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func randomString(encoding *base32.Encoding, size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(data), nil
+}
+
+// TOTPStore keeps the TOTP secrets and recovery codes of the staff
+// accounts. The admin account of the configuration file uses
+// auth.admin-totp-secret.
+type TOTPStore struct {
+	db			*sqlx.DB
+	// Refuses the staff accounts without TOTP
+	Required	bool
+	TimeFunc	func() time.Time
+}
+
+func NewTOTPStore(db *sqlx.DB) *TOTPStore {
+	return &TOTPStore{
+		db: db,
+		Required: viper.GetBool("auth.totp.required"),
+		TimeFunc: time.Now,
+	}
+}
+
+func (s *TOTPStore) table() string {
+	return pq.QuoteIdentifier(viper.GetString("database.accounts-table"))
+}
+
+// Enroll gives the account a new secret, which is only used for logins once
+// confirmed. It returns the secret and the otpauth:// URL of the QR code the
+// authenticator apps scan.
+func (s *TOTPStore) Enroll(username string) (string, string, error) {
+	secret, err := randomString(totpEncoding, 20)
+	if err != nil {
+		return "", "", err
+	}
+	query := fmt.Sprintf(`UPDATE %s SET totp_secret = $2
+		WHERE username = $1 AND NOT totp_enabled`, s.table())
+	res, err := s.db.Exec(query, username, secret)
+	if err != nil {
+		ctx.WithError(err).Error("failed to store the totp secret")
+		return "", "", err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		// Enrolled already, it has to be reset first
+		return "", "", ErrOTPNotEnrolling
+	}
+	issuer := viper.GetString("auth.totp.issuer")
+	otpURL := url.URL{
+		Scheme: "otpauth",
+		Host: "totp",
+		Path: "/" + issuer + ":" + username,
+		RawQuery: url.Values{
+			"secret": {secret},
+			"issuer": {issuer},
+		}.Encode(),
+	}
+	return secret, otpURL.String(), nil
+}
+
+// Confirm turns TOTP on for the account once it sent a code of its new
+// secret, and returns its recovery codes, which aren't stored in clear.
+func (s *TOTPStore) Confirm(username string, code string) ([]string, error) {
+	var secret sql.NullString
+	query := fmt.Sprintf(`SELECT totp_secret FROM %s
+		WHERE username = $1 AND NOT totp_enabled`, s.table())
+	err := s.db.QueryRow(query, username).Scan(&secret)
+	if err == sql.ErrNoRows || (err == nil && !secret.Valid) {
+		return nil, ErrOTPNotEnrolling
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up the totp secret")
+		return nil, err
+	}
+	counter, ok := validateTOTP(secret.String, code, s.TimeFunc())
+	if !ok {
+		return nil, ErrInvalidOTP
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	lower := base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+	for i := range codes {
+		code, err := randomString(lower, 7)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:10]
+		hashes[i] = hashSecret(codes[i])
+	}
+	query = fmt.Sprintf(`UPDATE %s SET totp_enabled = true,
+		totp_last_counter = $2, recovery_codes = $3
+		WHERE username = $1`, s.table())
+	_, err = s.db.Exec(query, username, counter, pq.Array(hashes))
+	if err != nil {
+		ctx.WithError(err).Error("failed to enable totp")
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Reset turns TOTP off for the account, e.g. when its device is lost, it
+// has to enroll again.
+func (s *TOTPStore) Reset(username string) error {
+	query := fmt.Sprintf(`UPDATE %s SET totp_enabled = false,
+		totp_secret = NULL, totp_last_counter = 0, recovery_codes = NULL
+		WHERE username = $1`, s.table())
+	res, err := s.db.Exec(query, username)
+	if err != nil {
+		ctx.WithError(err).Error("failed to reset totp")
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return ErrUnknownAccount
+	}
+	return nil
+}
+
+// Check verifies the second factor of a login of the account that got its
+// password right: a TOTP code, which can't be used twice, or one of its
+// recovery codes, which is spent.
+func (s *TOTPStore) Check(account Account, code string) error {
+	if s == nil || !IsStaffRole(account.Role) {
+		return nil
+	}
+	code = strings.TrimSpace(code)
+	// Authenticator always takes admin for the one of the configuration
+	if account.Username == "admin" {
+		return s.checkConfigAdmin(code)
+	}
+
+	var (
+		secret sql.NullString
+		enabled bool
+		lastCounter int64
+	)
+	query := fmt.Sprintf(`SELECT totp_secret, totp_enabled, totp_last_counter
+		FROM %s WHERE username = $1`, s.table())
+	err := s.db.QueryRow(query, account.Username).Scan(&secret, &enabled, &lastCounter)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.WithError(err).Error("failed to look up the totp secret")
+		return err
+	}
+	if !enabled {
+		if s.Required {
+			return ErrOTPEnrollmentRequired
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrOTPRequired
+	}
+
+	if counter, ok := validateTOTP(secret.String, code, s.TimeFunc()); ok {
+		// Spending the period, a code seen by someone else can't be
+		// used again
+		query = fmt.Sprintf(`UPDATE %s SET totp_last_counter = $2
+			WHERE username = $1 AND totp_last_counter < $2`, s.table())
+		res, err := s.db.Exec(query, account.Username, counter)
+		if err != nil {
+			ctx.WithError(err).Error("failed to update the totp counter")
+			return err
+		}
+		if count, err := res.RowsAffected(); err != nil || count == 0 {
+			return ErrInvalidOTP
+		}
+		return nil
+	}
+
+	// The codes are spent in Go rather than with array_remove, for SQLite
+	// to run this too. Only the codes as they were read are replaced, so a
+	// code can't be spent twice.
+	var codes pq.StringArray
+	query = fmt.Sprintf(`SELECT recovery_codes FROM %s WHERE username = $1`,
+		s.table())
+	if err = s.db.QueryRow(query, account.Username).Scan(&codes); err != nil {
+		ctx.WithError(err).Error("failed to look up the recovery codes")
+		return err
+	}
+	hash := hashSecret(strings.ToLower(code))
+	remaining := make([]string, 0, len(codes))
+	for _, c := range codes {
+		if c != hash {
+			remaining = append(remaining, c)
+		}
+	}
+	if len(remaining) == len(codes) {
+		return ErrInvalidOTP
+	}
+	query = fmt.Sprintf(`UPDATE %s SET recovery_codes = $3
+		WHERE username = $1 AND recovery_codes = $2`, s.table())
+	res, err := s.db.Exec(query, account.Username, codes, pq.Array(remaining))
+	if err != nil {
+		ctx.WithError(err).Error("failed to use a recovery code")
+		return err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		return ErrInvalidOTP
+	}
+	ctx.WithField("username", account.Username).Warn("logged in with a recovery code")
+	return nil
+}
+
+// checkConfigAdmin checks the code of the admin account of the
+// configuration file, whose codes can be used again within their period.
+func (s *TOTPStore) checkConfigAdmin(code string) error {
+	secret := viper.GetString("auth.admin-totp-secret")
+	if secret == "" {
+		if s.Required {
+			return ErrOTPEnrollmentRequired
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrOTPRequired
+	}
+	if _, ok := validateTOTP(secret, code, s.TimeFunc()); !ok {
+		return ErrInvalidOTP
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package proteus_mw
+
+import (
+	"encoding/base32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// The SHA1 test vectors of RFC 6238, truncated to 6 digits
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		time	int64
+		code	string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		now := time.Unix(tc.time, 0)
+		if _, ok := validateTOTP(secret, tc.code, now); !ok {
+			t.Errorf("expected %s to be valid at %d", tc.code, tc.time)
+		}
+		// The codes stay valid for a period either way
+		if _, ok := validateTOTP(secret, tc.code, now.Add(totpPeriod * time.Second)); !ok {
+			t.Errorf("expected %s to be valid a period later", tc.code)
+		}
+		if _, ok := validateTOTP(secret, tc.code, now.Add(3 * totpPeriod * time.Second)); ok {
+			t.Errorf("expected %s to be invalid 3 periods later", tc.code)
+		}
+	}
+	if _, ok := validateTOTP(secret, "28708", time.Unix(59, 0)); ok {
+		t.Error("expected a short code to be invalid")
+	}
+}
+
+func TestLoginHandlerTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	viper.Set("auth.admin-totp-secret", secret)
+	defer viper.Set("auth.admin-totp-secret", nil)
+
+	mw := testMiddleware()
+	mw.Authenticator = func(username string, password string, c *gin.Context) (Account, bool) {
+		return Account{Username: username, Role: AdminRole}, password == "right"
+	}
+	mw.TOTP = &TOTPStore{TimeFunc: func() time.Time {
+		return time.Unix(59, 0)
+	}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", mw.LoginHandler)
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tc := range []struct {
+		name	string
+		body	string
+		status	int
+		error	string
+	}{
+		{"no code", `{"username": "admin", "password": "right"}`,
+			http.StatusUnauthorized, "otp-required"},
+		{"wrong code", `{"username": "admin", "password": "right", "otp": "123456"}`,
+			http.StatusUnauthorized, "invalid-otp"},
+		{"wrong password", `{"username": "admin", "password": "wrong", "otp": "287082"}`,
+			http.StatusUnauthorized, "wrong-username-password"},
+		{"right code", `{"username": "admin", "password": "right", "otp": "287082"}`,
+			http.StatusOK, ""},
+	} {
+		w := login(tc.body)
+		if w.Code != tc.status || !strings.Contains(w.Body.String(), tc.error) {
+			t.Errorf("%s: expected %d %s (got: %d %s)", tc.name, tc.status,
+						tc.error, w.Code, w.Body.String())
+		}
+	}
+
+	viper.Set("auth.admin-totp-secret", nil)
+	mw.TOTP.Required = true
+	w := login(`{"username": "admin", "password": "right"}`)
+	if w.Code != http.StatusUnauthorized ||
+			!strings.Contains(w.Body.String(), "otp-enrollment-required") {
+		t.Errorf("expected the admin to need a secret (got: %d %s)",
+					w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package probes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// Touch records that the probe was seen now. To spare a write on every
+// request last_seen is only moved forward once it's older than resolution.
+func Touch(db *sqlx.DB, clientID string, resolution time.Duration) error {
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s SET last_seen = $2
+		WHERE CAST(id AS TEXT) = $1 AND (last_seen IS NULL OR last_seen <= $3)`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	_, err := db.Exec(query, clientID, now, now.Add(-resolution))
+	if err != nil {
+		ctx.WithError(err).Error("failed to update last seen")
+	}
+	return err
+}
+
+// ActiveCount is how many probes of a platform were seen recently
+type ActiveCount struct {
+	Platform	string `json:"platform"`
+	Count		int64 `json:"count"`
+}
+
+// CountActiveProbes returns how many probes were seen since the given time
+// by platform, the most common first.
+func CountActiveProbes(db *sqlx.DB, since time.Time) ([]ActiveCount, error) {
+	var counts = make([]ActiveCount, 0)
+	query := fmt.Sprintf(`SELECT COALESCE(platform, ''), COUNT(*)
+		FROM %s WHERE COALESCE(last_seen, last_updated) >= $1
+		GROUP BY 1
+		ORDER BY 2 DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	rows, err := db.Query(query, since)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count active probes")
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ActiveCount
+		if err = rows.Scan(&c.Platform, &c.Count); err != nil {
+			ctx.WithError(err).Error("failed to iterate over active probes")
+			return counts, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// GroupCount is how many probes of a country, platform and software version
+// were seen within each of the windows asked for, in the same order.
+type GroupCount struct {
+	ProbeCC			string `json:"probe_cc"`
+	Platform		string `json:"platform"`
+	SoftwareVersion	string `json:"software_version"`
+	Counts			[]int64 `json:"counts"`
+}
+
+// CountActiveByGroup returns how many probes were seen within each window
+// before now, by country, platform and software version. Deactivated probes
+// aren't counted.
+func CountActiveByGroup(db *sqlx.DB, now time.Time,
+						windows []time.Duration) ([]GroupCount, error) {
+	var (
+		groups = make([]GroupCount, 0)
+		counts []string
+		args []interface{}
+		longest time.Duration
+	)
+	for _, w := range windows {
+		args = append(args, now.Add(-w))
+		counts = append(counts, fmt.Sprintf(
+			"COUNT(*) FILTER (WHERE COALESCE(last_seen, last_updated) >= $%d)",
+			len(args)))
+		if w > longest {
+			longest = w
+		}
+	}
+	if len(windows) == 0 {
+		return groups, nil
+	}
+	args = append(args, now.Add(-longest))
+	query := fmt.Sprintf(`SELECT
+		COALESCE(probe_cc, ''), COALESCE(platform, ''),
+		COALESCE(software_version, ''), %s
+		FROM %s
+		WHERE deactivated_at IS NULL AND
+		COALESCE(last_seen, last_updated) >= $%d
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3`,
+		strings.Join(counts, ", "),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count active probes")
+		return groups, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		g := GroupCount{Counts: make([]int64, len(windows))}
+		dest := []interface{}{&g.ProbeCC, &g.Platform, &g.SoftwareVersion}
+		for i := range g.Counts {
+			dest = append(dest, &g.Counts[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			ctx.WithError(err).Error("failed to iterate over active probes")
+			return groups, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// DeactivateStale deactivates the probes that weren't seen since before,
+// returning their ids. Their last update time is kept, so that it's still
+// known when they were last heard from.
+func DeactivateStale(db *sqlx.DB, before time.Time) ([]string, error) {
+	var clientIDs []string
+	query := fmt.Sprintf(`UPDATE %s SET
+		%s
+		WHERE deactivated_at IS NULL AND
+		COALESCE(last_seen, last_updated) < $1
+		RETURNING id`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		deactivateColumns)
+	err := db.Select(&clientIDs, query, before, time.Now().UTC(), "Stale")
+	if err != nil {
+		ctx.WithError(err).Error("failed to deactivate stale probes")
+	}
+	return clientIDs, err
+}
@@ -0,0 +1,136 @@
+package probes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// Kind values of a BlockEntry
+const (
+	BlockProbeID	= "probe_id"
+	BlockToken		= "token"
+)
+
+// BlockEntry keeps a probe, by id or by push token, from using the API and
+// from being given tasks. Blocking the token also catches the device when
+// it registers again.
+type BlockEntry struct {
+	Kind			string `json:"kind" binding:"required"`
+	Value			string `json:"value" binding:"required"`
+	Reason			string `json:"reason"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+var ErrBlocked = errors.New("probe is blocked")
+var ErrInvalidBlockKind = errors.New("invalid blocklist kind")
+var ErrBlockNotFound = errors.New("blocklist entry not found")
+
+// Block adds the entry to the blocklist, blocking a value again updates the
+// reason.
+func Block(db *sqlx.DB, e BlockEntry) error {
+	if e.Kind != BlockProbeID && e.Kind != BlockToken {
+		return ErrInvalidBlockKind
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (kind, value, reason, creation_time)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, value) DO UPDATE SET reason = EXCLUDED.reason`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")))
+	_, err := db.Exec(query, e.Kind, e.Value, e.Reason, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to add to blocklist")
+	}
+	return err
+}
+
+// Unblock removes the entry from the blocklist
+func Unblock(db *sqlx.DB, kind string, value string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE kind = $1 AND value = $2`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")))
+	res, err := db.Exec(query, kind, value)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove from blocklist")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// ListBlocked returns the blocklist, the most recent entries first
+func ListBlocked(db *sqlx.DB) ([]BlockEntry, error) {
+	var entries = make([]BlockEntry, 0)
+	query := fmt.Sprintf(`SELECT kind, value, COALESCE(reason, ''), creation_time
+		FROM %s ORDER BY creation_time DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")))
+	rows, err := db.Query(query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list blocklist")
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e BlockEntry
+		err = rows.Scan(&e.Kind, &e.Value, &e.Reason, &e.CreationTime)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over blocklist")
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// NotBlockedCondition returns the condition that the active probes aliased
+// alias (none when empty) aren't blocked, by id nor by token.
+func NotBlockedCondition(alias string) string {
+	prefix := pq.QuoteIdentifier(
+		viper.GetString("database.active-probes-table")) + "."
+	if alias != "" {
+		prefix = alias + "."
+	}
+	table := pq.QuoteIdentifier(viper.GetString("database.blocklist-table"))
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM %[1]s AS b
+		WHERE (b.kind = '%[2]s' AND b.value = CAST(%[4]sid AS TEXT)) OR
+			(b.kind = '%[3]s' AND b.value = %[4]stoken))`,
+		table, BlockProbeID, BlockToken, prefix)
+}
+
+// IsBlocked tells whether the probe is blocked, by id or by token
+func IsBlocked(db *sqlx.DB, clientID string) (bool, error) {
+	var blocked bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %[1]s AS b
+		WHERE b.kind = '%[2]s' AND b.value = $1) OR EXISTS(
+		SELECT 1 FROM %[3]s AS p WHERE CAST(p.id AS TEXT) = $1 AND NOT %[4]s)`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")),
+		BlockProbeID,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		NotBlockedCondition("p"))
+	err := db.QueryRow(query, clientID).Scan(&blocked)
+	if err != nil {
+		ctx.WithError(err).Error("failed to check blocklist")
+	}
+	return blocked, err
+}
+
+// isTokenBlocked tells whether the push token is blocked
+func isTokenBlocked(db *sqlx.DB, token string) (bool, error) {
+	var blocked bool
+	if token == "" {
+		return false, nil
+	}
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s
+		WHERE kind = $1 AND value = $2)`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")))
+	err := db.QueryRow(query, BlockToken, token).Scan(&blocked)
+	if err != nil {
+		ctx.WithError(err).Error("failed to check blocklist")
+	}
+	return blocked, err
+}
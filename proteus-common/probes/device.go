@@ -0,0 +1,241 @@
+package probes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+var ErrClientNotFound = errors.New("client is not registered")
+var ErrInvalidCountry = errors.New("invalid probe_cc")
+
+var countryRegexp = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// DeviceUpdate holds the fields a probe can change about itself, the ones
+// left out are kept as they are.
+type DeviceUpdate struct {
+	Token			*string `json:"token"`
+	SoftwareVersion	*string `json:"software_version"`
+	ProbeCC			*string `json:"probe_cc"`
+	ProbeASN		*string `json:"probe_asn"`
+	NetworkType		*string `json:"network_type"`
+	Locale			*string `json:"locale"`
+}
+
+// columns returns the values of the update by active probes column
+func (u DeviceUpdate) columns() map[string]*string {
+	if u.Locale != nil {
+		locale := NormalizeLocale(*u.Locale)
+		u.Locale = &locale
+	}
+	if u.ProbeCC != nil {
+		cc := strings.ToUpper(strings.TrimSpace(*u.ProbeCC))
+		u.ProbeCC = &cc
+	}
+	return map[string]*string{
+		"token": u.Token,
+		"software_version": u.SoftwareVersion,
+		"probe_cc": u.ProbeCC,
+		"probe_asn": u.ProbeASN,
+		"network_type": u.NetworkType,
+		"locale": u.Locale,
+	}
+}
+
+// The order in which the changed fields are reported
+var deviceColumns = []string{"token", "software_version", "probe_cc",
+							"probe_asn", "network_type", "locale"}
+
+// UpdateDevice applies the update to the probe and returns the fields that
+// changed. Every change is recorded in the probe updates table along with
+// the fields it changed, since they drive what the probe is targeted by.
+func UpdateDevice(db *sqlx.DB, clientID string, u DeviceUpdate) ([]string, error) {
+	var changed = make([]string, 0)
+	values := u.columns()
+	if cc := values["probe_cc"]; cc != nil && !countryRegexp.MatchString(*cc) {
+		return changed, ErrInvalidCountry
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return changed, err
+	}
+
+	current := make([]string, len(deviceColumns))
+	dest := make([]interface{}, len(deviceColumns))
+	selected := make([]string, len(deviceColumns))
+	for i, column := range deviceColumns {
+		dest[i] = &current[i]
+		selected[i] = fmt.Sprintf("COALESCE(%s, '')", column)
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE CAST(id AS TEXT) = $1 FOR UPDATE`,
+		strings.Join(selected, ", "),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err = tx.QueryRow(query, clientID).Scan(dest...)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return changed, ErrClientNotFound
+		}
+		ctx.WithError(err).Error("failed to get device")
+		return changed, err
+	}
+
+	now := time.Now().UTC()
+	var (
+		set = []string{"last_updated = $2"}
+		args = []interface{}{clientID, now}
+		// token is the first of deviceColumns
+		oldToken = current[0]
+	)
+	for i, column := range deviceColumns {
+		value := values[column]
+		if value == nil || *value == current[i] {
+			continue
+		}
+		changed = append(changed, column)
+		args = append(args, *value)
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if len(changed) == 0 {
+		tx.Rollback()
+		return changed, nil
+	}
+	for _, column := range changed {
+		if column == "token" {
+			// A new token is worth trying again
+			set = append(set, "token_invalid_since = NULL",
+								"token_invalid_reason = NULL")
+		}
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET %s WHERE CAST(id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		strings.Join(set, ", "))
+	if _, err = tx.Exec(query, args...); err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to update device")
+		return changed, err
+	}
+	if values["token"] != nil && *values["token"] != oldToken {
+		err = replaceToken(tx, clientID, oldToken, *values["token"], now)
+		if err != nil {
+			tx.Rollback()
+			return changed, err
+		}
+	}
+
+	err = recordUpdate(tx, clientID, "device_update", changed, now)
+	if err != nil {
+		tx.Rollback()
+		return changed, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return changed, err
+	}
+	if values["token"] != nil && *values["token"] != oldToken {
+		migratePendingNotifications(db, oldToken, *values["token"])
+	}
+	return changed, nil
+}
+
+// recordUpdate copies the probe as it is now into the probe updates table,
+// along with the fields the update changed.
+func recordUpdate(tx *sql.Tx, clientID string, updateType string,
+					changed []string, now time.Time) error {
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, update_time,
+		client_id,
+		probe_cc, probe_asn,
+		platform, software_name,
+		software_version, supported_tests,
+		network_type, available_bandwidth,
+		token, probe_family,
+		probe_id, update_type,
+		locale,
+		region, city,
+		changed_fields
+	) SELECT
+		$1, $2,
+		id,
+		probe_cc, probe_asn,
+		platform, software_name,
+		software_version, supported_tests,
+		network_type, available_bandwidth,
+		token, probe_family,
+		probe_id, $3,
+		locale,
+		region, city,
+		$4
+		FROM %s WHERE CAST(id AS TEXT) = $5`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	_, err := tx.Exec(query, uuid.NewV4().String(), now, updateType,
+					pq.Array(changed), clientID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to add data to update table, rolling back")
+	}
+	return err
+}
+
+// deactivateColumns deactivate a probe at $2 for reason $3: its push token
+// is invalidated and its other ways of being notified forgotten.
+const deactivateColumns = `deactivated_at = $2,
+		token_invalid_since = COALESCE(token_invalid_since, $2),
+		token_invalid_reason = COALESCE(token_invalid_reason, $3),
+		callback_url = NULL,
+		callback_secret = NULL,
+		request_secret = NULL,
+		webpush_endpoint = NULL,
+		webpush_p256dh = NULL,
+		webpush_auth = NULL`
+
+// Deactivate marks the probe as inactive, e.g. because the user opted out,
+// so that it's no longer targeted nor notified.
+func Deactivate(db *sqlx.DB, clientID string) error {
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s SET
+		%s,
+		last_updated = $2
+		WHERE CAST(id AS TEXT) = $1 AND deactivated_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		deactivateColumns)
+	res, err := db.Exec(query, clientID, now, "Deactivated")
+	if err != nil {
+		ctx.WithError(err).Error("failed to deactivate probe")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// RequestSecret returns the secret the active probe signs its requests
+// with, empty when it doesn't.
+func RequestSecret(db *sqlx.DB, clientID string) (string, error) {
+	var secret string
+	query := fmt.Sprintf(`SELECT COALESCE(request_secret, '') FROM %s
+		WHERE CAST(id AS TEXT) = $1 AND deactivated_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", ErrClientNotFound
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to get request secret")
+		return "", err
+	}
+	return secret, nil
+}
@@ -0,0 +1,133 @@
+package probes
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// DeviceExport is what the active probes, probe updates and token history
+// tables hold about a probe. The secrets it was registered with are left
+// out.
+type DeviceExport struct {
+	Probe	types.JSONText `json:"probe"`
+	Updates	types.JSONText `json:"updates"`
+	Tokens	types.JSONText `json:"tokens"`
+}
+
+// ExportDevice returns all the data stored about the probe
+func ExportDevice(db *sqlx.DB, clientID string) (DeviceExport, error) {
+	var export DeviceExport
+	query := fmt.Sprintf(`SELECT
+		to_jsonb(p) - 'callback_secret' - 'request_secret' - 'webpush_p256dh' - 'webpush_auth',
+		(SELECT COALESCE(jsonb_agg(to_jsonb(u) ORDER BY u.update_time), '[]')
+			FROM %s AS u WHERE u.client_id = p.id),
+		(SELECT COALESCE(jsonb_agg(to_jsonb(h) ORDER BY h.retired_at), '[]')
+			FROM %s AS h WHERE h.probe_id = p.id)
+		FROM %s AS p WHERE CAST(p.id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")),
+		pq.QuoteIdentifier(viper.GetString("database.token-history-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID).Scan(&export.Probe, &export.Updates,
+											&export.Tokens)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return export, ErrClientNotFound
+		}
+		ctx.WithError(err).Error("failed to export device")
+		return export, err
+	}
+	return export, nil
+}
+
+// RequestDeletion deactivates the probe and schedules its data for deletion
+// once the grace period is over, returning when that is. Asking again
+// doesn't postpone the deletion.
+func RequestDeletion(db *sqlx.DB, clientID string,
+					grace time.Duration) (time.Time, error) {
+	var requestedAt time.Time
+	query := fmt.Sprintf(`UPDATE %s SET
+		deletion_requested_at = COALESCE(deletion_requested_at, $2)
+		WHERE CAST(id AS TEXT) = $1
+		RETURNING deletion_requested_at`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID, time.Now().UTC()).Scan(&requestedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return requestedAt, ErrClientNotFound
+		}
+		ctx.WithError(err).Error("failed to request deletion")
+		return requestedAt, err
+	}
+	// The probe may have been deactivated already
+	if err = Deactivate(db, clientID); err != nil && err != ErrClientNotFound {
+		return requestedAt, err
+	}
+	return requestedAt.Add(grace), nil
+}
+
+// PendingDeletions returns the probes whose deletion was requested before
+// the given time.
+func PendingDeletions(db *sqlx.DB, before time.Time) ([]string, error) {
+	var clientIDs []string
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE deletion_requested_at <= $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.Select(&clientIDs, query, before)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list pending deletions")
+	}
+	return clientIDs, err
+}
+
+// DeviceTokens returns the push tokens the probe has and had
+func DeviceTokens(tx *sql.Tx, clientID string) ([]string, error) {
+	var tokens []string
+	query := fmt.Sprintf(`SELECT token FROM %s
+		WHERE CAST(id AS TEXT) = $1 AND COALESCE(token, '') != ''
+		UNION
+		SELECT token FROM %s WHERE CAST(probe_id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		pq.QuoteIdentifier(viper.GetString("database.token-history-table")))
+	rows, err := tx.Query(query, clientID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get device tokens")
+		return tokens, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// PurgeDevice deletes the probe from the tables of the registry, including
+// the audit trail of its updates and the account it logs in with.
+func PurgeDevice(tx *sql.Tx, clientID string) error {
+	for _, q := range []struct {
+		table	string
+		column	string
+	}{
+		{"database.probe-updates-table", "CAST(client_id AS TEXT)"},
+		{"database.token-history-table", "CAST(probe_id AS TEXT)"},
+		{"database.accounts-table", "username"},
+		{"database.active-probes-table", "CAST(id AS TEXT)"},
+	} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`,
+			pq.QuoteIdentifier(viper.GetString(q.table)), q.column)
+		if _, err := tx.Exec(query, clientID); err != nil {
+			ctx.WithError(err).Errorf("failed to purge device from %s",
+										viper.GetString(q.table))
+			return err
+		}
+	}
+	return nil
+}
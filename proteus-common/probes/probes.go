@@ -0,0 +1,575 @@
+// Package probes holds the data model of the probes and the accessors of the
+// active probes table, shared by the services probes register with.
+package probes
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/attestation"
+	"github.com/thetorproject/proteus/proteus-common/quiethours"
+
+	"github.com/apex/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "probes",
+})
+
+type ClientData struct {
+	ProbeCC string `json:"probe_cc" binding:"required"`
+	ProbeASN string `json:"probe_asn" binding:"required"`
+	Platform string `json:"platform" binding:"required"`
+
+	SoftwareName string `json:"software_name" binding:"required"`
+	SoftwareVersion string `json:"software_version" binding:"required"`
+	SupportedTests []string `json:"supported_tests" binding:"required"`
+
+	NetworkType string `json:"network_type"`
+	AvailableBandwidth string `json:"available_bandwidth"`
+	
+	Token string `json:"token"`
+
+	ProbeFamily string `json:"probe_family"`
+	ProbeID string `json:"probe_id"`
+
+	// BCP 47 language tag of the device, e.g. "pt-BR"
+	Locale string `json:"locale"`
+
+	// Probes that can't receive mobile pushes (e.g. lepidopter devices) can
+	// be notified of new tasks with a signed POST to this URL
+	CallbackURL string `json:"callback_url"`
+	CallbackSecret string `json:"callback_secret"`
+
+	// Headless probes can sign their requests with this secret instead of
+	// logging in, see the middleware package. Kept when not sent again.
+	RequestSecret string `json:"request_secret"`
+
+	// Browser based probes are notified through the Web Push subscription
+	// they got from their push service
+	WebPush *WebPushSubscription `json:"web_push"`
+
+	// IANA name of the timezone of the device, e.g. "Europe/Rome", and the
+	// hours in that timezone during which it doesn't want to be notified,
+	// e.g. "22:00-07:00".
+	Timezone string `json:"timezone"`
+	QuietHours string `json:"quiet_hours"`
+
+	// Looked up with GeoIP when the probe checks in
+	Region string `json:"-"`
+	City string `json:"-"`
+
+	// Proof that the registration comes from a genuine app, see the
+	// attestation package
+	Attestation *attestation.Attestation `json:"attestation"`
+
+	Password string `json:"password"`
+}
+
+var ErrInvalidCallbackURL = errors.New("invalid callback url")
+var ErrWeakRequestSecret = errors.New("request secret must be at least 32 characters")
+
+// The shortest request secret, as long as a hex encoded 128 bits key
+const minRequestSecretLength = 32
+
+func checkRequestSecret(secret string) error {
+	if secret != "" && len(secret) < minRequestSecretLength {
+		return ErrWeakRequestSecret
+	}
+	return nil
+}
+
+func checkCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidCallbackURL
+	}
+	return nil
+}
+
+// WebPushSubscription is a PushSubscription as serialised by its toJSON
+// method in the browser
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys struct {
+		// Public key of the browser and authentication secret, base64url
+		// encoded
+		P256dh string `json:"p256dh"`
+		Auth string `json:"auth"`
+	} `json:"keys"`
+}
+
+var ErrInvalidWebPushSubscription = errors.New("invalid web push subscription")
+
+func checkWebPush(s *WebPushSubscription) error {
+	if s == nil {
+		return nil
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ErrInvalidWebPushSubscription
+	}
+	// An uncompressed P-256 point and a 16 bytes secret
+	p256dh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.P256dh, "="))
+	if err != nil || len(p256dh) != 65 {
+		return ErrInvalidWebPushSubscription
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return ErrInvalidWebPushSubscription
+	}
+	return nil
+}
+
+// webPushColumns returns the endpoint and keys of the subscription, empty
+// if there is none
+func (req ClientData) webPushColumns() (string, string, string) {
+	if req.WebPush == nil {
+		return "", "", ""
+	}
+	return req.WebPush.Endpoint, req.WebPush.Keys.P256dh, req.WebPush.Keys.Auth
+}
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+var ErrInvalidQuietHours = errors.New("invalid quiet hours")
+
+func checkQuietHours(req ClientData) error {
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	if req.QuietHours == "" {
+		return nil
+	}
+	// Quiet hours are meaningless without knowing when midnight is
+	if req.Timezone == "" {
+		return ErrInvalidQuietHours
+	}
+	if _, err := quiethours.Parse(req.QuietHours); err != nil {
+		return ErrInvalidQuietHours
+	}
+	return nil
+}
+
+// NormalizeLocale turns the locales sent by the various platforms (e.g.
+// "pt_BR") into a BCP 47 style tag, so that they can be matched by jobs.
+func NormalizeLocale(locale string) string {
+	return strings.Replace(strings.TrimSpace(locale), "_", "-", -1)
+}
+
+func IsClientRegistered(db *sqlx.DB, clientID string) (bool, error) {
+	var found string
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE id = $1`,
+				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID).Scan(&found)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Update replaces the data of a registered probe, keeping track of the
+// previous one in the probe updates table.
+func Update(db *sqlx.DB, clientID string, req ClientData) (error) {
+	if err := checkCallbackURL(req.CallbackURL); err != nil {
+		return err
+	}
+	if err := checkRequestSecret(req.RequestSecret); err != nil {
+		return err
+	}
+	if err := checkQuietHours(req); err != nil {
+		return err
+	}
+	if err := checkWebPush(req.WebPush); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+
+	var oldToken string
+	{
+		query := fmt.Sprintf(`SELECT COALESCE(token, '') FROM %s
+			WHERE id = $1 FOR UPDATE`,
+			pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+		err = tx.QueryRow(query, clientID).Scan(&oldToken)
+		if err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				return ErrClientNotFound
+			}
+			ctx.WithError(err).Error("failed to get device token")
+			return err
+		}
+	}
+
+	// Write into the updates table
+	{
+		query := fmt.Sprintf(`INSERT INTO %s (
+			id, update_time,
+			client_id,
+			probe_cc, probe_asn,
+			platform, software_name,
+			software_version, supported_tests,
+			network_type, available_bandwidth,
+			token, probe_family,
+			probe_id, update_type,
+			locale,
+			region, city
+		) VALUES (
+			$1, $2,
+			$3, $4,
+			$5, $6,
+			$7, $8,
+			$9, $10,
+			$11, $12,
+			$13, $14, $15,
+			$16,
+			$17, $18)`,
+			pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")))
+
+		stmt, err := tx.Prepare(query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare update probes query")
+			return err
+		}
+
+		updateID := uuid.NewV4().String()
+		_, err = stmt.Exec(updateID, time.Now().UTC(),
+							clientID,
+							req.ProbeCC, req.ProbeASN,
+							req.Platform, req.SoftwareName,
+							req.SoftwareVersion, pq.Array(req.SupportedTests),
+							req.NetworkType, req.AvailableBandwidth,
+							req.Token, req.ProbeFamily,
+							req.ProbeID, "register",
+							NormalizeLocale(req.Locale),
+							req.Region, req.City)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to add data to update table, rolling back")
+			tx.Rollback()
+			return errors.New("error in adding data to update probes")
+		}
+	}
+
+	// Write into the active probes table. A token the push service
+	// rejected stays invalid until the probe sends a new one.
+	{
+		query := fmt.Sprintf(`UPDATE %s SET
+			last_updated = $2,
+			probe_cc = $3,
+			probe_asn = $4,
+			platform = $5,
+			software_name = $6,
+			software_version = $7,
+			supported_tests = $8,
+			network_type = $9,
+			available_bandwidth = $10,
+			token = $11,
+			token_invalid_since = CASE WHEN token IS DISTINCT FROM $11
+				THEN NULL ELSE token_invalid_since END,
+			token_invalid_reason = CASE WHEN token IS DISTINCT FROM $11
+				THEN NULL ELSE token_invalid_reason END,
+			probe_family = $12,
+			probe_id = $13,
+			locale = $14,
+			region = $15,
+			city = $16,
+			callback_url = $17,
+			callback_secret = $18,
+			timezone = $19,
+			quiet_hours = $20,
+			webpush_endpoint = $21,
+			webpush_p256dh = $22,
+			webpush_auth = $23,
+			request_secret = COALESCE(NULLIF($24, ''), request_secret)
+			WHERE id = $1`,
+			pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+
+		stmt, err := tx.Prepare(query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare update probes query")
+			return err
+		}
+		webPushEndpoint, webPushP256dh, webPushAuth := req.webPushColumns()
+		_, err = stmt.Exec(clientID,
+							time.Now().UTC(),
+							req.ProbeCC,
+							req.ProbeASN,
+							req.Platform,
+							req.SoftwareName,
+							req.SoftwareVersion,
+							pq.Array(req.SupportedTests),
+							req.NetworkType,
+							req.AvailableBandwidth,
+							req.Token,
+							req.ProbeFamily,
+							req.ProbeID,
+							NormalizeLocale(req.Locale),
+							req.Region,
+							req.City,
+							req.CallbackURL,
+							req.CallbackSecret,
+							req.Timezone,
+							req.QuietHours,
+							webPushEndpoint,
+							webPushP256dh,
+							webPushAuth,
+							req.RequestSecret)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to update active table, rolling back")
+			tx.Rollback()
+			return errors.New("failed to update active table")
+		}
+	}
+
+	if req.Token != oldToken {
+		err = replaceToken(tx, clientID, oldToken, req.Token, time.Now().UTC())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+
+	if req.Token != oldToken {
+		migratePendingNotifications(db, oldToken, req.Token)
+	}
+	return nil
+}
+
+
+var ErrMissingToken = errors.New("missing device token")
+var ErrMissingPassword = errors.New("missing password")
+var ErrAttestationFailed = errors.New("attestation failed")
+var ErrAttestationRequired = errors.New("attestation required")
+
+// Register adds a probe to the active probes and creates the account it
+// logs in with, returning its client ID.
+func Register(db *sqlx.DB, req ClientData) (string, error) {
+	if ((req.Platform == "ios" || req.Platform == "android") &&
+			req.Token == "" && req.CallbackURL == "") {
+		return "", ErrMissingToken
+	}
+	if err := checkWebPush(req.WebPush); err != nil {
+		return "", err
+	}
+	if err := checkCallbackURL(req.CallbackURL); err != nil {
+		return "", err
+	}
+	if err := checkRequestSecret(req.RequestSecret); err != nil {
+		return "", err
+	}
+	if err := checkQuietHours(req); err != nil {
+		return "", err
+	}
+	if (req.Password == "") {
+		return "", ErrMissingPassword
+	}
+	if blocked, err := isTokenBlocked(db, req.Token); err != nil {
+		return "", err
+	} else if blocked {
+		return "", ErrBlocked
+	}
+	attestationLevel, err := attestation.Verify(req.Attestation,
+		attestation.Subject{
+			Platform: req.Platform,
+			SoftwareName: req.SoftwareName,
+			SoftwareVersion: req.SoftwareVersion,
+		})
+	if err != nil {
+		return "", ErrAttestationFailed
+	}
+	if !attestation.AtLeast(attestationLevel,
+					viper.GetString("attestation.required-level")) {
+		return "", ErrAttestationRequired
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return "", err
+	}
+
+	var clientID = uuid.NewV4().String()
+
+	{
+		query := fmt.Sprintf(`INSERT INTO %s (
+			id, creation_time,
+			last_updated,
+			probe_cc, probe_asn,
+			platform, software_name,
+			software_version, supported_tests,
+			network_type, available_bandwidth,
+			token, probe_family,
+			probe_id, locale,
+			region, city,
+			callback_url, callback_secret,
+			timezone, quiet_hours,
+			webpush_endpoint, webpush_p256dh, webpush_auth,
+			attestation_level, request_secret
+		) VALUES (
+			$1, $2,
+			$3, $4,
+			$5, $6,
+			$7, $8,
+			$9, $10,
+			$11, $12,
+			$13, $14, $15,
+			$16, $17,
+			$18, $19,
+			$20, $21,
+			$22, $23, $24,
+			$25, NULLIF($26, ''))`,
+			pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+
+		stmt, err := tx.Prepare(query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare active probes query")
+			return "", err
+		}
+		defer stmt.Close()
+
+		webPushEndpoint, webPushP256dh, webPushAuth := req.webPushColumns()
+		_, err = stmt.Exec(clientID, time.Now().UTC(),
+							time.Now().UTC(),
+							req.ProbeCC, req.ProbeASN,
+							req.Platform, req.SoftwareName,
+							req.SoftwareVersion, pq.Array(req.SupportedTests),
+							req.NetworkType, req.AvailableBandwidth,
+							req.Token, req.ProbeFamily,
+							req.ProbeID, NormalizeLocale(req.Locale),
+							req.Region, req.City,
+							req.CallbackURL, req.CallbackSecret,
+							req.Timezone, req.QuietHours,
+							webPushEndpoint, webPushP256dh, webPushAuth,
+							attestationLevel, req.RequestSecret)
+		if err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to insert into active probes table, rolling back")
+			return "", err
+		}
+		// A device registering again keeps its token
+		err = supersedeToken(tx, clientID, req.Token, time.Now().UTC())
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	{
+		query := fmt.Sprintf(`INSERT INTO %s (
+			id, update_time,
+			client_id,
+			probe_cc, probe_asn,
+			platform, software_name,
+			software_version, supported_tests,
+			network_type, available_bandwidth,
+			token, probe_family,
+			probe_id, update_type,
+			locale,
+			region, city
+		) VALUES (
+			$1, $2,
+			$3, $4,
+			$5, $6,
+			$7, $8,
+			$9, $10,
+			$11, $12,
+			$13, $14, $15,
+			$16,
+			$17, $18)`,
+			pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")))
+
+		stmt, err := tx.Prepare(query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare update probes query")
+			return "", err
+		}
+		defer stmt.Close()
+
+		updateID := uuid.NewV4().String()
+		_, err = stmt.Exec(updateID, time.Now().UTC(),
+							clientID,
+							req.ProbeCC, req.ProbeASN,
+							req.Platform, req.SoftwareName,
+							req.SoftwareVersion, pq.Array(req.SupportedTests),
+							req.NetworkType, req.AvailableBandwidth,
+							req.Token, req.ProbeFamily,
+							req.ProbeID, "register",
+							NormalizeLocale(req.Locale),
+							req.Region, req.City)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to add data to update table, rolling back")
+			tx.Rollback()
+			return "", errors.New("error in adding data to update probes")
+		}
+	}
+
+	{
+		query := fmt.Sprintf(`INSERT INTO %s (
+			username,
+			password_hash,
+			last_access,
+			role
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4)`,
+			pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
+
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			ctx.WithError(err).Error("failed to hash password")
+			return "", err
+		}
+
+		stmt, err := tx.Prepare(query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare accounts query")
+			return "", err
+		}
+		defer stmt.Close()
+
+		_, err = stmt.Exec(clientID,
+							string(passwordHash),
+							time.Now().UTC(),
+							"device")
+		if err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to insert into accounts table, rolling back")
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return "", err
+	}
+
+	return clientID, nil
+}
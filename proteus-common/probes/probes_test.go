@@ -0,0 +1,57 @@
+package probes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"pt_BR": "pt-BR",
+		" it ": "it",
+		"en-US": "en-US",
+	} {
+		if got := NormalizeLocale(locale); got != expected {
+			t.Errorf("expected %s for %q (got: %s)", expected, locale, got)
+		}
+	}
+}
+
+func TestCheckWebPush(t *testing.T) {
+	var s WebPushSubscription
+	s.Endpoint = "https://push.example.org/send/abc"
+	s.Keys.P256dh = "BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM"
+	s.Keys.Auth = "tBHItJI5svbpez7KI4CCXg"
+	if err := checkWebPush(&s); err != nil {
+		t.Errorf("expected the subscription to be valid (got: %v)", err)
+	}
+	if err := checkWebPush(nil); err != nil {
+		t.Errorf("expected no subscription to be valid (got: %v)", err)
+	}
+
+	invalid := s
+	invalid.Endpoint = "http://push.example.org/send/abc"
+	if err := checkWebPush(&invalid); err != ErrInvalidWebPushSubscription {
+		t.Errorf("expected plain http endpoints to be rejected (got: %v)", err)
+	}
+	invalid = s
+	invalid.Keys.Auth = "tBHItJI5"
+	if err := checkWebPush(&invalid); err != ErrInvalidWebPushSubscription {
+		t.Errorf("expected short secrets to be rejected (got: %v)", err)
+	}
+}
+
+func TestNotBlockedCondition(t *testing.T) {
+	viper.Set("database.active-probes-table", "active_probes")
+	viper.Set("database.blocklist-table", "probe_blocklist")
+	cond := NotBlockedCondition("p")
+	if !strings.Contains(cond, "CAST(p.id AS TEXT)") || !strings.Contains(cond, "p.token") {
+		t.Errorf("expected the condition to refer to alias p (got: %s)", cond)
+	}
+	cond = NotBlockedCondition("")
+	if !strings.Contains(cond, `"active_probes".token`) {
+		t.Errorf("expected the condition to refer to the table (got: %s)", cond)
+	}
+}
@@ -0,0 +1,183 @@
+package probes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// ErrTokenMismatch is returned when the old token a probe reports isn't
+// the one it's registered with, so the rotation can't be correlated.
+var ErrTokenMismatch = errors.New("old token does not match")
+
+// TokenChange is a push token a probe used to have
+type TokenChange struct {
+	Token		string `json:"token"`
+	ReplacedBy	string `json:"replaced_by"`
+	RetiredAt	time.Time `json:"retired_at"`
+}
+
+// supersedeToken deactivates the other probes registered with token: the
+// push service gives a token to a single app install, so they are earlier
+// registrations of the same device.
+func supersedeToken(tx *sql.Tx, clientID string, token string,
+					now time.Time) error {
+	if token == "" {
+		return nil
+	}
+	query := fmt.Sprintf(`UPDATE %s SET
+		deactivated_at = $3,
+		last_updated = $3,
+		token_invalid_since = COALESCE(token_invalid_since, $3),
+		token_invalid_reason = COALESCE(token_invalid_reason, 'Superseded')
+		WHERE token = $1 AND CAST(id AS TEXT) != $2 AND deactivated_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	res, err := tx.Exec(query, token, clientID, now)
+	if err != nil {
+		ctx.WithError(err).Error("failed to supersede duplicate probes")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		ctx.Infof("probe %s superseded %d registrations of the same device",
+				clientID, n)
+	}
+	return nil
+}
+
+// replaceToken records that the probe moved from oldToken to newToken and
+// dedupes the probes registered with newToken.
+func replaceToken(tx *sql.Tx, clientID string, oldToken string,
+					newToken string, now time.Time) error {
+	if oldToken != "" {
+		query := fmt.Sprintf(`INSERT INTO %s (
+			token, probe_id, replaced_by, retired_at
+		) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (token) DO UPDATE SET
+			probe_id = EXCLUDED.probe_id,
+			replaced_by = EXCLUDED.replaced_by,
+			retired_at = EXCLUDED.retired_at`,
+			pq.QuoteIdentifier(viper.GetString("database.token-history-table")))
+		_, err := tx.Exec(query, oldToken, clientID, newToken, now)
+		if err != nil {
+			ctx.WithError(err).Error("failed to record token history")
+			return err
+		}
+	}
+	return supersedeToken(tx, clientID, newToken, now)
+}
+
+// migratePendingNotifications moves the notifications still queued for
+// oldToken to newToken. The notifications table belongs to proteus-notify,
+// so this is best effort.
+func migratePendingNotifications(db *sqlx.DB, oldToken string, newToken string) {
+	if oldToken == "" || newToken == "" {
+		return
+	}
+	query := fmt.Sprintf(`UPDATE %s SET
+		tokens = ARRAY(SELECT DISTINCT unnest(
+			array_replace(tokens, $1::VARCHAR, $2::VARCHAR))),
+		last_updated = $3
+		WHERE state = 'pending' AND tokens @> ARRAY[$1]::VARCHAR[]`,
+		pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	_, err := db.Exec(query, oldToken, newToken, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Warn("failed to migrate pending notifications")
+	}
+}
+
+// RotateToken replaces the push token of the probe, which reports the token
+// it had so that the change can be correlated. Reporting the same rotation
+// again is a no-op.
+func RotateToken(db *sqlx.DB, clientID string, oldToken string,
+				newToken string) error {
+	if newToken == "" {
+		return ErrMissingToken
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	var current string
+	query := fmt.Sprintf(`SELECT COALESCE(token, '') FROM %s
+		WHERE CAST(id AS TEXT) = $1 FOR UPDATE`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err = tx.QueryRow(query, clientID).Scan(&current)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrClientNotFound
+		}
+		ctx.WithError(err).Error("failed to get device token")
+		return err
+	}
+	if current == newToken {
+		tx.Rollback()
+		return nil
+	}
+	if current != oldToken {
+		tx.Rollback()
+		return ErrTokenMismatch
+	}
+
+	now := time.Now().UTC()
+	query = fmt.Sprintf(`UPDATE %s SET
+		token = $2,
+		token_invalid_since = NULL,
+		token_invalid_reason = NULL,
+		last_updated = $3
+		WHERE CAST(id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	if _, err = tx.Exec(query, clientID, newToken, now); err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to update device token")
+		return err
+	}
+	if err = replaceToken(tx, clientID, oldToken, newToken, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = recordUpdate(tx, clientID, "token_rotation", []string{"token"}, now)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+
+	migratePendingNotifications(db, oldToken, newToken)
+	return nil
+}
+
+// GetTokenHistory returns the tokens the probe used to have, the most
+// recently retired first.
+func GetTokenHistory(db *sqlx.DB, clientID string) ([]TokenChange, error) {
+	var history = make([]TokenChange, 0)
+	query := fmt.Sprintf(`SELECT token, COALESCE(replaced_by, ''), retired_at
+		FROM %s WHERE CAST(probe_id AS TEXT) = $1
+		ORDER BY retired_at DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.token-history-table")))
+	rows, err := db.Query(query, clientID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get token history")
+		return history, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tc TokenChange
+		if err = rows.Scan(&tc.Token, &tc.ReplacedBy, &tc.RetiredAt); err != nil {
+			ctx.WithError(err).Error("failed to iterate over token history")
+			return history, err
+		}
+		history = append(history, tc)
+	}
+	return history, rows.Err()
+}
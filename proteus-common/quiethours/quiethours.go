@@ -0,0 +1,93 @@
+// Package quiethours implements the daily windows during which probes don't
+// want to be notified, e.g. "22:00-07:00" in the timezone of the device.
+package quiethours
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid quiet hours")
+
+// QuietHours is a window of the day, in minutes since midnight. Windows
+// where Start is after End go over midnight.
+type QuietHours struct {
+	Start	int
+	End		int
+}
+
+func parseClock(s string) (int, error) {
+	var h, m int
+	if len(s) != 5 {
+		return 0, ErrInvalid
+	}
+	if _, err := fmt.Sscanf(s, "%02d:%02d", &h, &m); err != nil {
+		return 0, ErrInvalid
+	}
+	if h > 23 || m > 59 || h < 0 || m < 0 {
+		return 0, ErrInvalid
+	}
+	return h*60 + m, nil
+}
+
+// Parse parses quiet hours in the "HH:MM-HH:MM" format
+func Parse(s string) (QuietHours, error) {
+	var q QuietHours
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return q, ErrInvalid
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return q, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return q, err
+	}
+	q.Start, q.End = start, end
+	return q, nil
+}
+
+func (q QuietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d",
+						q.Start/60, q.Start%60, q.End/60, q.End%60)
+}
+
+// Until returns when the quiet hours t falls in are over in the timezone
+// loc, or t itself if t is not in the quiet hours.
+func (q QuietHours) Until(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+	end := time.Date(local.Year(), local.Month(), local.Day(),
+					q.End/60, q.End%60, 0, 0, loc)
+	switch {
+	case q.Start < q.End && now >= q.Start && now < q.End:
+		return end
+	case q.Start > q.End && now < q.End:
+		return end
+	case q.Start > q.End && now >= q.Start:
+		return time.Date(local.Year(), local.Month(), local.Day()+1,
+						q.End/60, q.End%60, 0, 0, loc)
+	}
+	return t
+}
+
+// Within returns t if it falls in the window in the timezone loc, or when
+// the window starts next otherwise. It's the opposite of Until, for windows
+// during which probes are notified.
+func (q QuietHours) Within(t time.Time, loc *time.Location) time.Time {
+	if !q.Until(t, loc).Equal(t) {
+		return t
+	}
+	local := t.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(),
+						q.Start/60, q.Start%60, 0, 0, loc)
+	if start.Before(t) {
+		start = time.Date(local.Year(), local.Month(), local.Day()+1,
+							q.Start/60, q.Start%60, 0, 0, loc)
+	}
+	return start
+}
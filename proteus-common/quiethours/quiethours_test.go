@@ -0,0 +1,90 @@
+package quiethours
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse("22:00-07:30")
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	if q.Start != 22*60 || q.End != 7*60+30 {
+		t.Errorf("unexpected quiet hours %#v", q)
+	}
+	if q.String() != "22:00-07:30" {
+		t.Errorf("expected 22:00-07:30 (got: %s)", q.String())
+	}
+	for _, s := range []string{"", "22:00", "22-07", "24:00-07:00",
+								"22:60-07:00", "2200-0700", "22:00-07:00-08:00"} {
+		if _, err = Parse(s); err != ErrInvalid {
+			t.Errorf("expected %q to be invalid (got: %v)", s, err)
+		}
+	}
+}
+
+func TestUntil(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("no timezone database (%v)", err)
+	}
+	overnight, _ := Parse("22:00-07:00")
+	daytime, _ := Parse("09:00-17:00")
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		return t
+	}
+
+	for _, c := range []struct {
+		q			QuietHours
+		t			string
+		expected	string
+	}{
+		{overnight, "2017-03-01 23:10", "2017-03-02 07:00"},
+		{overnight, "2017-03-01 03:00", "2017-03-01 07:00"},
+		{overnight, "2017-03-01 07:00", "2017-03-01 07:00"},
+		{overnight, "2017-03-01 12:00", "2017-03-01 12:00"},
+		{daytime, "2017-03-01 10:00", "2017-03-01 17:00"},
+		{daytime, "2017-03-01 18:00", "2017-03-01 18:00"},
+		// The night the clocks go forward
+		{overnight, "2017-03-25 23:00", "2017-03-26 07:00"},
+	} {
+		got := c.q.Until(at(c.t).UTC(), loc)
+		if !got.Equal(at(c.expected)) {
+			t.Errorf("expected %s for %s in %s (got: %s)",
+					c.expected, c.t, c.q, got.In(loc))
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("no timezone database (%v)", err)
+	}
+	morning, _ := Parse("08:00-10:00")
+	overnight, _ := Parse("22:00-02:00")
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		return t
+	}
+
+	for _, c := range []struct {
+		q			QuietHours
+		t			string
+		expected	string
+	}{
+		{morning, "2017-03-01 06:30", "2017-03-01 08:00"},
+		{morning, "2017-03-01 09:00", "2017-03-01 09:00"},
+		{morning, "2017-03-01 10:00", "2017-03-02 08:00"},
+		{overnight, "2017-03-01 01:00", "2017-03-01 01:00"},
+		{overnight, "2017-03-01 12:00", "2017-03-01 22:00"},
+	} {
+		got := c.q.Within(at(c.t).UTC(), loc)
+		if !got.Equal(at(c.expected)) {
+			t.Errorf("expected %s for %s in %s (got: %s)",
+					c.expected, c.t, c.q, got.In(loc))
+		}
+	}
+}
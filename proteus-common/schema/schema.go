@@ -0,0 +1,244 @@
+// Package schema applies the migrations embedded in the binaries of the
+// services and checks the version of the schema of the database when they
+// start, so that an old binary doesn't run against a newer schema.
+//
+// Every service records the migrations it applied in its own schema version
+// table, proteus-registry and proteus-events share a database and used to
+// mix theirs up in gorp_migrations, the records are moved over from it the
+// first time.
+package schema
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/lib/pq"
+	"github.com/rubenv/sql-migrate"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "schema",
+})
+
+// The table sql-migrate records the migrations in by default
+const legacyTable = "gorp_migrations"
+
+var (
+	ErrSchemaTooNew = errors.New("the database schema is newer than this binary")
+	ErrSchemaOutdated = errors.New("the database schema is outdated, run the migrate up command")
+)
+
+// Migrator applies the migrations of a service
+type Migrator struct {
+	DB		*sql.DB
+	Source	migrate.MigrationSource
+	// The schema version table of the service
+	Table	string
+}
+
+// Status is the state of a migration
+type Status struct {
+	Id			string
+	Applied		bool
+	// The migration was applied by a newer binary
+	Unknown		bool
+	AppliedAt	string
+}
+
+// NewMigrator returns the Migrator of the migrations in data/migrations of
+// the bindata assets of a service.
+func NewMigrator(db *sql.DB, table string,
+				asset func(string) ([]byte, error),
+				assetDir func(string) ([]string, error)) *Migrator {
+	return &Migrator{
+		DB: db,
+		Source: &migrate.AssetMigrationSource{
+			Asset: asset,
+			AssetDir: assetDir,
+			Dir: "data/migrations",
+		},
+		Table: table,
+	}
+}
+
+// init creates the schema version table, filled in from gorp_migrations
+// when it exists.
+func (m *Migrator) init() error {
+	migrate.SetTable(m.Table)
+	table := pq.QuoteIdentifier(m.Table)
+	_, err := m.DB.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT NOT NULL PRIMARY KEY,
+		applied_at TIMESTAMP WITH TIME ZONE
+	)`, table))
+	if err != nil {
+		ctx.WithError(err).Error("failed to create the schema version table")
+		return err
+	}
+
+	var legacy sql.NullString
+	err = m.DB.QueryRow("SELECT to_regclass($1)::text", legacyTable).Scan(&legacy)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look for the legacy migrations table")
+		return err
+	}
+	if !legacy.Valid {
+		return nil
+	}
+	var count int
+	err = m.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count the applied migrations")
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	migrations, err := m.Source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, migration := range migrations {
+		ids = append(ids, migration.Id)
+	}
+	res, err := m.DB.Exec(fmt.Sprintf(`INSERT INTO %s (id, applied_at)
+		SELECT id, applied_at FROM %s WHERE id = ANY($1)`,
+		table, pq.QuoteIdentifier(legacyTable)), pq.Array(ids))
+	if err != nil {
+		ctx.WithError(err).Error("failed to copy the legacy migrations")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		ctx.Infof("moved %d migrations over from %s to %s", n, legacyTable, m.Table)
+	}
+	return nil
+}
+
+// compare returns the migrations not applied yet and the applied ones this
+// binary doesn't know of.
+func compare(migrations []*migrate.Migration,
+			records []*migrate.MigrationRecord) ([]string, []string) {
+	applied := make(map[string]bool)
+	for _, record := range records {
+		applied[record.Id] = true
+	}
+	var pending []string
+	known := make(map[string]bool)
+	for _, migration := range migrations {
+		known[migration.Id] = true
+		if !applied[migration.Id] {
+			pending = append(pending, migration.Id)
+		}
+	}
+	var unknown []string
+	for _, record := range records {
+		if !known[record.Id] {
+			unknown = append(unknown, record.Id)
+		}
+	}
+	return pending, unknown
+}
+
+// Status returns the state of every migration, in order
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	migrations, err := m.Source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	records, err := migrate.GetMigrationRecords(m.DB, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[string]string)
+	for _, record := range records {
+		appliedAt[record.Id] = record.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+	}
+	var statuses []Status
+	for _, migration := range migrations {
+		at, applied := appliedAt[migration.Id]
+		statuses = append(statuses, Status{
+			Id: migration.Id,
+			Applied: applied,
+			AppliedAt: at,
+		})
+	}
+	_, unknown := compare(migrations, records)
+	for _, id := range unknown {
+		statuses = append(statuses, Status{
+			Id: id,
+			Applied: true,
+			Unknown: true,
+			AppliedAt: appliedAt[id],
+		})
+	}
+	return statuses, nil
+}
+
+// Check returns the number of migrations to apply, or ErrSchemaTooNew when
+// the database has migrations this binary doesn't know of.
+func (m *Migrator) Check() (int, error) {
+	if err := m.init(); err != nil {
+		return 0, err
+	}
+	migrations, err := m.Source.FindMigrations()
+	if err != nil {
+		return 0, err
+	}
+	records, err := migrate.GetMigrationRecords(m.DB, "postgres")
+	if err != nil {
+		return 0, err
+	}
+	pending, unknown := compare(migrations, records)
+	if len(unknown) > 0 {
+		ctx.WithField("migrations", strings.Join(unknown, ", ")).Error(
+			"unknown migrations were applied")
+		return 0, ErrSchemaTooNew
+	}
+	return len(pending), nil
+}
+
+// Up applies at most max migrations, all of them when max is 0
+func (m *Migrator) Up(max int) (int, error) {
+	if _, err := m.Check(); err != nil {
+		return 0, err
+	}
+	return migrate.ExecMax(m.DB, "postgres", m.Source, migrate.Up, max)
+}
+
+// Down reverts the last max migrations
+func (m *Migrator) Down(max int) (int, error) {
+	if err := m.init(); err != nil {
+		return 0, err
+	}
+	return migrate.ExecMax(m.DB, "postgres", m.Source, migrate.Down, max)
+}
+
+// Startup brings the schema up to date when database.auto-migrate is set,
+// and otherwise refuses to go on unless it is.
+func (m *Migrator) Startup() error {
+	pending, err := m.Check()
+	if err != nil {
+		return err
+	}
+	if pending == 0 {
+		ctx.Info("the database schema is up to date")
+		return nil
+	}
+	if !viper.GetBool("database.auto-migrate") {
+		ctx.Errorf("%d migrations to apply", pending)
+		return ErrSchemaOutdated
+	}
+	n, err := m.Up(0)
+	if err != nil {
+		return err
+	}
+	ctx.Infof("performed %d migrations", n)
+	return nil
+}
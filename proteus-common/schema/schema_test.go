@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+func TestCompare(t *testing.T) {
+	migrations := []*migrate.Migration{
+		{Id: "1_jobs_create.sql"},
+		{Id: "2_add_jobs_state.sql"},
+		{Id: "10_tasks_state_varchar.sql"},
+	}
+	tests := []struct {
+		name	string
+		applied	[]string
+		pending	[]string
+		unknown	[]string
+	}{
+		{"empty", nil,
+			[]string{"1_jobs_create.sql", "2_add_jobs_state.sql",
+					"10_tasks_state_varchar.sql"}, nil},
+		{"behind", []string{"1_jobs_create.sql"},
+			[]string{"2_add_jobs_state.sql", "10_tasks_state_varchar.sql"}, nil},
+		{"gap", []string{"1_jobs_create.sql", "10_tasks_state_varchar.sql"},
+			[]string{"2_add_jobs_state.sql"}, nil},
+		{"up to date", []string{"1_jobs_create.sql", "2_add_jobs_state.sql",
+								"10_tasks_state_varchar.sql"}, nil, nil},
+		{"newer", []string{"1_jobs_create.sql", "2_add_jobs_state.sql",
+							"10_tasks_state_varchar.sql", "11_tasks_archive_create.sql"},
+			nil, []string{"11_tasks_archive_create.sql"}},
+	}
+	for _, test := range tests {
+		var records []*migrate.MigrationRecord
+		for _, id := range test.applied {
+			records = append(records, &migrate.MigrationRecord{Id: id})
+		}
+		pending, unknown := compare(migrations, records)
+		if !reflect.DeepEqual(pending, test.pending) {
+			t.Errorf("%s: expected pending %v (got: %v)", test.name, test.pending, pending)
+		}
+		if !reflect.DeepEqual(unknown, test.unknown) {
+			t.Errorf("%s: expected unknown %v (got: %v)", test.name, test.unknown, unknown)
+		}
+	}
+}
+
+func TestTableDiff(t *testing.T) {
+	table := Table{
+		Name: "jobs",
+		Columns: map[string]string{
+			"id": "uuid",
+			"state": "varchar",
+			"shared_with": "_varchar",
+		},
+	}
+	tests := []struct {
+		name		string
+		found		map[string]string
+		problems	[]string
+	}{
+		{"matching", map[string]string{"id": "uuid", "state": "varchar",
+										"shared_with": "_varchar",
+										"unused": "int4"}, nil},
+		{"missing table", map[string]string{},
+			[]string{"table jobs doesn't exist"}},
+		{"missing column", map[string]string{"id": "uuid", "state": "varchar"},
+			[]string{"jobs.shared_with is missing"}},
+		{"wrong type", map[string]string{"id": "varchar", "state": "varchar",
+											"shared_with": "varchar"},
+			[]string{"jobs.id is varchar instead of uuid",
+					"jobs.shared_with is varchar instead of _varchar"}},
+	}
+	for _, test := range tests {
+		problems := table.diff(test.found)
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: expected %v (got: %v)", test.name, test.problems, problems)
+		}
+	}
+}
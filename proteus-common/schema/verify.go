@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Table is a table a service expects to find
+type Table struct {
+	Name	string
+	// The type of every column the service uses by name, as the udt_name
+	// of information_schema.columns, e.g. "varchar", "timestamptz" or
+	// "_varchar" for an array of varchar
+	Columns	map[string]string
+}
+
+// MismatchError lists how the tables differ from the expected ones
+type MismatchError struct {
+	Problems	[]string
+}
+
+func (e *MismatchError) Error() string {
+	return "the database schema isn't the one expected: " +
+			strings.Join(e.Problems, "; ")
+}
+
+// Verify checks that the tables exist in the current schema with the
+// columns the service uses, so that a table missing or configured wrong is
+// reported when the service starts rather than by its first query. The
+// problems found are returned in a *MismatchError.
+func Verify(db *sql.DB, tables []Table) error {
+	var problems []string
+	for _, table := range tables {
+		found, err := tableColumns(db, table.Name)
+		if err != nil {
+			ctx.WithError(err).Errorf("failed to look up the columns of %s", table.Name)
+			return err
+		}
+		problems = append(problems, table.diff(found)...)
+	}
+	if len(problems) > 0 {
+		return &MismatchError{Problems: problems}
+	}
+	return nil
+}
+
+// tableColumns returns the type of every column of the table by name, none
+// when the table doesn't exist
+func tableColumns(db *sql.DB, table string) (map[string]string, error) {
+	rows, err := db.Query(`SELECT column_name, udt_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := make(map[string]string)
+	for rows.Next() {
+		var name, udt string
+		if err = rows.Scan(&name, &udt); err != nil {
+			return nil, err
+		}
+		found[name] = udt
+	}
+	return found, rows.Err()
+}
+
+// diff returns what is wrong with the columns found for the table
+func (t Table) diff(found map[string]string) []string {
+	if len(found) == 0 {
+		return []string{fmt.Sprintf("table %s doesn't exist", t.Name)}
+	}
+	names := make([]string, 0, len(t.Columns))
+	for name := range t.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		udt, ok := found[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s is missing",
+													t.Name, name))
+		} else if udt != t.Columns[name] {
+			problems = append(problems, fmt.Sprintf("%s.%s is %s instead of %s",
+													t.Name, name, udt,
+													t.Columns[name]))
+		}
+	}
+	return problems
+}
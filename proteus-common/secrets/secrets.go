@@ -0,0 +1,170 @@
+// Package secrets gets the secrets of the configuration, e.g. database.url
+// or auth.jwt-token, from HashiCorp Vault so that they don't have to be in
+// the config files. Every field of the secret at vault.path overrides the
+// config key it is named after.
+//
+// Like the rest of the configuration they can also come from the
+// environment, with the dots and dashes of the keys replaced by
+// underscores: DATABASE_URL, AUTH_JWT_TOKEN, FCM_SERVER_KEY.
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "secrets",
+})
+
+var ErrNotFound = errors.New("secret not found")
+
+// Vault reads the secret at Path, of a kv engine of version 1 or 2, with
+// Token from the Vault server at Address.
+type Vault struct {
+	Address	string
+	Token	string
+	Path	string
+	Client	*http.Client
+}
+
+// vaultResponse is what the Vault API answers, the fields depend on the
+// endpoint
+type vaultResponse struct {
+	Data	map[string]interface{}	`json:"data"`
+	Auth	*struct {
+		LeaseDuration	int		`json:"lease_duration"`
+		Renewable		bool	`json:"renewable"`
+	}								`json:"auth"`
+	Errors	[]string				`json:"errors"`
+}
+
+func (v *Vault) request(method string, path string, body interface{}) (vaultResponse, error) {
+	var resp vaultResponse
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return resp, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method,
+					strings.TrimRight(v.Address, "/") + "/v1/" + path, reader)
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotFound {
+		return resp, ErrNotFound
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil && err != io.EOF {
+		return resp, err
+	}
+	if r.StatusCode >= 300 {
+		return resp, fmt.Errorf("vault: %s %s: %d %s", method, path,
+								r.StatusCode, strings.Join(resp.Errors, ", "))
+	}
+	return resp, nil
+}
+
+// Read returns the fields of the secret
+func (v *Vault) Read() (map[string]interface{}, error) {
+	resp, err := v.request("GET", strings.Trim(v.Path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Version 2 of the kv engine nests the fields along with the metadata
+	if data, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+// RenewToken extends the lease of the token, it returns its new duration or
+// 0 if the token doesn't expire.
+func (v *Vault) RenewToken() (time.Duration, error) {
+	resp, err := v.request("POST", "auth/token/renew-self", map[string]string{})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Auth == nil || !resp.Auth.Renewable {
+		return 0, nil
+	}
+	return time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// apply overrides the config with the secret
+func apply(secret map[string]interface{}) {
+	for key, value := range secret {
+		viper.Set(key, value)
+	}
+}
+
+// watch renews the token every interval so that it doesn't expire while the
+// service runs, and tells when the secret changed since the services only
+// read most of their secrets when they start.
+func watch(v *Vault, secret map[string]interface{}, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := v.RenewToken(); err != nil {
+			ctx.WithError(err).Error("failed to renew the vault token")
+		}
+		current, err := v.Read()
+		if err != nil {
+			ctx.WithError(err).Error("failed to read the secrets from vault")
+			continue
+		}
+		for key, value := range current {
+			if !reflect.DeepEqual(secret[key], value) {
+				ctx.WithField("key", key).Warn("secret changed in vault, restart to use it")
+			}
+		}
+		secret = current
+	}
+}
+
+// Load overrides the config with the secret at vault.path of the Vault
+// server at vault.addr, and keeps the token alive every
+// vault.renew-interval. It does nothing when vault.addr isn't set.
+func Load() error {
+	if viper.GetString("vault.addr") == "" {
+		return nil
+	}
+	v := &Vault{
+		Address: viper.GetString("vault.addr"),
+		Token: viper.GetString("vault.token"),
+		Path: viper.GetString("vault.path"),
+	}
+	secret, err := v.Read()
+	if err != nil {
+		return err
+	}
+	apply(secret)
+	ctx.Infof("loaded %d secrets from %s", len(secret), v.Path)
+	if interval := viper.GetDuration("vault.renew-interval"); interval > 0 {
+		go watch(v, secret, interval)
+	}
+	return nil
+}
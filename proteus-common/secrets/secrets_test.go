@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func fakeVault(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/secret/data/proteus", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{
+					"database.url": "postgres://proteus:secret@db/proteus",
+					"auth.jwt-token": "jwt-secret",
+				},
+				"metadata": map[string]interface{}{"version": 3},
+			},
+		})
+	})
+	mux.HandleFunc("/v1/kv/proteus", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"fcm.server-key": "fcm-secret"}}`))
+	})
+	mux.HandleFunc("/v1/auth/token/renew-self", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected the token to be renewed with a POST (got: %s)", r.Method)
+		}
+		w.Write([]byte(`{"auth": {"lease_duration": 3600, "renewable": true}}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLoad(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+
+	viper.Set("vault.addr", server.URL)
+	viper.Set("vault.token", "s.token")
+	viper.Set("vault.path", "secret/data/proteus")
+	viper.Set("vault.renew-interval", 0)
+	defer viper.Set("vault.addr", "")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if viper.GetString("database.url") != "postgres://proteus:secret@db/proteus" ||
+			viper.GetString("auth.jwt-token") != "jwt-secret" {
+		t.Error("expected the config to be overridden by the secret")
+	}
+
+	viper.Set("vault.path", "kv/proteus")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if viper.GetString("fcm.server-key") != "fcm-secret" {
+		t.Error("expected secrets of version 1 of the kv engine to be read")
+	}
+
+	viper.Set("vault.path", "secret/data/missing")
+	if err := Load(); err != ErrNotFound {
+		t.Errorf("expected a missing secret to fail (got: %v)", err)
+	}
+	viper.Set("vault.path", "secret/data/proteus")
+	viper.Set("vault.token", "s.wrong")
+	if err := Load(); err == nil {
+		t.Error("expected a wrong token to fail")
+	}
+}
+
+func TestRenewToken(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+
+	v := &Vault{Address: server.URL, Token: "s.token"}
+	ttl, err := v.RenewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl.Hours() != 1 {
+		t.Errorf("expected the lease duration (got: %s)", ttl)
+	}
+}
@@ -0,0 +1,263 @@
+// Package settings assembles the settings document probes get when they
+// check in: where to submit measurements, the test helpers to use, how often
+// to poll and which features are enabled. The defaults come from the
+// configuration and admins override them by country and software version.
+package settings
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/tasksign"
+
+	"github.com/apex/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+var ctx = log.WithFields(log.Fields{
+	"pkg": "settings",
+})
+
+// Settings is the document returned to the probes. In an override the
+// fields left out keep the value they had, the flags and test helpers are
+// overridden one by one.
+type Settings struct {
+	CollectorEndpoints	[]string `json:"collector_endpoints,omitempty"`
+	TestHelpers			map[string][]string `json:"test_helpers,omitempty"`
+	// Go duration, e.g. "6h"
+	PollingInterval		string `json:"polling_interval,omitempty"`
+	FeatureFlags		map[string]bool `json:"feature_flags,omitempty"`
+	// The base64 Ed25519 public keys the tasks are signed with, they come
+	// from the configuration only
+	TaskSigningKeys		[]string `json:"task_signing_keys,omitempty"`
+}
+
+// Override applies Settings to the probes of a country and software
+// version, the empty ones match every probe.
+type Override struct {
+	Id				string `json:"id"`
+	ProbeCC			string `json:"probe_cc"`
+	SoftwareVersion	string `json:"software_version"`
+	Settings		Settings `json:"settings" binding:"required"`
+	Comment			string `json:"comment"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+var ErrOverrideNotFound = errors.New("settings override not found")
+var ErrInvalidPollingInterval = errors.New("invalid polling_interval")
+
+// Defaults returns the settings in the settings section of the
+// configuration
+func Defaults() Settings {
+	return Settings{
+		CollectorEndpoints: viper.GetStringSlice("settings.collector-endpoints"),
+		TestHelpers: viper.GetStringMapStringSlice("settings.test-helpers"),
+		PollingInterval: viper.GetString("settings.polling-interval"),
+		FeatureFlags: featureFlags(viper.GetStringMap("settings.feature-flags")),
+		TaskSigningKeys: tasksign.PublicKeys(),
+	}
+}
+
+func featureFlags(m map[string]interface{}) map[string]bool {
+	flags := make(map[string]bool, len(m))
+	for name, v := range m {
+		enabled, _ := v.(bool)
+		flags[name] = enabled
+	}
+	return flags
+}
+
+// Merge returns s with the fields set in o overriding its own
+func Merge(s Settings, o Settings) Settings {
+	merged := s
+	if o.CollectorEndpoints != nil {
+		merged.CollectorEndpoints = o.CollectorEndpoints
+	}
+	if o.PollingInterval != "" {
+		merged.PollingInterval = o.PollingInterval
+	}
+	if o.TestHelpers != nil {
+		merged.TestHelpers = make(map[string][]string,
+								len(s.TestHelpers) + len(o.TestHelpers))
+		for name, addrs := range s.TestHelpers {
+			merged.TestHelpers[name] = addrs
+		}
+		for name, addrs := range o.TestHelpers {
+			merged.TestHelpers[name] = addrs
+		}
+	}
+	if o.FeatureFlags != nil {
+		merged.FeatureFlags = make(map[string]bool,
+								len(s.FeatureFlags) + len(o.FeatureFlags))
+		for name, enabled := range s.FeatureFlags {
+			merged.FeatureFlags[name] = enabled
+		}
+		for name, enabled := range o.FeatureFlags {
+			merged.FeatureFlags[name] = enabled
+		}
+	}
+	return merged
+}
+
+// specificity orders the overrides from the most general to the most
+// specific one, which is applied last.
+func (o Override) specificity() int {
+	n := 0
+	if o.ProbeCC != "" {
+		n++
+	}
+	if o.SoftwareVersion != "" {
+		n += 2
+	}
+	return n
+}
+
+// Resolve returns the settings of the probes of the country running the
+// software version.
+func Resolve(db *sqlx.DB, probeCC string, softwareVersion string) (Settings, error) {
+	s := Defaults()
+	query := fmt.Sprintf(`SELECT settings FROM %s
+		WHERE COALESCE(probe_cc, '') IN ('', $1) AND
+		COALESCE(software_version, '') IN ('', $2)
+		ORDER BY
+			(CASE WHEN COALESCE(probe_cc, '') = '' THEN 0 ELSE 1 END) +
+			(CASE WHEN COALESCE(software_version, '') = '' THEN 0 ELSE 2 END),
+			creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.settings-overrides-table")))
+	rows, err := db.Query(query, strings.ToUpper(probeCC), softwareVersion)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get settings overrides")
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			raw types.JSONText
+			o Settings
+		)
+		if err = rows.Scan(&raw); err != nil {
+			ctx.WithError(err).Error("failed to iterate over settings overrides")
+			return s, err
+		}
+		if err = raw.Unmarshal(&o); err != nil {
+			ctx.WithError(err).Error("invalid settings override")
+			continue
+		}
+		s = Merge(s, o)
+	}
+	return s, rows.Err()
+}
+
+// ResolveForProbe returns the settings of a registered probe
+func ResolveForProbe(db *sqlx.DB, clientID string) (Settings, error) {
+	var probeCC, softwareVersion string
+	query := fmt.Sprintf(`SELECT
+		COALESCE(probe_cc, ''), COALESCE(software_version, '')
+		FROM %s WHERE CAST(id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID).Scan(&probeCC, &softwareVersion)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.WithError(err).Error("failed to get probe")
+		return Defaults(), err
+	}
+	return Resolve(db, probeCC, softwareVersion)
+}
+
+// AddOverride stores the override and returns its id
+func AddOverride(db *sqlx.DB, o Override) (string, error) {
+	if o.Settings.PollingInterval != "" {
+		d, err := time.ParseDuration(o.Settings.PollingInterval)
+		if err != nil || d <= 0 {
+			return "", ErrInvalidPollingInterval
+		}
+	}
+	// The probes trust these keys with their tasks, so they can't be
+	// changed through the API
+	o.Settings.TaskSigningKeys = nil
+	settingsStr, err := json.Marshal(o.Settings)
+	if err != nil {
+		return "", err
+	}
+	o.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, probe_cc, software_version, settings, comment, creation_time
+	) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6)`,
+		pq.QuoteIdentifier(viper.GetString("database.settings-overrides-table")))
+	_, err = db.Exec(query, o.Id, strings.ToUpper(o.ProbeCC), o.SoftwareVersion,
+					settingsStr, o.Comment, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into settings overrides table")
+		return "", err
+	}
+	return o.Id, nil
+}
+
+// ListOverrides returns the overrides in the order they are applied
+func ListOverrides(db *sqlx.DB) ([]Override, error) {
+	var overrides = make([]Override, 0)
+	query := fmt.Sprintf(`SELECT
+		id, COALESCE(probe_cc, ''), COALESCE(software_version, ''),
+		settings, COALESCE(comment, ''), creation_time
+		FROM %s ORDER BY creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.settings-overrides-table")))
+	rows, err := db.Query(query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list settings overrides")
+		return overrides, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			o Override
+			raw types.JSONText
+		)
+		err = rows.Scan(&o.Id, &o.ProbeCC, &o.SoftwareVersion,
+						&raw, &o.Comment, &o.CreationTime)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over settings overrides")
+			return overrides, err
+		}
+		if err = raw.Unmarshal(&o.Settings); err != nil {
+			return overrides, err
+		}
+		overrides = append(overrides, o)
+	}
+	if err = rows.Err(); err != nil {
+		return overrides, err
+	}
+	sortBySpecificity(overrides)
+	return overrides, nil
+}
+
+// sortBySpecificity keeps the overrides as specific as each other in the
+// order they were added
+func sortBySpecificity(overrides []Override) {
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].specificity() < overrides[j].specificity()
+	})
+}
+
+// DeleteOverride deletes the override
+func DeleteOverride(db *sqlx.DB, id string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE CAST(id AS TEXT) = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.settings-overrides-table")))
+	res, err := db.Exec(query, id)
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete settings override")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOverrideNotFound
+	}
+	return nil
+}
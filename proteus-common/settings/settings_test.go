@@ -0,0 +1,58 @@
+package settings
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := Settings{
+		CollectorEndpoints: []string{"https://a.collector.example.org"},
+		TestHelpers: map[string][]string{
+			"dns": []string{"8.8.8.8:53"},
+			"tcp-echo": []string{"37.218.241.94"},
+		},
+		PollingInterval: "6h",
+		FeatureFlags: map[string]bool{"websites": true, "im": true},
+	}
+	merged := Merge(base, Settings{
+		TestHelpers: map[string][]string{"dns": []string{"1.1.1.1:53"}},
+		PollingInterval: "1h",
+		FeatureFlags: map[string]bool{"im": false},
+	})
+	if merged.PollingInterval != "1h" {
+		t.Errorf("expected the polling interval to be overridden (got: %s)",
+				merged.PollingInterval)
+	}
+	if len(merged.CollectorEndpoints) != 1 {
+		t.Error("expected the collector endpoints to be kept")
+	}
+	if merged.TestHelpers["dns"][0] != "1.1.1.1:53" ||
+			merged.TestHelpers["tcp-echo"][0] != "37.218.241.94" {
+		t.Errorf("expected the test helpers to be overridden one by one (got: %v)",
+				merged.TestHelpers)
+	}
+	if !merged.FeatureFlags["websites"] || merged.FeatureFlags["im"] {
+		t.Errorf("expected the flags to be overridden one by one (got: %v)",
+				merged.FeatureFlags)
+	}
+	if !base.FeatureFlags["im"] {
+		t.Error("expected the defaults to be left untouched")
+	}
+}
+
+func TestSortBySpecificity(t *testing.T) {
+	overrides := []Override{
+		{Id: "both", ProbeCC: "IT", SoftwareVersion: "2.0.0"},
+		{Id: "version", SoftwareVersion: "2.0.0"},
+		{Id: "country", ProbeCC: "IT"},
+		{Id: "any"},
+		{Id: "country2", ProbeCC: "IR"},
+	}
+	sortBySpecificity(overrides)
+	expected := []string{"any", "country", "country2", "version", "both"}
+	for i, o := range overrides {
+		if o.Id != expected[i] {
+			t.Errorf("expected %s at %d (got: %s)", expected[i], i, o.Id)
+		}
+	}
+}
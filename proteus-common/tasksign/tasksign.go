@@ -0,0 +1,125 @@
+// Package tasksign signs the tasks given to the probes with Ed25519, so that
+// they can tell the tasks really come from the orchestrator even when a
+// middlebox intercepts TLS. The public keys reach the probes in their
+// settings, more than one while the key is being rotated.
+package tasksign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+var ErrInvalidSignature = errors.New("invalid task signature")
+
+// Signature carries the signed document as it was serialised, since the
+// probes couldn't serialise it back to the same bytes, the signature of it
+// and the id of the key.
+type Signature struct {
+	Payload		string `json:"payload"`
+	Signature	string `json:"signature"`
+	KeyID		string `json:"key_id"`
+}
+
+// KeyID tells the keys apart: the beginning of the hash of the public key
+func KeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Signer signs with the private key of tasks.signing-key
+type Signer struct {
+	key		ed25519.PrivateKey
+	keyID	string
+}
+
+// parseKey takes the base64 of a 32 bytes seed or of a 64 bytes private key
+func parseKey(encoded string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	}
+	return nil, fmt.Errorf("tasks.signing-key is %d bytes long", len(data))
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{
+		key: key,
+		keyID: KeyID(key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// SignerFromConfig returns the Signer of tasks.signing-key, or nil when it
+// isn't set and the tasks aren't signed.
+func SignerFromConfig() (*Signer, error) {
+	encoded := viper.GetString("tasks.signing-key")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := parseKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// Sign serialises the document and signs it
+func (s *Signer) Sign(document interface{}) (*Signature, error) {
+	payload, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Payload: base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+		KeyID: s.keyID,
+	}, nil
+}
+
+// Verify checks the signature with the public key, as the probes do, and
+// returns the signed document.
+func Verify(public ed25519.PublicKey, sig *Signature) ([]byte, error) {
+	payload, err := base64.StdEncoding.DecodeString(sig.Payload)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(public, payload, signature) {
+		return nil, ErrInvalidSignature
+	}
+	return payload, nil
+}
+
+// PublicKeys returns the base64 public keys the probes accept the
+// signatures of: the one of tasks.signing-key, if this instance has it, and
+// the ones of tasks.signing-public-keys, e.g. of the next key.
+func PublicKeys() []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	if encoded := viper.GetString("tasks.signing-key"); encoded != "" {
+		if key, err := parseKey(encoded); err == nil {
+			public := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+			keys = append(keys, public)
+			seen[public] = true
+		}
+	}
+	for _, public := range viper.GetStringSlice("tasks.signing-public-keys") {
+		if !seen[public] {
+			keys = append(keys, public)
+			seen[public] = true
+		}
+	}
+	return keys
+}
@@ -0,0 +1,82 @@
+package tasksign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSignVerify(t *testing.T) {
+	seed := strings.Repeat("s", ed25519.SeedSize)
+	viper.Set("tasks.signing-key", base64.StdEncoding.EncodeToString([]byte(seed)))
+	defer viper.Set("tasks.signing-key", nil)
+	signer, err := SignerFromConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ed25519.NewKeyFromSeed([]byte(seed))
+	public := key.Public().(ed25519.PublicKey)
+
+	sig, err := signer.Sign(map[string]string{"test_name": "web_connectivity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.KeyID != KeyID(public) {
+		t.Errorf("expected the id of the key (got: %s)", sig.KeyID)
+	}
+	payload, err := Verify(public, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != `{"test_name":"web_connectivity"}` {
+		t.Errorf("expected the signed document (got: %s)", payload)
+	}
+
+	tampered := *sig
+	tampered.Payload = base64.StdEncoding.EncodeToString(
+							[]byte(`{"test_name":"dash"}`))
+	if _, err := Verify(public, &tampered); err != ErrInvalidSignature {
+		t.Errorf("expected a tampered payload to be refused (got: %v)", err)
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Verify(other, sig); err != ErrInvalidSignature {
+		t.Errorf("expected another key to be refused (got: %v)", err)
+	}
+
+	// The full private key works too
+	viper.Set("tasks.signing-key", base64.StdEncoding.EncodeToString(key))
+	if other, err := SignerFromConfig(); err != nil || other.keyID != signer.keyID {
+		t.Errorf("expected the private key to be accepted (got: %v)", err)
+	}
+	viper.Set("tasks.signing-key", base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := SignerFromConfig(); err == nil {
+		t.Error("expected a short key to be refused")
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	seed := strings.Repeat("s", ed25519.SeedSize)
+	public := base64.StdEncoding.EncodeToString(
+				ed25519.NewKeyFromSeed([]byte(seed)).Public().(ed25519.PublicKey))
+	viper.Set("tasks.signing-key", base64.StdEncoding.EncodeToString([]byte(seed)))
+	viper.Set("tasks.signing-public-keys", []string{public, "next"})
+	defer viper.Set("tasks.signing-key", nil)
+	defer viper.Set("tasks.signing-public-keys", nil)
+
+	keys := PublicKeys()
+	if len(keys) != 2 || keys[0] != public || keys[1] != "next" {
+		t.Errorf("expected the key and the next one once (got: %v)", keys)
+	}
+
+	viper.Set("tasks.signing-key", nil)
+	viper.Set("tasks.signing-public-keys", nil)
+	if _, err := SignerFromConfig(); err != nil {
+		t.Error(err)
+	}
+	if len(PublicKeys()) != 0 {
+		t.Error("expected no key without configuration")
+	}
+}
@@ -0,0 +1,20 @@
+// Package webhook holds what is shared by the services POSTing events to
+// third party URLs.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SignatureHeader carries the signature of the body of webhook requests
+const SignatureHeader = "X-Proteus-Signature"
+
+// Sign returns the value of the SignatureHeader, so that receivers can check
+// the request comes from us.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
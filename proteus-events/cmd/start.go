@@ -32,4 +32,6 @@ func init() {
 	startCmd.PersistentFlags().StringP("address", "", "127.0.0.1", "Which interface we should listen on")
 	viper.BindPFlag("api.port", startCmd.PersistentFlags().Lookup("port"))
 	viper.BindPFlag("api.address", startCmd.PersistentFlags().Lookup("address"))
+	viper.SetDefault("api.max-poll-wait", 60)
+	viper.SetDefault("api.stream-heartbeat", "30s")
 }
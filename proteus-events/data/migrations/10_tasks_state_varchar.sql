@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE tasks ALTER COLUMN state TYPE TASK_STATE USING state::TASK_STATE;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- The allowed states are now defined by the task-transitions configuration,
+-- so we no longer constrain them in the database.
+-- +migrate StatementBegin
+ALTER TABLE tasks ALTER COLUMN state TYPE VARCHAR USING state::text;
+-- +migrate StatementEnd
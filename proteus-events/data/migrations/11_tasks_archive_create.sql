@@ -0,0 +1,7 @@
+-- +migrate Down
+DROP TABLE IF EXISTS tasks_archive;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS tasks_archive (LIKE tasks INCLUDING ALL);
+-- +migrate StatementEnd
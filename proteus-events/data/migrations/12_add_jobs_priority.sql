@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
+
+-- +migrate Up
+ALTER TABLE jobs ADD COLUMN priority INT NOT NULL DEFAULT 0;
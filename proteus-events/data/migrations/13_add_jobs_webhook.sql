@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS webhook_url;
+ALTER TABLE jobs DROP COLUMN IF EXISTS webhook_secret;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN webhook_url VARCHAR;
+ALTER TABLE jobs ADD COLUMN webhook_secret VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,16 @@
+-- +migrate Down
+DROP TABLE IF EXISTS idempotency_keys;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    probe_id VARCHAR NOT NULL,
+    key VARCHAR NOT NULL,
+    request_path VARCHAR,
+    status_code INT,
+    response BYTEA,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (probe_id, key)
+);
+-- +migrate StatementEnd
@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_sample_rate;
+
+-- +migrate Up
+ALTER TABLE jobs ADD COLUMN target_sample_rate DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_probe_ids;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_exclude_probe_ids;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN target_probe_ids VARCHAR[];
+ALTER TABLE jobs ADD COLUMN target_exclude_probe_ids VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_exclude_countries;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_exclude_platforms;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN target_exclude_countries VARCHAR[];
+ALTER TABLE jobs ADD COLUMN target_exclude_platforms VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_active_within;
+
+-- +migrate Up
+ALTER TABLE jobs ADD COLUMN target_active_within VARCHAR;
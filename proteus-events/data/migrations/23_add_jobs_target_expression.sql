@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_expression;
+
+-- +migrate Up
+ALTER TABLE jobs ADD COLUMN target_expression VARCHAR;
@@ -0,0 +1,19 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS segments;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_segment;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS segments
+(
+    name VARCHAR NOT NULL,
+    version INT NOT NULL,
+    comment VARCHAR,
+    target JSONB,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (name, version)
+);
+ALTER TABLE jobs ADD COLUMN target_segment VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,23 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS measurement_coverage;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_mode;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_coverage_window;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_coverage_cells;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS measurement_coverage
+(
+    probe_cc VARCHAR(2) NOT NULL,
+    probe_asn VARCHAR(30) NOT NULL,
+    test_name VARCHAR NOT NULL,
+    measurement_date DATE NOT NULL,
+    measurement_count INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (probe_cc, probe_asn, test_name, measurement_date)
+);
+ALTER TABLE jobs ADD COLUMN target_mode VARCHAR;
+ALTER TABLE jobs ADD COLUMN target_coverage_window VARCHAR;
+ALTER TABLE jobs ADD COLUMN target_coverage_cells INT NOT NULL DEFAULT 0;
+-- +migrate StatementEnd
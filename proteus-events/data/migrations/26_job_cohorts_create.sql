@@ -0,0 +1,16 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS job_cohorts;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_cohort;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS job_cohorts
+(
+    job_id UUID NOT NULL,
+    probe_id UUID NOT NULL,
+    PRIMARY KEY (job_id, probe_id)
+);
+ALTER TABLE jobs ADD COLUMN target_cohort VARCHAR;
+-- +migrate StatementEnd
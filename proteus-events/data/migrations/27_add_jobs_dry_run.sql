@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS dry_run;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN dry_run BOOLEAN DEFAULT FALSE;
+-- +migrate StatementEnd
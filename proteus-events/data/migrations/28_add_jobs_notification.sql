@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS notification;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN notification VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,29 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS alert_recipients;
+DROP TABLE IF EXISTS alerts;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS alerts
+(
+    id UUID PRIMARY KEY NOT NULL,
+    title VARCHAR NOT NULL,
+    body VARCHAR,
+    link VARCHAR,
+    severity VARCHAR NOT NULL,
+    target JSONB,
+    state VARCHAR NOT NULL,
+    publish_at TIMESTAMP WITH TIME ZONE,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE TABLE IF NOT EXISTS alert_recipients
+(
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    probe_id UUID NOT NULL,
+    ack_time TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (alert_id, probe_id)
+);
+CREATE INDEX IF NOT EXISTS alert_recipients_probe_id_idx ON alert_recipients (probe_id);
+-- +migrate StatementEnd
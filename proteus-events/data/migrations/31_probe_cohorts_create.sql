@@ -0,0 +1,25 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS probe_cohort_members;
+DROP TABLE IF EXISTS probe_cohorts;
+ALTER TABLE jobs DROP COLUMN IF EXISTS target_probe_cohorts;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS probe_cohorts
+(
+    name VARCHAR PRIMARY KEY NOT NULL,
+    comment VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE TABLE IF NOT EXISTS probe_cohort_members
+(
+    cohort_name VARCHAR NOT NULL REFERENCES probe_cohorts (name) ON DELETE CASCADE,
+    probe_id UUID NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (cohort_name, probe_id)
+);
+CREATE INDEX IF NOT EXISTS probe_cohort_members_probe_id_idx ON probe_cohort_members (probe_id);
+ALTER TABLE jobs ADD COLUMN target_probe_cohorts VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS created_by;
+ALTER TABLE jobs DROP COLUMN IF EXISTS shared_with;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN created_by VARCHAR;
+ALTER TABLE jobs ADD COLUMN shared_with VARCHAR[];
+-- +migrate StatementEnd
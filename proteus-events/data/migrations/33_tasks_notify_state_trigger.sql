@@ -0,0 +1,23 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TRIGGER IF EXISTS tasks_notify_state ON tasks;
+DROP FUNCTION IF EXISTS tasks_notify_state();
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION tasks_notify_state() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('proteus_task_state', json_build_object(
+        'task_id', NEW.id,
+        'probe_id', NEW.probe_id,
+        'state', NEW.state)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_notify_state ON tasks;
+CREATE TRIGGER tasks_notify_state AFTER UPDATE OF state ON tasks
+    FOR EACH ROW WHEN (OLD.state IS DISTINCT FROM NEW.state)
+    EXECUTE PROCEDURE tasks_notify_state();
+-- +migrate StatementEnd
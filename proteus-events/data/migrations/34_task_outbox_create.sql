@@ -0,0 +1,17 @@
+-- +migrate Down
+DROP TABLE IF EXISTS task_outbox;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS task_outbox
+(
+    task_id UUID PRIMARY KEY NOT NULL,
+    probe_id UUID NOT NULL,
+    notice JSONB,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_error VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX task_outbox_next_attempt_idx ON task_outbox (next_attempt_at);
+-- +migrate StatementEnd
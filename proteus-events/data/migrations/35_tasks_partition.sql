@@ -0,0 +1,58 @@
+-- +migrate Down
+-- +migrate StatementBegin
+CREATE TABLE tasks_unpartitioned (LIKE tasks INCLUDING DEFAULTS);
+INSERT INTO tasks_unpartitioned SELECT * FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_unpartitioned RENAME TO tasks;
+ALTER TABLE tasks ALTER COLUMN creation_time DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS tasks_job_run_probe_uindex ON tasks (job_id, run_id, probe_id);
+CREATE TRIGGER tasks_notify_insert AFTER INSERT ON tasks
+    FOR EACH ROW EXECUTE PROCEDURE tasks_notify_insert();
+CREATE TRIGGER tasks_notify_state AFTER UPDATE OF state ON tasks
+    FOR EACH ROW WHEN (OLD.state IS DISTINCT FROM NEW.state)
+    EXECUTE PROCEDURE tasks_notify_state();
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- The tasks are partitioned by the month they were created in, the ones
+-- created so far being kept in tasks_legacy. The partitions of the months
+-- to come are created by proteus-events. A unique index would have to
+-- include creation_time, so the tasks of a job run are kept unique by
+-- createTaskChunk instead.
+-- +migrate StatementBegin
+UPDATE tasks SET creation_time = COALESCE(last_updated, now())
+    WHERE creation_time IS NULL;
+DROP TRIGGER IF EXISTS tasks_notify_insert ON tasks;
+DROP TRIGGER IF EXISTS tasks_notify_state ON tasks;
+DROP INDEX IF EXISTS tasks_job_run_probe_uindex;
+ALTER TABLE tasks RENAME TO tasks_legacy;
+ALTER TABLE tasks_legacy ALTER COLUMN creation_time SET NOT NULL;
+
+CREATE TABLE tasks (LIKE tasks_legacy INCLUDING DEFAULTS)
+    PARTITION BY RANGE (creation_time);
+
+DO $$
+DECLARE
+    month TIMESTAMP WITH TIME ZONE :=
+        date_trunc('month', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+BEGIN
+    EXECUTE format('ALTER TABLE tasks ATTACH PARTITION tasks_legacy
+        FOR VALUES FROM (MINVALUE) TO (%L)', month);
+    FOR i IN 0..1 LOOP
+        EXECUTE format('CREATE TABLE tasks_%s PARTITION OF tasks
+            FOR VALUES FROM (%L) TO (%L)',
+            to_char(month AT TIME ZONE 'UTC', 'YYYY_MM'),
+            month, month + interval '1 month');
+        month := month + interval '1 month';
+    END LOOP;
+END$$;
+
+CREATE INDEX IF NOT EXISTS tasks_id_idx ON tasks (id);
+CREATE INDEX IF NOT EXISTS tasks_job_run_probe_idx ON tasks (job_id, run_id, probe_id);
+CREATE INDEX IF NOT EXISTS tasks_probe_creation_idx ON tasks (probe_id, creation_time);
+CREATE TRIGGER tasks_notify_insert AFTER INSERT ON tasks
+    FOR EACH ROW EXECUTE PROCEDURE tasks_notify_insert();
+CREATE TRIGGER tasks_notify_state AFTER UPDATE OF state ON tasks
+    FOR EACH ROW WHEN (OLD.state IS DISTINCT FROM NEW.state)
+    EXECUTE PROCEDURE tasks_notify_state();
+-- +migrate StatementEnd
@@ -0,0 +1,12 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS deleted_at;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- The deleted jobs are kept until they are purged, and can be restored
+-- until then. The ones deleted so far are purged a retention period from now.
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+UPDATE jobs SET deleted_at = now() WHERE state = 'deleted';
+-- +migrate StatementEnd
@@ -0,0 +1,12 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS request_hash;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- The keys are reserved before the request is handled, status_code is NULL
+-- until its response is stored. A key can only be reused for the same
+-- request, the keys stored so far only have their request_path to compare.
+-- +migrate StatementBegin
+ALTER TABLE idempotency_keys ADD COLUMN request_hash VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,13 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE jobs DROP COLUMN IF EXISTS state_before_delete;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- Restoring a deleted job puts it back in the state it was deleted in
+-- +migrate StatementBegin
+ALTER TABLE jobs ADD COLUMN state_before_delete JOB_STATE;
+UPDATE jobs SET state_before_delete = CASE WHEN is_done THEN 'done'::JOB_STATE
+                                           ELSE 'active'::JOB_STATE END
+    WHERE deleted_at IS NOT NULL;
+-- +migrate StatementEnd
@@ -0,0 +1,18 @@
+-- +migrate Down
+DROP TABLE IF EXISTS webhook_deliveries;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id UUID PRIMARY KEY NOT NULL,
+    job_id UUID NOT NULL,
+    task_id UUID NOT NULL,
+    event JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_error VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX webhook_deliveries_next_attempt_idx ON webhook_deliveries (next_attempt_at);
+-- +migrate StatementEnd
@@ -0,0 +1,16 @@
+-- +migrate Down
+DROP TABLE IF EXISTS task_results;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS task_results
+(
+    id UUID PRIMARY KEY NOT NULL,
+    task_id UUID NOT NULL,
+    probe_id UUID,
+    report_id VARCHAR,
+    summary JSONB,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS task_results_task_id_idx ON task_results (task_id);
+-- +migrate StatementEnd
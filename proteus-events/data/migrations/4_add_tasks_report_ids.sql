@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE tasks DROP COLUMN IF EXISTS report_ids;
+ALTER TABLE tasks DROP COLUMN IF EXISTS measurement_uids;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE tasks ADD COLUMN report_ids VARCHAR[];
+ALTER TABLE tasks ADD COLUMN measurement_uids VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,5 @@
+-- +migrate Down
+-- Postgres does not support removing values from an enum
+
+-- +migrate Up notransaction
+ALTER TYPE TASK_STATE ADD VALUE IF NOT EXISTS 'cancelled';
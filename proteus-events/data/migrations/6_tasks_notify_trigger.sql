@@ -0,0 +1,19 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TRIGGER IF EXISTS tasks_notify_insert ON tasks;
+DROP FUNCTION IF EXISTS tasks_notify_insert();
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION tasks_notify_insert() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('proteus_new_task', NEW.probe_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_notify_insert ON tasks;
+CREATE TRIGGER tasks_notify_insert AFTER INSERT ON tasks
+    FOR EACH ROW EXECUTE PROCEDURE tasks_notify_insert();
+-- +migrate StatementEnd
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS tasks_job_run_probe_uindex;
+ALTER TABLE tasks DROP COLUMN IF EXISTS run_id;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE tasks ADD COLUMN run_id INT;
+CREATE UNIQUE INDEX IF NOT EXISTS tasks_job_run_probe_uindex ON tasks (job_id, run_id, probe_id);
+-- +migrate StatementEnd
@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE tasks DROP COLUMN IF EXISTS lease_expires_at;
+
+-- +migrate Up
+ALTER TABLE tasks ADD COLUMN lease_expires_at TIMESTAMP WITH TIME ZONE;
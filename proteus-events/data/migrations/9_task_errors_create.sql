@@ -0,0 +1,19 @@
+-- +migrate Down
+DROP TABLE IF EXISTS task_errors;
+
+-- +migrate Up notransaction
+ALTER TYPE TASK_STATE ADD VALUE IF NOT EXISTS 'failed';
+
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS task_errors
+(
+    id UUID PRIMARY KEY NOT NULL,
+    task_id UUID NOT NULL,
+    probe_id UUID,
+    exception_class VARCHAR,
+    message VARCHAR,
+    app_version VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS task_errors_task_id_idx ON task_errors (task_id);
+-- +migrate StatementEnd
@@ -0,0 +1,198 @@
+-- +migrate Down
+DROP TABLE IF EXISTS alert_recipients;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS probe_cohort_members;
+DROP TABLE IF EXISTS probe_cohorts;
+DROP TABLE IF EXISTS job_cohorts;
+DROP TABLE IF EXISTS measurement_coverage;
+DROP TABLE IF EXISTS segments;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS task_outbox;
+DROP TABLE IF EXISTS task_errors;
+DROP TABLE IF EXISTS task_results;
+DROP TABLE IF EXISTS tasks_archive;
+DROP TABLE IF EXISTS tasks;
+DROP TABLE IF EXISTS jobs;
+
+-- +migrate Up
+-- The tables of the SQLiteStore, those of the PostgresStore as of migration
+-- 38. SQLite has no arrays, the lists are kept as JSON arrays and the target
+-- of a job as a JSON object, like the target of a segment.
+CREATE TABLE IF NOT EXISTS jobs
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    comment VARCHAR,
+    creation_time TIMESTAMP,
+    schedule VARCHAR,
+    delay INTEGER,
+    task_test_name VARCHAR,
+    task_arguments JSON,
+    times_run INTEGER,
+    next_run_at VARCHAR,
+    is_done BOOLEAN,
+    state VARCHAR,
+    state_before_delete VARCHAR,
+    deleted_at TIMESTAMP,
+    priority INTEGER NOT NULL DEFAULT 0,
+    webhook_url VARCHAR,
+    webhook_secret VARCHAR,
+    dry_run BOOLEAN DEFAULT FALSE,
+    notification VARCHAR,
+    notification_window VARCHAR,
+    created_by VARCHAR,
+    shared_with JSON,
+    target JSON
+);
+
+CREATE TABLE IF NOT EXISTS tasks
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    probe_id VARCHAR,
+    job_id VARCHAR,
+    test_name VARCHAR,
+    arguments JSON,
+    state VARCHAR,
+    progress INTEGER,
+    creation_time TIMESTAMP,
+    notification_time TIMESTAMP,
+    accept_time TIMESTAMP,
+    done_time TIMESTAMP,
+    last_updated TIMESTAMP,
+    run_id INTEGER,
+    lease_expires_at TIMESTAMP,
+    report_ids JSON,
+    measurement_uids JSON
+);
+CREATE UNIQUE INDEX IF NOT EXISTS tasks_job_run_probe_uindex ON tasks (job_id, run_id, probe_id);
+CREATE INDEX IF NOT EXISTS tasks_probe_id_idx ON tasks (probe_id);
+
+-- Where the reaper moves the finished tasks when core.archive-tasks is set
+CREATE TABLE IF NOT EXISTS tasks_archive
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    probe_id VARCHAR,
+    job_id VARCHAR,
+    test_name VARCHAR,
+    arguments JSON,
+    state VARCHAR,
+    progress INTEGER,
+    creation_time TIMESTAMP,
+    notification_time TIMESTAMP,
+    accept_time TIMESTAMP,
+    done_time TIMESTAMP,
+    last_updated TIMESTAMP,
+    run_id INTEGER,
+    lease_expires_at TIMESTAMP,
+    report_ids JSON,
+    measurement_uids JSON
+);
+
+CREATE TABLE IF NOT EXISTS task_outbox
+(
+    task_id VARCHAR PRIMARY KEY NOT NULL,
+    probe_id VARCHAR NOT NULL,
+    notice JSON,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_error VARCHAR,
+    creation_time TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_results
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    task_id VARCHAR NOT NULL,
+    probe_id VARCHAR,
+    report_id VARCHAR,
+    summary JSON,
+    creation_time TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS task_results_task_id_idx ON task_results (task_id);
+
+CREATE TABLE IF NOT EXISTS task_errors
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    task_id VARCHAR NOT NULL,
+    probe_id VARCHAR,
+    exception_class VARCHAR,
+    message VARCHAR,
+    app_version VARCHAR,
+    creation_time TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS task_errors_task_id_idx ON task_errors (task_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    probe_id VARCHAR NOT NULL,
+    key VARCHAR NOT NULL,
+    request_path VARCHAR,
+    request_hash VARCHAR,
+    status_code INTEGER,
+    response BLOB,
+    creation_time TIMESTAMP,
+    PRIMARY KEY (probe_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS segments
+(
+    name VARCHAR NOT NULL,
+    version INTEGER NOT NULL,
+    comment VARCHAR,
+    target JSON,
+    creation_time TIMESTAMP,
+    PRIMARY KEY (name, version)
+);
+
+CREATE TABLE IF NOT EXISTS measurement_coverage
+(
+    probe_cc VARCHAR(2) NOT NULL,
+    probe_asn VARCHAR(30) NOT NULL,
+    test_name VARCHAR NOT NULL,
+    -- YYYY-MM-DD
+    measurement_date VARCHAR NOT NULL,
+    measurement_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (probe_cc, probe_asn, test_name, measurement_date)
+);
+
+CREATE TABLE IF NOT EXISTS job_cohorts
+(
+    job_id VARCHAR NOT NULL,
+    probe_id VARCHAR NOT NULL,
+    PRIMARY KEY (job_id, probe_id)
+);
+
+CREATE TABLE IF NOT EXISTS probe_cohorts
+(
+    name VARCHAR PRIMARY KEY NOT NULL,
+    comment VARCHAR,
+    creation_time TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS probe_cohort_members
+(
+    cohort_name VARCHAR NOT NULL REFERENCES probe_cohorts (name) ON DELETE CASCADE,
+    probe_id VARCHAR NOT NULL,
+    added_at TIMESTAMP,
+    PRIMARY KEY (cohort_name, probe_id)
+);
+CREATE INDEX IF NOT EXISTS probe_cohort_members_probe_id_idx ON probe_cohort_members (probe_id);
+
+CREATE TABLE IF NOT EXISTS alerts
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    title VARCHAR NOT NULL,
+    body VARCHAR,
+    link VARCHAR,
+    severity VARCHAR NOT NULL,
+    target JSON,
+    state VARCHAR NOT NULL,
+    publish_at TIMESTAMP,
+    creation_time TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS alert_recipients
+(
+    alert_id VARCHAR NOT NULL REFERENCES alerts (id) ON DELETE CASCADE,
+    probe_id VARCHAR NOT NULL,
+    ack_time TIMESTAMP,
+    PRIMARY KEY (alert_id, probe_id)
+);
+CREATE INDEX IF NOT EXISTS alert_recipients_probe_id_idx ON alert_recipients (probe_id);
@@ -0,0 +1,188 @@
+-- +migrate Down
+DROP TABLE IF EXISTS anomalies;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS settings_overrides;
+DROP TABLE IF EXISTS probe_blocklist;
+DROP TABLE IF EXISTS token_history;
+DROP TABLE IF EXISTS probe_updates;
+DROP TABLE IF EXISTS active_probes;
+
+-- +migrate Up
+-- The tables of proteus-registry as of its migration 25, for the probes to
+-- register with and log in to the SQLite database. The arrays are kept as
+-- Postgres array literals, the way lib/pq writes and reads them.
+CREATE TABLE IF NOT EXISTS active_probes
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    creation_time TIMESTAMP,
+    probe_cc VARCHAR(2),
+    probe_asn VARCHAR(30),
+    platform VARCHAR,
+    software_name VARCHAR(100),
+    software_version VARCHAR,
+    supported_tests VARCHAR,
+    network_type VARCHAR,
+    available_bandwidth VARCHAR,
+    token VARCHAR,
+    probe_family VARCHAR,
+    probe_id VARCHAR,
+    last_updated TIMESTAMP,
+    locale VARCHAR,
+    tags VARCHAR NOT NULL DEFAULT '{}',
+    region VARCHAR,
+    city VARCHAR,
+    callback_url VARCHAR,
+    callback_secret VARCHAR,
+    timezone VARCHAR,
+    quiet_hours VARCHAR,
+    notify_wifi_only BOOLEAN DEFAULT FALSE,
+    notify_max_per_day INTEGER DEFAULT 0,
+    notify_categories VARCHAR,
+    token_invalid_since TIMESTAMP,
+    token_invalid_reason VARCHAR,
+    webpush_endpoint VARCHAR,
+    webpush_p256dh VARCHAR,
+    webpush_auth VARCHAR,
+    last_seen TIMESTAMP,
+    deactivated_at TIMESTAMP,
+    deletion_requested_at TIMESTAMP,
+    attestation_level VARCHAR,
+    request_secret VARCHAR
+);
+CREATE INDEX IF NOT EXISTS active_probes_last_seen_idx ON active_probes (last_seen);
+CREATE INDEX IF NOT EXISTS active_probes_token_idx ON active_probes (token);
+
+CREATE TABLE IF NOT EXISTS probe_updates
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    update_time TIMESTAMP,
+    probe_cc VARCHAR(2),
+    probe_asn VARCHAR(30),
+    platform VARCHAR,
+    software_name VARCHAR(100),
+    software_version VARCHAR,
+    supported_tests VARCHAR,
+    network_type VARCHAR,
+    available_bandwidth VARCHAR,
+    token VARCHAR,
+    probe_family VARCHAR,
+    probe_id VARCHAR,
+    update_type VARCHAR,
+    client_id VARCHAR,
+    locale VARCHAR,
+    region VARCHAR,
+    city VARCHAR,
+    changed_fields VARCHAR
+);
+CREATE INDEX IF NOT EXISTS probe_updates_client_id_idx ON probe_updates (client_id);
+
+CREATE TABLE IF NOT EXISTS token_history
+(
+    token VARCHAR PRIMARY KEY NOT NULL,
+    probe_id VARCHAR NOT NULL,
+    replaced_by VARCHAR,
+    retired_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS token_history_probe_id_idx ON token_history (probe_id);
+
+CREATE TABLE IF NOT EXISTS probe_blocklist
+(
+    kind VARCHAR NOT NULL,
+    value VARCHAR NOT NULL,
+    reason VARCHAR,
+    creation_time TIMESTAMP,
+    PRIMARY KEY (kind, value)
+);
+
+CREATE TABLE IF NOT EXISTS settings_overrides
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    probe_cc VARCHAR(2),
+    software_version VARCHAR,
+    settings JSON NOT NULL,
+    comment VARCHAR,
+    creation_time TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS accounts
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR,
+    password_hash VARCHAR,
+    salt VARCHAR,
+    last_access TIMESTAMP,
+    role VARCHAR,
+    totp_secret VARCHAR,
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_counter INTEGER NOT NULL DEFAULT 0,
+    recovery_codes VARCHAR
+);
+CREATE INDEX IF NOT EXISTS accounts_username_idx ON accounts (username);
+
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    name VARCHAR NOT NULL,
+    key_prefix VARCHAR NOT NULL,
+    key_hash VARCHAR NOT NULL,
+    scopes VARCHAR NOT NULL,
+    created_by VARCHAR,
+    creation_time TIMESTAMP,
+    last_used TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys (key_hash);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    token_hash VARCHAR NOT NULL,
+    family_id VARCHAR NOT NULL,
+    username VARCHAR NOT NULL,
+    role VARCHAR NOT NULL,
+    creation_time TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_token_hash_idx
+    ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx
+    ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_username_idx
+    ON refresh_tokens (username);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti VARCHAR PRIMARY KEY NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    username VARCHAR NOT NULL,
+    role VARCHAR NOT NULL,
+    user_agent VARCHAR,
+    ip_address VARCHAR,
+    creation_time TIMESTAMP,
+    last_used TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);
+
+CREATE TABLE IF NOT EXISTS anomalies
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    probe_id VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    detail VARCHAR,
+    creation_time TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS anomalies_probe_id_idx ON anomalies (probe_id);
+CREATE INDEX IF NOT EXISTS anomalies_creation_time_idx ON anomalies (creation_time);
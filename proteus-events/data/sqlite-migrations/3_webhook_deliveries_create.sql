@@ -0,0 +1,17 @@
+-- +migrate Down
+DROP TABLE IF EXISTS webhook_deliveries;
+
+-- +migrate Up
+-- The webhook deliveries of the PostgresStore as of migration 39
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id VARCHAR PRIMARY KEY NOT NULL,
+    job_id VARCHAR NOT NULL,
+    task_id VARCHAR NOT NULL,
+    event JSON NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_error VARCHAR,
+    creation_time TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_next_attempt_idx ON webhook_deliveries (next_attempt_at);
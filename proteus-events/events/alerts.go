@@ -0,0 +1,344 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+// Alert is a message shown to the users of the probes matched by Target.
+// Unlike tasks there is nothing to run, probes fetch the alerts addressed to
+// them and acknowledge them once the user has seen them.
+type Alert struct {
+	Id				string `json:"id"`
+	Title			string `json:"title" binding:"required"`
+	Body			string `json:"body"`
+	Link			string `json:"link"`
+	Severity		string `json:"severity"`
+	Target			Target `json:"target"`
+	// When the alert is shown to the users, right away if not set
+	PublishAt		time.Time `json:"publish_at"`
+	State			string `json:"state"`
+	Recipients		int64 `json:"recipients"`
+	Acknowledged	int64 `json:"acknowledged"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+// ProbeAlert is an alert as seen by a probe
+type ProbeAlert struct {
+	Id			string `json:"id"`
+	Title		string `json:"title"`
+	Body		string `json:"body"`
+	Link		string `json:"link"`
+	Severity	string `json:"severity"`
+	PublishAt	time.Time `json:"publish_at"`
+}
+
+// Severity values of an Alert
+const (
+	InfoSeverity		= "info"
+	WarningSeverity		= "warning"
+	CriticalSeverity	= "critical"
+)
+
+// State values of an Alert. Recipients are picked when an alert is
+// published, so a probe registering afterwards doesn't get it.
+const (
+	AlertScheduled	= "scheduled"
+	AlertPublished	= "published"
+	AlertWithdrawn	= "withdrawn"
+)
+
+var ErrAlertNotFound = errors.New("alert not found")
+var ErrInvalidSeverity = errors.New("invalid severity")
+
+// alertSeverity returns the severity of an alert, info when none is given
+func alertSeverity(severity string) (string, error) {
+	switch severity {
+	case "":
+		return InfoSeverity, nil
+	case InfoSeverity, WarningSeverity, CriticalSeverity:
+		return severity, nil
+	}
+	return "", ErrInvalidSeverity
+}
+
+// AddAlert stores the alert and publishes it if it's due
+func AddAlert(cx context.Context, a Alert, db *sqlx.DB) (string, error) {
+	var err error
+	a.Severity, err = alertSeverity(a.Severity)
+	if err != nil {
+		return "", err
+	}
+	if err := a.Target.Validate(cx, db); err != nil {
+		return "", err
+	}
+	targetStr, err := json.Marshal(a.Target)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise alert target")
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if a.PublishAt.IsZero() {
+		a.PublishAt = now
+	}
+	a.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, title, body, link, severity,
+		target, state, publish_at, creation_time
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	_, err = db.ExecContext(cx, query, a.Id, a.Title, a.Body, a.Link, a.Severity,
+					targetStr, AlertScheduled, a.PublishAt, now)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into alerts table")
+		return "", err
+	}
+
+	if !a.PublishAt.After(now) {
+		if err = publishAlert(a.Id, a.Target, db); err != nil {
+			// The publisher tries again on its next round
+			ctx.WithError(err).Warnf("failed to publish alert %s", a.Id)
+		}
+	}
+	return a.Id, nil
+}
+
+// publishAlert picks the probes currently matched by the target of a
+// scheduled alert as its recipients.
+func publishAlert(alertID string, t Target, db *sqlx.DB) error {
+	probes, err := t.FindProbes(context.Background(), 0, "", db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	// Only one instance gets to publish the alert
+	query := fmt.Sprintf(`UPDATE %s SET state = $2
+		WHERE id = $1 AND state = $3`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	res, err := tx.Exec(query, alertID, AlertPublished, AlertScheduled)
+	if err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to update alert state")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil || count == 0 {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(
+		viper.GetString("database.alert-recipients-table"), "alert_id", "probe_id"))
+	if err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to prepare recipients copy")
+		return err
+	}
+	for _, p := range probes {
+		if _, err = stmt.Exec(alertID, p.Id); err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to copy alert recipient")
+			return err
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to copy alert recipients")
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit alert")
+		return err
+	}
+	ctx.Infof("published alert %s to %d probes", alertID, len(probes))
+	return nil
+}
+
+// PublishDueAlerts publishes the scheduled alerts whose time has come
+func PublishDueAlerts(cx context.Context, db *sqlx.DB) (int, error) {
+	query := fmt.Sprintf(`SELECT id, target FROM %s
+		WHERE state = $1 AND publish_at <= $2`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	rows, err := db.QueryContext(cx, query, AlertScheduled, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to list due alerts")
+		return 0, err
+	}
+	type dueAlert struct {
+		id		string
+		target	Target
+	}
+	var due []dueAlert
+	for rows.Next() {
+		var (
+			a dueAlert
+			target types.JSONText
+		)
+		if err = rows.Scan(&a.id, &target); err != nil {
+			rows.Close()
+			ctx.WithError(err).Error("failed to iterate over due alerts")
+			return 0, err
+		}
+		if err = target.Unmarshal(&a.target); err != nil {
+			ctx.WithError(err).Errorf("invalid target of alert %s", a.id)
+			continue
+		}
+		due = append(due, a)
+	}
+	rows.Close()
+
+	published := 0
+	for _, a := range due {
+		if err = publishAlert(a.id, a.target, db); err != nil {
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+func RunAlertPublisher(alerts AlertStore, interval time.Duration) {
+	for range time.Tick(interval) {
+		alerts.PublishDueAlerts(context.Background())
+	}
+}
+
+// GetAlertsForProbe returns the published alerts the probe hasn't
+// acknowledged yet, the most severe first.
+func GetAlertsForProbe(cx context.Context, probeID string,
+						db *sqlx.DB) ([]ProbeAlert, error) {
+	var alerts = make([]ProbeAlert, 0)
+	query := fmt.Sprintf(`SELECT
+		a.id, a.title, COALESCE(a.body, ''), COALESCE(a.link, ''),
+		a.severity, a.publish_at
+		FROM %s AS r
+		JOIN %s AS a ON a.id = r.alert_id
+		WHERE r.probe_id = $1 AND r.ack_time IS NULL AND a.state = $2
+		ORDER BY CASE a.severity
+			WHEN $3 THEN 0 WHEN $4 THEN 1 ELSE 2 END,
+			a.publish_at DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	rows, err := db.QueryContext(cx, query, probeID, AlertPublished,
+									CriticalSeverity, WarningSeverity)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get alerts")
+		return alerts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a ProbeAlert
+		err = rows.Scan(&a.Id, &a.Title, &a.Body, &a.Link,
+						&a.Severity, &a.PublishAt)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over alerts")
+			return alerts, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// AckAlert records that the alert was shown to the user of the probe.
+// Acknowledging an alert again keeps the time of the first ack.
+func AckAlert(cx context.Context, alertID string, probeID string,
+				db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s
+		SET ack_time = COALESCE(ack_time, $3)
+		WHERE alert_id = $1 AND probe_id = $2`,
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")))
+	res, err := db.ExecContext(cx, query, alertID, probeID, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to ack alert")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// ListAlerts returns all the alerts, the most recent first, with how many
+// probes received and acknowledged them.
+func ListAlerts(cx context.Context, db *sqlx.DB) ([]Alert, error) {
+	var alerts = make([]Alert, 0)
+	query := fmt.Sprintf(`SELECT
+		a.id, a.title, COALESCE(a.body, ''), COALESCE(a.link, ''),
+		a.severity, a.target, a.state, a.publish_at, a.creation_time,
+		COUNT(r.probe_id), COUNT(r.ack_time)
+		FROM %s AS a
+		LEFT JOIN %s AS r ON r.alert_id = a.id
+		GROUP BY a.id
+		ORDER BY a.creation_time DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")))
+	rows, err := db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list alerts")
+		return alerts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			a Alert
+			target types.JSONText
+		)
+		err = rows.Scan(&a.Id, &a.Title, &a.Body, &a.Link,
+						&a.Severity, &target, &a.State, &a.PublishAt,
+						&a.CreationTime, &a.Recipients, &a.Acknowledged)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over alerts")
+			return alerts, err
+		}
+		if err = target.Unmarshal(&a.Target); err != nil {
+			return alerts, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// WithdrawAlert stops showing the alert to the probes that haven't
+// acknowledged it yet, or cancels it if it's still scheduled.
+func WithdrawAlert(cx context.Context, alertID string, db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s SET state = $2
+		WHERE id = $1 AND state != $2`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	res, err := db.ExecContext(cx, query, alertID, AlertWithdrawn)
+	if err != nil {
+		ctx.WithError(err).Error("failed to withdraw alert")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
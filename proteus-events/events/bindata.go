@@ -1,8 +1,56 @@
 // Code generated by go-bindata.
 // sources:
+// proteus-events/data/migrations/10_tasks_state_varchar.sql
+// proteus-events/data/migrations/11_tasks_archive_create.sql
+// proteus-events/data/migrations/12_add_jobs_priority.sql
+// proteus-events/data/migrations/13_add_jobs_webhook.sql
+// proteus-events/data/migrations/14_idempotency_keys_create.sql
+// proteus-events/data/migrations/15_add_jobs_target_version.sql
+// proteus-events/data/migrations/16_add_jobs_target_languages.sql
+// proteus-events/data/migrations/17_add_jobs_target_sample_rate.sql
+// proteus-events/data/migrations/18_add_jobs_target_probe_ids.sql
+// proteus-events/data/migrations/19_add_jobs_target_tags.sql
 // proteus-events/data/migrations/1_jobs_create.sql
 // proteus-events/data/migrations/1_tasks_create.sql
+// proteus-events/data/migrations/20_add_jobs_target_exclusions.sql
+// proteus-events/data/migrations/21_add_jobs_target_active_within.sql
+// proteus-events/data/migrations/22_add_jobs_target_regions.sql
+// proteus-events/data/migrations/23_add_jobs_target_expression.sql
+// proteus-events/data/migrations/24_segments_create.sql
+// proteus-events/data/migrations/25_measurement_coverage_create.sql
+// proteus-events/data/migrations/26_job_cohorts_create.sql
+// proteus-events/data/migrations/27_add_jobs_dry_run.sql
+// proteus-events/data/migrations/28_add_jobs_notification.sql
+// proteus-events/data/migrations/29_alerts_create.sql
 // proteus-events/data/migrations/2_add_jobs_state.sql
+// proteus-events/data/migrations/30_add_jobs_notification_window.sql
+// proteus-events/data/migrations/31_probe_cohorts_create.sql
+// proteus-events/data/migrations/32_add_jobs_owner.sql
+// proteus-events/data/migrations/33_tasks_notify_state_trigger.sql
+// proteus-events/data/migrations/34_task_outbox_create.sql
+// proteus-events/data/migrations/35_tasks_partition.sql
+// proteus-events/data/migrations/36_add_jobs_deleted_at.sql
+// proteus-events/data/migrations/37_add_idempotency_request_hash.sql
+// proteus-events/data/migrations/38_add_jobs_state_before_delete.sql
+// proteus-events/data/migrations/39_webhook_deliveries_create.sql
+// proteus-events/data/migrations/3_task_results_create.sql
+// proteus-events/data/migrations/4_add_tasks_report_ids.sql
+// proteus-events/data/migrations/5_add_tasks_cancelled_state.sql
+// proteus-events/data/migrations/6_tasks_notify_trigger.sql
+// proteus-events/data/migrations/7_add_tasks_run_id.sql
+// proteus-events/data/migrations/8_add_tasks_lease.sql
+// proteus-events/data/migrations/9_task_errors_create.sql
+// proteus-events/data/schemas/dash.json
+// proteus-events/data/schemas/facebook_messenger.json
+// proteus-events/data/schemas/http_header_field_manipulation.json
+// proteus-events/data/schemas/http_invalid_request_line.json
+// proteus-events/data/schemas/ndt.json
+// proteus-events/data/schemas/telegram.json
+// proteus-events/data/schemas/web_connectivity.json
+// proteus-events/data/schemas/whatsapp.json
+// proteus-events/data/sqlite-migrations/1_store_create.sql
+// proteus-events/data/sqlite-migrations/2_probes_create.sql
+// proteus-events/data/sqlite-migrations/3_webhook_deliveries_create.sql
 // proteus-events/data/templates/home.tmpl
 // DO NOT EDIT!
 
@@ -71,62 +119,1022 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
+var _dataMigrations10_tasks_state_varcharSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x50\x4d\x4f\xc3\x30\x0c\xbd\xf7\x57\xbc\x3b\x94\x1f\x30\x4e\xd9\x88\x00\x51\x06\x6a\x53\x24\x4e\xc8\x23\x5e\x17\xd1\x3a\x28\x31\x2a\xfc\x7b\x14\x7a\x80\x49\x88\x13\x27\xeb\x7d\xf8\xd9\x7a\x75\x8d\x93\x29\x0c\x89\x94\x71\x11\x67\xa9\x7e\x12\x9d\x92\xf2\xc4\xa2\x6b\x1e\x82\x54\xa6\x71\xb6\x85\x33\xeb\xc6\x42\x29\xbf\x64\x2c\xcc\xe6\xae\xe9\x6f\xb7\xc8\xc5\x0d\xf7\x78\x6f\xe1\x4c\x77\xf3\xd4\x39\xe3\x2c\xfa\xee\x7a\x7b\xb9\x68\xab\xd5\x37\x7f\xfe\xfb\x21\x2b\xbe\x3a\x52\xfa\xd7\x02\xdd\x81\x41\xe3\x18\x67\xf6\x4b\x54\x06\x25\x86\xc4\x19\x9e\xf7\x41\xd8\x63\xf7\x01\x3d\xf0\xd7\x5f\xb5\x26\x92\x1c\x34\x44\xc9\x78\x8e\xb2\x0f\xc3\x5b\xa2\x02\x4f\x4b\x58\x8e\x98\xcb\x2e\xc6\x28\x03\xa7\xe2\xc8\x9a\x28\x48\x09\x98\xb0\x4c\x78\x52\xda\x51\xe6\xb3\xff\x69\xe4\xc1\xb4\x9b\x2b\xd3\x1e\xd7\xa1\xfc\xae\x7f\x14\xf1\x39\x00\x1e\x97\x9b\x35\x9c\x01\x00\x00")
+
+func dataMigrations10_tasks_state_varcharSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations10_tasks_state_varcharSql,
+		"data/migrations/10_tasks_state_varchar.sql",
+	)
+}
+
+func dataMigrations10_tasks_state_varcharSql() (*asset, error) {
+	bytes, err := dataMigrations10_tasks_state_varcharSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/10_tasks_state_varchar.sql", size: 412, mode: os.FileMode(420), modTime: time.Unix(1792044779, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations11_tasks_archive_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\xce\x2e\x8e\x4f\x2c\x4a\xce\xc8\x2c\x4b\xb5\xe6\xe2\x42\xd6\x15\x5a\x80\xc2\x0d\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\x0e\x72\x75\x0c\x71\x45\x18\xe8\xe7\x1f\x82\xd5\x50\x05\x0d\x1f\x4f\x6f\x57\x88\x45\x0a\x9e\x7e\xce\x3e\xa1\x2e\x9e\x7e\xee\x0a\x8e\x3e\x3e\x9a\xd6\xd8\xcd\x77\xcd\x4b\xe1\x02\x0c\x00\x42\x73\x3a\x3a\xbe\x00\x00\x00")
+
+func dataMigrations11_tasks_archive_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations11_tasks_archive_createSql,
+		"data/migrations/11_tasks_archive_create.sql",
+	)
+}
+
+func dataMigrations11_tasks_archive_createSql() (*asset, error) {
+	bytes, err := dataMigrations11_tasks_archive_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/11_tasks_archive_create.sql", size: 190, mode: os.FileMode(420), modTime: time.Unix(1792044811, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations12_add_jobs_prioritySql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\xcc\xb1\x0a\xc2\x30\x10\x06\xe0\x3d\x4f\xf1\xef\x52\x70\xef\x14\xbd\x2b\x04\xce\x8b\xb4\x77\xe0\xaa\x20\x12\x41\x53\x62\x41\x7c\x7b\xa7\x82\xe0\x03\x7c\x5f\xd7\x61\xf3\x28\xb7\x76\x5e\xae\xa0\xfa\x7e\x86\x28\xc6\x23\x2c\xee\x84\x71\xaf\x97\x17\x68\xcc\x47\xec\xb3\xf8\x41\x91\x06\xf0\x29\x4d\x36\x61\x6e\xa5\xb6\xb2\x7c\xfa\x10\x7e\x0b\x9f\xff\x83\x48\xb4\xfa\x55\x21\xa9\x41\xb3\x41\x5d\x04\xc4\x43\x74\x31\x6c\xfb\xf0\x1d\x00\xe2\x68\x17\x31\x8f\x00\x00\x00")
+
+func dataMigrations12_add_jobs_prioritySqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations12_add_jobs_prioritySql,
+		"data/migrations/12_add_jobs_priority.sql",
+	)
+}
+
+func dataMigrations12_add_jobs_prioritySql() (*asset, error) {
+	bytes, err := dataMigrations12_add_jobs_prioritySqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/12_add_jobs_priority.sql", size: 143, mode: os.FileMode(420), modTime: time.Unix(1792044829, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations13_add_jobs_webhookSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4f\x4d\xca\xc8\xcf\xcf\x8e\x2f\x2d\xca\xb1\x26\x55\x4f\x71\x6a\x72\x51\x6a\x89\x35\x76\x57\xb8\xe6\xa5\x70\xa1\xc8\x84\x16\x90\xe4\x5c\x47\x17\x17\x98\xcd\x48\x6e\x54\x08\x73\x0c\x72\xf6\x70\x0c\xb2\x26\x4a\x03\xc4\x81\x08\x3d\x58\xed\x77\xcd\x4b\xe1\x02\x0c\x00\x0b\x80\x22\xa3\x59\x01\x00\x00")
+
+func dataMigrations13_add_jobs_webhookSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations13_add_jobs_webhookSql,
+		"data/migrations/13_add_jobs_webhook.sql",
+	)
+}
+
+func dataMigrations13_add_jobs_webhookSql() (*asset, error) {
+	bytes, err := dataMigrations13_add_jobs_webhookSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/13_add_jobs_webhook.sql", size: 345, mode: os.FileMode(420), modTime: time.Unix(1792044893, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations14_idempotency_keys_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x90\x4d\x6a\xc3\x30\x10\x85\xf7\x3a\xc5\x2c\x13\x9a\x9c\x20\x2b\x39\x51\x89\xa8\xff\x90\x95\xb6\xee\xc6\xa8\xf6\x90\x0a\x63\x49\xb5\x26\x14\xdf\xbe\x60\x63\xda\x42\xb3\x7c\x7a\xdf\xf7\x10\xb3\xdf\xc3\xc3\x60\xaf\xa3\x21\x84\x93\xff\x72\xec\xa4\x8a\x12\x34\x4f\x52\x01\xf2\x11\xc4\xab\xac\x74\x05\xb6\xc3\x21\x78\x42\xd7\x4e\x4d\x8f\x53\x3c\x30\xf6\x5b\xbc\x84\x3f\xb1\x22\x43\x38\xa0\xa3\x04\xaf\xd6\xb1\xa3\x12\x5c\x8b\x9f\xcd\xbc\xd0\xf7\x76\xd9\x86\x01\x00\x84\xd1\xbf\x63\x63\x3b\x78\xe6\xea\x78\xe6\x6a\x56\xf2\x4b\x9a\xee\xe6\xba\xc7\xe9\x4e\x33\xe2\xe7\x0d\x23\x35\xc1\xd0\xc7\x8a\x2c\x4e\x24\x43\xb7\xd8\xb4\xbe\x43\x90\xb9\x5e\xf1\x18\xbc\x8b\x08\x49\xad\x05\x5f\xde\xda\x11\x0d\x59\xef\x1a\xb2\x03\x82\x96\x99\xa8\x34\xcf\x4a\x78\x91\xfa\x3c\x47\x78\x2b\x72\xb1\xb0\xa5\x92\x19\x57\x35\x3c\x89\x1a\x36\xeb\xa7\x77\xd0\xe3\xb4\x65\xdb\xc3\xff\x37\x11\xae\x63\xdf\x03\x00\xb0\x66\x4c\xd8\x75\x01\x00\x00")
+
+func dataMigrations14_idempotency_keys_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations14_idempotency_keys_createSql,
+		"data/migrations/14_idempotency_keys_create.sql",
+	)
+}
+
+func dataMigrations14_idempotency_keys_createSql() (*asset, error) {
+	bytes, err := dataMigrations14_idempotency_keys_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/14_idempotency_keys_create.sql", size: 373, mode: os.FileMode(420), modTime: time.Unix(1792044926, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations15_add_jobs_target_versionSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\x2f\x4b\x2d\x2a\xce\xcc\xcf\xb3\xe6\xe2\x42\x36\x28\xb4\x00\xd3\x18\x47\x17\x17\x98\x29\xa8\x7a\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xac\xb9\x00\x03\x00\xde\x86\xf6\x7e\x8c\x00\x00\x00")
+
+func dataMigrations15_add_jobs_target_versionSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations15_add_jobs_target_versionSql,
+		"data/migrations/15_add_jobs_target_version.sql",
+	)
+}
+
+func dataMigrations15_add_jobs_target_versionSql() (*asset, error) {
+	bytes, err := dataMigrations15_add_jobs_target_versionSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/15_add_jobs_target_version.sql", size: 140, mode: os.FileMode(420), modTime: time.Unix(1792045051, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations16_add_jobs_target_languagesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\xcf\x49\xcc\x4b\x2f\x4d\x4c\x4f\x2d\xb6\xe6\xe2\x42\x36\x2a\xb4\x00\xd3\x20\x47\x17\x17\x98\x39\xe8\xba\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xa2\x63\xad\xb9\x00\x03\x00\x04\x57\x49\x86\x92\x00\x00\x00")
+
+func dataMigrations16_add_jobs_target_languagesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations16_add_jobs_target_languagesSql,
+		"data/migrations/16_add_jobs_target_languages.sql",
+	)
+}
+
+func dataMigrations16_add_jobs_target_languagesSql() (*asset, error) {
+	bytes, err := dataMigrations16_add_jobs_target_languagesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/16_add_jobs_target_languages.sql", size: 146, mode: os.FileMode(420), modTime: time.Unix(1792045087, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations17_add_jobs_target_sample_rateSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\xcd\xb1\x0a\x83\x30\x14\x46\xe1\x3d\x4f\xf1\xef\x45\xe8\xee\x94\x7a\x23\x04\x6e\x13\x31\xb9\xd0\x4d\x52\x08\xd2\x52\xab\x68\xa0\xaf\x5f\x1c\x0a\x05\x1f\xe0\x7c\xa7\xaa\x70\x9a\x1e\xe3\x9a\x4a\x06\xcd\x9f\xb7\xd2\x1c\x4d\x8f\xa8\x2f\x6c\xf0\x9c\xef\x1b\xa8\xf7\x1d\x1a\xcf\x72\x75\xb0\x2d\xcc\xcd\x86\x18\x50\xd2\x3a\xe6\x32\x6c\x69\x5a\x5e\x79\xd8\xf3\x5a\xa9\x7f\x4c\x96\x23\xa5\x89\x7e\xd2\xb1\x07\x79\xd9\xa7\x5d\x6f\x1a\x1b\xac\x77\x70\x3e\xc2\x09\x33\xc8\xb4\x5a\x38\xe2\x5c\xab\xef\x00\x3c\xbc\x82\xf0\xb0\x00\x00\x00")
+
+func dataMigrations17_add_jobs_target_sample_rateSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations17_add_jobs_target_sample_rateSql,
+		"data/migrations/17_add_jobs_target_sample_rate.sql",
+	)
+}
+
+func dataMigrations17_add_jobs_target_sample_rateSql() (*asset, error) {
+	bytes, err := dataMigrations17_add_jobs_target_sample_rateSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/17_add_jobs_target_sample_rate.sql", size: 176, mode: os.FileMode(420), modTime: time.Unix(1792045109, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations18_add_jobs_target_probe_idsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xce\xd1\x0a\x82\x30\x14\xc6\xf1\xfb\x3d\xc5\xb9\x0f\x9f\xc0\xab\xe9\x16\x09\x96\x31\x35\x82\x08\xd1\x76\x90\x45\x6e\x32\x4f\xd4\xe3\x77\x15\xac\xf2\x22\x6f\xcf\xe1\xff\xf1\x8b\x22\x58\x0d\xa6\xf7\x2d\x21\x08\xf7\xb0\x2c\x3c\x94\xd4\x12\x0e\x68\x29\xc1\xde\x58\xc6\xf3\x4a\x2a\xa8\x78\x92\x4b\xb8\xba\x6e\x02\xa1\x8a\x3d\xa4\x45\x5e\x6f\x77\x90\xad\x41\x1e\xb3\xb2\x2a\x81\x5a\xdf\x23\x35\xa3\x77\x1d\x36\x46\x4f\xf1\xc2\x10\x9f\x97\xdb\x5d\x63\x38\x30\x8b\x92\x56\xb3\x8f\x4f\x3d\x2e\xd2\x73\x21\xde\x86\x6f\x32\x1c\xb8\x4a\x37\x5c\x9d\xce\xf1\x3f\xdd\x8f\x38\xec\x67\x49\xd2\x6a\xf6\x1a\x00\x43\xa9\x62\xb6\x7b\x01\x00\x00")
+
+func dataMigrations18_add_jobs_target_probe_idsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations18_add_jobs_target_probe_idsSql,
+		"data/migrations/18_add_jobs_target_probe_ids.sql",
+	)
+}
+
+func dataMigrations18_add_jobs_target_probe_idsSql() (*asset, error) {
+	bytes, err := dataMigrations18_add_jobs_target_probe_idsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/18_add_jobs_target_probe_ids.sql", size: 379, mode: os.FileMode(420), modTime: time.Unix(1792045134, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations19_add_jobs_target_tagsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\x2f\x49\x4c\x2f\xb6\xe6\xe2\x42\x36\x25\xb4\x00\xd3\x0c\x47\x17\x17\x98\x11\x48\x1a\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xa2\x63\xad\xb9\x00\x03\x00\xa6\x3d\xb7\x18\x88\x00\x00\x00")
+
+func dataMigrations19_add_jobs_target_tagsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations19_add_jobs_target_tagsSql,
+		"data/migrations/19_add_jobs_target_tags.sql",
+	)
+}
+
+func dataMigrations19_add_jobs_target_tagsSql() (*asset, error) {
+	bytes, err := dataMigrations19_add_jobs_target_tagsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/19_add_jobs_target_tags.sql", size: 136, mode: os.FileMode(420), modTime: time.Unix(1792045159, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _dataMigrations1_jobs_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6c\xcf\xcf\x4e\x02\x31\x10\x06\xf0\x7b\x9f\x62\x8e\x10\x25\x51\xaf\x9c\x0a\xd4\x50\x5d\x76\xc9\x6e\x57\x45\x63\x9a\xca\x8e\x58\xa5\x2d\x69\x67\xa3\xbe\xbd\x61\xc1\x00\xc6\xe3\xcc\xf7\xeb\x9f\x6f\x30\x80\x33\x67\x57\xd1\x10\xc2\x24\x7c\x7a\x36\x29\x8b\x39\x28\x3e\xca\x04\xc8\x6b\x10\x0f\xb2\x52\x15\xbc\x87\x97\x34\x64\xec\x18\xd7\x1b\x36\x2e\x05\x57\xe2\x80\xf3\x42\x1d\x1f\x60\x3d\x06\x00\x60\x1b\xa8\x6b\x39\x81\x79\x29\x67\xbc\x5c\xc0\xad\x58\x74\x32\xaf\xb3\xec\xbc\x13\xcb\xe0\x1c\x7a\x82\x3b\x5e\x8e\xa7\xbc\xdc\x2f\x23\x1a\xb2\xc1\x6b\xb2\x0e\x41\xc9\x99\xa8\x14\x9f\xcd\xe1\x5e\xaa\x69\x37\xc2\x63\x91\x8b\x9d\x4d\xcb\x37\x6c\xda\x35\x9e\xde\xd0\xe0\xda\x7c\x83\xcc\xd5\x6e\x24\x13\x57\x48\x7a\x19\x5a\x4f\xd1\x62\xfa\xc5\xbd\xab\x3e\x3c\x3d\x9f\x98\xcd\xda\xd0\x6b\x88\xee\x60\x2e\x2f\x8e\x51\xfa\xd0\x84\x89\xb4\x37\xee\xcf\x9b\x5d\x66\xe2\xaa\xdd\x16\x4a\x70\x53\x15\xf9\x68\x9f\x58\x87\x49\xc7\xd6\x1f\x7e\xe4\xf1\x8b\xb6\x1b\x6d\x68\xd7\xe8\xbf\x6e\x36\xe9\x26\x78\x84\x51\x51\x64\x82\xe7\xac\x3f\x64\x3f\x01\x00\x00\xff\xff\xe5\x85\x78\xc4\xb4\x01\x00\x00")
 
-func dataMigrations1_jobs_createSqlBytes() ([]byte, error) {
+func dataMigrations1_jobs_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations1_jobs_createSql,
+		"data/migrations/1_jobs_create.sql",
+	)
+}
+
+func dataMigrations1_jobs_createSql() (*asset, error) {
+	bytes, err := dataMigrations1_jobs_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/1_jobs_create.sql", size: 436, mode: os.FileMode(420), modTime: time.Unix(1495987458, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations1_tasks_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x92\x41\x8f\xd3\x30\x10\x85\xef\xfe\x15\xef\x50\x29\xad\xd8\x3d\x70\x8e\x38\xa4\x8d\x4b\x0d\xad\x53\xc5\x0e\x0b\x5c\x22\x6f\x32\x44\x59\x68\x12\xc5\xb3\x82\xfe\x7b\x14\xa7\x8b\xba\x12\x2b\xf5\xf6\xe6\xf9\xcd\x8c\xe6\x93\xef\xef\xf1\xee\xd4\x36\xa3\x63\x42\xda\xff\xee\x44\x9a\x67\x47\xd8\x64\xbd\x97\x50\x5b\xd0\x9f\xd6\xb3\x07\x3b\xff\xd3\xc7\x42\x5c\xa7\x8b\xe1\x55\x69\xd8\x31\x9d\xa8\xe3\x35\x35\x6d\x27\xd2\x0c\x8b\x85\x00\x80\xb5\xfc\xa8\x74\x50\x6a\x0b\x9d\x59\xc8\xaf\xca\x58\x83\xa5\x91\x7b\xb9\xb1\x78\x8f\x6d\x9e\x1d\x30\x34\x25\x9f\x07\xc2\xc3\x4e\xe6\x12\x7c\x1e\x3a\x77\x22\x7c\x40\x34\xed\x2e\xfd\x34\x3d\x5a\xc1\xee\xe4\x3c\x6b\x93\xcb\xc4\x4a\xd8\x6f\x47\x09\x9b\x98\xcf\xa5\xb1\x53\x9d\x18\x48\x5d\x1c\xb0\x8c\x46\x72\xf5\x39\xba\x43\xd4\xf5\xdc\xfe\x68\xa9\x9e\xb4\xab\x2a\x1a\x78\xd6\x23\x3d\x51\x75\xd1\x75\xdf\x51\xb4\x8a\xc3\x64\xa9\x53\xa8\x6d\x2c\xa4\x4e\x17\x8b\x58\x88\x97\x4d\x2f\x48\xae\x4e\x08\x58\xc4\x32\xb4\xb5\x35\x8a\x42\xa5\xe1\x59\x17\xfb\xfd\x5d\x70\x87\xb1\x7f\xa4\xf2\xf2\x36\x5b\x4f\xfd\xe3\x6b\x83\xc9\x73\x19\xae\xfd\x92\xe4\x9b\x5d\x92\xcf\xb6\x1b\x9b\xe7\x89\xa7\xc7\x27\x93\xe9\xf5\x6c\x06\x0e\x57\x07\xff\xdb\xd2\x8c\xe4\x3d\x94\xb6\xb3\x53\x8d\xe4\xb8\xed\xbb\x92\xdb\x13\xc1\xaa\x83\x34\x36\x39\x1c\xf1\xa0\xec\x2e\x94\xf8\x9e\xe9\x4b\xf7\x0c\xa8\xba\x39\x3f\x43\xbc\x25\x39\x61\xbd\x25\xf7\xcb\x79\x2e\x9f\x87\xda\x31\xd5\x6f\x46\xc5\x2a\xfe\xff\x87\x93\x5d\x2d\xfe\x06\x00\x00\xff\xff\x3a\x61\xc2\x6a\xc7\x02\x00\x00")
+
+func dataMigrations1_tasks_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations1_tasks_createSql,
+		"data/migrations/1_tasks_create.sql",
+	)
+}
+
+func dataMigrations1_tasks_createSql() (*asset, error) {
+	bytes, err := dataMigrations1_tasks_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/1_tasks_create.sql", size: 711, mode: os.FileMode(420), modTime: time.Unix(1495831185, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations20_add_jobs_target_exclusionsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xcf\xc1\xca\x82\x40\x10\xc0\xf1\xfb\x3e\xc5\xdc\x3f\x7c\x02\x4f\xab\xbb\x1f\x09\x96\xb1\x6a\x04\x11\xb2\xe9\x24\x86\xee\xca\xee\x48\x3d\x7e\xa7\xc2\xc0\x0e\x76\x9d\xe1\x3f\xfc\x26\x08\xe0\x6f\xe8\x5a\xa7\x09\x41\xd8\xbb\x61\xf3\x41\x4e\x9a\x70\x40\x43\x11\xb6\x9d\x61\x3c\x2d\xa4\x82\x82\x47\xa9\x84\x9b\xbd\x78\x10\x2a\xdb\x43\x9c\xa5\xe5\x76\x07\xc9\x3f\xc8\x63\x92\x17\x39\x90\x76\x2d\x52\x85\x8f\xba\x9f\x1a\xac\x6a\x3b\x19\x72\x1d\xfa\xf0\xc7\x03\x63\xaf\xe9\x6a\xdd\xe0\xc3\x65\x9c\x34\x0d\xfb\xd8\x94\xe3\xaa\x2f\xb8\x10\x2f\xc3\x37\x3a\x1c\xb8\x8a\x37\x5c\x9d\xce\xe1\x9a\xfe\x2d\x9f\xf7\x8b\x34\x69\x1a\xf6\x1c\x00\x46\xa5\xd9\x78\x8b\x01\x00\x00")
+
+func dataMigrations20_add_jobs_target_exclusionsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations20_add_jobs_target_exclusionsSql,
+		"data/migrations/20_add_jobs_target_exclusions.sql",
+	)
+}
+
+func dataMigrations20_add_jobs_target_exclusionsSql() (*asset, error) {
+	bytes, err := dataMigrations20_add_jobs_target_exclusionsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/20_add_jobs_target_exclusions.sql", size: 395, mode: os.FileMode(420), modTime: time.Unix(1792045184, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations21_add_jobs_target_active_withinSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\x4f\x4c\x2e\xc9\x2c\x4b\x8d\x2f\xcf\x2c\xc9\xc8\xcc\xb3\xe6\xe2\x42\x36\x2e\xb4\x00\xd3\x30\x47\x17\x17\x98\x59\xd8\x4c\x50\x08\x73\x0c\x72\xf6\x70\x0c\xb2\xe6\x02\x0c\x00\xf6\xb6\x0a\xfb\x98\x00\x00\x00")
+
+func dataMigrations21_add_jobs_target_active_withinSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations21_add_jobs_target_active_withinSql,
+		"data/migrations/21_add_jobs_target_active_within.sql",
+	)
+}
+
+func dataMigrations21_add_jobs_target_active_withinSql() (*asset, error) {
+	bytes, err := dataMigrations21_add_jobs_target_active_withinSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/21_add_jobs_target_active_within.sql", size: 152, mode: os.FileMode(420), modTime: time.Unix(1792045261, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations22_add_jobs_target_regionsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\x2f\x4a\x4d\xcf\xcc\xcf\x2b\xb6\xe6\xe2\x42\x36\x28\xb4\x00\xd3\x18\x47\x17\x17\x98\x29\xa8\x7a\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xa2\x63\xad\xb9\x00\x03\x00\xdb\xc8\x52\xf9\x8e\x00\x00\x00")
+
+func dataMigrations22_add_jobs_target_regionsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations22_add_jobs_target_regionsSql,
+		"data/migrations/22_add_jobs_target_regions.sql",
+	)
+}
+
+func dataMigrations22_add_jobs_target_regionsSql() (*asset, error) {
+	bytes, err := dataMigrations22_add_jobs_target_regionsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/22_add_jobs_target_regions.sql", size: 142, mode: os.FileMode(420), modTime: time.Unix(1792045341, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations23_add_jobs_target_expressionSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x2c\x4a\x4f\x2d\x89\x4f\xad\x28\x28\x4a\x2d\x2e\xce\xcc\xcf\xb3\xe6\xe2\x42\x36\x2b\xb4\x00\xd3\x24\x47\x17\x17\x98\x41\x18\xda\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xac\xb9\x00\x03\x00\x15\x75\x3c\x75\x92\x00\x00\x00")
+
+func dataMigrations23_add_jobs_target_expressionSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations23_add_jobs_target_expressionSql,
+		"data/migrations/23_add_jobs_target_expression.sql",
+	)
+}
+
+func dataMigrations23_add_jobs_target_expressionSql() (*asset, error) {
+	bytes, err := dataMigrations23_add_jobs_target_expressionSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/23_add_jobs_target_expression.sql", size: 146, mode: os.FileMode(420), modTime: time.Unix(1792045407, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations24_segments_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\x4d\x4e\xc3\x30\x14\x84\xf7\x3e\xc5\x5b\xb6\xa2\x3d\x41\x57\x4e\x62\x54\x43\x62\x47\xb6\x03\x94\x4d\x65\xe0\x29\x32\x92\x6d\x94\x58\x70\x7d\x94\x3f\xd1\x56\x11\x4b\x7b\xbe\xd1\xcc\x9b\xfd\x1e\xee\xbc\x6b\x3b\x9b\x10\x8a\xf8\x13\xc8\xe5\x87\x4e\x36\xa1\xc7\x90\x32\x6c\x5d\x20\x85\x92\x35\x18\x9a\x95\x0c\xf8\x3d\xb0\x17\xae\x8d\x86\x1e\xdb\x81\xe8\x0f\x84\x96\x86\xa9\x59\xff\x8c\x6f\x3d\x8c\x7c\x2e\xcb\xa6\x12\x17\x86\x64\xbb\x16\xd3\x79\xf6\x1d\xd6\x03\x59\xf8\x20\x57\x4a\xf3\xb5\x0e\x4e\xcd\x72\xc5\xa8\x61\x7f\xdd\x84\x34\xb7\xfd\xc8\x86\x00\x00\x04\xeb\x11\x9e\xa8\xca\x8f\x54\x8d\x98\x68\xca\x72\x37\x4a\xdf\xd8\xf5\x2e\x06\xe0\xc2\xdc\x28\xef\xd1\x0f\x59\x8b\x6f\xc2\xa7\x3b\xe0\x41\x4b\x91\xcd\x58\x87\x36\xb9\x18\xce\xc9\x79\x04\xc3\x2b\xa6\x0d\xad\x6a\x78\xe6\xe6\x38\x3e\xe1\x55\x0a\x36\xb1\xb5\xe2\x15\x55\x27\x78\x64\x27\xd8\x0c\xa5\x76\x4b\xfe\x96\x6c\x57\xb6\xa4\x45\xb1\x4c\x79\x3d\xe0\x52\xea\x9f\x21\x7f\x07\x00\x67\x9c\x5f\xf8\xe4\x01\x00\x00")
+
+func dataMigrations24_segments_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations24_segments_createSql,
+		"data/migrations/24_segments_create.sql",
+	)
+}
+
+func dataMigrations24_segments_createSql() (*asset, error) {
+	bytes, err := dataMigrations24_segments_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/24_segments_create.sql", size: 484, mode: os.FileMode(420), modTime: time.Unix(1792045452, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations25_measurement_coverage_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x92\x41\x6f\x82\x30\x1c\xc5\xef\xfd\x14\xff\xa3\x66\x98\x98\xed\xe8\xa9\xda\x9a\x91\x55\x34\xb5\x2c\xf3\x44\x2a\xfc\x43\x5c\xa4\x35\x50\xe7\xd7\x5f\x40\x40\x34\x68\x36\xaf\xf4\xf7\xe8\x7b\x7d\x6f\x34\x82\x97\x6c\x97\xe6\xda\x21\x30\x7b\x32\xa4\xfb\x61\xed\xb4\xc3\x0c\x8d\x9b\x62\xba\x33\x84\xc9\xe5\x0a\x14\x9d\x0a\x0e\xfe\x1c\xf8\x97\xbf\x56\x6b\xc8\x50\x17\xc7\xbc\xa2\xa2\xd8\xfe\x60\xae\x53\x9c\x10\x2a\x14\x97\x35\xfb\x6d\xb7\x05\x54\xda\xd9\x52\x84\x8b\xa0\x23\x76\x3a\x4f\xd1\x45\x99\x4d\xfe\xad\x69\xee\x8a\x4e\x3b\x93\xd8\xd3\xd3\xf2\x18\xf7\xfb\x62\xd2\x1f\x9b\x9b\x84\x5c\x9d\x84\x87\x7e\xf0\xfc\x3e\x33\xc9\xa9\xe2\xb5\x05\x7f\x0e\xc1\x52\x3d\x7a\x25\x32\x20\x00\x00\x87\xdc\x6e\x31\x8a\x63\xf8\xa4\x72\xf6\x4e\xe5\xe0\x75\x58\x29\x83\x50\x08\xaf\x43\xe8\xc2\xb4\xc8\xdb\xf8\x96\x71\x58\xb8\xc8\xe8\x0c\x1b\xe6\xe6\xbc\x6b\x20\x29\xbb\x65\xa5\xd5\xfb\x4c\x6c\x8f\xc6\x81\x1f\xa8\x96\x01\xc6\xe7\x34\x14\x0a\xc6\x67\x7a\x25\xfd\x05\x95\x1b\xf8\xe0\x1b\x18\x34\x21\xbc\x8b\x59\xef\xe2\xc9\xbb\xfa\x75\x79\xfd\x90\x0c\x7b\x1a\xa3\x8c\x35\x85\xd5\x35\x95\xcb\x68\x12\xfd\x49\xd0\xf6\x7a\x9e\xc5\x73\xda\x6a\x13\x77\xc2\x3f\x98\xca\xef\x00\x3e\x06\x84\xc8\x4c\x03\x00\x00")
+
+func dataMigrations25_measurement_coverage_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations25_measurement_coverage_createSql,
+		"data/migrations/25_measurement_coverage_create.sql",
+	)
+}
+
+func dataMigrations25_measurement_coverage_createSql() (*asset, error) {
+	bytes, err := dataMigrations25_measurement_coverage_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/25_measurement_coverage_create.sql", size: 844, mode: os.FileMode(420), modTime: time.Unix(1792045517, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations26_job_cohorts_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x8f\xcd\x6e\x84\x20\x14\x85\xf7\x3c\xc5\x5d\xce\xa4\x33\x4f\xe0\x0a\x85\xa6\xa4\xf8\x13\x84\xa6\xae\x1a\xad\xc4\x6a\x22\x18\x24\xe9\xeb\x37\x41\xdb\x6a\x42\xbb\xe5\x9c\xc3\xfd\xbe\xfb\x1d\x1e\xe6\x71\x70\xad\xd7\x40\xec\xa7\x41\xc7\x87\xda\xb7\x5e\xcf\xda\xf8\x54\x0f\xa3\x41\x44\x94\x15\x48\x9c\x72\x0a\xec\x11\xe8\x2b\xab\x65\x0d\x93\xed\xde\xde\xed\x87\x75\x7e\x4d\x10\xe6\x92\x8a\xbd\x32\xd9\x6e\x85\x30\xc9\x4a\xae\xf2\xe2\xb0\xf1\xad\x1b\xb4\xdf\x67\x49\xfc\x24\x35\x3d\x3a\x25\x6a\x89\x17\x37\xb6\x4c\x50\x2c\xe9\x2f\x5d\x51\xca\x08\x21\xba\x20\x00\x08\xcc\x63\x0f\x4a\x31\x12\x8a\x85\xe2\xfc\x16\x92\xc5\xd9\x4e\xff\x91\x55\x82\xe5\x58\x34\xf0\x4c\x1b\xb8\x6c\x5f\xdc\x7e\x06\x57\x74\x8d\xe8\x63\x42\xbe\xed\x4f\xce\xf0\x82\x45\xf6\x84\xc5\x3f\xee\x5f\x03\x00\xd7\x6d\x11\x9c\x99\x01\x00\x00")
+
+func dataMigrations26_job_cohorts_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations26_job_cohorts_createSql,
+		"data/migrations/26_job_cohorts_create.sql",
+	)
+}
+
+func dataMigrations26_job_cohorts_createSql() (*asset, error) {
+	bytes, err := dataMigrations26_job_cohorts_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/26_job_cohorts_create.sql", size: 409, mode: os.FileMode(420), modTime: time.Unix(1792045552, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations27_add_jobs_dry_runSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xcd\xb1\x0a\xc2\x30\x14\x85\xe1\xbd\x4f\x71\x76\xe9\x13\x38\xdd\x98\x1b\x28\x5c\x1b\x69\x12\x70\x93\x4a\x43\xa9\xd0\x54\x62\x44\x7c\x7b\x17\x05\x05\x11\x5c\xcf\x81\xff\xab\x6b\xac\xe6\x69\xcc\x7d\x89\xd0\xcb\x2d\x55\xef\x83\x2b\x7d\x89\x73\x4c\x45\xc5\x71\x4a\x15\x89\xe7\x0e\x9e\x94\x30\x4e\xcb\xf1\x02\xdd\xd9\x1d\x36\x56\xc2\xb6\x45\x63\xc0\xfb\xc6\x79\x87\x21\xdf\x0f\xf9\x9a\xd6\xdf\x53\x9c\x86\xea\xe3\x09\xe7\xbf\x4c\xd2\xfa\x45\x3e\x21\x28\x6b\x85\xa9\x85\x66\x43\x41\x3c\x0c\x89\xe3\x1f\xfc\x63\x00\xcd\x93\xee\x9c\xf4\x00\x00\x00")
+
+func dataMigrations27_add_jobs_dry_runSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations27_add_jobs_dry_runSql,
+		"data/migrations/27_add_jobs_dry_run.sql",
+	)
+}
+
+func dataMigrations27_add_jobs_dry_runSql() (*asset, error) {
+	bytes, err := dataMigrations27_add_jobs_dry_runSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/27_add_jobs_dry_run.sql", size: 244, mode: os.FileMode(420), modTime: time.Unix(1792046435, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations28_add_jobs_notificationSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\xc8\xcb\x2f\xc9\x4c\xcb\x4c\x4e\x2c\xc9\xcc\xcf\xb3\xc6\x6e\x9e\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x49\x16\x3b\xba\xb8\xc0\xec\x45\xb6\x4d\x21\xcc\x31\xc8\xd9\xc3\x31\x08\x8f\xad\x80\x01\x00\xc5\x2b\xc6\xd6\xf0\x00\x00\x00")
+
+func dataMigrations28_add_jobs_notificationSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations28_add_jobs_notificationSql,
+		"data/migrations/28_add_jobs_notification.sql",
+	)
+}
+
+func dataMigrations28_add_jobs_notificationSql() (*asset, error) {
+	bytes, err := dataMigrations28_add_jobs_notificationSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/28_add_jobs_notification.sql", size: 240, mode: os.FileMode(420), modTime: time.Unix(1792046495, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations29_alerts_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x92\xcd\x72\x82\x40\x10\x84\xef\x3c\xc5\x1c\xb1\xa2\x4f\xe0\x69\x85\xb1\x24\x41\xb0\x96\x25\xd1\x5c\x28\x94\x29\xb3\x25\x02\xb5\x4c\x7e\x7c\xfb\x94\x22\x06\x8d\x3f\x47\xa6\xbf\xed\xed\xe9\x65\x30\x80\xa7\xad\x5e\x9b\x94\x09\xdc\xf2\xbb\xb0\xba\x83\x88\x53\xa6\x2d\x15\x3c\xa2\xb5\x2e\x2c\x57\x86\x33\x50\x62\xe4\x23\x78\x63\xc0\xb9\x17\xa9\x08\xd2\x9c\x0c\x27\x86\x56\xba\xd2\x54\x70\x3d\xbc\x83\xd5\xc3\xeb\xf6\x58\x64\xd6\x99\x12\x57\xd7\xc1\x26\x87\x23\x51\x28\xfc\xbb\x22\x08\xd5\xf9\x35\x96\x6d\x01\x00\xe8\x0c\xe2\xd8\x73\x61\x26\xbd\xa9\x90\x0b\x78\xc1\xc5\x81\x0d\x62\xdf\xef\x1f\x08\xd6\x9c\x13\xbc\x0a\xe9\x4c\x84\xbc\xd0\x96\x65\xb6\x6b\xa5\x86\xce\x75\xb1\x39\x9f\xd4\xf4\x45\x46\xf3\xee\x86\x05\xa7\x66\x4d\x0c\xcf\x51\x18\x8c\x8e\x07\xf6\x9b\xdc\xa0\xab\xcf\x65\xae\xeb\x8f\x24\x65\x50\xde\x14\x23\x25\xa6\x33\x78\xf3\xd4\xe4\xf0\x09\xef\x61\x80\x8d\xc9\xca\x50\xca\xba\x2c\x12\xd6\x5b\xba\xc9\x5a\xbd\xe1\xc3\xa6\x3a\xef\x76\xec\xac\x19\xb7\xcd\xb5\x01\x41\xe2\x18\x25\x06\x0e\xb6\x15\xdb\x3a\xeb\x41\x18\x80\x8b\x3e\x2a\x04\x47\x44\x8e\x70\x8f\xf9\x2a\x53\x2e\xe9\x9f\x47\xa3\xa5\xab\xcd\xfd\xd8\x0d\xd6\x7d\x32\xbb\xcd\xd4\x3f\x39\xf7\x3a\xcb\x79\x81\x8b\xf3\x07\xcb\x25\xed\xc1\x44\x67\x3f\xfb\xd8\x97\x00\xd8\x27\xeb\x3b\xff\xe8\xef\x00\x05\x39\x29\xad\x2d\x03\x00\x00")
+
+func dataMigrations29_alerts_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations29_alerts_createSql,
+		"data/migrations/29_alerts_create.sql",
+	)
+}
+
+func dataMigrations29_alerts_createSql() (*asset, error) {
+	bytes, err := dataMigrations29_alerts_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/29_alerts_create.sql", size: 813, mode: os.FileMode(420), modTime: time.Unix(1792046621, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations2_add_jobs_stateSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\xce\xcf\x0a\x82\x40\x10\x06\xf0\xfb\x3e\xc5\xdc\xb6\x28\x9f\xc0\xd3\xea\x4e\x60\xf8\x0f\x77\x85\x3a\x85\xe5\x20\x46\xae\x91\x4b\xbd\x7e\xb8\x10\x56\x88\xb7\x61\xe6\xe3\x9b\x9f\xe7\xc1\xa6\x6b\x9b\x47\x65\x09\x64\xff\x32\xec\x7b\xa1\x6c\x65\xa9\x23\x63\x03\x6a\x5a\xc3\x64\x91\xe5\xa0\x8f\x39\xc2\x3e\x0b\x4e\x4a\x0b\x8d\x10\xed\x00\x0f\x91\xd2\xca\x67\x22\xd6\x58\x80\x16\x41\x8c\x70\xed\xcf\x03\xb8\x7c\x98\xc5\x65\x92\x4e\x39\x18\xc6\x52\x7f\xfe\x0f\x9a\x9a\xfd\x5c\xca\xfb\x12\x28\x2c\x70\x34\xfc\x91\x84\x02\x4c\xcb\x04\x56\xbc\xba\xd8\xf6\x49\x7c\x0b\xbc\xa6\x1b\x59\xaa\xdd\xd8\x1b\xe2\xeb\x19\xae\x90\xf2\xa3\x75\xc6\xa9\x72\x41\xfb\x0e\x00\x00\xff\xff\x34\x68\x9e\x14\x40\x01\x00\x00")
+
+func dataMigrations2_add_jobs_stateSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations2_add_jobs_stateSql,
+		"data/migrations/2_add_jobs_state.sql",
+	)
+}
+
+func dataMigrations2_add_jobs_stateSql() (*asset, error) {
+	bytes, err := dataMigrations2_add_jobs_stateSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/2_add_jobs_state.sql", size: 320, mode: os.FileMode(420), modTime: time.Unix(1495831185, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations30_add_jobs_notification_windowSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\xc8\xcb\x2f\xc9\x4c\xcb\x4c\x4e\x2c\xc9\xcc\xcf\x8b\x2f\xcf\xcc\x4b\xc9\x2f\xb7\xc6\x6e\xac\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x49\xf6\x3b\xba\xb8\xc0\xac\xc7\x62\xa9\x42\x98\x63\x90\xb3\x87\x63\x10\x1e\xcb\x01\x03\x00\x61\x79\xa3\xf1\xfe\x00\x00\x00")
+
+func dataMigrations30_add_jobs_notification_windowSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations30_add_jobs_notification_windowSql,
+		"data/migrations/30_add_jobs_notification_window.sql",
+	)
+}
+
+func dataMigrations30_add_jobs_notification_windowSql() (*asset, error) {
+	bytes, err := dataMigrations30_add_jobs_notification_windowSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/30_add_jobs_notification_window.sql", size: 254, mode: os.FileMode(420), modTime: time.Unix(1792046869, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations31_probe_cohorts_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x92\x41\x6f\xe2\x30\x10\x85\xef\xf9\x15\x73\x0c\x5a\xf8\x05\x9c\x4c\x3c\x08\x6b\x13\x07\x39\xce\x2e\xec\xaa\x8a\x0c\xb6\xa8\x2b\x39\x46\xc1\x52\xfb\xf3\x2b\x42\x42\x03\x4a\x29\x47\x8f\xde\xf3\x7c\x6f\xf4\x66\x33\xf8\xe5\xec\xa1\x51\xc1\x00\xf5\xef\x75\x34\x1c\x14\x41\x05\xe3\x4c\x1d\x16\xe6\x60\xeb\x88\x8a\x7c\x0d\x92\x2c\x52\x04\xb6\x04\xdc\xb0\x42\x16\x70\x6c\xfc\xce\x54\x7b\xff\xea\x9b\x50\x39\xe3\x76\xa6\x39\xcd\x7f\x96\x9e\xe6\x11\x49\x25\x8a\x4e\xf4\xe6\x77\x27\x68\x4d\x49\x9e\x96\x19\x1f\xb8\x82\x6a\x0e\x26\x54\x77\xe6\x51\x4c\xac\x75\x74\x13\xa0\x3c\x3e\xca\x93\x08\x24\x12\xbf\x30\x79\x2e\x47\x51\xa3\x38\x02\x00\xa8\x95\x33\xf0\x87\x88\x64\x45\x04\xac\x05\xcb\x88\xd8\xc2\x6f\xdc\xb6\x3e\x5e\xa6\xe9\xb4\x95\xed\xbd\x3b\xaf\xe8\x95\xdd\xb0\x31\x2a\x58\x5f\x57\xc1\x3a\x03\x92\x65\x58\x48\x92\xad\xe1\x2f\x93\xab\xf6\x09\xff\x72\x8e\xd1\x64\xfe\x2c\x54\x7f\xea\x8e\xad\x1b\xde\x20\xf6\x58\x20\x70\x89\x02\x79\x82\x77\xb9\x20\x3e\xeb\x27\x90\x73\xa0\x98\xa2\x44\x48\x48\x91\x10\x8a\x17\xe6\x8b\xd6\x6a\x28\x4b\x46\xef\x42\x2a\xad\x8d\xae\x54\xf8\x36\xca\xe5\x8b\xe1\x95\xe2\x01\xe3\xf4\xfa\xf9\x64\x90\x99\x71\x8a\x9b\x27\x32\x77\x5d\xb0\xba\xb2\xfa\xe3\x4c\x3f\x26\x82\xf8\xba\x62\xa4\x6a\x84\xd2\xbe\x69\x63\xfd\xea\x6f\xf8\xff\xe5\x41\xd3\x3e\x07\x00\x27\x8f\x40\xd1\x3b\x03\x00\x00")
+
+func dataMigrations31_probe_cohorts_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations31_probe_cohorts_createSql,
+		"data/migrations/31_probe_cohorts_create.sql",
+	)
+}
+
+func dataMigrations31_probe_cohorts_createSql() (*asset, error) {
+	bytes, err := dataMigrations31_probe_cohorts_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/31_probe_cohorts_create.sql", size: 827, mode: os.FileMode(420), modTime: time.Unix(1792047624, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations32_add_jobs_ownerSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xca\x4f\x2a\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2e\x4a\x4d\x2c\x49\x4d\x89\x4f\xaa\xb4\x26\x56\x4b\x71\x46\x62\x51\x6a\x4a\x7c\x79\x66\x49\x86\x35\x76\x17\xb8\xe6\xa5\x70\xa1\xc8\x84\x16\x90\xe4\x54\x47\x17\x17\x98\xb5\x08\xf7\x29\x84\x39\x06\x39\x7b\x38\x06\x59\xe3\x55\x8f\xe4\x38\x98\x86\xe8\x58\x3c\xce\x04\x0c\x00\xe3\xc0\xf4\x8f\x53\x01\x00\x00")
+
+func dataMigrations32_add_jobs_ownerSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations32_add_jobs_ownerSql,
+		"data/migrations/32_add_jobs_owner.sql",
+	)
+}
+
+func dataMigrations32_add_jobs_ownerSql() (*asset, error) {
+	bytes, err := dataMigrations32_add_jobs_ownerSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/32_add_jobs_owner.sql", size: 339, mode: os.FileMode(420), modTime: time.Unix(1792050036, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations33_tasks_notify_state_triggerSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x92\xd1\xae\xa2\x30\x10\x86\xef\xfb\x14\x73\x41\x02\x66\xd5\x07\x90\x2b\x84\x01\x9b\x68\x4b\x86\x12\xbd\x23\xba\x74\x09\xae\x02\x0b\x35\xbb\xfb\xf6\x27\x80\x46\x4d\xc8\x49\xce\x49\x7a\xd1\xce\xfc\xdf\xfc\xd3\x69\x17\x0b\xf8\x71\x2d\x8b\xf6\x68\x34\x04\xf5\xdf\x8a\xbd\x06\x12\x73\x34\xfa\xaa\x2b\xb3\xd6\x45\x59\xb1\x80\x64\x0c\x8a\x78\x14\x21\x01\x0f\x01\x0f\x3c\x51\x09\x98\x63\xf7\xbb\xcb\xaa\xda\x94\xbf\xfe\x67\x5d\x8f\x80\x14\x63\xd4\x1d\x99\x30\x15\xbe\xe2\x52\x7c\x0a\x39\x33\x77\xda\x1c\xab\x9c\xbd\x65\xd2\x66\x5a\x38\x76\xe9\x13\x7a\x0a\x41\x12\x10\xc6\x5b\xcf\xc7\xa7\xfd\x94\x29\x10\xaa\x94\x44\x02\xa6\x2d\x8b\x42\xb7\xe0\x25\x60\x59\x6c\x8d\x11\x17\x0c\x00\x20\x46\x0a\x25\xed\xa0\x29\xee\xa4\x63\x37\x6d\x6d\xf4\xad\xcb\xfa\x7a\x63\x1d\x7b\x0e\xe7\xae\xae\xb2\xd3\xad\xbc\xe4\x59\x7d\x3a\xeb\x9f\xc6\x19\xf0\x7e\xd9\x83\xb0\xcc\xed\x39\x08\xdc\x2f\xcb\x7c\xfe\x4c\x35\x6d\x7d\xd2\xcf\xdc\xe3\xf8\xa2\x78\x18\xf4\xe8\xb0\x9f\xad\x56\x46\xff\x33\x33\x77\xd0\x8c\xfd\xf7\xb0\xcb\x50\x04\x2e\xb3\x2c\xd8\x7a\x22\x4a\xbd\x08\xa1\xb9\x34\x45\xf7\xe7\xe2\xb2\x6f\x3d\xde\x7d\x94\x0f\x6a\x42\xeb\x85\x0a\x09\xd2\x38\x18\x46\x1e\xc2\x7b\x85\xa1\xbf\x50\x12\xa0\xe7\x6f\x80\xe4\x1e\xf6\x1b\x14\xe0\xc8\x6d\xb0\x1c\x95\x3c\x81\x80\x27\x8a\x0b\x5f\x41\x48\x72\xf7\x72\xc9\x01\xc6\x03\xfa\xa9\x42\x88\x49\xfa\x18\xa4\x84\x5f\xfd\x38\x1f\x03\x00\x09\x49\xad\xb1\xe0\x02\x00\x00")
+
+func dataMigrations33_tasks_notify_state_triggerSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations33_tasks_notify_state_triggerSql,
+		"data/migrations/33_tasks_notify_state_trigger.sql",
+	)
+}
+
+func dataMigrations33_tasks_notify_state_triggerSql() (*asset, error) {
+	bytes, err := dataMigrations33_tasks_notify_state_triggerSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/33_tasks_notify_state_trigger.sql", size: 736, mode: os.FileMode(420), modTime: time.Unix(1792051555, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations34_task_outbox_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x90\xb1\x4e\xc3\x30\x10\x86\x77\x3f\xc5\x8d\xad\xa0\x12\x7b\x27\xb7\x71\x55\x43\xe2\x44\x8e\x03\x2d\x8b\xe5\x36\x56\x65\x41\xec\xc8\x39\x44\x1e\x1f\x29\x29\x25\x91\xca\x78\x77\xdf\xff\xd9\xfa\x57\x2b\x78\x68\xdc\x25\x1a\xb4\x90\x84\x6f\x4f\x12\x99\x17\xa0\xe8\x26\x65\xc0\x77\xc0\x0e\xbc\x54\x25\xa0\xe9\x3e\x74\xf8\xc2\x53\xe8\xd7\x84\x4c\x33\x55\x3b\x1b\x4b\x34\x68\x1b\xeb\x71\x63\x2f\xce\x93\xad\x64\x54\xb1\x3f\x9d\xc8\xd5\x1d\x25\x59\x10\x00\x18\x1f\x71\x35\x54\x15\x4f\xa0\x90\x3c\xa3\xf2\x08\x2f\xec\x38\xa4\x44\x95\xa6\x8f\x03\xd6\xc6\x70\xb2\x37\x6e\x7e\xf3\x01\xdd\xd9\xc2\x73\x99\x8b\xcd\xb8\x31\x88\xb6\x69\xb1\x03\x2e\xd4\x4d\x04\x09\xdb\xd1\x2a\x55\xf0\x74\x8d\xd9\x1e\xf5\x95\xd4\x06\x41\xf1\x8c\x95\x8a\x66\x05\xbc\x71\xb5\x1f\x46\x78\xcf\x05\x1b\xe9\x4f\xd3\xa1\xb6\x31\x86\x08\xaf\x54\x6e\xf7\x54\x8e\xfb\x73\xb4\x06\x5d\xf0\x1a\x5d\x63\xff\x75\x90\xe5\xfa\xb7\x16\x2e\x12\x76\x98\x16\xa1\x67\x1f\x71\x75\x0f\xb9\x98\xde\x61\x31\x03\x0c\x2e\xd7\xf7\xdb\x67\xbe\x26\x3f\x03\x00\x9a\x19\x53\x9c\xda\x01\x00\x00")
+
+func dataMigrations34_task_outbox_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations34_task_outbox_createSql,
+		"data/migrations/34_task_outbox_create.sql",
+	)
+}
+
+func dataMigrations34_task_outbox_createSql() (*asset, error) {
+	bytes, err := dataMigrations34_task_outbox_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/34_task_outbox_create.sql", size: 474, mode: os.FileMode(420), modTime: time.Unix(1792051676, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations35_tasks_partitionSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x55\x41\x73\xea\x36\x10\xbe\xfb\x57\xec\x21\x6f\x6c\xfa\x08\xd3\x77\x7d\x4c\x0e\x8e\x2d\x88\xa6\x46\xa2\xb6\x5c\x42\x2f\x1e\x83\x95\xa0\x17\x90\xa8\x2d\x27\xe5\xdf\x77\x24\x1b\xb0\xf3\x20\x69\xef\x9d\xc9\x4c\xf0\x6a\x77\xbf\x4f\xbb\xfb\xad\x6e\x6f\xe1\xeb\x4e\x3c\x97\xb9\xe6\x10\xaa\x37\xe9\x74\x0d\x89\xce\x35\xdf\x71\xa9\xef\xf9\xb3\x90\x4e\x10\x23\x9f\x21\x60\xfe\x7d\x84\x40\xe7\xd5\x4b\x95\xd5\x72\x9f\x97\x5a\x68\xa1\x24\x2f\xc0\x8b\xf0\x6f\xed\x09\x60\x12\x44\x69\x88\xc9\x14\x42\x34\xf1\xd3\x88\x25\x83\xb1\x83\x49\x82\x62\x06\x98\x30\x7a\x31\x41\x82\x22\x14\x30\xf8\x05\x26\x31\x9d\x35\x1e\x63\x27\x8c\xe9\xbc\x0b\x3a\x76\xfc\x88\xa1\xf8\x03\x1e\x31\x22\xfe\x0c\x01\xa3\x57\x03\xa0\xb1\x04\x34\x4a\x67\x04\xd6\x25\xcf\x4d\x68\xa6\xc5\x8e\x83\xc5\x23\x94\x01\x49\xa3\x68\x7c\xbc\x75\x4a\xf0\xef\x29\x02\x4c\x42\xf4\x08\x78\x62\x1d\xd0\x23\x4e\x58\xd2\x52\xf8\xa1\x56\x59\x59\xcb\x6c\x5f\xaa\x15\xcf\x6a\x21\x0b\xfe\x37\x50\xd2\xe2\x79\xe6\x58\x14\x43\x30\x2e\xe6\x7f\xe3\x26\x8a\xc1\x09\x81\xc5\x78\x3a\x45\x71\x9b\x4e\x2a\x2d\x9e\x0e\x99\x90\x15\x2f\x35\xf8\x13\x43\xb7\x2d\xdf\x31\xa9\x03\x00\x30\xa1\x31\x20\x3f\x78\x80\x98\x2e\x00\x3d\xa2\x20\x65\x08\xe6\x31\x0d\x50\x98\xc6\xe8\x52\x32\xef\x13\xc8\xca\x74\xbd\x45\x4c\xe7\xa1\xf1\xa3\x13\x68\xac\xd7\xa1\x17\x0f\x88\x80\x47\xa3\x70\xd4\x78\xe2\x04\x42\x9c\x30\x4c\x02\xd6\x74\x93\xa0\x45\x73\x34\xb0\xc1\x9f\x50\xb5\x9e\x86\xe9\xc5\x79\x44\xb2\x70\x7a\x27\xe9\xde\x7c\xb2\x0d\x6f\xcb\x9d\x97\x1c\xba\x13\xb1\x3a\x80\xde\x70\xd8\x29\xa9\x37\xe6\xd7\x01\xde\x78\xc9\x9b\xc6\xf3\x02\x84\x1c\x1a\x2b\x28\xc9\x2b\x93\xe8\x68\xaf\x14\x3c\xe5\x25\xac\xb8\x90\xcf\xf0\xc2\xf7\x1a\x84\x6c\x79\x6e\xf9\x73\xbe\x3e\x8c\x80\x6d\x3a\x48\x15\xa8\xa7\x33\x90\x4d\xa5\x15\xac\xd5\x8e\x43\xde\x81\x5b\x1d\x60\x5f\x2a\xcd\xeb\xea\x96\xbf\x72\xa9\xab\x11\xf8\x50\x4b\xf1\x57\xcd\xa1\x99\x9b\x37\x55\x6f\x0b\xd8\xe4\xaf\x1c\xb4\x32\x69\x84\x5c\x6f\xeb\x82\xf7\x47\x75\x08\x95\xb2\x70\x96\x92\xc1\xce\xe1\x87\x5a\x99\x19\xb3\x78\x96\x71\x9b\x77\x75\x38\x5f\x8c\xe5\xd5\x4b\xb0\xa9\xe5\x0b\x08\x59\x69\x9e\x17\xa3\xcb\x65\x6e\x64\xdf\xce\x40\x83\x91\x20\xf6\x4e\x2e\x77\x10\x50\x3f\x42\x49\x80\xbc\x6d\x5e\xe9\xac\xde\x17\xa6\xa6\x43\x90\xea\xcd\x1b\x34\xcd\x5e\x3c\xa0\x18\xbd\x8b\xc3\x49\x2b\x30\xab\xb7\xe3\x24\xe2\x49\x5f\x55\x7d\x19\x50\xd2\x5f\x0a\x1f\x07\xf5\x47\xb6\x8d\x39\x09\xf8\x53\xf1\x5e\x5a\x1b\xef\x36\x4b\x3b\x05\x17\x3c\xdb\x93\x8f\xf6\x8c\x29\xe5\x79\xcd\x9c\x24\xd9\x41\xeb\xec\xd3\x63\xbe\x0b\x6b\xd5\x56\x78\xee\xc7\x0c\x33\x4c\x09\xdc\x2f\x21\xf6\xc9\x14\x81\xd7\x83\x1b\x8c\x1d\x27\xa4\x70\x73\xe3\x84\x28\x88\xfc\x18\xd9\xb0\x46\x10\x0c\xcf\x50\xc2\xfc\xd9\x1c\x16\x98\x3d\xd8\x4f\xf8\x93\x12\x04\xdf\xef\xac\x97\xf9\x33\x4d\xcd\x74\x59\xcb\xb5\xe7\xda\x28\xb7\xed\x30\xf8\xac\x13\xe1\xa6\x2c\x70\x2f\xd9\xc6\xce\x3d\x9a\x62\xd2\xd3\xfe\x93\x2a\x77\xb9\xf6\xdc\x9f\xeb\xec\x33\x66\x16\xcb\xf9\x56\xdd\x22\x9c\x38\x99\xdd\xf7\x87\x1f\xa5\x28\x69\x56\x8c\x37\xc3\xc4\x7e\x0f\x4c\x87\xbc\x2f\xd1\xc0\x1d\x36\x52\x1c\x8c\x4f\x1b\x4b\x00\x26\xf0\xeb\x68\xf4\x0d\x22\x4a\xe7\xa7\x5c\xef\x39\xfd\xdc\x8e\xec\x4b\xd5\x21\x44\x27\x9d\x4d\x78\x95\xd0\x97\xa8\x43\xa5\xe7\xaa\x55\xb6\xde\xe4\xa5\x67\xe9\x5d\xa8\xd7\x10\xdc\xe5\x72\xb9\xcc\x66\x33\x77\xd0\x8f\xb4\x11\xed\xbd\xe0\x2b\x08\xa9\x79\xf9\x9a\x6f\xc1\xfd\xd6\xd8\xdc\xf6\xb2\xe7\xfe\x7e\xbf\xfb\xc0\xbb\x71\x46\x24\xb4\xf5\x18\x3b\x88\x84\x37\x37\xe7\x79\xbc\xfe\xe0\x89\x22\x13\x45\xf7\x89\xeb\x3e\x66\xd7\xc3\xfa\x52\x13\xc5\x7f\x7b\x24\xaf\xe7\x6d\x7c\x4f\x33\xdf\x4f\x7c\x4c\x34\xec\x6b\xf0\x9c\xf7\xb8\x4a\xfe\x7f\x7c\xff\xd5\xe3\xfb\xcf\x00\x98\x0f\x5f\x73\x37\x0a\x00\x00")
+
+func dataMigrations35_tasks_partitionSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations35_tasks_partitionSql,
+		"data/migrations/35_tasks_partition.sql",
+	)
+}
+
+func dataMigrations35_tasks_partitionSql() (*asset, error) {
+	bytes, err := dataMigrations35_tasks_partitionSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/35_tasks_partition.sql", size: 2615, mode: os.FileMode(420), modTime: time.Unix(1792051839, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations36_add_jobs_deleted_atSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x90\x4f\x4b\xc3\x40\x14\xc4\xef\xf9\x14\x73\xab\xa2\xed\x17\x28\x3d\xa4\x66\xa5\x81\xfe\x09\xc9\x86\x8a\x97\xb2\x75\x5f\xd3\x68\xf3\x36\x6c\x5e\x29\x7e\x7b\x49\x4c\x4b\x04\x11\x3c\xbe\x79\x33\xbf\x81\x19\x8f\xf1\x50\x95\x85\x37\x42\x88\xdc\x85\x83\xa1\x90\x89\x11\xaa\x88\x65\x4e\x45\xc9\x41\xb8\xd4\x2a\x85\x0e\xe7\x4b\x85\x77\xb7\x6f\x10\xa5\x9b\x04\x4f\x9b\x65\xbe\x5a\x23\x7e\x86\x7a\x89\x33\x9d\xc1\xd2\x89\x84\xec\xce\xc8\xf4\x77\x9a\x62\x1b\xfc\xf8\xe4\x75\x7b\xea\x23\x5d\xb3\xdf\x78\xe3\x09\x1f\x54\x0b\xce\x2c\xe5\x09\x72\xa4\xcf\x4e\xab\xcf\xbe\x20\xfb\x08\xc3\x16\x6f\x86\xb1\x27\x78\x6a\xc4\x79\xb2\x2d\xe7\xe6\xe6\x49\xc7\x74\x4c\xcd\x0d\xdc\x38\x1c\x8c\x1f\x60\x60\xe0\x49\x88\xa5\x74\x8c\x9a\x7c\xe9\x2c\x0e\xde\x55\x60\x77\x99\xfc\x6b\x8d\x30\x8a\xae\x63\xf4\x6d\x3b\x23\xd0\xf1\x4a\x65\x3a\x5c\x25\xd8\xc6\x7a\xd1\x9d\x78\xdd\xac\xd5\x34\xc8\x93\x28\xd4\x7d\x36\x53\x7a\x18\x9a\xb5\xed\x77\xf7\xd8\x2e\x54\xaa\xd0\xb4\xc5\x98\x61\xd4\x3b\x46\x7f\xec\xfa\x35\x00\x44\xda\x40\x24\xd0\x01\x00\x00")
+
+func dataMigrations36_add_jobs_deleted_atSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations36_add_jobs_deleted_atSql,
+		"data/migrations/36_add_jobs_deleted_at.sql",
+	)
+}
+
+func dataMigrations36_add_jobs_deleted_atSql() (*asset, error) {
+	bytes, err := dataMigrations36_add_jobs_deleted_atSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/36_add_jobs_deleted_at.sql", size: 464, mode: os.FileMode(420), modTime: time.Unix(1792052501, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations37_add_idempotency_request_hashSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x90\x41\x4e\xc3\x30\x10\x45\xf7\x3d\xc5\xdf\xd3\xf6\x02\xac\xd2\x26\x88\x4a\xa1\x45\x69\x8a\xd8\x45\x6e\x3c\xad\x2d\x1a\x3b\x78\x26\x45\xb9\x3d\xb2\x4b\x24\x90\x10\x0b\x96\xfe\xe3\x79\x7f\xf4\x16\x0b\xdc\x75\xf6\x1c\x94\x10\x72\xff\xe1\x66\xdf\x83\xbd\x28\xa1\x8e\x9c\xac\xe8\x6c\xdd\x2c\x2b\xeb\xa2\x42\x9d\xad\xca\x02\x56\x53\xd7\x7b\x21\xd7\x8e\xcd\x1b\x8d\x8c\xbc\xda\x3d\x63\xbd\x2b\x0f\x4f\x5b\x6c\x1e\x50\xbc\x6e\xf6\xf5\x1e\x81\xde\x07\x62\x69\x8c\x62\x73\xff\x3b\xbb\x70\x7a\xf6\x63\x72\xe8\xe3\xb3\x36\x84\x04\x56\x81\x10\x88\x29\x5c\x49\xe3\x48\x27\x1f\x08\x62\x68\x42\xc3\x32\x8c\x72\xfa\x42\x7a\x0e\x16\x25\x03\x37\xad\xd7\x14\xf3\xed\xa1\x2c\x23\x6b\x70\x62\x2f\xb0\xc2\x11\xd4\x7b\xc7\x69\xca\xe2\x03\xe9\x25\xb2\xd8\x83\x56\x39\x78\x77\x19\x71\x8c\xe8\x81\x49\xe3\xe4\x43\x6a\x62\xd5\x51\xc4\x7c\x35\xce\x53\x98\x6e\xbb\x21\xc0\x1e\x27\x15\x6e\xeb\x46\x5d\xd3\x7d\x36\x4c\xff\x9b\x5e\x89\x81\x78\xb4\xbe\xeb\x55\xa0\xe5\xbf\x1d\x67\x79\x3e\x29\x9e\xd8\x51\x2c\x5e\xb2\x6a\xfd\x98\x55\x7f\x08\xfe\x1c\x00\xf5\xef\xbf\xae\xe7\x01\x00\x00")
+
+func dataMigrations37_add_idempotency_request_hashSqlBytes() ([]byte, error) {
 	return bindataRead(
-		_dataMigrations1_jobs_createSql,
-		"data/migrations/1_jobs_create.sql",
+		_dataMigrations37_add_idempotency_request_hashSql,
+		"data/migrations/37_add_idempotency_request_hash.sql",
 	)
 }
 
-func dataMigrations1_jobs_createSql() (*asset, error) {
-	bytes, err := dataMigrations1_jobs_createSqlBytes()
+func dataMigrations37_add_idempotency_request_hashSql() (*asset, error) {
+	bytes, err := dataMigrations37_add_idempotency_request_hashSqlBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "data/migrations/1_jobs_create.sql", size: 436, mode: os.FileMode(420), modTime: time.Unix(1495987458, 0)}
+	info := bindataFileInfo{name: "data/migrations/37_add_idempotency_request_hash.sql", size: 487, mode: os.FileMode(420), modTime: time.Unix(1792053260, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _dataMigrations1_tasks_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x92\x41\x8f\xd3\x30\x10\x85\xef\xfe\x15\xef\x50\x29\xad\xd8\x3d\x70\x8e\x38\xa4\x8d\x4b\x0d\xad\x53\xc5\x0e\x0b\x5c\x22\x6f\x32\x44\x59\x68\x12\xc5\xb3\x82\xfe\x7b\x14\xa7\x8b\xba\x12\x2b\xf5\xf6\xe6\xf9\xcd\x8c\xe6\x93\xef\xef\xf1\xee\xd4\x36\xa3\x63\x42\xda\xff\xee\x44\x9a\x67\x47\xd8\x64\xbd\x97\x50\x5b\xd0\x9f\xd6\xb3\x07\x3b\xff\xd3\xc7\x42\x5c\xa7\x8b\xe1\x55\x69\xd8\x31\x9d\xa8\xe3\x35\x35\x6d\x27\xd2\x0c\x8b\x85\x00\x80\xb5\xfc\xa8\x74\x50\x6a\x0b\x9d\x59\xc8\xaf\xca\x58\x83\xa5\x91\x7b\xb9\xb1\x78\x8f\x6d\x9e\x1d\x30\x34\x25\x9f\x07\xc2\xc3\x4e\xe6\x12\x7c\x1e\x3a\x77\x22\x7c\x40\x34\xed\x2e\xfd\x34\x3d\x5a\xc1\xee\xe4\x3c\x6b\x93\xcb\xc4\x4a\xd8\x6f\x47\x09\x9b\x98\xcf\xa5\xb1\x53\x9d\x18\x48\x5d\x1c\xb0\x8c\x46\x72\xf5\x39\xba\x43\xd4\xf5\xdc\xfe\x68\xa9\x9e\xb4\xab\x2a\x1a\x78\xd6\x23\x3d\x51\x75\xd1\x75\xdf\x51\xb4\x8a\xc3\x64\xa9\x53\xa8\x6d\x2c\xa4\x4e\x17\x8b\x58\x88\x97\x4d\x2f\x48\xae\x4e\x08\x58\xc4\x32\xb4\xb5\x35\x8a\x42\xa5\xe1\x59\x17\xfb\xfd\x5d\x70\x87\xb1\x7f\xa4\xf2\xf2\x36\x5b\x4f\xfd\xe3\x6b\x83\xc9\x73\x19\xae\xfd\x92\xe4\x9b\x5d\x92\xcf\xb6\x1b\x9b\xe7\x89\xa7\xc7\x27\x93\xe9\xf5\x6c\x06\x0e\x57\x07\xff\xdb\xd2\x8c\xe4\x3d\x94\xb6\xb3\x53\x8d\xe4\xb8\xed\xbb\x92\xdb\x13\xc1\xaa\x83\x34\x36\x39\x1c\xf1\xa0\xec\x2e\x94\xf8\x9e\xe9\x4b\xf7\x0c\xa8\xba\x39\x3f\x43\xbc\x25\x39\x61\xbd\x25\xf7\xcb\x79\x2e\x9f\x87\xda\x31\xd5\x6f\x46\xc5\x2a\xfe\xff\x87\x93\x5d\x2d\xfe\x06\x00\x00\xff\xff\x3a\x61\xc2\x6a\xc7\x02\x00\x00")
+var _dataMigrations38_add_jobs_state_before_deleteSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x90\xc1\x4e\xc3\x30\x10\x44\xef\xf9\x8a\xb9\xf5\x80\xfa\x03\xad\x38\xb8\xf5\xa2\x16\x99\xa4\x8a\x1d\x95\x5b\xe4\x34\x4b\x30\x50\xa7\x8a\x0d\xfd\x7d\x64\x4a\x2b\x2a\x45\x08\x7c\xf2\xae\x77\xde\x7a\x66\x3a\xc5\xcd\xde\x75\x83\x8d\x0c\xd9\x1f\x7d\xf6\xb3\xa1\xa3\x8d\xbc\x67\x1f\x17\xdc\x39\x9f\x09\x65\xa8\x84\x11\x0b\x45\x78\xe9\x9b\x00\x59\x16\x1b\x2c\x0b\x55\x3d\xe4\x58\xdf\x81\x1e\xd7\xda\x68\x84\xa4\xaa\x1b\x7e\xea\x07\xae\x5b\x7e\xe3\xc8\xf3\x71\x2c\xf9\x36\xbb\x7a\xa9\x0e\xa9\x2c\x39\xc4\x7e\x70\xbe\x83\xc5\x49\xdf\xa6\x7d\x38\xbc\xc7\x00\x17\xd1\xd8\xdd\x2b\x9c\x47\x7c\xe6\xd3\xb2\xd4\x3c\xda\x70\x19\x76\xff\xb3\x21\xa4\x3c\xbb\x18\xf9\x3b\xee\x8b\x45\xad\x8d\x30\x34\xcf\xaa\x8d\x14\xe6\x5b\xa5\xc9\x8c\x8e\xdf\x62\x29\x34\x61\xbb\xa2\x1c\x2e\xd4\x6d\xef\x19\x26\x15\x93\x74\x9d\xcc\x66\x17\x5e\x86\xbf\x1f\x52\x9a\x30\xb1\xbb\xe8\x3e\xae\x18\xa0\x5c\x7e\x71\xb6\x2b\x2a\xe9\x9c\x40\x6d\x23\xd6\x1a\x79\x61\x90\x57\x4a\xfd\x12\xff\xe7\x00\x90\x29\x15\xe8\x00\x02\x00\x00")
 
-func dataMigrations1_tasks_createSqlBytes() ([]byte, error) {
+func dataMigrations38_add_jobs_state_before_deleteSqlBytes() ([]byte, error) {
 	return bindataRead(
-		_dataMigrations1_tasks_createSql,
-		"data/migrations/1_tasks_create.sql",
+		_dataMigrations38_add_jobs_state_before_deleteSql,
+		"data/migrations/38_add_jobs_state_before_delete.sql",
 	)
 }
 
-func dataMigrations1_tasks_createSql() (*asset, error) {
-	bytes, err := dataMigrations1_tasks_createSqlBytes()
+func dataMigrations38_add_jobs_state_before_deleteSql() (*asset, error) {
+	bytes, err := dataMigrations38_add_jobs_state_before_deleteSqlBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "data/migrations/1_tasks_create.sql", size: 711, mode: os.FileMode(420), modTime: time.Unix(1495831185, 0)}
+	info := bindataFileInfo{name: "data/migrations/38_add_jobs_state_before_delete.sql", size: 512, mode: os.FileMode(420), modTime: time.Unix(1792053502, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _dataMigrations2_add_jobs_stateSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\xce\xcf\x0a\x82\x40\x10\x06\xf0\xfb\x3e\xc5\xdc\xb6\x28\x9f\xc0\xd3\xea\x4e\x60\xf8\x0f\x77\x85\x3a\x85\xe5\x20\x46\xae\x91\x4b\xbd\x7e\xb8\x10\x56\x88\xb7\x61\xe6\xe3\x9b\x9f\xe7\xc1\xa6\x6b\x9b\x47\x65\x09\x64\xff\x32\xec\x7b\xa1\x6c\x65\xa9\x23\x63\x03\x6a\x5a\xc3\x64\x91\xe5\xa0\x8f\x39\xc2\x3e\x0b\x4e\x4a\x0b\x8d\x10\xed\x00\x0f\x91\xd2\xca\x67\x22\xd6\x58\x80\x16\x41\x8c\x70\xed\xcf\x03\xb8\x7c\x98\xc5\x65\x92\x4e\x39\x18\xc6\x52\x7f\xfe\x0f\x9a\x9a\xfd\x5c\xca\xfb\x12\x28\x2c\x70\x34\xfc\x91\x84\x02\x4c\xcb\x04\x56\xbc\xba\xd8\xf6\x49\x7c\x0b\xbc\xa6\x1b\x59\xaa\xdd\xd8\x1b\xe2\xeb\x19\xae\x90\xf2\xa3\x75\xc6\xa9\x72\x41\xfb\x0e\x00\x00\xff\xff\x34\x68\x9e\x14\x40\x01\x00\x00")
+var _dataMigrations39_webhook_deliveries_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x91\xc1\x4e\x02\x31\x10\x86\xef\x7d\x8a\x39\x42\x94\xc4\x3b\xa7\xc2\x96\x50\x5d\xba\xa4\xdb\x55\xf0\xd2\x14\x77\x82\x15\xb6\x25\xdd\x09\xf0\xf8\x26\x20\x2a\x84\x3d\x4e\xff\x6f\xbe\x4c\xfe\x0e\x06\xf0\xd0\xf8\x75\x72\x84\x90\xc5\x43\x60\x99\x2e\xe6\x60\xf8\x28\x17\x20\x27\x20\x16\xb2\x34\x25\x1c\x70\xf5\x19\xe3\xc6\xd6\xb8\xf5\x7b\x4c\x1e\xdb\x21\x63\xff\x57\xab\xdd\xd5\x58\x92\x23\x6c\x30\xd0\x08\xd7\x3e\xb0\xb1\x16\xdc\x88\x3f\xab\x2a\x4c\xb7\x99\xf5\x18\x00\x80\xaf\xa1\xaa\x64\x06\x73\x2d\x67\x5c\x2f\xe1\x45\x2c\x4f\x7b\xaa\xca\xf3\xc7\x13\xf1\x15\x57\xf6\x42\x5d\x27\xe4\xda\x4d\x47\x84\x7b\x0c\x04\xcf\x65\xa1\x46\x37\x89\x23\xc2\x66\x47\x2d\x48\x65\x7e\x23\xc8\xc4\x84\x57\xb9\x81\xa7\xb3\x39\xe0\x91\xec\x0f\x69\x1d\x81\x91\x33\x51\x1a\x3e\x9b\xc3\x9b\x34\xd3\xd3\x08\xef\x85\x12\x67\x7a\xeb\x5a\xb2\x98\x52\x4c\xf0\xca\xf5\x78\xca\xf5\xf9\xfd\x23\xa1\x23\x1f\x83\x25\xdf\x60\xa7\x83\xf5\x87\x97\xe6\xa4\xca\xc4\xe2\x4e\x57\xf6\xea\x1e\x5f\x1f\xa1\x50\x77\x30\xe8\xdd\xdc\xdd\x1f\xde\xff\x2e\x11\x6a\xf6\x3d\x00\xd8\x3a\xb5\xf5\x12\x02\x00\x00")
 
-func dataMigrations2_add_jobs_stateSqlBytes() ([]byte, error) {
+func dataMigrations39_webhook_deliveries_createSqlBytes() ([]byte, error) {
 	return bindataRead(
-		_dataMigrations2_add_jobs_stateSql,
-		"data/migrations/2_add_jobs_state.sql",
+		_dataMigrations39_webhook_deliveries_createSql,
+		"data/migrations/39_webhook_deliveries_create.sql",
 	)
 }
 
-func dataMigrations2_add_jobs_stateSql() (*asset, error) {
-	bytes, err := dataMigrations2_add_jobs_stateSqlBytes()
+func dataMigrations39_webhook_deliveries_createSql() (*asset, error) {
+	bytes, err := dataMigrations39_webhook_deliveries_createSqlBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "data/migrations/2_add_jobs_state.sql", size: 320, mode: os.FileMode(420), modTime: time.Unix(1495831185, 0)}
+	info := bindataFileInfo{name: "data/migrations/39_webhook_deliveries_create.sql", size: 530, mode: os.FileMode(420), modTime: time.Unix(1792056776, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations3_task_results_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\xd1\x4e\x83\x30\x14\x86\xef\xfb\x14\xff\xe5\x16\xdd\x13\xec\xaa\x8c\x9a\x55\xa1\x90\x52\x74\xf3\x86\x54\x69\x96\x46\x5b\x48\xe9\xa2\xbe\xbd\x11\x46\x94\x64\xf1\xf2\x7c\xdf\xf9\x4f\xfa\x77\xb3\xc1\x8d\xb3\xa7\xa0\xa3\x41\xda\x7d\x78\x92\xca\xa2\x84\xa2\x49\xc6\xc0\xef\xc0\x0e\xbc\x52\x15\xa2\x1e\xde\x9a\x60\x86\xf3\x7b\x1c\xb6\x84\xfc\x0d\xd5\xfd\x62\xac\xa2\x8e\xc6\x19\x1f\x13\x73\xb2\x9e\xec\x24\xa3\x8a\xfd\xde\x13\x85\xba\x76\x93\xac\x08\x00\xd8\x16\x75\xcd\x53\x94\x92\xe7\x54\x1e\xf1\xc0\x8e\x63\x42\xd4\x59\x76\x3b\x6e\x8c\xa1\x79\x6d\xa9\xfa\xd0\xbd\x98\xd9\x4d\x28\x98\xbe\x0b\xf1\x87\x3d\x52\xb9\xdb\x53\x39\xe1\xe1\xec\x9c\x0e\x5f\xb8\xaf\x0a\x91\x4c\xe8\x35\x18\x1d\x6d\xe7\x9b\x68\x9d\x81\xe2\x39\xab\x14\xcd\x4b\x3c\x71\xb5\x1f\x47\x3c\x17\x82\x91\xf5\x76\x6e\xc4\x45\xca\x0e\xff\x34\x6a\x2e\x2f\x6d\x6c\xfb\x89\x42\x2c\x1c\x56\x17\xb9\xde\x5e\xff\x3b\xe6\x5b\xf2\x3d\x00\x7a\x2d\xa0\x51\x99\x01\x00\x00")
+
+func dataMigrations3_task_results_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations3_task_results_createSql,
+		"data/migrations/3_task_results_create.sql",
+	)
+}
+
+func dataMigrations3_task_results_createSql() (*asset, error) {
+	bytes, err := dataMigrations3_task_results_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/3_task_results_create.sql", size: 409, mode: os.FileMode(420), modTime: time.Unix(1792044459, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations4_add_tasks_report_idsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xce\xd1\x0a\x82\x30\x14\xc6\xf1\xfb\x3d\xc5\xb9\x0f\x9f\xc0\xab\xe9\x16\x09\x96\x31\x35\x82\x08\x19\xec\x20\x23\x36\x65\x3b\xd2\xeb\x07\x42\x64\x21\x51\xb7\x1f\xfc\xf9\x7e\x49\x02\x1b\x67\xfb\xa0\x09\x41\x0c\x77\xcf\x96\x43\x4d\x9a\xd0\xa1\xa7\x0c\x7b\xeb\x19\x2f\x1b\xa9\xa0\xe1\x59\x29\x81\x74\xbc\x45\x10\xaa\x3a\x42\x5e\x95\xed\xfe\x00\xc5\x16\xe4\xb9\xa8\x9b\x1a\x02\x8e\x43\xa0\xce\x9a\x98\xfe\xdc\x38\xd4\x71\x0a\xf3\x59\x37\xcd\xe5\x2a\x44\x7a\xc3\xde\x88\xed\xf8\x9f\x98\x0b\xf1\x3c\x7f\x31\xe1\xc4\x55\xbe\xe3\xea\x72\x4d\xbf\x27\x9f\xca\x65\xb8\xca\x90\xde\xb0\xc7\x00\x50\x0f\x73\xc3\x63\x01\x00\x00")
+
+func dataMigrations4_add_tasks_report_idsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations4_add_tasks_report_idsSql,
+		"data/migrations/4_add_tasks_report_ids.sql",
+	)
+}
+
+func dataMigrations4_add_tasks_report_idsSql() (*asset, error) {
+	bytes, err := dataMigrations4_add_tasks_report_idsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/4_add_tasks_report_ids.sql", size: 355, mode: os.FileMode(420), modTime: time.Unix(1792044494, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations5_add_tasks_cancelled_stateSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4c\xcc\x31\x0a\xc2\x30\x14\x06\xe0\x3d\xa7\xf8\xb7\x0e\x92\x13\x38\x05\x1a\xa1\x58\xb4\x98\x54\x74\x92\xd0\x3e\x4b\xa1\x79\xaf\x24\x69\xbd\xbe\xb8\x79\x80\xef\xd3\x1a\x87\x38\x4f\x29\x14\x42\x2d\x1f\x56\x5a\xa3\x93\x5c\xa6\x44\x19\xa3\x50\x06\x4b\x41\xde\xd6\x55\x52\x41\xa2\x28\xfb\xcc\x13\xf6\xb0\x6c\x94\xf1\x4e\x12\x11\x18\xc4\x5b\x54\xea\xff\xea\xd7\x1f\x4c\x81\x73\x18\xca\x2c\xac\x4c\xeb\xed\x0d\xfe\xd9\x59\x78\xe3\xce\x2f\xe7\x8d\xb7\x30\x75\x8d\xbb\x69\x7b\x8b\xe6\x84\xcb\xd5\xc3\x3e\x1a\xe7\x1d\xaa\x21\xf0\x40\xcb\x42\x63\x75\x54\xdf\x01\x00\x05\x99\xbd\x48\xa4\x00\x00\x00")
+
+func dataMigrations5_add_tasks_cancelled_stateSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations5_add_tasks_cancelled_stateSql,
+		"data/migrations/5_add_tasks_cancelled_state.sql",
+	)
+}
+
+func dataMigrations5_add_tasks_cancelled_stateSql() (*asset, error) {
+	bytes, err := dataMigrations5_add_tasks_cancelled_stateSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/5_add_tasks_cancelled_state.sql", size: 164, mode: os.FileMode(420), modTime: time.Unix(1792044537, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations6_tasks_notify_triggerSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x91\x4f\x6f\xa3\x30\x10\xc5\xef\xfe\x14\xef\x80\x94\x44\xbb\xd9\x0f\x10\x4e\x0e\x0c\x2c\x52\xd6\x46\x83\x51\x72\x43\x59\xc5\x45\xa8\x89\xa1\xe0\x2a\xed\xb7\xaf\x12\xd2\x7f\x12\xaa\xd4\x5e\x67\xe6\xf7\xde\xb3\xdf\x72\x89\x5f\xa7\xa6\xee\xf7\xde\x22\x6e\xcf\x4e\x7c\x1c\x14\x7e\xef\xed\xc9\x3a\xbf\xb6\x75\xe3\x44\xcc\x3a\x87\xe1\x2c\x4d\x89\x91\x25\xa0\x5d\x56\x98\x02\x7e\x3f\xdc\x0f\x95\x6b\x7d\x73\xf7\x5c\x35\x6e\xb0\xbd\x87\x56\xe3\x38\x1c\xa1\xa4\x54\x91\xc9\xb4\xfa\x9a\x9a\x2f\xc2\x69\x7b\x72\x07\xf1\x69\x53\x76\xd3\x87\x63\xce\x88\x49\x1a\x82\x66\x30\xe5\x1b\x19\xd1\xbb\xff\xa4\x2b\x98\x4c\xc9\xaa\x80\xef\x9b\xba\xb6\x3d\x64\x81\x20\x10\x6b\x4a\x33\x25\x00\x20\x27\x4e\x34\xff\x43\x57\xdf\xd0\xf9\xac\xeb\x5b\x6f\x1f\x87\xca\xd9\x73\x75\x11\x9d\xfd\x86\xa2\xed\x9f\xae\x6f\xff\xdb\xaa\x39\xac\x56\xde\x3e\xf9\x45\x78\xc5\x47\xf9\xcb\x3e\x14\xa4\xe2\x50\x04\x01\x36\x52\xa5\xa5\x4c\x09\xdd\xb1\xab\x87\x87\x63\x28\x7e\xf6\xbd\xb7\xb7\xbe\x62\x53\xc7\x32\x31\x97\xbe\x54\x41\x6c\xde\xc8\x6b\xb0\x44\x33\x48\x46\x7f\xc1\x7a\x0b\xda\x51\x54\x1a\x42\xce\x3a\xa2\xb8\x64\xfa\x76\x45\x2f\x03\x00\xc3\xd1\xb7\x11\x4c\x02\x00\x00")
+
+func dataMigrations6_tasks_notify_triggerSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations6_tasks_notify_triggerSql,
+		"data/migrations/6_tasks_notify_trigger.sql",
+	)
+}
+
+func dataMigrations6_tasks_notify_triggerSql() (*asset, error) {
+	bytes, err := dataMigrations6_tasks_notify_triggerSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/6_tasks_notify_trigger.sql", size: 588, mode: os.FileMode(420), modTime: time.Unix(1792044641, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations7_add_tasks_run_idSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x8f\xd1\x4a\xc6\x20\x18\x86\xcf\xbd\x8a\xef\xb0\xa8\xff\x0a\x76\xe4\xe6\x17\x08\x4b\x6b\x53\xd8\x99\x6c\x28\xc3\x62\x6e\x6c\x8e\xba\xfc\x30\x8b\x16\x8d\xfe\x23\xc1\xf7\xf1\x7d\x7c\x2f\x17\xb8\x9b\xfc\xb8\xf6\xd1\x01\x9b\xdf\x02\x39\x5e\xb4\xb1\x8f\x6e\x72\x21\x96\x6e\xf4\x81\xb0\x46\x3e\x01\x17\x0c\x3b\xe0\x0f\x80\x1d\x6f\x55\x0b\xb1\xdf\x5e\x37\xf3\x32\x0f\x66\xdd\x83\x59\xd6\x79\x70\x66\xf7\xc1\xba\xf7\x82\xd0\x5a\x61\x03\x8a\x96\x35\x66\x0e\x3e\x2b\x2a\x59\xeb\x47\x71\xe8\x48\x2f\xbd\x2d\xce\xdd\x18\x2c\xf9\x95\xe8\xe5\x1c\xcc\x9f\xfc\xeb\xa4\x8c\x7d\x2b\xb3\x08\xb8\x50\x05\xa9\x1a\xa4\x0a\x41\x0b\xfe\xac\xf1\x67\x96\x90\xea\xfa\x34\x90\xe2\xab\xfc\x26\xc5\xde\xde\x43\x42\xd2\x99\x31\x6f\x6f\xff\x99\xf3\x31\x00\xf6\xc5\x75\x71\x75\x01\x00\x00")
+
+func dataMigrations7_add_tasks_run_idSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations7_add_tasks_run_idSql,
+		"data/migrations/7_add_tasks_run_id.sql",
+	)
+}
+
+func dataMigrations7_add_tasks_run_idSql() (*asset, error) {
+	bytes, err := dataMigrations7_add_tasks_run_idSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/7_add_tasks_run_id.sql", size: 373, mode: os.FileMode(420), modTime: time.Unix(1792044676, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations8_add_tasks_leaseSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x28\x49\x2c\xce\x2e\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\xc8\x49\x4d\x2c\x4e\x8d\x4f\xad\x28\xc8\x2c\x4a\x2d\x8e\x4f\x2c\xb1\xe6\xe2\x42\x36\x2b\xb4\x00\x8b\x49\x8e\x2e\x2e\x30\x83\xd0\xb5\x2b\x84\x78\xfa\xba\x06\x87\x38\xfa\x06\x28\x84\x7b\x86\x78\x80\xb9\x0a\x51\xfe\x7e\xae\xd6\x5c\x80\x01\x00\xd7\xbe\x02\x68\xa3\x00\x00\x00")
+
+func dataMigrations8_add_tasks_leaseSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations8_add_tasks_leaseSql,
+		"data/migrations/8_add_tasks_lease.sql",
+	)
+}
+
+func dataMigrations8_add_tasks_leaseSql() (*asset, error) {
+	bytes, err := dataMigrations8_add_tasks_leaseSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/8_add_tasks_lease.sql", size: 163, mode: os.FileMode(420), modTime: time.Unix(1792044701, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations9_task_errors_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x90\xc1\x6e\xea\x30\x10\x45\xf7\xfe\x8a\xd9\x01\x7a\x8f\x2f\x60\x65\x88\x2b\x2c\x42\x12\x39\x0e\x85\x6e\x22\x37\x99\x22\xab\xc4\x8e\x6c\xab\xe5\xf3\x2b\x0c\xa9\x92\xaa\x5d\x7a\xce\xdc\xa3\xb9\x5e\x2e\xe1\x5f\xa7\xcf\x4e\x05\x84\xc4\x7e\x1a\x92\x88\xbc\x00\x49\xd7\x29\x03\xfe\x04\xec\xc8\x4b\x59\x42\x50\xfe\xbd\x46\xe7\xac\xf3\x2b\x42\xc6\x99\xaa\x07\x63\x83\x53\xc6\xab\x26\x68\x6b\x08\x4d\x25\x13\x20\x4f\x05\x03\x49\xcb\x5d\x5d\x4a\x2a\x19\xd0\x24\x81\x03\x4d\xab\x28\xcd\x72\x39\x88\x67\x6f\x4a\x5f\xb0\x9d\xfd\xb0\x96\x41\x05\xec\xd0\x84\x35\x9e\xb5\x21\x1b\xc1\x6e\x92\xef\xab\x46\x82\xd1\x65\x64\x4e\x00\x00\x74\x0b\x55\xc5\x13\x28\x04\xdf\x53\x71\x82\x1d\x3b\xc5\x40\x56\xa5\xe9\xff\xb8\x11\x33\xc3\xda\x14\xf5\xce\xbe\xe2\xc0\xee\x23\xbc\x36\xd8\xdf\xaa\xd5\xcd\x45\x79\x0f\x07\x2a\x36\x5b\x2a\xee\xb0\x43\xef\xd5\x19\xa7\x43\xd5\xf7\xf5\x07\x3a\xaf\xad\x99\x82\xc6\xa1\x8a\xa6\xa0\x3b\x04\xc9\xf7\xac\x94\x74\x5f\xc0\x33\x97\xdb\xf8\x84\x97\x3c\x63\x64\xb1\x1a\x1a\xf3\x2c\x61\xc7\xbf\x1b\xd7\x8f\x26\xb5\x6e\xaf\x90\x67\x63\x04\xf3\x07\x5b\xac\x7e\xff\x59\x66\x5a\xf2\x35\x00\xd2\xe6\xdb\x48\xfd\x01\x00\x00")
+
+func dataMigrations9_task_errors_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations9_task_errors_createSql,
+		"data/migrations/9_task_errors_create.sql",
+	)
+}
+
+func dataMigrations9_task_errors_createSql() (*asset, error) {
+	bytes, err := dataMigrations9_task_errors_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/9_task_errors_create.sql", size: 509, mode: os.FileMode(420), modTime: time.Unix(1792044725, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasDashJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasDashJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasDashJson,
+		"data/schemas/dash.json",
+	)
+}
+
+func dataSchemasDashJson() (*asset, error) {
+	bytes, err := dataSchemasDashJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/dash.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasFacebook_messengerJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasFacebook_messengerJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasFacebook_messengerJson,
+		"data/schemas/facebook_messenger.json",
+	)
+}
+
+func dataSchemasFacebook_messengerJson() (*asset, error) {
+	bytes, err := dataSchemasFacebook_messengerJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/facebook_messenger.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasHttp_header_field_manipulationJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasHttp_header_field_manipulationJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasHttp_header_field_manipulationJson,
+		"data/schemas/http_header_field_manipulation.json",
+	)
+}
+
+func dataSchemasHttp_header_field_manipulationJson() (*asset, error) {
+	bytes, err := dataSchemasHttp_header_field_manipulationJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/http_header_field_manipulation.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasHttp_invalid_request_lineJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasHttp_invalid_request_lineJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasHttp_invalid_request_lineJson,
+		"data/schemas/http_invalid_request_line.json",
+	)
+}
+
+func dataSchemasHttp_invalid_request_lineJson() (*asset, error) {
+	bytes, err := dataSchemasHttp_invalid_request_lineJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/http_invalid_request_line.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasNdtJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasNdtJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasNdtJson,
+		"data/schemas/ndt.json",
+	)
+}
+
+func dataSchemasNdtJson() (*asset, error) {
+	bytes, err := dataSchemasNdtJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/ndt.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasTelegramJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasTelegramJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasTelegramJson,
+		"data/schemas/telegram.json",
+	)
+}
+
+func dataSchemasTelegramJson() (*asset, error) {
+	bytes, err := dataSchemasTelegramJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/telegram.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasWeb_connectivityJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbc\x90\x41\x0a\x83\x40\x0c\x45\xf7\x73\x8a\x90\xb5\x27\xf0\x14\xbd\x41\x89\x1a\x25\x65\x34\x12\x33\x8b\xa1\xcc\xdd\x8b\x15\xec\xd8\x75\x29\xb3\xfb\xff\xfd\x79\x90\x67\x00\x00\x40\xcf\x2b\x63\x0b\xa8\xdd\x83\x7b\xc7\xe6\x48\x57\xd3\x95\xcd\x85\x37\x6c\xe1\x20\xf7\x87\x53\xd4\x8e\xe2\xbd\x27\xe7\x49\xed\xbb\xbe\x7c\x48\x66\x94\xb1\xb9\x96\xe2\x3c\xbf\x37\x27\xb6\xb9\xc9\x32\x61\x39\xb9\xf2\x99\x60\xaf\x69\x71\xcb\x7f\xf3\x25\x8b\x3f\x33\x34\x80\xa3\xda\x4c\xbe\x67\xc9\xa4\x56\x86\x4a\x8c\x34\x0c\xe2\xa2\x0b\xc5\x5b\x7d\xf5\x91\xe2\xc6\xa1\x84\xd7\x00\x35\xbd\x16\x81\xa8\x01\x00\x00")
+
+func dataSchemasWeb_connectivityJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasWeb_connectivityJson,
+		"data/schemas/web_connectivity.json",
+	)
+}
+
+func dataSchemasWeb_connectivityJson() (*asset, error) {
+	bytes, err := dataSchemasWeb_connectivityJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/web_connectivity.json", size: 424, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSchemasWhatsappJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x46\x00\xb9\xff\x7b\x0a\x20\x20\x20\x20\x22\x74\x79\x70\x65\x22\x3a\x20\x5b\x22\x6f\x62\x6a\x65\x63\x74\x22\x2c\x20\x22\x6e\x75\x6c\x6c\x22\x5d\x2c\x0a\x20\x20\x20\x20\x22\x61\x64\x64\x69\x74\x69\x6f\x6e\x61\x6c\x50\x72\x6f\x70\x65\x72\x74\x69\x65\x73\x22\x3a\x20\x66\x61\x6c\x73\x65\x0a\x7d\x0a\x03\x00\x7f\x29\xda\x6c\x46\x00\x00\x00")
+
+func dataSchemasWhatsappJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSchemasWhatsappJson,
+		"data/schemas/whatsapp.json",
+	)
+}
+
+func dataSchemasWhatsappJson() (*asset, error) {
+	bytes, err := dataSchemasWhatsappJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/schemas/whatsapp.json", size: 70, mode: os.FileMode(420), modTime: time.Unix(1792051901, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSqliteMigrations1_store_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x58\xcf\x73\xea\x36\x10\xbe\xf3\x57\xec\x91\x4c\x21\xf3\xa6\xef\xd2\x99\x9c\x48\x70\x5a\x5a\x02\x79\x40\xda\xc7\x49\x23\x5b\x1b\xac\x60\x5b\xae\x24\x87\xf0\xdf\x77\x64\xcb\xc4\x16\xfe\x41\xd2\xe9\x4c\x0f\xef\xc8\xee\xa7\xf5\xee\xb7\x9f\x77\x65\xc6\x63\xf8\x29\xe6\x3b\x49\x35\xc2\x54\x1c\x92\xc1\x74\xb5\x7c\x84\xcd\xe4\x76\xee\xc1\xec\x1e\xbc\xef\xb3\xf5\x66\x0d\x34\x42\xa9\x89\xc4\x80\xa7\x1c\x13\xad\x6e\x3a\x60\x6d\xce\x54\x0a\x1f\x49\x20\x42\x21\x35\x89\x31\xf6\x51\x5e\x02\x6d\xc3\xbc\x08\xbf\x07\x11\x23\x55\x99\xc4\x18\x13\x4d\x02\xf1\x8a\x92\xee\xb0\x05\xaa\x70\x17\x77\xd4\xc5\x19\xc6\xa9\xd0\x98\x04\x47\xb2\xc7\x63\x1b\x4c\x53\xb5\x27\x22\xd3\xbe\x78\xeb\x42\xa0\x94\xa2\xb5\xf4\x3c\x86\x44\x95\x45\xad\xd9\x18\x88\x22\x54\x06\x21\x7f\x6d\x2b\x28\xc7\xb4\xf8\x5e\x84\xaf\x6e\x06\x83\x6a\xe7\x9f\x52\xf3\x73\x13\x22\x68\xea\x47\xa8\x40\x3c\x83\x0e\x11\xd6\xdf\xe6\x5c\xe3\x5a\x0b\x89\x23\xd0\xa1\x50\x58\x7a\x1e\x85\xd2\x3b\x89\x2a\xf7\x01\xcd\x4f\x14\xd1\xb8\x48\x4c\xb0\xaf\xbf\x5c\xdb\xe3\x10\x52\x05\x89\x00\x2a\x25\x3d\xaa\x51\x7e\x3c\xe2\x4a\x2b\xa0\x12\x61\x8f\xa9\x36\xe7\x7f\x5f\x2f\x17\x16\x02\x34\x61\x39\x4a\x53\xb9\x43\x6d\xa2\x89\x67\xa0\xf0\x22\x7c\x83\xa4\x05\x56\xf8\x2f\x18\xe8\x11\x44\x7c\x8f\x15\xb4\x49\x84\x96\x0d\xbd\x1e\xdc\xad\xbc\xc9\xc6\x7b\xe7\x60\xb1\xdc\x54\x79\x18\x0c\x07\x00\x00\x9c\xc1\x9f\x93\xd5\xdd\x6f\x93\x15\x3c\xae\x66\x0f\x93\xd5\x16\xfe\xf0\xb6\x39\x78\xf1\x34\x9f\x8f\x72\x50\x20\x62\x23\x92\x12\x69\x8d\x12\xf3\x92\x89\xe6\x31\xc2\x66\xf6\xe0\xad\x37\x93\x87\xc7\xc2\xa9\x82\x10\x59\x16\x61\xfd\x08\xc3\x88\x1e\x61\xb6\xd8\x78\xbf\x7a\xd6\x64\xda\x45\x34\x2a\x4d\x12\x1a\x3b\xf0\xdc\x47\xe5\x2e\x33\x0f\x2f\x78\xb2\x0e\x1e\xa3\x22\x32\x4b\xea\xb1\x12\x7c\xd3\xc6\x4a\xa8\x93\x2a\x57\x84\x89\x04\xe1\x76\xb9\x9c\x7b\x13\x1b\x44\x69\xaa\x9d\x07\xe6\x26\xe2\xe3\xb3\x90\x48\x18\x46\xe8\x02\x0a\x1b\x33\x0f\x70\x0a\x4e\x25\x17\x92\xeb\x53\x75\x27\x06\x61\xea\xdd\x4f\x9e\xe6\x1b\xf8\x52\x84\x38\xa0\x1f\x0a\xb1\x27\x99\x8c\xea\xb1\x4b\x87\xc2\x40\xa2\x53\x00\x93\x47\x53\x58\x59\xc0\x29\xe6\xfd\x64\xbe\xf6\x6c\xf1\x42\xf3\x67\x1e\xe4\x2d\xa9\x1f\xae\x7a\xc8\x81\x27\x4c\x1c\xea\x80\xbc\x93\xc8\x88\x7f\xac\xdb\x55\x48\x25\x32\x72\xe0\x3a\xac\x92\x5f\x88\xcd\x18\x06\x57\x37\x83\x2e\x9d\x99\x06\x7e\x48\x68\xc5\xf8\x7b\x87\x16\x79\x98\x81\xe7\xda\x5a\x24\xd3\xa4\x96\x86\x46\xa7\x52\x98\x57\x58\xd5\xf5\xd3\xa9\xe8\x1a\x8b\x4d\x00\x1a\x04\x98\xea\xc6\xb3\x46\x7c\x8d\x8e\x88\x2a\x4d\xb2\x94\x19\xfa\x5d\x9f\x11\x32\x67\xf5\x0c\x23\xa4\x0a\x09\xbe\xa5\x5c\xa2\x6a\x50\xa1\xc4\xd4\xec\x18\xce\xaa\xf5\x57\xb7\x41\x56\xba\x4c\xeb\x6c\xe7\x9e\x16\xb3\x6f\x4f\x1e\xcc\x16\x53\xef\x7b\x53\x03\x89\xe1\xdf\x64\x53\x74\x27\xe3\x09\xc3\x37\x58\x2e\x0a\x2f\x0c\x8d\x9b\xb3\x91\x4d\x78\x64\x77\x18\x67\xef\x4f\x68\x0f\x5d\x62\x09\x67\xd5\x90\x95\x10\x66\x06\xfe\x15\xa2\x2c\x26\x9d\x44\x9a\xa2\x84\x58\xbc\xa2\xca\x0d\xcf\x3c\xe1\x2a\x44\x66\x4f\x1e\x42\x4c\x20\x10\x12\xaf\xed\x96\x18\x17\x76\xae\x40\xa1\xee\xd5\x6a\xb9\x5b\x7e\x68\xf6\xff\xaa\xd9\xbe\x16\xda\x5b\x88\x6d\x60\x6e\xf9\x54\x17\x1d\xb7\x79\xfb\x03\xac\x24\x48\xb5\xc6\x38\xd5\xa7\x6e\xb4\xce\xfb\x7c\x29\x59\x74\x43\xf5\x39\x9b\xf9\xbd\xa8\x7c\x72\x67\x5f\x2f\xa2\xc0\x5e\xa2\x3e\x22\x62\x97\xa8\x6e\x72\x9c\xc6\xd5\xcd\x2a\x8b\x63\x2a\x8f\x15\xae\x3a\x6a\xe9\x19\x10\x65\x29\xc4\xe6\x57\x1d\x13\xa5\x0f\x86\xd6\x79\x09\x35\x39\xd3\xff\x39\x33\xf8\x66\x5e\x2b\xf3\xd2\x05\x11\x55\xaa\xee\x8c\x51\x29\xba\x73\x67\x40\x9a\x92\x57\x94\xea\x6c\x79\xff\x0b\xee\x8a\x5a\x1b\xa9\x2b\x5c\x97\x32\xe7\x7e\x04\x0c\x86\x8d\xb5\x3b\xd4\xec\xf1\xd8\xe2\x91\xf8\x77\x66\xd6\x77\x4a\x75\xe8\x4a\xaa\xf0\x84\x54\x39\x1e\xb3\xc4\x33\x45\x02\xc1\xb0\x3e\x5e\x24\xaa\x54\x24\x0a\xe1\x76\xbe\xbc\xed\xe4\xac\x70\x56\x3b\x7d\xda\x33\x23\xd8\xe3\xf1\xaa\xef\xe5\xb2\x57\xeb\xb2\xfe\xea\x24\x77\x2a\x2c\x5b\xe9\x0e\x87\x8e\xeb\x74\xe5\x5a\xf5\xd1\x2a\x4c\x22\xa3\xf2\x99\xbd\x55\x34\x7d\x1c\xd6\x3a\x1a\x04\x65\x66\xc3\x9f\xaf\x9c\xd4\x0b\xc2\xa8\x3a\xa9\x74\xf8\xf5\x8b\x8b\x39\x5b\x73\x8e\x7f\x3c\x86\xed\x76\xbb\x1d\x3f\x3c\x8c\xa7\xd3\xb3\x69\xcf\xa8\x6e\x3b\x58\xcf\x3c\x4b\x74\xef\xf0\x6d\x68\x76\x10\x94\x37\x14\xaa\x92\xd1\x7b\xb2\xa3\xb3\x2c\x7a\x99\xac\x7c\x88\x0f\x86\x0d\x5b\xdf\x49\xbf\xe7\x7d\xa9\xe5\x5a\xde\xa9\xca\x33\xbd\xb9\xd8\xe2\x6a\xd9\xd4\x7a\x50\x0d\x7f\x81\x1c\xfb\xe7\x4e\x5f\x16\xe5\x3f\x1d\x36\x19\x6b\x6c\xd4\x05\xac\xbc\x7b\x6f\xe5\x2d\xee\x3c\xa7\x10\x18\x1a\xfc\x95\x99\x5b\x53\x6f\xee\x6d\x3c\xb8\x9b\xac\xef\x26\x53\xef\x22\x46\x29\x63\x8d\xdf\x6a\x35\xa6\x2b\x79\x39\x74\x77\xcc\xd7\xa6\x3a\xcf\xee\xb2\x4d\xa0\xf7\x91\xd3\xd3\xcf\xe2\x0f\x25\xcb\x1d\x67\x17\xb4\x51\x73\x1d\x61\x0b\x13\xbe\x60\xce\xb7\x5d\xc4\x93\x7d\xdd\xa2\xf0\x15\xf3\x2f\xd8\xe6\x10\x67\xf3\xa9\x76\x45\x75\xc0\x69\xe6\x47\x5c\x85\x0d\xdc\x7f\x4e\x57\xee\xbf\x70\x96\x97\xc2\xcc\x59\xa7\xa0\x72\x90\x82\x21\x67\x9f\xd6\x51\xb0\x77\xd2\x6d\xd0\x51\x99\xcb\xe5\x22\x72\x8b\x3a\x13\x90\x0b\xa8\x89\xe7\x9f\x01\x00\xf2\x27\x82\x8c\xbf\x14\x00\x00")
+
+func dataSqliteMigrations1_store_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSqliteMigrations1_store_createSql,
+		"data/sqlite-migrations/1_store_create.sql",
+	)
+}
+
+func dataSqliteMigrations1_store_createSql() (*asset, error) {
+	bytes, err := dataSqliteMigrations1_store_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/sqlite-migrations/1_store_create.sql", size: 5311, mode: os.FileMode(420), modTime: time.Unix(1792055248, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSqliteMigrations2_probes_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x58\x4f\x73\xdb\xb6\x13\xbd\xeb\x53\xe0\x16\x79\x7e\x4e\x7e\x6e\x3a\xe9\xc5\x27\x25\x66\x5a\xb5\xb6\xe4\xc8\x72\x27\x39\x61\x56\xc4\x4a\x42\x05\x01\x0c\xb0\x94\xac\x76\xfa\xdd\x3b\xfc\x03\x46\x84\x48\x8a\x6a\x7b\xec\x51\x7c\xbb\x8b\xdd\xb7\x8b\xc7\xa5\x5e\xbf\x66\xff\xdb\xca\x95\x05\x42\x76\x67\xf6\x7a\x70\x37\x9b\x3e\xb2\xf9\xe8\xfd\x7d\xc4\xc6\x1f\x59\xf4\x79\xfc\x34\x7f\x62\xa0\xcd\x16\x94\x44\x77\xdb\x8c\x3b\x74\x4e\x1a\xdd\x06\x5b\xdc\x99\x0d\x0a\x4e\x66\x83\x1d\x46\x4b\x8b\x6e\xdd\x6d\x04\x89\xe4\x1b\x3c\xb4\xc2\x71\x6c\x52\x4d\x6d\xb0\x43\x22\xa9\x57\x8e\x9b\x1d\x5a\x2b\x45\x6b\x3d\x89\x35\x0b\xe4\x0b\x65\xe2\x8d\x92\x8e\x5a\xac\xf2\x4c\xf9\x5a\x3a\x32\xf6\xd0\x19\x29\x4d\x04\x50\xeb\x69\x10\x93\xdc\x21\xcf\x0f\x75\xb7\x83\xc1\x71\x4f\x9e\x93\xec\xe7\x7c\x8d\x8c\x60\xa1\xd0\x31\xb3\xcc\x62\x12\xa6\xee\xb5\xc5\x95\x74\x64\x0f\x0c\xf2\xc7\x92\x1c\x2b\xdc\xa4\xd1\xec\xed\xbb\x6b\xb6\x34\x96\xd1\x1a\x33\x87\x05\x3a\x46\x26\x8b\x55\x78\xa1\x65\x7b\x49\x6b\x06\x5a\x30\x65\x56\x4c\x6a\x46\x26\x37\x7e\xfa\x74\x2f\x09\x99\x00\x82\x05\x38\x7c\x93\x1f\x0e\xd6\xc2\xc1\x31\xb0\xc8\x36\x98\x10\x03\x97\x85\x7a\x34\x8e\x56\x16\xb3\xe7\x16\x0e\x4c\x49\x42\x0b\xca\x5d\xe7\x71\xf6\xf9\x93\xc5\xff\x93\xaf\x6c\x6f\x25\x65\x56\x5a\x30\x8b\x20\x5c\x86\x6f\xdf\x0c\x3e\xcc\xa2\xd1\x3c\xfa\x46\xc7\x64\x3a\x6f\xa4\x64\x30\x1c\x30\xc6\x98\x14\xec\xd7\xd1\xec\xc3\x4f\xa3\x19\x7b\x9c\x8d\x1f\x46\xb3\x2f\xec\x97\xe8\x4b\xee\x35\x79\xbe\xbf\xbf\xce\x8d\x62\x8b\x79\xfd\x9c\xe4\x16\xd9\x7c\xfc\x10\x3d\xcd\x47\x0f\x8f\x05\x98\xf3\xc0\xe3\xd8\xc7\x19\xbe\xbd\x3a\x06\xc0\xe9\x0a\xf9\xfe\xc6\x43\x0a\x68\x69\xec\xd6\x23\xc5\x53\x67\x96\xb4\x07\x8b\x5c\xc3\x16\x2b\xa7\xef\x6e\x6e\xae\x02\x7c\x87\x36\xbb\x19\x81\x77\x9a\x24\xc6\x52\x76\x23\xd0\x91\xab\x83\x1a\x69\x6f\xec\x86\xd3\x21\xa9\x22\x17\x08\xec\x40\xaa\x6c\x0a\xf8\x02\xb4\xd8\x4b\x41\xeb\xba\x41\x3e\x90\xf5\x47\x45\x65\x4b\xd8\x4a\x75\x68\x42\xbe\x91\x5a\x3c\x55\xe0\xa8\x1c\x57\x11\xd2\xa7\x4c\x0c\x2a\xc8\x89\x60\x55\xe5\x5f\xb5\x82\xdd\x45\x1f\x47\xcf\xf7\x73\xf6\xea\x8f\x3f\x5f\x15\xbe\xd9\xd4\x85\x34\xc4\x92\x82\x9c\x62\x50\x6a\x01\xf1\x86\xa7\x56\xb5\x20\x0e\x63\x8b\x54\x07\xb3\x5e\xff\x6e\x74\x90\xda\xd7\x54\x22\xf1\xb5\x49\x6d\xc8\xb0\x21\xb9\x3c\xf0\xbd\x5c\x4a\x6e\xb4\x3a\xb0\xf7\xd3\xe9\x7d\x34\x9a\x54\x69\x7f\x1c\xdd\x3f\x45\x35\xdb\x2d\xbc\xf0\x04\x2d\x17\x70\x60\xe3\xc9\x3c\xfa\x31\x9a\x55\xd6\x37\x35\xcb\x18\x08\x57\xc6\x4a\x0c\x0e\xcd\x7b\xc3\xa5\xde\x81\x92\x82\x3b\xa9\xe3\x93\xf1\xac\x9b\x58\x04\x17\x32\xb6\xc7\x45\x92\xba\x35\x47\x2d\x12\x23\x35\x35\xa3\xc9\xdb\x77\x3f\x88\x75\x33\x06\x69\x38\x34\x79\xc7\x1d\xa2\x0e\xd3\x11\x98\xdf\x42\xc8\xe6\x14\xe8\x14\x55\x98\x5f\x34\x8b\x5f\x53\x74\xcd\x46\x40\x84\x8e\x8a\x0b\xa9\x70\x87\x41\x53\x4b\xd7\xa0\xa7\x83\xab\x5b\x2f\x0d\xe3\xc9\x5d\xf4\xb9\x4b\x1a\x78\x95\x3d\x97\xe2\x85\x4d\x27\x75\x98\x0d\x2b\xfc\x92\xa0\x65\x23\x1a\x03\xe6\xd8\xd5\xed\xa0\x4b\xbd\x6a\xa2\x7f\x89\x7a\x15\x2e\xff\x69\xd7\xdf\xd3\x2e\xcf\xde\xc9\xe1\xb1\x92\xa8\xe9\x54\xeb\x1a\xf4\xac\xa7\x4e\xad\x41\xaf\x50\xf0\xa5\x44\x25\x5c\xcf\xc1\xad\x4d\x05\xaf\x72\xf2\x73\x56\x83\xd9\xb0\xc2\xcf\xcc\x5a\x6d\x09\x19\x0c\x4f\xb9\xec\x18\xb7\x90\xc6\x00\xb6\x98\x28\x88\x51\xf0\x45\x50\xbe\x45\x92\x36\xb8\xf0\x67\x8a\xaf\xa5\xc9\xfd\xc1\xbe\xf6\x1a\xca\x86\x1e\xee\x75\xcd\xaa\x2d\xad\x2c\x7e\x23\x75\x5b\x41\x3b\x50\x29\xb6\x60\x4d\x72\xdb\xb9\x4c\x1c\xd3\x3a\xcc\x0e\xbd\x2e\xe2\x5f\x0d\xce\xa4\x7d\xba\x85\x96\x99\x4b\xd1\xbb\x67\x0d\x3a\x70\xe6\xda\x96\x87\xb2\x9f\x9f\xa6\x93\x20\x64\x6c\xb6\x5b\xd4\xd4\xab\xf6\x73\xc5\xf9\x0d\xfc\x5b\x49\xfe\x75\x79\x5c\xd2\xe8\x79\x3e\x1d\x4f\x3e\xcc\xa2\x87\x68\x32\x2f\x2f\xaf\x43\x7b\x2c\x48\x65\xb5\xe0\xdc\xde\x58\xc1\xd7\xe0\x02\xc1\x70\xa0\x82\x94\x73\xad\x87\x38\x46\xe7\xc2\x66\x59\x73\xb2\xb8\x18\x4a\x82\x17\xcf\x11\x80\x3a\xdb\xb3\x44\xb5\x19\x78\xc2\x9a\x56\x84\xdc\x21\x3f\x3b\x2f\x1d\x6d\x55\xf2\x89\x57\xb9\x2a\x58\x8c\xb3\x2f\x90\x03\x8f\x8d\xc0\xbe\xf2\xe1\x99\xe5\x9e\x29\x7f\x79\x3c\xc0\x86\x1e\x39\xd7\xa3\xf2\x23\xea\x92\xb1\x3b\x6e\x4d\x00\x6d\xf0\xc0\x13\x8b\x4b\xf9\xd2\x61\x70\xdc\xbf\x00\x76\xb1\x49\xd0\xb5\x80\xf9\x18\x36\x48\x50\xe7\xd5\xcc\x9b\x91\xba\xd3\x0d\xd6\x7f\x88\xb6\x08\xd7\xf3\x64\xfc\xe9\xb9\x85\xfd\x92\x33\xee\x8b\xa9\xd8\x2f\x01\x36\xf4\xc8\x19\xf6\xeb\xdf\xb9\x97\xf4\xa0\x54\xc9\x76\x26\x8b\x57\x65\xbb\xa0\xfb\xf9\x68\x81\x8f\x2f\x49\x00\x75\xd2\x8d\x2f\x89\xb4\xe8\x6a\xac\x06\xfe\xa9\x0b\x58\xff\xa7\xfd\xa8\xb3\x58\x6e\x6c\xbe\x2f\x79\xec\xe9\x24\x30\x2a\x77\x37\xdf\xa3\xf2\x8c\x1e\xc1\x2b\x5a\xbb\x62\x57\x46\x17\x85\xf6\x1d\xe9\x8a\xdc\xf3\x56\x7b\x2e\x6b\x73\xf5\x1b\xc9\x1e\x83\xd5\xd9\xc0\xf3\xaf\xb3\xe2\xbf\x9f\x4b\x26\xd9\x97\x54\x99\xf6\x1e\xc4\xcc\x93\xc3\xea\xe4\x75\x25\x13\x0e\x42\xd8\x4c\xfa\xff\x05\x9d\xe8\x31\xd1\x67\x46\xb7\xa9\xf7\x9e\xa9\x13\x05\xf7\x40\x7f\x05\xf7\xff\xc7\x5d\x42\xba\xdf\xaa\x2a\xd3\x3a\xdc\xb1\x37\x09\x24\x90\xaa\x17\xb1\x95\xe7\x19\x2e\xaa\x0a\x4e\x76\xc1\x0a\xa9\xed\x81\xbd\x42\xd5\x72\x6a\x88\x57\xc3\xaf\x6e\x07\x7f\x0d\x00\x8a\x6b\x84\x5d\xfd\x14\x00\x00")
+
+func dataSqliteMigrations2_probes_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSqliteMigrations2_probes_createSql,
+		"data/sqlite-migrations/2_probes_create.sql",
+	)
+}
+
+func dataSqliteMigrations2_probes_createSql() (*asset, error) {
+	bytes, err := dataSqliteMigrations2_probes_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/sqlite-migrations/2_probes_create.sql", size: 5373, mode: os.FileMode(420), modTime: time.Unix(1792056564, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataSqliteMigrations3_webhook_deliveries_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x90\xc1\x6e\xea\x30\x10\x45\xf7\xfe\x8a\xbb\x04\xbd\x87\x54\xa9\xab\x8a\x95\x4b\x4c\x9b\x36\x24\x51\x62\x2a\x58\x59\xa1\x4c\xc1\x05\x62\xe4\x8c\x80\xcf\xaf\x9a\x34\x0a\xa0\xa2\x2e\x3d\xf7\x1c\xcf\xe8\x0e\x06\xf8\xb7\xb3\x2b\x5f\x30\x21\x70\xc7\x52\x04\x59\x92\x42\xcb\xc7\x48\x21\x1c\x43\xcd\xc2\x5c\xe7\x38\xd2\x62\xed\xdc\xc6\x2c\x69\x6b\x0f\xe4\x2d\x55\x43\x21\xce\xd5\xe9\xfe\xfb\xa9\xd7\xd4\xa2\xe8\x50\xb8\x0f\xf0\x9a\x90\xba\x8a\x57\x9e\xaa\x9c\x9d\x27\x14\xf5\xbc\xf1\xad\x2b\x71\xff\x20\x46\x99\x92\x5a\x75\xcb\xe3\x44\xdf\x3e\x40\xf4\x04\x00\xd8\x25\xde\x64\x36\x7a\x96\x19\xd2\x2c\x9c\xc8\x6c\x8e\x57\x35\xaf\xd5\x78\x1a\x45\xff\x6b\xe8\xd3\x2d\xcc\x19\x78\x19\x72\x51\x6d\x6e\xa7\x74\xa0\x92\xf1\x92\x27\xf1\x55\x50\x30\xd3\x6e\xcf\x15\xc2\x58\xab\x27\xd5\x79\x08\xd4\x58\x4e\x23\x8d\xbb\xe6\x87\x92\x4e\x6c\x7e\x68\x53\x30\x74\x38\x51\xb9\x96\x93\xb4\x89\xb7\x45\xc5\x86\xbc\x77\xbe\xbd\xa0\x99\xbf\x7b\xaa\x8b\x31\x6c\x77\xd4\x49\xa2\x3f\x6c\x7b\x0a\xe3\x40\xcd\xfe\xec\xc9\x5c\xec\xb7\xcb\x13\x92\xf8\x17\x0c\xbd\xab\x3b\xfb\x43\xf1\x35\x00\x3f\x89\x3a\xfb\x1c\x02\x00\x00")
+
+func dataSqliteMigrations3_webhook_deliveries_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataSqliteMigrations3_webhook_deliveries_createSql,
+		"data/sqlite-migrations/3_webhook_deliveries_create.sql",
+	)
+}
+
+func dataSqliteMigrations3_webhook_deliveries_createSql() (*asset, error) {
+	bytes, err := dataSqliteMigrations3_webhook_deliveries_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/sqlite-migrations/3_webhook_deliveries_create.sql", size: 540, mode: os.FileMode(420), modTime: time.Unix(1792056776, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -203,9 +1211,57 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
+	"data/migrations/10_tasks_state_varchar.sql": dataMigrations10_tasks_state_varcharSql,
+	"data/migrations/11_tasks_archive_create.sql": dataMigrations11_tasks_archive_createSql,
+	"data/migrations/12_add_jobs_priority.sql": dataMigrations12_add_jobs_prioritySql,
+	"data/migrations/13_add_jobs_webhook.sql": dataMigrations13_add_jobs_webhookSql,
+	"data/migrations/14_idempotency_keys_create.sql": dataMigrations14_idempotency_keys_createSql,
+	"data/migrations/15_add_jobs_target_version.sql": dataMigrations15_add_jobs_target_versionSql,
+	"data/migrations/16_add_jobs_target_languages.sql": dataMigrations16_add_jobs_target_languagesSql,
+	"data/migrations/17_add_jobs_target_sample_rate.sql": dataMigrations17_add_jobs_target_sample_rateSql,
+	"data/migrations/18_add_jobs_target_probe_ids.sql": dataMigrations18_add_jobs_target_probe_idsSql,
+	"data/migrations/19_add_jobs_target_tags.sql": dataMigrations19_add_jobs_target_tagsSql,
 	"data/migrations/1_jobs_create.sql": dataMigrations1_jobs_createSql,
 	"data/migrations/1_tasks_create.sql": dataMigrations1_tasks_createSql,
+	"data/migrations/20_add_jobs_target_exclusions.sql": dataMigrations20_add_jobs_target_exclusionsSql,
+	"data/migrations/21_add_jobs_target_active_within.sql": dataMigrations21_add_jobs_target_active_withinSql,
+	"data/migrations/22_add_jobs_target_regions.sql": dataMigrations22_add_jobs_target_regionsSql,
+	"data/migrations/23_add_jobs_target_expression.sql": dataMigrations23_add_jobs_target_expressionSql,
+	"data/migrations/24_segments_create.sql": dataMigrations24_segments_createSql,
+	"data/migrations/25_measurement_coverage_create.sql": dataMigrations25_measurement_coverage_createSql,
+	"data/migrations/26_job_cohorts_create.sql": dataMigrations26_job_cohorts_createSql,
+	"data/migrations/27_add_jobs_dry_run.sql": dataMigrations27_add_jobs_dry_runSql,
+	"data/migrations/28_add_jobs_notification.sql": dataMigrations28_add_jobs_notificationSql,
+	"data/migrations/29_alerts_create.sql": dataMigrations29_alerts_createSql,
 	"data/migrations/2_add_jobs_state.sql": dataMigrations2_add_jobs_stateSql,
+	"data/migrations/30_add_jobs_notification_window.sql": dataMigrations30_add_jobs_notification_windowSql,
+	"data/migrations/31_probe_cohorts_create.sql": dataMigrations31_probe_cohorts_createSql,
+	"data/migrations/32_add_jobs_owner.sql": dataMigrations32_add_jobs_ownerSql,
+	"data/migrations/33_tasks_notify_state_trigger.sql": dataMigrations33_tasks_notify_state_triggerSql,
+	"data/migrations/34_task_outbox_create.sql": dataMigrations34_task_outbox_createSql,
+	"data/migrations/35_tasks_partition.sql": dataMigrations35_tasks_partitionSql,
+	"data/migrations/36_add_jobs_deleted_at.sql": dataMigrations36_add_jobs_deleted_atSql,
+	"data/migrations/37_add_idempotency_request_hash.sql": dataMigrations37_add_idempotency_request_hashSql,
+	"data/migrations/38_add_jobs_state_before_delete.sql": dataMigrations38_add_jobs_state_before_deleteSql,
+	"data/migrations/39_webhook_deliveries_create.sql": dataMigrations39_webhook_deliveries_createSql,
+	"data/migrations/3_task_results_create.sql": dataMigrations3_task_results_createSql,
+	"data/migrations/4_add_tasks_report_ids.sql": dataMigrations4_add_tasks_report_idsSql,
+	"data/migrations/5_add_tasks_cancelled_state.sql": dataMigrations5_add_tasks_cancelled_stateSql,
+	"data/migrations/6_tasks_notify_trigger.sql": dataMigrations6_tasks_notify_triggerSql,
+	"data/migrations/7_add_tasks_run_id.sql": dataMigrations7_add_tasks_run_idSql,
+	"data/migrations/8_add_tasks_lease.sql": dataMigrations8_add_tasks_leaseSql,
+	"data/migrations/9_task_errors_create.sql": dataMigrations9_task_errors_createSql,
+	"data/schemas/dash.json": dataSchemasDashJson,
+	"data/schemas/facebook_messenger.json": dataSchemasFacebook_messengerJson,
+	"data/schemas/http_header_field_manipulation.json": dataSchemasHttp_header_field_manipulationJson,
+	"data/schemas/http_invalid_request_line.json": dataSchemasHttp_invalid_request_lineJson,
+	"data/schemas/ndt.json": dataSchemasNdtJson,
+	"data/schemas/telegram.json": dataSchemasTelegramJson,
+	"data/schemas/web_connectivity.json": dataSchemasWeb_connectivityJson,
+	"data/schemas/whatsapp.json": dataSchemasWhatsappJson,
+	"data/sqlite-migrations/1_store_create.sql": dataSqliteMigrations1_store_createSql,
+	"data/sqlite-migrations/2_probes_create.sql": dataSqliteMigrations2_probes_createSql,
+	"data/sqlite-migrations/3_webhook_deliveries_create.sql": dataSqliteMigrations3_webhook_deliveries_createSql,
 	"data/templates/home.tmpl": dataTemplatesHomeTmpl,
 }
 
@@ -251,9 +1307,61 @@ type bintree struct {
 var _bintree = &bintree{nil, map[string]*bintree{
 	"data": &bintree{nil, map[string]*bintree{
 		"migrations": &bintree{nil, map[string]*bintree{
+			"10_tasks_state_varchar.sql": &bintree{dataMigrations10_tasks_state_varcharSql, map[string]*bintree{}},
+			"11_tasks_archive_create.sql": &bintree{dataMigrations11_tasks_archive_createSql, map[string]*bintree{}},
+			"12_add_jobs_priority.sql": &bintree{dataMigrations12_add_jobs_prioritySql, map[string]*bintree{}},
+			"13_add_jobs_webhook.sql": &bintree{dataMigrations13_add_jobs_webhookSql, map[string]*bintree{}},
+			"14_idempotency_keys_create.sql": &bintree{dataMigrations14_idempotency_keys_createSql, map[string]*bintree{}},
+			"15_add_jobs_target_version.sql": &bintree{dataMigrations15_add_jobs_target_versionSql, map[string]*bintree{}},
+			"16_add_jobs_target_languages.sql": &bintree{dataMigrations16_add_jobs_target_languagesSql, map[string]*bintree{}},
+			"17_add_jobs_target_sample_rate.sql": &bintree{dataMigrations17_add_jobs_target_sample_rateSql, map[string]*bintree{}},
+			"18_add_jobs_target_probe_ids.sql": &bintree{dataMigrations18_add_jobs_target_probe_idsSql, map[string]*bintree{}},
+			"19_add_jobs_target_tags.sql": &bintree{dataMigrations19_add_jobs_target_tagsSql, map[string]*bintree{}},
 			"1_jobs_create.sql": &bintree{dataMigrations1_jobs_createSql, map[string]*bintree{}},
 			"1_tasks_create.sql": &bintree{dataMigrations1_tasks_createSql, map[string]*bintree{}},
+			"20_add_jobs_target_exclusions.sql": &bintree{dataMigrations20_add_jobs_target_exclusionsSql, map[string]*bintree{}},
+			"21_add_jobs_target_active_within.sql": &bintree{dataMigrations21_add_jobs_target_active_withinSql, map[string]*bintree{}},
+			"22_add_jobs_target_regions.sql": &bintree{dataMigrations22_add_jobs_target_regionsSql, map[string]*bintree{}},
+			"23_add_jobs_target_expression.sql": &bintree{dataMigrations23_add_jobs_target_expressionSql, map[string]*bintree{}},
+			"24_segments_create.sql": &bintree{dataMigrations24_segments_createSql, map[string]*bintree{}},
+			"25_measurement_coverage_create.sql": &bintree{dataMigrations25_measurement_coverage_createSql, map[string]*bintree{}},
+			"26_job_cohorts_create.sql": &bintree{dataMigrations26_job_cohorts_createSql, map[string]*bintree{}},
+			"27_add_jobs_dry_run.sql": &bintree{dataMigrations27_add_jobs_dry_runSql, map[string]*bintree{}},
+			"28_add_jobs_notification.sql": &bintree{dataMigrations28_add_jobs_notificationSql, map[string]*bintree{}},
+			"29_alerts_create.sql": &bintree{dataMigrations29_alerts_createSql, map[string]*bintree{}},
 			"2_add_jobs_state.sql": &bintree{dataMigrations2_add_jobs_stateSql, map[string]*bintree{}},
+			"30_add_jobs_notification_window.sql": &bintree{dataMigrations30_add_jobs_notification_windowSql, map[string]*bintree{}},
+			"31_probe_cohorts_create.sql": &bintree{dataMigrations31_probe_cohorts_createSql, map[string]*bintree{}},
+			"32_add_jobs_owner.sql": &bintree{dataMigrations32_add_jobs_ownerSql, map[string]*bintree{}},
+			"33_tasks_notify_state_trigger.sql": &bintree{dataMigrations33_tasks_notify_state_triggerSql, map[string]*bintree{}},
+			"34_task_outbox_create.sql": &bintree{dataMigrations34_task_outbox_createSql, map[string]*bintree{}},
+			"35_tasks_partition.sql": &bintree{dataMigrations35_tasks_partitionSql, map[string]*bintree{}},
+			"36_add_jobs_deleted_at.sql": &bintree{dataMigrations36_add_jobs_deleted_atSql, map[string]*bintree{}},
+			"37_add_idempotency_request_hash.sql": &bintree{dataMigrations37_add_idempotency_request_hashSql, map[string]*bintree{}},
+			"38_add_jobs_state_before_delete.sql": &bintree{dataMigrations38_add_jobs_state_before_deleteSql, map[string]*bintree{}},
+			"39_webhook_deliveries_create.sql": &bintree{dataMigrations39_webhook_deliveries_createSql, map[string]*bintree{}},
+			"3_task_results_create.sql": &bintree{dataMigrations3_task_results_createSql, map[string]*bintree{}},
+			"4_add_tasks_report_ids.sql": &bintree{dataMigrations4_add_tasks_report_idsSql, map[string]*bintree{}},
+			"5_add_tasks_cancelled_state.sql": &bintree{dataMigrations5_add_tasks_cancelled_stateSql, map[string]*bintree{}},
+			"6_tasks_notify_trigger.sql": &bintree{dataMigrations6_tasks_notify_triggerSql, map[string]*bintree{}},
+			"7_add_tasks_run_id.sql": &bintree{dataMigrations7_add_tasks_run_idSql, map[string]*bintree{}},
+			"8_add_tasks_lease.sql": &bintree{dataMigrations8_add_tasks_leaseSql, map[string]*bintree{}},
+			"9_task_errors_create.sql": &bintree{dataMigrations9_task_errors_createSql, map[string]*bintree{}},
+		}},
+		"schemas": &bintree{nil, map[string]*bintree{
+			"dash.json": &bintree{dataSchemasDashJson, map[string]*bintree{}},
+			"facebook_messenger.json": &bintree{dataSchemasFacebook_messengerJson, map[string]*bintree{}},
+			"http_header_field_manipulation.json": &bintree{dataSchemasHttp_header_field_manipulationJson, map[string]*bintree{}},
+			"http_invalid_request_line.json": &bintree{dataSchemasHttp_invalid_request_lineJson, map[string]*bintree{}},
+			"ndt.json": &bintree{dataSchemasNdtJson, map[string]*bintree{}},
+			"telegram.json": &bintree{dataSchemasTelegramJson, map[string]*bintree{}},
+			"web_connectivity.json": &bintree{dataSchemasWeb_connectivityJson, map[string]*bintree{}},
+			"whatsapp.json": &bintree{dataSchemasWhatsappJson, map[string]*bintree{}},
+		}},
+		"sqlite-migrations": &bintree{nil, map[string]*bintree{
+			"1_store_create.sql": &bintree{dataSqliteMigrations1_store_createSql, map[string]*bintree{}},
+			"2_probes_create.sql": &bintree{dataSqliteMigrations2_probes_createSql, map[string]*bintree{}},
+			"3_webhook_deliveries_create.sql": &bintree{dataSqliteMigrations3_webhook_deliveries_createSql, map[string]*bintree{}},
 		}},
 		"templates": &bintree{nil, map[string]*bintree{
 			"home.tmpl": &bintree{dataTemplatesHomeTmpl, map[string]*bintree{}},
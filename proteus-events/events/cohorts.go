@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// Cohort values of a Target. A frozen cohort is the set of probes matched
+// when the job is created, which every run of the job targets again. By
+// default the target is re-evaluated at every run instead.
+const (
+	ReevaluatedCohort	= "reevaluated"
+	FrozenCohort		= "frozen"
+)
+
+// freezeCohort stores the probes currently matched by the target as the
+// cohort of the job.
+func freezeCohort(cx context.Context, jobID string, t Target,
+					testName string, tx *sql.Tx, db *sqlx.DB) error {
+	probes, err := t.FindProbes(cx, 0, testName, db)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(cx, pq.CopyIn(
+		viper.GetString("database.job-cohorts-table"), "job_id", "probe_id"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to prepare cohort copy")
+		return err
+	}
+	for _, p := range probes {
+		if _, err = stmt.ExecContext(cx, jobID, p.Id); err != nil {
+			ctx.WithError(err).Error("failed to copy cohort probe")
+			return err
+		}
+	}
+	if _, err = stmt.ExecContext(cx); err != nil {
+		ctx.WithError(err).Error("failed to copy cohort")
+		return err
+	}
+	return stmt.Close()
+}
+
+// getCohort returns the probes of the frozen cohort of the job which are
+// still active.
+func getCohort(cx context.Context, jobID string,
+				db *sqlx.DB) ([]MatchingProbe, error) {
+	var probes []MatchingProbe
+	query := fmt.Sprintf(`SELECT
+		p.id,
+		COALESCE(p.probe_cc, ''),
+		COALESCE(p.platform, '')
+		FROM %s AS c
+		JOIN %s AS p ON p.id = c.probe_id
+		WHERE c.job_id = $1 AND p.deactivated_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.job-cohorts-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	rows, err := db.QueryContext(cx, query, jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get cohort")
+		return probes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p MatchingProbe
+		if err = rows.Scan(&p.Id, &p.ProbeCC, &p.Platform); err != nil {
+			ctx.WithError(err).Error("failed to iterate over cohort")
+			return probes, err
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// CoverageGapMode is the Target mode selecting the probes in the country/ASN
+// cells with the fewest recent measurements for the test of the job.
+const CoverageGapMode = "coverage_gap"
+
+// CoverageEntry is how many measurements of a test were collected from a
+// country/ASN cell in a day, as ingested from the measurement pipeline.
+type CoverageEntry struct {
+	ProbeCC		string `json:"probe_cc" binding:"required"`
+	ProbeASN	string `json:"probe_asn" binding:"required"`
+	TestName	string `json:"test_name" binding:"required"`
+	// YYYY-MM-DD
+	Date		string `json:"date" binding:"required"`
+	Count		int64 `json:"count"`
+}
+
+type CoverageReq struct {
+	Coverage	[]CoverageEntry `json:"coverage" binding:"required"`
+}
+
+// IngestCoverage stores the coverage entries, replacing the counts already
+// known for the same cell, test and day.
+func IngestCoverage(cx context.Context, entries []CoverageEntry,
+					db *sqlx.DB) error {
+	tx, err := db.BeginTx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (
+		probe_cc, probe_asn,
+		test_name,
+		measurement_date,
+		measurement_count
+	) VALUES (
+		$1, $2,
+		$3,
+		$4,
+		$5)
+	ON CONFLICT (probe_cc, probe_asn, test_name, measurement_date)
+	DO UPDATE SET measurement_count = EXCLUDED.measurement_count`,
+		pq.QuoteIdentifier(viper.GetString("database.measurement-coverage-table")))
+	stmt, err := tx.PrepareContext(cx, query)
+	if err != nil {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to prepare coverage query")
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		date, err := time.Parse("2006-01-02", e.Date)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("invalid date %q", e.Date)
+		}
+		_, err = stmt.ExecContext(cx, e.ProbeCC, e.ProbeASN,
+									e.TestName,
+									date,
+									e.Count)
+		if err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to insert into coverage table")
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+	return nil
+}
+
+// coverageGapCondition restricts the probes to the cells with the fewest
+// measurements of testName in the coverage window. Cells without any
+// coverage data come first.
+func (t Target) coverageGapCondition(testName string,
+									args []interface{}) (string, []interface{}) {
+	window, _ := t.coverageWindow()
+	cells := t.CoverageCells
+	if cells <= 0 {
+		cells = viper.GetInt64("targeting.coverage-cells")
+	}
+	args = append(args, testName, time.Now().UTC().Add(-window), cells)
+	cond := fmt.Sprintf(`(probe_cc, probe_asn) IN (
+		SELECT cells.probe_cc, cells.probe_asn
+		FROM (SELECT DISTINCT probe_cc, probe_asn FROM %s) AS cells
+		LEFT JOIN (SELECT probe_cc, probe_asn,
+			SUM(measurement_count) AS measurements
+			FROM %s
+			WHERE test_name = $%d AND measurement_date >= $%d::date
+			GROUP BY probe_cc, probe_asn) AS coverage
+		ON coverage.probe_cc = cells.probe_cc
+			AND coverage.probe_asn = cells.probe_asn
+		ORDER BY COALESCE(coverage.measurements, 0),
+			cells.probe_cc, cells.probe_asn
+		LIMIT $%d)`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		pq.QuoteIdentifier(viper.GetString("database.measurement-coverage-table")),
+		len(args) - 2, len(args) - 1, len(args))
+	return cond, args
+}
+
+func (t Target) coverageWindow() (time.Duration, error) {
+	window := t.CoverageWindow
+	if window == "" {
+		window = viper.GetString("targeting.coverage-window")
+	}
+	if len(window) == 0 || window[0] != 'P' {
+		return 0, ErrInvalidCoverageWindow
+	}
+	d, err := ParseDuration(window[1:])
+	if err != nil {
+		return 0, ErrInvalidCoverageWindow
+	}
+	return d.ToDuration(), nil
+}
@@ -1,25 +1,35 @@
 package events
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
-	_ "strings"
+	"strings"
 	"sync"
 
+	"github.com/thetorproject/proteus/proteus-common/anomaly"
+	"github.com/thetorproject/proteus/proteus-common/autotls"
+	"github.com/thetorproject/proteus/proteus-common/secrets"
+	"github.com/thetorproject/proteus/proteus-common/dbconn"
+	"github.com/thetorproject/proteus/proteus-common/schema"
+	"github.com/thetorproject/proteus/proteus-common/tasksign"
 	"github.com/thetorproject/proteus/proteus-common/middleware"
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-common/quiethours"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+	"github.com/thetorproject/proteus/proteus-events/taskargs"
 
 	"github.com/gin-contrib/multitemplate"
 	"github.com/apex/log"
 	"github.com/satori/go.uuid"
-	"github.com/rubenv/sql-migrate"
-	"github.com/lib/pq"
 	"github.com/jmoiron/sqlx"
-	"github.com/jmoiron/sqlx/types"
 	"github.com/spf13/viper"
 	"github.com/gin-gonic/gin"
 	"github.com/facebookgo/grace/gracehttp"
@@ -30,20 +40,67 @@ var ctx = log.WithFields(log.Fields{
 	"cmd": "events",
 })
 
+// initReplica opens the read replica at database.replica-url, if any
+func initReplica() (*sqlx.DB, error) {
+	db, err := dbconn.OpenReplica("postgres")
+	if err != nil || db == nil {
+		return nil, err
+	}
+	return sqlx.NewDb(db, "postgres"), nil
+}
+
 func initDatabase() (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", viper.GetString("database.url"))
+	db, err := dbconn.Open("postgres")
 	if err != nil {
-		ctx.Error("failed to open database")
 		return nil, err
 	}
-	return db, err
+	return sqlx.NewDb(db, "postgres"), nil
 }
 
 type Target struct {
 	Countries	[]string `json:"countries"`
 	Platforms	[]string `json:"platforms"`
+	// Probes in these countries or on these platforms are never targeted
+	ExcludeCountries	[]string `json:"exclude_countries"`
+	ExcludePlatforms	[]string `json:"exclude_platforms"`
+	// Semver range the probe software version has to satisfy, e.g. ">=2.1.0"
+	Version		string `json:"version"`
+	// Probe locales to target, a bare language such as "pt" also matches
+	// all of its regional variants
+	Languages	[]string `json:"languages"`
+	// Fraction of the matching probes that get a task on every run. Zero
+	// means no sampling, every matching probe is targeted.
+	SampleRate	float64 `json:"sample_rate"`
+	// When set only these probes are targeted
+	ProbeIds		[]string `json:"probe_ids"`
+	ExcludeProbeIds	[]string `json:"exclude_probe_ids"`
+	// Probes having any of these tags are targeted
+	Tags			[]string `json:"tags"`
+	// ISO 8601 duration, e.g. "P30D". Only the probes that were seen
+	// within it are targeted.
+	ActiveWithin	string `json:"active_within"`
+	// ISO 3166-2 codes of the regions to target, e.g. "IR-07"
+	Regions			[]string `json:"regions"`
+	// Targeting expression combining the dimensions above with AND, OR and
+	// NOT, e.g. "(country=IR AND platform=android) OR tag=staff"
+	Expression		string `json:"expression"`
+	// Name of a segment the probes also have to be matched by
+	Segment			string `json:"segment"`
+	// Set to "coverage_gap" to only target the probes in the CoverageCells
+	// country/ASN cells with the fewest measurements for the test of the
+	// job in the CoverageWindow (an ISO 8601 duration).
+	Mode			string `json:"mode"`
+	CoverageWindow	string `json:"coverage_window"`
+	CoverageCells	int64 `json:"coverage_cells"`
+	// Either "reevaluated" (the default) or "frozen" to keep targeting the
+	// probes matched when the job was created
+	Cohort			string `json:"cohort"`
+	// Probes in any of these admin managed cohorts are targeted
+	ProbeCohorts	[]string `json:"probe_cohorts"`
 }
 
+
+
 type URLTestArg struct {
 	GlobalCategories	[]string `json:"global_categories"`
 	CountryCategories	[]string `json:"country_categories"`
@@ -54,7 +111,15 @@ type Task struct {
 	Id			string `json:"id"`
 	TestName	string `json:"test_name" binding:"required"`
 	Arguments	interface{} `json:"arguments"`
-	State		string
+	State		taskstate.State
+	ProbeId		string `json:"-"`
+	JobId		string `json:"-"`
+	// The priority of the job the task belongs to, higher goes first
+	Priority	int64 `json:"priority"`
+	// The signature of the signedTask, when tasks.signing-key is set
+	Signed		*tasksign.Signature `json:"signed,omitempty"`
+
+	CreationTime	time.Time `json:"-"`
 }
 
 type JobData struct {
@@ -62,86 +127,71 @@ type JobData struct {
 	Schedule		string `json:"schedule" binding:"required"`
 	Delay			int64 `json:"delay"`
 	Comment			string `json:"comment" binding:"required"`
+	Priority		int64 `json:"priority"`
+	// Called whenever one of the tasks of the job is finished, returned to
+	// ready by an expired lease, or reaped
+	WebhookURL		string `json:"webhook_url"`
+	WebhookSecret	string `json:"webhook_secret,omitempty"`
+	// The notifications of dry run jobs are logged by proteus-notify instead
+	// of being pushed to the devices
+	DryRun			bool `json:"dry_run"`
+	// Either "visible" (the default) to show a notification to the user or
+	// "silent" to only wake up the app in the background, where the
+	// platform allows it
+	Notification	string `json:"notification"`
+	// "HH:MM-HH:MM" in the timezone of the probe. Tasks are created right
+	// away but the probes are only notified within the window, e.g.
+	// "08:00-10:00" to notify them in their morning.
+	NotificationWindow	string `json:"notification_window"`
 	Task			Task `json:"task"`
 	Target			Target `json:"target"`
 	State			string `json:"state"`
+	// The account that created the job, only it, the accounts it is
+	// SharedWith and the admins can change it
+	CreatedBy		string `json:"created_by"`
+	SharedWith		[]string `json:"shared_with"`
 
 	CreationTime	time.Time `json:"creation_time"`
+	// When the job was deleted, it can be restored until it is purged
+	DeletedAt		*time.Time `json:"deleted_at,omitempty"`
 }
 
-func AddJob(db *sqlx.DB, jd JobData, s *Scheduler) (string, error) {
+// Notification values of a JobData
+const (
+	VisibleNotification	= "visible"
+	SilentNotification	= "silent"
+)
+
+var ErrInvalidNotification = errors.New("invalid notification")
+var ErrInvalidNotificationWindow = errors.New("invalid notification_window")
+
+func AddJob(cx context.Context, store Store, jd JobData,
+			s *Scheduler) (string, error) {
 	schedule, err := ParseSchedule(jd.Schedule)
 	if err != nil {
 		ctx.WithError(err).Error("invalid schedule format")
 		return "", err
 	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		ctx.WithError(err).Error("failed to open transaction")
+	if err = store.ValidateTarget(cx, jd.Target); err != nil {
 		return "", err
 	}
-
-	jd.Id = uuid.NewV4().String()
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			id, comment,
-			schedule, delay,
-			target_countries,
-			target_platforms,
-			task_test_name,
-			task_arguments,
-			creation_time,
-			times_run,
-			next_run_at,
-			is_done,
-			state
-		) VALUES (
-			$1, $2,
-			$3, $4,
-			$5,
-			$6,
-			$7,
-			$8,
-			$9,
-			$10,
-			$11,
-			$12,
-			$13)`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare jobs query")
-			return "", err
-		}
-		defer stmt.Close()
-
-		taskArgsStr, err := json.Marshal(jd.Task.Arguments)
-		if err != nil {
-			ctx.WithError(err).Error("failed to serialise task arguments")
-			return "", err
-		}
-		_, err = stmt.Exec(jd.Id, jd.Comment,
-							jd.Schedule, jd.Delay,
-							pq.Array(jd.Target.Countries),
-							pq.Array(jd.Target.Platforms),
-							jd.Task.TestName,
-							taskArgsStr,
-							time.Now().UTC(),
-							0,
-							schedule.StartTime,
-							false,
-							"active")
-		if err != nil {
-			tx.Rollback()
-			ctx.WithError(err).Error("failed to insert into jobs table")
-			return "", err
+	switch jd.Notification {
+	case "", VisibleNotification, SilentNotification:
+	default:
+		return "", ErrInvalidNotification
+	}
+	if jd.NotificationWindow != "" {
+		if _, err = quiethours.Parse(jd.NotificationWindow); err != nil {
+			return "", ErrInvalidNotificationWindow
 		}
 	}
+	// Malformed arguments would only fail once the probes run the task
+	if err = taskargs.Validate(jd.Task.TestName, jd.Task.Arguments); err != nil {
+		return "", err
+	}
 
-	if err = tx.Commit(); err != nil {
-		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+	jd.Id = uuid.NewV4().String()
+	if err = store.CreateJob(cx, jd, schedule); err != nil {
 		return "", err
 	}
 	j := Job{
@@ -159,216 +209,218 @@ func AddJob(db *sqlx.DB, jd JobData, s *Scheduler) (string, error) {
 	return jd.Id, nil
 }
 
-func ListJobs(db *sqlx.DB, showDeleted bool) ([]JobData, error) {
-	// XXX this can probably be unified with JobDB.GetAll()
-	var (
-		currentJobs []JobData
-	)
-	query := fmt.Sprintf(`SELECT
-		id, comment,
-		creation_time,
-		schedule, delay,
-		target_countries,
-		target_platforms,
-		task_test_name,
-		task_arguments,
-		COALESCE(state, 'active') AS state
-		FROM %s`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-	if showDeleted == false {
-		query += " WHERE state = 'active'"
-	}
-	rows, err := db.Query(query)
-	if err != nil {
-		ctx.WithError(err).Error("failed to list jobs")
-		return currentJobs, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			jd JobData
-			taskArgs types.JSONText
-		)
-		err := rows.Scan(&jd.Id,
-						&jd.Comment,
-						&jd.CreationTime,
-						&jd.Schedule,
-						&jd.Delay,
-						pq.Array(&jd.Target.Countries),
-						pq.Array(&jd.Target.Platforms),
-						&jd.Task.TestName,
-						&taskArgs,
-						&jd.State)
-		if err != nil {
-			ctx.WithError(err).Error("failed to iterate over jobs")
-			return currentJobs, err
-		}
-		err = taskArgs.Unmarshal(&jd.Task.Arguments)
+var ErrJobNotFound = errors.New("job not found")
+
+var ErrTaskNotFound = errors.New("task not found")
+var ErrAccessDenied = errors.New("access denied")
+var ErrInconsistentState = taskstate.ErrInvalidTransition
+
+// signedTask is what the signature of a task covers, the probe it is for
+// included so that it can't be replayed to others
+type signedTask struct {
+	Id			string `json:"id"`
+	ProbeId		string `json:"probe_id"`
+	TestName	string `json:"test_name"`
+	Arguments	interface{} `json:"arguments"`
+}
+
+// signTasks signs the tasks of the probe, if there is a signer
+func signTasks(signer *tasksign.Signer, probeID string, tasks []Task) error {
+	if signer == nil {
+		return nil
+	}
+	for i, t := range tasks {
+		signed, err := signer.Sign(signedTask{
+			Id: t.Id,
+			ProbeId: probeID,
+			TestName: t.TestName,
+			Arguments: t.Arguments,
+		})
 		if err != nil {
-			ctx.WithError(err).Error("failed to unmarshal JSON")
-			return currentJobs, err
+			ctx.WithError(err).Error("failed to sign task")
+			return err
 		}
-		currentJobs = append(currentJobs, jd)
+		tasks[i].Signed = signed
 	}
-	return currentJobs, nil
+	return nil
 }
 
-var ErrJobNotFound = errors.New("job not found")
-
-func DeleteJob(jobID string, db *sqlx.DB) (error) {
-	query := fmt.Sprintf(`UPDATE %s SET
-		state = $2
-		WHERE id = $1`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-	_, err := db.Exec(query, jobID, "deleted")
+// GetTask returns the task, provided it belongs to the probe uID
+func GetTask(cx context.Context, tID string, uID string,
+				tasks TaskStore) (Task, error) {
+	task, err := tasks.GetTask(cx, tID)
 	if err != nil {
-		// XXX I am not actually sure this is the correct error
-		if err == sql.ErrNoRows {
-			return ErrJobNotFound
-		}
-		ctx.WithError(err).Error("failed delete job")
-		return err
+		return task, err
 	}
-	return nil
+	if task.ProbeId != uID {
+		return Task{}, ErrAccessDenied
+	}
+	return task, nil
 }
 
-var ErrTaskNotFound = errors.New("task not found")
-var ErrAccessDenied = errors.New("access denied")
-var ErrInconsistentState = errors.New("task already accepted")
+// TaskHistoryItem is a task as seen in the history of a probe
+type TaskHistoryItem struct {
+	Id				string `json:"id"`
+	TestName		string `json:"test_name"`
+	Arguments		interface{} `json:"arguments"`
+	State			taskstate.State `json:"state"`
+	CreationTime	time.Time `json:"creation_time"`
+	LastUpdated		time.Time `json:"last_updated"`
+}
 
-func GetTask(tID string, uID string, db *sqlx.DB) (Task, error) {
-	var (
-		err error
-		probeId string
-		taskArgs types.JSONText
-	)
-	task := Task{}
-	query := fmt.Sprintf(`SELECT
-		id,
-		probe_id,
-		test_name,
-		arguments,
-		COALESCE(state, 'active')
-		FROM %s
-		WHERE id = $1`,
-		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
-	err = db.QueryRow(query, tID).Scan(
-		&task.Id,
-		&probeId,
-		&task.TestName,
-		&taskArgs,
-		&task.State)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return task, ErrTaskNotFound
-		}
-		ctx.WithError(err).Error("failed to get task")
-		return task, err
+// Transition moves the task to the state to, provided the state machine
+// allows it, and records when it happened.
+func (t *Task) Transition(cx context.Context, to taskstate.State,
+							store Store) (error) {
+	if err := t.State.Check(to); err != nil {
+		return ErrInconsistentState
 	}
-	if probeId != uID {
-		return task, ErrAccessDenied
+	if err := store.SetTaskState(cx, t.Id, t.State, to); err != nil {
+		return err
 	}
-	err = taskArgs.Unmarshal(&task.Arguments)
-	if err != nil {
-		ctx.WithError(err).Error("failed to unmarshal json")
-		return task, err
+	t.State = to
+	if isFinishedState(to) && t.JobId != "" {
+		FireTaskWebhook(*t, WebhookTaskState, store)
 	}
-	return task, nil
+	return nil
 }
 
-func GetTasksForUser(uID string, since string,
-						db *sqlx.DB) ([]Task, error) {
-	var (
-		err error
-		tasks []Task
-	)
-	query := fmt.Sprintf(`SELECT
-		id,
-		test_name,
-		arguments
-		FROM %s
-		WHERE
-		state = 'ready' AND
-		probe_id = $1 AND creation_time >= $2`,
-		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
-
-	rows, err := db.Query(query, uID, since)
+func SetTaskState(cx context.Context, tID string, uID string,
+					state taskstate.State,
+					store Store) (error) {
+	task, err := GetTask(cx, tID, uID, store)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return tasks, nil
-		}
-		ctx.WithError(err).Error("failed to get task list")
-		return tasks, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			taskArgs types.JSONText
-			task Task
-		)
-		rows.Scan(&task.Id, &task.TestName, &taskArgs)
+		return err
+	}
+	return task.Transition(cx, state, store)
+}
+
+type TaskStateReq struct {
+	State string `json:"state" binding:"required"`
+}
+
+type BatchTaskReq struct {
+	TaskIds []string `json:"task_ids" binding:"required"`
+}
+
+// SetTasksState moves all the tasks in tIDs to state. A failure on one task
+// does not prevent the others from being updated, the returned map contains
+// the error (or nil) for every task.
+func SetTasksState(cx context.Context, tIDs []string, uID string,
+					state taskstate.State,
+					store Store) map[string]error {
+	errs := make(map[string]error)
+	for _, tID := range tIDs {
+		errs[tID] = SetTaskState(cx, tID, uID, state, store)
+	}
+	return errs
+}
+
+func batchTaskStateHandler(state taskstate.State, anomalies *anomaly.Detector,
+							store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var batchReq BatchTaskReq
+		userId := c.MustGet("userID").(string)
+		err := c.BindJSON(&batchReq)
 		if err != nil {
-			ctx.WithError(err).Error("failed to get task")
-			return tasks, err
+			ctx.WithError(err).Error("invalid request")
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": "invalid request"})
+			return
 		}
-		err = taskArgs.Unmarshal(&task.Arguments)
-		if err != nil {
-			ctx.WithError(err).Error("failed to unmarshal json")
-			return tasks, err
+		results := make(map[string]string)
+		for tID, err := range SetTasksState(c.Request.Context(),
+											batchReq.TaskIds, userId, state, store) {
+			switch err {
+			case nil:
+				results[tID] = string(state)
+				if state == taskstate.Accepted {
+					anomalies.ObserveDecision(userId, true, time.Now())
+				}
+			case ErrInconsistentState:
+				results[tID] = "inconsistent state"
+			case ErrAccessDenied:
+				results[tID] = "access denied"
+			case ErrTaskNotFound:
+				results[tID] = "task not found"
+			default:
+				results[tID] = "server side error"
+			}
 		}
-		tasks = append(tasks, task)
+		c.JSON(http.StatusOK,
+				gin.H{"results": results})
 	}
-	return tasks, nil
 }
 
-func SetTaskState(tID string, uID string,
-					state string, validStates []string,
-					updateTimeCol string,
-					db *sqlx.DB) (error) {
-	var err error
-	task, err := GetTask(tID, uID, db)
+// CancelProbeTasks cancels the tasks of the probe it hasn't finished yet,
+// returning how many were cancelled.
+func CancelProbeTasks(cx context.Context, probeID string,
+						store Store) (int, error) {
+	tIDs, err := store.UnfinishedTasks(cx, probeID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	stateConsistent := false
-	for _, s := range validStates {
-		if task.State == s {
-			stateConsistent = true
-			break
+	cancelled := 0
+	for _, tID := range tIDs {
+		task, err := store.GetTask(cx, tID)
+		if err != nil {
+			continue
+		}
+		// The task may have moved on in the meantime
+		if task.Transition(cx, taskstate.Cancelled, store) == nil {
+			cancelled++
 		}
 	}
-	if !stateConsistent {
-		return ErrInconsistentState
-	}
-
-	query := fmt.Sprintf(`UPDATE %s SET
-		state = $2,
-		%s = $3,
-		last_updated = $3
-		WHERE id = $1`,
-		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
-		updateTimeCol)
+	return cancelled, nil
+}
 
-	_, err = db.Exec(query, tID, state, time.Now().UTC())
+// CancelTask moves a task that has not yet been accepted to the cancelled
+// state. If the probe had already been notified about it we also tell it
+// that the task has been recalled.
+func CancelTask(cx context.Context, tID string, store Store) (error) {
+	task, err := store.GetTask(cx, tID)
+	if err != nil {
+		return err
+	}
+	wasNotified := task.State == taskstate.Notified
+	err = task.Transition(cx, taskstate.Cancelled, store)
 	if err != nil {
-		ctx.WithError(err).Error("failed to get task")
 		return err
 	}
+
+	if wasNotified {
+		err = TaskCancelNotify(task.ProbeId, tID)
+		if err != nil {
+			// The task is cancelled regardless, the probe will find out
+			// when it tries to accept it.
+			ctx.WithError(err).Errorf("failed to notify %s of cancellation",
+										task.ProbeId)
+		}
+	}
 	return nil
 }
 
-func runMigrations(db *sqlx.DB) (error) {
-	migrations := &migrate.AssetMigrationSource{
-		Asset: Asset,
-		AssetDir: AssetDir,
-		Dir: "data/migrations",
+func newMigrator(db *sql.DB) *schema.Migrator {
+	return schema.NewMigrator(db, viper.GetString("database.schema-version-table"),
+								Asset, AssetDir)
+}
+
+// OpenMigrator connects to the database for the migrate command
+func OpenMigrator() (*schema.Migrator, error) {
+	err := secrets.Load()
+	if err != nil {
+		return nil, err
 	}
-	n, err := migrate.Exec(db.DB, "postgres", migrations, migrate.Up)
+	db, err := initDatabase()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ctx.Infof("performed %d migrations", n)
-	return nil
+	return newMigrator(db.DB), nil
+}
+
+// runMigrations checks the schema of the database, and brings it up to date
+func runMigrations(db *sqlx.DB) (error) {
+	return newMigrator(db.DB).Startup()
 }
 
 func loadTemplates(list ...string) multitemplate.Render {
@@ -388,30 +440,38 @@ func loadTemplates(list ...string) multitemplate.Render {
     return r
 }
 
-func Start() {
-	db, err := initDatabase()
-	if (err != nil) {
-		ctx.WithError(err).Error("failed to connect to DB")
-		return
-	}
-	defer db.Close()
-
-	err = runMigrations(db)
-	if (err != nil) {
-		ctx.WithError(err).Error("failed to run DB migration")
-		return
+// loadArgumentSchemas loads the schemas of the task arguments, one per test
+// in data/schemas named after it
+func loadArgumentSchemas() error {
+	names, err := AssetDir("data/schemas")
+	if err != nil {
+		return err
 	}
-
-	authMiddleware, err := proteus_mw.InitAuthMiddleware(db)
-	if (err != nil) {
-		ctx.WithError(err).Error("failed to initialise authMiddlewareDevice")
-		return
+	for _, name := range names {
+		raw, err := Asset("data/schemas/" + name)
+		if err != nil {
+			return err
+		}
+		err = taskargs.Load(strings.TrimSuffix(name, ".json"), raw)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	scheduler := NewScheduler(db)
-
+// setupRouter registers the routes of the API, the admin ones behind the
+// staff auth of authMiddleware and the device ones behind the probe auth.
+func setupRouter(store Store, scheduler *Scheduler,
+					taskListener *TaskListener, taskSigner *tasksign.Signer,
+					anomalies *anomaly.Detector,
+					authMiddleware *proteus_mw.GinJWTMiddleware,
+					adminAllowlist *proteus_mw.IPAllowlist,
+					internalAllowlist *proteus_mw.IPAllowlist,
+					corsConfig cors.Config) *gin.Engine {
 	router := gin.Default()
-	router.Use(cors.New(proteus_mw.CorsConfig()))
+	router.Use(proteus_mw.SecurityHeaders(), cors.New(corsConfig),
+				proteus_mw.LimitBodyFromConfig())
 	router.HTMLRender = loadTemplates("home.tmpl")
 	router.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "home.tmpl", gin.H{
@@ -421,12 +481,81 @@ func Start() {
 		})
 	})
 	v1 := router.Group("/api/v1")
+	// Probes can register here as well as with proteus-registry, both store
+	// them in the active probes table. There is no GeoIP database here, so
+	// the region and city are only filled in when they check in with the
+	// registry.
+	v1.POST("/login", authMiddleware.LoginHandler)
+	v1.POST("/refresh", authMiddleware.RefreshHandler)
+	v1.POST("/logout", authMiddleware.LogoutHandler)
+	v1.POST("/totp/enroll", authMiddleware.TOTPEnrollHandler)
+	v1.POST("/totp/confirm", authMiddleware.TOTPConfirmHandler)
+	v1.GET("/oidc/login", authMiddleware.OIDCLoginHandler)
+	v1.GET("/oidc/callback", authMiddleware.OIDCCallbackHandler)
+	v1.POST("/register", func(c *gin.Context) {
+		var registerReq probes.ClientData
+		err := c.BindJSON(&registerReq)
+		if err != nil {
+			ctx.WithError(err).Error("invalid request")
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": "invalid request"})
+			return
+		}
+		clientID, err := store.RegisterProbe(c.Request.Context(), registerReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": err.Error()})
+			return
+		}
+		probeSettings, _ := store.ProbeSettings(c.Request.Context(),
+												registerReq.ProbeCC,
+												registerReq.SoftwareVersion)
+		c.JSON(http.StatusOK, gin.H{"client_id": clientID,
+									"settings": probeSettings})
+		return
+	})
+
+	// The routes of the other proteus services, which don't authenticate
+	// to each other
+	internal := v1.Group("/internal")
+	internal.Use(internalAllowlist.Handler())
+	{
+		// The notify service delivered the push of the tasks
+		internal.POST("/tasks/notified", func(c *gin.Context) {
+			var notifiedReq NotifiedReq
+			if err := c.BindJSON(&notifiedReq); err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err := store.MarkTasksNotified(c.Request.Context(),
+											notifiedReq.TaskIDs)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+	}
 
 	admin := v1.Group("/admin")
-	admin.Use(authMiddleware.MiddlewareFunc(proteus_mw.AdminAuthorizor))
+	// Viewers can use the routes that don't require another role
+	admin.Use(adminAllowlist.Handler(),
+				proteus_mw.RequireClientCert(),
+				proteus_mw.RateLimitFromConfig("rate-limit.admin.ip").ByIP(),
+				authMiddleware.StaffMiddlewareFunc(proteus_mw.StaffAuthorizor),
+				proteus_mw.RequireScope(proteus_mw.JobsAdminScope),
+				proteus_mw.RateLimitFromConfig("rate-limit.admin.identity").ByIdentity())
 	{
+		operator := proteus_mw.RequireRole(proteus_mw.OperatorRole)
+		// The counters of the background jobs along with the runtime
+		// metrics, for monitoring
+		admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 		admin.GET("/jobs", func(c *gin.Context) {
-			jobList, err := ListJobs(db, true)
+			showDeleted := c.Query("show_deleted") == "true"
+			jobList, err := store.ListJobs(c.Request.Context(), showDeleted)
 			if err != nil {
 				c.JSON(http.StatusBadRequest,
 						gin.H{"error": err.Error()})
@@ -435,7 +564,7 @@ func Start() {
 			c.JSON(http.StatusOK,
 					gin.H{"jobs": jobList})
 		})
-		admin.POST("/job", func(c *gin.Context) {
+		admin.POST("/job", operator, func(c *gin.Context) {
 			var jobData JobData
 			err := c.BindJSON(&jobData)
 			if err != nil {
@@ -444,7 +573,10 @@ func Start() {
 						gin.H{"error": "invalid request"})
 				return
 			}
-			jobID, err := AddJob(db, jobData, scheduler)
+			account, _ := c.Get("account")
+			jobData.CreatedBy = account.(proteus_mw.Account).Username
+			jobID, err := AddJob(c.Request.Context(), store, jobData,
+								scheduler)
 			if (err != nil) {
 				c.JSON(http.StatusBadRequest,
 						gin.H{"error": err.Error()})
@@ -455,149 +587,762 @@ func Start() {
 					gin.H{"id": jobID})
 			return
 		})
-		admin.DELETE("/job/:job_id", func(c *gin.Context) {
-			jobID := c.Param("job_id")
-			err := DeleteJob(jobID, db)
+		admin.POST("/coverage", operator, func(c *gin.Context) {
+			var coverageReq CoverageReq
+			err := c.BindJSON(&coverageReq)
 			if err != nil {
-				if err == ErrJobNotFound {
-					c.JSON(http.StatusNotFound,
-							gin.H{"error": "job not found"})
-					return
-				}
+				ctx.WithError(err).Error("invalid request")
 				c.JSON(http.StatusBadRequest,
-						gin.H{"error": "server side error"})
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = store.IngestCoverage(c.Request.Context(), coverageReq.Coverage)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
 				return
 			}
 			c.JSON(http.StatusOK,
-					gin.H{"status": "deleted"})
+					gin.H{"status": "ok"})
+			return
 		})
-	}
-
-	device := v1.Group("/")
-	device.Use(authMiddleware.MiddlewareFunc(proteus_mw.DeviceAuthorizor))
-	{
-		device.GET("/tasks", func(c *gin.Context) {
-			userId := c.MustGet("userID").(string)
-			since := c.DefaultQuery("since", "2016-10-20T10:30:00Z")
-			_, err := time.Parse(ISOUTCTimeLayout, since)
+		admin.POST("/target/estimate", func(c *gin.Context) {
+			var target Target
+			err := c.BindJSON(&target)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			// The coverage gap mode depends on the test being run
+			estimate, err := EstimateTarget(c.Request.Context(), target,
+											c.Query("test_name"), store)
 			if err != nil {
 				c.JSON(http.StatusBadRequest,
-						gin.H{"error": "invalid since specified"})
+						gin.H{"error": err.Error()})
 				return
 			}
-			tasks, err := GetTasksForUser(userId, since, db)
+			c.JSON(http.StatusOK, estimate)
+			return
+		})
+		admin.GET("/alerts", func(c *gin.Context) {
+			alerts, err := store.ListAlerts(c.Request.Context())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError,
 						gin.H{"error": "server side error"})
 				return
 			}
 			c.JSON(http.StatusOK,
-					gin.H{"tasks": tasks})
+					gin.H{"alerts": alerts})
+			return
 		})
-
-		device.GET("/task/:task_id", func(c *gin.Context) {
-			taskID := c.Param("task_id")
-			userId := c.MustGet("userID").(string)
-			task, err := GetTask(taskID, userId, db)
+		admin.POST("/alert", operator, func(c *gin.Context) {
+			var alert Alert
+			err := c.BindJSON(&alert)
 			if err != nil {
-				if err == ErrAccessDenied {
-					c.JSON(http.StatusUnauthorized,
-							gin.H{"error": "access denied"})
-					return
-				}
-				if err == ErrTaskNotFound {
-					// XXX is it a concern that a user this way can enumerate
-					// tasks of other users?
-					// I don't think it's a security issue, but it's worth
-					// thinking about...
-					c.JSON(http.StatusNotFound,
-							gin.H{"error": "task not found"})
-					return
-				}
+				ctx.WithError(err).Error("invalid request")
 				c.JSON(http.StatusBadRequest,
 						gin.H{"error": "invalid request"})
 				return
 			}
+			alertID, err := store.AddAlert(c.Request.Context(), alert)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusOK,
-					gin.H{"id": task.Id,
-						"test_name": task.TestName,
-						"arguments": task.Arguments})
+					gin.H{"id": alertID})
 			return
 		})
-		device.POST("/task/:task_id/accept", func(c *gin.Context) {
-			taskID := c.Param("task_id")
-			userId := c.MustGet("userID").(string)
-			err := SetTaskState(taskID,
-								userId,
-								"accepted",
-								[]string{"ready", "notified"},
-								"accept_time",
-								db)
+		admin.DELETE("/alert/:alert_id", operator, func(c *gin.Context) {
+			err := store.WithdrawAlert(c.Request.Context(), c.Param("alert_id"))
 			if err != nil {
-				if err == ErrInconsistentState {
-					c.JSON(http.StatusBadRequest,
-							gin.H{"error": "task already accepted"})
-					return
-				}
-				if err == ErrAccessDenied {
-					c.JSON(http.StatusUnauthorized,
-							gin.H{"error": "access denied"})
-					return
-				}
-				if err == ErrTaskNotFound {
+				if err == ErrAlertNotFound {
 					c.JSON(http.StatusNotFound,
-							gin.H{"error": "task not found"})
+							gin.H{"error": err.Error()})
 					return
 				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
 			}
 			c.JSON(http.StatusOK,
-					gin.H{"status": "accepted"})
+					gin.H{"status": "withdrawn"})
 			return
 		})
-		device.POST("/task/:task_id/reject", func(c *gin.Context) {
-			taskID := c.Param("task_id")
-			userId := c.MustGet("userID").(string)
-			err := SetTaskState(taskID,
-								userId,
-								"rejected",
-								[]string{"ready", "notified", "accepted"},
-								"done_time",
-								db)
+		admin.GET("/cohorts", func(c *gin.Context) {
+			cohorts, err := store.ListProbeCohorts(c.Request.Context())
 			if err != nil {
-				if err == ErrInconsistentState {
-					c.JSON(http.StatusBadRequest,
-							gin.H{"error": "task already done"})
-					return
-				}
-				if err == ErrAccessDenied {
-					c.JSON(http.StatusUnauthorized,
-							gin.H{"error": "access denied"})
-					return
-				}
-				if err == ErrTaskNotFound {
-					c.JSON(http.StatusNotFound,
-							gin.H{"error": "task not found"})
-					return
-				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
 			}
 			c.JSON(http.StatusOK,
-					gin.H{"status": "rejected"})
+					gin.H{"cohorts": cohorts})
 			return
 		})
-		device.POST("/task/:task_id/done", func(c *gin.Context) {
-			taskID := c.Param("task_id")
-			userId := c.MustGet("userID").(string)
-			err := SetTaskState(taskID,
-								userId,
-								"done",
-								[]string{"accepted"},
-								"done_time",
-								db)
+		admin.POST("/cohort", operator, func(c *gin.Context) {
+			var cohort ProbeCohort
+			err := c.BindJSON(&cohort)
 			if err != nil {
-				if err == ErrInconsistentState {
-					c.JSON(http.StatusBadRequest,
-							gin.H{"error": "task already done"})
-					return
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = store.CreateProbeCohort(c.Request.Context(), cohort)
+			if err != nil {
+				if err == ErrProbeCohortExists {
+					c.JSON(http.StatusConflict,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"name": cohort.Name})
+			return
+		})
+		admin.GET("/cohort/:name", func(c *gin.Context) {
+			members, err := store.ProbeCohortMembers(c.Request.Context(), c.Param("name"))
+			if err != nil {
+				if err == ErrProbeCohortNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"name": c.Param("name"), "probes": members})
+			return
+		})
+		admin.DELETE("/cohort/:name", operator, func(c *gin.Context) {
+			err := store.DeleteProbeCohort(c.Request.Context(), c.Param("name"))
+			if err != nil {
+				switch err {
+				case ErrProbeCohortNotFound:
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+				case ErrProbeCohortInUse:
+					c.JSON(http.StatusConflict,
+							gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+				}
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deleted"})
+			return
+		})
+		admin.POST("/cohort/:name/probes", operator, func(c *gin.Context) {
+			var req ProbeCohortMembersReq
+			err := c.BindJSON(&req)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			added, err := store.AddProbeCohortMembers(c.Request.Context(), c.Param("name"),
+														req.ProbeIds)
+			if err != nil {
+				switch err {
+				case ErrProbeCohortNotFound:
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+				case ErrUnknownProbe:
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+				}
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"added": added})
+			return
+		})
+		admin.DELETE("/cohort/:name/probe/:probe_id", operator, func(c *gin.Context) {
+			err := store.RemoveProbeCohortMember(c.Request.Context(), c.Param("name"),
+												c.Param("probe_id"))
+			if err != nil {
+				if err == ErrProbeNotInCohort {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "removed"})
+			return
+		})
+		admin.GET("/segments", func(c *gin.Context) {
+			segments, err := store.ListSegments(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"segments": segments})
+			return
+		})
+		admin.GET("/segment/:name", func(c *gin.Context) {
+			version, err := strconv.ParseInt(c.DefaultQuery("version", "0"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid version"})
+				return
+			}
+			segment, err := store.GetSegment(c.Request.Context(), c.Param("name"), version)
+			if err != nil {
+				if err == ErrSegmentNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK, segment)
+			return
+		})
+		admin.PUT("/segment/:name", operator, func(c *gin.Context) {
+			var segment Segment
+			err := c.BindJSON(&segment)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			segment.Name = c.Param("name")
+			version, err := store.PutSegment(c.Request.Context(), segment)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"name": segment.Name, "version": version})
+			return
+		})
+		admin.DELETE("/segment/:name", operator, func(c *gin.Context) {
+			err := store.DeleteSegment(c.Request.Context(), c.Param("name"))
+			if err != nil {
+				switch err {
+				case ErrSegmentNotFound:
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+				case ErrSegmentInUse:
+					c.JSON(http.StatusConflict,
+							gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+				}
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deleted"})
+			return
+		})
+		admin.DELETE("/job/:job_id", operator, func(c *gin.Context) {
+			jobID := c.Param("job_id")
+			account, _ := c.Get("account")
+			err := CheckJobOwner(c.Request.Context(), jobID,
+									account.(proteus_mw.Account), store)
+			if err == nil {
+				err = store.DeleteJob(c.Request.Context(), jobID)
+			}
+			if err != nil {
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusForbidden,
+							gin.H{"error": "not the owner of the job"})
+					return
+				}
+				if err == ErrJobNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "job not found"})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "server side error"})
+				return
+			}
+			scheduler.StopJob(jobID)
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deleted"})
+		})
+		admin.POST("/job/:job_id/restore", operator, func(c *gin.Context) {
+			jobID := c.Param("job_id")
+			account, _ := c.Get("account")
+			err := CheckJobOwner(c.Request.Context(), jobID,
+									account.(proteus_mw.Account), store)
+			var j *Job
+			if err == nil {
+				j, err = store.RestoreJob(c.Request.Context(), jobID)
+			}
+			if err != nil {
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusForbidden,
+							gin.H{"error": "not the owner of the job"})
+					return
+				}
+				if err == ErrJobNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "deleted job not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			// Jobs deleted once done stay done
+			if !j.IsDone {
+				go scheduler.RunJob(j)
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "restored"})
+		})
+		admin.PUT("/job/:job_id/shares", operator, func(c *gin.Context) {
+			var shareReq JobShareReq
+			err := c.BindJSON(&shareReq)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			jobID := c.Param("job_id")
+			account, _ := c.Get("account")
+			err = CheckJobOwner(c.Request.Context(), jobID,
+								account.(proteus_mw.Account), store)
+			if err == nil {
+				err = store.ShareJob(c.Request.Context(), jobID,
+										shareReq.SharedWith)
+			}
+			if err != nil {
+				if err == ErrJobNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "job not found"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusForbidden,
+							gin.H{"error": "not the owner of the job"})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "shared"})
+		})
+		admin.POST("/task/:task_id/cancel", operator, func(c *gin.Context) {
+			taskID := c.Param("task_id")
+			account, _ := c.Get("account")
+			err := CheckTaskOwner(c.Request.Context(), taskID,
+									account.(proteus_mw.Account), store)
+			if err == nil {
+				err = CancelTask(c.Request.Context(), taskID, store)
+			}
+			if err != nil {
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusForbidden,
+							gin.H{"error": "not the owner of the job"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task already accepted"})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "cancelled"})
+		})
+		admin.POST("/broadcast", proteus_mw.RequireRole(proteus_mw.AdminRole), func(c *gin.Context) {
+			var broadcastReq BroadcastReq
+			err := c.BindJSON(&broadcastReq)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = Broadcast(broadcastReq, c.Request.Header.Get("Authorization"))
+			if err != nil {
+				if err == ErrInvalidTopic {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": err.Error()})
+					return
+				}
+				ctx.WithError(err).Error("failed to broadcast")
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		admin.GET("/job/:job_id/stats", func(c *gin.Context) {
+			jobID := c.Param("job_id")
+			stats, err := store.JobStats(c.Request.Context(), jobID)
+			if err != nil {
+				if err == ErrJobNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "job not found"})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		})
+		admin.GET("/job/:job_id/results", func(c *gin.Context) {
+			jobID := c.Param("job_id")
+			results, err := store.JobResults(c.Request.Context(), jobID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"results": results})
+		})
+	}
+
+	tasksByIP := proteus_mw.RateLimitFromConfig("rate-limit.tasks.ip").ByIP()
+	tasksByIdentity := proteus_mw.RateLimitFromConfig("rate-limit.tasks.identity").ByIdentity()
+	tasksRead := proteus_mw.RequireScope(proteus_mw.TasksReadScope)
+	tasksWrite := proteus_mw.RequireScope(proteus_mw.TasksWriteScope)
+	device := v1.Group("/")
+	device.Use(authMiddleware.MiddlewareFunc(proteus_mw.DeviceAuthorizor),
+				proteus_mw.RejectBlocked(store.IsBlocked),
+				proteus_mw.TrackLastSeen(store.TouchProbe))
+	{
+		// Called when the user opts out or uninstalls the app
+		device.DELETE("/device/me", func(c *gin.Context) {
+			userId := c.MustGet("userID").(string)
+			err := store.DeactivateProbe(c.Request.Context(), userId)
+			if err != nil {
+				if err == probes.ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			cancelled, err := CancelProbeTasks(c.Request.Context(), userId, store)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deactivated", "cancelled_tasks": cancelled})
+			return
+		})
+		device.GET("/device/me/export", func(c *gin.Context) {
+			export, err := store.ExportDeviceData(c.Request.Context(),
+												c.MustGet("userID").(string))
+			if err != nil {
+				if err == probes.ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.Header("Content-Disposition",
+					"attachment; filename=\"proteus-data.json\"")
+			c.JSON(http.StatusOK, export)
+			return
+		})
+		// The data is deleted once the grace period is over, until then the
+		// probe is only deactivated
+		device.DELETE("/device/me/data", func(c *gin.Context) {
+			purgeAfter, err := store.RequestDeletion(c.Request.Context(),
+								c.MustGet("userID").(string),
+								viper.GetDuration("privacy.deletion-grace-period"))
+			if err != nil {
+				if err == probes.ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			CancelProbeTasks(c.Request.Context(),
+							c.MustGet("userID").(string), store)
+			c.JSON(http.StatusAccepted,
+					gin.H{"status": "deletion requested",
+						"purge_after": purgeAfter})
+			return
+		})
+		device.GET("/alerts", func(c *gin.Context) {
+			userId := c.MustGet("userID").(string)
+			alerts, err := store.ProbeAlerts(c.Request.Context(), userId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"alerts": alerts})
+			return
+		})
+		device.POST("/alert/:alert_id/ack", func(c *gin.Context) {
+			userId := c.MustGet("userID").(string)
+			err := store.AckAlert(c.Request.Context(), c.Param("alert_id"), userId)
+			if err != nil {
+				if err == ErrAlertNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "acknowledged"})
+			return
+		})
+		// Polled by every probe, so misbehaving ones could swamp the DB
+		device.GET("/tasks", tasksByIP, tasksByIdentity, tasksRead, func(c *gin.Context) {
+			var (
+				err error
+				cursor TaskCursor
+			)
+			userId := c.MustGet("userID").(string)
+			anomalies.ObservePoll(userId, time.Now())
+			if c.Query("cursor") != "" {
+				cursor, err = ParseTaskCursor(c.Query("cursor"))
+				if err != nil {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid cursor specified"})
+					return
+				}
+			} else {
+				// XXX since is kept for older clients, it should go away
+				// once they all use cursor.
+				since := c.DefaultQuery("since", "2016-10-20T10:30:00Z")
+				cursor.Time, err = time.Parse(ISOUTCTimeLayout, since)
+				if err != nil {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid since specified"})
+					return
+				}
+			}
+			wait, err := strconv.Atoi(c.DefaultQuery("wait", "0"))
+			if err != nil || wait < 0 {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid wait specified"})
+				return
+			}
+			if maxWait := viper.GetInt("api.max-poll-wait"); wait > maxWait {
+				wait = maxWait
+			}
+			// We subscribe before querying so that we don't miss tasks
+			// created in between.
+			newTask, cancelWait := taskListener.Wait(userId)
+			defer cancelWait()
+
+			tasks, err := store.TasksForProbe(c.Request.Context(), userId, cursor)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			if len(tasks) == 0 && wait > 0 {
+				select {
+				case <-newTask:
+					tasks, err = store.TasksForProbe(c.Request.Context(), userId, cursor)
+					if err != nil {
+						c.JSON(http.StatusInternalServerError,
+								gin.H{"error": "server side error"})
+						return
+					}
+				case <-time.After(time.Duration(wait) * time.Second):
+				case <-c.Request.Context().Done():
+					return
+				}
+			}
+			if err = signTasks(taskSigner, userId, tasks); err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			var taskIDs []string
+			for _, t := range tasks {
+				if cursor.After(t.CreationTime, t.Id) {
+					cursor = TaskCursor{Time: t.CreationTime, Id: t.Id}
+				}
+				taskIDs = append(taskIDs, t.Id)
+			}
+			// The probe knows about them now even if the push hasn't arrived
+			store.MarkTasksNotified(c.Request.Context(), taskIDs)
+			resp := gin.H{"tasks": tasks, "cursor": cursor.String()}
+			// Idle probes poll often, so avoid shipping them the same
+			// list over and over again.
+			etag, err := ContentETag(resp)
+			if err == nil {
+				c.Header("ETag", etag)
+				if ETagMatches(c.Request.Header.Get("If-None-Match"), etag) {
+					c.AbortWithStatus(http.StatusNotModified)
+					return
+				}
+			}
+			c.JSON(http.StatusOK, resp)
+		})
+		// Pushes the changes to the tasks of the probe as server-sent
+		// events, instead of having it poll for them
+		device.GET("/tasks/stream", tasksByIP, tasksByIdentity, tasksRead, func(c *gin.Context) {
+			userId := c.MustGet("userID").(string)
+			events, cancelEvents := taskListener.Subscribe(userId)
+			defer cancelEvents()
+
+			heartbeat := time.NewTicker(viper.GetDuration("api.stream-heartbeat"))
+			defer heartbeat.Stop()
+			c.Header("Cache-Control", "no-cache")
+			c.Stream(func(w io.Writer) bool {
+				select {
+				case ev := <-events:
+					switch {
+					case ev.ProbeId == "":
+						// The listener reconnected, the probe should
+						// fetch its task list again
+						c.SSEvent("resync", gin.H{})
+					case ev.TaskId == "":
+						c.SSEvent("new_tasks", gin.H{})
+					default:
+						c.SSEvent("task_state", ev)
+					}
+				case <-heartbeat.C:
+					io.WriteString(w, ": heartbeat\n\n")
+				case <-c.Request.Context().Done():
+					return false
+				}
+				return true
+			})
+		})
+
+		device.GET("/tasks/history", tasksRead, func(c *gin.Context) {
+			userId := c.MustGet("userID").(string)
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+			if err != nil || limit <= 0 || limit > 100 {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid limit specified"})
+				return
+			}
+			offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+			if err != nil || offset < 0 {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid offset specified"})
+				return
+			}
+			tasks, total, err := store.TaskHistory(c.Request.Context(), userId,
+													limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"tasks": tasks,
+						"total": total,
+						"limit": limit,
+						"offset": offset})
+		})
+
+		device.POST("/tasks/accept", tasksWrite, batchTaskStateHandler(taskstate.Accepted, anomalies, store))
+		device.POST("/tasks/done", tasksWrite, batchTaskStateHandler(taskstate.Done, anomalies, store))
+
+		device.GET("/task/:task_id", tasksRead, func(c *gin.Context) {
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			task, err := GetTask(c.Request.Context(), taskID, userId, store)
+			if err != nil {
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					// XXX is it a concern that a user this way can enumerate
+					// tasks of other users?
+					// I don't think it's a security issue, but it's worth
+					// thinking about...
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			tasks := []Task{task}
+			if err = signTasks(taskSigner, userId, tasks); err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			resp := gin.H{"id": task.Id,
+						"test_name": task.TestName,
+						"arguments": task.Arguments}
+			if tasks[0].Signed != nil {
+				resp["signed"] = tasks[0].Signed
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		})
+		device.POST("/task/:task_id/accept", tasksWrite, Idempotent(store), func(c *gin.Context) {
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			err := SetTaskState(c.Request.Context(), taskID,
+								userId,
+								taskstate.Accepted,
+								store)
+			if err == nil {
+				anomalies.ObserveDecision(userId, true, time.Now())
+			}
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task already accepted"})
+					return
 				}
 				if err == ErrAccessDenied {
 					c.JSON(http.StatusUnauthorized,
@@ -609,21 +1354,409 @@ func Start() {
 							gin.H{"error": "task not found"})
 					return
 				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "accepted"})
+			return
+		})
+		device.POST("/task/:task_id/reject", tasksWrite, Idempotent(store), func(c *gin.Context) {
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			err := SetTaskState(c.Request.Context(), taskID,
+								userId,
+								taskstate.Rejected,
+								store)
+			if err == nil {
+				anomalies.ObserveDecision(userId, false, time.Now())
+			}
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task already done"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "rejected"})
+			return
+		})
+		device.POST("/task/:task_id/done", tasksWrite, Idempotent(store), func(c *gin.Context) {
+			var doneReq TaskDoneReq
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			// The body is optional as older clients don't send one
+			if c.Request.ContentLength != 0 {
+				err := c.BindJSON(&doneReq)
+				if err != nil {
+					ctx.WithError(err).Error("invalid request")
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid request"})
+					return
+				}
+			}
+			err := SetTaskState(c.Request.Context(), taskID,
+								userId,
+								taskstate.Done,
+								store)
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task already done"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			if len(doneReq.ReportIds) > 0 || len(doneReq.MeasurementUids) > 0 {
+				err = store.SetTaskMeasurements(c.Request.Context(), taskID, doneReq)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+					return
+				}
 			}
 			c.JSON(http.StatusOK,
 					gin.H{"status": "done"})
 			return
 		})
+		// Moves a task to any of the states probes are allowed to set in
+		// the task-transitions policy.
+		device.POST("/task/:task_id/state", tasksWrite, func(c *gin.Context) {
+			var stateReq TaskStateReq
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			err := c.BindJSON(&stateReq)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			state, err := taskstate.Parse(stateReq.State)
+			if err != nil || taskstate.IsInternal(state) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid state"})
+				return
+			}
+			err = SetTaskState(c.Request.Context(), taskID, userId,
+								state, store)
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "inconsistent state"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": state})
+		})
+		device.POST("/task/:task_id/heartbeat", tasksWrite, func(c *gin.Context) {
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			expiresAt, err := RenewTaskLease(c.Request.Context(), taskID,
+												userId, store)
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task is not accepted"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"lease_expires_at": expiresAt})
+			return
+		})
+		device.POST("/task/:task_id/error", tasksWrite, func(c *gin.Context) {
+			var taskError TaskError
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			err := c.BindJSON(&taskError)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			errorID, err := AddTaskError(c.Request.Context(), taskID, userId,
+											taskError, store)
+			if err != nil {
+				if err == ErrInconsistentState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task already done"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"id": errorID})
+			return
+		})
+		device.POST("/task/:task_id/result", tasksWrite, func(c *gin.Context) {
+			var taskResult TaskResult
+			taskID := c.Param("task_id")
+			userId := c.MustGet("userID").(string)
+			err := c.BindJSON(&taskResult)
+			if err != nil {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			resultID, err := AddTaskResult(c.Request.Context(), taskID, userId,
+												taskResult, store)
+			if err != nil {
+				if err == ErrInvalidResultState {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "task is not accepted"})
+					return
+				}
+				if err == ErrAccessDenied {
+					c.JSON(http.StatusUnauthorized,
+							gin.H{"error": "access denied"})
+					return
+				}
+				if err == ErrTaskNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": "task not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"id": resultID})
+			return
+		})
+	}
+	return router
+}
+
+func Start() {
+	err := secrets.Load()
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to load the secrets from vault")
+		return
+	}
+
+	err = checkStoreDriver()
+	if (err != nil) {
+		ctx.WithError(err).Errorf("can't keep the jobs in %s",
+									viper.GetString("database.driver"))
+		return
+	}
+
+	var transitionsCfg map[string]taskstate.TransitionConfig
+	err = viper.UnmarshalKey("task-transitions", &transitionsCfg)
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid task-transitions configuration")
+		return
+	}
+	err = taskstate.Configure(transitionsCfg)
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid task-transitions configuration")
+		return
+	}
+
+	var (
+		db *sqlx.DB
+		backend Store
+		taskListener *TaskListener
+	)
+	useSQLite := viper.GetString("database.driver") == "sqlite3"
+	if useSQLite {
+		// The probes and the credentials are kept in sqlite too, there is
+		// no postgres to partition the tasks of nor to check the schema of
+		db, err = OpenSQLiteDatabase(viper.GetString("database.sqlite-path"))
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to open the sqlite database")
+			return
+		}
+		defer db.Close()
+		backend = NewSQLiteStore(db)
+		// Without the trigger of the tasks table nothing wakes up the
+		// probes waiting for their tasks: they get them on their next poll.
+		taskListener = NewLocalTaskListener()
+		ctx.Info("keeping everything in sqlite, the probes poll for their tasks")
+	} else {
+		db, err = initDatabase()
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to connect to DB")
+			return
+		}
+		defer db.Close()
+
+		err = runMigrations(db)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to run DB migration")
+			return
+		}
+		err = CreateTaskPartitions(db)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to create the task partitions")
+			return
+		}
+		// The transitions name the columns they record their time in
+		err = verifySchema(db)
+		if (err != nil) {
+			ctx.WithError(err).Error("refusing to start")
+			return
+		}
+
+		pgStore := NewPostgresStore(db)
+		replica, err := initReplica()
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to open the read replica")
+			return
+		}
+		if replica != nil {
+			defer replica.Close()
+			pgStore.UseReplica(replica)
+		}
+		backend = pgStore
+		taskListener = NewTaskListener(viper.GetString("database.url"))
+	}
+
+	authMiddleware, err := proteus_mw.InitAuthMiddleware(db)
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to initialise the auth middleware, refusing to start")
+		return
+	}
+	adminAllowlist, err := proteus_mw.IPAllowlistFromConfig("admin")
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid admin allowlist, refusing to start")
+		return
+	}
+	internalAllowlist, err := proteus_mw.IPAllowlistFromConfig("internal")
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid internal allowlist, refusing to start")
+		return
+	}
+
+	err = loadArgumentSchemas()
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to load the task argument schemas")
+		return
+	}
+
+	store := NewRetryStore(backend)
+	scheduler := NewScheduler(store)
+
+	err = taskListener.Start()
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to start task listener")
+		return
+	}
+	defer taskListener.Close()
+
+	taskSigner, err := tasksign.SignerFromConfig()
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid tasks.signing-key")
+		return
+	}
+
+	corsConfig, err := proteus_mw.CorsConfig()
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid cors configuration, refusing to start")
+		return
 	}
 
+	anomalies := anomaly.DetectorFromConfig(db)
+
+	router := setupRouter(store, scheduler, taskListener, taskSigner,
+							anomalies, authMiddleware, adminAllowlist,
+							internalAllowlist, corsConfig)
+
 	Addr := fmt.Sprintf("%s:%d", viper.GetString("api.address"),
 								viper.GetInt("api.port"))
 	ctx.Infof("starting on %s", Addr)
 
 	scheduler.Start()
-	s := &http.Server{
-		Addr: Addr,
-		Handler: router,
+	go SweepTaskLeases(store, viper.GetDuration("core.lease-sweep-interval"))
+	if !useSQLite {
+		go RunPartitionMaintainer(db, viper.GetDuration("core.partition-interval"))
+	}
+	go RunStaleDeviceReaper(store, viper.GetDuration("core.stale-device-interval"),
+							viper.GetDuration("core.stale-device-after"))
+	go RunAlertPublisher(store, viper.GetDuration("core.alert-publish-interval"))
+	go RunOutboxRelay(store, viper.GetDuration("outbox.poll-interval"))
+	go RunWebhookRelay(store, viper.GetDuration("webhooks.poll-interval"))
+	go RunDataPurger(store, viper.GetDuration("core.data-purge-interval"),
+						viper.GetDuration("privacy.deletion-grace-period"))
+	go RunIdempotencyKeyReaper(store, viper.GetDuration("core.idempotency-key-ttl"))
+	go RunTaskReaper(store, viper.GetDuration("core.task-reaper-interval"),
+						viper.GetDuration("core.task-retention"))
+	go RunJobPurger(store, viper.GetDuration("core.job-purge-interval"),
+					viper.GetDuration("core.deleted-job-retention"))
+	servers, err := autotls.Servers(Addr, router)
+	if err != nil {
+		ctx.WithError(err).Error("failed to set up TLS")
+		return
 	}
-	gracehttp.Serve(s)
+	gracehttp.Serve(servers...)
 }
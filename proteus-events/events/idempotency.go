@@ -0,0 +1,247 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"github.com/gin-gonic/gin"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// recordingWriter keeps a copy of the response body so that it can be
+// replayed for retried requests.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body	bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+type storedResponse struct {
+	RequestPath	string
+	// NULL for the keys stored before the requests were hashed
+	RequestHash	sql.NullString
+	// NULL while the first request with the key is being handled
+	StatusCode	sql.NullInt64
+	Body		[]byte
+}
+
+// requestHash identifies the request a key was first used for
+func requestHash(method string, path string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method + "\n" + path + "\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveKey claims the key for the request before it is handled, it returns
+// false when the key was already used.
+func reserveKey(cx context.Context, probeID string, key string, path string,
+				hash string, db *sqlx.DB) (bool, error) {
+	var reserved string
+	query := fmt.Sprintf(`INSERT INTO %s (
+		probe_id, key,
+		request_path,
+		request_hash,
+		creation_time
+	) VALUES (
+		$1, $2,
+		$3,
+		$4,
+		$5)
+	ON CONFLICT DO NOTHING
+	RETURNING key`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	err := db.QueryRowContext(cx, query, probeID, key,
+								path,
+								hash,
+								time.Now().UTC()).Scan(&reserved)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		ctx.WithError(err).Error("failed to reserve idempotency key")
+		return false, err
+	}
+	return true, nil
+}
+
+func getStoredResponse(cx context.Context, probeID string, key string,
+						db *sqlx.DB) (*storedResponse, error) {
+	var sr storedResponse
+	query := fmt.Sprintf(`SELECT
+		request_path, request_hash, status_code, response
+		FROM %s
+		WHERE probe_id = $1 AND key = $2`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	err := db.QueryRowContext(cx, query, probeID, key).Scan(&sr.RequestPath,
+															&sr.RequestHash,
+															&sr.StatusCode,
+															&sr.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		ctx.WithError(err).Error("failed to lookup idempotency key")
+		return nil, err
+	}
+	return &sr, nil
+}
+
+func storeResponse(cx context.Context, probeID string, key string,
+					statusCode int, body []byte, db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s
+		SET status_code = $3, response = $4
+		WHERE probe_id = $1 AND key = $2`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	_, err := db.ExecContext(cx, query, probeID, key, statusCode, body)
+	if err != nil {
+		ctx.WithError(err).Error("failed to store idempotency key")
+	}
+	return err
+}
+
+// releaseKey frees a reserved key so that the request can be retried
+func releaseKey(cx context.Context, probeID string, key string,
+				db *sqlx.DB) error {
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE probe_id = $1 AND key = $2 AND status_code IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	_, err := db.ExecContext(cx, query, probeID, key)
+	if err != nil {
+		ctx.WithError(err).Error("failed to release idempotency key")
+	}
+	return err
+}
+
+// Idempotent makes a device endpoint honour the Idempotency-Key header: the
+// key is reserved before the handler runs, and its response is stored and
+// replayed for retries of the same request instead of running the handler
+// again. A key reused for another request is refused with a 422, and a
+// retry while the first request is still being handled with a 409.
+func Idempotent(tasks TaskStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		userId := c.MustGet("userID").(string)
+		path := c.Request.URL.Path
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": "invalid request"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := requestHash(c.Request.Method, path, body)
+
+		reserved, err := tasks.ReserveIdempotencyKey(c.Request.Context(), userId,
+													key, path, hash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "server side error"})
+			c.Abort()
+			return
+		}
+		if !reserved {
+			sr, err := tasks.IdempotentResponse(c.Request.Context(), userId, key)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				c.Abort()
+				return
+			}
+			if sr == nil {
+				// Released or reaped in the meantime
+				c.JSON(http.StatusConflict,
+						gin.H{"error": "idempotency key in use, retry"})
+				c.Abort()
+				return
+			}
+			if sr.RequestPath != path ||
+					(sr.RequestHash.Valid && sr.RequestHash.String != hash) {
+				c.JSON(http.StatusUnprocessableEntity,
+						gin.H{"error": "idempotency key already used for another request"})
+				c.Abort()
+				return
+			}
+			if !sr.StatusCode.Valid {
+				c.JSON(http.StatusConflict,
+						gin.H{"error": "idempotency key in use, retry"})
+				c.Abort()
+				return
+			}
+			c.Data(int(sr.StatusCode.Int64), "application/json; charset=utf-8", sr.Body)
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// The client may be gone by now, a key left reserved would answer
+		// its retries with a 409 until it's reaped
+		cx, cancel := queryContext(context.Background())
+		defer cancel()
+		// Server side errors are worth retrying for real
+		if w.Status() >= 500 {
+			err = tasks.ReleaseIdempotencyKey(cx, userId, key)
+			if err != nil {
+				ctx.WithError(err).Errorf("idempotency key %s of %s left reserved",
+											key, userId)
+			}
+			return
+		}
+		err = tasks.StoreIdempotentResponse(cx, userId, key, w.Status(),
+											w.body.Bytes())
+		if err != nil {
+			ctx.WithError(err).Errorf("response to idempotency key %s of %s lost",
+										key, userId)
+		}
+	}
+}
+
+// ReapIdempotencyKeys deletes the keys older than ttl, after which a retry
+// is no longer recognised as such.
+func ReapIdempotencyKeys(cx context.Context, ttl time.Duration,
+						db *sqlx.DB) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE creation_time < $1`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	res, err := db.ExecContext(cx, query, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		ctx.WithError(err).Error("failed to reap idempotency keys")
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func RunIdempotencyKeyReaper(tasks TaskStore, ttl time.Duration) {
+	for range time.Tick(ttl / 4) {
+		tasks.ReapIdempotencyKeys(context.Background(), ttl)
+	}
+}
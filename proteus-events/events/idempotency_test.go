@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestRequestHash(t *testing.T) {
+	hash := requestHash("POST", "/api/v1/task/1/done", []byte(`{"a":1}`))
+	if hash != requestHash("POST", "/api/v1/task/1/done", []byte(`{"a":1}`)) {
+		t.Error("expected the same request to have the same hash")
+	}
+	others := []string{
+		requestHash("POST", "/api/v1/task/1/done", []byte(`{"a":2}`)),
+		requestHash("POST", "/api/v1/task/2/done", []byte(`{"a":1}`)),
+		requestHash("PUT", "/api/v1/task/1/done", []byte(`{"a":1}`)),
+	}
+	for i, other := range others {
+		if other == hash {
+			t.Errorf("expected request %d to have another hash", i)
+		}
+	}
+}
+
+// idempotentRouter serves POST /done through Idempotent, answering with
+// the code and body the test sets. The request of the probe is passed to
+// the handler so that it can hang up.
+func idempotentRouter(store TaskStore, code *int, calls *int,
+						hangUp *context.CancelFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/done", func(c *gin.Context) {
+		c.Set("userID", "p")
+	}, Idempotent(store), func(c *gin.Context) {
+		*calls++
+		if *hangUp != nil {
+			(*hangUp)()
+		}
+		c.JSON(*code, gin.H{"calls": *calls})
+	})
+	return router
+}
+
+func postIdempotent(router *gin.Engine, cx context.Context, key string,
+					body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/done", strings.NewReader(body))
+	req = req.WithContext(cx)
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotent(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	var (
+		code = http.StatusOK
+		calls = 0
+		hangUp context.CancelFunc
+	)
+	router := idempotentRouter(store, &code, &calls, &hangUp)
+
+	w := postIdempotent(router, bg, "k1", `{"a":1}`)
+	if w.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("expected the request to be handled (got: %d, %d calls)", w.Code, calls)
+	}
+	// The retry is answered with the stored response
+	replay := postIdempotent(router, bg, "k1", `{"a":1}`)
+	if replay.Code != http.StatusOK || calls != 1 ||
+			replay.Body.String() != w.Body.String() {
+		t.Errorf("expected the response to be replayed (got: %d, %s, %d calls)",
+					replay.Code, replay.Body.String(), calls)
+	}
+	if w = postIdempotent(router, bg, "k1", `{"a":2}`);
+			w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected the key of another request to be refused (got: %d)", w.Code)
+	}
+
+	// Still being handled
+	store.ReserveIdempotencyKey(bg, "p", "k2", "/done",
+								requestHash("POST", "/done", []byte(`{}`)))
+	if w = postIdempotent(router, bg, "k2", `{}`); w.Code != http.StatusConflict {
+		t.Errorf("expected the request in flight to be a conflict (got: %d)", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("expected the handler not to run again (got: %d calls)", calls)
+	}
+}
+
+func TestIdempotentHangUp(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	var (
+		code = http.StatusOK
+		calls = 0
+		hangUp context.CancelFunc
+	)
+	router := idempotentRouter(store, &code, &calls, &hangUp)
+
+	// The probe is gone by the time the task is done
+	cx, cancel := context.WithCancel(bg)
+	hangUp = cancel
+	postIdempotent(router, cx, "k1", `{}`)
+	sr, err := store.IdempotentResponse(bg, "p", "k1")
+	if err != nil || sr == nil || sr.StatusCode.Int64 != http.StatusOK {
+		t.Fatalf("expected the response to be stored (got: %+v, %v)", sr, err)
+	}
+	hangUp = nil
+	if w := postIdempotent(router, bg, "k1", `{}`); w.Code != http.StatusOK ||
+			calls != 1 {
+		t.Errorf("expected the retry to be replayed (got: %d, %d calls)", w.Code, calls)
+	}
+
+	// The server failed and the probe hung up, the key is free to retry
+	code = http.StatusInternalServerError
+	cx, cancel = context.WithCancel(bg)
+	hangUp = cancel
+	postIdempotent(router, cx, "k2", `{}`)
+	if sr, _ = store.IdempotentResponse(bg, "p", "k2"); sr != nil {
+		t.Errorf("expected the key to be released (got: %+v)", sr)
+	}
+	hangUp = nil
+	code = http.StatusOK
+	if w := postIdempotent(router, bg, "k2", `{}`); w.Code != http.StatusOK ||
+			calls != 3 {
+		t.Errorf("expected the retry to be handled (got: %d, %d calls)", w.Code, calls)
+	}
+}
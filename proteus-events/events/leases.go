@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// RenewTaskLease extends the lease the probe holds on an accepted task
+func RenewTaskLease(cx context.Context, tID string, uID string,
+					tasks TaskStore) (time.Time, error) {
+	task, err := GetTask(cx, tID, uID, tasks)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if task.State != taskstate.Accepted {
+		return time.Time{}, ErrInconsistentState
+	}
+
+	expiresAt := time.Now().UTC().Add(viper.GetDuration("core.task-lease"))
+	if err = tasks.SetTaskLease(cx, tID, expiresAt); err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+func setTaskLease(cx context.Context, tID string, expiresAt time.Time,
+					db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s SET
+		lease_expires_at = $2,
+		last_updated = $3
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	_, err := db.ExecContext(cx, query, tID, expiresAt, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to renew task lease")
+	}
+	return err
+}
+
+// ExpireTaskLeases returns accepted tasks whose lease has not been renewed
+// in time to the ready state, so that the probe can pick them up again. It
+// returns the tasks it moved.
+func ExpireTaskLeases(cx context.Context, db *sqlx.DB) ([]Task, error) {
+	var rows []taskRow
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $1,
+		accept_time = NULL,
+		lease_expires_at = NULL,
+		last_updated = $2
+		WHERE state = $3 AND lease_expires_at < $2
+		RETURNING %s`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+		webhookTaskColumns)
+	err := db.SelectContext(cx, &rows, query,
+						string(taskstate.Ready),
+						now,
+						string(taskstate.Accepted))
+	if err != nil {
+		ctx.WithError(err).Error("failed to expire task leases")
+		return nil, err
+	}
+	return taskRows(rows)
+}
+
+func SweepTaskLeases(store Store, interval time.Duration) {
+	for range time.Tick(interval) {
+		tasks, err := store.ExpireTaskLeases(context.Background())
+		if err != nil {
+			continue
+		}
+		if len(tasks) > 0 {
+			ctx.Infof("returned %d tasks with expired leases to ready", len(tasks))
+		}
+		FireTaskWebhooks(tasks, WebhookTaskState, store)
+	}
+}
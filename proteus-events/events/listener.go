@@ -0,0 +1,216 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/lib/pq"
+)
+
+// NewTaskChannel is the postgres channel on which the tasks table trigger
+// announces the probe_id of newly created tasks.
+const NewTaskChannel = "proteus_new_task"
+
+// TaskStateChannel is the postgres channel on which the tasks table trigger
+// announces the tasks changing state, as a TaskEvent.
+const TaskStateChannel = "proteus_task_state"
+
+// TaskEvent tells a subscriber about the tasks of its probe. The events of
+// new tasks only carry the probe, which has to fetch its task list, and the
+// ones without a probe tell that some events may have been missed.
+type TaskEvent struct {
+	TaskId	string `json:"task_id,omitempty"`
+	ProbeId	string `json:"probe_id,omitempty"`
+	State	taskstate.State `json:"state"`
+}
+
+// How many events a subscriber can be behind before they are dropped
+const subscriberBacklog = 16
+
+// TaskListener wakes up requests waiting for new tasks for a probe, and
+// pushes the changes to the tasks of a probe to its subscribers. As every
+// instance listens, the changes made through one of them reach the probes
+// connected to the others.
+type TaskListener struct {
+	listener	*pq.Listener
+
+	lock		sync.Mutex
+	waiters		map[string][]chan struct{}
+	subscribers	map[string][]chan TaskEvent
+}
+
+func NewTaskListener(dbUrl string) *TaskListener {
+	tl := &TaskListener{
+		waiters: make(map[string][]chan struct{}),
+		subscribers: make(map[string][]chan TaskEvent),
+	}
+	tl.listener = pq.NewListener(dbUrl,
+								10 * time.Second,
+								time.Minute,
+								func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			ctx.WithError(err).Error("task listener error")
+		}
+	})
+	return tl
+}
+
+// NewLocalTaskListener returns a TaskListener without a database to listen
+// to, for the SQLiteStore: the probes get their tasks on their next poll.
+func NewLocalTaskListener() *TaskListener {
+	return &TaskListener{
+		waiters: make(map[string][]chan struct{}),
+		subscribers: make(map[string][]chan TaskEvent),
+	}
+}
+
+func (tl *TaskListener) Start() error {
+	if tl.listener == nil {
+		return nil
+	}
+	err := tl.listener.Listen(NewTaskChannel)
+	if err != nil {
+		ctx.WithError(err).Error("failed to listen for new tasks")
+		return err
+	}
+	err = tl.listener.Listen(TaskStateChannel)
+	if err != nil {
+		ctx.WithError(err).Error("failed to listen for task states")
+		return err
+	}
+	go tl.run()
+	return nil
+}
+
+func (tl *TaskListener) run() {
+	for n := range tl.listener.Notify {
+		// A nil notification means the connection was re-established and
+		// we may have missed something, so we wake up everybody.
+		if n == nil {
+			tl.wakeAll()
+			tl.publishAll(TaskEvent{})
+			continue
+		}
+		switch n.Channel {
+		case NewTaskChannel:
+			tl.wake(n.Extra)
+			tl.publish(TaskEvent{ProbeId: n.Extra, State: taskstate.Ready})
+		case TaskStateChannel:
+			var ev TaskEvent
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				ctx.WithError(err).Error("invalid task state notification")
+				continue
+			}
+			tl.publish(ev)
+		}
+	}
+}
+
+// publish hands the event to the subscribers of its probe, skipping the
+// ones too far behind rather than holding up the others.
+func (tl *TaskListener) publish(ev TaskEvent) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	for _, ch := range tl.subscribers[ev.ProbeId] {
+		select {
+		case ch <- ev:
+		default:
+			ctx.Warnf("dropping task event for %s", ev.ProbeId)
+		}
+	}
+}
+
+func (tl *TaskListener) publishAll(ev TaskEvent) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	for _, chs := range tl.subscribers {
+		for _, ch := range chs {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
+
+func (tl *TaskListener) wake(probeID string) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	for _, ch := range tl.waiters[probeID] {
+		close(ch)
+	}
+	delete(tl.waiters, probeID)
+}
+
+func (tl *TaskListener) wakeAll() {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	for probeID, chs := range tl.waiters {
+		for _, ch := range chs {
+			close(ch)
+		}
+		delete(tl.waiters, probeID)
+	}
+}
+
+// Wait returns a channel that is closed when a new task is created for
+// probeID. The caller must call the returned cancel function once it is no
+// longer interested.
+func (tl *TaskListener) Wait(probeID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	tl.lock.Lock()
+	tl.waiters[probeID] = append(tl.waiters[probeID], ch)
+	tl.lock.Unlock()
+
+	cancel := func() {
+		tl.lock.Lock()
+		defer tl.lock.Unlock()
+		chs := tl.waiters[probeID]
+		for i, c := range chs {
+			if c == ch {
+				tl.waiters[probeID] = append(chs[:i], chs[i+1:]...)
+				break
+			}
+		}
+		if len(tl.waiters[probeID]) == 0 {
+			delete(tl.waiters, probeID)
+		}
+	}
+	return ch, cancel
+}
+
+// Subscribe returns a channel receiving the events of the tasks of probeID.
+// The caller must call the returned cancel function once it is no longer
+// interested.
+func (tl *TaskListener) Subscribe(probeID string) (<-chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, subscriberBacklog)
+	tl.lock.Lock()
+	tl.subscribers[probeID] = append(tl.subscribers[probeID], ch)
+	tl.lock.Unlock()
+
+	cancel := func() {
+		tl.lock.Lock()
+		defer tl.lock.Unlock()
+		chs := tl.subscribers[probeID]
+		for i, c := range chs {
+			if c == ch {
+				tl.subscribers[probeID] = append(chs[:i], chs[i+1:]...)
+				break
+			}
+		}
+		if len(tl.subscribers[probeID]) == 0 {
+			delete(tl.subscribers, probeID)
+		}
+	}
+	return ch, cancel
+}
+
+func (tl *TaskListener) Close() error {
+	if tl.listener == nil {
+		return nil
+	}
+	return tl.listener.Close()
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+)
+
+func TestTaskListenerSubscribe(t *testing.T) {
+	tl := &TaskListener{
+		waiters: make(map[string][]chan struct{}),
+		subscribers: make(map[string][]chan TaskEvent),
+	}
+	events, cancel := tl.Subscribe("probe")
+	others, cancelOthers := tl.Subscribe("other")
+	defer cancelOthers()
+
+	tl.publish(TaskEvent{TaskId: "task", ProbeId: "probe", State: taskstate.Cancelled})
+	select {
+	case ev := <-events:
+		if ev.TaskId != "task" || ev.State != taskstate.Cancelled {
+			t.Errorf("unexpected event %#v", ev)
+		}
+	default:
+		t.Fatal("expected the subscriber to get the event")
+	}
+	select {
+	case ev := <-others:
+		t.Errorf("expected the other probe not to get the event (got: %#v)", ev)
+	default:
+	}
+
+	// A subscriber too far behind doesn't hold up the listener
+	for i := 0; i < subscriberBacklog + 1; i++ {
+		tl.publish(TaskEvent{ProbeId: "probe"})
+	}
+	if len(events) != subscriberBacklog {
+		t.Errorf("expected %d pending events (got: %d)", subscriberBacklog, len(events))
+	}
+
+	cancel()
+	if _, ok := tl.subscribers["probe"]; ok {
+		t.Error("expected the subscription to be cancelled")
+	}
+}
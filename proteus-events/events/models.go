@@ -0,0 +1,195 @@
+package events
+
+import (
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+// The rows read by the PostgresStore are scanned by sqlx into the structs
+// below, matching the columns of the queries by name with their db tags
+// rather than by position. A column the struct has no field for is an
+// error, which is why the queries name their computed columns with AS.
+
+// targetRow holds the targetColumns of the jobs table
+type targetRow struct {
+	Countries			pq.StringArray `db:"target_countries"`
+	Platforms			pq.StringArray `db:"target_platforms"`
+	Version				string `db:"target_version"`
+	Languages			pq.StringArray `db:"target_languages"`
+	SampleRate			float64 `db:"target_sample_rate"`
+	ProbeIds			pq.StringArray `db:"target_probe_ids"`
+	ExcludeProbeIds		pq.StringArray `db:"target_exclude_probe_ids"`
+	Tags				pq.StringArray `db:"target_tags"`
+	ExcludeCountries	pq.StringArray `db:"target_exclude_countries"`
+	ExcludePlatforms	pq.StringArray `db:"target_exclude_platforms"`
+	ActiveWithin		string `db:"target_active_within"`
+	Regions				pq.StringArray `db:"target_regions"`
+	Expression			string `db:"target_expression"`
+	Segment				string `db:"target_segment"`
+	Mode				string `db:"target_mode"`
+	CoverageWindow		string `db:"target_coverage_window"`
+	CoverageCells		int64 `db:"target_coverage_cells"`
+	Cohort				string `db:"target_cohort"`
+	ProbeCohorts		pq.StringArray `db:"target_probe_cohorts"`
+}
+
+func (r targetRow) target() Target {
+	return Target{
+		Countries: r.Countries,
+		Platforms: r.Platforms,
+		ExcludeCountries: r.ExcludeCountries,
+		ExcludePlatforms: r.ExcludePlatforms,
+		Version: r.Version,
+		Languages: r.Languages,
+		SampleRate: r.SampleRate,
+		ProbeIds: r.ProbeIds,
+		ExcludeProbeIds: r.ExcludeProbeIds,
+		Tags: r.Tags,
+		ActiveWithin: r.ActiveWithin,
+		Regions: r.Regions,
+		Expression: r.Expression,
+		Segment: r.Segment,
+		Mode: r.Mode,
+		CoverageWindow: r.CoverageWindow,
+		CoverageCells: r.CoverageCells,
+		Cohort: r.Cohort,
+		ProbeCohorts: r.ProbeCohorts,
+	}
+}
+
+// jobRow is a row of the jobs table, GetJob only reads some of its columns
+type jobRow struct {
+	Id					string `db:"id"`
+	Comment				string `db:"comment"`
+	CreationTime		time.Time `db:"creation_time"`
+	Schedule			string `db:"schedule"`
+	Delay				int64 `db:"delay"`
+	TaskTestName		string `db:"task_test_name"`
+	TaskArguments		types.JSONText `db:"task_arguments"`
+	State				string `db:"state"`
+	Priority			int64 `db:"priority"`
+	WebhookURL			string `db:"webhook_url"`
+	WebhookSecret		string `db:"webhook_secret"`
+	DryRun				bool `db:"dry_run"`
+	Notification		string `db:"notification"`
+	NotificationWindow	string `db:"notification_window"`
+	CreatedBy			string `db:"created_by"`
+	SharedWith			pq.StringArray `db:"shared_with"`
+	TimesRun			int64 `db:"times_run"`
+	NextRunAt			string `db:"next_run_at"`
+	IsDone				bool `db:"is_done"`
+	DeletedAt			*time.Time `db:"deleted_at"`
+	targetRow
+}
+
+// job returns what the scheduler needs of the job
+func (r jobRow) job() (*Job, error) {
+	var err error
+	j := &Job{
+		Id: r.Id,
+		Comment: r.Comment,
+		Delay: r.Delay,
+		TimesRun: r.TimesRun,
+		IsDone: r.IsDone,
+	}
+	j.NextRunAt, err = time.Parse(ISOUTCTimeLayout, r.NextRunAt)
+	if err != nil {
+		ctx.WithError(err).Error("invalid time string")
+		return nil, err
+	}
+	j.Schedule, err = ParseSchedule(r.Schedule)
+	if err != nil {
+		ctx.WithError(err).Error("invalid schedule")
+		return nil, err
+	}
+	return j, nil
+}
+
+func (r jobRow) jobData() (JobData, error) {
+	jd := JobData{
+		Id: r.Id,
+		Schedule: r.Schedule,
+		Delay: r.Delay,
+		Comment: r.Comment,
+		Priority: r.Priority,
+		WebhookURL: r.WebhookURL,
+		DryRun: r.DryRun,
+		Notification: r.Notification,
+		NotificationWindow: r.NotificationWindow,
+		Task: Task{TestName: r.TaskTestName},
+		Target: r.target(),
+		State: r.State,
+		CreatedBy: r.CreatedBy,
+		SharedWith: r.SharedWith,
+		CreationTime: r.CreationTime,
+		DeletedAt: r.DeletedAt,
+	}
+	err := r.TaskArguments.Unmarshal(&jd.Task.Arguments)
+	return jd, err
+}
+
+// taskRow is a row of the tasks table, with the priority of its job
+type taskRow struct {
+	Id				string `db:"id"`
+	ProbeId			string `db:"probe_id"`
+	JobId			string `db:"job_id"`
+	TestName		string `db:"test_name"`
+	Arguments		types.JSONText `db:"arguments"`
+	State			taskstate.State `db:"state"`
+	Priority		int64 `db:"priority"`
+	CreationTime	time.Time `db:"creation_time"`
+	LastUpdated		time.Time `db:"last_updated"`
+}
+
+func (r taskRow) task() (Task, error) {
+	t := Task{
+		Id: r.Id,
+		TestName: r.TestName,
+		State: r.State,
+		ProbeId: r.ProbeId,
+		JobId: r.JobId,
+		Priority: r.Priority,
+		CreationTime: r.CreationTime,
+	}
+	err := r.Arguments.Unmarshal(&t.Arguments)
+	return t, err
+}
+
+// taskRows converts the rows of a query returning several tasks
+func taskRows(rows []taskRow) ([]Task, error) {
+	tasks := make([]Task, 0, len(rows))
+	for _, row := range rows {
+		t, err := row.task()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+func (r taskRow) historyItem() (TaskHistoryItem, error) {
+	item := TaskHistoryItem{
+		Id: r.Id,
+		TestName: r.TestName,
+		State: r.State,
+		CreationTime: r.CreationTime,
+		LastUpdated: r.LastUpdated,
+	}
+	err := r.Arguments.Unmarshal(&item.Arguments)
+	return item, err
+}
+
+// createdTaskRow is a task looked up by createTaskChunk
+type createdTaskRow struct {
+	ProbeId		string `db:"probe_id"`
+	TaskId		string `db:"id"`
+	NeedsNotify	bool `db:"needs_notify"`
+	// Created by this attempt rather than a previous one
+	IsNew		bool `db:"is_new"`
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// columnNames returns the names of the columns of a select list, which are
+// either plain columns or aliased with AS
+func columnNames(list string) []string {
+	var names []string
+	for _, column := range strings.Split(list, ",\n") {
+		fields := strings.Fields(column)
+		names = append(names, fields[len(fields) - 1])
+	}
+	return names
+}
+
+func TestTargetColumns(t *testing.T) {
+	fields := reflectx.NewMapper("db").TypeMap(reflect.TypeOf(jobRow{}))
+	for _, name := range columnNames(targetColumns) {
+		if fields.GetByPath(name) == nil {
+			t.Errorf("no field of jobRow is scanned from %s", name)
+		}
+		if _, ok := jobsColumns[name]; !ok {
+			t.Errorf("%s isn't verified when starting", name)
+		}
+	}
+}
+
+func TestJobRow(t *testing.T) {
+	row := jobRow{
+		Id: "job",
+		TaskTestName: "web_connectivity",
+		TaskArguments: []byte(`{"urls": ["https://example.com/"]}`),
+		SharedWith: []string{"alice"},
+	}
+	row.Countries = []string{"IT"}
+	row.CoverageCells = 3
+	jd, err := row.jobData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jd.Id != "job" || jd.Task.TestName != "web_connectivity" ||
+			len(jd.SharedWith) != 1 {
+		t.Errorf("unexpected job %+v", jd)
+	}
+	if len(jd.Target.Countries) != 1 || jd.Target.CoverageCells != 3 {
+		t.Errorf("unexpected target %+v", jd.Target)
+	}
+	args, ok := jd.Task.Arguments.(map[string]interface{})
+	if !ok || len(args["urls"].([]interface{})) != 1 {
+		t.Errorf("unexpected arguments %v", jd.Task.Arguments)
+	}
+
+	row.TaskArguments = []byte(`{`)
+	if _, err = row.jobData(); err == nil {
+		t.Error("expected the invalid arguments to be an error")
+	}
+}
+
+func TestVerifiedTasksColumns(t *testing.T) {
+	defer taskstate.Configure(nil)
+	err := taskstate.Configure(map[string]taskstate.TransitionConfig{
+		"downloading_inputs": {From: []string{"accepted"},
+								TimeColumn: "download_time"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := verifiedTasksColumns()
+	for _, name := range []string{"done_time", "accept_time",
+									"notification_time", "download_time"} {
+		if columns[name] != "timestamptz" {
+			t.Errorf("expected %s to be verified (got: %q)", name, columns[name])
+		}
+	}
+	if _, ok := tasksColumns["download_time"]; ok {
+		t.Error("expected tasksColumns to be left alone")
+	}
+}
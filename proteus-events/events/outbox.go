@@ -0,0 +1,174 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// The notifications of the tasks are written to the outbox in the
+// transaction creating the tasks, and sent to proteus-notify by the relay.
+// A task is thus never left without its notification being attempted, and
+// the tasks rolled back are never announced.
+
+// A relay that crashes while sending leaves the notices claimed, they are
+// picked up again once the claim expires.
+const outboxClaimTimeout = 10 * time.Minute
+
+// Wakes up the relay when tasks were created
+var outboxWakeup = make(chan bool, 1)
+
+// outboxNotice is a notification waiting in the outbox
+type outboxNotice struct {
+	target		JobTarget
+	attempts	int
+	// The state of the task, empty when it was deleted
+	state		string
+}
+
+// wakeOutboxRelay tells the relay of this instance that notices are waiting
+func wakeOutboxRelay() {
+	select {
+	case outboxWakeup <- true:
+	default:
+	}
+}
+
+// claimNotices claims the notices due to be sent, at most limit of them
+func claimNotices(cx context.Context, limit int,
+					db *sqlx.DB) ([]outboxNotice, error) {
+	var notices []outboxNotice
+	outboxTable := pq.QuoteIdentifier(viper.GetString("database.task-outbox-table"))
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s AS o
+		SET attempts = attempts + 1, next_attempt_at = $1
+		WHERE task_id IN (
+			SELECT task_id FROM %s
+			WHERE next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING o.task_id, o.probe_id, o.notice, o.attempts,
+			(SELECT COALESCE(t.state, 'ready') FROM %s AS t
+				WHERE t.id = o.task_id)`,
+		outboxTable, outboxTable,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	rows, err := db.QueryContext(cx, query, now.Add(outboxClaimTimeout), now, limit)
+	if err != nil {
+		ctx.WithError(err).Error("failed to claim outbox notices")
+		return notices, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			n outboxNotice
+			taskID, probeID string
+			notice []byte
+			state sql.NullString
+		)
+		err = rows.Scan(&taskID, &probeID, &notice, &n.attempts, &state)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over outbox notices")
+			return notices, err
+		}
+		if err = json.Unmarshal(notice, &n.target); err != nil {
+			ctx.WithError(err).Errorf("invalid outbox notice of %s", taskID)
+		}
+		n.target.ClientID = probeID
+		n.target.TaskID = taskID
+		n.state = state.String
+		notices = append(notices, n)
+	}
+	return notices, rows.Err()
+}
+
+// removeNotice takes the notice of the task out of the outbox
+func removeNotice(cx context.Context, taskID string, db *sqlx.DB) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE task_id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table")))
+	_, err := db.ExecContext(cx, query, taskID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove outbox notice")
+	}
+	return err
+}
+
+// noticeBackoff is how long to wait after the attempts of a notice failed,
+// twice as long after every attempt up to outbox.max-backoff
+func noticeBackoff(attempts int) time.Duration {
+	backoff := viper.GetDuration("outbox.backoff")
+	maxBackoff := viper.GetDuration("outbox.max-backoff")
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// retryNotice sends the notice again after its backoff
+func retryNotice(cx context.Context, n outboxNotice, sendErr error,
+					db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s
+		SET next_attempt_at = $2, last_error = $3
+		WHERE task_id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table")))
+	_, err := db.ExecContext(cx, query, n.target.TaskID,
+					time.Now().UTC().Add(noticeBackoff(n.attempts)),
+					sendErr.Error())
+	if err != nil {
+		ctx.WithError(err).Error("failed to reschedule outbox notice")
+	}
+	return err
+}
+
+// RelayNotices sends the notices due to proteus-notify, returning how many
+// were claimed. The notices of the tasks which are no longer ready, e.g.
+// because they were cancelled or deleted, are dropped without being sent.
+func RelayNotices(tasks TaskStore) (int, error) {
+	cx := context.Background()
+	notices, err := tasks.ClaimNotices(cx, viper.GetInt("outbox.batch-size"))
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range notices {
+		if n.state != string(taskstate.Ready) {
+			tasks.RemoveNotice(cx, n.target.TaskID)
+			continue
+		}
+		ctx.Debugf("notifying %s of %s", n.target.ClientID, n.target.TaskID)
+		if err := TaskNotify(&n.target); err != nil {
+			ctx.WithError(err).Errorf("failed to notify %s of %s",
+										n.target.ClientID, n.target.TaskID)
+			tasks.RetryNotice(cx, n, err)
+			continue
+		}
+		tasks.RemoveNotice(cx, n.target.TaskID)
+	}
+	return len(notices), nil
+}
+
+// RunOutboxRelay sends the notices as soon as the tasks of this instance
+// are created, and polls for the others every interval.
+func RunOutboxRelay(tasks TaskStore, interval time.Duration) {
+	for {
+		n, err := RelayNotices(tasks)
+		if err == nil && n > 0 {
+			continue
+		}
+		select {
+		case <-outboxWakeup:
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestNoticeBackoff(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("outbox.backoff", time.Second)
+	viper.Set("outbox.max-backoff", 10 * time.Second)
+
+	tests := []struct {
+		attempts	int
+		backoff		time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if backoff := noticeBackoff(test.attempts); backoff != test.backoff {
+			t.Errorf("%d attempts: expected %s (got: %s)",
+						test.attempts, test.backoff, backoff)
+		}
+	}
+}
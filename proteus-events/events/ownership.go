@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/thetorproject/proteus/proteus-common/middleware"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// JobShareReq replaces the accounts a job is shared with
+type JobShareReq struct {
+	SharedWith	[]string `json:"shared_with"`
+}
+
+// canModifyJob tells whether the account can change a job created by owner
+// and shared with the accounts of sharedWith. Admins can change every job,
+// and are the only ones who can change the jobs created before jobs had an
+// owner.
+func canModifyJob(account proteus_mw.Account, owner string,
+					sharedWith []string) bool {
+	if proteus_mw.HasRole(account, proteus_mw.AdminRole) {
+		return true
+	}
+	if owner == "" {
+		return false
+	}
+	if account.Username == owner {
+		return true
+	}
+	for _, username := range sharedWith {
+		if account.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// getJobOwner returns the account which created the job, deleted or not,
+// and the accounts it's shared with.
+func getJobOwner(cx context.Context, jobID string,
+					db *sqlx.DB) (string, []string, error) {
+	var (
+		owner string
+		sharedWith []string
+	)
+	query := fmt.Sprintf(`SELECT COALESCE(created_by, ''), shared_with
+		FROM %s WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := db.QueryRowContext(cx, query, jobID).Scan(&owner, pq.Array(&sharedWith))
+	if err == sql.ErrNoRows {
+		return "", nil, ErrJobNotFound
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up the owner of the job")
+		return "", nil, err
+	}
+	return owner, sharedWith, nil
+}
+
+// CheckJobOwner returns ErrAccessDenied unless the account can change the
+// job, i.e. it created it, it's shared with it or it's an admin.
+func CheckJobOwner(cx context.Context, jobID string,
+					account proteus_mw.Account, jobs JobStore) error {
+	owner, sharedWith, err := jobs.JobOwner(cx, jobID)
+	if err != nil {
+		return err
+	}
+	if !canModifyJob(account, owner, sharedWith) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// CheckTaskOwner returns ErrAccessDenied unless the account can change the
+// job of the task. The tasks without a job, e.g. broadcasts, are the
+// admins' like the jobs without an owner.
+func CheckTaskOwner(cx context.Context, taskID string,
+					account proteus_mw.Account, store Store) error {
+	task, err := store.GetTask(cx, taskID)
+	if err != nil {
+		return err
+	}
+	if task.JobId == "" {
+		if !canModifyJob(account, "", nil) {
+			return ErrAccessDenied
+		}
+		return nil
+	}
+	return CheckJobOwner(cx, task.JobId, account, store)
+}
+
+// ShareJob lets the accounts change the job as well as its owner, they
+// replace the ones it was shared with so far.
+func ShareJob(cx context.Context, jobID string, sharedWith []string,
+				db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s SET shared_with = $2 WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	res, err := db.ExecContext(cx, query, jobID, pq.Array(sharedWith))
+	if err != nil {
+		ctx.WithError(err).Error("failed to share the job")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
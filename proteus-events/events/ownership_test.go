@@ -0,0 +1,67 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/thetorproject/proteus/proteus-common/middleware"
+)
+
+func TestCanModifyJob(t *testing.T) {
+	t.Parallel()
+	alice := proteus_mw.Account{Username: "alice", Role: proteus_mw.OperatorRole}
+	bob := proteus_mw.Account{Username: "bob", Role: proteus_mw.OperatorRole}
+	admin := proteus_mw.Account{Username: "carol", Role: proteus_mw.AdminRole}
+
+	for _, tc := range []struct {
+		name		string
+		account		proteus_mw.Account
+		owner		string
+		sharedWith	[]string
+		expected	bool
+	}{
+		{"owner", alice, "alice", nil, true},
+		{"other team", bob, "alice", nil, false},
+		{"shared", bob, "alice", []string{"dave", "bob"}, true},
+		{"admin", admin, "alice", nil, true},
+		{"no owner", alice, "", nil, false},
+		{"no owner admin", admin, "", nil, true},
+	} {
+		if canModifyJob(tc.account, tc.owner, tc.sharedWith) != tc.expected {
+			t.Errorf("%s: expected %v", tc.name, tc.expected)
+		}
+	}
+}
+
+func TestCheckTaskOwner(t *testing.T) {
+	alice := proteus_mw.Account{Username: "alice", Role: proteus_mw.OperatorRole}
+	bob := proteus_mw.Account{Username: "bob", Role: proteus_mw.OperatorRole}
+	admin := proteus_mw.Account{Username: "carol", Role: proteus_mw.AdminRole}
+
+	store := newMemStore()
+	store.jobs["job"] = JobData{Id: "job", CreatedBy: "alice"}
+	created, _ := store.CreateTasks(bg, "job", []string{"probe"},
+									Task{TestName: "ndt"}, 0, JobTarget{})
+	tID := created[0].TaskId
+	broadcast := store.createTask("probe", 1)
+	// Deleted jobs can still be restored by their owner
+	store.DeleteJob(bg, "job")
+
+	for _, tc := range []struct {
+		name		string
+		account		proteus_mw.Account
+		taskID		string
+		expected	error
+	}{
+		{"owner", alice, tID, nil},
+		{"other team", bob, tID, ErrAccessDenied},
+		{"admin", admin, tID, nil},
+		{"broadcast", alice, broadcast, ErrAccessDenied},
+		{"broadcast admin", admin, broadcast, nil},
+		{"missing", admin, "missing", ErrTaskNotFound},
+	} {
+		err := CheckTaskOwner(bg, tc.taskID, tc.account, store)
+		if err != tc.expected {
+			t.Errorf("%s: expected %v (got: %v)", tc.name, tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// taskPartition is the partition of the tasks table holding the tasks
+// created in a month
+type taskPartition struct {
+	Name	string
+	From	time.Time
+	To		time.Time
+}
+
+// taskPartitions returns the partitions of the month of now and of the
+// ahead months after it
+func taskPartitions(now time.Time, ahead int) []taskPartition {
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var partitions []taskPartition
+	for i := 0; i <= ahead; i++ {
+		next := month.AddDate(0, 1, 0)
+		partitions = append(partitions, taskPartition{
+			Name: fmt.Sprintf("%s_%04d_%02d",
+							viper.GetString("database.tasks-table"),
+							month.Year(), month.Month()),
+			From: month,
+			To: next,
+		})
+		month = next
+	}
+	return partitions
+}
+
+// CreateTaskPartitions makes sure the partitions of the tasks table exist
+// for this month and the database.task-partitions-ahead next ones, the
+// tasks can't be created otherwise.
+func CreateTaskPartitions(db *sqlx.DB) error {
+	const layout = "2006-01-02 15:04:05Z07:00"
+	for _, p := range taskPartitions(time.Now(),
+									viper.GetInt("database.task-partitions-ahead")) {
+		// The bounds of a partition can't be query parameters
+		query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+			PARTITION OF %s
+			FOR VALUES FROM ('%s') TO ('%s')`,
+			pq.QuoteIdentifier(p.Name),
+			pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+			p.From.Format(layout), p.To.Format(layout))
+		if _, err := db.Exec(query); err != nil {
+			ctx.WithError(err).Errorf("failed to create task partition %s", p.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+func RunPartitionMaintainer(db *sqlx.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		CreateTaskPartitions(db)
+	}
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestTaskPartitions(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.tasks-table", "tasks")
+	now := time.Date(2026, time.December, 31, 23, 0, 0, 0, time.UTC)
+
+	partitions := taskPartitions(now, 2)
+	if len(partitions) != 3 {
+		t.Fatalf("expected 3 partitions (got: %d)", len(partitions))
+	}
+	expected := []string{"tasks_2026_12", "tasks_2027_01", "tasks_2027_02"}
+	for i, p := range partitions {
+		if p.Name != expected[i] {
+			t.Errorf("expected %s (got: %s)", expected[i], p.Name)
+		}
+		if i > 0 && !p.From.Equal(partitions[i - 1].To) {
+			t.Errorf("expected %s to start where the previous one ends", p.Name)
+		}
+	}
+	if !partitions[0].From.Equal(time.Date(2026, time.December, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the first partition to start with the month (got: %s)",
+					partitions[0].From)
+	}
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/spf13/viper"
+)
+
+// DeviceDataExport is everything stored about a probe, for it to download
+type DeviceDataExport struct {
+	Device		probes.DeviceExport `json:"device"`
+	Tasks		types.JSONText `json:"tasks"`
+	Results		types.JSONText `json:"results"`
+	Errors		types.JSONText `json:"errors"`
+	Alerts		types.JSONText `json:"alerts"`
+
+	ExportTime	time.Time `json:"export_time"`
+}
+
+// ExportDeviceData gathers the data about the probe from every service
+func ExportDeviceData(cx context.Context, probeID string,
+						db *sqlx.DB) (DeviceDataExport, error) {
+	var (
+		export DeviceDataExport
+		err error
+	)
+	export.Device, err = probes.ExportDevice(db, probeID)
+	if err != nil {
+		return export, err
+	}
+
+	query := fmt.Sprintf(`SELECT
+		(SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.creation_time), '[]')
+			FROM %s AS t WHERE t.probe_id::text = $1) ||
+		(SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.creation_time), '[]')
+			FROM %s AS t WHERE t.probe_id::text = $1),
+		(SELECT COALESCE(jsonb_agg(to_jsonb(r) ORDER BY r.creation_time), '[]')
+			FROM %s AS r WHERE r.probe_id::text = $1),
+		(SELECT COALESCE(jsonb_agg(to_jsonb(e) ORDER BY e.creation_time), '[]')
+			FROM %s AS e WHERE e.probe_id::text = $1),
+		(SELECT COALESCE(jsonb_agg(jsonb_build_object(
+				'id', a.id, 'title', a.title, 'publish_at', a.publish_at,
+				'ack_time', ar.ack_time) ORDER BY a.publish_at), '[]')
+			FROM %s AS ar JOIN %s AS a ON a.id = ar.alert_id
+			WHERE ar.probe_id::text = $1)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-archive-table")),
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	err = db.QueryRowContext(cx, query, probeID).Scan(&export.Tasks, &export.Results,
+														&export.Errors, &export.Alerts)
+	if err != nil {
+		ctx.WithError(err).Error("failed to export device data")
+		return export, err
+	}
+	export.ExportTime = time.Now().UTC()
+	return export, nil
+}
+
+// The tables of the events service referring to probes by probe_id
+var probeDataTables = []string{
+	"database.task-results-table",
+	"database.task-errors-table",
+	"database.tasks-table",
+	"database.tasks-archive-table",
+	"database.idempotency-keys-table",
+	"database.alert-recipients-table",
+	"database.job-cohorts-table",
+	"database.probe-cohort-members-table",
+}
+
+// PurgeDeviceData deletes everything stored about the probe: its tasks and
+// what they produced, the notifications sent to its tokens and its
+// registration.
+func PurgeDeviceData(probeID string, db *sqlx.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	tokens, err := probes.DeviceTokens(tx, probeID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, table := range probeDataTables {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE probe_id::text = $1`,
+			pq.QuoteIdentifier(viper.GetString(table)))
+		if _, err = tx.Exec(query, probeID); err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Errorf("failed to purge device from %s",
+										viper.GetString(table))
+			return err
+		}
+	}
+	if len(tokens) > 0 {
+		// Notifications sent to other devices as well only lose the tokens
+		// of this one
+		table := pq.QuoteIdentifier(viper.GetString("database.notifications-table"))
+		query := fmt.Sprintf(`DELETE FROM %s
+			WHERE tokens && $1::VARCHAR[] AND tokens <@ $1::VARCHAR[]`, table)
+		if _, err = tx.Exec(query, pq.Array(tokens)); err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to purge device notifications")
+			return err
+		}
+		query = fmt.Sprintf(`UPDATE %s SET
+			tokens = ARRAY(SELECT unnest(tokens) EXCEPT SELECT unnest($1::VARCHAR[]))
+			WHERE tokens && $1::VARCHAR[]`, table)
+		if _, err = tx.Exec(query, pq.Array(tokens)); err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to purge device notifications")
+			return err
+		}
+	}
+	if err = probes.PurgeDevice(tx, probeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit purge")
+		return err
+	}
+	return nil
+}
+
+// PurgeDeletedDevices purges the probes whose deletion was requested more
+// than grace ago
+func PurgeDeletedDevices(grace time.Duration, db *sqlx.DB) (int, error) {
+	probeIDs, err := probes.PendingDeletions(db, time.Now().UTC().Add(-grace))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, probeID := range probeIDs {
+		if err = PurgeDeviceData(probeID, db); err != nil {
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func RunDataPurger(devices DeviceStore, interval time.Duration,
+					grace time.Duration) {
+	for range time.Tick(interval) {
+		n, err := devices.PurgeDeletedDevices(context.Background(), grace)
+		if err == nil && n > 0 {
+			ctx.Infof("purged the data of %d devices", n)
+		}
+	}
+}
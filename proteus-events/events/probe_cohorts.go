@@ -0,0 +1,215 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// ProbeCohort is a named set of probes maintained by the admins, e.g. the
+// devices of a partner deployment or a longitudinal panel. Unlike segments
+// its probes are listed one by one instead of being matched.
+type ProbeCohort struct {
+	Name			string `json:"name"`
+	Comment			string `json:"comment"`
+	Size			int64 `json:"size"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+type ProbeCohortMember struct {
+	ProbeId		string `json:"probe_id"`
+	ProbeCC		string `json:"probe_cc"`
+	Platform	string `json:"platform"`
+	AddedAt		time.Time `json:"added_at"`
+}
+
+type ProbeCohortMembersReq struct {
+	ProbeIds []string `json:"probe_ids" binding:"required"`
+}
+
+var ErrProbeCohortNotFound = errors.New("probe cohort not found")
+var ErrProbeCohortExists = errors.New("probe cohort already exists")
+var ErrProbeCohortInUse = errors.New("probe cohort is used by active jobs")
+var ErrProbeNotInCohort = errors.New("probe is not in the cohort")
+
+// CreateProbeCohort creates an empty cohort
+func CreateProbeCohort(cx context.Context, pc ProbeCohort, db *sqlx.DB) error {
+	if pc.Name == "" {
+		return errors.New("missing probe cohort name")
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (name, comment, creation_time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")))
+	res, err := db.ExecContext(cx, query, pc.Name, pc.Comment, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into probe cohorts table")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeCohortExists
+	}
+	return nil
+}
+
+// ListProbeCohorts returns every cohort with how many probes it has
+func ListProbeCohorts(cx context.Context, db *sqlx.DB) ([]ProbeCohort, error) {
+	var cohorts = make([]ProbeCohort, 0)
+	query := fmt.Sprintf(`SELECT
+		c.name, COALESCE(c.comment, ''), c.creation_time, COUNT(m.probe_id)
+		FROM %s AS c
+		LEFT JOIN %s AS m ON m.cohort_name = c.name
+		GROUP BY c.name
+		ORDER BY c.name`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")),
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	rows, err := db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list probe cohorts")
+		return cohorts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pc ProbeCohort
+		err = rows.Scan(&pc.Name, &pc.Comment, &pc.CreationTime, &pc.Size)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over probe cohorts")
+			return cohorts, err
+		}
+		cohorts = append(cohorts, pc)
+	}
+	return cohorts, rows.Err()
+}
+
+// checkProbeCohortsExist makes sure that all the cohorts were created
+func checkProbeCohortsExist(cx context.Context, names []string,
+							db *sqlx.DB) error {
+	if len(names) == 0 {
+		return nil
+	}
+	var found int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE name = ANY($1)`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")))
+	err := db.QueryRowContext(cx, query, pq.Array(names)).Scan(&found)
+	if err != nil {
+		ctx.WithError(err).Error("failed to lookup probe cohorts")
+		return err
+	}
+	unique := map[string]bool{}
+	for _, name := range names {
+		unique[name] = true
+	}
+	if found != len(unique) {
+		return ErrProbeCohortNotFound
+	}
+	return nil
+}
+
+// GetProbeCohortMembers returns the probes of the cohort, the most recently
+// added first.
+func GetProbeCohortMembers(cx context.Context, name string,
+							db *sqlx.DB) ([]ProbeCohortMember, error) {
+	var members = make([]ProbeCohortMember, 0)
+	if err := checkProbeCohortsExist(cx, []string{name}, db); err != nil {
+		return members, err
+	}
+	query := fmt.Sprintf(`SELECT
+		m.probe_id,
+		COALESCE(p.probe_cc, ''),
+		COALESCE(p.platform, ''),
+		m.added_at
+		FROM %s AS m
+		LEFT JOIN %s AS p ON p.id = m.probe_id
+		WHERE m.cohort_name = $1
+		ORDER BY m.added_at DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	rows, err := db.QueryContext(cx, query, name)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get probe cohort members")
+		return members, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m ProbeCohortMember
+		err = rows.Scan(&m.ProbeId, &m.ProbeCC, &m.Platform, &m.AddedAt)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over probe cohort members")
+			return members, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// AddProbeCohortMembers adds the probes to the cohort, returning how many
+// weren't in it already.
+func AddProbeCohortMembers(cx context.Context, name string, probeIDs []string,
+							db *sqlx.DB) (int64, error) {
+	if err := checkProbeCohortsExist(cx, []string{name}, db); err != nil {
+		return 0, err
+	}
+	if err := checkProbesExist(cx, probeIDs, db); err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (cohort_name, probe_id, added_at)
+		SELECT $1, p::UUID, $3 FROM unnest($2::VARCHAR[]) AS p
+		ON CONFLICT (cohort_name, probe_id) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	res, err := db.ExecContext(cx, query, name, pq.Array(probeIDs), time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to add probe cohort members")
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RemoveProbeCohortMember removes the probe from the cohort
+func RemoveProbeCohortMember(cx context.Context, name string, probeID string,
+								db *sqlx.DB) error {
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE cohort_name = $1 AND probe_id::text = $2`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	res, err := db.ExecContext(cx, query, name, probeID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove probe cohort member")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeNotInCohort
+	}
+	return nil
+}
+
+// DeleteProbeCohort deletes a cohort no active job targets
+func DeleteProbeCohort(cx context.Context, name string, db *sqlx.DB) error {
+	var inUse bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s
+		WHERE $1 = ANY(target_probe_cohorts) AND state = 'active')`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if err := db.QueryRowContext(cx, query, name).Scan(&inUse); err != nil {
+		ctx.WithError(err).Error("failed to check probe cohort usage")
+		return err
+	}
+	if inUse {
+		return ErrProbeCohortInUse
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %s WHERE name = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")))
+	res, err := db.ExecContext(cx, query, name)
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete probe cohort")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeCohortNotFound
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/satori/go.uuid"
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/spf13/viper"
+)
+
+// TaskResult is the summary a probe submits once it has run a task.
+type TaskResult struct {
+	Id				string `json:"id"`
+	TaskId			string `json:"task_id"`
+	ProbeId			string `json:"probe_id"`
+	ReportId		string `json:"report_id"`
+	Summary			interface{} `json:"summary" binding:"required"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+// TaskDoneReq is the optional body of the done endpoint. It allows us to
+// cross reference tasks with what ended up in the measurement pipeline.
+type TaskDoneReq struct {
+	ReportIds		[]string `json:"report_ids"`
+	MeasurementUids	[]string `json:"measurement_uids"`
+}
+
+// TaskError is a failure a probe ran into while running a task
+type TaskError struct {
+	Id				string `json:"id"`
+	TaskId			string `json:"task_id"`
+	ProbeId			string `json:"probe_id"`
+	ExceptionClass	string `json:"exception_class" binding:"required"`
+	Message			string `json:"message"`
+	AppVersion		string `json:"app_version"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+// JobStats is a summary of how the tasks of a job are doing
+type JobStats struct {
+	JobId		string `json:"job_id"`
+	Tasks		map[string]int64 `json:"tasks"`
+	Results		int64 `json:"results"`
+	// Number of errors reported by probes, by exception class
+	Errors		map[string]int64 `json:"errors"`
+	// How long it took for the probes to learn about their tasks
+	NotificationLatency	LatencyStats `json:"notification_latency"`
+}
+
+// LatencyStats summarises a set of latencies, in seconds
+type LatencyStats struct {
+	Count	int64 `json:"count"`
+	Median	float64 `json:"median"`
+	P95		float64 `json:"p95"`
+}
+
+var ErrInvalidResultState = errors.New("task is not accepted or done")
+
+// AddTaskResult stores the result the probe submitted for its task
+func AddTaskResult(cx context.Context, tID string, uID string, tr TaskResult,
+					store Store) (string, error) {
+	task, err := GetTask(cx, tID, uID, store)
+	if err != nil {
+		return "", err
+	}
+	if task.State != taskstate.Accepted && task.State != taskstate.Done {
+		return "", ErrInvalidResultState
+	}
+	tr.TaskId = tID
+	tr.ProbeId = uID
+	return store.SaveTaskResult(cx, tr)
+}
+
+func saveTaskResult(cx context.Context, tr TaskResult,
+					db *sqlx.DB) (string, error) {
+	summaryStr, err := json.Marshal(tr.Summary)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise result summary")
+		return "", err
+	}
+
+	tr.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, task_id,
+		probe_id, report_id,
+		summary,
+		creation_time
+	) VALUES (
+		$1, $2,
+		$3, $4,
+		$5,
+		$6)`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")))
+	_, err = db.ExecContext(cx, query,
+					tr.Id, tr.TaskId,
+					tr.ProbeId, tr.ReportId,
+					summaryStr,
+					time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into task results table")
+		return "", err
+	}
+	return tr.Id, nil
+}
+
+// AddTaskError records the failure reported by the probe and marks the task
+// as failed.
+func AddTaskError(cx context.Context, tID string, uID string, te TaskError,
+					store Store) (string, error) {
+	task, err := GetTask(cx, tID, uID, store)
+	if err != nil {
+		return "", err
+	}
+	err = task.Transition(cx, taskstate.Failed, store)
+	if err != nil {
+		return "", err
+	}
+	te.TaskId = tID
+	te.ProbeId = uID
+	return store.SaveTaskError(cx, te)
+}
+
+func saveTaskError(cx context.Context, te TaskError,
+					db *sqlx.DB) (string, error) {
+	te.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, task_id,
+		probe_id,
+		exception_class,
+		message,
+		app_version,
+		creation_time
+	) VALUES (
+		$1, $2,
+		$3,
+		$4,
+		$5,
+		$6,
+		$7)`,
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")))
+	_, err := db.ExecContext(cx, query,
+					te.Id, te.TaskId,
+					te.ProbeId,
+					te.ExceptionClass,
+					te.Message,
+					te.AppVersion,
+					time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into task errors table")
+		return "", err
+	}
+	return te.Id, nil
+}
+
+func SetTaskMeasurements(cx context.Context, tID string, req TaskDoneReq,
+							db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s SET
+		report_ids = $2,
+		measurement_uids = $3
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	_, err := db.ExecContext(cx, query, tID,
+							pq.Array(req.ReportIds),
+							pq.Array(req.MeasurementUids))
+	if err != nil {
+		ctx.WithError(err).Error("failed to store task measurements")
+		return err
+	}
+	return nil
+}
+
+func ListJobResults(cx context.Context, jobID string,
+					db *sqlx.DB) ([]TaskResult, error) {
+	var results []TaskResult
+	query := fmt.Sprintf(`SELECT
+		r.id, r.task_id,
+		r.probe_id,
+		COALESCE(r.report_id, ''),
+		r.summary,
+		r.creation_time
+		FROM %s AS r
+		JOIN %s AS t ON t.id = r.task_id
+		WHERE t.job_id = $1
+		ORDER BY r.creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	rows, err := db.QueryContext(cx, query, jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list job results")
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			tr TaskResult
+			summary types.JSONText
+		)
+		err := rows.Scan(&tr.Id, &tr.TaskId,
+						&tr.ProbeId,
+						&tr.ReportId,
+						&summary,
+						&tr.CreationTime)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over results")
+			return results, err
+		}
+		err = summary.Unmarshal(&tr.Summary)
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return results, err
+		}
+		results = append(results, tr)
+	}
+	return results, nil
+}
+
+func GetJobStats(cx context.Context, jobID string,
+					db *sqlx.DB) (JobStats, error) {
+	stats := JobStats{
+		JobId: jobID,
+		Tasks: map[string]int64{},
+		Errors: map[string]int64{},
+	}
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (
+		SELECT 1 FROM %s WHERE id = $1 AND deleted_at IS NULL)`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := db.QueryRowContext(cx, query, jobID).Scan(&exists)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up job")
+		return stats, err
+	}
+	if !exists {
+		return stats, ErrJobNotFound
+	}
+
+	query = fmt.Sprintf(`SELECT
+		COALESCE(state, 'ready'), COUNT(*)
+		FROM %s
+		WHERE job_id = $1
+		GROUP BY state`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	rows, err := db.QueryContext(cx, query, jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count tasks")
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			state string
+			count int64
+		)
+		if err := rows.Scan(&state, &count); err != nil {
+			ctx.WithError(err).Error("failed to iterate over task counts")
+			return stats, err
+		}
+		stats.Tasks[state] = count
+	}
+
+	query = fmt.Sprintf(`SELECT COUNT(*)
+		FROM %s AS r
+		JOIN %s AS t ON t.id = r.task_id
+		WHERE t.job_id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err = db.QueryRowContext(cx, query, jobID).Scan(&stats.Results)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.WithError(err).Error("failed to count results")
+		return stats, err
+	}
+
+	query = fmt.Sprintf(`SELECT
+		COALESCE(e.exception_class, ''), COUNT(*)
+		FROM %s AS e
+		JOIN %s AS t ON t.id = e.task_id
+		WHERE t.job_id = $1
+		GROUP BY e.exception_class`,
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	errRows, err := db.QueryContext(cx, query, jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count errors")
+		return stats, err
+	}
+	defer errRows.Close()
+	for errRows.Next() {
+		var (
+			exceptionClass string
+			count int64
+		)
+		if err := errRows.Scan(&exceptionClass, &count); err != nil {
+			ctx.WithError(err).Error("failed to iterate over error counts")
+			return stats, err
+		}
+		stats.Errors[exceptionClass] = count
+	}
+
+	query = fmt.Sprintf(`SELECT
+		COUNT(*),
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY latency), 0),
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency), 0)
+		FROM (
+			SELECT EXTRACT(EPOCH FROM notification_time - creation_time) AS latency
+			FROM %s
+			WHERE job_id = $1 AND notification_time IS NOT NULL
+		) AS l`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err = db.QueryRowContext(cx, query, jobID).Scan(&stats.NotificationLatency.Count,
+										&stats.NotificationLatency.Median,
+										&stats.NotificationLatency.P95)
+	if err != nil {
+		ctx.WithError(err).Error("failed to compute notification latency")
+		return stats, err
+	}
+	return stats, nil
+}
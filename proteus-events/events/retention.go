@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// Tasks in these states will not change anymore and can be reaped
+var finishedTaskStates = []taskstate.State{
+	taskstate.Done,
+	taskstate.Rejected,
+	taskstate.Cancelled,
+	taskstate.Failed,
+}
+
+// ReapTasks deletes the finished tasks last updated before the retention
+// period. When core.archive-tasks is set they are moved to the archive
+// table instead. It returns the tasks it reaped.
+func ReapTasks(cx context.Context, retention time.Duration,
+				db *sqlx.DB) ([]Task, error) {
+	var (
+		query string
+		rows []taskRow
+	)
+	before := time.Now().UTC().Add(-retention)
+	tasksTable := pq.QuoteIdentifier(viper.GetString("database.tasks-table"))
+	if viper.GetBool("core.archive-tasks") {
+		query = fmt.Sprintf(`WITH reaped AS (
+			DELETE FROM %s
+			WHERE state = ANY($1) AND last_updated < $2
+			RETURNING *
+		) INSERT INTO %s SELECT * FROM reaped
+		RETURNING %s`,
+			tasksTable,
+			pq.QuoteIdentifier(viper.GetString("database.tasks-archive-table")),
+			webhookTaskColumns)
+	} else {
+		query = fmt.Sprintf(`DELETE FROM %s
+			WHERE state = ANY($1) AND last_updated < $2
+			RETURNING %s`,
+			tasksTable, webhookTaskColumns)
+	}
+	err := db.SelectContext(cx, &rows, query,
+						pq.Array(taskstate.Strings(finishedTaskStates)),
+						before)
+	if err != nil {
+		ctx.WithError(err).Error("failed to reap tasks")
+		return nil, err
+	}
+	return taskRows(rows)
+}
+
+func RunTaskReaper(store Store, interval time.Duration,
+					retention time.Duration) {
+	if retention <= 0 {
+		ctx.Info("task retention is disabled")
+		return
+	}
+	for range time.Tick(interval) {
+		tasks, err := store.ReapTasks(context.Background(), retention)
+		if err != nil {
+			continue
+		}
+		if len(tasks) > 0 {
+			ctx.Infof("reaped %d tasks older than %s", len(tasks), retention)
+		}
+		FireTaskWebhooks(tasks, WebhookTaskReaped, store)
+	}
+}
+
+// RunJobPurger removes for good the jobs deleted for longer than the
+// retention period, until then they can be restored
+func RunJobPurger(store Store, interval time.Duration,
+					retention time.Duration) {
+	if retention <= 0 {
+		ctx.Info("deleted jobs are kept forever")
+		return
+	}
+	for range time.Tick(interval) {
+		before := time.Now().UTC().Add(-retention)
+		n, err := store.PurgeJobs(context.Background(), before)
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			ctx.Infof("purged %d jobs deleted more than %s ago", n, retention)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/middleware"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func testAuthMiddleware() *proteus_mw.GinJWTMiddleware {
+	return &proteus_mw.GinJWTMiddleware{
+		Realm: "Proteus Test Realm",
+		Key: []byte("secret"),
+		Timeout: time.Hour,
+		TimeFunc: time.Now,
+	}
+}
+
+func testToken(t *testing.T, mw *proteus_mw.GinJWTMiddleware, role string,
+				scopes []string, expires time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, proteus_mw.ProteusClaims{
+		Role: role,
+		User: role + "-user",
+		Scopes: scopes,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: expires.Unix()},
+	})
+	signed, err := token.SignedString(mw.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// testRouter is the router of Start, with the jobs kept in memory
+func testRouter(t *testing.T, mw *proteus_mw.GinJWTMiddleware) *gin.Engine {
+	return storeRouter(t, mw, newMemStore())
+}
+
+// storeRouter is the router of Start keeping everything in store
+func storeRouter(t *testing.T, mw *proteus_mw.GinJWTMiddleware,
+				store Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	allowlist, err := proteus_mw.IPAllowlistFromConfig("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internalAllowlist, err := proteus_mw.IPAllowlistFromConfig("internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corsConfig, err := proteus_mw.CorsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setupRouter(store, NewScheduler(store), nil, nil, nil, mw,
+						allowlist, internalAllowlist, corsConfig)
+}
+
+func TestAdminAuth(t *testing.T) {
+	mw := testAuthMiddleware()
+	router := testRouter(t, mw)
+	hour := time.Now().Add(time.Hour)
+	forged := testAuthMiddleware()
+	forged.Key = []byte("not the secret")
+	token := func(m *proteus_mw.GinJWTMiddleware, role string,
+					expires time.Time) string {
+		return testToken(t, m, role, proteus_mw.ScopesForRole(role), expires)
+	}
+
+	tests := []struct {
+		name	string
+		method	string
+		path	string
+		token	string
+		status	int
+	}{
+		{"no token", "GET", "/api/v1/admin/jobs", "", http.StatusUnauthorized},
+		{"garbage token", "GET", "/api/v1/admin/jobs", "garbage", http.StatusUnauthorized},
+		{"forged token", "GET", "/api/v1/admin/jobs",
+			token(forged, proteus_mw.AdminRole, hour), http.StatusUnauthorized},
+		{"expired token", "GET", "/api/v1/admin/jobs",
+			token(mw, proteus_mw.AdminRole, time.Now().Add(-time.Hour)),
+			http.StatusUnauthorized},
+		{"unknown api key", "GET", "/api/v1/admin/jobs",
+			proteus_mw.APIKeyPrefix + "key", http.StatusUnauthorized},
+		{"device", "GET", "/api/v1/admin/jobs",
+			token(mw, proteus_mw.DeviceRole, hour), http.StatusForbidden},
+		{"viewer listing", "GET", "/api/v1/admin/jobs",
+			token(mw, proteus_mw.ViewerRole, hour), http.StatusOK},
+		{"viewer creating", "POST", "/api/v1/admin/job",
+			token(mw, proteus_mw.ViewerRole, hour), http.StatusForbidden},
+		// Let in, then refused for the empty body
+		{"operator creating", "POST", "/api/v1/admin/job",
+			token(mw, proteus_mw.OperatorRole, hour), http.StatusBadRequest},
+		{"admin creating", "POST", "/api/v1/admin/job",
+			token(mw, proteus_mw.AdminRole, hour), http.StatusBadRequest},
+		{"admin without scopes", "GET", "/api/v1/admin/jobs",
+			testToken(t, mw, proteus_mw.AdminRole, nil, hour),
+			http.StatusUnauthorized},
+		{"admin with probe scopes", "GET", "/api/v1/admin/jobs",
+			testToken(t, mw, proteus_mw.AdminRole,
+						proteus_mw.ScopesForRole(proteus_mw.DeviceRole), hour),
+			http.StatusForbidden},
+		{"operator broadcasting", "POST", "/api/v1/admin/broadcast",
+			token(mw, proteus_mw.OperatorRole, hour), http.StatusForbidden},
+		{"viewer metrics", "GET", "/api/v1/admin/debug/vars",
+			token(mw, proteus_mw.ViewerRole, hour), http.StatusOK},
+		{"anonymous metrics", "GET", "/api/v1/admin/debug/vars", "",
+			http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, strings.NewReader(""))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer " + test.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d (got: %d)", test.name, test.status, w.Code)
+		}
+	}
+}
+
+func TestAdminAuthDisabled(t *testing.T) {
+	mw := testAuthMiddleware()
+	mw.DisableStaffAuth = true
+	router := testRouter(t, mw)
+
+	req, _ := http.NewRequest("GET", "/api/v1/admin/jobs", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the dev bypass to let requests in (got: %d)", w.Code)
+	}
+}
+
+func TestDeviceRoutes(t *testing.T) {
+	mw := testAuthMiddleware()
+	store := newMemStore()
+	router := storeRouter(t, mw, store)
+	token := testToken(t, mw, proteus_mw.DeviceRole,
+						proteus_mw.ScopesForRole(proteus_mw.DeviceRole),
+						time.Now().Add(time.Hour))
+	optOut := func() int {
+		req, _ := http.NewRequest("DELETE", "/api/v1/device/me", nil)
+		req.Header.Set("Authorization", "Bearer " + token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := optOut(); code != http.StatusOK {
+		t.Fatalf("expected the probe to opt out (got: %d)", code)
+	}
+	if !store.deactivated["device-user"] || !store.seen["device-user"] {
+		t.Errorf("expected the store to deactivate the probe it saw")
+	}
+	if code := optOut(); code != http.StatusNotFound {
+		t.Errorf("expected the probe to be gone (got: %d)", code)
+	}
+	store.blocked["device-user"] = true
+	if code := optOut(); code != http.StatusForbidden {
+		t.Errorf("expected the blocked probe to be refused (got: %d)", code)
+	}
+}
+
+// TestSQLiteRouter boots the router of Start on SQLite alone, a probe
+// registering, logging in and opting out without any postgres.
+func TestTasksNotified(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("api.max-body-size", 1 << 20)
+	store := newMemStore()
+	router := storeRouter(t, testAuthMiddleware(), store)
+	store.tasks["ready-task"] = Task{Id: "ready-task", State: taskstate.Ready}
+	store.tasks["done-task"] = Task{Id: "done-task", State: taskstate.Done}
+	notified := func(body string) int {
+		req, _ := http.NewRequest("POST", "/api/v1/internal/tasks/notified",
+									strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	code := notified(`{"task_ids": ["ready-task", "done-task", "missing"]}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected the tasks to be marked notified (got: %d)", code)
+	}
+	if s := store.tasks["ready-task"].State; s != taskstate.Notified {
+		t.Errorf("expected the ready task to be notified (got: %s)", s)
+	}
+	if s := store.tasks["done-task"].State; s != taskstate.Done {
+		t.Errorf("expected the done task to be left alone (got: %s)", s)
+	}
+	if code := notified(`{}`); code != http.StatusBadRequest {
+		t.Errorf("expected the request without tasks to be refused (got: %d)", code)
+	}
+}
+
+func TestSQLiteRouter(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	for key, table := range map[string]string{
+		"probe-updates-table": "probe_updates",
+		"token-history-table": "token_history",
+		"settings-overrides-table": "settings_overrides",
+		"accounts-table": "accounts",
+		"refresh-tokens-table": "refresh_tokens",
+		"revoked-tokens-table": "revoked_tokens",
+		"sessions-table": "sessions",
+	} {
+		viper.Set("database." + key, table)
+	}
+	viper.Set("database.url", "")
+	viper.Set("auth.enforce", true)
+	viper.Set("auth.jwt-token", "secret")
+	viper.Set("api.max-body-size", 1 << 20)
+	mw, err := proteus_mw.InitAuthMiddleware(store.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := storeRouter(t, mw, NewRetryStore(store))
+	call := func(method string, path string, token string, body string,
+				reply interface{}) int {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer " + token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if reply != nil {
+			json.Unmarshal(w.Body.Bytes(), reply)
+		}
+		return w.Code
+	}
+
+	var registered struct {
+		ClientID	string `json:"client_id"`
+	}
+	code := call("POST", "/api/v1/register", "", `{"probe_cc": "IT",
+		"probe_asn": "AS1", "platform": "linux",
+		"supported_tests": ["web_connectivity"], "software_name": "probe-cli",
+		"software_version": "3.0.0", "password": "hunter2"}`, &registered)
+	if code != http.StatusOK || registered.ClientID == "" {
+		t.Fatalf("expected the probe to register (got: %d)", code)
+	}
+	var login struct {
+		Token	string `json:"token"`
+	}
+	code = call("POST", "/api/v1/login", "", `{"username": "` +
+				registered.ClientID + `", "password": "hunter2"}`, &login)
+	if code != http.StatusOK || login.Token == "" {
+		t.Fatalf("expected the probe to log in (got: %d)", code)
+	}
+	var export struct {
+		Device	struct {
+			Probe	map[string]interface{} `json:"probe"`
+		} `json:"device"`
+	}
+	code = call("GET", "/api/v1/device/me/export", login.Token, "", &export)
+	if code != http.StatusOK {
+		t.Errorf("expected the probe to export its data (got: %d)", code)
+	}
+	if tests, _ := export.Device.Probe["supported_tests"].([]interface{}); len(tests) != 1 {
+		t.Errorf("expected the tests of the probe in its export (got: %v)",
+				export.Device.Probe)
+	}
+	if code = call("DELETE", "/api/v1/device/me", login.Token, "", nil); code != http.StatusOK {
+		t.Errorf("expected the probe to opt out (got: %d)", code)
+	}
+	if code = call("DELETE", "/api/v1/device/me", login.Token, "", nil); code != http.StatusNotFound {
+		t.Errorf("expected the probe to be gone (got: %d)", code)
+	}
+}
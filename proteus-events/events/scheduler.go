@@ -2,28 +2,30 @@ package events
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"os"
 	"net/http"
 	"net/url"
+	"regexp"
 	_ "os/signal"
 	"sync"
 	_ "syscall"
 	"time"
 
-	"github.com/satori/go.uuid"
 	"github.com/spf13/viper"
-	"github.com/lib/pq"
-	"github.com/jmoiron/sqlx"
-	"github.com/jmoiron/sqlx/types"
 )
 
 type JobTarget struct {
 	ClientID	string
 	TaskID		string
+	// Used to describe the task in the notification
+	TestName	string
+	URLCount	int
+	DryRun		bool
+	Silent		bool
+	NotificationWindow	string
 }
 
 func NewJobTarget(cID string, tID string) *JobTarget {
@@ -33,6 +35,41 @@ func NewJobTarget(cID string, tID string) *JobTarget {
 	}
 }
 
+// testCategories groups the tests so that probes can choose which kind of
+// tasks they want to be notified about.
+var testCategories = map[string]string{
+	"web_connectivity": "websites",
+	"whatsapp": "im",
+	"facebook_messenger": "im",
+	"telegram": "im",
+	"http_invalid_request_line": "middlebox",
+	"http_header_field_manipulation": "middlebox",
+	"ndt": "performance",
+	"dash": "performance",
+}
+
+// TestCategory returns the category of the test, "other" if it has none
+func TestCategory(testName string) string {
+	if category, ok := testCategories[testName]; ok {
+		return category
+	}
+	return "other"
+}
+
+// urlCount returns how many URLs the arguments of a task list, 0 if the
+// test doesn't take URLs.
+func urlCount(args interface{}) int {
+	m, ok := args.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	urls, ok := m["urls"].([]interface{})
+	if !ok {
+		return 0
+	}
+	return len(urls)
+}
+
 type Job struct {
 	Id			string
 	Schedule	Schedule
@@ -45,158 +82,70 @@ type Job struct {
 	lock		sync.RWMutex
 	jobTimer	*time.Timer	
 	IsDone		bool
+	// The job was deleted, it is no longer run
+	stopped		bool
 }
 
-func (j *Job) CreateTask(cID string, t Task, jDB *JobDB) (string, error) {
-	tx, err := jDB.db.Begin()
-	if err != nil {
-		ctx.WithError(err).Error("failed to open createTask transaction")
-		return "", err
-	}
-
-	var taskID = uuid.NewV4().String()
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			id, probe_id,
-			job_id, test_name,
-			arguments,
-			state,
-			progress,
-			creation_time,
-			notification_time,
-			accept_time,
-			done_time,
-			last_updated
-		) VALUES (
-			$1, $2,
-			$3, $4,
-			$5,
-			$6,
-			$7,
-			$8,
-			$9,
-			$10,
-			$11,
-			$12)`,
-		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
-		stmt, err := tx.Prepare(query)
-		if err != nil {
-			ctx.WithError(err).Error("failed to prepare task create query")
-			return "", err
-		}
-		defer stmt.Close()
-
-		taskArgsStr, err := json.Marshal(t.Arguments)
-		ctx.Debugf("task args: %#", t.Arguments)
-		if err != nil {
-			ctx.WithError(err).Error("failed to serialise task arguments in createTask")
-			return "", err
-		}
-		now := time.Now().UTC()
-		_, err = stmt.Exec(taskID, cID,
-							j.Id, t.TestName,
-							taskArgsStr,
-							"ready",
-							0,
-							now,
-							nil,
-							nil,
-							nil,
-							now)
-		if err != nil {
-			tx.Rollback()
-			ctx.WithError(err).Error("failed to insert into tasks table")
-			return "", err
-		}
-		if err = tx.Commit(); err != nil {
-			ctx.WithError(err).Error("failed to commit transaction in tasks table, rolling back")
-			return "", err
-		}
-	}
-
-	return taskID, nil
-}
-
-func (j *Job) GetTargets(jDB *JobDB) []*JobTarget {
+func (j *Job) GetTargets(store Store) []*JobTarget {
 	var (
 		err error
-		query string
-		targetCountries []string
-		targetPlatforms []string
 		targets []*JobTarget
-		taskArgs types.JSONText
-		task Task
-		rows *sql.Rows
+		// Every time the job fires is a new run, retries of the same run
+		// will not create duplicate tasks.
+		runID = j.TimesRun
+		// Runs are not tied to a request, every query is bounded by
+		// database.query-timeout alone
+		cx = context.Background()
 	)
-	query = fmt.Sprintf(`SELECT
-		target_countries,
-		target_platforms,
-		task_test_name,
-		task_arguments
-		FROM %s
-		WHERE id = $1`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-	
-	err = jDB.db.QueryRow(query, j.Id).Scan(
-		pq.Array(&targetCountries),
-		pq.Array(&targetPlatforms),
-		&task.TestName,
-		&taskArgs)
+	jd, err := store.GetJob(cx, j.Id)
 	if err != nil {
-		ctx.WithError(err).Error("failed to obtain targets")
-		if err == sql.ErrNoRows {
-			panic("could not find job with ID")
+		// Deleted while waiting for its run
+		if err == ErrJobNotFound {
+			ctx.Warnf("job %s is gone, skipping its run", j.Id)
+			return targets
 		}
 		panic("other error in query")
 	}
-	err = taskArgs.Unmarshal(&task.Arguments)
-	if err != nil {
-		ctx.WithError(err).Error("failed to unmarshal json")
-		panic("invalid JSON in database")
-	}
-
-	// XXX this is really ghetto. There is probably a much better way of doing
-	// it.
-	query = fmt.Sprintf("SELECT id FROM %s",
-		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
-	if len(targetCountries) > 0 && len(targetPlatforms) > 0 {
-		query += " WHERE probe_cc = ANY($1) AND platform = ANY($2)"
-		rows, err = jDB.db.Query(query,
-									pq.Array(targetCountries),
-									pq.Array(targetPlatforms))
-	} else if len(targetCountries) > 0 || len(targetPlatforms) > 0 {
-		if len(targetCountries) > 0 {
-			query += " WHERE probe_cc = ANY($1)"
-			rows, err = jDB.db.Query(query, pq.Array(targetCountries))
-		} else {
-			query += " WHERE platform = ANY($1)"
-			rows, err = jDB.db.Query(query, pq.Array(targetPlatforms))
-		}
+	task := jd.Task
+	target := jd.Target
+
+	var probes []MatchingProbe
+	if target.Cohort == FrozenCohort {
+		probes, err = store.JobCohort(cx, j.Id)
 	} else {
-		rows, err = jDB.db.Query(query)
+		probes, err = store.FindProbes(cx, target, runID, task.TestName)
 	}
-
 	if err != nil {
-		ctx.WithError(err).Error("failed to find targets")
 		return targets
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			clientID string
-			taskID string
-		)
-		err = rows.Scan(&clientID)
-		if err != nil {
-			ctx.WithError(err).Error("failed to iterate over targets")
-			return targets
-		}
-		taskID, err = j.CreateTask(clientID, task, jDB)
-		if err != nil {
-			ctx.WithError(err).Error("failed to create task")
-			return targets
+	probeIDs := make([]string, len(probes))
+	for i, p := range probes {
+		probeIDs[i] = p.Id
+	}
+	notice := JobTarget{
+		TestName: task.TestName,
+		URLCount: urlCount(task.Arguments),
+		DryRun: jd.DryRun,
+		Silent: jd.Notification == SilentNotification,
+		NotificationWindow: jd.NotificationWindow,
+	}
+	created, err := store.CreateTasks(cx, j.Id, probeIDs, task, runID, notice)
+	if batchErr, ok := err.(*TaskBatchError); ok {
+		// The probes whose tasks were created are notified regardless
+		ctx.WithError(batchErr.Err).Errorf("failed to create the tasks of %d of %d probes",
+											len(batchErr.Failed), len(probeIDs))
+	} else if err != nil {
+		ctx.WithError(err).Error("failed to create tasks")
+		return targets
+	}
+	for _, c := range created {
+		if !c.NeedsNotify {
+			continue
 		}
-		targets = append(targets, NewJobTarget(clientID, taskID))
+		t := notice
+		t.ClientID = c.ProbeId
+		t.TaskID = c.TaskId
+		targets = append(targets, &t)
 	}
 	return targets
 }
@@ -222,16 +171,19 @@ func (j *Job) GetWaitDuration() time.Duration {
 	return waitDuration
 }
 
-func (j *Job) WaitAndRun(jDB *JobDB) {
+func (j *Job) WaitAndRun(store Store) {
 	ctx.Debugf("running job: \"%s\"", j.Comment)
 
 	j.lock.Lock()
 	defer j.lock.Unlock()
+	if j.stopped {
+		return
+	}
 	
 	waitDuration := j.GetWaitDuration()
 
 	ctx.Debugf("will wait for: \"%s\"", waitDuration)
-	jobRun := func() { j.Run(jDB) }
+	jobRun := func() { j.Run(store) }
 	j.jobTimer = time.AfterFunc(waitDuration, jobRun)
 }
 
@@ -239,23 +191,36 @@ func (j *Job) WaitAndRun(jDB *JobDB) {
 type NotifyReq struct {
 	ClientIDs []string `json:"client_ids"`
 	Event map[string]interface {} `json:"event"`
+	// Moved to notified once the notification is delivered
+	TaskIDs []string `json:"task_ids,omitempty"`
+	// Notifications with the same key are batched into a single push
+	CollapseKey string `json:"collapse_key,omitempty"`
+	// Only log the notification instead of pushing it
+	DryRun bool `json:"dry_run,omitempty"`
+	// Wake up the app in the background without showing anything
+	Silent bool `json:"silent,omitempty"`
+	// Defer the notification to the next time the probe is within this
+	// "HH:MM-HH:MM" window of its day
+	NotificationWindow string `json:"notification_window,omitempty"`
 }
 
-func TaskNotify(clientID string, taskID string, jDB *JobDB) error {
-	path, _ := url.Parse("/api/v1/notify")
+// NotifiedReq is sent by the notify service once it delivered the push of
+// the tasks, to move them to notified
+// XXX this is duplicated in proteus-notify
+type NotifiedReq struct {
+	TaskIDs []string `json:"task_ids" binding:"required"`
+}
+
+// postToNotify sends a request to the API of the notify service, on behalf
+// of the staff whose Authorization header is authorization when it's set
+func postToNotify(apiPath string, authorization string, body interface{}) error {
+	path, _ := url.Parse(apiPath)
 	baseUrl, err := url.Parse(viper.GetString("core.notify-url"))
 	if err != nil {
 		ctx.WithError(err).Error("invalid base url")
 		return err
 	}
-	notifyReq := NotifyReq{
-		ClientIDs: []string{clientID},
-		Event: map[string]interface{}{
-			"type": "run_task",
-			"task_id": taskID,
-		},
-	}
-	jsonStr, err := json.Marshal(notifyReq)
+	jsonStr, err := json.Marshal(body)
 	if err != nil {
 		ctx.WithError(err).Error("failed to marshal data")
 		return err
@@ -265,6 +230,9 @@ func TaskNotify(clientID string, taskID string, jDB *JobDB) error {
 								u.String(),
 								bytes.NewBuffer(jsonStr))
     req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -276,41 +244,96 @@ func TaskNotify(clientID string, taskID string, jDB *JobDB) error {
 	if resp.StatusCode != 200 {
 		return errors.New("http request returned invalid status code")
 	}
-	err = SetTaskState(taskID,
-						clientID,
-						"notified",
-						[]string{"ready"},
-						"notification_time",
-						jDB.db)
-	if err != nil {
-		ctx.WithError(err).Error("failed to update task state")
-		return err
-	}
 	return nil
 }
 
-func (j *Job) Run(jDB *JobDB) {
+func sendNotifyReq(notifyReq NotifyReq) error {
+	return postToNotify("/api/v1/notify", "", notifyReq)
+}
+
+// TaskNotify asks the notify service to tell the probe about the task. The
+// notify service reports back to /internal/tasks/notified once the push
+// is delivered.
+// Tasks created close to each other for the same probe are announced with
+// a single push, the probe then finds all of them in GET /tasks.
+func TaskNotify(t *JobTarget) error {
+	notifyReq := NotifyReq{
+		ClientIDs: []string{t.ClientID},
+		Event: map[string]interface{}{
+			"type": "run_task",
+			"task_id": t.TaskID,
+			"test_name": t.TestName,
+			"category": TestCategory(t.TestName),
+			"url_count": t.URLCount,
+		},
+		TaskIDs: []string{t.TaskID},
+		CollapseKey: "run_task",
+		DryRun: t.DryRun,
+		Silent: t.Silent,
+		NotificationWindow: t.NotificationWindow,
+	}
+	return sendNotifyReq(notifyReq)
+}
+
+// TaskCancelNotify tells a probe that a task it was notified about should no
+// longer be run.
+func TaskCancelNotify(clientID string, taskID string) error {
+	notifyReq := NotifyReq{
+		ClientIDs: []string{clientID},
+		Event: map[string]interface{}{
+			"type": "cancel_task",
+			"task_id": taskID,
+		},
+	}
+	return sendNotifyReq(notifyReq)
+}
+
+// BroadcastReq asks the notify service to push an event to all the devices
+// subscribed to an FCM topic, e.g. "country-IR".
+type BroadcastReq struct {
+	Topic		string `json:"topic" binding:"required"`
+	Priority	string `json:"priority"`
+	Event		map[string]interface{} `json:"event"`
+}
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// https://firebase.google.com/docs/cloud-messaging/android/topic-messaging
+var topicRegexp = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]+$`)
+
+// Broadcast tells the devices subscribed to a topic to check in now. No
+// tasks are created, the event defaults to a "check_in" one. The notify
+// service only takes broadcasts from admins, so the Authorization header of
+// the admin is passed along.
+func Broadcast(req BroadcastReq, authorization string) error {
+	if !topicRegexp.MatchString(req.Topic) {
+		return ErrInvalidTopic
+	}
+	if req.Event == nil {
+		req.Event = map[string]interface{}{
+			"type": "check_in",
+		}
+	}
+	return postToNotify("/api/v1/broadcast", authorization, req)
+}
+
+func (j *Job) Run(store Store) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
+	if j.stopped {
+		return
+	}
 	if !j.ShouldRun() {
 		ctx.Error("inconsitency in should run detected..")
 		return
 	}
 
-	targets := j.GetTargets(jDB)
+	targets := j.GetTargets(store)
 	lastRunAt := time.Now().UTC()
-	for _, t := range targets {
-		// XXX
-		// In here shall go logic to connect to notification server and notify
-		// them of the task
-		ctx.Debugf("notifying %s of %s", t.ClientID, t.TaskID)
-		err := TaskNotify(t.ClientID, t.TaskID, jDB)
-		if err != nil {
-			ctx.WithError(err).Errorf("failed to notify %s of %s",
-										t.ClientID, t.TaskID)
-		}
-	}
+	// The notifications were queued in the outbox with the tasks
+	ctx.Debugf("%d probes to notify", len(targets))
+	wakeOutboxRelay()
 
 	ctx.Debugf("successfully ran at %s", lastRunAt)
 	// XXX maybe move these elsewhere
@@ -324,49 +347,13 @@ func (j *Job) Run(jDB *JobDB) {
 	}
 	ctx.Debugf("next run will be at %s", j.NextRunAt)
 	ctx.Debugf("times run %d", j.TimesRun)
-	err := j.Save(jDB)
+	err := store.SaveJobRun(context.Background(), j)
 	if err != nil {
 		ctx.Error("failed to save job state to DB")
 	}
 	if j.ShouldWait() {
-		go j.WaitAndRun(jDB)
-	}
-}
-
-func (j *Job) Save(jDB *JobDB) error {
-	tx, err := jDB.db.Begin()
-	if err != nil {
-		ctx.WithError(err).Error("failed to open transaction")
-		return err
-	}
-
-	query := fmt.Sprintf(`UPDATE %s SET
-		times_run = $2,
-		next_run_at = $3,
-		is_done = $4
-		WHERE id = $1`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-
-	stmt, err := tx.Prepare(query)
-	if (err != nil) {
-		ctx.WithError(err).Error("failed to prepare update jobs query")
-		return err
-	}
-	_, err = stmt.Exec(j.Id,
-						j.TimesRun,
-						j.NextRunAt.Format(ISOUTCTimeLayout),
-						j.IsDone)
-
-	if (err != nil) {
-		tx.Rollback()
-		ctx.WithError(err).Error("failed to jobs table, rolling back")
-		return errors.New("failed to update jobs table")
-	}
-	if err = tx.Commit(); err != nil {
-		ctx.WithError(err).Error("failed to commit transaction, rolling back")
-		return err
+		go j.WaitAndRun(store)
 	}
-	return nil
 }
 
 func (j *Job) ShouldWait() bool {
@@ -400,84 +387,52 @@ func (j *Job) ShouldRun() bool {
 	return false
 }
 
-type JobDB struct {
-	db *sqlx.DB
-}
-
-func (db *JobDB) GetAll() ([]*Job, error) {
-	allJobs := []*Job{}
-	query := fmt.Sprintf(`SELECT
-		id, comment,
-		schedule, delay,
-		times_run,
-		next_run_at,
-		is_done
-		FROM %s
-		WHERE state = 'active'`,
-		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
-	rows, err := db.db.Query(query)
-	if err != nil {
-		ctx.WithError(err).Error("failed to list jobs")
-		return allJobs, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			j				Job
-			schedule		string
-			nextRunAtStr	string
-		)
-		err := rows.Scan(&j.Id,
-						&j.Comment,
-						&schedule,
-						&j.Delay,
-						&j.TimesRun,
-						&nextRunAtStr,
-						&j.IsDone)
-		if err != nil {
-			ctx.WithError(err).Error("failed to iterate over jobs")
-			return allJobs, err
-		}
-		j.NextRunAt, err = time.Parse(ISOUTCTimeLayout, nextRunAtStr)
-		if err != nil {
-			ctx.WithError(err).Error("invalid time string")
-			return allJobs, err
-		}
-		j.Schedule, err = ParseSchedule(schedule)
-		if err != nil {
-			ctx.WithError(err).Error("invalid schedule")
-			return allJobs, err
-		}
-		j.lock = sync.RWMutex{}
-		allJobs = append(allJobs, &j)
-	}
-	return allJobs, nil
-}
-
 type Scheduler struct {
-	jobDB	JobDB
+	store	Store
 
 	stopped	chan os.Signal
+	// The jobs being run by id
+	jobs	map[string]*Job
+	jobsLock	sync.Mutex
 }
 
-func NewScheduler(db *sqlx.DB) *Scheduler {
+func NewScheduler(store Store) *Scheduler {
 	return &Scheduler{
 			stopped: make(chan os.Signal),
-			jobDB: JobDB{db: db}}
+			store: store,
+			jobs: make(map[string]*Job)}
 }
 
 func (s *Scheduler) RunJob(j *Job) {
+	s.jobsLock.Lock()
+	s.jobs[j.Id] = j
+	s.jobsLock.Unlock()
 	if j.ShouldWait() {
-		j.WaitAndRun(&s.jobDB)
+		j.WaitAndRun(s.store)
+	}
+}
+
+// StopJob stops running the deleted job, waiting for the run in progress
+// if any
+func (s *Scheduler) StopJob(jobID string) {
+	s.jobsLock.Lock()
+	j, ok := s.jobs[jobID]
+	delete(s.jobs, jobID)
+	s.jobsLock.Unlock()
+	if !ok {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.stopped = true
+	if j.jobTimer != nil {
+		j.jobTimer.Stop()
 	}
 }
 
 func (s *Scheduler) Start() {
 	ctx.Debug("starting scheduler")
-	// XXX currently when jobs are deleted the allJobs list will not be
-	// updated. We should find a way to check this and stop triggering a job in
-	// case it gets deleted.
-	allJobs, err := s.jobDB.GetAll()
+	allJobs, err := s.store.ActiveJobs(context.Background())
 	if err != nil {
 		ctx.WithError(err).Error("failed to list all jobs")
 		return
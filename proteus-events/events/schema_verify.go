@@ -0,0 +1,110 @@
+package events
+
+import (
+	"github.com/thetorproject/proteus/proteus-common/schema"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// jobsColumns are the columns of the jobs table the store uses
+var jobsColumns = map[string]string{
+	"id": "uuid",
+	"comment": "varchar",
+	"creation_time": "timestamptz",
+	"schedule": "varchar",
+	"delay": "int4",
+	"task_test_name": "varchar",
+	"task_arguments": "jsonb",
+	"state": "job_state",
+	"priority": "int4",
+	"webhook_url": "varchar",
+	"webhook_secret": "varchar",
+	"dry_run": "bool",
+	"notification": "varchar",
+	"notification_window": "varchar",
+	"created_by": "varchar",
+	"shared_with": "_varchar",
+	"times_run": "int4",
+	"next_run_at": "timetz",
+	"is_done": "bool",
+	"deleted_at": "timestamptz",
+	"state_before_delete": "job_state",
+	"target_countries": "_varchar",
+	"target_platforms": "_varchar",
+	"target_version": "varchar",
+	"target_languages": "_varchar",
+	"target_sample_rate": "float8",
+	"target_probe_ids": "_varchar",
+	"target_exclude_probe_ids": "_varchar",
+	"target_tags": "_varchar",
+	"target_exclude_countries": "_varchar",
+	"target_exclude_platforms": "_varchar",
+	"target_active_within": "varchar",
+	"target_regions": "_varchar",
+	"target_expression": "varchar",
+	"target_segment": "varchar",
+	"target_mode": "varchar",
+	"target_coverage_window": "varchar",
+	"target_coverage_cells": "int4",
+	"target_cohort": "varchar",
+	"target_probe_cohorts": "_varchar",
+}
+
+// tasksColumns are the columns of the tasks table the store uses
+var tasksColumns = map[string]string{
+	"id": "uuid",
+	"probe_id": "uuid",
+	"job_id": "uuid",
+	"test_name": "varchar",
+	"arguments": "jsonb",
+	"state": "varchar",
+	"progress": "int4",
+	"creation_time": "timestamptz",
+	"notification_time": "timestamptz",
+	"accept_time": "timestamptz",
+	"done_time": "timestamptz",
+	"last_updated": "timestamptz",
+	"run_id": "int4",
+	"lease_expires_at": "timestamptz",
+	"report_ids": "_varchar",
+	"measurement_uids": "_varchar",
+}
+
+// taskOutboxColumns are the columns of the task outbox
+var taskOutboxColumns = map[string]string{
+	"task_id": "uuid",
+	"probe_id": "uuid",
+	"notice": "jsonb",
+	"attempts": "int4",
+	"next_attempt_at": "timestamptz",
+	"last_error": "varchar",
+	"creation_time": "timestamptz",
+}
+
+// verifiedTasksColumns adds the time columns of the configured task
+// transitions to tasksColumns
+func verifiedTasksColumns() map[string]string {
+	columns := make(map[string]string, len(tasksColumns))
+	for name, udt := range tasksColumns {
+		columns[name] = udt
+	}
+	for _, name := range taskstate.TimeColumns() {
+		columns[name] = "timestamptz"
+	}
+	return columns
+}
+
+// verifySchema checks that the configured jobs, tasks and task outbox
+// tables are the ones the store expects, with the task-transitions already
+// configured
+func verifySchema(db *sqlx.DB) error {
+	return schema.Verify(db.DB, []schema.Table{
+		{Name: viper.GetString("database.jobs-table"), Columns: jobsColumns},
+		{Name: viper.GetString("database.tasks-table"),
+			Columns: verifiedTasksColumns()},
+		{Name: viper.GetString("database.task-outbox-table"),
+			Columns: taskOutboxColumns},
+	})
+}
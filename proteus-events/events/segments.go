@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/spf13/viper"
+)
+
+// Segment is a named Target jobs can refer to. Every update of a segment
+// creates a new version and jobs always use the latest one.
+type Segment struct {
+	Name			string `json:"name"`
+	Version			int64 `json:"version"`
+	Comment			string `json:"comment"`
+	Target			Target `json:"target"`
+
+	CreationTime	time.Time `json:"creation_time"`
+}
+
+var ErrSegmentNotFound = errors.New("segment not found")
+var ErrNestedSegment = errors.New("a segment cannot refer to another segment")
+var ErrSegmentInUse = errors.New("segment is used by active jobs")
+
+// PutSegment stores a new version of the segment and returns its number
+func PutSegment(cx context.Context, s Segment, db *sqlx.DB) (int64, error) {
+	if s.Target.Segment != "" {
+		return 0, ErrNestedSegment
+	}
+	if err := s.Target.Validate(cx, db); err != nil {
+		return 0, err
+	}
+	targetStr, err := json.Marshal(s.Target)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise segment target")
+		return 0, err
+	}
+
+	var version int64
+	query := fmt.Sprintf(`INSERT INTO %[1]s (
+		name, version,
+		comment,
+		target,
+		creation_time
+	) SELECT
+		$1, COALESCE(MAX(version), 0) + 1,
+		$2,
+		$3,
+		$4
+		FROM %[1]s WHERE name = $1
+	RETURNING version`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	err = db.QueryRowContext(cx, query, s.Name,
+								s.Comment,
+								targetStr,
+								time.Now().UTC()).Scan(&version)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into segments table")
+		return 0, err
+	}
+	return version, nil
+}
+
+func scanSegment(row interface{Scan(...interface{}) error}) (Segment, error) {
+	var (
+		s Segment
+		target types.JSONText
+	)
+	err := row.Scan(&s.Name, &s.Version,
+					&s.Comment,
+					&target,
+					&s.CreationTime)
+	if err != nil {
+		return s, err
+	}
+	err = target.Unmarshal(&s.Target)
+	return s, err
+}
+
+// GetSegment returns the given version of the segment, or the latest one if
+// version is 0.
+func GetSegment(cx context.Context, name string, version int64,
+				db *sqlx.DB) (Segment, error) {
+	query := fmt.Sprintf(`SELECT
+		name, version,
+		COALESCE(comment, ''),
+		target,
+		creation_time
+		FROM %s
+		WHERE name = $1 AND ($2 = 0 OR version = $2)
+		ORDER BY version DESC
+		LIMIT 1`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	s, err := scanSegment(db.QueryRowContext(cx, query, name, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return s, ErrSegmentNotFound
+		}
+		ctx.WithError(err).Error("failed to get segment")
+		return s, err
+	}
+	return s, nil
+}
+
+// ListSegments returns the latest version of every segment
+func ListSegments(cx context.Context, db *sqlx.DB) ([]Segment, error) {
+	var segments []Segment
+	query := fmt.Sprintf(`SELECT DISTINCT ON (name)
+		name, version,
+		COALESCE(comment, ''),
+		target,
+		creation_time
+		FROM %s
+		ORDER BY name, version DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	rows, err := db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list segments")
+		return segments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over segments")
+			return segments, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
+
+// DeleteSegment deletes all the versions of a segment no active job uses
+func DeleteSegment(cx context.Context, name string, db *sqlx.DB) error {
+	var inUse bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s
+		WHERE target_segment = $1 AND state = 'active')`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if err := db.QueryRowContext(cx, query, name).Scan(&inUse); err != nil {
+		ctx.WithError(err).Error("failed to check segment usage")
+		return err
+	}
+	if inUse {
+		return ErrSegmentInUse
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %s WHERE name = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	res, err := db.ExecContext(cx, query, name)
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete segment")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSegmentNotFound
+	}
+	return nil
+}
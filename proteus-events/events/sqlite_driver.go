@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is the sqlite3 driver taking the queries of the probes
+// and middleware packages, which are written for Postgres
+const sqliteDriverName = "proteus-sqlite3"
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// sqliteDriver numbers the $1 placeholders of the queries as ?1: SQLite
+// takes $1 for a named parameter, numbered in the order the parameters
+// first appear rather than by their name. It also binds the times in UTC,
+// SQLite comparing them as text.
+type sqliteDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(numberPlaceholders(query))
+}
+
+func (c *sqliteConn) PrepareContext(cx context.Context,
+									query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(cx, numberPlaceholders(query))
+}
+
+func (c *sqliteConn) QueryContext(cx context.Context, query string,
+									args []driver.NamedValue) (driver.Rows, error) {
+	return c.SQLiteConn.QueryContext(cx, numberPlaceholders(query), args)
+}
+
+func (c *sqliteConn) ExecContext(cx context.Context, query string,
+									args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(cx, numberPlaceholders(query), args)
+}
+
+// CheckNamedValue moves the times to UTC, leaving the conversion of the
+// values to database/sql
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if t, ok := nv.Value.(time.Time); ok {
+		nv.Value = t.UTC()
+	}
+	return driver.ErrSkip
+}
+
+// numberPlaceholders replaces the $1 placeholders of the query by ?1, the
+// $ within quotes, like those of the JSON paths, are left alone
+func numberPlaceholders(query string) string {
+	if !strings.Contains(query, "$") {
+		return query
+	}
+	var (
+		b strings.Builder
+		quote byte
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '$' && i + 1 < len(query) &&
+				query[i + 1] >= '0' && query[i + 1] <= '9':
+			ch = '?'
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
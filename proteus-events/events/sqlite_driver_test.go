@@ -0,0 +1,44 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestNumberPlaceholders(t *testing.T) {
+	tests := []struct {
+		query	string
+		want	string
+	}{
+		{`SELECT 1`, `SELECT 1`},
+		{`UPDATE t SET a = $2 WHERE id = $1 AND b <= $2`,
+			`UPDATE t SET a = ?2 WHERE id = ?1 AND b <= ?2`},
+		{`SELECT json_extract(v, '$.a') FROM t WHERE id = $10`,
+			`SELECT json_extract(v, '$.a') FROM t WHERE id = ?10`},
+		{`SELECT "$1" FROM t WHERE a = 'it''s $1' AND b = $1`,
+			`SELECT "$1" FROM t WHERE a = 'it''s $1' AND b = ?1`},
+		{`SELECT $ FROM t`, `SELECT $ FROM t`},
+	}
+	for _, test := range tests {
+		if got := numberPlaceholders(test.query); got != test.want {
+			t.Errorf("expected %s (got: %s)", test.want, got)
+		}
+	}
+}
+
+// The queries of the probes package bind their parameters by number, some
+// more than once and out of order
+func TestSQLiteDriverPlaceholders(t *testing.T) {
+	db, err := OpenSQLiteDatabase(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var a, b, c string
+	err = db.QueryRow(`SELECT $2, $1, $2 || '$1'`, "one", "two").Scan(&a, &b, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != "two" || b != "one" || c != "two$1" {
+		t.Errorf("expected the parameters by number (got: %s, %s, %s)", a, b, c)
+	}
+}
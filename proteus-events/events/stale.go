@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"expvar"
+	"time"
+)
+
+// staleStats counts what the stale device reaper did since this instance
+// started, published with expvar as "stale_devices".
+var staleStats = expvar.NewMap("stale_devices")
+
+// ReapStaleDevices deactivates the probes that haven't been in contact for
+// longer than after, invalidating their tokens and cancelling their pending
+// tasks. It returns how many probes were deactivated.
+func ReapStaleDevices(store Store, after time.Duration) (int, error) {
+	probeIDs, err := store.DeactivateStaleProbes(context.Background(),
+												time.Now().UTC().Add(-after))
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, probeID := range probeIDs {
+		n, err := CancelProbeTasks(context.Background(), probeID, store)
+		if err != nil {
+			continue
+		}
+		cancelled += n
+	}
+	staleStats.Add("runs", 1)
+	staleStats.Add("deactivated", int64(len(probeIDs)))
+	staleStats.Add("cancelled_tasks", int64(cancelled))
+	if len(probeIDs) > 0 {
+		ctx.Infof("deactivated %d devices not seen in %s, cancelling %d tasks",
+					len(probeIDs), after, cancelled)
+	}
+	return len(probeIDs), nil
+}
+
+func RunStaleDeviceReaper(store Store, interval time.Duration,
+							after time.Duration) {
+	if after <= 0 {
+		ctx.Info("stale device reaping is disabled")
+		return
+	}
+	for range time.Tick(interval) {
+		ReapStaleDevices(store, after)
+	}
+}
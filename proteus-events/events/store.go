@@ -0,0 +1,310 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-common/settings"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/spf13/viper"
+)
+
+// JobStore keeps the jobs and where their schedule is at
+type JobStore interface {
+	// CreateJob stores the job, with its cohort when it is frozen
+	CreateJob(cx context.Context, jd JobData, schedule Schedule) error
+	// GetJob returns the target and the task of the job
+	GetJob(cx context.Context, jobID string) (JobData, error)
+	// ListJobs returns the jobs, the deleted ones only when showDeleted is
+	// set
+	ListJobs(cx context.Context, showDeleted bool) ([]JobData, error)
+	JobStats(cx context.Context, jobID string) (JobStats, error)
+	// DeleteJob stops the job from being run, it is kept until it is purged
+	// and can be restored until then
+	DeleteJob(cx context.Context, jobID string) error
+	// RestoreJob undoes DeleteJob and returns the job for the scheduler to
+	// run again, or ErrJobNotFound when no deleted job has the id
+	RestoreJob(cx context.Context, jobID string) (*Job, error)
+	// PurgeJobs removes the jobs deleted before the time for good, and
+	// returns how many there were
+	PurgeJobs(cx context.Context, before time.Time) (int64, error)
+	// ActiveJobs returns the jobs the scheduler runs
+	ActiveJobs(cx context.Context) ([]*Job, error)
+	// SaveJobRun records that the job ran
+	SaveJobRun(cx context.Context, j *Job) error
+	// JobWebhook returns the webhook URL of the job and its secret
+	JobWebhook(cx context.Context, jobID string) (string, string, error)
+	// JobOwner returns the account which created the job, deleted or not,
+	// and the accounts it's shared with
+	JobOwner(cx context.Context, jobID string) (string, []string, error)
+	// ShareJob replaces the accounts the job is shared with
+	ShareJob(cx context.Context, jobID string, sharedWith []string) error
+	// JobResults returns the results submitted for the tasks of the job
+	JobResults(cx context.Context, jobID string) ([]TaskResult, error)
+}
+
+// TaskStore keeps the tasks given to the probes
+type TaskStore interface {
+	// CreateTasks creates the tasks of the probes in run runID of the job,
+	// or returns the ones created by a previous attempt. The notification
+	// of every new task, notice with the probe and the task filled in, is
+	// queued along with it. The probes whose task couldn't be created are
+	// listed in a *TaskBatchError.
+	CreateTasks(cx context.Context, jobID string, probeIDs []string,
+				t Task, runID int64, notice JobTarget) ([]CreatedTask, error)
+	// GetTask returns the task whoever it belongs to, or ErrTaskNotFound
+	GetTask(cx context.Context, tID string) (Task, error)
+	// TasksForProbe returns the tasks of the probe waiting to be accepted
+	// and created after the cursor
+	TasksForProbe(cx context.Context, probeID string,
+					cursor TaskCursor) ([]Task, error)
+	// TaskHistory returns a page of the tasks of the probe and how many it
+	// has in total
+	TaskHistory(cx context.Context, probeID string, limit int,
+				offset int) ([]TaskHistoryItem, int64, error)
+	// SetTaskState moves the task from the state from to state, the caller
+	// checked the transition is allowed. It returns ErrInconsistentState
+	// when the task is no longer in from, e.g. because a concurrent request
+	// moved it first.
+	SetTaskState(cx context.Context, tID string, from taskstate.State,
+				state taskstate.State) error
+	MarkTasksNotified(cx context.Context, tIDs []string) error
+	// UnfinishedTasks returns the ids of the tasks of the probe which can
+	// still be cancelled
+	UnfinishedTasks(cx context.Context, probeID string) ([]string, error)
+	// SaveTaskResult stores the result of the task and returns its id
+	SaveTaskResult(cx context.Context, tr TaskResult) (string, error)
+	// SaveTaskError stores the error of the task and returns its id
+	SaveTaskError(cx context.Context, te TaskError) (string, error)
+	SetTaskMeasurements(cx context.Context, tID string, req TaskDoneReq) error
+	// SetTaskLease makes the lease on the task expire at expiresAt
+	SetTaskLease(cx context.Context, tID string, expiresAt time.Time) error
+	// ExpireTaskLeases returns the accepted tasks whose lease expired to
+	// the ready state, and returns them
+	ExpireTaskLeases(cx context.Context) ([]Task, error)
+	// ReapTasks deletes the tasks finished for longer than retention, or
+	// moves them to the archive when core.archive-tasks is set, and returns
+	// them
+	ReapTasks(cx context.Context, retention time.Duration) ([]Task, error)
+
+	// ClaimNotices claims the notices of the outbox due to be sent, at most
+	// limit of them, see RelayNotices
+	ClaimNotices(cx context.Context, limit int) ([]outboxNotice, error)
+	// RemoveNotice removes the notice of the task from the outbox
+	RemoveNotice(cx context.Context, taskID string) error
+	// RetryNotice sends the notice again after its backoff
+	RetryNotice(cx context.Context, n outboxNotice, sendErr error) error
+
+	// QueueWebhooks queues the events for the webhooks of their jobs, see
+	// RelayWebhooks
+	QueueWebhooks(cx context.Context, deliveries []webhookDelivery) error
+	// ClaimWebhooks claims the deliveries due to be sent, at most limit of
+	// them
+	ClaimWebhooks(cx context.Context, limit int) ([]webhookDelivery, error)
+	// RemoveWebhook removes the delivery, sent or given up on
+	RemoveWebhook(cx context.Context, id string) error
+	// RetryWebhook sends the delivery again after its backoff
+	RetryWebhook(cx context.Context, d webhookDelivery, sendErr error) error
+
+	// ReserveIdempotencyKey claims the key of the probe for the request,
+	// it returns false when the key was already used
+	ReserveIdempotencyKey(cx context.Context, probeID string, key string,
+							path string, hash string) (bool, error)
+	// IdempotentResponse returns what the key was used for, or nil when it
+	// isn't in use
+	IdempotentResponse(cx context.Context, probeID string,
+						key string) (*storedResponse, error)
+	StoreIdempotentResponse(cx context.Context, probeID string, key string,
+							statusCode int, body []byte) error
+	// ReleaseIdempotencyKey frees a key reserved for a request which has no
+	// response yet
+	ReleaseIdempotencyKey(cx context.Context, probeID string, key string) error
+	// ReapIdempotencyKeys deletes the keys older than ttl, after which a
+	// retry is no longer recognised as such, and returns how many there were
+	ReapIdempotencyKeys(cx context.Context, ttl time.Duration) (int64, error)
+}
+
+// CreatedTask is a task created by CreateTasks
+type CreatedTask struct {
+	ProbeId		string
+	TaskId		string
+	// The probe still has to be notified about the task
+	NeedsNotify	bool
+}
+
+// TaskBatchError tells which tasks CreateTasks failed to create
+type TaskBatchError struct {
+	// The probes left without a task
+	Failed	[]string
+	// The first error
+	Err		error
+}
+
+func (e *TaskBatchError) Error() string {
+	return fmt.Sprintf("failed to create the tasks of %d probes: %s",
+						len(e.Failed), e.Err)
+}
+
+func (e *TaskBatchError) Unwrap() error {
+	return e.Err
+}
+
+// taskChunkCreator creates the tasks of a chunk of probes in one go, given
+// the serialised arguments and notice of the tasks
+type taskChunkCreator func(chunk []string, taskArgs []byte,
+							notice []byte) ([]CreatedTask, error)
+
+// createTasksInChunks has createChunk create the tasks of the probes in
+// chunks of core.task-batch-size probes. The chunks which failed are
+// reported in a *TaskBatchError, along with the tasks of the others.
+func createTasksInChunks(probeIDs []string, t Task, notice JobTarget,
+						createChunk taskChunkCreator) ([]CreatedTask, error) {
+	var (
+		created []CreatedTask
+		batchErr *TaskBatchError
+	)
+	taskArgsStr, err := json.Marshal(t.Arguments)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise task arguments in createTasks")
+		return created, err
+	}
+	noticeStr, err := json.Marshal(notice)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise task notice in createTasks")
+		return created, err
+	}
+	size := viper.GetInt("core.task-batch-size")
+	if size <= 0 {
+		size = len(probeIDs)
+	}
+	for start := 0; start < len(probeIDs); start += size {
+		end := start + size
+		if end > len(probeIDs) {
+			end = len(probeIDs)
+		}
+		chunk := probeIDs[start:end]
+		tasks, err := createChunk(chunk, taskArgsStr, noticeStr)
+		if err != nil {
+			if batchErr == nil {
+				batchErr = &TaskBatchError{Err: err}
+			}
+			batchErr.Failed = append(batchErr.Failed, chunk...)
+			continue
+		}
+		created = append(created, tasks...)
+	}
+	if batchErr != nil {
+		return created, batchErr
+	}
+	return created, nil
+}
+
+// ProbeStore looks up the probes targeted by the jobs
+type ProbeStore interface {
+	ValidateTarget(cx context.Context, t Target) error
+	FindProbes(cx context.Context, t Target, runID int64,
+				testName string) ([]MatchingProbe, error)
+	// JobCohort returns the probes of the frozen cohort of the job
+	JobCohort(cx context.Context, jobID string) ([]MatchingProbe, error)
+	// ExportDeviceData returns everything stored about the probe
+	ExportDeviceData(cx context.Context, probeID string) (DeviceDataExport, error)
+	// IngestCoverage stores the measurement counts of the coverage gap mode
+	IngestCoverage(cx context.Context, entries []CoverageEntry) error
+
+	CreateProbeCohort(cx context.Context, pc ProbeCohort) error
+	ListProbeCohorts(cx context.Context) ([]ProbeCohort, error)
+	ProbeCohortMembers(cx context.Context, name string) ([]ProbeCohortMember, error)
+	// AddProbeCohortMembers returns how many of the probes weren't in the
+	// cohort already
+	AddProbeCohortMembers(cx context.Context, name string,
+							probeIDs []string) (int64, error)
+	RemoveProbeCohortMember(cx context.Context, name string, probeID string) error
+	DeleteProbeCohort(cx context.Context, name string) error
+
+	// PutSegment stores a new version of the segment and returns its number
+	PutSegment(cx context.Context, s Segment) (int64, error)
+	// GetSegment returns the given version of the segment, or the latest
+	// one if version is 0
+	GetSegment(cx context.Context, name string, version int64) (Segment, error)
+	ListSegments(cx context.Context) ([]Segment, error)
+	DeleteSegment(cx context.Context, name string) error
+}
+
+// DeviceStore keeps the registrations of the probes, which they make here
+// as well as with proteus-registry
+type DeviceStore interface {
+	// RegisterProbe adds the probe to the active probes with the account it
+	// logs in with, and returns its client ID
+	RegisterProbe(cx context.Context, req probes.ClientData) (string, error)
+	// ProbeSettings returns the settings of the probes of the country
+	// running the software version
+	ProbeSettings(cx context.Context, probeCC string,
+					softwareVersion string) (settings.Settings, error)
+	// DeactivateProbe stops the probe from being targeted and notified, or
+	// returns probes.ErrClientNotFound when it isn't active
+	DeactivateProbe(cx context.Context, probeID string) error
+	// RequestDeletion deactivates the probe and returns when its data will
+	// be purged, grace after the first time it was asked
+	RequestDeletion(cx context.Context, probeID string,
+					grace time.Duration) (time.Time, error)
+	// IsBlocked tells whether the probe is blocked, by id or by token
+	IsBlocked(cx context.Context, probeID string) (bool, error)
+	// TouchProbe records that the probe was seen now, at most once a minute
+	TouchProbe(cx context.Context, probeID string) error
+	// DeactivateStaleProbes deactivates the probes which weren't seen since
+	// before and returns their ids
+	DeactivateStaleProbes(cx context.Context, before time.Time) ([]string, error)
+	// PurgeDeletedDevices purges everything stored about the probes whose
+	// deletion was requested more than grace ago, and returns how many
+	// there were
+	PurgeDeletedDevices(cx context.Context, grace time.Duration) (int, error)
+}
+
+// AlertStore keeps the alerts shown to the users of the probes
+type AlertStore interface {
+	// AddAlert stores the alert, publishing it if it's due, and returns its
+	// id
+	AddAlert(cx context.Context, a Alert) (string, error)
+	ListAlerts(cx context.Context) ([]Alert, error)
+	WithdrawAlert(cx context.Context, alertID string) error
+	// ProbeAlerts returns the published alerts the probe hasn't
+	// acknowledged yet
+	ProbeAlerts(cx context.Context, probeID string) ([]ProbeAlert, error)
+	AckAlert(cx context.Context, alertID string, probeID string) error
+	// PublishDueAlerts publishes the scheduled alerts whose time has come,
+	// and returns how many there were
+	PublishDueAlerts(cx context.Context) (int, error)
+}
+
+// Store is what the handlers and the scheduler keep the jobs and tasks in,
+// PostgresStore being the one used by the service. Every call is given the
+// context of the request it serves, or context.Background() outside of one,
+// and gives up once it is done.
+type Store interface {
+	JobStore
+	TaskStore
+	ProbeStore
+	DeviceStore
+	AlertStore
+}
+
+var ErrUnsupportedDriver = errors.New("unsupported database driver")
+
+// checkStoreDriver makes sure database.driver is one the Store can be kept
+// in: postgres, or sqlite3 for development. With sqlite3 the probes and the
+// credentials are kept in database.sqlite-path too, so the instance runs
+// without postgres but doesn't share them with proteus-registry and
+// proteus-notify.
+func checkStoreDriver() error {
+	switch viper.GetString("database.driver") {
+	case "postgres", "sqlite3":
+		return nil
+	default:
+		return ErrUnsupportedDriver
+	}
+}
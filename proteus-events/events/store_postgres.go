@@ -0,0 +1,1241 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-common/settings"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+// PostgresStore is the Store of the jobs and tasks in the database shared
+// with proteus-registry, where the active probes are.
+type PostgresStore struct {
+	db					*sqlx.DB
+	// The read-only replica the listings and the stats are read from, if
+	// any, falling back to db while it is unreachable
+	replica				*sqlx.DB
+	replicaLock			sync.Mutex
+	replicaDownUntil	time.Time
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// UseReplica reads the listings and the stats from the replica
+func (p *PostgresStore) UseReplica(replica *sqlx.DB) {
+	p.replica = replica
+}
+
+// queryContext bounds the queries run with cx by database.query-timeout
+func queryContext(cx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := viper.GetDuration("database.query-timeout"); timeout > 0 {
+		return context.WithTimeout(cx, timeout)
+	}
+	return context.WithCancel(cx)
+}
+
+// replicaUnreachable tells whether the query failed because the replica
+// couldn't be reached, rather than because the server refused it
+func replicaUnreachable(err error) bool {
+	if _, ok := err.(*pq.Error); ok {
+		return false
+	}
+	return err != sql.ErrNoRows
+}
+
+// read runs the query on the replica, or on the primary when there is no
+// replica or it is unreachable. An unreachable replica is left alone for
+// database.replica-retry.
+func (p *PostgresStore) read(cx context.Context,
+							query func(cx context.Context, db *sqlx.DB) error) error {
+	if p.replica != nil {
+		p.replicaLock.Lock()
+		down := time.Now().Before(p.replicaDownUntil)
+		p.replicaLock.Unlock()
+		if !down {
+			replicaCx, cancel := queryContext(cx)
+			err := query(replicaCx, p.replica)
+			cancel()
+			// There is no point in asking the primary when the request is
+			// gone
+			if err == nil || !replicaUnreachable(err) || cx.Err() != nil {
+				return err
+			}
+			ctx.WithError(err).Warn("read replica unreachable, using the primary")
+			p.replicaLock.Lock()
+			p.replicaDownUntil = time.Now().Add(viper.GetDuration("database.replica-retry"))
+			p.replicaLock.Unlock()
+		}
+	}
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return query(cx, p.db)
+}
+
+// JobStats returns how the tasks of the job are doing
+func (p *PostgresStore) JobStats(cx context.Context, jobID string) (JobStats, error) {
+	var stats JobStats
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		stats, err = GetJobStats(cx, jobID, db)
+		return err
+	})
+	return stats, err
+}
+
+// CreateJob stores the job, with its cohort when it is frozen
+func (p *PostgresStore) CreateJob(cx context.Context, jd JobData,
+									schedule Schedule) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := p.db.BeginTx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+
+	{
+		query := fmt.Sprintf(`INSERT INTO %s (
+			id, comment,
+			schedule, delay,
+			target_countries,
+			target_platforms,
+			task_test_name,
+			task_arguments,
+			creation_time,
+			times_run,
+			next_run_at,
+			is_done,
+			state,
+			priority,
+			webhook_url,
+			webhook_secret,
+			target_version,
+			target_languages,
+			target_sample_rate,
+			target_probe_ids,
+			target_exclude_probe_ids,
+			target_tags,
+			target_exclude_countries,
+			target_exclude_platforms,
+			target_active_within,
+			target_regions,
+			target_expression,
+			target_segment,
+			target_mode,
+			target_coverage_window,
+			target_coverage_cells,
+			target_cohort,
+			dry_run,
+			notification,
+			notification_window,
+			target_probe_cohorts,
+			created_by,
+			shared_with
+		) VALUES (
+			$1, $2,
+			$3, $4,
+			$5,
+			$6,
+			$7,
+			$8,
+			$9,
+			$10,
+			$11,
+			$12,
+			$13,
+			$14,
+			$15,
+			$16,
+			$17,
+			$18,
+			$19,
+			$20,
+			$21,
+			$22,
+			$23,
+			$24,
+			$25,
+			$26,
+			$27,
+			$28,
+			$29,
+			$30,
+			$31,
+			$32,
+			$33,
+			$34,
+			$35,
+			$36,
+			$37,
+			$38)`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+
+		stmt, err := tx.PrepareContext(cx, query)
+		if (err != nil) {
+			ctx.WithError(err).Error("failed to prepare jobs query")
+			return err
+		}
+		defer stmt.Close()
+
+		taskArgsStr, err := json.Marshal(jd.Task.Arguments)
+		if err != nil {
+			ctx.WithError(err).Error("failed to serialise task arguments")
+			return err
+		}
+		_, err = stmt.ExecContext(cx, jd.Id, jd.Comment,
+							jd.Schedule, jd.Delay,
+							pq.Array(jd.Target.Countries),
+							pq.Array(jd.Target.Platforms),
+							jd.Task.TestName,
+							taskArgsStr,
+							time.Now().UTC(),
+							0,
+							schedule.StartTime,
+							false,
+							"active",
+							jd.Priority,
+							jd.WebhookURL,
+							jd.WebhookSecret,
+							jd.Target.Version,
+							pq.Array(jd.Target.Languages),
+							jd.Target.SampleRate,
+							pq.Array(jd.Target.ProbeIds),
+							pq.Array(jd.Target.ExcludeProbeIds),
+							pq.Array(jd.Target.Tags),
+							pq.Array(jd.Target.ExcludeCountries),
+							pq.Array(jd.Target.ExcludePlatforms),
+							jd.Target.ActiveWithin,
+							pq.Array(jd.Target.Regions),
+							jd.Target.Expression,
+							jd.Target.Segment,
+							jd.Target.Mode,
+							jd.Target.CoverageWindow,
+							jd.Target.CoverageCells,
+							jd.Target.Cohort,
+							jd.DryRun,
+							jd.Notification,
+							jd.NotificationWindow,
+							pq.Array(jd.Target.ProbeCohorts),
+							jd.CreatedBy,
+							pq.Array(jd.SharedWith))
+		if err != nil {
+			tx.Rollback()
+			ctx.WithError(err).Error("failed to insert into jobs table")
+			return err
+		}
+	}
+
+	if jd.Target.Cohort == FrozenCohort {
+		err = freezeCohort(cx, jd.Id, jd.Target, jd.Task.TestName, tx, p.db)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+	return nil
+}
+
+// GetJob returns the target and the task of the job
+func (p *PostgresStore) GetJob(cx context.Context, jobID string) (JobData, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row jobRow
+	query := fmt.Sprintf(`SELECT
+		id,
+		%s,
+		task_test_name,
+		task_arguments,
+		COALESCE(dry_run, FALSE) AS dry_run,
+		COALESCE(notification, '') AS notification,
+		COALESCE(notification_window, '') AS notification_window
+		FROM %s
+		WHERE id = $1 AND deleted_at IS NULL`,
+		targetColumns,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+
+	err := p.db.GetContext(cx, &row, query, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return JobData{Id: jobID}, ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to obtain targets")
+		return JobData{Id: jobID}, err
+	}
+	jd, err := row.jobData()
+	if err != nil {
+		ctx.WithError(err).Error("failed to unmarshal json")
+		return jd, err
+	}
+	return jd, nil
+}
+
+func (p *PostgresStore) ListJobs(cx context.Context, showDeleted bool) ([]JobData, error) {
+	var jobs []JobData
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		jobs, err = listJobs(cx, db, showDeleted)
+		return err
+	})
+	return jobs, err
+}
+
+func listJobs(cx context.Context, db *sqlx.DB, showDeleted bool) ([]JobData, error) {
+	// XXX this can probably be unified with ActiveJobs()
+	var (
+		currentJobs []JobData
+		rows []jobRow
+	)
+	query := fmt.Sprintf(`SELECT
+		id, comment,
+		creation_time,
+		schedule, delay,
+		task_test_name,
+		task_arguments,
+		COALESCE(state, 'active') AS state,
+		priority,
+		COALESCE(webhook_url, '') AS webhook_url,
+		COALESCE(dry_run, FALSE) AS dry_run,
+		COALESCE(notification, '') AS notification,
+		COALESCE(notification_window, '') AS notification_window,
+		COALESCE(created_by, '') AS created_by,
+		shared_with,
+		deleted_at,
+		%s
+		FROM %s`,
+		targetColumns,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if showDeleted == false {
+		query += " WHERE deleted_at IS NULL"
+	}
+	err := db.SelectContext(cx, &rows, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list jobs")
+		return currentJobs, err
+	}
+	for _, row := range rows {
+		jd, err := row.jobData()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal JSON")
+			return currentJobs, err
+		}
+		currentJobs = append(currentJobs, jd)
+	}
+	return currentJobs, nil
+}
+
+// DeleteJob marks the job as deleted, the time it was first deleted at and
+// the state it was in are kept when it is deleted again
+func (p *PostgresStore) DeleteJob(cx context.Context, jobID string) (error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $2,
+		state_before_delete = CASE WHEN deleted_at IS NULL
+			THEN COALESCE(state, 'active') ELSE state_before_delete END,
+		deleted_at = COALESCE(deleted_at, $3)
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	res, err := p.db.ExecContext(cx, query, jobID, "deleted", time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed delete job")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// RestoreJob puts the deleted job back in the state it was deleted in
+func (p *PostgresStore) RestoreJob(cx context.Context, jobID string) (*Job, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row jobRow
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = COALESCE(state_before_delete, $2),
+		state_before_delete = NULL,
+		deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING
+		id, comment,
+		schedule, delay,
+		times_run,
+		next_run_at,
+		is_done`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := p.db.GetContext(cx, &row, query, jobID, "active")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to restore job")
+		return nil, err
+	}
+	return row.job()
+}
+
+// PurgeJobs deletes the jobs deleted before the time along with their
+// frozen cohorts. Their tasks are left to the task reaper.
+func (p *PostgresStore) PurgeJobs(cx context.Context, before time.Time) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var purged int64
+	query := fmt.Sprintf(`WITH purged AS (
+			DELETE FROM %s WHERE deleted_at < $1
+			RETURNING id
+		), cohorts AS (
+			DELETE FROM %s WHERE job_id IN (SELECT id FROM purged)
+		) SELECT COUNT(*) FROM purged`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")),
+		pq.QuoteIdentifier(viper.GetString("database.job-cohorts-table")))
+	err := p.db.GetContext(cx, &purged, query, before)
+	if err != nil {
+		ctx.WithError(err).Error("failed to purge the deleted jobs")
+		return 0, err
+	}
+	return purged, nil
+}
+
+// ActiveJobs returns the jobs the scheduler runs
+func (p *PostgresStore) ActiveJobs(cx context.Context) ([]*Job, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var rows []jobRow
+	allJobs := []*Job{}
+	query := fmt.Sprintf(`SELECT
+		id, comment,
+		schedule, delay,
+		times_run,
+		next_run_at,
+		is_done
+		FROM %s
+		WHERE state = 'active'`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := p.db.SelectContext(cx, &rows, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list jobs")
+		return allJobs, err
+	}
+	for _, row := range rows {
+		j, err := row.job()
+		if err != nil {
+			return allJobs, err
+		}
+		allJobs = append(allJobs, j)
+	}
+	return allJobs, nil
+}
+
+// SaveJobRun records that the job ran
+func (p *PostgresStore) SaveJobRun(cx context.Context, j *Job) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := p.db.BeginTx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET
+		times_run = $2,
+		next_run_at = $3,
+		is_done = $4
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+
+	stmt, err := tx.PrepareContext(cx, query)
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to prepare update jobs query")
+		return err
+	}
+	_, err = stmt.ExecContext(cx, j.Id,
+						j.TimesRun,
+						j.NextRunAt.Format(ISOUTCTimeLayout),
+						j.IsDone)
+
+	if (err != nil) {
+		tx.Rollback()
+		ctx.WithError(err).Error("failed to jobs table, rolling back")
+		return errors.New("failed to update jobs table")
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+	return nil
+}
+
+// JobWebhook returns the webhook URL of the job and its secret
+func (p *PostgresStore) JobWebhook(cx context.Context,
+									jobID string) (string, string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row jobRow
+	query := fmt.Sprintf(`SELECT
+		COALESCE(webhook_url, '') AS webhook_url,
+		COALESCE(webhook_secret, '') AS webhook_secret
+		FROM %s
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := p.db.GetContext(cx, &row, query, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to lookup job webhook")
+		return "", "", err
+	}
+	return row.WebhookURL, row.WebhookSecret, nil
+}
+
+// JobOwner returns the account which created the job and the ones it's
+// shared with
+func (p *PostgresStore) JobOwner(cx context.Context,
+								jobID string) (string, []string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return getJobOwner(cx, jobID, p.db)
+}
+
+func (p *PostgresStore) ShareJob(cx context.Context, jobID string,
+								sharedWith []string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return ShareJob(cx, jobID, sharedWith, p.db)
+}
+
+// JobResults returns the results submitted for the tasks of the job
+func (p *PostgresStore) JobResults(cx context.Context, jobID string) ([]TaskResult, error) {
+	var results []TaskResult
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		results, err = ListJobResults(cx, jobID, db)
+		return err
+	})
+	return results, err
+}
+
+// CreateTasks creates the tasks of the probes in run runID of the job,
+// in chunks of core.task-batch-size tasks each copied over in one
+// transaction. A job run creates at most one task per probe, so if the
+// dispatch is being retried the existing tasks are returned instead. The
+// chunks which failed are reported in a *TaskBatchError, along with the
+// tasks of the others.
+func (p *PostgresStore) CreateTasks(cx context.Context, jobID string,
+									probeIDs []string, t Task,
+									runID int64,
+									notice JobTarget) ([]CreatedTask, error) {
+	return createTasksInChunks(probeIDs, t, notice,
+		func(chunk []string, taskArgs []byte, notice []byte) ([]CreatedTask, error) {
+			return p.createTaskChunk(cx, jobID, chunk, t.TestName,
+									taskArgs, runID, notice)
+		})
+}
+
+// createTaskChunk copies the tasks into a temporary table and moves them
+// over to the tasks table, skipping the ones created by a previous attempt,
+// and queues the notifications of the new ones in the outbox.
+func (p *PostgresStore) createTaskChunk(cx context.Context, jobID string,
+										probeIDs []string,
+										testName string, taskArgs []byte,
+										runID int64,
+										notice []byte) ([]CreatedTask, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := p.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open createTasks transaction")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(cx, `CREATE TEMPORARY TABLE new_tasks (
+		id UUID NOT NULL,
+		probe_id UUID NOT NULL
+	) ON COMMIT DROP`)
+	if err != nil {
+		ctx.WithError(err).Error("failed to create the new tasks table")
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(cx, pq.CopyIn("new_tasks", "id", "probe_id"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to prepare task copy")
+		return nil, err
+	}
+	for _, probeID := range probeIDs {
+		if _, err = stmt.ExecContext(cx, uuid.NewV4().String(), probeID); err != nil {
+			ctx.WithError(err).Error("failed to copy task")
+			stmt.Close()
+			return nil, err
+		}
+	}
+	if _, err = stmt.ExecContext(cx); err != nil {
+		ctx.WithError(err).Error("failed to copy tasks")
+		stmt.Close()
+		return nil, err
+	}
+	if err = stmt.Close(); err != nil {
+		ctx.WithError(err).Error("failed to copy tasks")
+		return nil, err
+	}
+
+	// The tasks table is partitioned, which rules out a unique index on
+	// the run: the attempts to create the tasks of a run take turns instead
+	_, err = tx.ExecContext(cx, `SELECT pg_advisory_xact_lock(
+		hashtext($1::text || ':' || $2::text))`, jobID, runID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to lock the job run")
+		return nil, err
+	}
+
+	tasksTable := pq.QuoteIdentifier(viper.GetString("database.tasks-table"))
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, probe_id,
+		job_id, test_name,
+		arguments,
+		state,
+		progress,
+		creation_time,
+		last_updated,
+		run_id
+	) SELECT
+		id, probe_id,
+		$1::uuid, $2::varchar,
+		$3::jsonb,
+		$4::varchar,
+		0,
+		$5::timestamptz,
+		$5::timestamptz,
+		$6::int
+		FROM new_tasks AS n
+		WHERE NOT EXISTS (
+			SELECT 1 FROM %s AS t
+			WHERE t.job_id = $1::uuid AND t.run_id = $6::int AND
+				t.probe_id = n.probe_id
+		)`, tasksTable, tasksTable)
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(cx, query, jobID, testName, string(taskArgs),
+					string(taskstate.Ready), now, runID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into tasks table")
+		return nil, err
+	}
+
+	// The tasks of a previous attempt kept their id, and their notice
+	query = fmt.Sprintf(`INSERT INTO %s (
+		task_id, probe_id,
+		notice,
+		attempts,
+		next_attempt_at,
+		creation_time
+	) SELECT
+		n.id, n.probe_id,
+		$1::jsonb,
+		0,
+		$2::timestamptz,
+		$2::timestamptz
+		FROM new_tasks AS n
+		JOIN %s AS t ON t.id = n.id
+	ON CONFLICT (task_id) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table")),
+		tasksTable)
+	_, err = tx.ExecContext(cx, query, string(notice), now)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into task outbox")
+		return nil, err
+	}
+
+	// The tasks created by a previous attempt are returned too, only the
+	// ones still ready need a notification
+	query = fmt.Sprintf(`SELECT
+		t.probe_id, t.id,
+		COALESCE(t.state, 'ready') = $3 AS needs_notify,
+		t.id = n.id AS is_new
+		FROM %s AS t
+		JOIN new_tasks AS n ON n.probe_id = t.probe_id
+		WHERE t.job_id = $1 AND t.run_id = $2`, tasksTable)
+	var rows []createdTaskRow
+	err = tx.SelectContext(cx, &rows, query, jobID, runID, string(taskstate.Ready))
+	if err != nil {
+		ctx.WithError(err).Error("failed to lookup created tasks")
+		return nil, err
+	}
+	var created []CreatedTask
+	for _, row := range rows {
+		if !row.IsNew {
+			ctx.Debugf("task for %s in run %d already exists", row.ProbeId, runID)
+		}
+		created = append(created, CreatedTask{
+			ProbeId: row.ProbeId,
+			TaskId: row.TaskId,
+			NeedsNotify: row.NeedsNotify,
+		})
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction in tasks table, rolling back")
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetTask looks up a task without checking who it belongs to
+func (p *PostgresStore) GetTask(cx context.Context, tID string) (Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row taskRow
+	query := fmt.Sprintf(`SELECT
+		id,
+		probe_id,
+		COALESCE(job_id::text, '') AS job_id,
+		test_name,
+		arguments,
+		COALESCE(state, 'ready') AS state
+		FROM %s
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err := p.db.GetContext(cx, &row, query, tID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, ErrTaskNotFound
+		}
+		ctx.WithError(err).Error("failed to get task")
+		return Task{}, err
+	}
+	task, err := row.task()
+	if err != nil {
+		ctx.WithError(err).Error("failed to unmarshal json")
+		return task, err
+	}
+	return task, nil
+}
+
+// TasksForProbe returns the tasks of a probe that are waiting to be
+// accepted and were created after the position of the cursor. Tasks of
+// tests the probe no longer supports are left out.
+func (p *PostgresStore) TasksForProbe(cx context.Context, uID string,
+										cursor TaskCursor) ([]Task, error) {
+	var tasks []Task
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		tasks, err = tasksForProbe(cx, db, uID, cursor)
+		return err
+	})
+	return tasks, err
+}
+
+func tasksForProbe(cx context.Context, db *sqlx.DB, uID string,
+					cursor TaskCursor) ([]Task, error) {
+	var (
+		tasks []Task
+		rows []taskRow
+	)
+	query := fmt.Sprintf(`SELECT
+		t.id,
+		t.test_name,
+		t.arguments,
+		COALESCE(j.priority, 0) AS priority,
+		t.creation_time
+		FROM %s AS t
+		LEFT JOIN %s AS j ON j.id = t.job_id
+		JOIN %s AS p ON p.id = t.probe_id
+		WHERE
+		t.state IN ('ready', 'notified') AND
+		t.probe_id = $1 AND
+		j.deleted_at IS NULL AND
+		t.creation_time >= $2 AND
+		(t.creation_time > $2 OR t.id::text > $3) AND
+		%s AND
+		%s
+		ORDER BY j.priority DESC NULLS LAST, t.creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		supportsTest("p", "t.test_name"),
+		probes.NotBlockedCondition("p"))
+
+	err := db.SelectContext(cx, &rows, query, uID, cursor.Time, cursor.Id)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get task list")
+		return tasks, err
+	}
+	for _, row := range rows {
+		task, err := row.task()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// TaskHistory returns a page of the tasks of a probe, in any state, most
+// recent first, together with the total number of tasks it has.
+func (p *PostgresStore) TaskHistory(cx context.Context, uID string, limit int,
+									offset int) ([]TaskHistoryItem, int64, error) {
+	var (
+		tasks []TaskHistoryItem
+		total int64
+	)
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		tasks, total, err = taskHistory(cx, db, uID, limit, offset)
+		return err
+	})
+	return tasks, total, err
+}
+
+func taskHistory(cx context.Context, db *sqlx.DB, uID string, limit int,
+					offset int) ([]TaskHistoryItem, int64, error) {
+	var (
+		total int64
+		tasks []TaskHistoryItem
+		rows []taskRow
+	)
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE probe_id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err := db.GetContext(cx, &total, query, uID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count tasks")
+		return tasks, 0, err
+	}
+
+	query = fmt.Sprintf(`SELECT
+		id,
+		test_name,
+		arguments,
+		COALESCE(state, 'ready') AS state,
+		creation_time,
+		COALESCE(last_updated, creation_time) AS last_updated
+		FROM %s
+		WHERE probe_id = $1
+		ORDER BY creation_time DESC
+		LIMIT $2 OFFSET $3`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err = db.SelectContext(cx, &rows, query, uID, limit, offset)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get task history")
+		return tasks, 0, err
+	}
+	for _, row := range rows {
+		task, err := row.historyItem()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return tasks, 0, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, total, nil
+}
+
+// SetTaskState moves the task to state and records when it happened
+func (p *PostgresStore) SetTaskState(cx context.Context, tID string,
+										from taskstate.State,
+										to taskstate.State) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	now := time.Now().UTC()
+	args := []interface{}{tID, string(to), now, string(from)}
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $2,
+		last_updated = $3`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	if col := taskstate.TimeColumn(to); col != "" {
+		query += fmt.Sprintf(`,
+		%s = $3`, pq.QuoteIdentifier(col))
+	}
+	// Accepting a task grants the probe a lease on it
+	if to == taskstate.Accepted {
+		query += `,
+		lease_expires_at = $5`
+		args = append(args, now.Add(viper.GetDuration("core.task-lease")))
+	}
+	// The state is checked again in the update, so that of two requests
+	// racing to move the task only the first one wins
+	query += " WHERE id = $1 AND COALESCE(state, 'ready') = $4"
+
+	res, err := p.db.ExecContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Errorf("failed to move task to %s", to)
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInconsistentState
+	}
+	return nil
+}
+
+// MarkTasksNotified records that the probe learnt about the tasks in tIDs,
+// when it fetches its task list for example. Tasks that were already
+// notified or moved on are left alone.
+func (p *PostgresStore) MarkTasksNotified(cx context.Context, tIDs []string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	if len(tIDs) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $2,
+		notification_time = $3,
+		last_updated = $3
+		WHERE id::text = ANY($1) AND state = ANY($4)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	_, err := p.db.ExecContext(cx, query, pq.Array(tIDs), string(taskstate.Notified),
+						time.Now().UTC(),
+						pq.Array(taskstate.Strings(taskstate.ValidFrom(taskstate.Notified))))
+	if err != nil {
+		ctx.WithError(err).Error("failed to mark tasks as notified")
+	}
+	return err
+}
+
+// UnfinishedTasks returns the ids of the tasks of the probe which can still
+// be cancelled
+func (p *PostgresStore) UnfinishedTasks(cx context.Context, probeID string) ([]string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`SELECT id FROM %s
+		WHERE probe_id = $1 AND state = ANY($2)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	var tIDs []string
+	err := p.db.SelectContext(cx, &tIDs, query, probeID,
+		pq.Array(taskstate.Strings(taskstate.ValidFrom(taskstate.Cancelled))))
+	if err != nil {
+		ctx.WithError(err).Error("failed to list probe tasks")
+		return nil, err
+	}
+	return tIDs, nil
+}
+
+func (p *PostgresStore) SaveTaskResult(cx context.Context, tr TaskResult) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return saveTaskResult(cx, tr, p.db)
+}
+
+func (p *PostgresStore) SaveTaskError(cx context.Context, te TaskError) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return saveTaskError(cx, te, p.db)
+}
+
+func (p *PostgresStore) SetTaskMeasurements(cx context.Context, tID string,
+											req TaskDoneReq) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return SetTaskMeasurements(cx, tID, req, p.db)
+}
+
+func (p *PostgresStore) SetTaskLease(cx context.Context, tID string,
+									expiresAt time.Time) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return setTaskLease(cx, tID, expiresAt, p.db)
+}
+
+// ExpireTaskLeases returns the accepted tasks whose lease expired to the
+// ready state
+func (p *PostgresStore) ExpireTaskLeases(cx context.Context) ([]Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return ExpireTaskLeases(cx, p.db)
+}
+
+func (p *PostgresStore) ReapTasks(cx context.Context,
+									retention time.Duration) ([]Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return ReapTasks(cx, retention, p.db)
+}
+
+func (p *PostgresStore) ClaimNotices(cx context.Context,
+									limit int) ([]outboxNotice, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return claimNotices(cx, limit, p.db)
+}
+
+func (p *PostgresStore) RemoveNotice(cx context.Context, taskID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return removeNotice(cx, taskID, p.db)
+}
+
+func (p *PostgresStore) RetryNotice(cx context.Context, n outboxNotice,
+									sendErr error) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return retryNotice(cx, n, sendErr, p.db)
+}
+
+func (p *PostgresStore) QueueWebhooks(cx context.Context,
+										deliveries []webhookDelivery) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return queueWebhooks(cx, deliveries, p.db)
+}
+
+func (p *PostgresStore) ClaimWebhooks(cx context.Context,
+										limit int) ([]webhookDelivery, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return claimWebhooks(cx, limit, p.db)
+}
+
+func (p *PostgresStore) RemoveWebhook(cx context.Context, id string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return removeWebhook(cx, id, p.db)
+}
+
+func (p *PostgresStore) RetryWebhook(cx context.Context, d webhookDelivery,
+										sendErr error) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return retryWebhook(cx, d, sendErr, p.db)
+}
+
+func (p *PostgresStore) ReserveIdempotencyKey(cx context.Context, probeID string,
+												key string, path string,
+												hash string) (bool, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return reserveKey(cx, probeID, key, path, hash, p.db)
+}
+
+func (p *PostgresStore) IdempotentResponse(cx context.Context, probeID string,
+											key string) (*storedResponse, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return getStoredResponse(cx, probeID, key, p.db)
+}
+
+func (p *PostgresStore) StoreIdempotentResponse(cx context.Context, probeID string,
+												key string, statusCode int,
+												body []byte) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return storeResponse(cx, probeID, key, statusCode, body, p.db)
+}
+
+func (p *PostgresStore) ReleaseIdempotencyKey(cx context.Context, probeID string,
+												key string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return releaseKey(cx, probeID, key, p.db)
+}
+
+func (p *PostgresStore) ReapIdempotencyKeys(cx context.Context,
+											ttl time.Duration) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return ReapIdempotencyKeys(cx, ttl, p.db)
+}
+
+// ValidateTarget checks that the target can be matched against the probes
+func (p *PostgresStore) ValidateTarget(cx context.Context, t Target) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return t.Validate(cx, p.db)
+}
+
+func (p *PostgresStore) FindProbes(cx context.Context, t Target, runID int64,
+									testName string) ([]MatchingProbe, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return t.FindProbes(cx, runID, testName, p.db)
+}
+
+// JobCohort returns the probes of the frozen cohort of the job
+func (p *PostgresStore) JobCohort(cx context.Context, jobID string) ([]MatchingProbe, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return getCohort(cx, jobID, p.db)
+}
+
+// ExportDeviceData returns everything stored about the probe
+func (p *PostgresStore) ExportDeviceData(cx context.Context,
+										probeID string) (DeviceDataExport, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return ExportDeviceData(cx, probeID, p.db)
+}
+
+func (p *PostgresStore) IngestCoverage(cx context.Context, entries []CoverageEntry) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return IngestCoverage(cx, entries, p.db)
+}
+
+func (p *PostgresStore) CreateProbeCohort(cx context.Context, pc ProbeCohort) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return CreateProbeCohort(cx, pc, p.db)
+}
+
+func (p *PostgresStore) ListProbeCohorts(cx context.Context) ([]ProbeCohort, error) {
+	var cohorts []ProbeCohort
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		cohorts, err = ListProbeCohorts(cx, db)
+		return err
+	})
+	return cohorts, err
+}
+
+func (p *PostgresStore) ProbeCohortMembers(cx context.Context,
+											name string) ([]ProbeCohortMember, error) {
+	var members []ProbeCohortMember
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		members, err = GetProbeCohortMembers(cx, name, db)
+		return err
+	})
+	return members, err
+}
+
+func (p *PostgresStore) AddProbeCohortMembers(cx context.Context, name string,
+												probeIDs []string) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return AddProbeCohortMembers(cx, name, probeIDs, p.db)
+}
+
+func (p *PostgresStore) RemoveProbeCohortMember(cx context.Context, name string,
+												probeID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return RemoveProbeCohortMember(cx, name, probeID, p.db)
+}
+
+func (p *PostgresStore) DeleteProbeCohort(cx context.Context, name string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return DeleteProbeCohort(cx, name, p.db)
+}
+
+func (p *PostgresStore) PutSegment(cx context.Context, s Segment) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return PutSegment(cx, s, p.db)
+}
+
+func (p *PostgresStore) GetSegment(cx context.Context, name string,
+									version int64) (Segment, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return GetSegment(cx, name, version, p.db)
+}
+
+func (p *PostgresStore) ListSegments(cx context.Context) ([]Segment, error) {
+	var segments []Segment
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		segments, err = ListSegments(cx, db)
+		return err
+	})
+	return segments, err
+}
+
+func (p *PostgresStore) DeleteSegment(cx context.Context, name string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return DeleteSegment(cx, name, p.db)
+}
+
+// AddAlert stores the alert and publishes it if it's due
+func (p *PostgresStore) AddAlert(cx context.Context, a Alert) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return AddAlert(cx, a, p.db)
+}
+
+func (p *PostgresStore) ListAlerts(cx context.Context) ([]Alert, error) {
+	var alerts []Alert
+	err := p.read(cx, func(cx context.Context, db *sqlx.DB) (err error) {
+		alerts, err = ListAlerts(cx, db)
+		return err
+	})
+	return alerts, err
+}
+
+func (p *PostgresStore) WithdrawAlert(cx context.Context, alertID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return WithdrawAlert(cx, alertID, p.db)
+}
+
+func (p *PostgresStore) ProbeAlerts(cx context.Context, probeID string) ([]ProbeAlert, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return GetAlertsForProbe(cx, probeID, p.db)
+}
+
+func (p *PostgresStore) AckAlert(cx context.Context, alertID string,
+								probeID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return AckAlert(cx, alertID, probeID, p.db)
+}
+
+func (p *PostgresStore) PublishDueAlerts(cx context.Context) (int, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return PublishDueAlerts(cx, p.db)
+}
+
+// The registrations of the probes are kept by the probes package, which
+// proteus-registry shares. It doesn't take a context, the queries only
+// being bounded by the timeouts of the connections.
+
+func (p *PostgresStore) RegisterProbe(cx context.Context,
+									req probes.ClientData) (string, error) {
+	return probes.Register(p.db, req)
+}
+
+func (p *PostgresStore) ProbeSettings(cx context.Context, probeCC string,
+									softwareVersion string) (settings.Settings, error) {
+	return settings.Resolve(p.db, probeCC, softwareVersion)
+}
+
+func (p *PostgresStore) DeactivateProbe(cx context.Context, probeID string) error {
+	return probes.Deactivate(p.db, probeID)
+}
+
+func (p *PostgresStore) RequestDeletion(cx context.Context, probeID string,
+										grace time.Duration) (time.Time, error) {
+	return probes.RequestDeletion(p.db, probeID, grace)
+}
+
+func (p *PostgresStore) IsBlocked(cx context.Context, probeID string) (bool, error) {
+	return probes.IsBlocked(p.db, probeID)
+}
+
+func (p *PostgresStore) TouchProbe(cx context.Context, probeID string) error {
+	return probes.Touch(p.db, probeID, time.Minute)
+}
+
+func (p *PostgresStore) DeactivateStaleProbes(cx context.Context,
+											before time.Time) ([]string, error) {
+	return probes.DeactivateStale(p.db, before)
+}
+
+func (p *PostgresStore) PurgeDeletedDevices(cx context.Context,
+											grace time.Duration) (int, error) {
+	return PurgeDeletedDevices(grace, p.db)
+}
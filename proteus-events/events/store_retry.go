@@ -0,0 +1,401 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/dbconn"
+	"github.com/thetorproject/proteus/proteus-common/settings"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+)
+
+// RetryStore retries the operations of a Store failing with a transient
+// error, such as a serialization failure or a connection lost to a
+// failover, instead of handing it to the handlers. Every operation can be
+// run again: the writes are either rolled back when they fail or, like
+// CreateTasks, give the same result when repeated. The ones which would
+// store a second copy of what they create if the first one was committed
+// before the failure, like SaveTaskResult, AddAlert or RegisterProbe, or
+// lose what they return, like ExpireTaskLeases, are not retried. Neither is
+// DeactivateProbe, which would find the probe deactivated by the first try.
+type RetryStore struct {
+	Store
+}
+
+func NewRetryStore(store Store) *RetryStore {
+	return &RetryStore{Store: store}
+}
+
+func (r *RetryStore) CreateJob(cx context.Context, jd JobData,
+								schedule Schedule) error {
+	return dbconn.Retry(cx, "CreateJob", func() error {
+		return r.Store.CreateJob(cx, jd, schedule)
+	})
+}
+
+func (r *RetryStore) GetJob(cx context.Context, jobID string) (jd JobData, err error) {
+	err = dbconn.Retry(cx, "GetJob", func() error {
+		jd, err = r.Store.GetJob(cx, jobID)
+		return err
+	})
+	return jd, err
+}
+
+func (r *RetryStore) ListJobs(cx context.Context,
+								showDeleted bool) (jobs []JobData, err error) {
+	err = dbconn.Retry(cx, "ListJobs", func() error {
+		jobs, err = r.Store.ListJobs(cx, showDeleted)
+		return err
+	})
+	return jobs, err
+}
+
+func (r *RetryStore) JobStats(cx context.Context,
+								jobID string) (stats JobStats, err error) {
+	err = dbconn.Retry(cx, "JobStats", func() error {
+		stats, err = r.Store.JobStats(cx, jobID)
+		return err
+	})
+	return stats, err
+}
+
+func (r *RetryStore) DeleteJob(cx context.Context, jobID string) error {
+	return dbconn.Retry(cx, "DeleteJob", func() error {
+		return r.Store.DeleteJob(cx, jobID)
+	})
+}
+
+func (r *RetryStore) RestoreJob(cx context.Context, jobID string) (j *Job, err error) {
+	err = dbconn.Retry(cx, "RestoreJob", func() error {
+		j, err = r.Store.RestoreJob(cx, jobID)
+		return err
+	})
+	return j, err
+}
+
+func (r *RetryStore) PurgeJobs(cx context.Context,
+								before time.Time) (purged int64, err error) {
+	err = dbconn.Retry(cx, "PurgeJobs", func() error {
+		purged, err = r.Store.PurgeJobs(cx, before)
+		return err
+	})
+	return purged, err
+}
+
+func (r *RetryStore) ActiveJobs(cx context.Context) (jobs []*Job, err error) {
+	err = dbconn.Retry(cx, "ActiveJobs", func() error {
+		jobs, err = r.Store.ActiveJobs(cx)
+		return err
+	})
+	return jobs, err
+}
+
+func (r *RetryStore) SaveJobRun(cx context.Context, j *Job) error {
+	return dbconn.Retry(cx, "SaveJobRun", func() error {
+		return r.Store.SaveJobRun(cx, j)
+	})
+}
+
+func (r *RetryStore) JobWebhook(cx context.Context,
+								jobID string) (url string, secret string, err error) {
+	err = dbconn.Retry(cx, "JobWebhook", func() error {
+		url, secret, err = r.Store.JobWebhook(cx, jobID)
+		return err
+	})
+	return url, secret, err
+}
+
+// CreateTasks creates the whole batch again when a chunk of it failed with
+// a transient error, the tasks already created are returned as they are.
+func (r *RetryStore) CreateTasks(cx context.Context, jobID string,
+								probeIDs []string, t Task, runID int64,
+								notice JobTarget) (created []CreatedTask, err error) {
+	err = dbconn.Retry(cx, "CreateTasks", func() error {
+		created, err = r.Store.CreateTasks(cx, jobID, probeIDs, t, runID,
+											notice)
+		return err
+	})
+	return created, err
+}
+
+func (r *RetryStore) GetTask(cx context.Context, tID string) (t Task, err error) {
+	err = dbconn.Retry(cx, "GetTask", func() error {
+		t, err = r.Store.GetTask(cx, tID)
+		return err
+	})
+	return t, err
+}
+
+func (r *RetryStore) TasksForProbe(cx context.Context, probeID string,
+									cursor TaskCursor) (tasks []Task, err error) {
+	err = dbconn.Retry(cx, "TasksForProbe", func() error {
+		tasks, err = r.Store.TasksForProbe(cx, probeID, cursor)
+		return err
+	})
+	return tasks, err
+}
+
+func (r *RetryStore) TaskHistory(cx context.Context, probeID string, limit int,
+								offset int) (items []TaskHistoryItem,
+											total int64, err error) {
+	err = dbconn.Retry(cx, "TaskHistory", func() error {
+		items, total, err = r.Store.TaskHistory(cx, probeID, limit, offset)
+		return err
+	})
+	return items, total, err
+}
+
+func (r *RetryStore) SetTaskState(cx context.Context, tID string,
+									from taskstate.State,
+									state taskstate.State) error {
+	return dbconn.Retry(cx, "SetTaskState", func() error {
+		return r.Store.SetTaskState(cx, tID, from, state)
+	})
+}
+
+func (r *RetryStore) MarkTasksNotified(cx context.Context, tIDs []string) error {
+	return dbconn.Retry(cx, "MarkTasksNotified", func() error {
+		return r.Store.MarkTasksNotified(cx, tIDs)
+	})
+}
+
+func (r *RetryStore) UnfinishedTasks(cx context.Context,
+									probeID string) (tIDs []string, err error) {
+	err = dbconn.Retry(cx, "UnfinishedTasks", func() error {
+		tIDs, err = r.Store.UnfinishedTasks(cx, probeID)
+		return err
+	})
+	return tIDs, err
+}
+
+func (r *RetryStore) ValidateTarget(cx context.Context, t Target) error {
+	return dbconn.Retry(cx, "ValidateTarget", func() error {
+		return r.Store.ValidateTarget(cx, t)
+	})
+}
+
+func (r *RetryStore) FindProbes(cx context.Context, t Target, runID int64,
+								testName string) (probes []MatchingProbe, err error) {
+	err = dbconn.Retry(cx, "FindProbes", func() error {
+		probes, err = r.Store.FindProbes(cx, t, runID, testName)
+		return err
+	})
+	return probes, err
+}
+
+func (r *RetryStore) JobCohort(cx context.Context,
+								jobID string) (probes []MatchingProbe, err error) {
+	err = dbconn.Retry(cx, "JobCohort", func() error {
+		probes, err = r.Store.JobCohort(cx, jobID)
+		return err
+	})
+	return probes, err
+}
+
+func (r *RetryStore) JobOwner(cx context.Context,
+								jobID string) (owner string, sharedWith []string, err error) {
+	err = dbconn.Retry(cx, "JobOwner", func() error {
+		owner, sharedWith, err = r.Store.JobOwner(cx, jobID)
+		return err
+	})
+	return owner, sharedWith, err
+}
+
+func (r *RetryStore) ShareJob(cx context.Context, jobID string,
+								sharedWith []string) error {
+	return dbconn.Retry(cx, "ShareJob", func() error {
+		return r.Store.ShareJob(cx, jobID, sharedWith)
+	})
+}
+
+func (r *RetryStore) JobResults(cx context.Context,
+								jobID string) (results []TaskResult, err error) {
+	err = dbconn.Retry(cx, "JobResults", func() error {
+		results, err = r.Store.JobResults(cx, jobID)
+		return err
+	})
+	return results, err
+}
+
+func (r *RetryStore) SetTaskMeasurements(cx context.Context, tID string,
+										req TaskDoneReq) error {
+	return dbconn.Retry(cx, "SetTaskMeasurements", func() error {
+		return r.Store.SetTaskMeasurements(cx, tID, req)
+	})
+}
+
+func (r *RetryStore) SetTaskLease(cx context.Context, tID string,
+								expiresAt time.Time) error {
+	return dbconn.Retry(cx, "SetTaskLease", func() error {
+		return r.Store.SetTaskLease(cx, tID, expiresAt)
+	})
+}
+
+func (r *RetryStore) IdempotentResponse(cx context.Context, probeID string,
+										key string) (sr *storedResponse, err error) {
+	err = dbconn.Retry(cx, "IdempotentResponse", func() error {
+		sr, err = r.Store.IdempotentResponse(cx, probeID, key)
+		return err
+	})
+	return sr, err
+}
+
+func (r *RetryStore) StoreIdempotentResponse(cx context.Context, probeID string,
+											key string, statusCode int,
+											body []byte) error {
+	return dbconn.Retry(cx, "StoreIdempotentResponse", func() error {
+		return r.Store.StoreIdempotentResponse(cx, probeID, key, statusCode, body)
+	})
+}
+
+func (r *RetryStore) ReleaseIdempotencyKey(cx context.Context, probeID string,
+											key string) error {
+	return dbconn.Retry(cx, "ReleaseIdempotencyKey", func() error {
+		return r.Store.ReleaseIdempotencyKey(cx, probeID, key)
+	})
+}
+
+func (r *RetryStore) ExportDeviceData(cx context.Context,
+									probeID string) (export DeviceDataExport, err error) {
+	err = dbconn.Retry(cx, "ExportDeviceData", func() error {
+		export, err = r.Store.ExportDeviceData(cx, probeID)
+		return err
+	})
+	return export, err
+}
+
+func (r *RetryStore) IngestCoverage(cx context.Context, entries []CoverageEntry) error {
+	return dbconn.Retry(cx, "IngestCoverage", func() error {
+		return r.Store.IngestCoverage(cx, entries)
+	})
+}
+
+func (r *RetryStore) CreateProbeCohort(cx context.Context, pc ProbeCohort) error {
+	return dbconn.Retry(cx, "CreateProbeCohort", func() error {
+		return r.Store.CreateProbeCohort(cx, pc)
+	})
+}
+
+func (r *RetryStore) ListProbeCohorts(cx context.Context) (cohorts []ProbeCohort, err error) {
+	err = dbconn.Retry(cx, "ListProbeCohorts", func() error {
+		cohorts, err = r.Store.ListProbeCohorts(cx)
+		return err
+	})
+	return cohorts, err
+}
+
+func (r *RetryStore) ProbeCohortMembers(cx context.Context,
+										name string) (members []ProbeCohortMember, err error) {
+	err = dbconn.Retry(cx, "ProbeCohortMembers", func() error {
+		members, err = r.Store.ProbeCohortMembers(cx, name)
+		return err
+	})
+	return members, err
+}
+
+func (r *RetryStore) AddProbeCohortMembers(cx context.Context, name string,
+											probeIDs []string) (added int64, err error) {
+	err = dbconn.Retry(cx, "AddProbeCohortMembers", func() error {
+		added, err = r.Store.AddProbeCohortMembers(cx, name, probeIDs)
+		return err
+	})
+	return added, err
+}
+
+func (r *RetryStore) RemoveProbeCohortMember(cx context.Context, name string,
+											probeID string) error {
+	return dbconn.Retry(cx, "RemoveProbeCohortMember", func() error {
+		return r.Store.RemoveProbeCohortMember(cx, name, probeID)
+	})
+}
+
+func (r *RetryStore) DeleteProbeCohort(cx context.Context, name string) error {
+	return dbconn.Retry(cx, "DeleteProbeCohort", func() error {
+		return r.Store.DeleteProbeCohort(cx, name)
+	})
+}
+
+func (r *RetryStore) GetSegment(cx context.Context, name string,
+								version int64) (s Segment, err error) {
+	err = dbconn.Retry(cx, "GetSegment", func() error {
+		s, err = r.Store.GetSegment(cx, name, version)
+		return err
+	})
+	return s, err
+}
+
+func (r *RetryStore) ListSegments(cx context.Context) (segments []Segment, err error) {
+	err = dbconn.Retry(cx, "ListSegments", func() error {
+		segments, err = r.Store.ListSegments(cx)
+		return err
+	})
+	return segments, err
+}
+
+func (r *RetryStore) DeleteSegment(cx context.Context, name string) error {
+	return dbconn.Retry(cx, "DeleteSegment", func() error {
+		return r.Store.DeleteSegment(cx, name)
+	})
+}
+
+func (r *RetryStore) ListAlerts(cx context.Context) (alerts []Alert, err error) {
+	err = dbconn.Retry(cx, "ListAlerts", func() error {
+		alerts, err = r.Store.ListAlerts(cx)
+		return err
+	})
+	return alerts, err
+}
+
+func (r *RetryStore) WithdrawAlert(cx context.Context, alertID string) error {
+	return dbconn.Retry(cx, "WithdrawAlert", func() error {
+		return r.Store.WithdrawAlert(cx, alertID)
+	})
+}
+
+func (r *RetryStore) ProbeAlerts(cx context.Context,
+								probeID string) (alerts []ProbeAlert, err error) {
+	err = dbconn.Retry(cx, "ProbeAlerts", func() error {
+		alerts, err = r.Store.ProbeAlerts(cx, probeID)
+		return err
+	})
+	return alerts, err
+}
+
+func (r *RetryStore) AckAlert(cx context.Context, alertID string,
+								probeID string) error {
+	return dbconn.Retry(cx, "AckAlert", func() error {
+		return r.Store.AckAlert(cx, alertID, probeID)
+	})
+}
+
+func (r *RetryStore) ProbeSettings(cx context.Context, probeCC string,
+									softwareVersion string) (s settings.Settings, err error) {
+	err = dbconn.Retry(cx, "ProbeSettings", func() error {
+		s, err = r.Store.ProbeSettings(cx, probeCC, softwareVersion)
+		return err
+	})
+	return s, err
+}
+
+func (r *RetryStore) RequestDeletion(cx context.Context, probeID string,
+									grace time.Duration) (purgeAfter time.Time, err error) {
+	err = dbconn.Retry(cx, "RequestDeletion", func() error {
+		purgeAfter, err = r.Store.RequestDeletion(cx, probeID, grace)
+		return err
+	})
+	return purgeAfter, err
+}
+
+func (r *RetryStore) IsBlocked(cx context.Context, probeID string) (blocked bool, err error) {
+	err = dbconn.Retry(cx, "IsBlocked", func() error {
+		blocked, err = r.Store.IsBlocked(cx, probeID)
+		return err
+	})
+	return blocked, err
+}
+
+func (r *RetryStore) TouchProbe(cx context.Context, probeID string) error {
+	return dbconn.Retry(cx, "TouchProbe", func() error {
+		return r.Store.TouchProbe(cx, probeID)
+	})
+}
@@ -0,0 +1,2764 @@
+package events
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-common/settings"
+	"github.com/thetorproject/proteus/proteus-events/targeting"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+	"github.com/rubenv/sql-migrate"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+// SQLiteStore is the Store of the jobs and tasks in an SQLite database, for
+// running the service without provisioning Postgres, e.g. during
+// development. The probes register and log in to the same database, whose
+// migrations create the tables of proteus-registry alongside those of the
+// jobs: the queries of the probes package are run as they are, through the
+// proteus-sqlite3 driver.
+//
+// SQLite has no arrays: the lists are kept as JSON arrays, and the target
+// of a job as a JSON object like the target of a segment. The probes are
+// matched by their targets in Go rather than in SQL.
+type SQLiteStore struct {
+	db		*sqlx.DB
+}
+
+func NewSQLiteStore(db *sqlx.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+// OpenSQLiteDatabase opens the SQLite database at path, ":memory:" for one
+// in memory, and brings its schema up to date
+func OpenSQLiteDatabase(path string) (*sqlx.DB, error) {
+	sqlDB, err := sql.Open(sqliteDriverName, "file:" + path + "?_foreign_keys=on")
+	if err != nil {
+		ctx.WithError(err).Error("failed to open the sqlite database")
+		return nil, err
+	}
+	// The queries written for sqlx are bound with ?, like sqlite3 does
+	db := sqlx.NewDb(sqlDB, "sqlite3")
+	// The writes are serialised by SQLite anyway, with a single connection
+	// they wait for each other instead of failing with SQLITE_BUSY. It also
+	// keeps a database in memory alive.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	if err = migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite applies the migrations in data/sqlite-migrations, the
+// database only being used by this instance there is nothing to check them
+// against
+func migrateSQLite(db *sqlx.DB) error {
+	migrate.SetTable(viper.GetString("database.schema-version-table"))
+	n, err := migrate.Exec(db.DB, "sqlite3", &migrate.AssetMigrationSource{
+		Asset: Asset,
+		AssetDir: AssetDir,
+		Dir: "data/sqlite-migrations",
+	}, migrate.Up)
+	if err != nil {
+		ctx.WithError(err).Error("failed to migrate the sqlite database")
+		return err
+	}
+	if n > 0 {
+		ctx.Infof("applied %d migrations to the sqlite database", n)
+	}
+	return nil
+}
+
+// jsonStrings is a list kept in a JSON array
+type jsonStrings []string
+
+func (a jsonStrings) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal([]string(a))
+	return string(b), err
+}
+
+func (a *jsonStrings) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), (*[]string)(a))
+	case []byte:
+		return json.Unmarshal(src, (*[]string)(a))
+	}
+	return fmt.Errorf("cannot scan %T into a list", src)
+}
+
+// sqliteJobRow is a row of the jobs table of the SQLiteStore
+type sqliteJobRow struct {
+	jobRow
+	Target		types.JSONText `db:"target"`
+	// Read AS shared_with_list, shared_with being the column of jobRow
+	SharedWith	jsonStrings `db:"shared_with_list"`
+}
+
+func (r sqliteJobRow) jobData() (JobData, error) {
+	jd, err := r.jobRow.jobData()
+	if err != nil {
+		return jd, err
+	}
+	jd.SharedWith = r.SharedWith
+	err = r.Target.Unmarshal(&jd.Target)
+	return jd, err
+}
+
+// CreateJob stores the job, with its cohort when it is frozen
+func (s *SQLiteStore) CreateJob(cx context.Context, jd JobData,
+								schedule Schedule) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	taskArgsStr, err := json.Marshal(jd.Task.Arguments)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise task arguments")
+		return err
+	}
+	targetStr, err := json.Marshal(jd.Target)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise job target")
+		return err
+	}
+	// Looked up before the transaction, which holds the only connection
+	var cohort []MatchingProbe
+	if jd.Target.Cohort == FrozenCohort {
+		cohort, err = s.findProbes(cx, jd.Target, 0, jd.Task.TestName)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, comment,
+		schedule, delay,
+		task_test_name,
+		task_arguments,
+		creation_time,
+		times_run,
+		next_run_at,
+		is_done,
+		state,
+		priority,
+		webhook_url,
+		webhook_secret,
+		dry_run,
+		notification,
+		notification_window,
+		created_by,
+		shared_with,
+		target
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	_, err = tx.ExecContext(cx, query, jd.Id, jd.Comment,
+						jd.Schedule, jd.Delay,
+						jd.Task.TestName,
+						string(taskArgsStr),
+						time.Now().UTC(),
+						0,
+						schedule.StartTime.UTC().Format(ISOUTCTimeLayout),
+						false,
+						"active",
+						jd.Priority,
+						jd.WebhookURL,
+						jd.WebhookSecret,
+						jd.DryRun,
+						jd.Notification,
+						jd.NotificationWindow,
+						jd.CreatedBy,
+						jsonStrings(jd.SharedWith),
+						string(targetStr))
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into jobs table")
+		return err
+	}
+
+	query = fmt.Sprintf(`INSERT INTO %s (job_id, probe_id) VALUES (?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.job-cohorts-table")))
+	for _, p := range cohort {
+		if _, err = tx.ExecContext(cx, query, jd.Id, p.Id); err != nil {
+			ctx.WithError(err).Error("failed to insert cohort probe")
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+	return nil
+}
+
+// GetJob returns the target and the task of the job
+func (s *SQLiteStore) GetJob(cx context.Context, jobID string) (JobData, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row sqliteJobRow
+	query := fmt.Sprintf(`SELECT
+		id,
+		target,
+		task_test_name,
+		task_arguments,
+		COALESCE(dry_run, FALSE) AS dry_run,
+		COALESCE(notification, '') AS notification,
+		COALESCE(notification_window, '') AS notification_window
+		FROM %s
+		WHERE id = ? AND deleted_at IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.GetContext(cx, &row, query, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return JobData{Id: jobID}, ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to obtain targets")
+		return JobData{Id: jobID}, err
+	}
+	jd, err := row.jobData()
+	if err != nil {
+		ctx.WithError(err).Error("failed to unmarshal json")
+		return jd, err
+	}
+	return jd, nil
+}
+
+func (s *SQLiteStore) ListJobs(cx context.Context, showDeleted bool) ([]JobData, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		currentJobs []JobData
+		rows []sqliteJobRow
+	)
+	query := fmt.Sprintf(`SELECT
+		id, comment,
+		creation_time,
+		schedule, delay,
+		task_test_name,
+		task_arguments,
+		COALESCE(state, 'active') AS state,
+		priority,
+		COALESCE(webhook_url, '') AS webhook_url,
+		COALESCE(dry_run, FALSE) AS dry_run,
+		COALESCE(notification, '') AS notification,
+		COALESCE(notification_window, '') AS notification_window,
+		COALESCE(created_by, '') AS created_by,
+		shared_with AS shared_with_list,
+		deleted_at,
+		target
+		FROM %s`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if showDeleted == false {
+		query += " WHERE deleted_at IS NULL"
+	}
+	err := s.db.SelectContext(cx, &rows, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list jobs")
+		return currentJobs, err
+	}
+	for _, row := range rows {
+		jd, err := row.jobData()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal JSON")
+			return currentJobs, err
+		}
+		currentJobs = append(currentJobs, jd)
+	}
+	return currentJobs, nil
+}
+
+// JobStats returns how the tasks of the job are doing
+func (s *SQLiteStore) JobStats(cx context.Context, jobID string) (JobStats, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	stats := JobStats{
+		JobId: jobID,
+		Tasks: map[string]int64{},
+		Errors: map[string]int64{},
+	}
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (
+		SELECT 1 FROM %s WHERE id = ? AND deleted_at IS NULL)`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.QueryRowContext(cx, query, jobID).Scan(&exists)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up job")
+		return stats, err
+	}
+	if !exists {
+		return stats, ErrJobNotFound
+	}
+
+	counts := func(query string, into map[string]int64) error {
+		rows, err := s.db.QueryContext(cx, query, jobID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				key string
+				count int64
+			)
+			if err := rows.Scan(&key, &count); err != nil {
+				return err
+			}
+			into[key] = count
+		}
+		return rows.Err()
+	}
+	query = fmt.Sprintf(`SELECT
+		COALESCE(state, 'ready'), COUNT(*)
+		FROM %s
+		WHERE job_id = ?
+		GROUP BY state`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	if err = counts(query, stats.Tasks); err != nil {
+		ctx.WithError(err).Error("failed to count tasks")
+		return stats, err
+	}
+	query = fmt.Sprintf(`SELECT
+		COALESCE(e.exception_class, ''), COUNT(*)
+		FROM %s AS e
+		JOIN %s AS t ON t.id = e.task_id
+		WHERE t.job_id = ?
+		GROUP BY e.exception_class`,
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	if err = counts(query, stats.Errors); err != nil {
+		ctx.WithError(err).Error("failed to count errors")
+		return stats, err
+	}
+
+	query = fmt.Sprintf(`SELECT COUNT(*)
+		FROM %s AS r
+		JOIN %s AS t ON t.id = r.task_id
+		WHERE t.job_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err = s.db.QueryRowContext(cx, query, jobID).Scan(&stats.Results)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count results")
+		return stats, err
+	}
+
+	// SQLite has no percentile_cont, the latencies are summarised here
+	var times []struct {
+		CreationTime		time.Time `db:"creation_time"`
+		NotificationTime	time.Time `db:"notification_time"`
+	}
+	query = fmt.Sprintf(`SELECT creation_time, notification_time
+		FROM %s
+		WHERE job_id = ? AND notification_time IS NOT NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	if err = s.db.SelectContext(cx, &times, query, jobID); err != nil {
+		ctx.WithError(err).Error("failed to compute notification latency")
+		return stats, err
+	}
+	latencies := make([]float64, 0, len(times))
+	for _, t := range times {
+		latencies = append(latencies,
+							t.NotificationTime.Sub(t.CreationTime).Seconds())
+	}
+	sort.Float64s(latencies)
+	stats.NotificationLatency = LatencyStats{
+		Count: int64(len(latencies)),
+		Median: percentile(latencies, 0.5),
+		P95: percentile(latencies, 0.95),
+	}
+	return stats, nil
+}
+
+// percentile interpolates the fraction p of the sorted values like
+// percentile_cont does, it is 0 when there are none
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p * float64(len(sorted) - 1)
+	lower := int(math.Floor(pos))
+	if lower + 1 >= len(sorted) {
+		return sorted[lower]
+	}
+	frac := pos - float64(lower)
+	return sorted[lower] + frac * (sorted[lower + 1] - sorted[lower])
+}
+
+// DeleteJob marks the job as deleted, the time it was first deleted at and
+// the state it was in are kept when it is deleted again
+func (s *SQLiteStore) DeleteJob(cx context.Context, jobID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = ?2,
+		state_before_delete = CASE WHEN deleted_at IS NULL
+			THEN COALESCE(state, 'active') ELSE state_before_delete END,
+		deleted_at = COALESCE(deleted_at, ?3)
+		WHERE id = ?1`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	res, err := s.db.ExecContext(cx, query, jobID, "deleted", time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed delete job")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// RestoreJob puts the deleted job back in the state it was deleted in
+func (s *SQLiteStore) RestoreJob(cx context.Context, jobID string) (*Job, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row jobRow
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = COALESCE(state_before_delete, ?2),
+		state_before_delete = NULL,
+		deleted_at = NULL
+		WHERE id = ?1 AND deleted_at IS NOT NULL
+		RETURNING
+		id, comment,
+		schedule, delay,
+		times_run,
+		next_run_at,
+		is_done`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.GetContext(cx, &row, query, jobID, "active")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to restore job")
+		return nil, err
+	}
+	return row.job()
+}
+
+// PurgeJobs deletes the jobs deleted before the time along with their
+// frozen cohorts. Their tasks are left alone, like the PostgresStore leaves
+// them to the task reaper.
+func (s *SQLiteStore) PurgeJobs(cx context.Context, before time.Time) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return 0, err
+	}
+	defer tx.Rollback()
+	jobsTable := pq.QuoteIdentifier(viper.GetString("database.jobs-table"))
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE job_id IN (SELECT id FROM %s WHERE deleted_at < ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.job-cohorts-table")),
+		jobsTable)
+	if _, err = tx.ExecContext(cx, query, before.UTC()); err != nil {
+		ctx.WithError(err).Error("failed to purge the cohorts of the deleted jobs")
+		return 0, err
+	}
+	query = fmt.Sprintf(`DELETE FROM %s WHERE deleted_at < ?`, jobsTable)
+	res, err := tx.ExecContext(cx, query, before.UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to purge the deleted jobs")
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit the purge of the deleted jobs")
+		return 0, err
+	}
+	return purged, nil
+}
+
+// ActiveJobs returns the jobs the scheduler runs
+func (s *SQLiteStore) ActiveJobs(cx context.Context) ([]*Job, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var rows []jobRow
+	allJobs := []*Job{}
+	query := fmt.Sprintf(`SELECT
+		id, comment,
+		schedule, delay,
+		times_run,
+		next_run_at,
+		is_done
+		FROM %s
+		WHERE state = 'active'`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.SelectContext(cx, &rows, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list jobs")
+		return allJobs, err
+	}
+	for _, row := range rows {
+		j, err := row.job()
+		if err != nil {
+			return allJobs, err
+		}
+		allJobs = append(allJobs, j)
+	}
+	return allJobs, nil
+}
+
+// SaveJobRun records that the job ran
+func (s *SQLiteStore) SaveJobRun(cx context.Context, j *Job) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET
+		times_run = ?,
+		next_run_at = ?,
+		is_done = ?
+		WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	_, err := s.db.ExecContext(cx, query, j.TimesRun,
+						j.NextRunAt.UTC().Format(ISOUTCTimeLayout),
+						j.IsDone,
+						j.Id)
+	if err != nil {
+		ctx.WithError(err).Error("failed to update jobs table")
+		return err
+	}
+	return nil
+}
+
+// JobWebhook returns the webhook URL of the job and its secret
+func (s *SQLiteStore) JobWebhook(cx context.Context,
+								jobID string) (string, string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row jobRow
+	query := fmt.Sprintf(`SELECT
+		COALESCE(webhook_url, '') AS webhook_url,
+		COALESCE(webhook_secret, '') AS webhook_secret
+		FROM %s
+		WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.GetContext(cx, &row, query, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", ErrJobNotFound
+		}
+		ctx.WithError(err).Error("failed to lookup job webhook")
+		return "", "", err
+	}
+	return row.WebhookURL, row.WebhookSecret, nil
+}
+
+// JobOwner returns the account which created the job and the ones it's
+// shared with
+func (s *SQLiteStore) JobOwner(cx context.Context,
+								jobID string) (string, []string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		owner string
+		sharedWith jsonStrings
+	)
+	query := fmt.Sprintf(`SELECT COALESCE(created_by, ''), shared_with
+		FROM %s WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err := s.db.QueryRowContext(cx, query, jobID).Scan(&owner, &sharedWith)
+	if err == sql.ErrNoRows {
+		return "", nil, ErrJobNotFound
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up the owner of the job")
+		return "", nil, err
+	}
+	return owner, sharedWith, nil
+}
+
+// ShareJob replaces the accounts the job is shared with
+func (s *SQLiteStore) ShareJob(cx context.Context, jobID string,
+								sharedWith []string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET shared_with = ? WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	res, err := s.db.ExecContext(cx, query, jsonStrings(sharedWith), jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to share the job")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// JobResults returns the results submitted for the tasks of the job
+func (s *SQLiteStore) JobResults(cx context.Context, jobID string) ([]TaskResult, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var results []TaskResult
+	query := fmt.Sprintf(`SELECT
+		r.id, r.task_id,
+		r.probe_id,
+		COALESCE(r.report_id, ''),
+		r.summary,
+		r.creation_time
+		FROM %s AS r
+		JOIN %s AS t ON t.id = r.task_id
+		WHERE t.job_id = ?
+		ORDER BY r.creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	rows, err := s.db.QueryContext(cx, query, jobID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list job results")
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			tr TaskResult
+			summary types.JSONText
+		)
+		err := rows.Scan(&tr.Id, &tr.TaskId,
+						&tr.ProbeId,
+						&tr.ReportId,
+						&summary,
+						&tr.CreationTime)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over results")
+			return results, err
+		}
+		if err = summary.Unmarshal(&tr.Summary); err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return results, err
+		}
+		results = append(results, tr)
+	}
+	return results, rows.Err()
+}
+
+// CreateTasks creates the tasks of the probes in run runID of the job, in
+// chunks of core.task-batch-size tasks each created in one transaction. A
+// job run creates at most one task per probe, so if the dispatch is being
+// retried the existing tasks are returned instead.
+//
+// The notifications are queued in the outbox like with the PostgresStore,
+// but no relay sends them: the probes find their tasks when they poll.
+func (s *SQLiteStore) CreateTasks(cx context.Context, jobID string,
+								probeIDs []string, t Task,
+								runID int64,
+								notice JobTarget) ([]CreatedTask, error) {
+	return createTasksInChunks(probeIDs, t, notice,
+		func(chunk []string, taskArgs []byte, notice []byte) ([]CreatedTask, error) {
+			return s.createTaskChunk(cx, jobID, chunk, t.TestName,
+									taskArgs, runID, notice)
+		})
+}
+
+func (s *SQLiteStore) createTaskChunk(cx context.Context, jobID string,
+										probeIDs []string,
+										testName string, taskArgs []byte,
+										runID int64,
+										notice []byte) ([]CreatedTask, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open createTasks transaction")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tasksTable := pq.QuoteIdentifier(viper.GetString("database.tasks-table"))
+	insertTask, err := tx.PrepareContext(cx, fmt.Sprintf(`INSERT INTO %s (
+		id, probe_id,
+		job_id, test_name,
+		arguments,
+		state,
+		progress,
+		creation_time,
+		last_updated,
+		run_id
+	) VALUES (?1, ?2, ?3, ?4, ?5, ?6, 0, ?7, ?7, ?8)
+	ON CONFLICT (job_id, run_id, probe_id) DO NOTHING`, tasksTable))
+	if err != nil {
+		ctx.WithError(err).Error("failed to prepare task insert")
+		return nil, err
+	}
+	defer insertTask.Close()
+	insertNotice, err := tx.PrepareContext(cx, fmt.Sprintf(`INSERT INTO %s (
+		task_id, probe_id,
+		notice,
+		attempts,
+		next_attempt_at,
+		creation_time
+	) VALUES (?1, ?2, ?3, 0, ?4, ?4)
+	ON CONFLICT (task_id) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table"))))
+	if err != nil {
+		ctx.WithError(err).Error("failed to prepare outbox insert")
+		return nil, err
+	}
+	defer insertNotice.Close()
+	existingTask, err := tx.PrepareContext(cx, fmt.Sprintf(`SELECT
+		probe_id, id,
+		COALESCE(state, 'ready') = ?4 AS needs_notify
+		FROM %s
+		WHERE job_id = ?1 AND run_id = ?2 AND probe_id = ?3`, tasksTable))
+	if err != nil {
+		ctx.WithError(err).Error("failed to prepare task lookup")
+		return nil, err
+	}
+	defer existingTask.Close()
+
+	now := time.Now().UTC()
+	var created []CreatedTask
+	for _, probeID := range probeIDs {
+		tID := uuid.NewV4().String()
+		res, err := insertTask.ExecContext(cx, tID, probeID,
+									jobID, testName,
+									string(taskArgs),
+									string(taskstate.Ready),
+									now,
+									runID)
+		if err != nil {
+			ctx.WithError(err).Error("failed to insert into tasks table")
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			_, err = insertNotice.ExecContext(cx, tID, probeID, string(notice), now)
+			if err != nil {
+				ctx.WithError(err).Error("failed to insert into task outbox")
+				return nil, err
+			}
+			created = append(created, CreatedTask{
+				ProbeId: probeID,
+				TaskId: tID,
+				NeedsNotify: true,
+			})
+			continue
+		}
+
+		// Created by a previous attempt, only notified if still ready
+		ctx.Debugf("task for %s in run %d already exists", probeID, runID)
+		var row createdTaskRow
+		err = existingTask.QueryRowContext(cx, jobID, runID, probeID,
+										string(taskstate.Ready)).Scan(&row.ProbeId,
+																	&row.TaskId,
+																	&row.NeedsNotify)
+		if err != nil {
+			ctx.WithError(err).Error("failed to lookup created task")
+			return nil, err
+		}
+		created = append(created, CreatedTask{
+			ProbeId: row.ProbeId,
+			TaskId: row.TaskId,
+			NeedsNotify: row.NeedsNotify,
+		})
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction in tasks table, rolling back")
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetTask looks up a task without checking who it belongs to
+func (s *SQLiteStore) GetTask(cx context.Context, tID string) (Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var row taskRow
+	query := fmt.Sprintf(`SELECT
+		id,
+		probe_id,
+		COALESCE(job_id, '') AS job_id,
+		test_name,
+		arguments,
+		COALESCE(state, 'ready') AS state
+		FROM %s
+		WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err := s.db.GetContext(cx, &row, query, tID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, ErrTaskNotFound
+		}
+		ctx.WithError(err).Error("failed to get task")
+		return Task{}, err
+	}
+	task, err := row.task()
+	if err != nil {
+		ctx.WithError(err).Error("failed to unmarshal json")
+		return task, err
+	}
+	return task, nil
+}
+
+// TasksForProbe returns the tasks of a probe that are waiting to be
+// accepted and were created after the position of the cursor. Tasks of
+// tests the probe no longer supports are left out, like all the tasks of a
+// blocked probe.
+func (s *SQLiteStore) TasksForProbe(cx context.Context, uID string,
+									cursor TaskCursor) ([]Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		tasks []Task
+		rows []taskRow
+	)
+	probe, err := s.probeRows(cx, "CAST(id AS TEXT) = ?", uID)
+	if err != nil || len(probe) == 0 {
+		return tasks, err
+	}
+
+	query := fmt.Sprintf(`SELECT
+		t.id,
+		t.test_name,
+		t.arguments,
+		COALESCE(j.priority, 0) AS priority,
+		t.creation_time
+		FROM %s AS t
+		LEFT JOIN %s AS j ON j.id = t.job_id
+		WHERE
+		t.state IN ('ready', 'notified') AND
+		t.probe_id = ?1 AND
+		j.deleted_at IS NULL AND
+		t.creation_time >= ?2 AND
+		(t.creation_time > ?2 OR t.id > ?3)
+		ORDER BY j.priority DESC NULLS LAST, t.creation_time`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	err = s.db.SelectContext(cx, &rows, query, uID, cursor.Time.UTC(), cursor.Id)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get task list")
+		return tasks, err
+	}
+	for _, row := range rows {
+		if !probe[0].supportsTest(row.TestName) {
+			continue
+		}
+		task, err := row.task()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// TaskHistory returns a page of the tasks of a probe, in any state, most
+// recent first, together with the total number of tasks it has.
+func (s *SQLiteStore) TaskHistory(cx context.Context, uID string, limit int,
+									offset int) ([]TaskHistoryItem, int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		total int64
+		tasks []TaskHistoryItem
+		rows []taskRow
+	)
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE probe_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err := s.db.GetContext(cx, &total, query, uID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count tasks")
+		return tasks, 0, err
+	}
+
+	// last_updated is set when the tasks are created
+	query = fmt.Sprintf(`SELECT
+		id,
+		test_name,
+		arguments,
+		COALESCE(state, 'ready') AS state,
+		creation_time,
+		last_updated
+		FROM %s
+		WHERE probe_id = ?
+		ORDER BY creation_time DESC
+		LIMIT ? OFFSET ?`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err = s.db.SelectContext(cx, &rows, query, uID, limit, offset)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get task history")
+		return tasks, 0, err
+	}
+	for _, row := range rows {
+		task, err := row.historyItem()
+		if err != nil {
+			ctx.WithError(err).Error("failed to unmarshal json")
+			return tasks, 0, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, total, nil
+}
+
+// SetTaskState moves the task to state and records when it happened
+func (s *SQLiteStore) SetTaskState(cx context.Context, tID string,
+									from taskstate.State,
+									to taskstate.State) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	now := time.Now().UTC()
+	args := []interface{}{tID, string(to), now, string(from)}
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = ?2,
+		last_updated = ?3`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	if col := taskstate.TimeColumn(to); col != "" {
+		query += fmt.Sprintf(`,
+		%s = ?3`, pq.QuoteIdentifier(col))
+	}
+	// Accepting a task grants the probe a lease on it
+	if to == taskstate.Accepted {
+		query += `,
+		lease_expires_at = ?5`
+		args = append(args, now.Add(viper.GetDuration("core.task-lease")))
+	}
+	// The state is checked again in the update, so that of two requests
+	// racing to move the task only the first one wins
+	query += " WHERE id = ?1 AND COALESCE(state, 'ready') = ?4"
+
+	res, err := s.db.ExecContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Errorf("failed to move task to %s", to)
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInconsistentState
+	}
+	return nil
+}
+
+// MarkTasksNotified records that the probe learnt about the tasks in tIDs,
+// the tasks that were already notified or moved on are left alone.
+func (s *SQLiteStore) MarkTasksNotified(cx context.Context, tIDs []string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	if len(tIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(fmt.Sprintf(`UPDATE %s SET
+		state = ?,
+		notification_time = ?,
+		last_updated = ?
+		WHERE id IN (?) AND state IN (?)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table"))),
+		string(taskstate.Notified), time.Now().UTC(), time.Now().UTC(), tIDs,
+		taskstate.Strings(taskstate.ValidFrom(taskstate.Notified)))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to mark tasks as notified")
+	}
+	return err
+}
+
+// UnfinishedTasks returns the ids of the tasks of the probe which can still
+// be cancelled
+func (s *SQLiteStore) UnfinishedTasks(cx context.Context, probeID string) ([]string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT id FROM %s
+		WHERE probe_id = ? AND state IN (?)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table"))),
+		probeID, taskstate.Strings(taskstate.ValidFrom(taskstate.Cancelled)))
+	if err != nil {
+		return nil, err
+	}
+	var tIDs []string
+	if err = s.db.SelectContext(cx, &tIDs, query, args...); err != nil {
+		ctx.WithError(err).Error("failed to list probe tasks")
+		return nil, err
+	}
+	return tIDs, nil
+}
+
+func (s *SQLiteStore) SaveTaskResult(cx context.Context, tr TaskResult) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	summaryStr, err := json.Marshal(tr.Summary)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise result summary")
+		return "", err
+	}
+	tr.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, task_id,
+		probe_id, report_id,
+		summary,
+		creation_time
+	) VALUES (?, ?, ?, ?, ?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")))
+	_, err = s.db.ExecContext(cx, query,
+					tr.Id, tr.TaskId,
+					tr.ProbeId, tr.ReportId,
+					string(summaryStr),
+					time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into task results table")
+		return "", err
+	}
+	return tr.Id, nil
+}
+
+func (s *SQLiteStore) SaveTaskError(cx context.Context, te TaskError) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	te.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, task_id,
+		probe_id,
+		exception_class,
+		message,
+		app_version,
+		creation_time
+	) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")))
+	_, err := s.db.ExecContext(cx, query,
+					te.Id, te.TaskId,
+					te.ProbeId,
+					te.ExceptionClass,
+					te.Message,
+					te.AppVersion,
+					time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into task errors table")
+		return "", err
+	}
+	return te.Id, nil
+}
+
+func (s *SQLiteStore) SetTaskMeasurements(cx context.Context, tID string,
+											req TaskDoneReq) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET
+		report_ids = ?,
+		measurement_uids = ?
+		WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	_, err := s.db.ExecContext(cx, query, jsonStrings(req.ReportIds),
+								jsonStrings(req.MeasurementUids),
+								tID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to store task measurements")
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetTaskLease(cx context.Context, tID string,
+									expiresAt time.Time) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET
+		lease_expires_at = ?,
+		last_updated = ?
+		WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	_, err := s.db.ExecContext(cx, query, expiresAt.UTC(), time.Now().UTC(), tID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to renew task lease")
+	}
+	return err
+}
+
+// ExpireTaskLeases returns the accepted tasks whose lease expired to the
+// ready state
+func (s *SQLiteStore) ExpireTaskLeases(cx context.Context) ([]Task, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var rows []taskRow
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = ?1,
+		accept_time = NULL,
+		lease_expires_at = NULL,
+		last_updated = ?2
+		WHERE state = ?3 AND lease_expires_at < ?2
+		RETURNING id, probe_id, COALESCE(job_id, '') AS job_id,
+		test_name, arguments, state`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	err := s.db.SelectContext(cx, &rows, query,
+						string(taskstate.Ready),
+						time.Now().UTC(),
+						string(taskstate.Accepted))
+	if err != nil {
+		ctx.WithError(err).Error("failed to expire task leases")
+		return nil, err
+	}
+	return taskRows(rows)
+}
+
+// ReapTasks deletes the finished tasks, the archived ones are copied
+// before being deleted as SQLite can't chain the two.
+func (s *SQLiteStore) ReapTasks(cx context.Context,
+								retention time.Duration) ([]Task, error) {
+	var rows []taskRow
+	states := taskstate.Strings(finishedTaskStates)
+	before := time.Now().UTC().Add(-retention)
+	tasksTable := pq.QuoteIdentifier(viper.GetString("database.tasks-table"))
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return nil, err
+	}
+	defer tx.Rollback()
+	if viper.GetBool("core.archive-tasks") {
+		query, args, err := sqlx.In(fmt.Sprintf(`INSERT INTO %s
+			SELECT * FROM %s
+			WHERE state IN (?) AND last_updated < ?`,
+			pq.QuoteIdentifier(viper.GetString("database.tasks-archive-table")),
+			tasksTable), states, before)
+		if err == nil {
+			_, err = tx.ExecContext(cx, query, args...)
+		}
+		if err != nil {
+			ctx.WithError(err).Error("failed to archive tasks")
+			return nil, err
+		}
+	}
+	query, args, err := sqlx.In(fmt.Sprintf(`DELETE FROM %s
+		WHERE state IN (?) AND last_updated < ?
+		RETURNING id, probe_id, COALESCE(job_id, '') AS job_id,
+		test_name, arguments, state`,
+		tasksTable), states, before)
+	if err == nil {
+		err = tx.SelectContext(cx, &rows, query, args...)
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to reap tasks")
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit reaped tasks")
+		return nil, err
+	}
+	return taskRows(rows)
+}
+
+func (s *SQLiteStore) ReserveIdempotencyKey(cx context.Context, probeID string,
+											key string, path string,
+											hash string) (bool, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var reserved string
+	query := fmt.Sprintf(`INSERT INTO %s (
+		probe_id, key,
+		request_path,
+		request_hash,
+		creation_time
+	) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	RETURNING key`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	err := s.db.QueryRowContext(cx, query, probeID, key,
+								path,
+								hash,
+								time.Now().UTC()).Scan(&reserved)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		ctx.WithError(err).Error("failed to reserve idempotency key")
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLiteStore) IdempotentResponse(cx context.Context, probeID string,
+										key string) (*storedResponse, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var sr storedResponse
+	query := fmt.Sprintf(`SELECT
+		request_path, request_hash, status_code, response
+		FROM %s
+		WHERE probe_id = ? AND key = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	err := s.db.QueryRowContext(cx, query, probeID, key).Scan(&sr.RequestPath,
+															&sr.RequestHash,
+															&sr.StatusCode,
+															&sr.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		ctx.WithError(err).Error("failed to lookup idempotency key")
+		return nil, err
+	}
+	return &sr, nil
+}
+
+func (s *SQLiteStore) StoreIdempotentResponse(cx context.Context, probeID string,
+											key string, statusCode int,
+											body []byte) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s
+		SET status_code = ?, response = ?
+		WHERE probe_id = ? AND key = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	_, err := s.db.ExecContext(cx, query, statusCode, body, probeID, key)
+	if err != nil {
+		ctx.WithError(err).Error("failed to store idempotency key")
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey frees a reserved key so that the request can be
+// retried
+func (s *SQLiteStore) ReleaseIdempotencyKey(cx context.Context, probeID string,
+											key string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE probe_id = ? AND key = ? AND status_code IS NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	_, err := s.db.ExecContext(cx, query, probeID, key)
+	if err != nil {
+		ctx.WithError(err).Error("failed to release idempotency key")
+	}
+	return err
+}
+
+func (s *SQLiteStore) ReapIdempotencyKeys(cx context.Context,
+										ttl time.Duration) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`DELETE FROM %s WHERE creation_time < ?`,
+		pq.QuoteIdentifier(viper.GetString("database.idempotency-keys-table")))
+	res, err := s.db.ExecContext(cx, query, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		ctx.WithError(err).Error("failed to reap idempotency keys")
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimNotices claims the notices due to be sent. There is a single
+// connection to the database, the claim can't race with that of another
+// relay.
+func (s *SQLiteStore) ClaimNotices(cx context.Context,
+									limit int) ([]outboxNotice, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var notices []outboxNotice
+	outboxTable := pq.QuoteIdentifier(viper.GetString("database.task-outbox-table"))
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s
+		SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE task_id IN (
+			SELECT task_id FROM %s
+			WHERE next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+		)
+		RETURNING task_id, probe_id, notice, attempts,
+			(SELECT COALESCE(t.state, 'ready') FROM %s AS t
+				WHERE t.id = task_id)`,
+		outboxTable, outboxTable,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")))
+	rows, err := s.db.QueryContext(cx, query, now.Add(outboxClaimTimeout), now, limit)
+	if err != nil {
+		ctx.WithError(err).Error("failed to claim outbox notices")
+		return notices, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			n outboxNotice
+			taskID, probeID string
+			notice []byte
+			state sql.NullString
+		)
+		err = rows.Scan(&taskID, &probeID, &notice, &n.attempts, &state)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over outbox notices")
+			return notices, err
+		}
+		if err = json.Unmarshal(notice, &n.target); err != nil {
+			ctx.WithError(err).Errorf("invalid outbox notice of %s", taskID)
+		}
+		n.target.ClientID = probeID
+		n.target.TaskID = taskID
+		n.state = state.String
+		notices = append(notices, n)
+	}
+	return notices, rows.Err()
+}
+
+func (s *SQLiteStore) RemoveNotice(cx context.Context, taskID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`DELETE FROM %s WHERE task_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table")))
+	_, err := s.db.ExecContext(cx, query, taskID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove outbox notice")
+	}
+	return err
+}
+
+func (s *SQLiteStore) RetryNotice(cx context.Context, n outboxNotice,
+								sendErr error) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s
+		SET next_attempt_at = ?, last_error = ?
+		WHERE task_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.task-outbox-table")))
+	_, err := s.db.ExecContext(cx, query,
+					time.Now().UTC().Add(noticeBackoff(n.attempts)),
+					sendErr.Error(),
+					n.target.TaskID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to reschedule outbox notice")
+	}
+	return err
+}
+
+func (s *SQLiteStore) QueueWebhooks(cx context.Context,
+									deliveries []webhookDelivery) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return queueWebhooks(cx, deliveries, s.db)
+}
+
+// ClaimWebhooks claims the deliveries due to be sent, like ClaimNotices
+// without a race with another relay
+func (s *SQLiteStore) ClaimWebhooks(cx context.Context,
+									limit int) ([]webhookDelivery, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var deliveries []webhookDelivery
+	table := pq.QuoteIdentifier(viper.GetString("database.webhook-deliveries-table"))
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s
+		SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM %s
+			WHERE next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+		)
+		RETURNING id, job_id, task_id, event, attempts`,
+		table, table)
+	rows, err := s.db.QueryContext(cx, query, now.Add(webhookClaimTimeout), now, limit)
+	if err != nil {
+		ctx.WithError(err).Error("failed to claim webhook deliveries")
+		return deliveries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d webhookDelivery
+		err = rows.Scan(&d.id, &d.jobID, &d.taskID, &d.event, &d.attempts)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over webhook deliveries")
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLiteStore) RemoveWebhook(cx context.Context, id string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return removeWebhook(cx, id, s.db)
+}
+
+func (s *SQLiteStore) RetryWebhook(cx context.Context, d webhookDelivery,
+									sendErr error) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return retryWebhook(cx, d, sendErr, s.db)
+}
+
+// activeProbe is what the targets are matched against of a probe
+type activeProbe struct {
+	Id					string `db:"id"`
+	ProbeCC				string `db:"probe_cc"`
+	ProbeASN			string `db:"probe_asn"`
+	Platform			string `db:"platform"`
+	Region				string `db:"region"`
+	Locale				string `db:"locale"`
+	SoftwareName		string `db:"software_name"`
+	SoftwareVersion		string `db:"software_version"`
+	NetworkType			string `db:"network_type"`
+	AttestationLevel	string `db:"attestation_level"`
+	Token				string `db:"token"`
+	Tags				pq.StringArray `db:"tags"`
+	SupportedTests		pq.StringArray `db:"supported_tests"`
+	LastSeen			*time.Time `db:"last_seen"`
+	LastUpdated			*time.Time `db:"last_updated"`
+}
+
+// probeRows returns the probes matching the condition which aren't blocked,
+// by id nor by token.
+func (s *SQLiteStore) probeRows(cx context.Context, where string,
+								args ...interface{}) ([]activeProbe, error) {
+	var rows []activeProbe
+	query := fmt.Sprintf(`SELECT
+		CAST(id AS TEXT) AS id,
+		COALESCE(probe_cc, '') AS probe_cc,
+		COALESCE(probe_asn, '') AS probe_asn,
+		COALESCE(platform, '') AS platform,
+		COALESCE(region, '') AS region,
+		COALESCE(locale, '') AS locale,
+		COALESCE(software_name, '') AS software_name,
+		COALESCE(software_version, '') AS software_version,
+		COALESCE(network_type, '') AS network_type,
+		COALESCE(attestation_level, '') AS attestation_level,
+		COALESCE(token, '') AS token,
+		tags,
+		supported_tests,
+		last_seen,
+		last_updated
+		FROM %s
+		WHERE %s`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		where)
+	err := s.db.SelectContext(cx, &rows, query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up the active probes")
+		return nil, err
+	}
+
+	var blocklist []struct {
+		Kind	string `db:"kind"`
+		Value	string `db:"value"`
+	}
+	query = fmt.Sprintf(`SELECT kind, value FROM %s`,
+		pq.QuoteIdentifier(viper.GetString("database.blocklist-table")))
+	if err = s.db.SelectContext(cx, &blocklist, query); err != nil {
+		ctx.WithError(err).Error("failed to look up the blocklist")
+		return nil, err
+	}
+	blocked := map[string]bool{}
+	for _, b := range blocklist {
+		blocked[b.Kind + ":" + b.Value] = true
+	}
+	unblocked := rows[:0]
+	for _, p := range rows {
+		if blocked[probes.BlockProbeID + ":" + p.Id] ||
+				(p.Token != "" && blocked[probes.BlockToken + ":" + p.Token]) {
+			continue
+		}
+		unblocked = append(unblocked, p)
+	}
+	return unblocked, nil
+}
+
+// supportsTest tells whether the probe can run the test, probes that didn't
+// declare their supported tests are assumed to run all of them
+func (p activeProbe) supportsTest(testName string) bool {
+	return len(p.SupportedTests) == 0 || contains(p.SupportedTests, testName)
+}
+
+// fields returns the values of the fields of the targeting expressions
+func (p activeProbe) fields() map[string][]string {
+	known := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	attestation := p.AttestationLevel
+	// Probes registered before attestation was supported have none
+	if attestation == "" {
+		attestation = "none"
+	}
+	return map[string][]string{
+		"country": known(p.ProbeCC),
+		"platform": known(p.Platform),
+		"asn": known(p.ProbeASN),
+		"software": known(p.SoftwareName),
+		"network": known(p.NetworkType),
+		"region": known(p.Region),
+		"probe": known(p.Id),
+		"tag": p.Tags,
+		"language": p.languages(),
+		"attestation": []string{attestation},
+	}
+}
+
+// languages returns the locale of the probe and its bare language
+func (p activeProbe) languages() []string {
+	if p.Locale == "" {
+		return nil
+	}
+	return []string{p.Locale, strings.SplitN(p.Locale, "-", 2)[0]}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a []string, b []string) bool {
+	for _, v := range a {
+		if contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled tells whether the probe is in the sample of run runID, hashing
+// them like the condition of the PostgresStore so that both pick the same
+// sample
+func sampled(probeID string, runID int64, rate float64) bool {
+	sum := md5.Sum([]byte(probeID + ":" + strconv.FormatInt(runID, 10)))
+	return float64(binary.BigEndian.Uint32(sum[:4])) / 4294967296.0 < rate
+}
+
+// targetMatcher returns whether a probe is matched by the target in run
+// runID of a job running testName, once the cohorts and the coverage it
+// depends on are looked up. Like Target.conditions, the software version
+// and the segment are left to the caller.
+func (s *SQLiteStore) targetMatcher(cx context.Context, t Target, runID int64,
+									testName string) (func(p activeProbe) bool, error) {
+	var expr *targeting.Expr
+	if t.Expression != "" {
+		var err error
+		// Targets are validated when jobs are added
+		expr, err = targeting.Parse(t.Expression)
+		if err != nil {
+			ctx.WithError(err).Error("invalid targeting expression")
+			return nil, err
+		}
+	}
+	var cohortMembers map[string]bool
+	if len(t.ProbeCohorts) > 0 {
+		query, args, err := sqlx.In(fmt.Sprintf(`SELECT probe_id FROM %s
+			WHERE cohort_name IN (?)`,
+			pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table"))),
+			t.ProbeCohorts)
+		if err != nil {
+			return nil, err
+		}
+		var members []string
+		if err = s.db.SelectContext(cx, &members, query, args...); err != nil {
+			ctx.WithError(err).Error("failed to get probe cohort members")
+			return nil, err
+		}
+		cohortMembers = map[string]bool{}
+		for _, id := range members {
+			cohortMembers[id] = true
+		}
+	}
+	var gapCells map[string]bool
+	if t.Mode == CoverageGapMode {
+		var err error
+		if gapCells, err = s.coverageGapCells(cx, t, testName); err != nil {
+			return nil, err
+		}
+	}
+	activeWithin, _ := t.activeWithin()
+	activeSince := time.Now().UTC().Add(-activeWithin)
+
+	return func(p activeProbe) bool {
+		if testName != "" && !p.supportsTest(testName) {
+			return false
+		}
+		if len(t.Countries) > 0 && !contains(t.Countries, p.ProbeCC) {
+			return false
+		}
+		if len(t.Platforms) > 0 && !contains(t.Platforms, p.Platform) {
+			return false
+		}
+		if len(t.Regions) > 0 && !contains(t.Regions, p.Region) {
+			return false
+		}
+		if contains(t.ExcludeCountries, p.ProbeCC) ||
+				contains(t.ExcludePlatforms, p.Platform) {
+			return false
+		}
+		if len(t.Languages) > 0 && !overlaps(t.Languages, p.languages()) {
+			return false
+		}
+		if len(t.ProbeIds) > 0 && !contains(t.ProbeIds, p.Id) {
+			return false
+		}
+		if contains(t.ExcludeProbeIds, p.Id) {
+			return false
+		}
+		if activeWithin > 0 {
+			lastSeen := p.LastSeen
+			if lastSeen == nil {
+				lastSeen = p.LastUpdated
+			}
+			if lastSeen == nil || lastSeen.Before(activeSince) {
+				return false
+			}
+		}
+		if cohortMembers != nil && !cohortMembers[p.Id] {
+			return false
+		}
+		if len(t.Tags) > 0 && !overlaps(t.Tags, p.Tags) {
+			return false
+		}
+		if expr != nil && !expr.Match(p.fields()) {
+			return false
+		}
+		if gapCells != nil && !gapCells[p.ProbeCC + "/" + p.ProbeASN] {
+			return false
+		}
+		if t.SampleRate > 0 && t.SampleRate < 1 &&
+				!sampled(p.Id, runID, t.SampleRate) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// coverageGapCells returns the country/ASN cells of the active probes with
+// the fewest measurements of testName in the coverage window, as
+// "probe_cc/probe_asn". Cells without any coverage data come first.
+func (s *SQLiteStore) coverageGapCells(cx context.Context, t Target,
+										testName string) (map[string]bool, error) {
+	type cell struct {
+		ProbeCC			string `db:"probe_cc"`
+		ProbeASN		string `db:"probe_asn"`
+		Measurements	int64 `db:"measurements"`
+	}
+	var cells []cell
+	query := fmt.Sprintf(`SELECT DISTINCT probe_cc, probe_asn
+		FROM %s
+		WHERE probe_cc IS NOT NULL AND probe_asn IS NOT NULL`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	if err := s.db.SelectContext(cx, &cells, query); err != nil {
+		ctx.WithError(err).Error("failed to look up the probe cells")
+		return nil, err
+	}
+
+	window, _ := t.coverageWindow()
+	var coverage []cell
+	query = fmt.Sprintf(`SELECT probe_cc, probe_asn,
+		SUM(measurement_count) AS measurements
+		FROM %s
+		WHERE test_name = ? AND measurement_date >= ?
+		GROUP BY probe_cc, probe_asn`,
+		pq.QuoteIdentifier(viper.GetString("database.measurement-coverage-table")))
+	err := s.db.SelectContext(cx, &coverage, query, testName,
+						time.Now().UTC().Add(-window).Format("2006-01-02"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up the coverage")
+		return nil, err
+	}
+	measurements := map[string]int64{}
+	for _, c := range coverage {
+		measurements[c.ProbeCC + "/" + c.ProbeASN] = c.Measurements
+	}
+	for i := range cells {
+		cells[i].Measurements = measurements[cells[i].ProbeCC + "/" + cells[i].ProbeASN]
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Measurements != cells[j].Measurements {
+			return cells[i].Measurements < cells[j].Measurements
+		}
+		if cells[i].ProbeCC != cells[j].ProbeCC {
+			return cells[i].ProbeCC < cells[j].ProbeCC
+		}
+		return cells[i].ProbeASN < cells[j].ProbeASN
+	})
+	limit := t.CoverageCells
+	if limit <= 0 {
+		limit = viper.GetInt64("targeting.coverage-cells")
+	}
+	gaps := map[string]bool{}
+	for i := 0; i < len(cells) && int64(i) < limit; i++ {
+		gaps[cells[i].ProbeCC + "/" + cells[i].ProbeASN] = true
+	}
+	return gaps, nil
+}
+
+// findProbes returns the active probes matched by the target in run runID
+// of a job running testName
+func (s *SQLiteStore) findProbes(cx context.Context, t Target, runID int64,
+								testName string) ([]MatchingProbe, error) {
+	var matching []MatchingProbe
+
+	versionConstraint, err := ParseVersionConstraint(t.Version)
+	if err != nil {
+		ctx.WithError(err).Error("invalid target version")
+		return matching, err
+	}
+	matches, err := s.targetMatcher(cx, t, runID, testName)
+	if err != nil {
+		return matching, err
+	}
+	if t.Segment != "" {
+		// Segments are resolved on every run so that updating them
+		// updates all the jobs using them
+		segment, err := s.getSegment(cx, t.Segment, 0)
+		if err != nil {
+			return matching, err
+		}
+		segmentConstraint, err := ParseVersionConstraint(segment.Target.Version)
+		if err != nil {
+			ctx.WithError(err).Error("invalid segment version")
+			return matching, err
+		}
+		versionConstraint = append(versionConstraint, segmentConstraint...)
+		segmentMatches, err := s.targetMatcher(cx, segment.Target, runID, testName)
+		if err != nil {
+			return matching, err
+		}
+		targetMatches := matches
+		matches = func(p activeProbe) bool {
+			return targetMatches(p) && segmentMatches(p)
+		}
+	}
+
+	// Probes that opted out are never targeted
+	probes, err := s.probeRows(cx, "deactivated_at IS NULL")
+	if err != nil {
+		return matching, err
+	}
+	for _, p := range probes {
+		if !matches(p) || !versionConstraint.Matches(p.SoftwareVersion) {
+			continue
+		}
+		matching = append(matching, MatchingProbe{
+			Id: p.Id,
+			ProbeCC: p.ProbeCC,
+			Platform: p.Platform,
+		})
+	}
+	return matching, nil
+}
+
+func (s *SQLiteStore) FindProbes(cx context.Context, t Target, runID int64,
+								testName string) ([]MatchingProbe, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return s.findProbes(cx, t, runID, testName)
+}
+
+// probesByID returns the probes with the ids, only the active ones if
+// active is set, whether blocked or not
+func (s *SQLiteStore) probesByID(cx context.Context, probeIDs []string,
+								active bool) (map[string]MatchingProbe, error) {
+	found := map[string]MatchingProbe{}
+	if len(probeIDs) == 0 {
+		return found, nil
+	}
+	query := fmt.Sprintf(`SELECT
+		CAST(id AS TEXT),
+		COALESCE(probe_cc, ''),
+		COALESCE(platform, '')
+		FROM %s
+		WHERE CAST(id AS TEXT) IN (?)`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	if active {
+		query += " AND deactivated_at IS NULL"
+	}
+	query, args, err := sqlx.In(query, probeIDs)
+	if err != nil {
+		return found, err
+	}
+	rows, err := s.db.QueryContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up probes")
+		return found, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p MatchingProbe
+		if err = rows.Scan(&p.Id, &p.ProbeCC, &p.Platform); err != nil {
+			ctx.WithError(err).Error("failed to iterate over probes")
+			return found, err
+		}
+		found[p.Id] = p
+	}
+	return found, rows.Err()
+}
+
+// checkProbesExist makes sure that all the probes are registered
+func (s *SQLiteStore) checkProbesExist(cx context.Context, probeIDs []string) error {
+	found, err := s.probesByID(cx, probeIDs, false)
+	if err != nil {
+		return err
+	}
+	for _, id := range probeIDs {
+		if _, ok := found[id]; !ok {
+			return ErrUnknownProbe
+		}
+	}
+	return nil
+}
+
+// checkProbeCohortsExist makes sure that all the cohorts were created
+func (s *SQLiteStore) checkProbeCohortsExist(cx context.Context,
+											names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT name FROM %s WHERE name IN (?)`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table"))),
+		names)
+	if err != nil {
+		return err
+	}
+	var found []string
+	if err = s.db.SelectContext(cx, &found, query, args...); err != nil {
+		ctx.WithError(err).Error("failed to lookup probe cohorts")
+		return err
+	}
+	for _, name := range names {
+		if !contains(found, name) {
+			return ErrProbeCohortNotFound
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) validateTarget(cx context.Context, t Target) error {
+	if err := t.validateFields(); err != nil {
+		return err
+	}
+	if t.Segment != "" {
+		if _, err := s.getSegment(cx, t.Segment, 0); err != nil {
+			return err
+		}
+	}
+	if err := s.checkProbeCohortsExist(cx, t.ProbeCohorts); err != nil {
+		return err
+	}
+	if err := s.checkProbesExist(cx, t.ProbeIds); err != nil {
+		return err
+	}
+	return s.checkProbesExist(cx, t.ExcludeProbeIds)
+}
+
+// ValidateTarget checks that the target can be matched against the probes
+func (s *SQLiteStore) ValidateTarget(cx context.Context, t Target) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return s.validateTarget(cx, t)
+}
+
+// JobCohort returns the probes of the frozen cohort of the job which are
+// still active
+func (s *SQLiteStore) JobCohort(cx context.Context, jobID string) ([]MatchingProbe, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		cohort []MatchingProbe
+		probeIDs []string
+	)
+	query := fmt.Sprintf(`SELECT probe_id FROM %s WHERE job_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.job-cohorts-table")))
+	if err := s.db.SelectContext(cx, &probeIDs, query, jobID); err != nil {
+		ctx.WithError(err).Error("failed to get cohort")
+		return cohort, err
+	}
+	found, err := s.probesByID(cx, probeIDs, true)
+	if err != nil {
+		return cohort, err
+	}
+	for _, id := range probeIDs {
+		if p, ok := found[id]; ok {
+			cohort = append(cohort, p)
+		}
+	}
+	return cohort, nil
+}
+
+// ExportDeviceData returns everything stored about the probe
+func (s *SQLiteStore) ExportDeviceData(cx context.Context,
+										probeID string) (DeviceDataExport, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var (
+		export DeviceDataExport
+		err error
+	)
+	export.Device, err = s.exportDevice(cx, probeID)
+	if err != nil {
+		return export, err
+	}
+
+	query := fmt.Sprintf(`SELECT
+		(SELECT json_group_array(json_object(
+				'id', t.id, 'probe_id', t.probe_id, 'job_id', t.job_id,
+				'test_name', t.test_name, 'arguments', json(t.arguments),
+				'state', t.state, 'progress', t.progress,
+				'creation_time', t.creation_time,
+				'notification_time', t.notification_time,
+				'accept_time', t.accept_time, 'done_time', t.done_time,
+				'last_updated', t.last_updated, 'run_id', t.run_id,
+				'lease_expires_at', t.lease_expires_at,
+				'report_ids', json(t.report_ids),
+				'measurement_uids', json(t.measurement_uids))
+				ORDER BY t.creation_time)
+			FROM %s AS t WHERE t.probe_id = ?1),
+		(SELECT json_group_array(json_object(
+				'id', r.id, 'task_id', r.task_id, 'probe_id', r.probe_id,
+				'report_id', r.report_id, 'summary', json(r.summary),
+				'creation_time', r.creation_time)
+				ORDER BY r.creation_time)
+			FROM %s AS r WHERE r.probe_id = ?1),
+		(SELECT json_group_array(json_object(
+				'id', e.id, 'task_id', e.task_id, 'probe_id', e.probe_id,
+				'exception_class', e.exception_class, 'message', e.message,
+				'app_version', e.app_version,
+				'creation_time', e.creation_time)
+				ORDER BY e.creation_time)
+			FROM %s AS e WHERE e.probe_id = ?1),
+		(SELECT json_group_array(json_object(
+				'id', a.id, 'title', a.title, 'publish_at', a.publish_at,
+				'ack_time', ar.ack_time)
+				ORDER BY a.publish_at)
+			FROM %s AS ar JOIN %s AS a ON a.id = ar.alert_id
+			WHERE ar.probe_id = ?1)`,
+		pq.QuoteIdentifier(viper.GetString("database.tasks-table")),
+		pq.QuoteIdentifier(viper.GetString("database.task-results-table")),
+		pq.QuoteIdentifier(viper.GetString("database.task-errors-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	err = s.db.QueryRowContext(cx, query, probeID).Scan(&export.Tasks, &export.Results,
+														&export.Errors, &export.Alerts)
+	if err != nil {
+		ctx.WithError(err).Error("failed to export device data")
+		return export, err
+	}
+	export.ExportTime = time.Now().UTC()
+	return export, nil
+}
+
+// The tables of the SQLiteStore referring to probes by probe_id
+var sqliteProbeDataTables = []string{
+	"database.task-results-table",
+	"database.task-errors-table",
+	"database.task-outbox-table",
+	"database.tasks-table",
+	"database.idempotency-keys-table",
+	"database.alert-recipients-table",
+	"database.job-cohorts-table",
+	"database.probe-cohort-members-table",
+}
+
+// PurgeDeviceData deletes everything the SQLiteStore keeps about the tasks
+// of the probe, its registration is left to PurgeDeletedDevices
+func (s *SQLiteStore) PurgeDeviceData(cx context.Context, probeID string) error {
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range sqliteProbeDataTables {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE probe_id = ?`,
+			pq.QuoteIdentifier(viper.GetString(table)))
+		if _, err = tx.ExecContext(cx, query, probeID); err != nil {
+			ctx.WithError(err).Errorf("failed to purge device from %s",
+										viper.GetString(table))
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit purge")
+		return err
+	}
+	return nil
+}
+
+// PurgeDeletedDevices purges the probes whose deletion was requested more
+// than grace ago. The data of their tasks goes first, as the probe is no
+// longer pending deletion once its registration is purged. There are no
+// notifications to purge, they are only queued by proteus-notify.
+func (s *SQLiteStore) PurgeDeletedDevices(cx context.Context,
+										grace time.Duration) (int, error) {
+	probeIDs, err := probes.PendingDeletions(s.db, time.Now().UTC().Add(-grace))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, probeID := range probeIDs {
+		if err = s.PurgeDeviceData(cx, probeID); err != nil {
+			continue
+		}
+		if err = s.purgeRegistration(cx, probeID); err != nil {
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *SQLiteStore) purgeRegistration(cx context.Context, probeID string) error {
+	tx, err := s.db.BeginTx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	if err = probes.PurgeDevice(tx, probeID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit purge")
+		return err
+	}
+	return nil
+}
+
+// The columns of the registry tables holding Postgres array literals
+var sqliteArrayColumns = map[string]bool{
+	"supported_tests": true,
+	"tags": true,
+	"notify_categories": true,
+	"changed_fields": true,
+}
+
+// exportDevice is probes.ExportDevice, whose to_jsonb SQLite doesn't have:
+// the rows are made into JSON objects here, leaving out the same secrets.
+func (s *SQLiteStore) exportDevice(cx context.Context,
+									probeID string) (probes.DeviceExport, error) {
+	var export probes.DeviceExport
+	probe, err := s.exportRows(cx, fmt.Sprintf(`SELECT * FROM %s WHERE id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table"))),
+		probeID)
+	if err != nil {
+		return export, err
+	}
+	if len(probe) == 0 {
+		return export, probes.ErrClientNotFound
+	}
+	for _, column := range []string{"callback_secret", "request_secret",
+									"webpush_p256dh", "webpush_auth"} {
+		delete(probe[0], column)
+	}
+	updates, err := s.exportRows(cx, fmt.Sprintf(`SELECT * FROM %s
+		WHERE client_id = ? ORDER BY update_time`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-updates-table"))),
+		probeID)
+	if err != nil {
+		return export, err
+	}
+	tokens, err := s.exportRows(cx, fmt.Sprintf(`SELECT * FROM %s
+		WHERE probe_id = ? ORDER BY retired_at`,
+		pq.QuoteIdentifier(viper.GetString("database.token-history-table"))),
+		probeID)
+	if err != nil {
+		return export, err
+	}
+
+	for _, v := range []struct {
+		dest	*types.JSONText
+		value	interface{}
+	}{
+		{&export.Probe, probe[0]},
+		{&export.Updates, updates},
+		{&export.Tokens, tokens},
+	} {
+		if *v.dest, err = json.Marshal(v.value); err != nil {
+			ctx.WithError(err).Error("failed to serialise device export")
+			return export, err
+		}
+	}
+	return export, nil
+}
+
+// exportRows returns the rows of the query by column
+func (s *SQLiteStore) exportRows(cx context.Context, query string,
+								args ...interface{}) ([]map[string]interface{}, error) {
+	var exported = make([]map[string]interface{}, 0)
+	rows, err := s.db.QueryxContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to export device")
+		return exported, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err = rows.MapScan(row); err != nil {
+			ctx.WithError(err).Error("failed to iterate over device export")
+			return exported, err
+		}
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+				row[column] = value
+			}
+			if str, ok := value.(string); ok && sqliteArrayColumns[column] {
+				var a pq.StringArray
+				if err = a.Scan(str); err != nil {
+					return exported, err
+				}
+				row[column] = []string(a)
+			}
+		}
+		exported = append(exported, row)
+	}
+	return exported, rows.Err()
+}
+
+// IngestCoverage stores the coverage entries, replacing the counts already
+// known for the same cell, test and day.
+func (s *SQLiteStore) IngestCoverage(cx context.Context, entries []CoverageEntry) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		probe_cc, probe_asn,
+		test_name,
+		measurement_date,
+		measurement_count
+	) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (probe_cc, probe_asn, test_name, measurement_date)
+	DO UPDATE SET measurement_count = excluded.measurement_count`,
+		pq.QuoteIdentifier(viper.GetString("database.measurement-coverage-table")))
+	for _, e := range entries {
+		date, err := time.Parse("2006-01-02", e.Date)
+		if err != nil {
+			return fmt.Errorf("invalid date %q", e.Date)
+		}
+		_, err = tx.ExecContext(cx, query, e.ProbeCC, e.ProbeASN,
+								e.TestName,
+								date.Format("2006-01-02"),
+								e.Count)
+		if err != nil {
+			ctx.WithError(err).Error("failed to insert into coverage table")
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit transaction, rolling back")
+		return err
+	}
+	return nil
+}
+
+// CreateProbeCohort creates an empty cohort
+func (s *SQLiteStore) CreateProbeCohort(cx context.Context, pc ProbeCohort) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	if pc.Name == "" {
+		return errors.New("missing probe cohort name")
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (name, comment, creation_time)
+		VALUES (?, ?, ?)
+		ON CONFLICT (name) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")))
+	res, err := s.db.ExecContext(cx, query, pc.Name, pc.Comment, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into probe cohorts table")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeCohortExists
+	}
+	return nil
+}
+
+// ListProbeCohorts returns every cohort with how many probes it has
+func (s *SQLiteStore) ListProbeCohorts(cx context.Context) ([]ProbeCohort, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var cohorts = make([]ProbeCohort, 0)
+	query := fmt.Sprintf(`SELECT
+		c.name, COALESCE(c.comment, ''), c.creation_time, COUNT(m.probe_id)
+		FROM %s AS c
+		LEFT JOIN %s AS m ON m.cohort_name = c.name
+		GROUP BY c.name
+		ORDER BY c.name`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")),
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	rows, err := s.db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list probe cohorts")
+		return cohorts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pc ProbeCohort
+		err = rows.Scan(&pc.Name, &pc.Comment, &pc.CreationTime, &pc.Size)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over probe cohorts")
+			return cohorts, err
+		}
+		cohorts = append(cohorts, pc)
+	}
+	return cohorts, rows.Err()
+}
+
+// ProbeCohortMembers returns the probes of the cohort, the most recently
+// added first
+func (s *SQLiteStore) ProbeCohortMembers(cx context.Context,
+										name string) ([]ProbeCohortMember, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var members = make([]ProbeCohortMember, 0)
+	if err := s.checkProbeCohortsExist(cx, []string{name}); err != nil {
+		return members, err
+	}
+	var rows []struct {
+		ProbeId	string `db:"probe_id"`
+		AddedAt	time.Time `db:"added_at"`
+	}
+	query := fmt.Sprintf(`SELECT probe_id, added_at
+		FROM %s
+		WHERE cohort_name = ?
+		ORDER BY added_at DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	if err := s.db.SelectContext(cx, &rows, query, name); err != nil {
+		ctx.WithError(err).Error("failed to get probe cohort members")
+		return members, err
+	}
+	probeIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		probeIDs = append(probeIDs, row.ProbeId)
+	}
+	found, err := s.probesByID(cx, probeIDs, false)
+	if err != nil {
+		return members, err
+	}
+	for _, row := range rows {
+		p := found[row.ProbeId]
+		members = append(members, ProbeCohortMember{
+			ProbeId: row.ProbeId,
+			ProbeCC: p.ProbeCC,
+			Platform: p.Platform,
+			AddedAt: row.AddedAt,
+		})
+	}
+	return members, nil
+}
+
+// AddProbeCohortMembers adds the probes to the cohort, returning how many
+// weren't in it already.
+func (s *SQLiteStore) AddProbeCohortMembers(cx context.Context, name string,
+											probeIDs []string) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	if err := s.checkProbeCohortsExist(cx, []string{name}); err != nil {
+		return 0, err
+	}
+	if err := s.checkProbesExist(cx, probeIDs); err != nil {
+		return 0, err
+	}
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return 0, err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`INSERT INTO %s (cohort_name, probe_id, added_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (cohort_name, probe_id) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	var added int64
+	now := time.Now().UTC()
+	for _, probeID := range probeIDs {
+		res, err := tx.ExecContext(cx, query, name, probeID, now)
+		if err != nil {
+			ctx.WithError(err).Error("failed to add probe cohort members")
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		added += n
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit probe cohort members")
+		return 0, err
+	}
+	return added, nil
+}
+
+// RemoveProbeCohortMember removes the probe from the cohort
+func (s *SQLiteStore) RemoveProbeCohortMember(cx context.Context, name string,
+											probeID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE cohort_name = ? AND probe_id = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")))
+	res, err := s.db.ExecContext(cx, query, name, probeID)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove probe cohort member")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeNotInCohort
+	}
+	return nil
+}
+
+// DeleteProbeCohort deletes a cohort no active job targets
+func (s *SQLiteStore) DeleteProbeCohort(cx context.Context, name string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var inUse bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1
+		FROM %s AS j, json_each(j.target, '$.probe_cohorts') AS c
+		WHERE c.value = ? AND j.state = 'active')`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if err := s.db.QueryRowContext(cx, query, name).Scan(&inUse); err != nil {
+		ctx.WithError(err).Error("failed to check probe cohort usage")
+		return err
+	}
+	if inUse {
+		return ErrProbeCohortInUse
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %s WHERE name = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-cohorts-table")))
+	res, err := s.db.ExecContext(cx, query, name)
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete probe cohort")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProbeCohortNotFound
+	}
+	return nil
+}
+
+// PutSegment stores a new version of the segment and returns its number
+func (s *SQLiteStore) PutSegment(cx context.Context, seg Segment) (int64, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	if seg.Target.Segment != "" {
+		return 0, ErrNestedSegment
+	}
+	if err := s.validateTarget(cx, seg.Target); err != nil {
+		return 0, err
+	}
+	targetStr, err := json.Marshal(seg.Target)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise segment target")
+		return 0, err
+	}
+
+	var version int64
+	query := fmt.Sprintf(`INSERT INTO %[1]s (
+		name, version,
+		comment,
+		target,
+		creation_time
+	) SELECT
+		?1, COALESCE(MAX(version), 0) + 1,
+		?2,
+		?3,
+		?4
+		FROM %[1]s WHERE name = ?1
+	RETURNING version`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	err = s.db.QueryRowContext(cx, query, seg.Name,
+								seg.Comment,
+								string(targetStr),
+								time.Now().UTC()).Scan(&version)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into segments table")
+		return 0, err
+	}
+	return version, nil
+}
+
+func (s *SQLiteStore) getSegment(cx context.Context, name string,
+								version int64) (Segment, error) {
+	query := fmt.Sprintf(`SELECT
+		name, version,
+		COALESCE(comment, ''),
+		target,
+		creation_time
+		FROM %s
+		WHERE name = ?1 AND (?2 = 0 OR version = ?2)
+		ORDER BY version DESC
+		LIMIT 1`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	seg, err := scanSegment(s.db.QueryRowContext(cx, query, name, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return seg, ErrSegmentNotFound
+		}
+		ctx.WithError(err).Error("failed to get segment")
+		return seg, err
+	}
+	return seg, nil
+}
+
+// GetSegment returns the given version of the segment, or the latest one
+// if version is 0
+func (s *SQLiteStore) GetSegment(cx context.Context, name string,
+								version int64) (Segment, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	return s.getSegment(cx, name, version)
+}
+
+// ListSegments returns the latest version of every segment
+func (s *SQLiteStore) ListSegments(cx context.Context) ([]Segment, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var segments []Segment
+	segmentsTable := pq.QuoteIdentifier(viper.GetString("database.segments-table"))
+	query := fmt.Sprintf(`SELECT
+		s.name, s.version,
+		COALESCE(s.comment, ''),
+		s.target,
+		s.creation_time
+		FROM %s AS s
+		WHERE s.version = (SELECT MAX(version) FROM %s WHERE name = s.name)
+		ORDER BY s.name`,
+		segmentsTable, segmentsTable)
+	rows, err := s.db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list segments")
+		return segments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		seg, err := scanSegment(rows)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over segments")
+			return segments, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, rows.Err()
+}
+
+// DeleteSegment deletes all the versions of a segment no active job uses
+func (s *SQLiteStore) DeleteSegment(cx context.Context, name string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var inUse bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s
+		WHERE json_extract(target, '$.segment') = ? AND state = 'active')`,
+		pq.QuoteIdentifier(viper.GetString("database.jobs-table")))
+	if err := s.db.QueryRowContext(cx, query, name).Scan(&inUse); err != nil {
+		ctx.WithError(err).Error("failed to check segment usage")
+		return err
+	}
+	if inUse {
+		return ErrSegmentInUse
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %s WHERE name = ?`,
+		pq.QuoteIdentifier(viper.GetString("database.segments-table")))
+	res, err := s.db.ExecContext(cx, query, name)
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete segment")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSegmentNotFound
+	}
+	return nil
+}
+
+// AddAlert stores the alert and publishes it if it's due
+func (s *SQLiteStore) AddAlert(cx context.Context, a Alert) (string, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var err error
+	a.Severity, err = alertSeverity(a.Severity)
+	if err != nil {
+		return "", err
+	}
+	if err = s.validateTarget(cx, a.Target); err != nil {
+		return "", err
+	}
+	targetStr, err := json.Marshal(a.Target)
+	if err != nil {
+		ctx.WithError(err).Error("failed to serialise alert target")
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if a.PublishAt.IsZero() {
+		a.PublishAt = now
+	}
+	a.Id = uuid.NewV4().String()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, title, body, link, severity,
+		target, state, publish_at, creation_time
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	_, err = s.db.ExecContext(cx, query, a.Id, a.Title, a.Body, a.Link, a.Severity,
+					string(targetStr), AlertScheduled, a.PublishAt.UTC(), now)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into alerts table")
+		return "", err
+	}
+
+	if !a.PublishAt.After(now) {
+		if err = s.publishAlert(cx, a.Id, a.Target); err != nil {
+			// The publisher tries again on its next round
+			ctx.WithError(err).Warnf("failed to publish alert %s", a.Id)
+		}
+	}
+	return a.Id, nil
+}
+
+// publishAlert picks the probes currently matched by the target of a
+// scheduled alert as its recipients.
+func (s *SQLiteStore) publishAlert(cx context.Context, alertID string,
+									t Target) error {
+	probes, err := s.findProbes(cx, t, 0, "")
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`UPDATE %s SET state = ?2
+		WHERE id = ?1 AND state = ?3`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	res, err := tx.ExecContext(cx, query, alertID, AlertPublished, AlertScheduled)
+	if err != nil {
+		ctx.WithError(err).Error("failed to update alert state")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	query = fmt.Sprintf(`INSERT INTO %s (alert_id, probe_id) VALUES (?, ?)`,
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")))
+	for _, p := range probes {
+		if _, err = tx.ExecContext(cx, query, alertID, p.Id); err != nil {
+			ctx.WithError(err).Error("failed to insert alert recipient")
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit alert")
+		return err
+	}
+	ctx.Infof("published alert %s to %d probes", alertID, len(probes))
+	return nil
+}
+
+// PublishDueAlerts publishes the scheduled alerts whose time has come
+func (s *SQLiteStore) PublishDueAlerts(cx context.Context) (int, error) {
+	var due []struct {
+		Id		string `db:"id"`
+		Target	types.JSONText `db:"target"`
+	}
+	query := fmt.Sprintf(`SELECT id, target FROM %s
+		WHERE state = ? AND publish_at <= ?`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	err := s.db.SelectContext(cx, &due, query, AlertScheduled, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to list due alerts")
+		return 0, err
+	}
+	published := 0
+	for _, a := range due {
+		var t Target
+		if err = a.Target.Unmarshal(&t); err != nil {
+			ctx.WithError(err).Errorf("invalid target of alert %s", a.Id)
+			continue
+		}
+		if err = s.publishAlert(cx, a.Id, t); err != nil {
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+func (s *SQLiteStore) ListAlerts(cx context.Context) ([]Alert, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var alerts = make([]Alert, 0)
+	query := fmt.Sprintf(`SELECT
+		a.id, a.title, COALESCE(a.body, ''), COALESCE(a.link, ''),
+		a.severity, a.target, a.state, a.publish_at, a.creation_time,
+		COUNT(r.probe_id), COUNT(r.ack_time)
+		FROM %s AS a
+		LEFT JOIN %s AS r ON r.alert_id = a.id
+		GROUP BY a.id
+		ORDER BY a.creation_time DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")))
+	rows, err := s.db.QueryContext(cx, query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list alerts")
+		return alerts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			a Alert
+			target types.JSONText
+		)
+		err = rows.Scan(&a.Id, &a.Title, &a.Body, &a.Link,
+						&a.Severity, &target, &a.State, &a.PublishAt,
+						&a.CreationTime, &a.Recipients, &a.Acknowledged)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over alerts")
+			return alerts, err
+		}
+		if err = target.Unmarshal(&a.Target); err != nil {
+			return alerts, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// WithdrawAlert stops showing the alert to the probes that haven't
+// acknowledged it yet, or cancels it if it's still scheduled.
+func (s *SQLiteStore) WithdrawAlert(cx context.Context, alertID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s SET state = ?2
+		WHERE id = ?1 AND state != ?2`,
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	res, err := s.db.ExecContext(cx, query, alertID, AlertWithdrawn)
+	if err != nil {
+		ctx.WithError(err).Error("failed to withdraw alert")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// ProbeAlerts returns the published alerts the probe hasn't acknowledged
+// yet, the most severe first.
+func (s *SQLiteStore) ProbeAlerts(cx context.Context, probeID string) ([]ProbeAlert, error) {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	var alerts = make([]ProbeAlert, 0)
+	query := fmt.Sprintf(`SELECT
+		a.id, a.title, COALESCE(a.body, ''), COALESCE(a.link, ''),
+		a.severity, a.publish_at
+		FROM %s AS r
+		JOIN %s AS a ON a.id = r.alert_id
+		WHERE r.probe_id = ? AND r.ack_time IS NULL AND a.state = ?
+		ORDER BY CASE a.severity
+			WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END,
+			a.publish_at DESC`,
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")),
+		pq.QuoteIdentifier(viper.GetString("database.alerts-table")))
+	rows, err := s.db.QueryContext(cx, query, probeID, AlertPublished,
+									CriticalSeverity, WarningSeverity)
+	if err != nil {
+		ctx.WithError(err).Error("failed to get alerts")
+		return alerts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a ProbeAlert
+		err = rows.Scan(&a.Id, &a.Title, &a.Body, &a.Link,
+						&a.Severity, &a.PublishAt)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over alerts")
+			return alerts, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// AckAlert records that the alert was shown to the user of the probe.
+// Acknowledging an alert again keeps the time of the first ack.
+func (s *SQLiteStore) AckAlert(cx context.Context, alertID string,
+								probeID string) error {
+	cx, cancel := queryContext(cx)
+	defer cancel()
+	query := fmt.Sprintf(`UPDATE %s
+		SET ack_time = COALESCE(ack_time, ?3)
+		WHERE alert_id = ?1 AND probe_id = ?2`,
+		pq.QuoteIdentifier(viper.GetString("database.alert-recipients-table")))
+	res, err := s.db.ExecContext(cx, query, alertID, probeID, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Error("failed to ack alert")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// The probes register in the SQLite database, through the probes package
+// like with the PostgresStore.
+
+func (s *SQLiteStore) RegisterProbe(cx context.Context,
+									req probes.ClientData) (string, error) {
+	return probes.Register(s.db, req)
+}
+
+func (s *SQLiteStore) ProbeSettings(cx context.Context, probeCC string,
+									softwareVersion string) (settings.Settings, error) {
+	return settings.Resolve(s.db, probeCC, softwareVersion)
+}
+
+func (s *SQLiteStore) DeactivateProbe(cx context.Context, probeID string) error {
+	return probes.Deactivate(s.db, probeID)
+}
+
+func (s *SQLiteStore) RequestDeletion(cx context.Context, probeID string,
+										grace time.Duration) (time.Time, error) {
+	return probes.RequestDeletion(s.db, probeID, grace)
+}
+
+func (s *SQLiteStore) IsBlocked(cx context.Context, probeID string) (bool, error) {
+	return probes.IsBlocked(s.db, probeID)
+}
+
+func (s *SQLiteStore) TouchProbe(cx context.Context, probeID string) error {
+	return probes.Touch(s.db, probeID, time.Minute)
+}
+
+func (s *SQLiteStore) DeactivateStaleProbes(cx context.Context,
+											before time.Time) ([]string, error) {
+	return probes.DeactivateStale(s.db, before)
+}
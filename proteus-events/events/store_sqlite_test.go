@@ -0,0 +1,716 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/spf13/viper"
+)
+
+// newSQLiteStore returns a SQLiteStore in memory, with a few probes
+// registered
+func newSQLiteStore(t *testing.T) *SQLiteStore {
+	for key, table := range map[string]string{
+		"schema-version-table": "events_schema_version",
+		"jobs-table": "jobs",
+		"tasks-table": "tasks",
+		"tasks-archive-table": "tasks_archive",
+		"task-outbox-table": "task_outbox",
+		"webhook-deliveries-table": "webhook_deliveries",
+		"task-results-table": "task_results",
+		"task-errors-table": "task_errors",
+		"idempotency-keys-table": "idempotency_keys",
+		"segments-table": "segments",
+		"job-cohorts-table": "job_cohorts",
+		"measurement-coverage-table": "measurement_coverage",
+		"alerts-table": "alerts",
+		"alert-recipients-table": "alert_recipients",
+		"probe-cohorts-table": "probe_cohorts",
+		"probe-cohort-members-table": "probe_cohort_members",
+		"active-probes-table": "active_probes",
+		"blocklist-table": "probe_blocklist",
+	} {
+		viper.Set("database." + key, table)
+	}
+	viper.Set("core.task-lease", time.Hour)
+	viper.Set("targeting.coverage-window", "P7D")
+	viper.Set("targeting.coverage-cells", 10)
+
+	db, err := OpenSQLiteDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open the database (%v)", err)
+	}
+	// The arrays are Postgres array literals, like lib/pq reads them
+	_, err = db.Exec(`INSERT INTO active_probes
+		(id, probe_cc, probe_asn, platform, region, locale, software_version,
+		attestation_level, token, tags, supported_tests, last_seen)
+	VALUES
+		('p-ir-android', 'IR', 'AS1', 'android', 'IR-07', 'fa-IR', '2.1.0',
+		NULL, 'tok1', '{staff}', NULL, datetime('now')),
+		('p-ir-ios', 'IR', 'AS2', 'ios', 'IR-01', 'fa', '1.0.0',
+		'strong', 'tok2', '{}', '{web_connectivity}', datetime('now', '-60 days')),
+		('p-br-android', 'BR', 'AS3', 'android', NULL, 'pt-BR', '2.2.0',
+		NULL, 'tok3', '{beta,staff}', NULL, datetime('now')),
+		('p-blocked', 'IR', 'AS1', 'android', NULL, NULL, '2.1.0',
+		NULL, 'tok4', '{}', NULL, datetime('now')),
+		('p-gone', 'IR', 'AS1', 'android', NULL, NULL, '2.1.0',
+		NULL, 'tok5', '{}', NULL, datetime('now'));
+	UPDATE active_probes SET deactivated_at = datetime('now') WHERE id = 'p-gone';
+	INSERT INTO probe_blocklist (kind, value) VALUES ('token', 'tok4');`)
+	if err != nil {
+		t.Fatalf("failed to create the probes (%v)", err)
+	}
+	return NewSQLiteStore(db)
+}
+
+func probeIds(matching []MatchingProbe) map[string]bool {
+	ids := map[string]bool{}
+	for _, p := range matching {
+		ids[p.Id] = true
+	}
+	return ids
+}
+
+func TestSQLiteStoreJobs(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	schedule, err := ParseSchedule("R/2118-12-16T16:20:30Z/PT2M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jd := JobData{
+		Id: "job",
+		Schedule: "R/2118-12-16T16:20:30Z/PT2M",
+		Comment: "a job",
+		Priority: 2,
+		Task: Task{TestName: "web_connectivity",
+					Arguments: map[string]interface{}{"urls": []interface{}{"https://example.com"}}},
+		Target: Target{Countries: []string{"IR"}, Cohort: FrozenCohort},
+		CreatedBy: "owner",
+		SharedWith: []string{"friend"},
+	}
+	if err = store.CreateJob(bg, jd, schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetJob(bg, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Target.Countries) != 1 || got.Target.Countries[0] != "IR" ||
+			got.Task.TestName != "web_connectivity" || got.Task.Arguments == nil {
+		t.Errorf("expected the job to be stored (got: %+v)", got)
+	}
+	jobs, err := store.ListJobs(bg, false)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("expected 1 job (got: %v, %v)", jobs, err)
+	}
+	if jobs[0].State != "active" || jobs[0].Priority != 2 ||
+			len(jobs[0].SharedWith) != 1 || jobs[0].CreationTime.IsZero() {
+		t.Errorf("expected the job to be listed (got: %+v)", jobs[0])
+	}
+
+	active, err := store.ActiveJobs(bg)
+	if err != nil || len(active) != 1 {
+		t.Fatalf("expected 1 active job (got: %v)", err)
+	}
+	if !active[0].NextRunAt.Equal(schedule.StartTime) {
+		t.Errorf("expected the job to run at %s (got: %s)", schedule.StartTime,
+					active[0].NextRunAt)
+	}
+	active[0].TimesRun = 1
+	active[0].NextRunAt = schedule.StartTime.Add(2 * time.Minute)
+	if err = store.SaveJobRun(bg, active[0]); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ = store.ActiveJobs(bg); active[0].TimesRun != 1 {
+		t.Errorf("expected the run to be saved (got: %d)", active[0].TimesRun)
+	}
+
+	// The frozen cohort is the IR probes which are active and not blocked
+	cohort, err := store.JobCohort(bg, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := probeIds(cohort); len(ids) != 2 || !ids["p-ir-android"] ||
+			!ids["p-ir-ios"] {
+		t.Errorf("expected the cohort to be frozen (got: %v)", ids)
+	}
+
+	owner, sharedWith, err := store.JobOwner(bg, "job")
+	if err != nil || owner != "owner" || len(sharedWith) != 1 {
+		t.Errorf("expected the owner of the job (got: %s, %v, %v)", owner,
+					sharedWith, err)
+	}
+	if err = store.ShareJob(bg, "job", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, sharedWith, _ = store.JobOwner(bg, "job"); len(sharedWith) != 2 {
+		t.Errorf("expected the job to be shared (got: %v)", sharedWith)
+	}
+	if err = store.ShareJob(bg, "missing", nil); err != ErrJobNotFound {
+		t.Errorf("expected %v (got: %v)", ErrJobNotFound, err)
+	}
+
+	if err = store.DeleteJob(bg, "job"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetJob(bg, "job"); err != ErrJobNotFound {
+		t.Errorf("expected the deleted job to be hidden (got: %v)", err)
+	}
+	if jobs, _ = store.ListJobs(bg, true); len(jobs) != 1 || jobs[0].DeletedAt == nil {
+		t.Errorf("expected the deleted job to be listed (got: %v)", jobs)
+	}
+	j, err := store.RestoreJob(bg, "job")
+	if err != nil || j.Id != "job" || j.TimesRun != 1 {
+		t.Fatalf("expected the job to be restored (got: %v)", err)
+	}
+	if _, err = store.RestoreJob(bg, "job"); err != ErrJobNotFound {
+		t.Errorf("expected only deleted jobs to be restored (got: %v)", err)
+	}
+
+	store.DeleteJob(bg, "job")
+	if n, _ := store.PurgeJobs(bg, time.Now().UTC().Add(-time.Hour)); n != 0 {
+		t.Errorf("expected the job to be kept until its retention (got: %d)", n)
+	}
+	if n, _ := store.PurgeJobs(bg, time.Now().UTC().Add(time.Hour)); n != 1 {
+		t.Errorf("expected the job to be purged (got: %d)", n)
+	}
+	if cohort, _ = store.JobCohort(bg, "job"); len(cohort) != 0 {
+		t.Errorf("expected the cohort to be purged (got: %v)", cohort)
+	}
+}
+
+func TestSQLiteStoreTasks(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	jd := JobData{Id: "job", Schedule: "R/2118-12-16T16:20:30Z/PT2M",
+					Priority: 1, Task: Task{TestName: "web_connectivity"}}
+	if err := store.CreateJob(bg, jd, Schedule{}); err != nil {
+		t.Fatal(err)
+	}
+	probeIDs := []string{"p-ir-android", "p-br-android"}
+	created, err := store.CreateTasks(bg, "job", probeIDs, jd.Task, 1, JobTarget{})
+	if err != nil || len(created) != 2 {
+		t.Fatalf("expected 2 tasks (got: %v, %v)", created, err)
+	}
+	// Retrying the dispatch of the run returns the same tasks
+	again, err := store.CreateTasks(bg, "job", probeIDs, jd.Task, 1, JobTarget{})
+	if err != nil || len(again) != 2 || again[0].TaskId != created[0].TaskId ||
+			!again[0].NeedsNotify {
+		t.Fatalf("expected the tasks of the run to be reused (got: %v, %v)", again, err)
+	}
+	var outbox int
+	store.db.Get(&outbox, "SELECT COUNT(*) FROM task_outbox")
+	if outbox != 2 {
+		t.Errorf("expected 2 notifications to be queued (got: %d)", outbox)
+	}
+
+	tID := created[0].TaskId
+	tasks, err := store.TasksForProbe(bg, "p-ir-android", TaskCursor{})
+	if err != nil || len(tasks) != 1 || tasks[0].Id != tID || tasks[0].Priority != 1 {
+		t.Fatalf("expected the task of the probe (got: %v, %v)", tasks, err)
+	}
+	cursor := TaskCursor{Time: tasks[0].CreationTime, Id: tasks[0].Id}
+	if tasks, _ = store.TasksForProbe(bg, "p-ir-android", cursor); len(tasks) != 0 {
+		t.Errorf("expected no task after the cursor (got: %v)", tasks)
+	}
+	if err = store.MarkTasksNotified(bg, []string{tID}); err != nil {
+		t.Fatal(err)
+	}
+	task, err := store.GetTask(bg, tID)
+	if err != nil || task.State != taskstate.Notified || task.JobId != "job" {
+		t.Errorf("expected the task to be notified (got: %+v, %v)", task, err)
+	}
+	if again, _ = store.CreateTasks(bg, "job", probeIDs[:1], jd.Task, 1,
+									JobTarget{}); again[0].NeedsNotify {
+		t.Error("expected the notified task not to be notified again")
+	}
+
+	err = store.SetTaskState(bg, tID, taskstate.Ready, taskstate.Accepted)
+	if err != ErrInconsistentState {
+		t.Errorf("expected %v (got: %v)", ErrInconsistentState, err)
+	}
+	if err = store.SetTaskState(bg, tID, taskstate.Notified, taskstate.Accepted); err != nil {
+		t.Fatal(err)
+	}
+	if expired, _ := store.ExpireTaskLeases(bg); len(expired) != 0 {
+		t.Errorf("expected the lease to be running (got: %v)", expired)
+	}
+	store.SetTaskLease(bg, tID, time.Now().UTC().Add(-time.Minute))
+	expired, err := store.ExpireTaskLeases(bg)
+	if err != nil || len(expired) != 1 || expired[0].Id != tID ||
+			expired[0].ProbeId != "p-ir-android" {
+		t.Fatalf("expected the task to be returned to ready (got: %v, %v)", expired, err)
+	}
+
+	store.SetTaskState(bg, tID, taskstate.Ready, taskstate.Accepted)
+	if err = store.SetTaskState(bg, tID, taskstate.Accepted, taskstate.Done); err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetTaskMeasurements(bg, tID, TaskDoneReq{ReportIds: []string{"r"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SaveTaskResult(bg, TaskResult{TaskId: tID, ProbeId: "p-ir-android",
+							Summary: map[string]interface{}{"blocked": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SaveTaskError(bg, TaskError{TaskId: created[1].TaskId,
+							ProbeId: "p-br-android", ExceptionClass: "Timeout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := store.JobResults(bg, "job")
+	if err != nil || len(results) != 1 || results[0].Summary == nil {
+		t.Errorf("expected the result of the job (got: %v, %v)", results, err)
+	}
+	stats, err := store.JobStats(bg, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Tasks["done"] != 1 || stats.Tasks["ready"] != 1 || stats.Results != 1 ||
+			stats.Errors["Timeout"] != 1 || stats.NotificationLatency.Count != 1 {
+		t.Errorf("expected the stats of the job (got: %+v)", stats)
+	}
+	if _, err = store.JobStats(bg, "missing"); err != ErrJobNotFound {
+		t.Errorf("expected %v (got: %v)", ErrJobNotFound, err)
+	}
+
+	history, total, err := store.TaskHistory(bg, "p-ir-android", 10, 0)
+	if err != nil || total != 1 || len(history) != 1 ||
+			history[0].State != taskstate.Done {
+		t.Errorf("expected the history of the probe (got: %v, %d, %v)", history,
+					total, err)
+	}
+	unfinished, err := store.UnfinishedTasks(bg, "p-br-android")
+	if err != nil || len(unfinished) != 1 {
+		t.Errorf("expected 1 unfinished task (got: %v, %v)", unfinished, err)
+	}
+	if unfinished, _ = store.UnfinishedTasks(bg, "p-ir-android"); len(unfinished) != 0 {
+		t.Errorf("expected the done task to be finished (got: %v)", unfinished)
+	}
+
+	notices, err := store.ClaimNotices(bg, 10)
+	if err != nil || len(notices) != 2 {
+		t.Fatalf("expected 2 notices to be claimed (got: %v, %v)", notices, err)
+	}
+	for _, n := range notices {
+		if (n.target.TaskID == tID) != (n.state == string(taskstate.Done)) ||
+				n.attempts != 1 {
+			t.Errorf("expected the state of the task (got: %+v)", n)
+		}
+	}
+	if notices, _ = store.ClaimNotices(bg, 10); len(notices) != 0 {
+		t.Errorf("expected the claimed notices to be skipped (got: %v)", notices)
+	}
+
+	viper.Set("core.archive-tasks", true)
+	reaped, err := store.ReapTasks(bg, 0)
+	if err != nil || len(reaped) != 1 || reaped[0].Id != tID {
+		t.Fatalf("expected the done task to be reaped (got: %v, %v)", reaped, err)
+	}
+	var archived int
+	store.db.Get(&archived, "SELECT COUNT(*) FROM tasks_archive")
+	if archived != 1 {
+		t.Errorf("expected the reaped task to be archived (got: %d)", archived)
+	}
+	if err = store.PurgeDeviceData(bg, "p-br-android"); err != nil {
+		t.Fatal(err)
+	}
+	if unfinished, _ = store.UnfinishedTasks(bg, "p-br-android"); len(unfinished) != 0 {
+		t.Errorf("expected the tasks of the purged probe to be gone (got: %v)", unfinished)
+	}
+}
+
+func TestSQLiteStoreTasksForProbe(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	for _, testName := range []string{"web_connectivity", "whatsapp"} {
+		jd := JobData{Id: testName, Schedule: "R/2118-12-16T16:20:30Z/PT2M",
+						Task: Task{TestName: testName}}
+		if err := store.CreateJob(bg, jd, Schedule{}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := store.CreateTasks(bg, testName, []string{"p-ir-ios", "p-blocked"},
+									jd.Task, 1, JobTarget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The probe only supports web_connectivity
+	tasks, err := store.TasksForProbe(bg, "p-ir-ios", TaskCursor{})
+	if err != nil || len(tasks) != 1 || tasks[0].TestName != "web_connectivity" {
+		t.Errorf("expected the supported task only (got: %v, %v)", tasks, err)
+	}
+	if tasks, _ = store.TasksForProbe(bg, "p-blocked", TaskCursor{}); len(tasks) != 0 {
+		t.Errorf("expected the blocked probe to get no task (got: %v)", tasks)
+	}
+	store.DeleteJob(bg, "web_connectivity")
+	if tasks, _ = store.TasksForProbe(bg, "p-ir-ios", TaskCursor{}); len(tasks) != 0 {
+		t.Errorf("expected the tasks of deleted jobs to be hidden (got: %v)", tasks)
+	}
+}
+
+func TestSQLiteStoreIdempotencyKeys(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	reserved, err := store.ReserveIdempotencyKey(bg, "p", "k", "/path", "hash")
+	if err != nil || !reserved {
+		t.Fatalf("expected the key to be reserved (got: %v)", err)
+	}
+	if reserved, _ = store.ReserveIdempotencyKey(bg, "p", "k", "/path", "hash"); reserved {
+		t.Error("expected the key to be reserved once")
+	}
+	if err = store.StoreIdempotentResponse(bg, "p", "k", 200, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := store.IdempotentResponse(bg, "p", "k")
+	if err != nil || sr == nil || sr.StatusCode.Int64 != 200 ||
+			string(sr.Body) != "{}" {
+		t.Errorf("expected the stored response (got: %v, %v)", sr, err)
+	}
+	// Keys with a response are kept
+	store.ReleaseIdempotencyKey(bg, "p", "k")
+	if sr, _ = store.IdempotentResponse(bg, "p", "k"); sr == nil {
+		t.Error("expected the answered key to be kept")
+	}
+	if n, err := store.ReapIdempotencyKeys(bg, time.Hour); err != nil || n != 0 {
+		t.Errorf("expected the key to be kept for its ttl (got: %d, %v)", n, err)
+	}
+	if n, _ := store.ReapIdempotencyKeys(bg, 0); n != 1 {
+		t.Errorf("expected the key to be reaped (got: %d)", n)
+	}
+}
+
+func TestSQLiteStoreWebhooks(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	viper.Set("webhooks.backoff", "1h")
+	err := store.QueueWebhooks(bg, []webhookDelivery{
+		{id: "d1", jobID: "j", taskID: "t1", event: []byte(`{"task_id": "t1"}`)},
+		{id: "d2", jobID: "j", taskID: "t2", event: []byte(`{"task_id": "t2"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.ClaimWebhooks(bg, 10)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("expected 2 deliveries to be claimed (got: %v, %v)", claimed, err)
+	}
+	for _, d := range claimed {
+		if d.attempts != 1 || string(d.event) != `{"task_id": "` + d.taskID + `"}` {
+			t.Errorf("expected the queued event (got: %+v)", d)
+		}
+	}
+	if claimed, _ = store.ClaimWebhooks(bg, 10); len(claimed) != 0 {
+		t.Errorf("expected the claimed deliveries to be skipped (got: %v)", claimed)
+	}
+
+	store.RemoveWebhook(bg, "d1")
+	store.RetryWebhook(bg, webhookDelivery{id: "d2", attempts: 1},
+						errors.New("webhook returned 503"))
+	var left []struct {
+		Id			string `db:"id"`
+		LastError	string `db:"last_error"`
+	}
+	store.db.Select(&left, "SELECT id, last_error FROM webhook_deliveries")
+	if len(left) != 1 || left[0].Id != "d2" ||
+			left[0].LastError != "webhook returned 503" {
+		t.Errorf("expected d2 to be retried (got: %v)", left)
+	}
+}
+
+func TestSQLiteStoreFindProbes(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	tests := []struct {
+		target		Target
+		testName	string
+		expected	[]string
+	}{
+		{Target{}, "", []string{"p-ir-android", "p-ir-ios", "p-br-android"}},
+		{Target{}, "whatsapp", []string{"p-ir-android", "p-br-android"}},
+		{Target{Countries: []string{"IR"}}, "", []string{"p-ir-android", "p-ir-ios"}},
+		{Target{ExcludePlatforms: []string{"ios"}}, "",
+			[]string{"p-ir-android", "p-br-android"}},
+		{Target{Languages: []string{"pt"}}, "", []string{"p-br-android"}},
+		{Target{Languages: []string{"fa"}}, "", []string{"p-ir-android", "p-ir-ios"}},
+		{Target{Tags: []string{"beta"}}, "", []string{"p-br-android"}},
+		{Target{Regions: []string{"IR-07"}}, "", []string{"p-ir-android"}},
+		{Target{ProbeIds: []string{"p-ir-ios", "p-blocked"}}, "", []string{"p-ir-ios"}},
+		{Target{ActiveWithin: "P30D"}, "", []string{"p-ir-android", "p-br-android"}},
+		{Target{Version: ">=2.0.0"}, "", []string{"p-ir-android", "p-br-android"}},
+		{Target{Expression: "(country=IR AND NOT platform=ios) OR tag=beta"}, "",
+			[]string{"p-ir-android", "p-br-android"}},
+		{Target{Expression: "attestation=none"}, "",
+			[]string{"p-ir-android", "p-br-android"}},
+	}
+	for _, test := range tests {
+		matching, err := store.FindProbes(bg, test.target, 0, test.testName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := probeIds(matching)
+		if len(ids) != len(test.expected) {
+			t.Errorf("expected %v to match %v (got: %v)", test.target, test.expected, ids)
+			continue
+		}
+		for _, id := range test.expected {
+			if !ids[id] {
+				t.Errorf("expected %v to match %v (got: %v)", test.target,
+							test.expected, ids)
+			}
+		}
+	}
+
+	// A run samples the same probes as the PostgresStore, and always the
+	// same ones when retried
+	sample := Target{SampleRate: 0.5}
+	first, _ := store.FindProbes(bg, sample, 7, "")
+	for _, p := range first {
+		if !sampled(p.Id, 7, 0.5) {
+			t.Errorf("expected %s not to be sampled", p.Id)
+		}
+	}
+	if again, _ := store.FindProbes(bg, sample, 7, ""); len(again) != len(first) {
+		t.Errorf("expected the sample to be stable (got: %d, %d)", len(first), len(again))
+	}
+}
+
+func TestSQLiteStoreCoverageGap(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	today := time.Now().UTC().Format("2006-01-02")
+	err := store.IngestCoverage(bg, []CoverageEntry{
+		{ProbeCC: "IR", ProbeASN: "AS1", TestName: "web_connectivity", Date: today, Count: 5},
+		{ProbeCC: "IR", ProbeASN: "AS2", TestName: "web_connectivity", Date: today, Count: 50},
+		{ProbeCC: "BR", ProbeASN: "AS3", TestName: "web_connectivity", Date: today, Count: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The counts of a cell are replaced when they are ingested again
+	err = store.IngestCoverage(bg, []CoverageEntry{
+		{ProbeCC: "BR", ProbeASN: "AS3", TestName: "web_connectivity", Date: today, Count: 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matching, err := store.FindProbes(bg, Target{Mode: CoverageGapMode, CoverageCells: 1},
+										0, "web_connectivity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := probeIds(matching); len(ids) != 1 || !ids["p-ir-android"] {
+		t.Errorf("expected the least covered cell (got: %v)", ids)
+	}
+}
+
+func TestSQLiteStoreProbeCohorts(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	if err := store.CreateProbeCohort(bg, ProbeCohort{Name: "panel"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateProbeCohort(bg, ProbeCohort{Name: "panel"}); err != ErrProbeCohortExists {
+		t.Errorf("expected %v (got: %v)", ErrProbeCohortExists, err)
+	}
+	added, err := store.AddProbeCohortMembers(bg, "panel",
+									[]string{"p-ir-ios", "p-br-android"})
+	if err != nil || added != 2 {
+		t.Fatalf("expected 2 members to be added (got: %d, %v)", added, err)
+	}
+	if added, _ = store.AddProbeCohortMembers(bg, "panel", []string{"p-ir-ios"}); added != 0 {
+		t.Errorf("expected the member to be added once (got: %d)", added)
+	}
+	if _, err = store.AddProbeCohortMembers(bg, "panel", []string{"unknown"}); err != ErrUnknownProbe {
+		t.Errorf("expected %v (got: %v)", ErrUnknownProbe, err)
+	}
+	members, err := store.ProbeCohortMembers(bg, "panel")
+	if err != nil || len(members) != 2 || members[0].ProbeCC == "" {
+		t.Errorf("expected the members of the cohort (got: %v, %v)", members, err)
+	}
+	cohorts, err := store.ListProbeCohorts(bg)
+	if err != nil || len(cohorts) != 1 || cohorts[0].Size != 2 {
+		t.Errorf("expected the cohort to be listed (got: %v, %v)", cohorts, err)
+	}
+
+	target := Target{ProbeCohorts: []string{"panel"}, Platforms: []string{"android"}}
+	matching, err := store.FindProbes(bg, target, 0, "")
+	if ids := probeIds(matching); err != nil || len(ids) != 1 || !ids["p-br-android"] {
+		t.Errorf("expected the android probe of the cohort (got: %v, %v)", ids, err)
+	}
+	err = store.ValidateTarget(bg, Target{ProbeCohorts: []string{"missing"}})
+	if err != ErrProbeCohortNotFound {
+		t.Errorf("expected %v (got: %v)", ErrProbeCohortNotFound, err)
+	}
+
+	jd := JobData{Id: "job", Schedule: "R/2118-12-16T16:20:30Z/PT2M",
+					Task: Task{TestName: "web_connectivity"}, Target: target}
+	if err = store.CreateJob(bg, jd, Schedule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.DeleteProbeCohort(bg, "panel"); err != ErrProbeCohortInUse {
+		t.Errorf("expected %v (got: %v)", ErrProbeCohortInUse, err)
+	}
+	if err = store.RemoveProbeCohortMember(bg, "panel", "p-ir-ios"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.RemoveProbeCohortMember(bg, "panel", "p-ir-ios"); err != ErrProbeNotInCohort {
+		t.Errorf("expected %v (got: %v)", ErrProbeNotInCohort, err)
+	}
+	store.DeleteJob(bg, "job")
+	if err = store.DeleteProbeCohort(bg, "panel"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.ProbeCohortMembers(bg, "panel"); err != ErrProbeCohortNotFound {
+		t.Errorf("expected %v (got: %v)", ErrProbeCohortNotFound, err)
+	}
+}
+
+func TestSQLiteStoreSegments(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	seg := Segment{Name: "iran", Target: Target{Countries: []string{"IR"}}}
+	if version, err := store.PutSegment(bg, seg); err != nil || version != 1 {
+		t.Fatalf("expected version 1 (got: %d, %v)", version, err)
+	}
+	seg.Target.Platforms = []string{"ios"}
+	if version, err := store.PutSegment(bg, seg); err != nil || version != 2 {
+		t.Fatalf("expected version 2 (got: %d, %v)", version, err)
+	}
+	_, err := store.PutSegment(bg, Segment{Name: "nested", Target: Target{Segment: "iran"}})
+	if err != ErrNestedSegment {
+		t.Errorf("expected %v (got: %v)", ErrNestedSegment, err)
+	}
+	if s, err := store.GetSegment(bg, "iran", 1); err != nil || len(s.Target.Platforms) != 0 {
+		t.Errorf("expected the first version (got: %v, %v)", s, err)
+	}
+	segments, err := store.ListSegments(bg)
+	if err != nil || len(segments) != 1 || segments[0].Version != 2 {
+		t.Errorf("expected the latest version to be listed (got: %v, %v)", segments, err)
+	}
+
+	// The latest version of the segment is applied on top of the target
+	matching, err := store.FindProbes(bg, Target{Segment: "iran"}, 0, "")
+	if ids := probeIds(matching); err != nil || len(ids) != 1 || !ids["p-ir-ios"] {
+		t.Errorf("expected the probes of the segment (got: %v, %v)", ids, err)
+	}
+	jd := JobData{Id: "job", Schedule: "R/2118-12-16T16:20:30Z/PT2M",
+					Task: Task{TestName: "web_connectivity"},
+					Target: Target{Segment: "iran"}}
+	if err = store.CreateJob(bg, jd, Schedule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.DeleteSegment(bg, "iran"); err != ErrSegmentInUse {
+		t.Errorf("expected %v (got: %v)", ErrSegmentInUse, err)
+	}
+	store.DeleteJob(bg, "job")
+	if err = store.DeleteSegment(bg, "iran"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetSegment(bg, "iran", 0); err != ErrSegmentNotFound {
+		t.Errorf("expected %v (got: %v)", ErrSegmentNotFound, err)
+	}
+}
+
+func TestSQLiteStoreAlerts(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	if _, err := store.AddAlert(bg, Alert{Title: "t", Severity: "bogus"}); err != ErrInvalidSeverity {
+		t.Errorf("expected %v (got: %v)", ErrInvalidSeverity, err)
+	}
+	id, err := store.AddAlert(bg, Alert{Title: "outage",
+								Target: Target{Countries: []string{"IR"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled, err := store.AddAlert(bg, Alert{Title: "later", Severity: CriticalSeverity,
+								PublishAt: time.Now().UTC().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := store.ProbeAlerts(bg, "p-ir-android")
+	if err != nil || len(alerts) != 1 || alerts[0].Id != id ||
+			alerts[0].Severity != InfoSeverity {
+		t.Fatalf("expected the published alert (got: %v, %v)", alerts, err)
+	}
+	if alerts, _ = store.ProbeAlerts(bg, "p-br-android"); len(alerts) != 0 {
+		t.Errorf("expected the alert to target IR only (got: %v)", alerts)
+	}
+	if alerts, _ = store.ProbeAlerts(bg, "p-blocked"); len(alerts) != 0 {
+		t.Errorf("expected the blocked probe to get no alert (got: %v)", alerts)
+	}
+
+	// Once due the scheduled alert is published, the most severe first
+	store.db.Exec("UPDATE alerts SET publish_at = ? WHERE id = ?",
+					time.Now().UTC().Add(-time.Minute), scheduled)
+	if n, err := store.PublishDueAlerts(bg); err != nil || n != 1 {
+		t.Fatalf("expected 1 alert to be published (got: %d, %v)", n, err)
+	}
+	if n, _ := store.PublishDueAlerts(bg); n != 0 {
+		t.Errorf("expected the alert to be published once (got: %d)", n)
+	}
+	alerts, _ = store.ProbeAlerts(bg, "p-ir-android")
+	if len(alerts) != 2 || alerts[0].Id != scheduled {
+		t.Errorf("expected the critical alert first (got: %v)", alerts)
+	}
+
+	if err = store.AckAlert(bg, id, "p-ir-android"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.AckAlert(bg, id, "p-br-android"); err != ErrAlertNotFound {
+		t.Errorf("expected %v (got: %v)", ErrAlertNotFound, err)
+	}
+	all, err := store.ListAlerts(bg)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected 2 alerts (got: %v, %v)", all, err)
+	}
+	for _, a := range all {
+		if a.Id == id && (a.Recipients != 2 || a.Acknowledged != 1 ||
+				a.State != AlertPublished || len(a.Target.Countries) != 1) {
+			t.Errorf("expected the alert to reach 2 probes (got: %+v)", a)
+		}
+	}
+
+	if err = store.WithdrawAlert(bg, scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.WithdrawAlert(bg, scheduled); err != ErrAlertNotFound {
+		t.Errorf("expected %v (got: %v)", ErrAlertNotFound, err)
+	}
+	if alerts, _ = store.ProbeAlerts(bg, "p-ir-ios"); len(alerts) != 1 {
+		t.Errorf("expected the withdrawn alert to be hidden (got: %v)", alerts)
+	}
+}
+
+func TestSQLiteStoreBlocklist(t *testing.T) {
+	defer viper.Reset()
+	store := newSQLiteStore(t)
+	_, err := store.db.Exec("INSERT INTO probe_blocklist (kind, value) VALUES (?, ?)",
+							probes.BlockProbeID, "p-br-android")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matching, err := store.FindProbes(bg, Target{}, 0, "")
+	if ids := probeIds(matching); err != nil || len(ids) != 2 ||
+			ids["p-br-android"] || ids["p-blocked"] {
+		t.Errorf("expected the blocked probes to be left out (got: %v, %v)", ids, err)
+	}
+	// Blocked probes can still be referred to by the targets
+	if err = store.ValidateTarget(bg, Target{ProbeIds: []string{"p-blocked"}}); err != nil {
+		t.Errorf("expected the blocked probe to be known (got: %v)", err)
+	}
+	err = store.ValidateTarget(bg, Target{ExcludeProbeIds: []string{"unknown"}})
+	if err != ErrUnknownProbe {
+		t.Errorf("expected %v (got: %v)", ErrUnknownProbe, err)
+	}
+}
@@ -0,0 +1,692 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// memStore is a Store keeping everything in memory
+type memStore struct {
+	// Left nil, the operations no test uses panic
+	Store
+	mu		sync.Mutex
+	jobs	map[string]JobData
+	tasks	map[string]Task
+	// The task of every job, run and probe
+	runs	map[string]string
+	probes	[]MatchingProbe
+	// The state of the deleted jobs before they were deleted
+	deletedStates	map[string]string
+	leases	map[string]time.Time
+	results	[]TaskResult
+	// The probes which are blocked, were seen and were deactivated
+	blocked		map[string]bool
+	seen		map[string]bool
+	deactivated	map[string]bool
+	// The webhook deliveries queued, and when they are due
+	webhooks	map[string]webhookDelivery
+	webhooksDue	map[string]time.Time
+}
+
+var bg = context.Background()
+
+func newMemStore() *memStore {
+	return &memStore{
+		jobs: map[string]JobData{},
+		tasks: map[string]Task{},
+		runs: map[string]string{},
+		deletedStates: map[string]string{},
+		leases: map[string]time.Time{},
+		blocked: map[string]bool{},
+		seen: map[string]bool{},
+		deactivated: map[string]bool{},
+		webhooks: map[string]webhookDelivery{},
+		webhooksDue: map[string]time.Time{},
+	}
+}
+
+func (m *memStore) CreateJob(cx context.Context, jd JobData, schedule Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[jd.Id] = jd
+	return nil
+}
+
+func (m *memStore) GetJob(cx context.Context, jobID string) (JobData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jd, ok := m.jobs[jobID]
+	if !ok || jd.DeletedAt != nil {
+		return jd, ErrJobNotFound
+	}
+	return jd, nil
+}
+
+func (m *memStore) ListJobs(cx context.Context, showDeleted bool) ([]JobData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []JobData
+	for _, jd := range m.jobs {
+		if showDeleted || jd.State != "deleted" {
+			jobs = append(jobs, jd)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *memStore) DeleteJob(cx context.Context, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jd, ok := m.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if jd.DeletedAt == nil {
+		now := time.Now().UTC()
+		jd.DeletedAt = &now
+		m.deletedStates[jobID] = jd.State
+	}
+	jd.State = "deleted"
+	m.jobs[jobID] = jd
+	return nil
+}
+
+func (m *memStore) RestoreJob(cx context.Context, jobID string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jd, ok := m.jobs[jobID]
+	if !ok || jd.DeletedAt == nil {
+		return nil, ErrJobNotFound
+	}
+	jd.State = m.deletedStates[jobID]
+	if jd.State == "" {
+		jd.State = "active"
+	}
+	delete(m.deletedStates, jobID)
+	jd.DeletedAt = nil
+	m.jobs[jobID] = jd
+	schedule, err := ParseSchedule(jd.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Id: jd.Id, Comment: jd.Comment, Schedule: schedule,
+				NextRunAt: schedule.StartTime,
+				IsDone: jd.State == "done"}, nil
+}
+
+func (m *memStore) PurgeJobs(cx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var purged int64
+	for id, jd := range m.jobs {
+		if jd.DeletedAt != nil && jd.DeletedAt.Before(before) {
+			delete(m.jobs, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *memStore) JobStats(cx context.Context, jobID string) (JobStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if jd, ok := m.jobs[jobID]; !ok || jd.DeletedAt != nil {
+		return JobStats{JobId: jobID}, ErrJobNotFound
+	}
+	return JobStats{JobId: jobID}, nil
+}
+
+func (m *memStore) ActiveJobs(cx context.Context) ([]*Job, error) {
+	return nil, nil
+}
+
+func (m *memStore) SaveJobRun(cx context.Context, j *Job) error {
+	return nil
+}
+
+func (m *memStore) JobWebhook(cx context.Context, jobID string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jd := m.jobs[jobID]
+	return jd.WebhookURL, jd.WebhookSecret, nil
+}
+
+func (m *memStore) QueueWebhooks(cx context.Context,
+									deliveries []webhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range deliveries {
+		m.webhooks[d.id] = d
+		m.webhooksDue[d.id] = time.Now()
+	}
+	return nil
+}
+
+func (m *memStore) ClaimWebhooks(cx context.Context,
+									limit int) ([]webhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var claimed []webhookDelivery
+	now := time.Now()
+	for id, d := range m.webhooks {
+		if m.webhooksDue[id].After(now) {
+			continue
+		}
+		d.attempts++
+		m.webhooks[id] = d
+		m.webhooksDue[id] = now.Add(webhookClaimTimeout)
+		claimed = append(claimed, d)
+	}
+	return claimed, nil
+}
+
+func (m *memStore) RemoveWebhook(cx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.webhooks, id)
+	delete(m.webhooksDue, id)
+	return nil
+}
+
+func (m *memStore) RetryWebhook(cx context.Context, d webhookDelivery,
+								sendErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooksDue[d.id] = time.Now().Add(webhookBackoff(d.attempts))
+	return nil
+}
+
+func (m *memStore) JobOwner(cx context.Context, jobID string) (string, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jd, ok := m.jobs[jobID]
+	if !ok {
+		return "", nil, ErrJobNotFound
+	}
+	return jd.CreatedBy, jd.SharedWith, nil
+}
+
+func (m *memStore) CreateTasks(cx context.Context, jobID string,
+								probeIDs []string, t Task, runID int64,
+								notice JobTarget) ([]CreatedTask, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var created []CreatedTask
+	for _, probeID := range probeIDs {
+		key := fmt.Sprintf("%s/%d/%s", jobID, runID, probeID)
+		if tID, ok := m.runs[key]; ok {
+			created = append(created, CreatedTask{
+				ProbeId: probeID,
+				TaskId: tID,
+				NeedsNotify: m.tasks[tID].State == taskstate.Ready,
+			})
+			continue
+		}
+		task := t
+		task.Id = fmt.Sprintf("task-%d", len(m.tasks))
+		task.JobId = jobID
+		task.ProbeId = probeID
+		task.State = taskstate.Ready
+		m.tasks[task.Id] = task
+		m.runs[key] = task.Id
+		created = append(created, CreatedTask{
+			ProbeId: probeID,
+			TaskId: task.Id,
+			NeedsNotify: true,
+		})
+	}
+	return created, nil
+}
+
+// createTask creates the task of the probe, returning its id
+func (m *memStore) createTask(probeID string, runID int64) string {
+	created, _ := m.CreateTasks(context.Background(), "", []string{probeID},
+								Task{TestName: "ndt"}, runID, JobTarget{})
+	return created[0].TaskId
+}
+
+func (m *memStore) GetTask(cx context.Context, tID string) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[tID]
+	if !ok {
+		return t, ErrTaskNotFound
+	}
+	return t, nil
+}
+
+func (m *memStore) TasksForProbe(cx context.Context, probeID string,
+									cursor TaskCursor) ([]Task, error) {
+	return nil, nil
+}
+
+func (m *memStore) TaskHistory(cx context.Context, probeID string, limit int,
+								offset int) ([]TaskHistoryItem, int64, error) {
+	return nil, 0, nil
+}
+
+func (m *memStore) SetTaskState(cx context.Context, tID string,
+									from taskstate.State,
+									state taskstate.State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.tasks[tID]
+	if t.State != from {
+		return ErrInconsistentState
+	}
+	t.State = state
+	m.tasks[tID] = t
+	return nil
+}
+
+func (m *memStore) MarkTasksNotified(cx context.Context, tIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tID := range tIDs {
+		t, ok := m.tasks[tID]
+		if ok && t.State.CanTransition(taskstate.Notified) {
+			t.State = taskstate.Notified
+			m.tasks[tID] = t
+		}
+	}
+	return nil
+}
+
+func (m *memStore) UnfinishedTasks(cx context.Context, probeID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tIDs []string
+	for _, t := range m.tasks {
+		if t.ProbeId == probeID && t.State.CanTransition(taskstate.Cancelled) {
+			tIDs = append(tIDs, t.Id)
+		}
+	}
+	return tIDs, nil
+}
+
+func (m *memStore) SaveTaskResult(cx context.Context, tr TaskResult) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tr.Id = fmt.Sprintf("result-%d", len(m.results))
+	m.results = append(m.results, tr)
+	return tr.Id, nil
+}
+
+func (m *memStore) SetTaskLease(cx context.Context, tID string,
+								expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leases[tID] = expiresAt
+	return nil
+}
+
+func (m *memStore) ValidateTarget(cx context.Context, t Target) error {
+	return nil
+}
+
+func (m *memStore) FindProbes(cx context.Context, t Target, runID int64,
+								testName string) ([]MatchingProbe, error) {
+	return m.probes, nil
+}
+
+func (m *memStore) JobCohort(cx context.Context, jobID string) ([]MatchingProbe, error) {
+	return nil, nil
+}
+
+func (m *memStore) IsBlocked(cx context.Context, probeID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blocked[probeID], nil
+}
+
+func (m *memStore) TouchProbe(cx context.Context, probeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seen[probeID] = true
+	return nil
+}
+
+func (m *memStore) DeactivateProbe(cx context.Context, probeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deactivated[probeID] {
+		return probes.ErrClientNotFound
+	}
+	m.deactivated[probeID] = true
+	return nil
+}
+
+func TestGetTargets(t *testing.T) {
+	store := newMemStore()
+	store.probes = []MatchingProbe{{Id: "probe-a"}, {Id: "probe-b"}}
+	store.jobs["job"] = JobData{
+		Id: "job",
+		Task: Task{TestName: "web_connectivity"},
+		Notification: SilentNotification,
+	}
+	j := &Job{Id: "job"}
+
+	targets := j.GetTargets(store)
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets (got: %d)", len(targets))
+	}
+	if !targets[0].Silent || targets[0].TestName != "web_connectivity" {
+		t.Errorf("unexpected target %#v", targets[0])
+	}
+	// Retrying the run gives the same tasks, the probes were notified
+	// already once they moved on
+	if err := SetTaskState(bg, targets[0].TaskID, "probe-a", taskstate.Notified,
+							store); err != nil {
+		t.Fatal(err)
+	}
+	targets = j.GetTargets(store)
+	if len(targets) != 1 || targets[0].ClientID != "probe-b" {
+		t.Errorf("expected to notify probe-b again only (got: %v)", targets)
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("expected the retry not to create tasks (got: %d)", len(store.tasks))
+	}
+}
+
+func TestSetTaskState(t *testing.T) {
+	store := newMemStore()
+	tID := store.createTask("probe", 0)
+
+	if err := SetTaskState(bg, tID, "other", taskstate.Accepted, store); err != ErrAccessDenied {
+		t.Errorf("expected %v (got: %v)", ErrAccessDenied, err)
+	}
+	if err := SetTaskState(bg, "missing", "probe", taskstate.Accepted, store); err != ErrTaskNotFound {
+		t.Errorf("expected %v (got: %v)", ErrTaskNotFound, err)
+	}
+	if err := SetTaskState(bg, tID, "probe", taskstate.Accepted, store); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTaskState(bg, tID, "probe", taskstate.Notified, store); err != ErrInconsistentState {
+		t.Errorf("expected %v (got: %v)", ErrInconsistentState, err)
+	}
+}
+
+func TestTransitionRace(t *testing.T) {
+	store := newMemStore()
+	tID := store.createTask("probe", 0)
+	// Both requests looked the task up before either moved it
+	first, _ := store.GetTask(bg, tID)
+	second, _ := store.GetTask(bg, tID)
+
+	if err := first.Transition(bg, taskstate.Accepted, store); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Transition(bg, taskstate.Rejected, store); err != ErrInconsistentState {
+		t.Errorf("expected %v (got: %v)", ErrInconsistentState, err)
+	}
+	if task, _ := store.GetTask(bg, tID); task.State != taskstate.Accepted {
+		t.Errorf("expected the task to stay accepted (got: %s)", task.State)
+	}
+}
+
+func TestRenewTaskLease(t *testing.T) {
+	store := newMemStore()
+	tID := store.createTask("probe", 0)
+
+	if _, err := RenewTaskLease(bg, tID, "probe", store); err != ErrInconsistentState {
+		t.Errorf("expected %v (got: %v)", ErrInconsistentState, err)
+	}
+	store.SetTaskState(bg, tID, taskstate.Ready, taskstate.Accepted)
+	if _, err := RenewTaskLease(bg, tID, "other", store); err != ErrAccessDenied {
+		t.Errorf("expected %v (got: %v)", ErrAccessDenied, err)
+	}
+	expiresAt, err := RenewTaskLease(bg, tID, "probe", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.leases[tID].Equal(expiresAt) {
+		t.Errorf("expected the lease to expire at %s (got: %s)", expiresAt,
+				store.leases[tID])
+	}
+}
+
+func TestAddTaskResult(t *testing.T) {
+	store := newMemStore()
+	tID := store.createTask("probe", 0)
+	tr := TaskResult{ReportId: "report", Summary: "ok"}
+
+	if _, err := AddTaskResult(bg, tID, "probe", tr, store); err != ErrInvalidResultState {
+		t.Errorf("expected %v (got: %v)", ErrInvalidResultState, err)
+	}
+	store.SetTaskState(bg, tID, taskstate.Ready, taskstate.Accepted)
+	if _, err := AddTaskResult(bg, tID, "other", tr, store); err != ErrAccessDenied {
+		t.Errorf("expected %v (got: %v)", ErrAccessDenied, err)
+	}
+	if _, err := AddTaskResult(bg, tID, "probe", tr, store); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.results) != 1 || store.results[0].TaskId != tID ||
+			store.results[0].ProbeId != "probe" {
+		t.Errorf("unexpected results %v", store.results)
+	}
+}
+
+func TestCancelProbeTasks(t *testing.T) {
+	store := newMemStore()
+	for i := int64(0); i < 3; i++ {
+		store.createTask("probe", i)
+	}
+	done := store.createTask("probe", 3)
+	store.SetTaskState(bg, done, taskstate.Ready, taskstate.Done)
+	store.createTask("other", 0)
+
+	cancelled, err := CancelProbeTasks(bg, "probe", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled != 3 {
+		t.Errorf("expected 3 cancelled tasks (got: %d)", cancelled)
+	}
+	if task, _ := store.GetTask(bg, done); task.State != taskstate.Done {
+		t.Errorf("expected the done task to stay done (got: %s)", task.State)
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.replica-retry", time.Minute)
+	primary := sqlx.NewDb(&sql.DB{}, "postgres")
+	replica := sqlx.NewDb(&sql.DB{}, "postgres")
+	store := NewPostgresStore(primary)
+	store.UseReplica(replica)
+
+	var used []*sqlx.DB
+	query := func(replicaErr error) func(cx context.Context, db *sqlx.DB) error {
+		return func(cx context.Context, db *sqlx.DB) error {
+			used = append(used, db)
+			if db == replica {
+				return replicaErr
+			}
+			return nil
+		}
+	}
+	if err := store.read(bg, query(nil)); err != nil || len(used) != 1 || used[0] != replica {
+		t.Fatalf("expected the replica to be read from (got: %v)", err)
+	}
+
+	used = nil
+	refused := &pq.Error{Message: "relation does not exist"}
+	if err := store.read(bg, query(refused)); err != refused || len(used) != 1 {
+		t.Errorf("expected the errors of the replica to be returned (got: %v)", err)
+	}
+
+	used = nil
+	if err := store.read(bg, query(errors.New("connection refused"))); err != nil ||
+			len(used) != 2 || used[1] != primary {
+		t.Fatalf("expected to fall back to the primary (got: %v)", err)
+	}
+	used = nil
+	store.read(bg, query(nil))
+	if len(used) != 1 || used[0] != primary {
+		t.Error("expected the replica to be left alone after failing")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.query-timeout", time.Second)
+	cx, cancel := queryContext(bg)
+	defer cancel()
+	if deadline, ok := cx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("expected the query to be bounded by the timeout (got: %v)", deadline)
+	}
+
+	viper.Set("database.query-timeout", 0)
+	cx, cancel = queryContext(bg)
+	defer cancel()
+	if _, ok := cx.Deadline(); ok {
+		t.Error("expected no deadline without a timeout")
+	}
+}
+
+func TestReadCancelled(t *testing.T) {
+	defer viper.Reset()
+	primary := sqlx.NewDb(&sql.DB{}, "postgres")
+	replica := sqlx.NewDb(&sql.DB{}, "postgres")
+	store := NewPostgresStore(primary)
+	store.UseReplica(replica)
+
+	// The client went away while the replica was being queried
+	cx, cancel := context.WithCancel(bg)
+	var used []*sqlx.DB
+	err := store.read(cx, func(cx context.Context, db *sqlx.DB) error {
+		used = append(used, db)
+		cancel()
+		return cx.Err()
+	})
+	if err != context.Canceled || len(used) != 1 {
+		t.Errorf("expected the primary not to be queried (got: %v, %d)", err, len(used))
+	}
+}
+
+// failoverStore fails the first calls of GetTask as if the database went
+// away
+type failoverStore struct {
+	*memStore
+	failures	int
+}
+
+func (f *failoverStore) GetTask(cx context.Context, tID string) (Task, error) {
+	if f.failures > 0 {
+		f.failures--
+		return Task{}, &pq.Error{Code: "57P01"}
+	}
+	return f.memStore.GetTask(cx, tID)
+}
+
+func TestRetryStore(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.retry-attempts", 3)
+	viper.Set("database.retry-backoff", time.Millisecond)
+	failover := &failoverStore{memStore: newMemStore(), failures: 2}
+	tID := failover.createTask("probe", 0)
+	store := NewRetryStore(failover)
+
+	if _, err := GetTask(bg, tID, "probe", store); err != nil {
+		t.Fatalf("expected the failover to be retried (got: %v)", err)
+	}
+	failover.failures = 3
+	if _, err := GetTask(bg, tID, "probe", store); err == nil {
+		t.Error("expected to give up after 3 attempts")
+	}
+	if _, err := store.GetTask(bg, "missing"); err != ErrTaskNotFound {
+		t.Errorf("expected %v (got: %v)", ErrTaskNotFound, err)
+	}
+}
+
+func TestSoftDeleteJob(t *testing.T) {
+	store := newMemStore()
+	schedule := "R/2118-12-16T16:20:30Z/PT2M"
+	store.CreateJob(bg, JobData{Id: "job", Schedule: schedule}, Schedule{})
+	if err := store.DeleteJob(bg, "job"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := store.ListJobs(bg, false); len(jobs) != 0 {
+		t.Errorf("expected the deleted job to be hidden (got: %v)", jobs)
+	}
+	if jobs, _ := store.ListJobs(bg, true); len(jobs) != 1 {
+		t.Errorf("expected the deleted job to be listed (got: %v)", jobs)
+	}
+
+	j, err := store.RestoreJob(bg, "job")
+	if err != nil || j.Id != "job" {
+		t.Fatalf("expected the job to be restored (got: %v)", err)
+	}
+	if jobs, _ := store.ListJobs(bg, false); len(jobs) != 1 {
+		t.Errorf("expected the restored job to be listed (got: %v)", jobs)
+	}
+	if _, err = store.RestoreJob(bg, "job"); err != ErrJobNotFound {
+		t.Errorf("expected only deleted jobs to be restored (got: %v)", err)
+	}
+
+	// A done job is restored as done, and not run again
+	store.CreateJob(bg, JobData{Id: "done", Schedule: schedule, State: "done"},
+					Schedule{})
+	store.DeleteJob(bg, "done")
+	if _, err = store.GetJob(bg, "done"); err != ErrJobNotFound {
+		t.Errorf("expected the deleted job to be hidden (got: %v)", err)
+	}
+	if _, err = store.JobStats(bg, "done"); err != ErrJobNotFound {
+		t.Errorf("expected the stats of the deleted job to be hidden (got: %v)", err)
+	}
+	store.DeleteJob(bg, "done")
+	j, err = store.RestoreJob(bg, "done")
+	if err != nil || !j.IsDone {
+		t.Errorf("expected the job to be restored as done (got: %v)", err)
+	}
+	if jd, _ := store.GetJob(bg, "done"); jd.State != "done" {
+		t.Errorf("expected the job to be done (got: %s)", jd.State)
+	}
+	store.DeleteJob(bg, "done")
+
+	store.DeleteJob(bg, "job")
+	if n, _ := store.PurgeJobs(bg, time.Now().UTC().Add(-time.Hour)); n != 0 {
+		t.Errorf("expected the job to be kept until its retention (got: %d)", n)
+	}
+	if n, _ := store.PurgeJobs(bg, time.Now().UTC().Add(time.Hour)); n != 2 {
+		t.Errorf("expected the job to be purged (got: %d)", n)
+	}
+	if _, err = store.RestoreJob(bg, "job"); err != ErrJobNotFound {
+		t.Errorf("expected the purged job to be gone (got: %v)", err)
+	}
+}
+
+func TestStopJob(t *testing.T) {
+	store := newMemStore()
+	scheduler := NewScheduler(store)
+	schedule, err := ParseSchedule("R/2118-12-16T16:20:30Z/PT2M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := &Job{Id: "job", Schedule: schedule, NextRunAt: schedule.StartTime}
+	scheduler.RunJob(j)
+	if j.jobTimer == nil {
+		t.Fatal("expected the job to be waiting to run")
+	}
+
+	scheduler.StopJob("job")
+	if j.jobTimer.Stop() {
+		t.Error("expected the timer of the job to be stopped")
+	}
+	j.WaitAndRun(store)
+	if j.jobTimer.Stop() {
+		t.Error("expected the stopped job not to be run again")
+	}
+}
@@ -0,0 +1,354 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-events/targeting"
+
+	"github.com/lib/pq"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// targetColumns are the columns of the jobs table a Target is stored in,
+// named after the fields of targetRow.
+const targetColumns = `target_countries,
+		target_platforms,
+		COALESCE(target_version, '') AS target_version,
+		target_languages,
+		target_sample_rate,
+		target_probe_ids,
+		target_exclude_probe_ids,
+		target_tags,
+		target_exclude_countries,
+		target_exclude_platforms,
+		COALESCE(target_active_within, '') AS target_active_within,
+		target_regions,
+		COALESCE(target_expression, '') AS target_expression,
+		COALESCE(target_segment, '') AS target_segment,
+		COALESCE(target_mode, '') AS target_mode,
+		COALESCE(target_coverage_window, '') AS target_coverage_window,
+		target_coverage_cells,
+		COALESCE(target_cohort, '') AS target_cohort,
+		target_probe_cohorts`
+
+var ErrInvalidSampleRate = errors.New("sample_rate must be between 0 and 1")
+var ErrUnknownProbe = errors.New("target contains unknown probe ids")
+var ErrInvalidActiveWithin = errors.New("invalid active_within duration")
+var ErrInvalidMode = errors.New("invalid targeting mode")
+var ErrInvalidCoverageWindow = errors.New("invalid coverage_window duration")
+var ErrInvalidCohort = errors.New("invalid cohort")
+
+// checkProbesExist makes sure that all the probes are registered
+func checkProbesExist(cx context.Context, probeIDs []string, db *sqlx.DB) error {
+	if len(probeIDs) == 0 {
+		return nil
+	}
+	var found int
+	query := fmt.Sprintf(`SELECT COUNT(DISTINCT id)
+		FROM %s
+		WHERE id::text = ANY($1)`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRowContext(cx, query, pq.Array(probeIDs)).Scan(&found)
+	if err != nil {
+		ctx.WithError(err).Error("failed to lookup target probes")
+		return err
+	}
+	unique := map[string]bool{}
+	for _, id := range probeIDs {
+		unique[id] = true
+	}
+	if found != len(unique) {
+		return ErrUnknownProbe
+	}
+	return nil
+}
+
+// Validate checks that the target can be matched against the probes
+func (t Target) Validate(cx context.Context, db *sqlx.DB) error {
+	if err := t.validateFields(); err != nil {
+		return err
+	}
+	if t.Segment != "" {
+		if _, err := GetSegment(cx, t.Segment, 0, db); err != nil {
+			return err
+		}
+	}
+	if err := checkProbeCohortsExist(cx, t.ProbeCohorts, db); err != nil {
+		return err
+	}
+	if err := checkProbesExist(cx, t.ProbeIds, db); err != nil {
+		return err
+	}
+	if err := checkProbesExist(cx, t.ExcludeProbeIds, db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateFields checks what Validate can without looking up the segment,
+// the cohorts and the probes the target refers to
+func (t Target) validateFields() error {
+	if _, err := ParseVersionConstraint(t.Version); err != nil {
+		return err
+	}
+	if t.SampleRate < 0 || t.SampleRate > 1 {
+		return ErrInvalidSampleRate
+	}
+	if _, err := t.activeWithin(); err != nil {
+		return err
+	}
+	switch t.Cohort {
+	case "", ReevaluatedCohort, FrozenCohort:
+	default:
+		return ErrInvalidCohort
+	}
+	switch t.Mode {
+	case "":
+	case CoverageGapMode:
+		if _, err := t.coverageWindow(); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidMode
+	}
+	if t.Expression != "" {
+		if _, err := targeting.Parse(t.Expression); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Target) activeWithin() (time.Duration, error) {
+	if t.ActiveWithin == "" {
+		return 0, nil
+	}
+	if t.ActiveWithin[0] != 'P' {
+		return 0, ErrInvalidActiveWithin
+	}
+	d, err := ParseDuration(t.ActiveWithin[1:])
+	if err != nil {
+		return 0, ErrInvalidActiveWithin
+	}
+	return d.ToDuration(), nil
+}
+
+// supportsTest returns the condition that the active probes aliased alias
+// (none when empty) can run the test named by the SQL expression test.
+// Probes that didn't declare their supported tests are assumed to run all
+// of them.
+func supportsTest(alias string, test string) string {
+	column := "supported_tests"
+	if alias != "" {
+		column = alias + "." + column
+	}
+	return fmt.Sprintf("(COALESCE(cardinality(%s), 0) = 0 OR %s = ANY(%s))",
+						column, test, column)
+}
+
+// conditions returns the WHERE clause selecting the active probes matched
+// by the target in run runID of a job, appending its arguments to args. The
+// software version and the segment are left to the caller.
+func (t Target) conditions(runID int64, testName string,
+							args []interface{}) (string, []interface{}) {
+	// Probes that opted out are never targeted
+	conditions := []string{"deactivated_at IS NULL",
+							probes.NotBlockedCondition("")}
+	if testName != "" {
+		args = append(args, testName)
+		conditions = append(conditions, supportsTest("", fmt.Sprintf("$%d", len(args))))
+	}
+	if len(t.Countries) > 0 {
+		args = append(args, pq.Array(t.Countries))
+		conditions = append(conditions,
+							fmt.Sprintf("probe_cc = ANY($%d)", len(args)))
+	}
+	if len(t.Platforms) > 0 {
+		args = append(args, pq.Array(t.Platforms))
+		conditions = append(conditions,
+							fmt.Sprintf("platform = ANY($%d)", len(args)))
+	}
+	if len(t.Regions) > 0 {
+		args = append(args, pq.Array(t.Regions))
+		conditions = append(conditions,
+							fmt.Sprintf("region = ANY($%d)", len(args)))
+	}
+	if len(t.ExcludeCountries) > 0 {
+		args = append(args, pq.Array(t.ExcludeCountries))
+		conditions = append(conditions, fmt.Sprintf(
+			"NOT COALESCE(probe_cc, '') = ANY($%d)", len(args)))
+	}
+	if len(t.ExcludePlatforms) > 0 {
+		args = append(args, pq.Array(t.ExcludePlatforms))
+		conditions = append(conditions, fmt.Sprintf(
+			"NOT COALESCE(platform, '') = ANY($%d)", len(args)))
+	}
+	if len(t.Languages) > 0 {
+		args = append(args, pq.Array(t.Languages))
+		conditions = append(conditions, fmt.Sprintf(
+			"(locale = ANY($%d) OR split_part(locale, '-', 1) = ANY($%d))",
+			len(args), len(args)))
+	}
+	if len(t.ProbeIds) > 0 {
+		args = append(args, pq.Array(t.ProbeIds))
+		conditions = append(conditions,
+							fmt.Sprintf("id::text = ANY($%d)", len(args)))
+	}
+	if len(t.ExcludeProbeIds) > 0 {
+		args = append(args, pq.Array(t.ExcludeProbeIds))
+		conditions = append(conditions,
+							fmt.Sprintf("NOT id::text = ANY($%d)", len(args)))
+	}
+	if d, _ := t.activeWithin(); d > 0 {
+		args = append(args, time.Now().UTC().Add(-d))
+		conditions = append(conditions,
+							fmt.Sprintf("COALESCE(last_seen, last_updated) >= $%d",
+										len(args)))
+	}
+	if len(t.ProbeCohorts) > 0 {
+		args = append(args, pq.Array(t.ProbeCohorts))
+		conditions = append(conditions, fmt.Sprintf(
+			"id IN (SELECT probe_id FROM %s WHERE cohort_name = ANY($%d))",
+			pq.QuoteIdentifier(viper.GetString("database.probe-cohort-members-table")),
+			len(args)))
+	}
+	if len(t.Tags) > 0 {
+		args = append(args, pq.Array(t.Tags))
+		conditions = append(conditions,
+							fmt.Sprintf("tags && $%d::VARCHAR[]", len(args)))
+	}
+	if t.Expression != "" {
+		// Targets are validated when jobs are added
+		expr, err := targeting.Parse(t.Expression)
+		if err != nil {
+			ctx.WithError(err).Error("invalid targeting expression")
+			return "FALSE", args
+		}
+		var cond string
+		cond, args = expr.Compile(args)
+		conditions = append(conditions, cond)
+	}
+	if t.Mode == CoverageGapMode {
+		var cond string
+		cond, args = t.coverageGapCondition(testName, args)
+		conditions = append(conditions, cond)
+	}
+	if t.SampleRate > 0 && t.SampleRate < 1 {
+		// Hashing the probe together with the run gives every run a
+		// different sample, which stays the same if the run is retried.
+		args = append(args, runID, t.SampleRate)
+		conditions = append(conditions, fmt.Sprintf(
+			"('x' || substr(md5(id::text || ':' || $%d::text), 1, 8))::bit(32)::bigint / 4294967296.0 < $%d",
+			len(args) - 1, len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// MatchingProbe is an active probe matched by a Target
+type MatchingProbe struct {
+	Id			string
+	ProbeCC		string
+	Platform	string
+}
+
+// FindProbes returns the active probes matched by the target in run runID
+// of a job running testName
+func (t Target) FindProbes(cx context.Context, runID int64, testName string,
+							db *sqlx.DB) ([]MatchingProbe, error) {
+	var probes []MatchingProbe
+
+	versionConstraint, err := ParseVersionConstraint(t.Version)
+	if err != nil {
+		ctx.WithError(err).Error("invalid target version")
+		return probes, err
+	}
+	where, args := t.conditions(runID, testName, nil)
+	if t.Segment != "" {
+		// Segments are resolved on every run so that updating them
+		// updates all the jobs using them
+		segment, err := GetSegment(cx, t.Segment, 0, db)
+		if err != nil {
+			return probes, err
+		}
+		segmentConstraint, err := ParseVersionConstraint(segment.Target.Version)
+		if err != nil {
+			ctx.WithError(err).Error("invalid segment version")
+			return probes, err
+		}
+		versionConstraint = append(versionConstraint, segmentConstraint...)
+		var segmentWhere string
+		segmentWhere, args = segment.Target.conditions(runID, testName, args)
+		where = "(" + where + ") AND (" + segmentWhere + ")"
+	}
+	query := fmt.Sprintf(`SELECT
+		id,
+		COALESCE(probe_cc, ''),
+		COALESCE(platform, ''),
+		COALESCE(software_version, '')
+		FROM %s
+		WHERE %s`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")),
+		where)
+	var rows *sql.Rows
+	rows, err = db.QueryContext(cx, query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to find targets")
+		return probes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			p MatchingProbe
+			softwareVersion string
+		)
+		err = rows.Scan(&p.Id, &p.ProbeCC, &p.Platform, &softwareVersion)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over targets")
+			return probes, err
+		}
+		// Semver ranges can't be expressed in SQL
+		if !versionConstraint.Matches(softwareVersion) {
+			continue
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// TargetEstimate is how many of the currently active probes a Target
+// reaches
+type TargetEstimate struct {
+	Total		int64 `json:"total"`
+	Countries	map[string]int64 `json:"countries"`
+	Platforms	map[string]int64 `json:"platforms"`
+}
+
+// EstimateTarget counts the probes the target would reach if a job running
+// testName used it now. When sampling, the count is that of the first run.
+func EstimateTarget(cx context.Context, t Target, testName string,
+					store ProbeStore) (TargetEstimate, error) {
+	estimate := TargetEstimate{
+		Countries: map[string]int64{},
+		Platforms: map[string]int64{},
+	}
+	if err := store.ValidateTarget(cx, t); err != nil {
+		return estimate, err
+	}
+	probes, err := store.FindProbes(cx, t, 0, testName)
+	if err != nil {
+		return estimate, err
+	}
+	for _, p := range probes {
+		estimate.Total++
+		estimate.Countries[p.ProbeCC]++
+		estimate.Platforms[p.Platform]++
+	}
+	return estimate, nil
+}
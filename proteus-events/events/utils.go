@@ -2,6 +2,10 @@ package events
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"strings"
 	"strconv"
@@ -134,6 +138,9 @@ func ParseDuration(s string) (ScheduleDuration, error) {
 		if err != nil {
 			return d, err
 		}
+		if s == "" {
+			return d, errors.New("missing unit")
+		}
 		unit := s[0]
 		if timePart == true {
 			switch unit {
@@ -209,3 +216,186 @@ func ParseSchedule(s string) (Schedule, error) {
 	schedule.Duration = d
 	return schedule, nil
 }
+
+// ContentETag returns a strong ETag for the JSON serialisation of v
+func ContentETag(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(b)
+	return "\"" + hex.EncodeToString(sum[:]) + "\"", nil
+}
+
+// ETagMatches tells if etag is one of the values in an If-None-Match header
+func ETagMatches(ifNoneMatch string, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskCursor marks the position of the last task a probe has seen. Tasks
+// are ordered by creation time and then by id so that tasks created at the
+// same time are not missed.
+type TaskCursor struct {
+	Time	time.Time
+	Id		string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// String encodes the cursor into the opaque value handed to probes
+func (tc TaskCursor) String() string {
+	raw := tc.Time.UTC().Format(time.RFC3339Nano) + "|" + tc.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// After tells if the position of the task created at t with id comes after
+// the cursor.
+func (tc TaskCursor) After(t time.Time, id string) bool {
+	return t.After(tc.Time) || (t.Equal(tc.Time) && id > tc.Id)
+}
+
+func ParseTaskCursor(s string) (TaskCursor, error) {
+	var tc TaskCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return tc, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return tc, ErrInvalidCursor
+	}
+	tc.Time, err = time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return tc, ErrInvalidCursor
+	}
+	tc.Id = parts[1]
+	return tc, nil
+}
+
+type semVersion struct {
+	Parts		[3]int64
+	PreRelease	string
+}
+
+func parseSemVersion(s string) (semVersion, error) {
+	var v semVersion
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	// Build metadata does not take part in comparisons
+	if i := strings.Index(s, "+"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i != -1 {
+		v.PreRelease = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || parts[0] == "" {
+		return v, errors.New("invalid version")
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 {
+			return v, errors.New("invalid version")
+		}
+		v.Parts[i] = n
+	}
+	return v, nil
+}
+
+func (v semVersion) Compare(o semVersion) int {
+	for i := range v.Parts {
+		if v.Parts[i] < o.Parts[i] {
+			return -1
+		}
+		if v.Parts[i] > o.Parts[i] {
+			return 1
+		}
+	}
+	// A pre-release comes before the release it precedes
+	switch {
+	case v.PreRelease == o.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case o.PreRelease == "":
+		return -1
+	case v.PreRelease < o.PreRelease:
+		return -1
+	}
+	return 1
+}
+
+type versionComparator struct {
+	Op		string
+	Version	semVersion
+}
+
+// VersionConstraint is a semver range such as ">=2.1.0" or ">=2.1.0 <3".
+// All the comparators, separated by spaces or commas, have to match.
+type VersionConstraint []versionComparator
+
+var ErrInvalidVersionConstraint = errors.New("invalid version constraint")
+
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	var vc VersionConstraint
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	for _, f := range fields {
+		op := strings.TrimRight(f, "0123456789.v-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		if op == "" {
+			op = "="
+		}
+		switch op {
+		case "=", "==", "!=", ">", ">=", "<", "<=":
+		default:
+			return nil, ErrInvalidVersionConstraint
+		}
+		v, err := parseSemVersion(strings.TrimLeft(f, "=!<>"))
+		if err != nil {
+			return nil, ErrInvalidVersionConstraint
+		}
+		vc = append(vc, versionComparator{Op: op, Version: v})
+	}
+	return vc, nil
+}
+
+// Matches tells if version satisfies the constraint. Versions that cannot
+// be parsed never match a non empty constraint.
+func (vc VersionConstraint) Matches(version string) bool {
+	if len(vc) == 0 {
+		return true
+	}
+	v, err := parseSemVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, c := range vc {
+		cmp := v.Compare(c.Version)
+		var ok bool
+		switch c.Op {
+		case "=", "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
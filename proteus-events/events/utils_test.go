@@ -2,6 +2,7 @@ package events
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseSchedule(t *testing.T) {
@@ -17,10 +18,10 @@ func TestParseSchedule(t *testing.T) {
 		t.Errorf("expected Repeat to be 42 (got: %d)", s.Repeat)
 	}
 	if s.Duration.Weeks != 1.3 {
-		t.Error("expected 1.3 weeks duration (got: %f)", s.Duration.Weeks)
+		t.Errorf("expected 1.3 weeks duration (got: %f)", s.Duration.Weeks)
 	}
 	if s.Duration.Minutes != 2.0 {
-		t.Error("expected 2.0 minutes duration (got: %f)", s.Duration.Minutes)
+		t.Errorf("expected 2.0 minutes duration (got: %f)", s.Duration.Minutes)
 	}
 
 	s, err = ParseSchedule("R/2018-12-16T16:20:30Z/PT2M")
@@ -49,7 +50,97 @@ func TestToDuration(t *testing.T) {
 	febHours := (2.2*28+1)*24
 	decHours := (2.2*31+1)*24
 	if d.Hours() < febHours || d.Hours() > decHours {
-		t.Errorf("expected duration to be in range (1478, 1637) (got: %d)",
+		t.Errorf("expected duration to be in range (1478, 1637) (got: %f)",
 					d.Hours())
 	}
 }
+
+func TestETag(t *testing.T) {
+	a, err := ContentETag([]string{"a", "b"})
+	if err != nil {
+		t.Error("failed")
+	}
+	b, _ := ContentETag([]string{"a", "c"})
+	if a == b {
+		t.Error("expected different content to have different etags")
+	}
+	if !ETagMatches("\"foo\", " + a, a) {
+		t.Errorf("expected %s to match", a)
+	}
+	if !ETagMatches("W/" + a, a) {
+		t.Errorf("expected weak %s to match", a)
+	}
+	if ETagMatches(b, a) {
+		t.Errorf("expected %s to not match %s", b, a)
+	}
+}
+
+func TestTaskCursor(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 30, 0, 1234000, time.UTC)
+	tc := TaskCursor{Time: now, Id: "b4a0f1d0-0000-4000-8000-000000000000"}
+	parsed, err := ParseTaskCursor(tc.String())
+	if err != nil {
+		t.Error("failed")
+	}
+	if !parsed.Time.Equal(now) || parsed.Id != tc.Id {
+		t.Errorf("expected %v (got: %v)", tc, parsed)
+	}
+	if !tc.After(now, "c0000000-0000-4000-8000-000000000000") {
+		t.Error("expected a task at the same time with a bigger id to be after")
+	}
+	if tc.After(now.Add(-time.Second), "c0000000-0000-4000-8000-000000000000") {
+		t.Error("expected an older task to not be after")
+	}
+	_, err = ParseTaskCursor("antani")
+	if err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor (got: %v)", err)
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	t.Parallel()
+	vc, err := ParseVersionConstraint(">=2.1.0, <3")
+	if err != nil {
+		t.Fatal("failed to parse constraint")
+	}
+	for _, v := range []string{"2.1.0", "2.1.1", "v2.9", "2.10.0"} {
+		if !vc.Matches(v) {
+			t.Errorf("expected %s to match", v)
+		}
+	}
+	for _, v := range []string{"2.0.9", "2.1.0-beta.1", "3.0.0", "garbage", ""} {
+		if vc.Matches(v) {
+			t.Errorf("expected %s not to match", v)
+		}
+	}
+
+	vc, err = ParseVersionConstraint("2.1.0")
+	if err != nil {
+		t.Fatal("failed to parse constraint")
+	}
+	if !vc.Matches("2.1.0") || vc.Matches("2.1.1") {
+		t.Error("bare version should match exactly")
+	}
+
+	vc, err = ParseVersionConstraint("")
+	if err != nil || !vc.Matches("anything") {
+		t.Error("empty constraint should match everything")
+	}
+
+	for _, s := range []string{"~>2.1", ">=two", ">=1.2.3.4"} {
+		if _, err = ParseVersionConstraint(s); err == nil {
+			t.Errorf("expected %s to be invalid", s)
+		}
+	}
+}
+
+func TestParseDurationMissingUnit(t *testing.T) {
+	t.Parallel()
+	if _, err := ParseDuration("30"); err == nil {
+		t.Error("expected an error for a duration without unit")
+	}
+	d, err := ParseDuration("30D")
+	if err != nil || d.Days != 30 {
+		t.Errorf("expected 30 days (got: %f, %v)", d.Days, err)
+	}
+}
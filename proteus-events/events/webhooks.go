@@ -0,0 +1,320 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/webhook"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+// The events POSTed to the webhooks of the jobs
+const (
+	// The task moved to State
+	WebhookTaskState = "task_state"
+	// The finished task was deleted, or archived, after the retention period
+	WebhookTaskReaped = "task_reaped"
+)
+
+// WebhookEvent is what gets POSTed to the webhook of a job when one of its
+// tasks is finished, returned to ready by an expired lease, or reaped.
+type WebhookEvent struct {
+	Event		string `json:"event"`
+	JobId		string `json:"job_id"`
+	TaskId		string `json:"task_id"`
+	ProbeId		string `json:"probe_id"`
+	State		taskstate.State `json:"state"`
+	Time		time.Time `json:"time"`
+}
+
+// The columns of the tasks changed by the background jobs, returned to fire
+// their webhooks
+const webhookTaskColumns = `id, probe_id, COALESCE(job_id::text, '') AS job_id,
+	test_name, arguments, state`
+
+func isFinishedState(state taskstate.State) bool {
+	for _, s := range finishedTaskStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// The events are written to the webhook deliveries table, and POSTed by the
+// relay, so that the retries survive a restart. A relay that crashes while
+// sending leaves the deliveries claimed, they are picked up again once the
+// claim expires.
+const webhookClaimTimeout = 10 * time.Minute
+
+// Wakes up the relay when events were queued
+var webhookWakeup = make(chan bool, 1)
+
+// webhookDelivery is an event waiting to be POSTed to the webhook of its job
+type webhookDelivery struct {
+	id			string
+	jobID		string
+	taskID		string
+	event		[]byte
+	attempts	int
+}
+
+// wakeWebhookRelay tells the relay of this instance that events are waiting
+func wakeWebhookRelay() {
+	select {
+	case webhookWakeup <- true:
+	default:
+	}
+}
+
+// FireTaskWebhook queues the event for the webhook of the job the task
+// belongs to, if it has one. It outlives the request which changed the
+// task, so it doesn't share its context.
+func FireTaskWebhook(t Task, event string, store Store) {
+	FireTaskWebhooks([]Task{t}, event, store)
+}
+
+// FireTaskWebhooks queues the events of the tasks changed at once by the
+// background jobs, looking up the webhook of every job only once.
+func FireTaskWebhooks(tasks []Task, event string, store Store) {
+	cx := context.Background()
+	hasWebhook := map[string]bool{}
+	var deliveries []webhookDelivery
+	for _, t := range tasks {
+		if t.JobId == "" {
+			continue
+		}
+		has, ok := hasWebhook[t.JobId]
+		if !ok {
+			url, _, err := store.JobWebhook(cx, t.JobId)
+			if err != nil {
+				continue
+			}
+			has = url != ""
+			hasWebhook[t.JobId] = has
+		}
+		if !has {
+			continue
+		}
+		body, err := json.Marshal(WebhookEvent{
+			Event: event,
+			JobId: t.JobId,
+			TaskId: t.Id,
+			ProbeId: t.ProbeId,
+			State: t.State,
+			Time: time.Now().UTC(),
+		})
+		if err != nil {
+			ctx.WithError(err).Error("failed to marshal webhook event")
+			continue
+		}
+		deliveries = append(deliveries, webhookDelivery{
+			id: uuid.NewV4().String(),
+			jobID: t.JobId,
+			taskID: t.Id,
+			event: body,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := store.QueueWebhooks(cx, deliveries); err != nil {
+		ctx.WithError(err).Errorf("dropping %d webhook events", len(deliveries))
+		return
+	}
+	wakeWebhookRelay()
+}
+
+// queueWebhooks writes the deliveries to the webhook deliveries table, due
+// right away
+func queueWebhooks(cx context.Context, deliveries []webhookDelivery,
+					db *sqlx.DB) error {
+	tx, err := db.BeginTxx(cx, nil)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, job_id, task_id, event, next_attempt_at, creation_time
+	) VALUES ($1, $2, $3, $4, $5, $5)`,
+		pq.QuoteIdentifier(viper.GetString("database.webhook-deliveries-table")))
+	now := time.Now().UTC()
+	for _, d := range deliveries {
+		_, err = tx.ExecContext(cx, query, d.id, d.jobID, d.taskID,
+								string(d.event), now)
+		if err != nil {
+			ctx.WithError(err).Error("failed to queue webhook delivery")
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		ctx.WithError(err).Error("failed to commit webhook deliveries")
+		return err
+	}
+	return nil
+}
+
+// claimWebhooks claims the deliveries due to be sent, at most limit of them
+func claimWebhooks(cx context.Context, limit int,
+					db *sqlx.DB) ([]webhookDelivery, error) {
+	var deliveries []webhookDelivery
+	table := pq.QuoteIdentifier(viper.GetString("database.webhook-deliveries-table"))
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s
+		SET attempts = attempts + 1, next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM %s
+			WHERE next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, job_id, task_id, event, attempts`,
+		table, table)
+	rows, err := db.QueryContext(cx, query, now.Add(webhookClaimTimeout), now, limit)
+	if err != nil {
+		ctx.WithError(err).Error("failed to claim webhook deliveries")
+		return deliveries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d webhookDelivery
+		err = rows.Scan(&d.id, &d.jobID, &d.taskID, &d.event, &d.attempts)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over webhook deliveries")
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// removeWebhook takes the delivery out of the webhook deliveries table
+func removeWebhook(cx context.Context, id string, db *sqlx.DB) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.webhook-deliveries-table")))
+	_, err := db.ExecContext(cx, query, id)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove webhook delivery")
+	}
+	return err
+}
+
+// webhookBackoff is how long to wait after the attempts of a delivery
+// failed, webhooks.backoff then twice as long after every attempt
+func webhookBackoff(attempts int) time.Duration {
+	backoff := viper.GetDuration("webhooks.backoff")
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// retryWebhook sends the delivery again after its backoff
+func retryWebhook(cx context.Context, d webhookDelivery, sendErr error,
+					db *sqlx.DB) error {
+	query := fmt.Sprintf(`UPDATE %s
+		SET next_attempt_at = $2, last_error = $3
+		WHERE id = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.webhook-deliveries-table")))
+	_, err := db.ExecContext(cx, query, d.id,
+					time.Now().UTC().Add(webhookBackoff(d.attempts)),
+					sendErr.Error())
+	if err != nil {
+		ctx.WithError(err).Error("failed to reschedule webhook delivery")
+	}
+	return err
+}
+
+// postWebhook POSTs the event to the webhook, signed with its secret
+func postWebhook(client *http.Client, webhookUrl string, secret string,
+					body []byte) error {
+	req, err := http.NewRequest("POST", webhookUrl, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RelayWebhooks POSTs the events due to the webhooks of their jobs,
+// returning how many were claimed. A delivery is given up on after
+// webhooks.max-retries, or once its job no longer has a webhook.
+func RelayWebhooks(store Store) (int, error) {
+	cx := context.Background()
+	deliveries, err := store.ClaimWebhooks(cx, viper.GetInt("webhooks.batch-size"))
+	if err != nil {
+		return 0, err
+	}
+	type jobWebhook struct {
+		url		string
+		secret	string
+	}
+	webhooks := map[string]jobWebhook{}
+	client := &http.Client{Timeout: viper.GetDuration("webhooks.timeout")}
+	for _, d := range deliveries {
+		wh, ok := webhooks[d.jobID]
+		if !ok {
+			url, secret, err := store.JobWebhook(cx, d.jobID)
+			if err != nil && err != ErrJobNotFound {
+				store.RetryWebhook(cx, d, err)
+				continue
+			}
+			wh = jobWebhook{url, secret}
+			webhooks[d.jobID] = wh
+		}
+		if wh.url == "" {
+			store.RemoveWebhook(cx, d.id)
+			continue
+		}
+		err := postWebhook(client, wh.url, wh.secret, d.event)
+		if err == nil {
+			store.RemoveWebhook(cx, d.id)
+			continue
+		}
+		ctx.WithError(err).Errorf("webhook for job %s failed", d.jobID)
+		if d.attempts > viper.GetInt("webhooks.max-retries") {
+			ctx.Errorf("giving up on webhook for task %s", d.taskID)
+			store.RemoveWebhook(cx, d.id)
+			continue
+		}
+		store.RetryWebhook(cx, d, err)
+	}
+	return len(deliveries), nil
+}
+
+// RunWebhookRelay POSTs the events as soon as they are queued by this
+// instance, and polls for the others every interval.
+func RunWebhookRelay(store Store, interval time.Duration) {
+	for {
+		n, err := RelayWebhooks(store)
+		if err == nil && n > 0 {
+			continue
+		}
+		select {
+		case <-webhookWakeup:
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/webhook"
+	"github.com/thetorproject/proteus/proteus-events/taskstate"
+
+	"github.com/spf13/viper"
+)
+
+// webhookReceiver fails the first failures deliveries, and checks the
+// signature of every one of them
+type webhookReceiver struct {
+	mu			sync.Mutex
+	failures	int
+	attempts	int
+	events		[]WebhookEvent
+	badSignatures	int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Header.Get(webhook.SignatureHeader) != webhook.Sign("secret", body) {
+		r.badSignatures++
+	}
+	r.attempts++
+	if r.attempts <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var event WebhookEvent
+	json.Unmarshal(body, &event)
+	r.events = append(r.events, event)
+}
+
+func testWebhookStore(url string) *memStore {
+	store := newMemStore()
+	store.jobs["job"] = JobData{Id: "job", WebhookURL: url,
+								WebhookSecret: "secret"}
+	store.jobs["no-webhook"] = JobData{Id: "no-webhook"}
+	return store
+}
+
+// relayWebhooks relays the webhooks of the store until none is queued
+func relayWebhooks(t *testing.T, store *memStore) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := RelayWebhooks(store); err != nil {
+			t.Fatal(err)
+		}
+		store.mu.Lock()
+		queued := len(store.webhooks)
+		store.mu.Unlock()
+		if queued == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected the webhooks to be relayed")
+}
+
+func TestFireTaskWebhookRetries(t *testing.T) {
+	viper.Set("webhooks.max-retries", 3)
+	viper.Set("webhooks.backoff", "1ms")
+	defer viper.Set("webhooks.max-retries", nil)
+	defer viper.Set("webhooks.backoff", nil)
+
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	store := testWebhookStore(server.URL)
+
+	task := Task{Id: "task", JobId: "job", ProbeId: "probe",
+				State: taskstate.Done}
+	FireTaskWebhook(task, WebhookTaskState, store)
+	// Queued rather than sent, so that a restart doesn't lose it
+	if receiver.attempts != 0 || len(store.webhooks) != 1 {
+		t.Fatalf("expected the event to be queued (got: %d attempts, %d queued)",
+				receiver.attempts, len(store.webhooks))
+	}
+	relayWebhooks(t, store)
+	if receiver.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", receiver.attempts)
+	}
+	if receiver.badSignatures != 0 {
+		t.Errorf("%d deliveries had a bad signature", receiver.badSignatures)
+	}
+	if len(receiver.events) != 1 {
+		t.Fatalf("expected 1 delivered event, got %d", len(receiver.events))
+	}
+	event := receiver.events[0]
+	if event.Event != WebhookTaskState || event.TaskId != "task" ||
+			event.State != taskstate.Done {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// Gives up after max-retries
+	receiver = &webhookReceiver{failures: 10}
+	server.Config.Handler = receiver
+	FireTaskWebhook(task, WebhookTaskState, store)
+	relayWebhooks(t, store)
+	if receiver.attempts != 4 {
+		t.Errorf("expected 4 attempts, got %d", receiver.attempts)
+	}
+
+	// Dropped once the job is gone
+	FireTaskWebhook(task, WebhookTaskState, store)
+	delete(store.jobs, "job")
+	relayWebhooks(t, store)
+	if receiver.attempts != 4 {
+		t.Errorf("expected no attempt without the job, got %d", receiver.attempts)
+	}
+}
+
+func TestFireTaskWebhooks(t *testing.T) {
+	viper.Set("webhooks.backoff", "1ms")
+	defer viper.Set("webhooks.backoff", nil)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	store := testWebhookStore(server.URL)
+
+	tasks := []Task{
+		{Id: "1", JobId: "job", State: taskstate.Ready},
+		{Id: "2", JobId: "no-webhook", State: taskstate.Ready},
+		{Id: "3", State: taskstate.Ready},
+		{Id: "4", JobId: "job", State: taskstate.Ready},
+	}
+	FireTaskWebhooks(tasks, WebhookTaskReaped, store)
+	if len(store.webhooks) != 2 {
+		t.Fatalf("expected the events of tasks 1 and 4 to be queued (got: %d)",
+				len(store.webhooks))
+	}
+	relayWebhooks(t, store)
+	if len(receiver.events) != 2 {
+		t.Fatalf("expected the webhooks of tasks 1 and 4, got %+v", receiver.events)
+	}
+	for _, event := range receiver.events {
+		if event.Event != WebhookTaskReaped || event.JobId != "job" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Package targeting implements the expressions jobs can use to select the
+// probes they target, for example:
+//
+//   (country=IR AND platform=android) OR tag=staff
+//
+// A comparison matches if the field is equal to any of the comma separated
+// values, so "country=IR,IQ" targets both countries. Expressions are
+// compiled to a condition on the active probes table, or matched against
+// the fields of a probe where SQL can't express them.
+package targeting
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var ErrSyntax = errors.New("invalid targeting expression")
+var ErrUnknownField = errors.New("unknown targeting field")
+
+// Op is the kind of node of an expression
+type Op string
+
+const (
+	And		Op = "and"
+	Or		Op = "or"
+	Not		Op = "not"
+	Equal	Op = "="
+	NotEqual	Op = "!="
+)
+
+// Expr is a node of a parsed expression. And, Or and Not nodes have
+// Children, comparisons have a Field and the Values it is compared to.
+type Expr struct {
+	Op			Op
+	Children	[]*Expr
+	Field		string
+	Values		[]string
+}
+
+// fieldColumns maps the fields usable in expressions to the SQL matching
+// them against an array of values.
+var fieldColumns = map[string]string{
+	"country":	"probe_cc = ANY(%s)",
+	"platform":	"platform = ANY(%s)",
+	"asn":		"probe_asn = ANY(%s)",
+	"software":	"software_name = ANY(%s)",
+	"network":	"network_type = ANY(%s)",
+	"region":	"region = ANY(%s)",
+	"probe":	"id::text = ANY(%s)",
+	"tag":		"tags && %s::VARCHAR[]",
+	"language":	"(locale = ANY(%[1]s) OR split_part(locale, '-', 1) = ANY(%[1]s))",
+	// Probes registered before attestation was supported have none
+	"attestation":	"COALESCE(attestation_level, 'none') = ANY(%s)",
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokEqual
+	tokNotEqual
+	tokLParen
+	tokRParen
+	tokEOF
+)
+
+type token struct {
+	kind	tokenKind
+	value	string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: tokEqual})
+			i++
+		case c == '!':
+			if i+1 >= len(s) || s[i+1] != '=' {
+				return nil, ErrSyntax
+			}
+			tokens = append(tokens, token{kind: tokNotEqual})
+			i += 2
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end == -1 {
+				return nil, ErrSyntax
+			}
+			tokens = append(tokens, token{kind: tokWord, value: s[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n()=!\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokWord, value: s[i:j]})
+			i = j
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+type parser struct {
+	tokens	[]token
+	pos		int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.ToUpper(t.value) == kw
+}
+
+// or := and ("OR" and)*
+func (p *parser) parseOr() (*Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []*Expr{left}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &Expr{Op: Or, Children: children}, nil
+}
+
+// and := unary ("AND" unary)*
+func (p *parser) parseAnd() (*Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []*Expr{left}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &Expr{Op: And, Children: children}, nil
+}
+
+// unary := "NOT" unary | "(" or ")" | field ("=" | "!=") values
+func (p *parser) parseUnary() (*Expr, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Op: Not, Children: []*Expr{child}}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, ErrSyntax
+		}
+		return e, nil
+	}
+
+	field := p.next()
+	if field.kind != tokWord {
+		return nil, ErrSyntax
+	}
+	name := strings.ToLower(field.value)
+	if _, ok := fieldColumns[name]; !ok {
+		return nil, ErrUnknownField
+	}
+	var op Op
+	switch p.next().kind {
+	case tokEqual:
+		op = Equal
+	case tokNotEqual:
+		op = NotEqual
+	default:
+		return nil, ErrSyntax
+	}
+	value := p.next()
+	if value.kind != tokWord {
+		return nil, ErrSyntax
+	}
+	var values []string
+	for _, v := range strings.Split(value.value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, ErrSyntax
+	}
+	return &Expr{Op: op, Field: name, Values: values}, nil
+}
+
+// Parse parses an expression. The keywords AND, OR and NOT are case
+// insensitive, AND binds tighter than OR.
+func Parse(s string) (*Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, ErrSyntax
+	}
+	return e, nil
+}
+
+// Compile turns the expression into an SQL condition. The values are
+// appended to args and referenced as positional parameters, so that the
+// condition can be combined with others using the same arguments.
+func (e *Expr) Compile(args []interface{}) (string, []interface{}) {
+	switch e.Op {
+	case And, Or:
+		var parts []string
+		for _, c := range e.Children {
+			var part string
+			part, args = c.Compile(args)
+			parts = append(parts, part)
+		}
+		sep := " AND "
+		if e.Op == Or {
+			sep = " OR "
+		}
+		return "(" + strings.Join(parts, sep) + ")", args
+	case Not:
+		part, args := e.Children[0].Compile(args)
+		return "NOT COALESCE(" + part + ", FALSE)", args
+	}
+	args = append(args, pq.Array(e.Values))
+	cond := fmt.Sprintf(fieldColumns[e.Field], fmt.Sprintf("$%d", len(args)))
+	if e.Op == NotEqual {
+		// Probes where the field is not known are not equal either
+		return "NOT COALESCE(" + cond + ", FALSE)", args
+	}
+	return "COALESCE(" + cond + ", FALSE)", args
+}
+
+// Match tells whether the probe with the given values of the fields is
+// matched, like the compiled condition would. A field without values isn't
+// known: it is equal to none of the values, and thus not equal to all of
+// them.
+func (e *Expr) Match(fields map[string][]string) bool {
+	switch e.Op {
+	case And:
+		for _, c := range e.Children {
+			if !c.Match(fields) {
+				return false
+			}
+		}
+		return true
+	case Or:
+		for _, c := range e.Children {
+			if c.Match(fields) {
+				return true
+			}
+		}
+		return false
+	case Not:
+		return !e.Children[0].Match(fields)
+	}
+	equal := false
+	for _, have := range fields[e.Field] {
+		for _, value := range e.Values {
+			if have == value {
+				equal = true
+			}
+		}
+	}
+	if e.Op == NotEqual {
+		return !equal
+	}
+	return equal
+}
+
+func (e *Expr) String() string {
+	switch e.Op {
+	case And, Or:
+		var parts []string
+		for _, c := range e.Children {
+			parts = append(parts, c.String())
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(string(e.Op))+" ") + ")"
+	case Not:
+		return "NOT " + e.Children[0].String()
+	}
+	return fmt.Sprintf("%s%s%s", e.Field, e.Op, strings.Join(e.Values, ","))
+}
@@ -0,0 +1,82 @@
+package targeting
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	e, err := Parse("(country=IR AND platform=android) or tag=staff")
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	expected := "((country=IR AND platform=android) OR tag=staff)"
+	if e.String() != expected {
+		t.Errorf("expected %s (got: %s)", expected, e.String())
+	}
+
+	e, err = Parse(`NOT country=IR,IQ AND region != "IR-07"`)
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	expected = "(NOT country=IR,IQ AND region!=IR-07)"
+	if e.String() != expected {
+		t.Errorf("expected %s (got: %s)", expected, e.String())
+	}
+
+	for _, s := range []string{"", "country=", "(country=IR", "country IR",
+								"country=IR platform=android", "a!b"} {
+		if _, err = Parse(s); err != ErrSyntax {
+			t.Errorf("expected %q to be a syntax error (got: %v)", s, err)
+		}
+	}
+	if _, err = Parse("antani=IR"); err != ErrUnknownField {
+		t.Errorf("expected unknown field error (got: %v)", err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	e, err := Parse("(country=IR AND NOT platform=android) OR tag=staff")
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	sql, args := e.Compile([]interface{}{"existing"})
+	expected := "((COALESCE(probe_cc = ANY($2), FALSE) AND " +
+				"NOT COALESCE(COALESCE(platform = ANY($3), FALSE), FALSE)) OR " +
+				"COALESCE(tags && $4::VARCHAR[], FALSE))"
+	if sql != expected {
+		t.Errorf("expected %s (got: %s)", expected, sql)
+	}
+	if len(args) != 4 {
+		t.Errorf("expected 4 arguments (got: %d)", len(args))
+	}
+}
+
+func TestMatch(t *testing.T) {
+	e, err := Parse("(country=IR AND NOT platform=android) OR tag=staff,beta")
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	tests := []struct {
+		fields		map[string][]string
+		expected	bool
+	}{
+		{map[string][]string{"country": {"IR"}, "platform": {"ios"}}, true},
+		{map[string][]string{"country": {"IR"}, "platform": {"android"}}, false},
+		{map[string][]string{"country": {"IR"}}, true},
+		{map[string][]string{"country": {"IQ"}, "tag": {"beta", "x"}}, true},
+		{map[string][]string{"country": {"IQ"}}, false},
+	}
+	for _, test := range tests {
+		if e.Match(test.fields) != test.expected {
+			t.Errorf("expected %v to match: %v", test.fields, test.expected)
+		}
+	}
+
+	e, err = Parse("region!=IR-07")
+	if err != nil {
+		t.Fatalf("failed to parse (%v)", err)
+	}
+	if !e.Match(map[string][]string{}) {
+		t.Error("expected a probe without region to match")
+	}
+}
@@ -0,0 +1,193 @@
+// Package taskargs checks the arguments of the tasks against the schema of
+// their test. The schemas are written in the subset of JSON Schema the
+// arguments need: type, properties, required, additionalProperties, items,
+// minItems, maxItems, enum and the "uri" format.
+package taskargs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Schema describes a JSON value
+type Schema struct {
+	Type					Types `json:"type"`
+	Properties				map[string]*Schema `json:"properties"`
+	Required				[]string `json:"required"`
+	AdditionalProperties	*bool `json:"additionalProperties"`
+	Items					*Schema `json:"items"`
+	MinItems				*int `json:"minItems"`
+	MaxItems				*int `json:"maxItems"`
+	Enum					[]interface{} `json:"enum"`
+	Format					string `json:"format"`
+}
+
+// Types are the types a value may have, given either as a single type or
+// as a list of them
+type Types []string
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = Types(list)
+	return nil
+}
+
+// ValidationError tells which argument doesn't match the schema
+type ValidationError struct {
+	// Where the argument is, e.g. "arguments.urls[2]"
+	Path	string
+	Message	string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// The schemas of the tests, by test name
+var schemas = map[string]*Schema{}
+
+// Load parses the schema of the arguments of testName
+func Load(testName string, raw []byte) error {
+	var s Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("invalid schema for %s: %s", testName, err)
+	}
+	schemas[testName] = &s
+	return nil
+}
+
+// Validate checks the arguments of a task running testName. The tests
+// without a schema take any arguments.
+func Validate(testName string, args interface{}) error {
+	s, ok := schemas[testName]
+	if !ok {
+		return nil
+	}
+	return s.Validate(args)
+}
+
+// Validate checks the value, as decoded by encoding/json
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate("arguments", value)
+}
+
+func (s *Schema) validate(path string, value interface{}) error {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return &ValidationError{path, fmt.Sprintf("expected %s", s.Type)}
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return &ValidationError{path, "not one of the allowed values"}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return &ValidationError{path,
+				fmt.Sprintf("expected at least %d items", *s.MinItems)}
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return &ValidationError{path,
+				fmt.Sprintf("expected at most %d items", *s.MaxItems)}
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		if s.Format == "uri" && !isURI(v) {
+			return &ValidationError{path, "not a valid URI"}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{path + "." + name, "missing"}
+		}
+	}
+	// Sorted so that the same arguments always give the same error
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return &ValidationError{path + "." + name, "unknown argument"}
+			}
+			continue
+		}
+		if err := prop.validate(path + "." + name, obj[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Types) matches(value interface{}) bool {
+	for _, name := range t {
+		if typeOf(value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value interface{}, name string) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || (name == "integer" && v == float64(int64(v)))
+	case json.Number:
+		if name == "integer" {
+			_, err := v.Int64()
+			return err == nil
+		}
+		return name == "number"
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	}
+	return false
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isURI tells whether s is an absolute URI, the probes can't resolve the
+// relative ones
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+}
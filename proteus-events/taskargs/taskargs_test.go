@@ -0,0 +1,63 @@
+package taskargs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const urlsSchema = `{
+	"type": "object",
+	"properties": {
+		"urls": {
+			"type": "array",
+			"items": {"type": "string", "format": "uri"},
+			"maxItems": 2
+		},
+		"mode": {"enum": ["fast", "slow"]},
+		"count": {"type": "integer"}
+	},
+	"required": ["urls"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	if err := Load("urls_test", []byte(urlsSchema)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args	string
+		path	string
+	}{
+		{`{"urls": ["https://example.com/"]}`, ""},
+		{`{"urls": [], "mode": "fast", "count": 3}`, ""},
+		{`null`, "arguments"},
+		{`{}`, "arguments.urls"},
+		{`{"urls": "https://example.com/"}`, "arguments.urls"},
+		{`{"urls": ["https://example.com/", "example.com"]}`, "arguments.urls[1]"},
+		{`{"urls": ["http://a/", "http://b/", "http://c/"]}`, "arguments.urls"},
+		{`{"urls": [], "mode": "medium"}`, "arguments.mode"},
+		{`{"urls": [], "count": 1.5}`, "arguments.count"},
+		{`{"urls": [], "url": "https://example.com/"}`, "arguments.url"},
+	}
+	for _, test := range tests {
+		var args interface{}
+		if err := json.Unmarshal([]byte(test.args), &args); err != nil {
+			t.Fatal(err)
+		}
+		err := Validate("urls_test", args)
+		if test.path == "" {
+			if err != nil {
+				t.Errorf("%s: expected to be valid (got: %v)", test.args, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok || verr.Path != test.path {
+			t.Errorf("%s: expected an error at %s (got: %v)", test.args, test.path, err)
+		}
+	}
+
+	if err := Validate("no_schema_test", "anything"); err != nil {
+		t.Errorf("expected the tests without a schema to take anything (got: %v)", err)
+	}
+}
@@ -0,0 +1,184 @@
+package taskstate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// State is the state a task is in. The values are stored as is in the state
+// column of the tasks table.
+type State string
+
+const (
+	Ready		State = "ready"
+	Notified	State = "notified"
+	Accepted	State = "accepted"
+	Rejected	State = "rejected"
+	Done		State = "done"
+	Cancelled	State = "cancelled"
+	Failed		State = "failed"
+)
+
+var ErrUnknownState = errors.New("unknown task state")
+var ErrInvalidTransition = errors.New("invalid task state transition")
+
+// Transition describes how a task can move into a state.
+type Transition struct {
+	// The states a task must be in to be moved to the target state
+	From		[]State
+	// The column of the tasks table recording when the transition happened.
+	// Empty if the transition only touches last_updated.
+	TimeColumn	string
+	// Internal transitions are only performed by the orchestrator and
+	// cannot be requested by probes.
+	Internal	bool
+}
+
+// TransitionConfig is how a transition is specified in the configuration
+// file, for example:
+//
+//   [task-transitions.downloading_inputs]
+//   from = ["accepted"]
+type TransitionConfig struct {
+	From		[]string `mapstructure:"from"`
+	TimeColumn	string `mapstructure:"time-column"`
+	Internal	bool `mapstructure:"internal"`
+}
+
+// DefaultTransitions is the policy used when nothing else is configured
+var DefaultTransitions = map[State]Transition{
+	// Accepted tasks whose lease expired are handed out again
+	Ready: {
+		From: []State{Accepted},
+		Internal: true,
+	},
+	Notified: {
+		From: []State{Ready},
+		TimeColumn: "notification_time",
+		Internal: true,
+	},
+	Accepted: {
+		From: []State{Ready, Notified},
+		TimeColumn: "accept_time",
+	},
+	Rejected: {
+		From: []State{Ready, Notified, Accepted},
+		TimeColumn: "done_time",
+	},
+	Done: {
+		From: []State{Accepted},
+		TimeColumn: "done_time",
+	},
+	Cancelled: {
+		From: []State{Ready, Notified},
+		Internal: true,
+	},
+	Failed: {
+		From: []State{Ready, Notified, Accepted},
+		TimeColumn: "done_time",
+	},
+}
+
+var transitions = DefaultTransitions
+
+// Configure replaces the transition policy with the defaults overridden by
+// the transitions in cfg. It is meant to be called once at startup.
+func Configure(cfg map[string]TransitionConfig) error {
+	policy := make(map[State]Transition)
+	for to, t := range DefaultTransitions {
+		policy[to] = t
+	}
+	for to, tc := range cfg {
+		t := Transition{
+			TimeColumn: tc.TimeColumn,
+			Internal: tc.Internal,
+		}
+		for _, from := range tc.From {
+			t.From = append(t.From, State(from))
+		}
+		policy[State(to)] = t
+	}
+	for to, t := range policy {
+		for _, from := range t.From {
+			if _, ok := policy[from]; !ok && from != Ready {
+				return fmt.Errorf("transition to %s: %s is not reachable", to, from)
+			}
+		}
+	}
+	transitions = policy
+	return nil
+}
+
+// Parse returns the State for the given string
+func Parse(s string) (State, error) {
+	state := State(s)
+	if state == Ready {
+		return state, nil
+	}
+	if _, ok := transitions[state]; !ok {
+		return state, ErrUnknownState
+	}
+	return state, nil
+}
+
+// CanTransition tells if a task in state s may be moved to state to
+func (s State) CanTransition(to State) bool {
+	t, ok := transitions[to]
+	if !ok {
+		return false
+	}
+	for _, from := range t.From {
+		if from == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns ErrInvalidTransition when moving from s to to is not allowed
+func (s State) Check(to State) error {
+	if !s.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// TimeColumn returns the column recording when a task entered state to
+func TimeColumn(to State) string {
+	return transitions[to].TimeColumn
+}
+
+// TimeColumns returns the columns the transitions record their time in
+func TimeColumns() []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, t := range transitions {
+		if t.TimeColumn != "" && !seen[t.TimeColumn] {
+			seen[t.TimeColumn] = true
+			columns = append(columns, t.TimeColumn)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// IsInternal tells if only the orchestrator may move tasks to state to
+func IsInternal(to State) bool {
+	return transitions[to].Internal
+}
+
+// ValidFrom returns the states from which a task may be moved to state to
+func ValidFrom(to State) []State {
+	return transitions[to].From
+}
+
+// Strings converts a list of states into a list of strings, useful for
+// passing them to pq.Array.
+func Strings(states []State) []string {
+	var s []string
+	for _, state := range states {
+		s = append(s, string(state))
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+package taskstate
+
+import (
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	if !Ready.CanTransition(Accepted) {
+		t.Error("expected ready => accepted to be allowed")
+	}
+	if !Accepted.CanTransition(Done) {
+		t.Error("expected accepted => done to be allowed")
+	}
+	if Ready.CanTransition(Done) {
+		t.Error("expected ready => done to not be allowed")
+	}
+	if Accepted.CanTransition(Cancelled) {
+		t.Error("expected accepted => cancelled to not be allowed")
+	}
+	if Done.Check(Rejected) != ErrInvalidTransition {
+		t.Error("expected done => rejected to return ErrInvalidTransition")
+	}
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse("notified")
+	if err != nil || s != Notified {
+		t.Errorf("expected notified (got: %s, %v)", s, err)
+	}
+	_, err = Parse("antani")
+	if err != ErrUnknownState {
+		t.Errorf("expected ErrUnknownState (got: %v)", err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer func() { transitions = DefaultTransitions }()
+
+	err := Configure(map[string]TransitionConfig{
+		"downloading_inputs": {From: []string{"accepted"}},
+		"done": {From: []string{"accepted", "downloading_inputs"},
+				TimeColumn: "done_time"},
+	})
+	if err != nil {
+		t.Errorf("failed to configure (%v)", err)
+	}
+	s, err := Parse("downloading_inputs")
+	if err != nil {
+		t.Errorf("expected downloading_inputs to be known (got: %v)", err)
+	}
+	if !Accepted.CanTransition(s) || !s.CanTransition(Done) {
+		t.Error("expected accepted => downloading_inputs => done")
+	}
+	if TimeColumn(Done) != "done_time" {
+		t.Errorf("expected done_time (got: %s)", TimeColumn(Done))
+	}
+	if !Ready.CanTransition(Accepted) {
+		t.Error("expected default transitions to be kept")
+	}
+
+	err = Configure(map[string]TransitionConfig{
+		"done": {From: []string{"antani"}},
+	})
+	if err == nil {
+		t.Error("expected unreachable state to be an error")
+	}
+}
@@ -142,7 +142,7 @@ export default class AdminJobsIndex extends React.Component {
       return
     }
     let req = this.state.session.createRequest({baseURL: process.env.EVENTS_URL})
-    req.get('/api/v1/admin/jobs')
+    req.get('/api/v1/admin/jobs?show_deleted=true')
       .then((res) => {
         this.setState({
           jobList: res.data.jobs,
@@ -0,0 +1,21 @@
+-- +migrate Down
+DROP TABLE IF EXISTS notifications;
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id UUID PRIMARY KEY NOT NULL,
+    platform VARCHAR,
+    tokens VARCHAR[],
+    payload JSONB,
+    state VARCHAR,
+    attempts INT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_error VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    last_updated TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX notifications_pending_idx ON notifications (next_attempt_at)
+    WHERE state = 'pending';
+-- +migrate StatementEnd
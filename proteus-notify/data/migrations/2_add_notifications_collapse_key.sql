@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE notifications DROP COLUMN IF EXISTS collapse_key;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE notifications ADD COLUMN collapse_key VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS notifications_tokens_idx;
+
+-- +migrate Up
+CREATE INDEX notifications_tokens_idx ON notifications USING GIN (tokens);
@@ -0,0 +1,19 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TRIGGER IF EXISTS notifications_notify_insert ON notifications;
+DROP FUNCTION IF EXISTS notifications_notify_insert();
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION notifications_notify_insert() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('proteus_notification_queued', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notifications_notify_insert ON notifications;
+CREATE TRIGGER notifications_notify_insert AFTER INSERT ON notifications
+    FOR EACH ROW EXECUTE PROCEDURE notifications_notify_insert();
+-- +migrate StatementEnd
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	apns "github.com/sideshow/apns2"
+)
+
+// APNs refuses provider tokens older than an hour and more than one new
+// token every 20 minutes.
+const apnsTokenLifetime = 50 * time.Minute
+
+var ErrInvalidApnsKey = errors.New("invalid APNs authentication key")
+
+// ApnsToken signs the JSON Web Tokens used to authenticate to APNs with a
+// .p8 authentication key, instead of a per app certificate.
+type ApnsToken struct {
+	KeyID		string
+	TeamID		string
+	key			*ecdsa.PrivateKey
+
+	lock		sync.Mutex
+	bearer		string
+	issuedAt	time.Time
+}
+
+func LoadApnsToken(keyPath string, keyID string, teamID string) (*ApnsToken, error) {
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidApnsKey
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidApnsKey
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidApnsKey
+	}
+	return &ApnsToken{
+		KeyID: keyID,
+		TeamID: teamID,
+		key: key,
+	}, nil
+}
+
+// Bearer returns the current token, signing a new one when it is about to
+// expire.
+func (t *ApnsToken) Bearer() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	if t.bearer != "" && now.Sub(t.issuedAt) < apnsTokenLifetime {
+		return t.bearer, nil
+	}
+
+	header, _ := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": t.KeyID,
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": t.TeamID,
+		"iat": now.Unix(),
+	})
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, t.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// ES256 signatures are the two 32 bytes integers one after the other
+	sig := make([]byte, 64)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rBytes):32], rBytes)
+	copy(sig[64-len(sBytes):], sBytes)
+
+	t.bearer = signed + "." + enc.EncodeToString(sig)
+	t.issuedAt = now
+	return t.bearer, nil
+}
+
+// apnsTokenTransport adds the provider token to the requests sent to APNs
+type apnsTokenTransport struct {
+	token	*ApnsToken
+	base	http.RoundTripper
+}
+
+func (tt *apnsTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bearer, err := tt.token.Bearer()
+	if err != nil {
+		return nil, err
+	}
+	// A RoundTripper must not modify the request it is given
+	authReq := req.Clone(req.Context())
+	authReq.Header.Set("authorization", "bearer " + bearer)
+	return tt.base.RoundTrip(authReq)
+}
+
+// NewApnsTokenClient returns an APNs client authenticating with token
+func NewApnsTokenClient(token *ApnsToken) *apns.Client {
+	client := apns.NewClient(tls.Certificate{})
+	client.HTTPClient.Transport = &apnsTokenTransport{
+		token: token,
+		base: client.HTTPClient.Transport,
+	}
+	return client
+}
@@ -0,0 +1,425 @@
+// Code generated by go-bindata.
+// sources:
+// proteus-notify/data/migrations/1_notifications_create.sql
+// proteus-notify/data/migrations/2_add_notifications_collapse_key.sql
+// proteus-notify/data/migrations/3_notifications_tokens_index.sql
+// proteus-notify/data/migrations/4_notifications_notify_trigger.sql
+// proteus-notify/data/templates/de.json
+// proteus-notify/data/templates/en.json
+// proteus-notify/data/templates/es.json
+// proteus-notify/data/templates/fr.json
+// proteus-notify/data/templates/it.json
+// DO NOT EDIT!
+
+package notify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func bindataRead(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, gz)
+	clErr := gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+	if clErr != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type asset struct {
+	bytes []byte
+	info  os.FileInfo
+}
+
+type bindataFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi bindataFileInfo) Name() string {
+	return fi.name
+}
+func (fi bindataFileInfo) Size() int64 {
+	return fi.size
+}
+func (fi bindataFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+func (fi bindataFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+func (fi bindataFileInfo) IsDir() bool {
+	return false
+}
+func (fi bindataFileInfo) Sys() interface{} {
+	return nil
+}
+
+var _dataMigrations1_notifications_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x91\x51\x4f\xfa\x30\x14\xc5\xdf\xfb\x29\xee\x1b\x90\xff\x9f\x4f\x40\x7c\x18\xac\x86\x2a\x74\xa4\xeb\x04\x34\x66\x69\xe8\x85\x34\x6e\xed\xb2\x5d\x23\x7e\x7b\xe3\x36\xa2\x33\x98\xf8\x78\x4f\xcf\xf9\xb5\x3d\x77\x3a\x85\x7f\xa5\x3b\xd5\x86\x10\xe2\xf0\xe6\x59\xac\x92\x0d\xe8\x68\xbe\xe2\x20\x6e\x81\xef\x44\xaa\x53\xf0\x81\xdc\xd1\x1d\x0c\xb9\xe0\x9b\x19\x63\xdf\x53\x59\x35\x18\x53\x32\x84\x25\x7a\x9a\xe3\xc9\x79\xb6\x50\x3c\xd2\xfc\x0b\x28\x13\x7d\x15\xca\xc6\x0c\x00\xc0\x59\xc8\x32\x11\xc3\x46\x89\x75\xa4\xf6\x70\xcf\xf7\x6d\x44\x66\xab\xd5\xff\xd6\x51\x15\x86\x8e\xa1\x2e\xe1\x21\x52\x8b\x65\xa4\x3a\x95\xc2\x0b\xfa\xe6\xa2\x3d\x3d\xf7\x5e\xf3\x5e\x04\x63\xe1\x2e\x4d\xe4\xbc\x93\x9a\xcf\xe7\x0d\xb3\x86\x08\xcb\x8a\x1a\x10\x52\x77\x8a\xc7\x33\xe5\xbd\x9c\x1b\x02\x2d\xd6\x3c\xd5\xd1\x7a\x03\x5b\xa1\x97\xed\x08\x8f\x89\xe4\x9d\xbb\x30\x0d\xe5\x58\xd7\xa1\x1e\x72\x0f\x35\xb6\x85\xe5\xe4\x4a\xfc\x0b\xe3\xb5\xb2\x86\xd0\xfe\x6a\x65\x93\xd9\xa5\x4f\x21\x63\xbe\x1b\x36\x98\x57\xe8\xad\xf3\xa7\xdc\xd9\x33\x24\x72\x78\x08\xe3\x1f\x7f\x9a\xb4\xd7\x6e\x97\x5c\xf1\xbe\x93\x1b\x18\xf5\x84\xd1\xec\xfa\x46\xb9\xb7\xec\x63\x00\xc2\xbe\x55\x69\x30\x02\x00\x00")
+
+func dataMigrations1_notifications_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations1_notifications_createSql,
+		"data/migrations/1_notifications_create.sql",
+	)
+}
+
+func dataMigrations1_notifications_createSql() (*asset, error) {
+	bytes, err := dataMigrations1_notifications_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/1_notifications_create.sql", size: 560, mode: os.FileMode(420), modTime: time.Unix(1792045863, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations2_add_notifications_collapse_keySql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\xc8\xcb\x2f\xc9\x4c\xcb\x4c\x4e\x2c\xc9\xcc\xcf\x2b\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\xce\xcf\xc9\x49\x2c\x28\x4e\x8d\xcf\x4e\xad\xb4\xc6\x6e\xb0\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x79\x2e\x70\x74\x71\x81\x39\x00\xd9\x5a\x85\x30\xc7\x20\x67\x0f\xc7\x20\x3c\xd6\x03\x06\x00\xa0\xc9\xb5\x3c\x02\x01\x00\x00")
+
+func dataMigrations2_add_notifications_collapse_keySqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations2_add_notifications_collapse_keySql,
+		"data/migrations/2_add_notifications_collapse_key.sql",
+	)
+}
+
+func dataMigrations2_add_notifications_collapse_keySql() (*asset, error) {
+	bytes, err := dataMigrations2_add_notifications_collapse_keySqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/2_add_notifications_collapse_key.sql", size: 258, mode: os.FileMode(420), modTime: time.Unix(1792046039, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations3_notifications_tokens_indexSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\x09\xf2\x0f\x50\xf0\xf4\x73\x71\x8d\x50\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\xc8\xcb\x2f\xc9\x4c\xcb\x4c\x4e\x2c\xc9\xcc\xcf\x2b\x8e\x2f\xc9\xcf\x4e\xcd\x2b\x8e\xcf\x4c\xa9\xb0\xe6\xe2\x42\x36\x20\xb4\x80\xcb\x39\xc8\xd5\x31\xc4\x15\x6a\x00\x2e\x6d\x0a\xfe\x7e\xa8\x46\x2a\x84\x06\x7b\xfa\xb9\x2b\xb8\x7b\xfa\x29\x68\x94\xe4\x67\xa7\xe6\x15\x6b\x5a\x73\x01\x06\x00\x8c\x5f\x5e\xe7\x9b\x00\x00\x00")
+
+func dataMigrations3_notifications_tokens_indexSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations3_notifications_tokens_indexSql,
+		"data/migrations/3_notifications_tokens_index.sql",
+	)
+}
+
+func dataMigrations3_notifications_tokens_indexSql() (*asset, error) {
+	bytes, err := dataMigrations3_notifications_tokens_indexSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/3_notifications_tokens_index.sql", size: 155, mode: os.FileMode(420), modTime: time.Unix(1792046269, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations4_notifications_notify_triggerSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x91\x51\x6b\xf2\x30\x14\x86\xef\xf3\x2b\xce\x45\x41\xe5\xfb\xdc\x0f\xb0\x57\xb1\x3d\xed\x0a\x2e\x29\xa7\x09\x7a\x57\x64\x66\x21\xa0\x69\x6d\x23\xdb\xfe\xfd\xd0\x3a\xa6\x4c\x64\x8c\x5d\x26\x6f\xce\x73\x1e\xf2\x4e\xa7\xf0\x6f\xe7\x6c\xb7\x0e\x06\xd2\xe6\xd5\xb3\xcb\x8b\x2a\xac\x83\xd9\x19\x1f\xe6\xc6\x3a\xcf\x52\x92\x25\x28\x2a\xf2\x1c\x09\x8a\x0c\x70\x55\x54\xaa\x02\xdf\x04\xf7\xe2\x9e\xd7\xc1\x35\xbe\xaf\x4f\xa7\xf7\xda\xf9\xde\x74\x01\xa4\xb8\x8e\xe3\x01\x92\x69\x91\xa8\x42\x8a\x9f\x51\xc6\x93\xf8\xb6\x16\xfa\x0d\xbb\x4a\x74\x7b\xfb\xe1\xe0\x9f\x10\x72\x85\x20\x09\x08\xcb\x05\x4f\xf0\xcb\xe3\xee\x76\x20\x54\x9a\x44\x05\xa1\x73\xd6\x9a\x0e\x78\x05\x51\xc4\xe6\x98\x17\x82\x01\x00\x94\x48\x99\xa4\x27\x68\xed\x79\x74\x3c\x6a\xbb\x26\x98\x43\x5f\x5f\x82\xeb\xfd\xc1\x1c\xcc\x66\xf4\x1f\x04\x2e\x1f\xdc\x66\x36\x0b\xe6\x2d\x4c\xe2\x13\x63\xd8\x71\x4c\x62\x86\x22\x8d\x59\x14\xc1\x82\x8b\x5c\xf3\x1c\xa1\xdd\xb6\xb6\xdf\x6f\x63\xf6\x37\x1d\x9c\x3f\xe2\x13\x73\x6f\x98\x67\xea\x58\xb6\xa8\x90\xd4\x37\xd2\x49\x3c\x93\x04\xc8\x93\x47\x20\xb9\x04\x5c\x61\xa2\x15\x42\x49\x32\xc1\x54\x13\xfe\xba\xd7\x8f\x01\x00\x36\xb3\x16\x29\x99\x02\x00\x00")
+
+func dataMigrations4_notifications_notify_triggerSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations4_notifications_notify_triggerSql,
+		"data/migrations/4_notifications_notify_trigger.sql",
+	)
+}
+
+func dataMigrations4_notifications_notify_triggerSql() (*asset, error) {
+	bytes, err := dataMigrations4_notifications_notify_triggerSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/4_notifications_notify_trigger.sql", size: 665, mode: os.FileMode(420), modTime: time.Unix(1792051555, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataTemplatesDeJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4c\xca\x41\x4a\xc0\x30\x10\x46\xe1\x7d\x4e\xf1\x93\x75\xe9\x01\x7a\x02\xdd\xb8\x12\x5c\x96\xd4\x4c\x34\xd8\x4c\x21\x33\x23\x68\x98\x9b\x75\xd7\x8b\x49\x71\xa1\xbc\xdd\xe3\x1b\x01\x00\x62\x37\x5e\x35\xc9\x47\x5c\xf0\x7b\xee\xa2\x56\xdd\x29\x2e\x88\x4f\x64\xd4\xf1\x4c\xa2\xf8\xa4\x5e\xae\xf3\x6d\x4b\x3d\x4e\x7f\x72\x3b\xf2\xd7\x0d\x1f\xea\x5e\x60\x2c\x13\x72\x12\x3c\xb2\x52\x67\x52\x7c\x1b\x1a\x89\x10\x4f\xa8\x9c\xa9\x21\x1b\xc6\x98\x95\x44\x57\x4e\x8d\xdc\xc7\xa8\x05\xb3\xf5\x7d\x7d\x3d\x8c\xd5\x1d\xad\xea\x6d\xfe\xaf\x17\xda\xa4\x2a\xc9\x18\xc4\xd9\x1d\xc9\xa4\x5c\xe7\x7b\x17\x9d\x63\x00\x00\x0f\x1e\x7e\x06\x00\xbb\xba\x02\x20\xd2\x00\x00\x00")
+
+func dataTemplatesDeJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataTemplatesDeJson,
+		"data/templates/de.json",
+	)
+}
+
+func dataTemplatesDeJson() (*asset, error) {
+	bytes, err := dataTemplatesDeJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/templates/de.json", size: 210, mode: os.FileMode(420), modTime: time.Unix(1792046107, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataTemplatesEnJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4c\xcc\x41\xaa\xc3\x30\x0c\x84\xe1\xbd\x4f\x31\x78\xfd\xc8\x01\x72\x82\xb7\xea\x15\x42\xd2\x4c\x5b\xd3\x44\x2e\xb6\x4c\x08\x42\x77\x2f\xa6\x8b\x16\xed\x7e\x3e\x8d\x05\x00\x88\xa5\xc9\xa4\x73\x7d\xc6\x11\x9f\xd2\x2f\x6a\xd2\x8d\x71\x44\xbc\xf0\x80\xb2\x2a\x34\xa3\x34\x89\x7f\x5f\xb3\xe4\xf5\xec\xe4\x9f\xdb\x0b\xad\x62\xe7\x5c\x5b\x21\xf4\x41\x24\x51\x16\xa1\x62\x39\xfb\x9b\x24\xb9\xc3\x6c\xe8\x4b\x93\xcc\x3b\xdd\xcd\xd2\x0d\x43\x2b\xdb\x74\xcd\x4d\xd4\x1d\x59\x3a\xf9\x2d\x07\x97\x9a\x94\xd5\x8c\xb2\xba\x0f\x31\x00\x80\x07\x0f\xef\x01\x00\xa4\x4e\xb6\x68\xbd\x00\x00\x00")
+
+func dataTemplatesEnJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataTemplatesEnJson,
+		"data/templates/en.json",
+	)
+}
+
+func dataTemplatesEnJson() (*asset, error) {
+	bytes, err := dataTemplatesEnJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/templates/en.json", size: 189, mode: os.FileMode(420), modTime: time.Unix(1792046107, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataTemplatesEsJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4c\xcb\xc1\x89\xc3\x30\x10\x85\xe1\xbb\xaa\x78\xe8\xbc\xb8\x00\xdf\xb6\x81\x6d\xc1\x8c\xad\x59\xd0\xae\x3d\x32\xd2\x28\xc1\x0c\xd3\x58\xae\x69\x2c\x98\x10\x12\xde\xed\xe7\x7b\x16\x00\x20\xd6\x2e\x93\x52\xfb\x8f\x23\x9e\xe5\x5c\xd4\xac\x2b\xc7\x11\xf1\xa7\xf3\x85\xb0\xd7\xce\x33\x61\xa7\x4a\xe0\x3f\x5e\xba\x52\x8d\x5f\x6f\x3e\x97\x74\x9c\xfa\xfb\xb8\xdf\x12\x49\x69\x20\x6c\x9c\x72\x45\x16\xe5\x2a\xac\xaf\x9b\xa4\x02\xb3\x41\xb9\xe9\x24\xb4\xb1\xbb\x59\xfe\xc5\xd0\xeb\x3a\x2d\xa5\x8b\xba\x83\xe5\x24\x9f\xa5\x65\xcd\xa5\xe1\xca\xb3\x19\x4b\x72\x1f\x62\x00\x00\x0f\x1e\x1e\x03\x00\x5a\xa2\xe0\x1e\xc8\x00\x00\x00")
+
+func dataTemplatesEsJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataTemplatesEsJson,
+		"data/templates/es.json",
+	)
+}
+
+func dataTemplatesEsJson() (*asset, error) {
+	bytes, err := dataTemplatesEsJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/templates/es.json", size: 200, mode: os.FileMode(420), modTime: time.Unix(1792046107, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataTemplatesFrJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x54\xcc\x41\x8a\xc3\x30\x0c\x85\xe1\xbd\x4f\xf1\xf0\x7a\x26\x07\xc8\x6e\x2e\x30\x57\x08\x4e\xa2\x82\x69\x22\x83\x2d\xb5\xb4\x42\x77\xe9\xae\x07\xc9\xc5\x8a\xe9\xa2\x14\xed\x7e\x3e\x3d\x0b\x00\x10\xab\xf2\x24\xa9\x9d\xe3\x88\x77\xe9\x17\x25\xcb\x46\x71\x44\xfc\x2f\x7a\xa1\xa4\x10\x6a\x82\xe3\x81\x2d\xf1\x42\x35\xfe\x7c\xe8\x5c\xd6\x5b\x97\x7f\x79\xa5\xfb\x2f\x17\x6d\xdd\xed\xd4\xb4\x52\x45\x66\xa1\xca\x24\x20\xee\xbf\xc7\x33\xb1\xc0\x6c\xe8\x7b\x13\xa7\x9d\xdc\xcd\xf2\x09\x83\xd6\x6d\x5a\x8a\xb2\xb8\xa3\x69\xed\xe6\x2b\x65\xa1\x86\x2b\xcd\x66\xc4\xab\xfb\x10\x03\x00\x78\xf0\xf0\x1a\x00\xf9\xf8\x8f\x32\xc9\x00\x00\x00")
+
+func dataTemplatesFrJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataTemplatesFrJson,
+		"data/templates/fr.json",
+	)
+}
+
+func dataTemplatesFrJson() (*asset, error) {
+	bytes, err := dataTemplatesFrJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/templates/fr.json", size: 201, mode: os.FileMode(420), modTime: time.Unix(1792046107, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataTemplatesItJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x54\xcc\x41\x8a\xc3\x30\x0c\x85\xe1\xbd\x4f\xf1\xf0\x7a\xc8\x01\xb2\x9b\x0b\xcc\x15\x82\x27\x56\x8b\x68\x22\x83\x2d\x15\x8a\xd0\xdd\x8b\xc9\xa2\x14\xed\x7e\x3e\x3d\x4f\x00\x90\xbb\xc9\xa6\x65\x3c\xf2\x8a\xab\xcc\xcb\xca\x7a\x50\x5e\x91\xff\xac\x3d\x1b\x94\x86\xa2\x16\xd0\xa0\xbb\x71\xa7\xfc\xf3\xa1\xff\xad\xbe\xa6\xfc\x65\xd3\xb2\x33\x0a\x4e\x1e\xd6\x4b\x27\xb0\x28\x75\x21\xbd\xfe\x48\x6a\x83\xfb\x32\xc7\x36\x29\x27\x45\xb8\xf3\x0d\x8b\xf5\x63\xdb\x9b\x89\x46\x60\xd8\x24\x5f\x85\x95\xdd\x49\x6a\xc4\x92\x13\x00\x44\x8a\xf4\x1e\x00\xcf\xe7\xcf\x7a\xbe\x00\x00\x00")
+
+func dataTemplatesItJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_dataTemplatesItJson,
+		"data/templates/it.json",
+	)
+}
+
+func dataTemplatesItJson() (*asset, error) {
+	bytes, err := dataTemplatesItJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/templates/it.json", size: 190, mode: os.FileMode(420), modTime: time.Unix(1792046107, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+// Asset loads and returns the asset for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func Asset(name string) ([]byte, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("Asset %s can't read by error: %v", name, err)
+		}
+		return a.bytes, nil
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+// MustAsset is like Asset but panics when Asset would return an error.
+// It simplifies safe initialization of global variables.
+func MustAsset(name string) []byte {
+	a, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+
+	return a
+}
+
+// AssetInfo loads and returns the asset info for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func AssetInfo(name string) (os.FileInfo, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("AssetInfo %s can't read by error: %v", name, err)
+		}
+		return a.info, nil
+	}
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
+
+// AssetNames returns the names of the assets.
+func AssetNames() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+// _bindata is a table, holding each asset generator, mapped to its name.
+var _bindata = map[string]func() (*asset, error){
+	"data/migrations/1_notifications_create.sql": dataMigrations1_notifications_createSql,
+	"data/migrations/2_add_notifications_collapse_key.sql": dataMigrations2_add_notifications_collapse_keySql,
+	"data/migrations/3_notifications_tokens_index.sql": dataMigrations3_notifications_tokens_indexSql,
+	"data/migrations/4_notifications_notify_trigger.sql": dataMigrations4_notifications_notify_triggerSql,
+	"data/templates/de.json": dataTemplatesDeJson,
+	"data/templates/en.json": dataTemplatesEnJson,
+	"data/templates/es.json": dataTemplatesEsJson,
+	"data/templates/fr.json": dataTemplatesFrJson,
+	"data/templates/it.json": dataTemplatesItJson,
+}
+
+// AssetDir returns the file names below a certain
+// directory embedded in the file by go-bindata.
+// For example if you run go-bindata on data/... and data contains the
+// following hierarchy:
+//     data/
+//       foo.txt
+//       img/
+//         a.png
+//         b.png
+// then AssetDir("data") would return []string{"foo.txt", "img"}
+// AssetDir("data/img") would return []string{"a.png", "b.png"}
+// AssetDir("foo.txt") and AssetDir("notexist") would return an error
+// AssetDir("") will return []string{"data"}.
+func AssetDir(name string) ([]string, error) {
+	node := _bintree
+	if len(name) != 0 {
+		cannonicalName := strings.Replace(name, "\\", "/", -1)
+		pathList := strings.Split(cannonicalName, "/")
+		for _, p := range pathList {
+			node = node.Children[p]
+			if node == nil {
+				return nil, fmt.Errorf("Asset %s not found", name)
+			}
+		}
+	}
+	if node.Func != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	rv := make([]string, 0, len(node.Children))
+	for childName := range node.Children {
+		rv = append(rv, childName)
+	}
+	return rv, nil
+}
+
+type bintree struct {
+	Func     func() (*asset, error)
+	Children map[string]*bintree
+}
+var _bintree = &bintree{nil, map[string]*bintree{
+	"data": &bintree{nil, map[string]*bintree{
+		"migrations": &bintree{nil, map[string]*bintree{
+			"1_notifications_create.sql": &bintree{dataMigrations1_notifications_createSql, map[string]*bintree{}},
+			"2_add_notifications_collapse_key.sql": &bintree{dataMigrations2_add_notifications_collapse_keySql, map[string]*bintree{}},
+			"3_notifications_tokens_index.sql": &bintree{dataMigrations3_notifications_tokens_indexSql, map[string]*bintree{}},
+			"4_notifications_notify_trigger.sql": &bintree{dataMigrations4_notifications_notify_triggerSql, map[string]*bintree{}},
+		}},
+		"templates": &bintree{nil, map[string]*bintree{
+			"de.json": &bintree{dataTemplatesDeJson, map[string]*bintree{}},
+			"en.json": &bintree{dataTemplatesEnJson, map[string]*bintree{}},
+			"es.json": &bintree{dataTemplatesEsJson, map[string]*bintree{}},
+			"fr.json": &bintree{dataTemplatesFrJson, map[string]*bintree{}},
+			"it.json": &bintree{dataTemplatesItJson, map[string]*bintree{}},
+		}},
+	}},
+}}
+
+// RestoreAsset restores an asset under the given directory
+func RestoreAsset(dir, name string) error {
+	data, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	info, err := AssetInfo(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(_filePath(dir, filepath.Dir(name)), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(_filePath(dir, name), data, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(_filePath(dir, name), info.ModTime(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreAssets restores an asset under the given directory recursively
+func RestoreAssets(dir, name string) error {
+	children, err := AssetDir(name)
+	// File
+	if err != nil {
+		return RestoreAsset(dir, name)
+	}
+	// Dir
+	for _, child := range children {
+		err = RestoreAssets(dir, filepath.Join(name, child))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func _filePath(dir, name string) string {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	return filepath.Join(append([]string{dir}, strings.Split(cannonicalName, "/")...)...)
+}
+
@@ -2,6 +2,7 @@ package notify
 
 import (
 	"crypto/tls"
+	"database/sql"
 
 	"github.com/apex/log"
 	apns "github.com/sideshow/apns2"
@@ -12,6 +13,8 @@ var (
 		"cmd": "notify",
 	})
 	CertificatePemIos tls.Certificate
-	QueueNotification chan PushNotification
 	ApnsClient *apns.Client
+	// Used by the workers for the queue and to keep the stored device
+	// tokens up to date
+	DB *sql.DB
 )
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Upper bounds, in seconds, of the buckets of the delivery latency, i.e. the
+// time from when a notification is queued to when it's delivered.
+var latencyBuckets = []float64{1, 5, 15, 60, 300, 900, 3600, 21600, 86400}
+
+// Histogram counts observations by bucket. Counts[i] is the number of
+// observations greater than Buckets[i-1] and at most Buckets[i], the last
+// count is the ones greater than the last bucket.
+type Histogram struct {
+	Buckets	[]float64 `json:"buckets"`
+	Counts	[]int64 `json:"counts"`
+	Count	int64 `json:"count"`
+	Sum		float64 `json:"sum"`
+}
+
+func newHistogram(buckets []float64) Histogram {
+	return Histogram{
+		Buckets: buckets,
+		Counts: make([]int64, len(buckets) + 1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.Buckets) && v > h.Buckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// ChannelStats are the delivery metrics of a provider. Sent, Delivered and
+// Failed count devices, Failed by the reason given by the push service,
+// e.g. "BadDeviceToken". Purged counts the tokens that were invalidated.
+type ChannelStats struct {
+	Sent		int64 `json:"sent"`
+	Delivered	int64 `json:"delivered"`
+	Failed		map[string]int64 `json:"failed"`
+	Purged		int64 `json:"purged"`
+	Latency		Histogram `json:"latency"`
+}
+
+// DeliveryStats are the metrics of every provider since Since. They are
+// kept in memory, so every instance has its own.
+type DeliveryStats struct {
+	Since		time.Time `json:"since"`
+	Channels	map[string]*ChannelStats `json:"channels"`
+
+	mu			sync.Mutex
+}
+
+func NewDeliveryStats() *DeliveryStats {
+	return &DeliveryStats{
+		Since: time.Now().UTC(),
+		Channels: map[string]*ChannelStats{},
+	}
+}
+
+// Stats are the metrics of this instance, they are also published with
+// expvar as "notifications".
+var Stats = NewDeliveryStats()
+
+func init() {
+	expvar.Publish("notifications", expvar.Func(func() interface{} {
+		return Stats.Snapshot()
+	}))
+}
+
+func (s *DeliveryStats) channel(name string) *ChannelStats {
+	c, ok := s.Channels[name]
+	if !ok {
+		c = &ChannelStats{
+			Failed: map[string]int64{},
+			Latency: newHistogram(latencyBuckets),
+		}
+		s.Channels[name] = c
+	}
+	return c
+}
+
+// RecordSent counts n devices a provider is about to push to
+func (s *DeliveryStats) RecordSent(channel string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(channel).Sent += int64(n)
+}
+
+// RecordDelivered counts n devices the push service accepted the
+// notification for
+func (s *DeliveryStats) RecordDelivered(channel string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(channel).Delivered += int64(n)
+}
+
+// RecordFailed counts n devices the notification couldn't be pushed to
+func (s *DeliveryStats) RecordFailed(channel string, reason string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(channel).Failed[reason] += int64(n)
+}
+
+// RecordPurged counts n tokens the push service rejected for good
+func (s *DeliveryStats) RecordPurged(channel string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(channel).Purged += int64(n)
+}
+
+// RecordLatency observes how long a notification took to be delivered
+func (s *DeliveryStats) RecordLatency(channel string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.channel(channel)
+	c.Latency.Observe(d.Seconds())
+}
+
+// failureReason is the reason given by the push service or, when there is
+// none, the HTTP status of the response, e.g. "Status503".
+func failureReason(reason string, statusCode int) string {
+	if reason != "" {
+		return reason
+	}
+	return fmt.Sprintf("Status%d", statusCode)
+}
+
+// Snapshot returns a copy of the metrics that is safe to serialise
+func (s *DeliveryStats) Snapshot() *DeliveryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := &DeliveryStats{
+		Since: s.Since,
+		Channels: make(map[string]*ChannelStats, len(s.Channels)),
+	}
+	for name, c := range s.Channels {
+		copied := *c
+		copied.Failed = make(map[string]int64, len(c.Failed))
+		for reason, n := range c.Failed {
+			copied.Failed[reason] = n
+		}
+		copied.Latency.Counts = append([]int64(nil), c.Latency.Counts...)
+		snapshot.Channels[name] = &copied
+	}
+	return snapshot
+}
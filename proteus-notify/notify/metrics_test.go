@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := newHistogram([]float64{1, 10})
+	for _, v := range []float64{0.5, 1, 5, 10, 30} {
+		h.Observe(v)
+	}
+	expected := []int64{2, 2, 1}
+	for i, count := range expected {
+		if h.Counts[i] != count {
+			t.Errorf("bucket %d: expected %d (got: %d)", i, count, h.Counts[i])
+		}
+	}
+	if h.Count != 5 || h.Sum != 46.5 {
+		t.Errorf("expected 5 observations summing to 46.5 (got: %d, %f)",
+				h.Count, h.Sum)
+	}
+}
+
+func TestDeliveryStatsSnapshot(t *testing.T) {
+	s := NewDeliveryStats()
+	s.RecordSent("apns", 3)
+	s.RecordDelivered("apns", 1)
+	s.RecordFailed("apns", "BadDeviceToken", 2)
+	s.RecordLatency("apns", 2*time.Second)
+
+	snapshot := s.Snapshot()
+	s.RecordFailed("apns", "BadDeviceToken", 1)
+	s.RecordLatency("apns", 2*time.Second)
+
+	apns := snapshot.Channels["apns"]
+	if apns.Sent != 3 || apns.Delivered != 1 {
+		t.Errorf("expected 3 sent and 1 delivered (got: %d, %d)",
+				apns.Sent, apns.Delivered)
+	}
+	if apns.Failed["BadDeviceToken"] != 2 {
+		t.Errorf("expected 2 failures (got: %d)", apns.Failed["BadDeviceToken"])
+	}
+	if apns.Latency.Counts[1] != 1 {
+		t.Errorf("expected the snapshot not to change (got: %v)",
+				apns.Latency.Counts)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	if r := failureReason("Unregistered", 410); r != "Unregistered" {
+		t.Errorf("expected Unregistered (got: %s)", r)
+	}
+	if r := failureReason("", 503); r != "Status503" {
+		t.Errorf("expected Status503 (got: %s)", r)
+	}
+}
@@ -1,12 +1,18 @@
 package notify
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"time"
 	"errors"
 
 	"github.com/spf13/viper"
 	"path/filepath"
 
+	"github.com/apex/log"
+	"github.com/thetorproject/proteus/proteus-common/webhook"
 	"github.com/NaySoftware/go-fcm"
 	apns "github.com/sideshow/apns2"
 	"github.com/sideshow/apns2/certificate"
@@ -18,8 +24,20 @@ type PushNotification struct {
 	Platform	string
 	Priority	string
 	Data		map[string]interface{}
+	// The text shown to the user, rendered in the language of the probes.
+	// Pushes without text only wake up the app.
+	Title		string
+	Body		string
+	// Silent pushes wake up the app in the background and never show any
+	// text, background delivery is throttled by the platforms though.
+	Silent		bool
 	Retry		int
 	Topic		string
+	// Pending notifications with the same collapse key and devices are
+	// sent as one, and the devices only show the last one they got.
+	CollapseKey	string
+	// Deferred until then, e.g. because the device is in its quiet hours
+	NotBefore	time.Time
 
 	// iOS specific
 	Expiration	time.Time
@@ -27,7 +45,23 @@ type PushNotification struct {
 
 	// Android specific
 	TimeToLive	int
+
+	// Only written to the dry run sink, never pushed to the devices
 	DryRun		bool
+
+	// Webhook specific, the Tokens are the callback URLs
+	Secret		string
+
+	// Web Push specific, the Tokens are the endpoints of the subscriptions
+	// and these their keys
+	P256dh		string
+	Auth		string
+
+	// The tasks to move to notified once the notification is delivered
+	TaskIDs		[]string
+
+	// When the notification was queued
+	QueuedAt	time.Time `json:"-"`
 }
 
 func InitApnsClient() error {
@@ -42,197 +76,411 @@ func InitApnsClient() error {
 		apnKeyPassword = viper.GetString("apn.key-password")
 		isProduction = viper.GetBool("apn.production")
 	)
-	ext := filepath.Ext(apnKeyPath)
-	switch ext {
-	case ".p12":
-		CertificatePemIos, err = certificate.FromP12File(apnKeyPath, apnKeyPassword)
-	case ".pem":
-		CertificatePemIos, err = certificate.FromPemFile(apnKeyPath, apnKeyPassword)
+	switch viper.GetString("apn.auth-type") {
+	case "token":
+		// .p8 authentication keys work for all the apps of the team
+		token, err := LoadApnsToken(apnKeyPath,
+									viper.GetString("apn.key-id"),
+									viper.GetString("apn.team-id"))
+		if err != nil {
+			ctx.WithError(err).Error("authentication key error")
+			return err
+		}
+		ApnsClient = NewApnsTokenClient(token)
+	case "certificate":
+		ext := filepath.Ext(apnKeyPath)
+		switch ext {
+		case ".p12":
+			CertificatePemIos, err = certificate.FromP12File(apnKeyPath, apnKeyPassword)
+		case ".pem":
+			CertificatePemIos, err = certificate.FromPemFile(apnKeyPath, apnKeyPassword)
+		default:
+			err = errors.New("wrong certificate key extension")
+		}
+		if err != nil {
+			ctx.WithError(err).Error("certificate error")
+			return err
+		}
+		ApnsClient = apns.NewClient(CertificatePemIos)
 	default:
-		err = errors.New("wrong certificate key extension")
-	}
-	if err != nil {
-		ctx.WithError(err).Error("certificate error")
-		return err
+		return errors.New("apn.auth-type must be certificate or token")
 	}
 
 	if isProduction {
-		ApnsClient = apns.NewClient(CertificatePemIos).Production()
+		ApnsClient.Production()
 		return nil
 	}
-	ApnsClient = apns.NewClient(CertificatePemIos).Development()
+	ApnsClient.Development()
 	return nil
 }
 
-func InitWorkers(workerNum int, queueSize int) {
-	ctx.Debugf("worker number: %d, queue size: %d", workerNum, queueSize)
-	QueueNotification = make(chan PushNotification, queueSize)
-	for i := 0; i < workerNum; i++ {
-		go startWorker()
-	}
+// Provider delivers a notification to the devices of one platform. Push
+// makes a single attempt and returns the tokens that should be tried again
+// along with the last error.
+type Provider struct {
+	Push			func(PushNotification) ([]string, error)
+	MaxRetriesKey	string
 }
 
-func startWorker() {
-	for {
-		notification := <-QueueNotification
-		switch notification.Platform {
-		case "ios":
-			PushToApn(notification)
-		case "android":
-			PushToFcm(notification)
-		default:
-			ctx.Errorf("unsupported platform %s", notification.Platform)
-		}
-	}
+// Providers are the available providers by name. Which one is used for a
+// platform is set in the providers section of the configuration.
+var Providers = map[string]Provider{
+	"apns": Provider{PushToApn, "apn.max-retries"},
+	"fcm": Provider{PushToFcm, "fcm.max-retries"},
+	"fcm-topic": Provider{PushToFcmTopic, "fcm.max-retries"},
+	"webhook": Provider{PushToWebhook, "webhook.max-retries"},
+	"webpush": Provider{PushToWebPush, "webpush.max-retries"},
 }
 
-func PushToAny(req PushNotification) {
-	QueueNotification <- req
+func providerFor(platform string) (Provider, bool) {
+	name := viper.GetString("providers." + platform)
+	if name == "" {
+		return Provider{}, false
+	}
+	p, ok := Providers[name]
+	return p, ok
 }
 
-func PushToApn(req PushNotification) {
+func PushToApn(req PushNotification) ([]string, error) {
 	ctx.Debug("Pushing iOS notification to APN")
-	
-	var retryCount = 0
-	var retryAfter = 1
-	var maxRetry = viper.GetInt("apn.max-retry")
 
-	if req.Retry > 0 && req.Retry < maxRetry {
-		maxRetry = req.Retry
-	}
-	
-	var isDone = false
-
-	for isDone == false {
-		var toRetryTokens []string
-
-		notification := MakeApnNotification(req)
-
-		for _, token := range req.Tokens {
-			if viper.GetString("core.environment") == "development" {
-				ctx.Infof("I would have sent a %s notification with token %s", req.Platform, token)
-				continue
-			}
+	var (
+		toRetryTokens []string
+		lastErr error
+	)
+	notification := MakeApnNotification(req)
 
-			notification.DeviceToken = token
-			res, err := ApnsClient.Push(notification)
+	for _, token := range req.Tokens {
+		if viper.GetString("core.environment") == "development" {
+			ctx.Infof("I would have sent a %s notification with token %s", req.Platform, token)
+			Stats.RecordDelivered("apns", 1)
+			continue
+		}
 
-			if err != nil {
-				// Maybe write this somewhere?
-				ctx.WithError(err).Error("failed to notify ios")
-				toRetryTokens = append(toRetryTokens, token)
-				continue
-			}
+		notification.DeviceToken = token
+		res, err := ApnsClient.Push(notification)
 
-			if res.Sent() {
-				ctx.Debugf("sent %v", res.ApnsID)
-			} else {
-				// res.Reason are defined:
-				// https://github.com/sideshow/apns2/blob/master/response.go#L14-L105
-				// XXX when we see `ReasonExpiredProviderToken` and
-				// `ReasonBadDeviceToken` we probably want to write this
-				// somewhere and stop trying to send messages to these
-				// devices.
-				ctx.Errorf("failed to send %v %v %v",
-									res.StatusCode,
-									res.ApnsID,
-									res.Reason)
-				toRetryTokens = append(toRetryTokens, token)
-				continue
-			}
+		if err != nil {
+			ctx.WithError(err).Error("failed to notify ios")
+			Stats.RecordFailed("apns", "RequestError", 1)
+			toRetryTokens = append(toRetryTokens, token)
+			lastErr = err
+			continue
 		}
-		if len(toRetryTokens) == 0 || retryCount >= maxRetry {
-			isDone = true
+
+		if res.Sent() {
+			ctx.Debugf("sent %v", res.ApnsID)
+			Stats.RecordDelivered("apns", 1)
+		} else if apnsInvalidTokenReasons[res.Reason] {
+			ctx.WithField("token", token).Warnf("APNs send failed: %s", res.Reason)
+			Stats.RecordFailed("apns", res.Reason, 1)
+			purgeToken("apns", token, res.Reason)
 		} else {
-			time.Sleep(time.Duration(retryAfter) * time.Second)
-			retryAfter = retryAfter*2
-			retryCount++
-			req.Tokens = toRetryTokens
+			// res.Reason are defined:
+			// https://github.com/sideshow/apns2/blob/master/response.go#L14-L105
+			ctx.Errorf("failed to send %v %v %v",
+								res.StatusCode,
+								res.ApnsID,
+								res.Reason)
+			Stats.RecordFailed("apns", failureReason(res.Reason, res.StatusCode), 1)
+			toRetryTokens = append(toRetryTokens, token)
+			lastErr = fmt.Errorf("APNs returned %d %s", res.StatusCode, res.Reason)
+			continue
 		}
 	}
+	return toRetryTokens, lastErr
 }
 
 
+// APNs reasons meaning that the token will never work again. Unregistered
+// comes with a 410 status once the app is uninstalled.
+var apnsInvalidTokenReasons = map[string]bool{
+	apns.ReasonUnregistered: true,
+	apns.ReasonBadDeviceToken: true,
+	apns.ReasonDeviceTokenNotForTopic: true,
+}
+
+// purgeToken stops sending notifications to a token the push service
+// rejected for good
+func purgeToken(channel string, token string, reason string) {
+	if InvalidateToken(DB, token, reason) == nil {
+		Stats.RecordPurged(channel, 1)
+	}
+}
+
 func MakeApnNotification(req PushNotification) *apns.Notification {
 	notification := &apns.Notification{
 		ApnsID: req.ApnsID,
 		Topic:  req.Topic,
+		CollapseID: req.CollapseKey,
 	}
 
 	if len(req.Priority) > 0 && req.Priority == "normal" {
 		notification.Priority = apns.PriorityLow
 	}
+	// APNs rejects background pushes sent with high priority
+	if req.Silent {
+		notification.Priority = apns.PriorityLow
+	}
 
 	payload := payload.NewPayload()
 
 	for k, v := range req.Data {
 		payload.Custom(k, v)
 	}
+	if req.Silent {
+		payload.ContentAvailable()
+	} else if req.Title != "" || req.Body != "" {
+		payload.AlertTitle(req.Title).AlertBody(req.Body)
+	}
 
 	notification.Payload = payload
 
 	return notification
 }
 
-func PushToFcm(req PushNotification) {
+// The FCM API accepts at most 1000 registration ids per message
+// https://firebase.google.com/docs/cloud-messaging/http-server-ref
+const fcmMaxTokens = 1000
+
+// FCM errors after which sending again may succeed
+var fcmRetryableErrors = map[string]bool{
+	"Unavailable": true,
+	"InternalServerError": true,
+	"DeviceMessageRateExceeded": true,
+}
+
+// FCM errors meaning that the token will never work again
+var fcmInvalidTokenErrors = map[string]bool{
+	"NotRegistered": true,
+	"InvalidRegistration": true,
+	"MismatchSenderId": true,
+}
+
+func PushToFcm(req PushNotification) ([]string, error) {
 	ctx.Debug("Pushing Android notification to FCM")
-	
-	var retryCount = 0
-	var retryAfter = 1
-	var maxRetry = viper.GetInt("fcm.max-retry")
 
-	if req.Retry > 0 && req.Retry < maxRetry {
-		maxRetry = req.Retry
+	var (
+		toRetryTokens []string
+		lastErr error
+	)
+	tokens := req.Tokens
+	for len(tokens) > 0 {
+		n := len(tokens)
+		if n > fcmMaxTokens {
+			n = fcmMaxTokens
+		}
+		chunk := req
+		chunk.Tokens = tokens[:n]
+		failed, err := pushFcmChunk(chunk)
+		if len(failed) > 0 {
+			toRetryTokens = append(toRetryTokens, failed...)
+			if _, ok := lastErr.(permanentError); !ok {
+				lastErr = err
+			}
+		}
+		tokens = tokens[n:]
+	}
+	return toRetryTokens, lastErr
+}
+
+func pushFcmChunk(req PushNotification) ([]string, error) {
+	var toRetryTokens []string
+	var lastErr error
+
+	if viper.GetString("core.environment") == "development" {
+		ctx.Infof("I would have sent a %s notification with token %v", req.Platform, req.Tokens)
+		Stats.RecordDelivered("fcm", len(req.Tokens))
+		return nil, nil
+	}
+
+	notification := MakeFcmNotification(req)
+	res, err := notification.Send()
+	if err != nil {
+		ctx.WithError(err).Error("failed to notify")
+		Stats.RecordFailed("fcm", "RequestError", len(req.Tokens))
+		return req.Tokens, err
+	}
+	if res.StatusCode >= 500 {
+		ctx.Errorf("FCM is unavailable (status: %d)", res.StatusCode)
+		Stats.RecordFailed("fcm", failureReason("", res.StatusCode), len(req.Tokens))
+		return req.Tokens, fmt.Errorf("FCM is unavailable (status: %d)",
+										res.StatusCode)
 	}
-	
-	var isDone = false
+	if res.StatusCode != 200 {
+		// e.g. 401 when the server key is wrong, retrying won't help
+		ctx.Errorf("FCM rejected the request (status: %d)",
+					res.StatusCode)
+		Stats.RecordFailed("fcm", failureReason("", res.StatusCode), len(req.Tokens))
+		return req.Tokens, permanentError{
+			fmt.Errorf("FCM rejected the request (status: %d)", res.StatusCode)}
+	}
+	for k, result := range res.Results {
+		token := req.Tokens[k]
+		fcmErr := result["error"]
+		switch {
+		case fcmErr == "":
+			ctx.WithFields(log.Fields{
+				"token": token,
+				"message_id": result["message_id"],
+			}).Info("sent FCM notification")
+			Stats.RecordDelivered("fcm", 1)
+			if newToken := result["registration_id"]; newToken != "" {
+				ReplaceToken(DB, token, newToken)
+			}
+		case fcmRetryableErrors[fcmErr]:
+			ctx.WithField("token", token).Warnf("FCM send failed: %s", fcmErr)
+			Stats.RecordFailed("fcm", fcmErr, 1)
+			toRetryTokens = append(toRetryTokens, token)
+			lastErr = errors.New(fcmErr)
+		case fcmInvalidTokenErrors[fcmErr]:
+			ctx.WithField("token", token).Warnf("FCM send failed: %s", fcmErr)
+			Stats.RecordFailed("fcm", fcmErr, 1)
+			purgeToken("fcm", token, fcmErr)
+		default:
+			ctx.WithField("token", token).Errorf("FCM send failed: %s", fcmErr)
+			Stats.RecordFailed("fcm", fcmErr, 1)
+		}
+	}
+	return toRetryTokens, lastErr
+}
 
-	for isDone == false {
-		var toRetryTokens []string
+// PushToFcmTopic broadcasts the notification to the devices subscribed to
+// the FCM topics in Tokens, e.g. "country-IR". Apps subscribe to their
+// topics themselves.
+func PushToFcmTopic(req PushNotification) ([]string, error) {
+	ctx.Debug("Pushing notification to FCM topics")
 
-		notification := MakeFcmNotification(req)
+	var (
+		toRetryTopics []string
+		lastErr error
+	)
+	for _, topic := range req.Tokens {
 		if viper.GetString("core.environment") == "development" {
-			ctx.Infof("I would have sent a %s notification with token %v", req.Platform, req.Tokens)
-			isDone = true
-			break
+			ctx.Infof("I would have sent a notification to topic %s", topic)
+			Stats.RecordDelivered("fcm-topic", 1)
+			continue
 		}
 
+		notification := MakeFcmNotification(req)
+		notification.Message.RegistrationIds = nil
+		notification.NewFcmMsgTo("/topics/" + topic, req.Data)
 		res, err := notification.Send()
-		if err == nil {
-			isDone = true
-			break
-		} else {
-			ctx.WithError(err).Error("failed to notify")
-			for k, result := range res.Results {
-				if result["Error"] != "" {
-					toRetryTokens = append(toRetryTokens, req.Tokens[k])
-				}
-			}
+		if err != nil {
+			ctx.WithError(err).Errorf("failed to notify topic %s", topic)
+			Stats.RecordFailed("fcm-topic", "RequestError", 1)
+			toRetryTopics = append(toRetryTopics, topic)
+			lastErr = err
+			continue
 		}
-		if len(toRetryTokens) == 0 || retryCount >= maxRetry {
-			isDone = true
-		} else {
-			time.Sleep(time.Duration(retryAfter) * time.Second)
-			retryAfter = retryAfter*2
-			retryCount++
-			req.Tokens = toRetryTokens
+		if res.StatusCode >= 500 || fcmRetryableErrors[res.Err] {
+			ctx.Errorf("FCM failed to send to topic %s (status: %d, error: %s)",
+						topic, res.StatusCode, res.Err)
+			Stats.RecordFailed("fcm-topic", failureReason(res.Err, res.StatusCode), 1)
+			toRetryTopics = append(toRetryTopics, topic)
+			lastErr = fmt.Errorf("FCM failed (status: %d, error: %s)",
+								res.StatusCode, res.Err)
+			continue
+		}
+		if res.StatusCode != 200 || res.Err != "" {
+			ctx.Errorf("FCM rejected the topic %s (status: %d, error: %s)",
+						topic, res.StatusCode, res.Err)
+			Stats.RecordFailed("fcm-topic", failureReason(res.Err, res.StatusCode), 1)
+			return req.Tokens, permanentError{
+				fmt.Errorf("FCM rejected the request (status: %d, error: %s)",
+							res.StatusCode, res.Err)}
 		}
+		ctx.WithFields(log.Fields{
+			"topic": topic,
+			"message_id": res.MsgId,
+		}).Info("sent FCM topic notification")
+		Stats.RecordDelivered("fcm-topic", 1)
 	}
+	return toRetryTopics, lastErr
 }
 
 func MakeFcmNotification(req PushNotification) *fcm.FcmClient {
-	// XXX the FCM API only supports up to 1k devices. We should have checks
-	// for that here and split them up into < 1000 chunks
-	// https://firebase.google.com/docs/cloud-messaging/http-server-ref
-	// 1000 devices
-
 	notification := fcm.NewFcmClient(viper.GetString("fcm.server-key"))
+	// Data messages are delivered to the app even when it is in the
+	// background, which is what wakes up the probe to fetch its tasks.
+	// Note that "to" can't be combined with the registration ids.
 	notification.NewFcmRegIdsMsg(req.Tokens, req.Data)
-	notification.Message.To = req.Topic
 
 	if len(req.Priority) > 0 {
 		notification.SetPriority(req.Priority)
 	}
+	if req.TimeToLive > 0 {
+		notification.SetTimeToLive(req.TimeToLive)
+	}
+	if req.CollapseKey != "" {
+		notification.SetCollapseKey(req.CollapseKey)
+	}
+	if req.Silent {
+		// Data messages are delivered to the app without showing anything,
+		// content_available wakes up the iOS apps using FCM
+		notification.SetContentAvailable(true)
+	} else if req.Title != "" || req.Body != "" {
+		notification.SetNotificationPayload(&fcm.NotificationPayload{
+			Title: req.Title,
+			Body: req.Body,
+		})
+	}
 
 	return notification
 }
+
+// PushToWebhook notifies probes by POSTing the notification data to their
+// callback URL, signed with the secret they registered.
+func PushToWebhook(req PushNotification) ([]string, error) {
+	ctx.Debug("Pushing notification to webhook")
+
+	body, err := json.Marshal(req.Data)
+	if err != nil {
+		ctx.WithError(err).Error("failed to marshal webhook notification")
+		Stats.RecordFailed("webhook", "InvalidPayload", len(req.Tokens))
+		return req.Tokens, permanentError{err}
+	}
+
+	var (
+		toRetryURLs []string
+		lastErr error
+	)
+	client := &http.Client{Timeout: viper.GetDuration("webhook.timeout")}
+	for _, callbackURL := range req.Tokens {
+		if viper.GetString("core.environment") == "development" {
+			ctx.Infof("I would have sent a webhook notification to %s", callbackURL)
+			Stats.RecordDelivered("webhook", 1)
+			continue
+		}
+		httpReq, err := http.NewRequest("POST", callbackURL, bytes.NewBuffer(body))
+		if err != nil {
+			ctx.WithError(err).Errorf("invalid callback url %s", callbackURL)
+			Stats.RecordFailed("webhook", "InvalidURL", 1)
+			continue
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if req.Secret != "" {
+			httpReq.Header.Set(webhook.SignatureHeader,
+								webhook.Sign(req.Secret, body))
+		}
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			ctx.WithError(err).Errorf("webhook to %s failed", callbackURL)
+			Stats.RecordFailed("webhook", "RequestError", 1)
+			toRetryURLs = append(toRetryURLs, callbackURL)
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			ctx.Errorf("webhook to %s returned %d", callbackURL, resp.StatusCode)
+			Stats.RecordFailed("webhook", failureReason("", resp.StatusCode), 1)
+			toRetryURLs = append(toRetryURLs, callbackURL)
+			lastErr = fmt.Errorf("webhook returned %d", resp.StatusCode)
+			continue
+		}
+		ctx.Debugf("sent webhook to %s", callbackURL)
+		Stats.RecordDelivered("webhook", 1)
+	}
+	return toRetryURLs, lastErr
+}
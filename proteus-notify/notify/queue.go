@@ -0,0 +1,471 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/schema"
+	"github.com/thetorproject/proteus/proteus-common/secrets"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"github.com/satori/go.uuid"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+const (
+	NotificationPending = "pending"
+	NotificationSent = "sent"
+	NotificationDead = "dead"
+)
+
+// A worker that crashes while sending leaves the notification claimed, it
+// is picked up again once the claim expires.
+const claimTimeout = 10 * time.Minute
+
+// permanentError is returned by providers when sending again won't help
+type permanentError struct {
+	error
+}
+
+// DeadNotification is a notification we gave up on
+type DeadNotification struct {
+	Id				string		`json:"id"`
+	Platform		string		`json:"platform"`
+	Tokens			[]string	`json:"tokens"`
+	Attempts		int			`json:"attempts"`
+	LastError		string		`json:"last_error"`
+	CreationTime	time.Time	`json:"creation_time"`
+	LastUpdated		time.Time	`json:"last_updated"`
+}
+
+// Wakes up an idle worker when a notification is enqueued
+var wakeup chan bool
+
+// QueuedChannel is the postgres channel on which the notifications table
+// trigger announces the notifications enqueued by any instance.
+const QueuedChannel = "proteus_notification_queued"
+
+func newMigrator(db *sql.DB) *schema.Migrator {
+	return schema.NewMigrator(db, viper.GetString("database.schema-version-table"),
+								Asset, AssetDir)
+}
+
+// OpenMigrator connects to the database for the migrate command
+func OpenMigrator() (*schema.Migrator, error) {
+	err := secrets.Load()
+	if err != nil {
+		return nil, err
+	}
+	db, err := initDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db), nil
+}
+
+// runMigrations checks the schema of the database, and brings it up to date
+func runMigrations(db *sql.DB) (error) {
+	return newMigrator(db).Startup()
+}
+
+func InitWorkers(workerNum int) {
+	ctx.Debugf("worker number: %d", workerNum)
+	InitRateLimiters()
+	wakeup = make(chan bool, workerNum)
+	for i := 0; i < workerNum; i++ {
+		go startWorker()
+	}
+}
+
+// ListenForQueued wakes up an idle worker whenever a notification is
+// enqueued, by this instance or another one, so that the workers only poll
+// for the notifications whose backoff expired.
+func ListenForQueued(dbUrl string) (*pq.Listener, error) {
+	listener := pq.NewListener(dbUrl,
+								10 * time.Second,
+								time.Minute,
+								func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			ctx.WithError(err).Error("queue listener error")
+		}
+	})
+	if err := listener.Listen(QueuedChannel); err != nil {
+		ctx.WithError(err).Error("failed to listen for queued notifications")
+		listener.Close()
+		return nil, err
+	}
+	go func() {
+		// A nil notification means the connection was re-established,
+		// waking up a worker catches up on what we missed
+		for range listener.Notify {
+			select {
+			case wakeup <- true:
+			default:
+			}
+		}
+	}()
+	return listener, nil
+}
+
+func startWorker() {
+	for {
+		id, notification, attempts, err := claimNotification(DB)
+		if err == sql.ErrNoRows {
+			select {
+			case <-wakeup:
+			case <-time.After(viper.GetDuration("queue.poll-interval")):
+			}
+			continue
+		}
+		if err != nil {
+			ctx.WithError(err).Error("failed to claim notification")
+			time.Sleep(viper.GetDuration("queue.poll-interval"))
+			continue
+		}
+		deliver(id, notification, attempts)
+	}
+}
+
+// PushToAny stores the notification so that it is delivered by the workers.
+// Notifications with a collapse key wait for the batch window, so that
+// others for the same devices are merged into a single push.
+func PushToAny(req PushNotification) error {
+	tokens := req.Tokens
+	req.Tokens = nil
+	if req.TaskIDs == nil {
+		// Merged notifications concatenate their lists
+		req.TaskIDs = []string{}
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	if req.CollapseKey != "" {
+		merged, err := mergeNotification(req.Platform, tokens, req)
+		if err != nil {
+			return err
+		}
+		if merged {
+			return nil
+		}
+	}
+
+	now := time.Now().UTC()
+	nextAttemptAt := now
+	if req.CollapseKey != "" {
+		nextAttemptAt = now.Add(viper.GetDuration("queue.batch-window"))
+	}
+	if req.NotBefore.After(nextAttemptAt) {
+		nextAttemptAt = req.NotBefore
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (
+		id, platform, tokens, payload, state, attempts,
+		collapse_key, next_attempt_at, creation_time, last_updated
+	) VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $8)`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	_, err = DB.Exec(query, uuid.NewV4().String(), req.Platform,
+					pq.Array(tokens), payload, NotificationPending,
+					req.CollapseKey, nextAttemptAt, now)
+	if err != nil {
+		ctx.WithError(err).Error("failed to enqueue notification")
+		return err
+	}
+
+	select {
+	case wakeup <- true:
+	default:
+		// All the workers are busy, they will get to it
+	}
+	return nil
+}
+
+// mergeInto folds the notification into a queued one with the same
+// collapse key and devices. The devices only need to be woken up once, the
+// newest data wins and the tasks of both are moved to notified on delivery.
+// Notifications deferred to different times are never merged, that would
+// send one of them outside of its quiet hours or notification window.
+func mergeInto(queued PushNotification, req PushNotification) (PushNotification, bool) {
+	if queued.DryRun != req.DryRun || queued.Silent != req.Silent ||
+			!queued.NotBefore.Equal(req.NotBefore) {
+		return queued, false
+	}
+	merged := req
+	merged.TaskIDs = append(append([]string{}, queued.TaskIDs...), req.TaskIDs...)
+	return merged, true
+}
+
+// mergeNotification folds the notification into the first one waiting to be
+// sent to the same devices it can be merged into. Returns false if there was
+// nothing to merge into.
+func mergeNotification(platform string, tokens []string,
+						req PushNotification) (bool, error) {
+	type queuedRow struct {
+		id		string
+		payload	[]byte
+	}
+	tblName := pq.QuoteIdentifier(viper.GetString("database.notifications-table"))
+	tx, err := DB.Begin()
+	if err != nil {
+		ctx.WithError(err).Error("failed to open transaction")
+		return false, err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`SELECT id, payload FROM %s
+		WHERE state = $1 AND attempts = 0 AND
+		platform = $2 AND tokens = $3 AND collapse_key = $4
+		ORDER BY creation_time
+		FOR UPDATE SKIP LOCKED`,
+		tblName)
+	rows, err := tx.Query(query, NotificationPending, platform,
+						pq.Array(tokens), req.CollapseKey)
+	if err != nil {
+		ctx.WithError(err).Error("failed to look up notifications to merge into")
+		return false, err
+	}
+	var queued []queuedRow
+	for rows.Next() {
+		var r queuedRow
+		if err = rows.Scan(&r.id, &r.payload); err != nil {
+			rows.Close()
+			ctx.WithError(err).Error("failed to iterate over notifications")
+			return false, err
+		}
+		queued = append(queued, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		ctx.WithError(err).Error("failed to iterate over notifications")
+		return false, err
+	}
+
+	for _, r := range queued {
+		var notification PushNotification
+		if err = json.Unmarshal(r.payload, &notification); err != nil {
+			ctx.WithError(err).Errorf("invalid payload of notification %s", r.id)
+			continue
+		}
+		merged, ok := mergeInto(notification, req)
+		if !ok {
+			continue
+		}
+		payload, err := json.Marshal(merged)
+		if err != nil {
+			return false, err
+		}
+		query = fmt.Sprintf(`UPDATE %s SET payload = $1, last_updated = $2
+			WHERE id = $3`,
+			tblName)
+		_, err = tx.Exec(query, string(payload), time.Now().UTC(), r.id)
+		if err != nil {
+			ctx.WithError(err).Error("failed to merge notification")
+			return false, err
+		}
+		if err = tx.Commit(); err != nil {
+			ctx.WithError(err).Error("failed to commit merged notification")
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// claimNotification takes the next pending notification that is due and
+// pushes its next attempt forward, so that no other worker takes it.
+func claimNotification(db *sql.DB) (string, PushNotification, int, error) {
+	var (
+		id string
+		notification PushNotification
+		payload []byte
+		attempts int
+	)
+	tblName := pq.QuoteIdentifier(viper.GetString("database.notifications-table"))
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s
+		SET attempts = attempts + 1, next_attempt_at = $1, last_updated = $2
+		WHERE id = (
+			SELECT id FROM %s
+			WHERE state = $3 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, platform, tokens, payload, attempts, creation_time`,
+		tblName, tblName)
+	err := db.QueryRow(query, now.Add(claimTimeout), now,
+						NotificationPending).Scan(
+						&id, &notification.Platform,
+						pq.Array(&notification.Tokens), &payload, &attempts,
+						&notification.QueuedAt)
+	if err != nil {
+		return id, notification, attempts, err
+	}
+	tokens := notification.Tokens
+	if err = json.Unmarshal(payload, &notification); err != nil {
+		return id, notification, attempts, err
+	}
+	notification.Tokens = tokens
+	return id, notification, attempts, nil
+}
+
+func deliver(id string, notification PushNotification, attempts int) {
+	provider, ok := providerFor(notification.Platform)
+	if isDryRun(notification) {
+		provider, ok = Provider{PushToSink, "dry-run.max-retries"}, true
+	}
+	if !ok {
+		ctx.Errorf("unsupported platform %s", notification.Platform)
+		updateNotification(id, NotificationDead, notification.Tokens,
+			fmt.Sprintf("unsupported platform %s", notification.Platform),
+			time.Now().UTC())
+		return
+	}
+
+	// Every device notified takes from both the global and the provider's
+	// rate limits, so that big campaigns don't trip the abuse limits of
+	// the push services.
+	channel := viper.GetString("providers." + notification.Platform)
+	if !isDryRun(notification) {
+		globalLimiter.Wait(len(notification.Tokens))
+		providerLimiters[channel].Wait(len(notification.Tokens))
+		Stats.RecordSent(channel, len(notification.Tokens))
+	}
+
+	failed, err := provider.Push(notification)
+	if len(failed) == 0 {
+		now := time.Now().UTC()
+		if !isDryRun(notification) {
+			Stats.RecordLatency(channel, now.Sub(notification.QueuedAt))
+		}
+		updateNotification(id, NotificationSent, nil, "", now)
+		ReportTasksNotified(notification.TaskIDs)
+		return
+	}
+	if err == nil {
+		err = errors.New("unknown error")
+	}
+
+	var maxRetry = viper.GetInt(provider.MaxRetriesKey)
+	if notification.Retry > 0 && notification.Retry < maxRetry {
+		maxRetry = notification.Retry
+	}
+	_, isPermanent := err.(permanentError)
+	if isPermanent || attempts > maxRetry {
+		ctx.WithError(err).Errorf("giving up on notification %s", id)
+		updateNotification(id, NotificationDead, failed, err.Error(),
+							time.Now().UTC())
+		return
+	}
+	updateNotification(id, NotificationPending, failed, err.Error(),
+						time.Now().UTC().Add(retryBackoff(attempts)))
+}
+
+// retryBackoff doubles the time we wait after every failed attempt
+func retryBackoff(attempts int) time.Duration {
+	backoff := viper.GetDuration("queue.backoff")
+	maxBackoff := viper.GetDuration("queue.max-backoff")
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// updateNotification records the outcome of an attempt. The tokens are
+// the ones still left to notify.
+func updateNotification(id string, state string, tokens []string,
+						lastError string, nextAttemptAt time.Time) {
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $2, tokens = COALESCE($3, tokens), last_error = $4,
+		next_attempt_at = $5, last_updated = $6
+		WHERE id = $1`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	var tokensArg interface{}
+	if tokens != nil {
+		tokensArg = pq.Array(tokens)
+	}
+	_, err := DB.Exec(query, id, state, tokensArg, lastError,
+						nextAttemptAt, time.Now().UTC())
+	if err != nil {
+		ctx.WithError(err).Errorf("failed to update notification %s", id)
+	}
+}
+
+// CountRecentNotifications returns how many notifications to the token were
+// queued since the given time. Notifications merged into one count once.
+func CountRecentNotifications(db *sql.DB, token string, since time.Time) (int64, error) {
+	var count int64
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s
+		WHERE tokens @> ARRAY[$1]::VARCHAR[] AND creation_time >= $2 AND
+		state != $3`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	err := db.QueryRow(query, token, since, NotificationDead).Scan(&count)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count recent notifications")
+	}
+	return count, err
+}
+
+// ListDeadNotifications returns the notifications we gave up on, the most
+// recent first.
+func ListDeadNotifications(db *sql.DB) ([]DeadNotification, error) {
+	var notifications = make([]DeadNotification, 0)
+	query := fmt.Sprintf(`SELECT
+		id, platform, tokens, attempts, COALESCE(last_error, ''),
+		creation_time, last_updated
+		FROM %s WHERE state = $1
+		ORDER BY last_updated DESC`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	rows, err := db.Query(query, NotificationDead)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list dead notifications")
+		return notifications, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n DeadNotification
+		err = rows.Scan(&n.Id, &n.Platform, pq.Array(&n.Tokens), &n.Attempts,
+						&n.LastError, &n.CreationTime, &n.LastUpdated)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over dead notifications")
+			return notifications, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// RetryNotification puts a dead notification back in the queue with a
+// fresh set of attempts.
+func RetryNotification(db *sql.DB, id string) error {
+	now := time.Now().UTC()
+	query := fmt.Sprintf(`UPDATE %s SET
+		state = $2, attempts = 0, next_attempt_at = $3, last_updated = $3
+		WHERE id = $1 AND state = $4`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	res, err := db.Exec(query, id, NotificationPending, now, NotificationDead)
+	if err != nil {
+		ctx.WithError(err).Error("failed to retry notification")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotificationNotFound
+	}
+
+	select {
+	case wakeup <- true:
+	default:
+	}
+	return nil
+}
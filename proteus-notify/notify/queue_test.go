@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeInto(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	queued := PushNotification{CollapseKey: "tasks", TaskIDs: []string{"t1"},
+								Data: map[string]interface{}{"n": 1}}
+	req := PushNotification{CollapseKey: "tasks", TaskIDs: []string{"t2"},
+							Data: map[string]interface{}{"n": 2}}
+
+	merged, ok := mergeInto(queued, req)
+	if !ok {
+		t.Fatal("expected the notifications to be merged")
+	}
+	if !reflect.DeepEqual(merged.TaskIDs, []string{"t1", "t2"}) {
+		t.Errorf("expected the tasks of both (got: %v)", merged.TaskIDs)
+	}
+	if merged.Data["n"] != 2 {
+		t.Errorf("expected the newest data to win (got: %v)", merged.Data)
+	}
+
+	// Held until the end of the quiet hours, it can't go out now
+	held := req
+	held.NotBefore = now.Add(8 * time.Hour)
+	if _, ok = mergeInto(queued, held); ok {
+		t.Error("expected a deferred push not to merge into a due one")
+	}
+	if _, ok = mergeInto(held, queued); ok {
+		t.Error("expected a due push not to merge into a deferred one")
+	}
+	// Deferred to the same slot, in another time zone
+	later := held
+	later.NotBefore = held.NotBefore.In(time.FixedZone("IRST", 12600))
+	if _, ok = mergeInto(held, later); !ok {
+		t.Error("expected pushes deferred to the same time to be merged")
+	}
+
+	silent := req
+	silent.Silent = true
+	if _, ok = mergeInto(queued, silent); ok {
+		t.Error("expected a silent push not to merge into a visible one")
+	}
+}
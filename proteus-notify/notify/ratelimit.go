@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RateLimiter is a token bucket refilled at Rate tokens per second up to
+// Burst tokens. Sending to a device takes a token, when there are none left
+// the workers wait, so that the queue drains at the configured rate.
+type RateLimiter struct {
+	Rate	float64
+	Burst	float64
+
+	mu		sync.Mutex
+	tokens	float64
+	last	time.Time
+}
+
+func NewRateLimiter(rate float64, burst float64) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		Rate: rate,
+		Burst: burst,
+		tokens: burst,
+	}
+}
+
+// reserve takes n tokens at time now and returns how long to wait before
+// using them. Taking more tokens than there are leaves the bucket in debt,
+// which is paid back before anyone else is let through.
+func (l *RateLimiter) reserve(n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.Rate
+		if l.tokens > l.Burst {
+			l.tokens = l.Burst
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.Rate * float64(time.Second))
+}
+
+// Wait blocks until n devices can be notified. A nil or zero rate limiter
+// never waits.
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || l.Rate <= 0 {
+		return
+	}
+	if wait := l.reserve(n, time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+var (
+	globalLimiter *RateLimiter
+	providerLimiters map[string]*RateLimiter
+)
+
+// InitRateLimiters sets up the limiter shared by all the providers and the
+// ones of each provider from the rate-limit section of the configuration.
+func InitRateLimiters() {
+	globalLimiter = NewRateLimiter(viper.GetFloat64("rate-limit.rate"),
+									viper.GetFloat64("rate-limit.burst"))
+	providerLimiters = map[string]*RateLimiter{}
+	for name := range Providers {
+		key := "rate-limit." + name
+		if !viper.IsSet(key + ".rate") {
+			continue
+		}
+		providerLimiters[name] = NewRateLimiter(
+									viper.GetFloat64(key + ".rate"),
+									viper.GetFloat64(key + ".burst"))
+	}
+}
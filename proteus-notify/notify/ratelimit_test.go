@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := NewRateLimiter(10, 5)
+	now := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// The burst goes through straight away
+	if wait := l.reserve(5, now); wait != 0 {
+		t.Errorf("expected no wait (got: %s)", wait)
+	}
+	// Then we go at 10 per second
+	if wait := l.reserve(1, now); wait != 100*time.Millisecond {
+		t.Errorf("expected 100ms (got: %s)", wait)
+	}
+	// More than the burst is paid back before the next ones
+	if wait := l.reserve(20, now.Add(100*time.Millisecond)); wait != 2*time.Second {
+		t.Errorf("expected 2s (got: %s)", wait)
+	}
+	// An idle limiter refills up to the burst only
+	if wait := l.reserve(5, now.Add(time.Hour)); wait != 0 {
+		t.Errorf("expected no wait (got: %s)", wait)
+	}
+	if wait := l.reserve(1, now.Add(time.Hour)); wait != 100*time.Millisecond {
+		t.Errorf("expected 100ms (got: %s)", wait)
+	}
+
+	var unlimited *RateLimiter
+	unlimited.Wait(1000)
+}
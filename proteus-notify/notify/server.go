@@ -1,13 +1,24 @@
 package notify
 
 import (
+	"bytes"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/url"
 	"database/sql"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/thetorproject/proteus/proteus-common/autotls"
+	"github.com/thetorproject/proteus/proteus-common/secrets"
+	"github.com/thetorproject/proteus/proteus-common/dbconn"
+	"github.com/thetorproject/proteus/proteus-common/quiethours"
+	"github.com/thetorproject/proteus/proteus-common/middleware"
 	"github.com/spf13/viper"
-	"gopkg.in/gin-gonic/gin.v1"
+	"github.com/gin-gonic/gin"
 	"github.com/facebookgo/grace/gracehttp"
 )
 
@@ -23,52 +34,322 @@ type NotifyReq struct {
 	ClientIDs []string `json:"client_ids" binding:"required"`
 	Priority string `json:"priority"`
 	Event map[string]interface {} `json:"event"`
+	// Moved to notified once the notification is delivered
+	TaskIDs []string `json:"task_ids"`
+	CollapseKey string `json:"collapse_key"`
+	DryRun bool `json:"dry_run"`
+	Silent bool `json:"silent"`
+	// "HH:MM-HH:MM" window of the day of the devices they are notified in
+	NotificationWindow string `json:"notification_window"`
+}
+
+// BroadcastReq pushes an event to all the devices subscribed to a topic,
+// without looking up any client.
+type BroadcastReq struct {
+	Topic string `json:"topic" binding:"required"`
+	Priority string `json:"priority"`
+	Event map[string]interface {} `json:"event"`
 }
 
 type TokenPlatform struct {
 	Token string
+	// Set once the push service told us the token is no longer valid
+	TokenInvalid bool
 	Platform string
+	CallbackURL string
+	CallbackSecret string
+	WebPushEndpoint string
+	WebPushP256dh string
+	WebPushAuth string
+	Locale string
+	Timezone string
+	QuietHours string
+	NetworkType string
+	// The preferences of the device
+	WifiOnly bool
+	MaxPerDay int64
+	Categories []string
+}
+
+// address is where the notifications of the device are sent to, and what
+// they are recorded with
+func (tp TokenPlatform) address() string {
+	if tp.CallbackURL != "" {
+		return tp.CallbackURL
+	}
+	if tp.WebPushEndpoint != "" {
+		return tp.WebPushEndpoint
+	}
+	return tp.Token
 }
 
 func GetClientTokenPlatform(db *sql.DB, clientID string) (TokenPlatform, error) {
 	var tp TokenPlatform
-	query := fmt.Sprintf(`SELECT token, platform FROM %s WHERE id = $1`,
+	query := fmt.Sprintf(`SELECT
+		COALESCE(token, ''), token_invalid_since IS NOT NULL, platform,
+		COALESCE(callback_url, ''), COALESCE(callback_secret, ''),
+		COALESCE(webpush_endpoint, ''), COALESCE(webpush_p256dh, ''),
+		COALESCE(webpush_auth, ''),
+		COALESCE(locale, ''),
+		COALESCE(timezone, ''), COALESCE(quiet_hours, ''),
+		COALESCE(network_type, ''),
+		COALESCE(notify_wifi_only, FALSE), COALESCE(notify_max_per_day, 0),
+		COALESCE(notify_categories, '{}')
+		FROM %s WHERE id = $1`,
 				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
-	err := db.QueryRow(query, clientID).Scan(&tp.Token, &tp.Platform)
+	err := db.QueryRow(query, clientID).Scan(&tp.Token, &tp.TokenInvalid, &tp.Platform,
+											&tp.CallbackURL, &tp.CallbackSecret,
+											&tp.WebPushEndpoint, &tp.WebPushP256dh,
+											&tp.WebPushAuth,
+											&tp.Locale,
+											&tp.Timezone, &tp.QuietHours,
+											&tp.NetworkType,
+											&tp.WifiOnly, &tp.MaxPerDay,
+											pq.Array(&tp.Categories))
 	ctx.Debugf("found %s, %s", tp.Token, tp.Platform)
 	// The caller is responsible for checking the error
 	return tp, err
 }
 
-func initDatabase() (*sql.DB, error) {
-	db, err := sql.Open("postgres", viper.GetString("database.url"))
+// InvalidateToken marks a token the push service told us is no longer
+// valid, e.g. because the app was uninstalled, so that we stop sending
+// notifications to it until the probe registers a new one. The token is also
+// dropped from the notifications waiting to be sent.
+func InvalidateToken(db *sql.DB, token string, reason string) error {
+	query := fmt.Sprintf(`UPDATE %s SET
+		token_invalid_since = $2, token_invalid_reason = $3
+		WHERE token = $1 AND token_invalid_since IS NULL`,
+				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	_, err := db.Exec(query, token, time.Now().UTC(), reason)
+	if err != nil {
+		ctx.WithError(err).Error("failed to invalidate token")
+		return err
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET
+		tokens = array_remove(tokens, $1::VARCHAR), last_updated = $2
+		WHERE state = $3 AND tokens @> ARRAY[$1]::VARCHAR[]`,
+				pq.QuoteIdentifier(viper.GetString("database.notifications-table")))
+	_, err = db.Exec(query, token, time.Now().UTC(), NotificationPending)
 	if err != nil {
-		ctx.Error("failed to open database")
-		return nil, err
+		ctx.WithError(err).Error("failed to drop invalid token from queue")
 	}
-	return db, err
+	return err
 }
 
-func MakeNotifications(db *sql.DB, req NotifyReq) ([]PushNotification, error) {
-	var notifications []PushNotification
+// InvalidTokenCount is how many devices of a platform had their token
+// invalidated for a reason
+type InvalidTokenCount struct {
+	Platform	string `json:"platform"`
+	Reason		string `json:"reason"`
+	Count		int64 `json:"count"`
+}
+
+// CountInvalidTokens returns how many tokens were purged by platform and
+// reason
+func CountInvalidTokens(db *sql.DB) ([]InvalidTokenCount, error) {
+	var counts = make([]InvalidTokenCount, 0)
+	query := fmt.Sprintf(`SELECT
+		COALESCE(platform, ''), COALESCE(token_invalid_reason, ''), COUNT(*)
+		FROM %s WHERE token_invalid_since IS NOT NULL
+		GROUP BY 1, 2
+		ORDER BY 3 DESC`,
+				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	rows, err := db.Query(query)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count invalid tokens")
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c InvalidTokenCount
+		if err = rows.Scan(&c.Platform, &c.Reason, &c.Count); err != nil {
+			ctx.WithError(err).Error("failed to iterate over invalid tokens")
+			return counts, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// ReplaceToken stores the canonical token the push service told us to use
+// instead of the one we have.
+func ReplaceToken(db *sql.DB, token string, newToken string) error {
+	query := fmt.Sprintf(`UPDATE %s SET token = $2 WHERE token = $1`,
+				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	_, err := db.Exec(query, token, newToken)
+	if err != nil {
+		ctx.WithError(err).Error("failed to replace token")
+	}
+	return err
+}
+
+// NotifiedReq tells proteus-events that the push of the tasks was delivered
+// XXX this is duplicated in proteus-events
+type NotifiedReq struct {
+	TaskIDs []string `json:"task_ids"`
+}
+
+// ReportTasksNotified asks proteus-events to move the tasks a delivered
+// notification was about to notified. Nothing is retried, the tasks are
+// moved as well when the probe fetches them.
+func ReportTasksNotified(taskIDs []string) error {
+	if len(taskIDs) == 0 || viper.GetString("core.events-url") == "" {
+		return nil
+	}
+	baseUrl, err := url.Parse(viper.GetString("core.events-url"))
+	if err != nil {
+		ctx.WithError(err).Error("invalid events url")
+		return err
+	}
+	path, _ := url.Parse("/api/v1/internal/tasks/notified")
+	body, err := json.Marshal(NotifiedReq{TaskIDs: taskIDs})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: viper.GetDuration("core.events-timeout")}
+	resp, err := client.Post(baseUrl.ResolveReference(path).String(),
+								"application/json", bytes.NewBuffer(body))
+	if err != nil {
+		ctx.WithError(err).Error("failed to report the notified tasks")
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		ctx.Errorf("failed to report the notified tasks: %s", resp.Status)
+		return fmt.Errorf("events returned %s", resp.Status)
+	}
+	return nil
+}
+
+// WantsNotification tells if the preferences of the device allow pushing
+// the event to it. Skipped tasks are still found by the probe when it
+// fetches its task list.
+func WantsNotification(db *sql.DB, tp TokenPlatform,
+						event map[string]interface{}) bool {
+	if tp.WifiOnly && tp.NetworkType != "wifi" {
+		return false
+	}
+	if category, ok := event["category"].(string); ok && len(tp.Categories) > 0 {
+		found := false
+		for _, c := range tp.Categories {
+			if c == category {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if tp.MaxPerDay > 0 {
+		count, err := CountRecentNotifications(db, tp.address(),
+								time.Now().UTC().Add(-24 * time.Hour))
+		if err != nil {
+			// Better to notify too much than to not notify at all
+			return true
+		}
+		if count >= tp.MaxPerDay {
+			return false
+		}
+	}
+	return true
+}
 
-	androidNotification := PushNotification{
-		Topic:"ooni/orchestrate",
-		Priority:req.Priority,
-		Retry:5,
-		Platform:"android",
+// QuietUntil returns when the quiet hours of the probe are over if it is in
+// them at time now, the zero time otherwise. Probes that only told us their
+// timezone get the default quiet hours.
+func QuietUntil(tp TokenPlatform, now time.Time) time.Time {
+	qh := tp.QuietHours
+	if qh == "" {
+		qh = viper.GetString("quiet-hours.default")
 	}
-	androidNotification.Data = req.Event
-	iosNotification := PushNotification{
-		Topic:"ooni/orchestrate",
-		Priority:req.Priority,
-		Retry:5,
-		Platform:"ios",
+	if qh == "" || tp.Timezone == "" {
+		return time.Time{}
 	}
-	iosNotification.Data = req.Event
+	q, err := quiethours.Parse(qh)
+	if err != nil {
+		ctx.WithError(err).Warnf("ignoring quiet hours %s", qh)
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(tp.Timezone)
+	if err != nil {
+		ctx.WithError(err).Warnf("ignoring timezone %s", tp.Timezone)
+		return time.Time{}
+	}
+	until := q.Until(now, loc)
+	if until.Equal(now) {
+		return time.Time{}
+	}
+	return until.UTC()
+}
+
+// notBeforeFor returns when the device can be notified of the request, the
+// zero time meaning right away. Pushes are held back until the device is in
+// the notification window and then until its quiet hours are over.
+func notBeforeFor(req NotifyReq, tp TokenPlatform, now time.Time) time.Time {
+	notBefore := WindowStart(req.NotificationWindow, tp, now)
+	from := now
+	if !notBefore.IsZero() {
+		from = notBefore
+	}
+	if quietUntil := QuietUntil(tp, from); !quietUntil.IsZero() {
+		notBefore = quietUntil
+	}
+	return notBefore
+}
+
+// WindowStart returns when the device is next within the notification
+// window, or the zero time if it already is. Devices that didn't tell us
+// their timezone are assumed to be in UTC.
+func WindowStart(window string, tp TokenPlatform, now time.Time) time.Time {
+	if window == "" {
+		return time.Time{}
+	}
+	w, err := quiethours.Parse(window)
+	if err != nil {
+		ctx.WithError(err).Warnf("ignoring notification window %s", window)
+		return time.Time{}
+	}
+	loc := time.UTC
+	if tp.Timezone != "" {
+		loc, err = time.LoadLocation(tp.Timezone)
+		if err != nil {
+			ctx.WithError(err).Warnf("ignoring timezone %s", tp.Timezone)
+			loc = time.UTC
+		}
+	}
+	start := w.Within(now, loc)
+	if start.Equal(now) {
+		return time.Time{}
+	}
+	return start.UTC()
+}
+
+func initDatabase() (*sql.DB, error) {
+	return dbconn.Open("postgres")
+}
+
+func MakeNotifications(db *sql.DB, req NotifyReq) ([]PushNotification, error) {
+	return makeNotifications(db, req, func(clientID string) (TokenPlatform, error) {
+		return GetClientTokenPlatform(db, clientID)
+	}, time.Now().UTC()), nil
+}
+
+// makeNotifications is MakeNotifications with the devices of the clients
+// looked up by lookup.
+func makeNotifications(db *sql.DB, req NotifyReq,
+						lookup func(clientID string) (TokenPlatform, error),
+						now time.Time) []PushNotification {
+	var notifications []PushNotification
+	// Mobile pushes are grouped by platform and language, so that every
+	// probe gets the text in its own language, and by the end of the quiet
+	// hours of the probes they are deferred to.
+	var pushes = map[string]*PushNotification{}
+	var order []string
 
 	for _, clientID := range req.ClientIDs {
-		tp, err := GetClientTokenPlatform(db, clientID)
+		tp, err := lookup(clientID)
 		if err == sql.ErrNoRows {
 			ctx.Warnf("could not find client with ID %s. ignoring", clientID)
 			continue
@@ -79,48 +360,116 @@ func MakeNotifications(db *sql.DB, req NotifyReq) ([]PushNotification, error) {
 			continue
 		}
 
-		if tp.Platform == "ios" {
-			ctx.Debugf("appending token %s", tp.Token)
-			iosNotification.Tokens = append(iosNotification.Tokens, tp.Token)
-		} else if tp.Platform == "android" {
-			androidNotification.Tokens = append(androidNotification.Tokens,
-												tp.Token)
-		} else {
-			ctx.Warnf("unsupported platform type %s", tp.Platform)
+		// The preferences apply to every channel the device is notified on
+		if !WantsNotification(db, tp, req.Event) {
+			ctx.Debugf("client %s doesn't want to be notified. skipping", clientID)
+			continue
 		}
-	}
-	if len(androidNotification.Tokens) > 0 {
-		notifications = append(notifications, androidNotification)
-	}
-	if len(iosNotification.Tokens) > 0 {
-		notifications = append(notifications, iosNotification)
-	}
-	return notifications, nil
-}
 
-func StartServer() {
-	err := InitApnsClient()
-	if err != nil {
-		ctx.WithError(err).Error("failed to connect to APN")
-		return
-	}
+		// A registered callback URL takes precedence over mobile pushes
+		if tp.CallbackURL != "" {
+			if _, ok := providerFor("webhook"); !ok {
+				ctx.Warn("no provider for webhooks")
+				continue
+			}
+			// Every probe has its own secret, so they get a notification each
+			notifications = append(notifications, PushNotification{
+				Tokens: []string{tp.CallbackURL},
+				Platform: "webhook",
+				Priority: req.Priority,
+				Retry: 5,
+				Data: req.Event,
+				Secret: tp.CallbackSecret,
+				TaskIDs: req.TaskIDs,
+				CollapseKey: req.CollapseKey,
+				NotBefore: notBeforeFor(req, tp, now),
+				DryRun: req.DryRun,
+			})
+			continue
+		}
 
-	InitWorkers(viper.GetInt("core.worker-num"),
-				viper.GetInt("core.queue-size"))
+		// Browser probes are notified through their Web Push subscription
+		if tp.WebPushEndpoint != "" {
+			if _, ok := providerFor("webpush"); !ok {
+				ctx.Warn("no provider for web push")
+				continue
+			}
+			// Every subscription has its own keys
+			push := PushNotification{
+				Tokens: []string{tp.WebPushEndpoint},
+				Platform: "webpush",
+				Priority: req.Priority,
+				Retry: 5,
+				Data: req.Event,
+				P256dh: tp.WebPushP256dh,
+				Auth: tp.WebPushAuth,
+				TaskIDs: req.TaskIDs,
+				CollapseKey: req.CollapseKey,
+				NotBefore: notBeforeFor(req, tp, now),
+				DryRun: req.DryRun,
+				Silent: req.Silent,
+			}
+			if !req.Silent {
+				push.Title, push.Body, _ = RenderMessage(languageFor(tp.Locale),
+														req.Event)
+			}
+			notifications = append(notifications, push)
+			continue
+		}
 
-	db, err := initDatabase()
+		if tp.Token == "" {
+			ctx.Warnf("client %s has no device token. ignoring", clientID)
+			continue
+		}
+		if tp.TokenInvalid {
+			ctx.Debugf("client %s has an invalid device token. ignoring", clientID)
+			continue
+		}
 
-	if err != nil {
-		ctx.WithError(err).Error("failed to connect to DB")
-		return
+		if _, ok := providerFor(tp.Platform); !ok {
+			ctx.Warnf("no provider for platform type %s", tp.Platform)
+			continue
+		}
+		if tp.Platform != "ios" && tp.Platform != "android" {
+			ctx.Warnf("unsupported platform type %s", tp.Platform)
+			continue
+		}
+
+		lang := languageFor(tp.Locale)
+		notBefore := notBeforeFor(req, tp, now)
+		key := tp.Platform + "/" + lang + "/" + notBefore.Format(time.RFC3339)
+		push, ok := pushes[key]
+		if !ok {
+			push = &PushNotification{
+				Topic:"ooni/orchestrate",
+				Priority:req.Priority,
+				Retry:5,
+				Platform:tp.Platform,
+				Data:req.Event,
+				TaskIDs:req.TaskIDs,
+				CollapseKey:req.CollapseKey,
+				NotBefore:notBefore,
+				DryRun:req.DryRun,
+				Silent:req.Silent,
+			}
+			if !req.Silent {
+				push.Title, push.Body, _ = RenderMessage(lang, req.Event)
+			}
+			pushes[key] = push
+			order = append(order, key)
+		}
+		ctx.Debugf("appending token %s", tp.Token)
+		push.Tokens = append(push.Tokens, tp.Token)
 	}
-	defer db.Close()
-	
-	ctx.Infof("ENV: %s", viper.GetString("core.environment"))
-	if viper.GetString("environment") != "development" {
-		gin.SetMode(gin.ReleaseMode)
+	for _, key := range order {
+		notifications = append(notifications, *pushes[key])
 	}
+	return notifications
+}
 
+// setupRouter registers the routes of the API, the admin ones behind the
+// staff auth of authMiddleware.
+func setupRouter(db *sql.DB, authMiddleware *proteus_mw.GinJWTMiddleware) *gin.Engine {
 	router := gin.Default()
 	router.POST("/api/v1/notify", func(c *gin.Context) {
 		var notifyReq NotifyReq
@@ -134,20 +483,170 @@ func StartServer() {
 		notifications, err := MakeNotifications(db, notifyReq)
 
 		for _, notification := range notifications {
-			go PushToAny(notification)
+			err = PushToAny(notification)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK,
+				gin.H{"status": "ok"})
+		return
+	})
+	// Broadcasts reach every device of a topic, only the admins send them
+	router.POST("/api/v1/broadcast",
+				authMiddleware.StaffMiddlewareFunc(proteus_mw.StaffAuthorizor),
+				proteus_mw.RequireRole(proteus_mw.AdminRole),
+				func(c *gin.Context) {
+		var broadcastReq BroadcastReq
+		err := c.BindJSON(&broadcastReq)
+		if (err != nil) {
+			ctx.WithError(err).Error("invalid request")
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": "invalid request"})
+			return
+		}
+		if _, ok := providerFor("topic"); !ok {
+			c.JSON(http.StatusBadRequest,
+					gin.H{"error": "no provider for topics"})
+			return
 		}
+		err = PushToAny(PushNotification{
+			Tokens: []string{broadcastReq.Topic},
+			Platform: "topic",
+			Priority: broadcastReq.Priority,
+			Retry: 5,
+			Data: broadcastReq.Event,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "server side error"})
+			return
+		}
+		c.JSON(http.StatusOK,
+				gin.H{"status": "ok"})
+		return
+	})
 
+	admin := router.Group("/api/v1/admin")
+	admin.Use(authMiddleware.StaffMiddlewareFunc(proteus_mw.StaffAuthorizor),
+				proteus_mw.RequireRole(proteus_mw.OperatorRole))
+	admin.GET("/notifications/dead", func(c *gin.Context) {
+		notifications, err := ListDeadNotifications(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "server side error"})
+			return
+		}
+		c.JSON(http.StatusOK,
+				gin.H{"notifications": notifications})
+		return
+	})
+	admin.GET("/notifications/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Stats.Snapshot())
+		return
+	})
+	// The same metrics along with the runtime ones, for monitoring
+	admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	admin.GET("/tokens/invalid", func(c *gin.Context) {
+		counts, err := CountInvalidTokens(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "server side error"})
+			return
+		}
+		c.JSON(http.StatusOK,
+				gin.H{"invalid_tokens": counts})
+		return
+	})
+	admin.POST("/notification/:id/retry", func(c *gin.Context) {
+		err := RetryNotification(db, c.Param("id"))
+		if err == ErrNotificationNotFound {
+			c.JSON(http.StatusNotFound,
+					gin.H{"error": "notification not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "server side error"})
+			return
+		}
 		c.JSON(http.StatusOK,
 				gin.H{"status": "ok"})
 		return
 	})
+	return router
+}
+
+func StartServer() {
+	err := secrets.Load()
+	if err != nil {
+		ctx.WithError(err).Error("failed to load the secrets from vault")
+		return
+	}
+
+	err = InitApnsClient()
+	if err != nil {
+		ctx.WithError(err).Error("failed to connect to APN")
+		return
+	}
+
+	err = InitWebPush()
+	if err != nil {
+		ctx.WithError(err).Error("invalid VAPID private key")
+		return
+	}
+
+	err = LoadTemplates()
+	if err != nil {
+		ctx.WithError(err).Error("failed to load message templates")
+		return
+	}
+
+	db, err := initDatabase()
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to connect to DB")
+		return
+	}
+	defer db.Close()
+	DB = db
+
+	err = runMigrations(db)
+	if err != nil {
+		ctx.WithError(err).Error("failed to run DB migration")
+		return
+	}
+
+	authMiddleware, err := proteus_mw.InitAuthMiddleware(sqlx.NewDb(db, "postgres"))
+	if err != nil {
+		ctx.WithError(err).Error("refusing to start")
+		return
+	}
+
+	InitWorkers(viper.GetInt("core.worker-num"))
+	queueListener, err := ListenForQueued(viper.GetString("database.url"))
+	if err != nil {
+		return
+	}
+	defer queueListener.Close()
+	
+	ctx.Infof("ENV: %s", viper.GetString("core.environment"))
+	if viper.GetString("environment") != "development" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	router := setupRouter(db, authMiddleware)
 
 	Addr := fmt.Sprintf("%s:%d", viper.GetString("api.address"),
 								viper.GetInt("api.port"))
 	ctx.Infof("starting on %s", Addr)
-	s := &http.Server{
-		Addr: Addr,
-		Handler: router,
+	servers, err := autotls.Servers(Addr, router)
+	if err != nil {
+		ctx.WithError(err).Error("failed to set up TLS")
+		return
 	}
-	gracehttp.Serve(s)
+	gracehttp.Serve(servers...)
 }
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/thetorproject/proteus/proteus-common/middleware"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func testToken(t *testing.T, mw *proteus_mw.GinJWTMiddleware, role string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, proteus_mw.ProteusClaims{
+		Role: role,
+		User: role + "-user",
+		Scopes: proteus_mw.ScopesForRole(role),
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	signed, err := token.SignedString(mw.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRouterAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mw := &proteus_mw.GinJWTMiddleware{
+		Realm: "Proteus Test Realm",
+		Key: []byte("secret"),
+		Timeout: time.Hour,
+		TimeFunc: time.Now,
+	}
+	router := setupRouter(nil, mw)
+
+	tests := []struct {
+		name	string
+		method	string
+		path	string
+		role	string
+		code	int
+	}{
+		{"anonymous broadcast", "POST", "/api/v1/broadcast", "", http.StatusUnauthorized},
+		{"operator broadcast", "POST", "/api/v1/broadcast", proteus_mw.OperatorRole, http.StatusForbidden},
+		// Let in, then refused for the empty body
+		{"admin broadcast", "POST", "/api/v1/broadcast", proteus_mw.AdminRole, http.StatusBadRequest},
+		{"anonymous stats", "GET", "/api/v1/admin/notifications/stats", "", http.StatusUnauthorized},
+		{"viewer stats", "GET", "/api/v1/admin/notifications/stats", proteus_mw.ViewerRole, http.StatusForbidden},
+		{"operator stats", "GET", "/api/v1/admin/notifications/stats", proteus_mw.OperatorRole, http.StatusOK},
+		{"anonymous retry", "POST", "/api/v1/admin/notification/1/retry", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, strings.NewReader(""))
+		if test.role != "" {
+			req.Header.Set("Authorization", "Bearer " + testToken(t, mw, test.role))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, w.Code)
+		}
+	}
+}
+
+func TestMakeNotificationsPreferences(t *testing.T) {
+	viper.Set("providers.webhook", "webhook")
+	viper.Set("providers.webpush", "webpush")
+	defer viper.Set("providers.webhook", nil)
+	defer viper.Set("providers.webpush", nil)
+
+	devices := map[string]TokenPlatform{
+		"webpush-opted-out": TokenPlatform{
+			WebPushEndpoint: "https://push.example.org/1",
+			Categories: []string{"news"},
+		},
+		"webhook-opted-out": TokenPlatform{
+			CallbackURL: "https://probe.example.org/1",
+			WifiOnly: true,
+			NetworkType: "mobile",
+		},
+		"webpush": TokenPlatform{
+			WebPushEndpoint: "https://push.example.org/2",
+			Categories: []string{"im"},
+		},
+	}
+	lookup := func(clientID string) (TokenPlatform, error) {
+		tp, ok := devices[clientID]
+		if !ok {
+			return tp, sql.ErrNoRows
+		}
+		return tp, nil
+	}
+	req := NotifyReq{
+		ClientIDs: []string{"webpush-opted-out", "webhook-opted-out", "webpush"},
+		Event: map[string]interface{}{"type": "run_task", "category": "im"},
+		Silent: true,
+	}
+	notifications := makeNotifications(nil, req, lookup, time.Now().UTC())
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifications))
+	}
+	if notifications[0].Tokens[0] != "https://push.example.org/2" {
+		t.Errorf("unexpected notification to %v", notifications[0].Tokens)
+	}
+}
+
+func TestMakeNotificationsWebhookWindow(t *testing.T) {
+	viper.Set("providers.webhook", "webhook")
+	defer viper.Set("providers.webhook", nil)
+
+	lookup := func(clientID string) (TokenPlatform, error) {
+		return TokenPlatform{CallbackURL: "https://probe.example.org/1"}, nil
+	}
+	req := NotifyReq{
+		ClientIDs: []string{"webhook"},
+		Event: map[string]interface{}{"type": "run_task"},
+		NotificationWindow: "20:00-21:00",
+	}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	notifications := makeNotifications(nil, req, lookup, now)
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifications))
+	}
+	expected := time.Date(2026, 10, 15, 20, 0, 0, 0, time.UTC)
+	if !notifications[0].NotBefore.Equal(expected) {
+		t.Errorf("expected the webhook to be deferred to %s, got %s",
+				expected, notifications[0].NotBefore)
+	}
+}
+
+func TestReportTasksNotified(t *testing.T) {
+	defer viper.Reset()
+	var (
+		body	string
+		status	= http.StatusOK
+	)
+	events := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/internal/tasks/notified" {
+				http.NotFound(w, r)
+				return
+			}
+			raw, _ := ioutil.ReadAll(r.Body)
+			body = string(raw)
+			w.WriteHeader(status)
+		}))
+	defer events.Close()
+
+	if err := ReportTasksNotified([]string{"t1"}); err != nil || body != "" {
+		t.Errorf("expected nothing to be reported without events-url")
+	}
+	viper.Set("core.events-url", events.URL)
+	if err := ReportTasksNotified([]string{"t1", "t2"}); err != nil {
+		t.Fatal(err)
+	}
+	if body != `{"task_ids":["t1","t2"]}` {
+		t.Errorf("expected the tasks to be reported (got: %s)", body)
+	}
+	status = http.StatusInternalServerError
+	if err := ReportTasksNotified([]string{"t1"}); err == nil {
+		t.Errorf("expected the refused report to fail")
+	}
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+// SinkEntry is what is written to the dry run sink for every notification
+type SinkEntry struct {
+	Time		time.Time `json:"time"`
+	Platform	string `json:"platform"`
+	Tokens		[]string `json:"tokens"`
+	Title		string `json:"title,omitempty"`
+	Body		string `json:"body,omitempty"`
+	Data		map[string]interface{} `json:"data"`
+}
+
+var sinkLock sync.Mutex
+
+// isDryRun tells if the notification must go to the sink instead of the
+// push services, either because the whole service is in dry run mode (e.g.
+// in staging) or because the job asked for it.
+func isDryRun(req PushNotification) bool {
+	return viper.GetBool("dry-run.enabled") || req.DryRun
+}
+
+// PushToSink logs the notification and appends it as a JSON line to the
+// dry-run.sink file, if set, without reaching any device.
+func PushToSink(req PushNotification) ([]string, error) {
+	entry := SinkEntry{
+		Time: time.Now().UTC(),
+		Platform: req.Platform,
+		Tokens: req.Tokens,
+		Title: req.Title,
+		Body: req.Body,
+		Data: req.Data,
+	}
+	ctx.WithFields(log.Fields{
+		"platform": req.Platform,
+		"tokens": len(req.Tokens),
+	}).Info("dry run, not sending notification")
+
+	path := viper.GetString("dry-run.sink")
+	if path == "" {
+		return nil, nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return req.Tokens, permanentError{err}
+	}
+
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open dry run sink")
+		return req.Tokens, err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		ctx.WithError(err).Error("failed to write to dry run sink")
+		return req.Tokens, err
+	}
+	return nil, nil
+}
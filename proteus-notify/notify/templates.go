@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// MessageTemplate is the text shown to the user for an event type. Title
+// and Body are text/template templates executed on the event data, e.g.
+// "{{.test_name}}".
+type MessageTemplate struct {
+	Title	string `json:"title"`
+	Body	string `json:"body"`
+}
+
+type message struct {
+	title	*template.Template
+	body	*template.Template
+}
+
+// The messages by language and event type
+var messages = map[string]map[string]message{}
+
+func parseMessages(lang string, data []byte) error {
+	var templates map[string]MessageTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return err
+	}
+	if messages[lang] == nil {
+		messages[lang] = map[string]message{}
+	}
+	for eventType, t := range templates {
+		title, err := template.New("title").Option("missingkey=error").Parse(t.Title)
+		if err != nil {
+			return err
+		}
+		body, err := template.New("body").Option("missingkey=error").Parse(t.Body)
+		if err != nil {
+			return err
+		}
+		messages[lang][eventType] = message{title: title, body: body}
+	}
+	return nil
+}
+
+// LoadTemplates loads the built-in messages and then the ones in
+// templates.path, which can add languages or override the built-in
+// messages. Files are named after the language, e.g. "pt-BR.json".
+func LoadTemplates() error {
+	names, err := AssetDir("data/templates")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := Asset("data/templates/" + name)
+		if err != nil {
+			return err
+		}
+		err = parseMessages(strings.TrimSuffix(name, ".json"), data)
+		if err != nil {
+			ctx.WithError(err).Errorf("failed to parse template %s", name)
+			return err
+		}
+	}
+
+	dir := viper.GetString("templates.path")
+	if dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = parseMessages(strings.TrimSuffix(filepath.Base(path), ".json"), data)
+		if err != nil {
+			ctx.WithError(err).Errorf("failed to parse template %s", path)
+			return err
+		}
+	}
+	return nil
+}
+
+// languageFor returns the language we have messages in that is the
+// closest to locale, falling back to templates.default-language.
+func languageFor(locale string) string {
+	if _, ok := messages[locale]; ok {
+		return locale
+	}
+	lang := strings.SplitN(locale, "-", 2)[0]
+	if _, ok := messages[lang]; ok {
+		return lang
+	}
+	return viper.GetString("templates.default-language")
+}
+
+// RenderMessage returns the title and body of the notification for the
+// event in the given language. ok is false if there is no message for the
+// event type, in which case the notification is sent without any text.
+func RenderMessage(lang string, event map[string]interface{}) (string, string, bool) {
+	eventType, _ := event["type"].(string)
+	m, ok := messages[lang][eventType]
+	if !ok {
+		return "", "", false
+	}
+	var title, body bytes.Buffer
+	if err := m.title.Execute(&title, event); err != nil {
+		ctx.WithError(err).Warnf("failed to render %s title", eventType)
+		return "", "", false
+	}
+	if err := m.body.Execute(&body, event); err != nil {
+		ctx.WithError(err).Warnf("failed to render %s body", eventType)
+		return "", "", false
+	}
+	return title.String(), body.String(), true
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRenderMessage(t *testing.T) {
+	viper.SetDefault("templates.default-language", "en")
+	if err := LoadTemplates(); err != nil {
+		t.Fatalf("failed to load templates (%v)", err)
+	}
+
+	for locale, expected := range map[string]string{
+		"it": "it",
+		"fr-CA": "fr",
+		"xx-YY": "en",
+		"": "en",
+	} {
+		if lang := languageFor(locale); lang != expected {
+			t.Errorf("expected %s for %q (got: %s)", expected, locale, lang)
+		}
+	}
+
+	_, body, ok := RenderMessage("en", map[string]interface{}{
+		"type": "run_task",
+		"test_name": "web_connectivity",
+		"url_count": float64(10),
+	})
+	if !ok {
+		t.Fatal("expected a message for run_task")
+	}
+	expected := "Help us measure the internet by running web_connectivity on 10 websites."
+	if body != expected {
+		t.Errorf("expected %q (got: %q)", expected, body)
+	}
+
+	_, body, ok = RenderMessage("en", map[string]interface{}{
+		"type": "run_task",
+		"test_name": "http_invalid_request_line",
+		"url_count": float64(0),
+	})
+	expected = "Help us measure the internet by running http_invalid_request_line."
+	if !ok || body != expected {
+		t.Errorf("expected %q (got: %q)", expected, body)
+	}
+
+	// Events we have no text for, or without the placeholders, are sent
+	// without any text.
+	if _, _, ok = RenderMessage("en", map[string]interface{}{
+		"type": "cancel_task",
+	}); ok {
+		t.Error("expected no message for cancel_task")
+	}
+	if _, _, ok = RenderMessage("en", map[string]interface{}{
+		"type": "run_task",
+	}); ok {
+		t.Error("expected no message when test_name is missing")
+	}
+}
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// The VAPID key identifying us to the push services of the browsers,
+// loaded by InitWebPush
+var vapidKey *ecdsa.PrivateKey
+
+var ErrWebPushNotConfigured = errors.New("web push is not configured")
+
+// decodeBase64URL decodes the base64url keys used by the browsers, which
+// may or may not be padded
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// InitWebPush loads the VAPID private key in webpush.vapid-private-key, the
+// base64url encoded P-256 private key whose public key the browser probes
+// subscribe with. Web Push is disabled when it's not set.
+func InitWebPush() error {
+	encoded := viper.GetString("webpush.vapid-private-key")
+	if encoded == "" {
+		return nil
+	}
+	d, err := decodeBase64URL(encoded)
+	if err != nil {
+		return err
+	}
+	vapidKey, err = ecdsa.ParseRawPrivateKey(elliptic.P256(), d)
+	return err
+}
+
+// vapidAuthorization returns the Authorization header value for sending to
+// the push service of endpoint, as defined in RFC 8292.
+func vapidAuthorization(key *ecdsa.PrivateKey, endpoint string,
+						subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+				base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS signatures are the two 32 bytes integers one after the other
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	publicKey, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned,
+						base64.RawURLEncoding.EncodeToString(signature),
+						base64.RawURLEncoding.EncodeToString(publicKey)), nil
+}
+
+func hkdfExtract(salt []byte, ikm []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpand is HKDF-Expand for lengths up to a single SHA-256 block, which
+// is all Web Push needs
+func hkdfExpand(prk []byte, info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:length]
+}
+
+// The record size advertised in the header of encrypted payloads
+const webPushRecordSize = 4096
+
+// encryptWebPush encrypts the payload for the browser with public key p256dh
+// and authentication secret auth, with the aes128gcm content encoding of
+// RFC 8291. The payload has to fit in a single record.
+func encryptWebPush(payload []byte, p256dh []byte, auth []byte) ([]byte, error) {
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	// Every message is encrypted with a new key pair of ours
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyInfo bytes.Buffer
+	keyInfo.WriteString("WebPush: info\x00")
+	keyInfo.Write(p256dh)
+	keyInfo.Write(asPublic)
+	ikm := hkdfExpand(hkdfExtract(auth, secret), keyInfo.Bytes(), 32)
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk := hkdfExtract(salt, ikm)
+	cek := hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The 0x02 delimiter marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 2)
+	if len(plaintext) + gcm.Overhead() > webPushRecordSize {
+		return nil, errors.New("web push payload too large")
+	}
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(webPushRecordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(gcm.Seal(nil, nonce, plaintext, nil))
+	return body.Bytes(), nil
+}
+
+// webPushMessage is what the service worker of the probe gets
+type webPushMessage struct {
+	Title	string `json:"title,omitempty"`
+	Body	string `json:"body,omitempty"`
+	Data	map[string]interface{} `json:"data"`
+}
+
+// PushToWebPush notifies browser probes through the push service of their
+// browser. The Tokens are the endpoints of the subscriptions, which all
+// share the keys in the notification.
+func PushToWebPush(req PushNotification) ([]string, error) {
+	ctx.Debug("Pushing notification to Web Push")
+
+	message := webPushMessage{Data: req.Data}
+	if !req.Silent {
+		message.Title, message.Body = req.Title, req.Body
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		ctx.WithError(err).Error("failed to marshal web push notification")
+		Stats.RecordFailed("webpush", "InvalidPayload", len(req.Tokens))
+		return req.Tokens, permanentError{err}
+	}
+	p256dh, err := decodeBase64URL(req.P256dh)
+	if err != nil {
+		Stats.RecordFailed("webpush", "InvalidSubscription", len(req.Tokens))
+		return req.Tokens, permanentError{err}
+	}
+	auth, err := decodeBase64URL(req.Auth)
+	if err != nil {
+		Stats.RecordFailed("webpush", "InvalidSubscription", len(req.Tokens))
+		return req.Tokens, permanentError{err}
+	}
+
+	var (
+		toRetryEndpoints []string
+		lastErr error
+	)
+	client := &http.Client{Timeout: viper.GetDuration("webpush.timeout")}
+	for _, endpoint := range req.Tokens {
+		if viper.GetString("core.environment") == "development" {
+			ctx.Infof("I would have sent a web push notification to %s", endpoint)
+			Stats.RecordDelivered("webpush", 1)
+			continue
+		}
+		if vapidKey == nil {
+			Stats.RecordFailed("webpush", "NotConfigured", len(req.Tokens))
+			return req.Tokens, permanentError{ErrWebPushNotConfigured}
+		}
+
+		body, err := encryptWebPush(payload, p256dh, auth)
+		if err != nil {
+			ctx.WithError(err).Error("failed to encrypt web push notification")
+			Stats.RecordFailed("webpush", "InvalidSubscription", 1)
+			continue
+		}
+		authorization, err := vapidAuthorization(vapidKey, endpoint,
+									viper.GetString("webpush.subject"), time.Now())
+		if err != nil {
+			ctx.WithError(err).Errorf("invalid web push endpoint %s", endpoint)
+			Stats.RecordFailed("webpush", "InvalidSubscription", 1)
+			continue
+		}
+		httpReq, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+		if err != nil {
+			ctx.WithError(err).Errorf("invalid web push endpoint %s", endpoint)
+			Stats.RecordFailed("webpush", "InvalidSubscription", 1)
+			continue
+		}
+		httpReq.Header.Set("Content-Encoding", "aes128gcm")
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+		httpReq.Header.Set("Authorization", authorization)
+		httpReq.Header.Set("TTL", fmt.Sprintf("%d",
+							int(viper.GetDuration("webpush.ttl").Seconds())))
+		if req.Priority == "high" {
+			httpReq.Header.Set("Urgency", "high")
+		}
+		if req.CollapseKey != "" {
+			// Replaces the messages with the same topic the browser
+			// hasn't received yet
+			httpReq.Header.Set("Topic", req.CollapseKey)
+		}
+
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			ctx.WithError(err).Errorf("web push to %s failed", endpoint)
+			Stats.RecordFailed("webpush", "RequestError", 1)
+			toRetryEndpoints = append(toRetryEndpoints, endpoint)
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			ctx.Debugf("sent web push to %s", endpoint)
+			Stats.RecordDelivered("webpush", 1)
+		case resp.StatusCode == http.StatusNotFound ||
+				resp.StatusCode == http.StatusGone:
+			// The subscription expired or the user unsubscribed
+			ctx.Warnf("web push subscription %s is gone", endpoint)
+			Stats.RecordFailed("webpush", failureReason("", resp.StatusCode), 1)
+			if ForgetWebPushSubscription(DB, endpoint) == nil {
+				Stats.RecordPurged("webpush", 1)
+			}
+		case resp.StatusCode == http.StatusTooManyRequests ||
+				resp.StatusCode >= 500:
+			ctx.Errorf("web push to %s returned %d", endpoint, resp.StatusCode)
+			Stats.RecordFailed("webpush", failureReason("", resp.StatusCode), 1)
+			toRetryEndpoints = append(toRetryEndpoints, endpoint)
+			lastErr = fmt.Errorf("web push returned %d", resp.StatusCode)
+		default:
+			ctx.Errorf("web push to %s was rejected with %d", endpoint,
+						resp.StatusCode)
+			Stats.RecordFailed("webpush", failureReason("", resp.StatusCode), 1)
+		}
+	}
+	return toRetryEndpoints, lastErr
+}
+
+// ForgetWebPushSubscription removes a subscription the push service told us
+// is gone. The probe subscribes again and updates its registration.
+func ForgetWebPushSubscription(db *sql.DB, endpoint string) error {
+	query := fmt.Sprintf(`UPDATE %s SET
+		webpush_endpoint = NULL, webpush_p256dh = NULL, webpush_auth = NULL
+		WHERE webpush_endpoint = $1`,
+				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	_, err := db.Exec(query, endpoint)
+	if err != nil {
+		ctx.WithError(err).Error("failed to forget web push subscription")
+	}
+	return err
+}
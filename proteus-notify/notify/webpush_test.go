@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decryptWebPush is what the browser does with the messages we send
+func decryptWebPush(t *testing.T, body []byte, ua *ecdh.PrivateKey,
+					auth []byte) []byte {
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		t.Fatalf("unexpected record size %d", rs)
+	}
+	idLen := int(body[20])
+	asPublic := body[21:21 + idLen]
+	ciphertext := body[21 + idLen:]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := ua.ECDH(asKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), ua.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdfExpand(hkdfExtract(auth, secret), keyInfo, 32)
+	prk := hkdfExtract(salt, ikm)
+	cek := hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if plaintext[len(plaintext) - 1] != 2 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext) - 1]
+}
+
+func TestEncryptWebPush(t *testing.T) {
+	ua, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	payload := []byte(`{"data":{"type":"run_task"}}`)
+	body, err := encryptWebPush(payload, ua.PublicKey().Bytes(), auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decryptWebPush(t, body, ua, auth); string(got) != string(payload) {
+		t.Errorf("expected %s (got: %s)", payload, got)
+	}
+
+	if _, err = encryptWebPush(make([]byte, webPushRecordSize), ua.PublicKey().Bytes(),
+								auth); err == nil {
+		t.Error("expected payloads over the record size to be rejected")
+	}
+}
+
+func TestVapidAuthorization(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := vapidAuthorization(key, "https://push.example.org/send/abc",
+									"mailto:admin@example.org", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(header, "vapid t=") {
+		t.Fatalf("unexpected header %s", header)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "vapid t="), ", k=", 2)
+	jwt := strings.Split(parts[0], ".")
+	if len(jwt) != 3 {
+		t.Fatalf("invalid JWT %s", parts[0])
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(jwt[1])
+	if !strings.Contains(string(claims), `"aud":"https://push.example.org"`) {
+		t.Errorf("unexpected claims %s", claims)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(jwt[2])
+	digest := sha256.Sum256([]byte(jwt[0] + "." + jwt[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("invalid signature")
+	}
+	publicKey, _ := key.PublicKey.Bytes()
+	if parts[1] != base64.RawURLEncoding.EncodeToString(publicKey) {
+		t.Errorf("unexpected public key %s", parts[1])
+	}
+}
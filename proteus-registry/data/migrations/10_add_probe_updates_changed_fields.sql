@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE probe_updates DROP COLUMN IF EXISTS changed_fields;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE probe_updates ADD COLUMN changed_fields VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,12 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS active_probes_last_seen_idx;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS last_seen;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN last_seen TIMESTAMP WITH TIME ZONE;
+UPDATE active_probes SET last_seen = last_updated;
+CREATE INDEX IF NOT EXISTS active_probes_last_seen_idx ON active_probes (last_seen);
+-- +migrate StatementEnd
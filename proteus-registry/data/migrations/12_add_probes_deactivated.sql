@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS deactivated_at;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE;
+-- +migrate StatementEnd
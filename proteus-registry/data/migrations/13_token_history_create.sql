@@ -0,0 +1,16 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS token_history;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS token_history
+(
+    token VARCHAR PRIMARY KEY NOT NULL,
+    probe_id UUID NOT NULL,
+    replaced_by VARCHAR,
+    retired_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS token_history_probe_id_idx ON token_history (probe_id);
+-- +migrate StatementEnd
@@ -0,0 +1,17 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS probe_aggregates;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS probe_aggregates
+(
+    day DATE NOT NULL,
+    probe_cc VARCHAR(2) NOT NULL,
+    platform VARCHAR NOT NULL,
+    active_probes INT,
+    new_probes INT,
+    PRIMARY KEY (day, probe_cc, platform)
+);
+-- +migrate StatementEnd
@@ -0,0 +1,16 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS probe_blocklist;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS probe_blocklist
+(
+    kind VARCHAR NOT NULL,
+    value VARCHAR NOT NULL,
+    reason VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (kind, value)
+);
+-- +migrate StatementEnd
@@ -0,0 +1,12 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS deletion_requested_at;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN deletion_requested_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS active_probes_deletion_requested_at_idx
+    ON active_probes (deletion_requested_at)
+    WHERE deletion_requested_at IS NOT NULL;
+-- +migrate StatementEnd
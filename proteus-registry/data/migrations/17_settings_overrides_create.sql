@@ -0,0 +1,17 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS settings_overrides;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS settings_overrides
+(
+    id UUID PRIMARY KEY NOT NULL,
+    probe_cc VARCHAR(2),
+    software_version VARCHAR,
+    settings JSONB NOT NULL,
+    comment VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE
+);
+-- +migrate StatementEnd
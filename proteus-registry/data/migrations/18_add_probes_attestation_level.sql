@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS attestation_level;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN attestation_level VARCHAR;
+-- +migrate StatementEnd
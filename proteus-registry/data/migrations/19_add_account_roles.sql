@@ -0,0 +1,6 @@
+-- +migrate Down
+-- Postgres does not support removing values from an enum
+
+-- +migrate Up notransaction
+ALTER TYPE ACCOUNT_ROLE ADD VALUE IF NOT EXISTS 'viewer';
+ALTER TYPE ACCOUNT_ROLE ADD VALUE IF NOT EXISTS 'operator';
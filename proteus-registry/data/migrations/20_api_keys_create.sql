@@ -0,0 +1,21 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id UUID PRIMARY KEY NOT NULL,
+    name VARCHAR NOT NULL,
+    key_prefix VARCHAR NOT NULL,
+    key_hash VARCHAR NOT NULL,
+    scopes VARCHAR[] NOT NULL,
+    created_by VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    last_used TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys (key_hash);
+-- +migrate StatementEnd
@@ -0,0 +1,33 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS revoked_tokens;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id UUID PRIMARY KEY NOT NULL,
+    token_hash VARCHAR NOT NULL,
+    family_id UUID NOT NULL,
+    username VARCHAR NOT NULL,
+    role VARCHAR NOT NULL,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_token_hash_idx
+    ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx
+    ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_username_idx
+    ON refresh_tokens (username);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti VARCHAR PRIMARY KEY NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +migrate StatementEnd
@@ -0,0 +1,9 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS request_secret;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN request_secret VARCHAR;
+-- +migrate StatementEnd
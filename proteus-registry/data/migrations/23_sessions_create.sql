@@ -0,0 +1,22 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS sessions;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id UUID PRIMARY KEY NOT NULL,
+    username VARCHAR NOT NULL,
+    role VARCHAR NOT NULL,
+    user_agent VARCHAR,
+    ip_address VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE,
+    last_used TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS sessions_username_idx
+    ON sessions (username);
+-- +migrate StatementEnd
@@ -0,0 +1,15 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_secret;
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_last_counter;
+ALTER TABLE accounts DROP COLUMN IF EXISTS recovery_codes;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE accounts ADD COLUMN totp_secret VARCHAR;
+ALTER TABLE accounts ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE accounts ADD COLUMN totp_last_counter BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN recovery_codes VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,18 @@
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE IF EXISTS anomalies;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS anomalies
+(
+    id UUID PRIMARY KEY NOT NULL,
+    probe_id VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    detail VARCHAR,
+    creation_time TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS anomalies_probe_id_idx ON anomalies (probe_id);
+CREATE INDEX IF NOT EXISTS anomalies_creation_time_idx ON anomalies (creation_time);
+-- +migrate StatementEnd
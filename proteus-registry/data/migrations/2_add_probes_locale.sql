@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS locale;
+ALTER TABLE probe_updates DROP COLUMN IF EXISTS locale;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN locale VARCHAR;
+ALTER TABLE probe_updates ADD COLUMN locale VARCHAR;
+-- +migrate StatementEnd
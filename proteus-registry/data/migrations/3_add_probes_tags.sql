@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE active_probes DROP COLUMN IF EXISTS tags;
+
+-- +migrate Up
+ALTER TABLE active_probes ADD COLUMN tags VARCHAR[] NOT NULL DEFAULT '{}';
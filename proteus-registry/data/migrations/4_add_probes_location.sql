@@ -0,0 +1,15 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS region;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS city;
+ALTER TABLE probe_updates DROP COLUMN IF EXISTS region;
+ALTER TABLE probe_updates DROP COLUMN IF EXISTS city;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN region VARCHAR;
+ALTER TABLE active_probes ADD COLUMN city VARCHAR;
+ALTER TABLE probe_updates ADD COLUMN region VARCHAR;
+ALTER TABLE probe_updates ADD COLUMN city VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS callback_url;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS callback_secret;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN callback_url VARCHAR;
+ALTER TABLE active_probes ADD COLUMN callback_secret VARCHAR;
+-- +migrate StatementEnd
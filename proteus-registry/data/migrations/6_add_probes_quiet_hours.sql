@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS timezone;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS quiet_hours;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN timezone VARCHAR;
+ALTER TABLE active_probes ADD COLUMN quiet_hours VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,13 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS notify_wifi_only;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS notify_max_per_day;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS notify_categories;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN notify_wifi_only BOOLEAN DEFAULT FALSE;
+ALTER TABLE active_probes ADD COLUMN notify_max_per_day INT DEFAULT 0;
+ALTER TABLE active_probes ADD COLUMN notify_categories VARCHAR[];
+-- +migrate StatementEnd
@@ -0,0 +1,11 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS token_invalid_since;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS token_invalid_reason;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN token_invalid_since TIMESTAMP WITH TIME ZONE;
+ALTER TABLE active_probes ADD COLUMN token_invalid_reason VARCHAR;
+-- +migrate StatementEnd
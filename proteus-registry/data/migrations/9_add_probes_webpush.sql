@@ -0,0 +1,13 @@
+-- +migrate Down
+-- +migrate StatementBegin
+ALTER TABLE active_probes DROP COLUMN IF EXISTS webpush_endpoint;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS webpush_p256dh;
+ALTER TABLE active_probes DROP COLUMN IF EXISTS webpush_auth;
+-- +migrate StatementEnd
+
+-- +migrate Up
+-- +migrate StatementBegin
+ALTER TABLE active_probes ADD COLUMN webpush_endpoint VARCHAR;
+ALTER TABLE active_probes ADD COLUMN webpush_p256dh VARCHAR;
+ALTER TABLE active_probes ADD COLUMN webpush_auth VARCHAR;
+-- +migrate StatementEnd
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/middleware"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// StaffAccount is an account allowed to use the admin API. The admin
+// account of the configuration file isn't stored, so it isn't listed.
+type StaffAccount struct {
+	Username	string `json:"username"`
+	Role		string `json:"role"`
+	LastAccess	*time.Time `json:"last_access"`
+	// Whether it logs in with TOTP
+	TOTP		bool `json:"totp"`
+}
+
+// NewStaffAccount is the request creating a StaffAccount
+type NewStaffAccount struct {
+	Username	string `json:"username" binding:"required"`
+	Password	string `json:"password" binding:"required"`
+	Role		string `json:"role" binding:"required"`
+}
+
+// RoleReq is the request changing the role of a StaffAccount
+type RoleReq struct {
+	Role	string `json:"role" binding:"required"`
+}
+
+var ErrAccountExists = errors.New("account already exists")
+var ErrAccountNotFound = errors.New("account not found")
+var ErrInvalidRole = errors.New("invalid role")
+
+// ListAccounts returns the staff accounts, the ones of the probes aren't
+// listed.
+func ListAccounts(db *sqlx.DB) ([]StaffAccount, error) {
+	var accounts = make([]StaffAccount, 0)
+	query := fmt.Sprintf(`SELECT username, role, last_access, totp_enabled
+		FROM %s WHERE role = ANY($1)
+		ORDER BY username`,
+		pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
+	rows, err := db.Query(query, pq.Array([]string{proteus_mw.ViewerRole,
+							proteus_mw.OperatorRole, proteus_mw.AdminRole}))
+	if err != nil {
+		ctx.WithError(err).Error("failed to list accounts")
+		return accounts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a StaffAccount
+		if err = rows.Scan(&a.Username, &a.Role, &a.LastAccess, &a.TOTP); err != nil {
+			ctx.WithError(err).Error("failed to iterate over accounts")
+			return accounts, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// CreateAccount adds a staff account
+func CreateAccount(db *sqlx.DB, a NewStaffAccount) error {
+	if !proteus_mw.IsStaffRole(a.Role) {
+		return ErrInvalidRole
+	}
+	// The admin of the configuration file always logs in as admin
+	if a.Username == "admin" {
+		return ErrAccountExists
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(a.Password),
+														bcrypt.DefaultCost)
+	if err != nil {
+		ctx.WithError(err).Error("failed to hash password")
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %[1]s (username, password_hash, role)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE username = $1)`,
+		pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
+	res, err := db.Exec(query, a.Username, string(passwordHash), a.Role)
+	if err != nil {
+		ctx.WithError(err).Error("failed to insert into accounts table")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAccountExists
+	}
+	return nil
+}
+
+// SetAccountRole changes the role of a staff account. Its access tokens
+// keep the old role until they expire.
+func SetAccountRole(db *sqlx.DB, username string, role string) error {
+	if !proteus_mw.IsStaffRole(role) {
+		return ErrInvalidRole
+	}
+	query := fmt.Sprintf(`UPDATE %s SET role = $2
+		WHERE username = $1 AND role = ANY($3)`,
+		pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
+	res, err := db.Exec(query, username, role, pq.Array([]string{
+		proteus_mw.ViewerRole, proteus_mw.OperatorRole, proteus_mw.AdminRole}))
+	if err != nil {
+		ctx.WithError(err).Error("failed to update account role")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAccountNotFound
+	}
+	// The account has to log in again to get tokens with its new role
+	return proteus_mw.NewTokenStore(db).RevokeUser(username)
+}
+
+// DeleteAccount removes a staff account
+func DeleteAccount(db *sqlx.DB, username string) error {
+	query := fmt.Sprintf(`DELETE FROM %s
+		WHERE username = $1 AND role = ANY($2)`,
+		pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
+	res, err := db.Exec(query, username, pq.Array([]string{
+		proteus_mw.ViewerRole, proteus_mw.OperatorRole, proteus_mw.AdminRole}))
+	if err != nil {
+		ctx.WithError(err).Error("failed to delete account")
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAccountNotFound
+	}
+	// Its refresh tokens can't be used to stay logged in either
+	return proteus_mw.NewTokenStore(db).RevokeUser(username)
+}
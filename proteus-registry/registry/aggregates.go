@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// ProbeAggregate is the activity of the probes of a country and platform
+// during a day. Counts below analytics.k-anonymity are suppressed, i.e. left
+// out, so that no aggregate singles out a handful of probes.
+type ProbeAggregate struct {
+	Day				string `json:"day"`
+	ProbeCC			string `json:"probe_cc"`
+	Platform		string `json:"platform"`
+	// Probes seen since the beginning of the day
+	ActiveProbes	int64 `json:"active_probes"`
+	// Probes that registered during the day, null when suppressed
+	NewProbes		*int64 `json:"new_probes"`
+}
+
+// AggregateDay rolls up the activity of the probes during the given day.
+// Since only the last time probes were seen is known, it has to run right
+// after the day is over, which is why the first run for a day is kept.
+func AggregateDay(db *sqlx.DB, day time.Time, k int) (int64, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	query := fmt.Sprintf(`INSERT INTO %s (
+		day, probe_cc, platform, active_probes, new_probes
+	) SELECT
+		$1::date, probe_cc, platform, active,
+		CASE WHEN new >= $4 THEN new END
+		FROM (SELECT
+			COALESCE(probe_cc, '') AS probe_cc,
+			COALESCE(platform, '') AS platform,
+			COUNT(*) FILTER (
+				WHERE COALESCE(last_seen, last_updated) >= $2) AS active,
+			COUNT(*) FILTER (
+				WHERE creation_time >= $2 AND creation_time < $3) AS new
+			FROM %s
+			WHERE deactivated_at IS NULL OR deactivated_at >= $2
+			GROUP BY 1, 2) AS cells
+		WHERE active >= $4
+		ON CONFLICT (day, probe_cc, platform) DO NOTHING`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-aggregates-table")),
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	res, err := db.Exec(query, start.Format("2006-01-02"), start,
+						start.AddDate(0, 0, 1), k)
+	if err != nil {
+		ctx.WithError(err).Error("failed to aggregate probes")
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunProbeAggregator aggregates the day before at every tick, the first
+// tick after midnight UTC is the one that counts.
+func RunProbeAggregator(db *sqlx.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		yesterday := time.Now().UTC().AddDate(0, 0, -1)
+		n, err := AggregateDay(db, yesterday,
+								viper.GetInt("analytics.k-anonymity"))
+		if err == nil && n > 0 {
+			ctx.Infof("aggregated %d cells of probe activity for %s", n,
+						yesterday.Format("2006-01-02"))
+		}
+	}
+}
+
+// ListProbeAggregates returns the aggregates of the days from since to
+// until, both included.
+func ListProbeAggregates(db *sqlx.DB, since time.Time,
+						until time.Time) ([]ProbeAggregate, error) {
+	var aggregates = make([]ProbeAggregate, 0)
+	query := fmt.Sprintf(`SELECT
+		to_char(day, 'YYYY-MM-DD'), probe_cc, platform,
+		active_probes, new_probes
+		FROM %s
+		WHERE day >= $1::date AND day <= $2::date
+		ORDER BY day, probe_cc, platform`,
+		pq.QuoteIdentifier(viper.GetString("database.probe-aggregates-table")))
+	rows, err := db.Query(query, since.Format("2006-01-02"),
+							until.Format("2006-01-02"))
+	if err != nil {
+		ctx.WithError(err).Error("failed to list probe aggregates")
+		return aggregates, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a ProbeAggregate
+		err = rows.Scan(&a.Day, &a.ProbeCC, &a.Platform,
+						&a.ActiveProbes, &a.NewProbes)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over probe aggregates")
+			return aggregates, err
+		}
+		aggregates = append(aggregates, a)
+	}
+	return aggregates, rows.Err()
+}
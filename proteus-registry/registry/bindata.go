@@ -1,8 +1,32 @@
 // Code generated by go-bindata.
 // sources:
+// proteus-registry/data/migrations/10_add_probe_updates_changed_fields.sql
+// proteus-registry/data/migrations/11_add_probes_last_seen.sql
+// proteus-registry/data/migrations/12_add_probes_deactivated.sql
+// proteus-registry/data/migrations/13_token_history_create.sql
+// proteus-registry/data/migrations/14_probe_aggregates_create.sql
+// proteus-registry/data/migrations/15_probe_blocklist_create.sql
+// proteus-registry/data/migrations/16_add_probes_deletion_requested.sql
+// proteus-registry/data/migrations/17_settings_overrides_create.sql
+// proteus-registry/data/migrations/18_add_probes_attestation_level.sql
+// proteus-registry/data/migrations/19_add_account_roles.sql
 // proteus-registry/data/migrations/1_accounts_create.sql
 // proteus-registry/data/migrations/1_active_probes_create.sql
 // proteus-registry/data/migrations/1_probe_updates_create.sql
+// proteus-registry/data/migrations/20_api_keys_create.sql
+// proteus-registry/data/migrations/21_refresh_tokens_create.sql
+// proteus-registry/data/migrations/22_add_probes_request_secret.sql
+// proteus-registry/data/migrations/23_sessions_create.sql
+// proteus-registry/data/migrations/24_add_accounts_totp.sql
+// proteus-registry/data/migrations/25_anomalies_create.sql
+// proteus-registry/data/migrations/2_add_probes_locale.sql
+// proteus-registry/data/migrations/3_add_probes_tags.sql
+// proteus-registry/data/migrations/4_add_probes_location.sql
+// proteus-registry/data/migrations/5_add_probes_callback.sql
+// proteus-registry/data/migrations/6_add_probes_quiet_hours.sql
+// proteus-registry/data/migrations/7_add_probes_preferences.sql
+// proteus-registry/data/migrations/8_add_probes_token_invalid.sql
+// proteus-registry/data/migrations/9_add_probes_webpush.sql
 // proteus-registry/data/templates/home.tmpl
 // DO NOT EDIT!
 
@@ -71,6 +95,206 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
+var _dataMigrations10_add_probe_updates_changed_fieldsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x28\x28\xca\x4f\x4a\x8d\x2f\x2d\x48\x49\x2c\x49\x2d\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\xce\x48\xcc\x4b\x4f\x4d\x89\x4f\xcb\x4c\xcd\x49\x29\xb6\xc6\x6e\xb4\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x79\x6e\x70\x74\x71\x81\x39\x01\xd5\x62\x85\x30\xc7\x20\x67\x0f\xc7\xa0\xe8\x58\x3c\x4e\x00\x0c\x00\x50\xee\xff\x24\x08\x01\x00\x00")
+
+func dataMigrations10_add_probe_updates_changed_fieldsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations10_add_probe_updates_changed_fieldsSql,
+		"data/migrations/10_add_probe_updates_changed_fields.sql",
+	)
+}
+
+func dataMigrations10_add_probe_updates_changed_fieldsSql() (*asset, error) {
+	bytes, err := dataMigrations10_add_probe_updates_changed_fieldsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/10_add_probe_updates_changed_fields.sql", size: 264, mode: os.FileMode(420), modTime: time.Unix(1792047161, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations11_add_probes_last_seenSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x90\xcd\x6a\xc3\x30\x10\x84\xef\x7a\x8a\x3d\xb6\x94\x3c\x81\xe9\x41\x89\xb6\x54\x60\x4b\xc6\x5a\xd3\xd0\x8b\x51\xab\x25\x08\x1a\xc5\xc4\xea\xcf\xe3\x97\x26\x54\x38\x21\x2d\xb9\x49\xbb\x3b\xf3\x0d\xb3\x58\xc0\xdd\x36\x6e\xf6\x3e\x33\xa8\xdd\x67\x12\xf3\x81\xcb\x3e\xf3\x96\x53\x5e\xf2\x26\x26\xa1\x3a\xdb\x82\x36\x0a\xd7\xa0\x1f\x00\xd7\xda\x91\x03\xff\x9a\xe3\x07\x0f\xe3\x7e\xf7\xc2\xd3\xf0\xe6\xa7\x3c\x4c\xcc\x69\x88\xe1\xab\x12\xb2\x26\xec\x80\xe4\xb2\xc6\xd3\x43\x38\x78\xad\x6c\xdd\x37\x66\x66\x56\xe4\xd5\xe5\x1c\x98\x82\x38\xd9\xf4\xe3\xe5\xc3\x63\xe0\xbf\xf1\x52\xa9\x5f\x7a\x61\x02\xe9\x06\x1d\xc9\xa6\x85\x27\x4d\x8f\x87\x2f\x3c\x5b\x83\x95\xe8\x5b\x25\xe9\xdc\xc3\x21\xcd\xc4\xf7\xc7\xf7\xfb\x18\x7c\xe6\x50\x89\x55\x87\x3f\x92\x52\x97\xb1\x74\x45\x65\x60\xcd\x19\xe5\xa6\xec\x6f\xff\x29\xe5\x7b\x00\x05\xae\xb0\x60\xc7\x01\x00\x00")
+
+func dataMigrations11_add_probes_last_seenSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations11_add_probes_last_seenSql,
+		"data/migrations/11_add_probes_last_seen.sql",
+	)
+}
+
+func dataMigrations11_add_probes_last_seenSql() (*asset, error) {
+	bytes, err := dataMigrations11_add_probes_last_seenSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/11_add_probes_last_seen.sql", size: 455, mode: os.FileMode(420), modTime: time.Unix(1792047211, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations12_add_probes_deactivatedSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x8e\xcb\xca\xc2\x30\x14\x84\xf7\x7d\x8a\xd9\xff\xf4\x09\xfe\x55\x6a\x22\x06\x7a\xa3\x39\x45\x71\x53\xa2\x3d\x94\x2c\x9a\x96\x7a\xd0\xd7\x17\x0a\x82\x05\x71\xe1\x72\x2e\xcc\x7c\x69\x8a\xbf\x31\x0c\x8b\x17\x86\x9e\x1e\x31\x79\x37\x9c\x78\xe1\x91\xa3\x64\x3c\x84\x98\xa8\x9c\x4c\x03\x52\x59\x6e\xe0\xaf\x12\xee\xdc\xcd\xcb\x74\xe1\x1b\x74\x53\xd5\xd8\x55\x79\x5b\x94\xb0\x7b\x98\x93\x75\xe4\xd0\xf3\xda\xf2\xc2\x7d\xe7\xe5\xff\xf3\xb4\x89\x7d\xb2\x49\xda\xf9\x37\x06\xa5\xf5\x0b\x61\x7b\x0c\xb2\x85\x71\xa4\x8a\x1a\x47\x4b\x87\x55\xe2\x5c\x95\xe6\x0b\xd1\x73\x00\x8b\xe0\x0d\xbf\x17\x01\x00\x00")
+
+func dataMigrations12_add_probes_deactivatedSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations12_add_probes_deactivatedSql,
+		"data/migrations/12_add_probes_deactivated.sql",
+	)
+}
+
+func dataMigrations12_add_probes_deactivatedSql() (*asset, error) {
+	bytes, err := dataMigrations12_add_probes_deactivatedSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/12_add_probes_deactivated.sql", size: 279, mode: os.FileMode(420), modTime: time.Unix(1792047270, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations13_token_history_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\xd1\x4e\xc3\x20\x18\x85\xef\x79\x8a\x73\xb9\x45\xf7\x04\xbb\x62\x2b\x66\xc4\x95\x36\x94\xea\xe6\x0d\xe9\xe4\xcf\x24\x3a\xda\x20\x89\xee\xed\x4d\xba\x10\x9d\x69\x76\x09\xdf\x39\x9c\x2f\x2c\x16\xb8\x3b\xf9\x63\xec\x12\xa1\xe8\xbf\x02\xfb\x7b\xd1\xa4\x2e\xd1\x89\x42\x5a\xd1\xd1\x07\x56\xe8\xaa\x86\xe1\xab\xad\x80\x7c\x80\xd8\xc9\xc6\x34\x48\xfd\x3b\x05\xfb\xe6\x3f\x53\x1f\xcf\xcb\xe9\xba\x08\x8e\x5d\x91\x76\x98\x0e\x5e\x76\xd6\x5a\x70\x23\x7e\x97\x54\x65\x26\xd7\xd8\x8c\x01\xb8\x18\xe0\x89\xeb\xf5\x86\x6b\xd4\x5a\x96\x5c\xef\xf1\x28\xf6\x63\x51\xb5\xdb\xed\xfd\x98\x1b\x62\x7f\x20\xeb\x1d\xda\x56\x16\xff\x58\xa4\xe1\xa3\x7b\x25\x67\x0f\xe7\xfc\x52\x06\xc9\x47\x72\xb6\x4b\x30\xb2\x14\x8d\xe1\x65\x8d\x67\x69\x36\xe3\x11\x2f\x95\x12\x6c\xbe\xcc\xca\x52\x15\x62\x77\x4b\xd9\x66\x09\xeb\xdd\x37\x2a\x75\x4d\x31\xcb\x78\x7e\xe3\x27\x7f\x06\x00\xac\x17\x01\xd8\xb3\x01\x00\x00")
+
+func dataMigrations13_token_history_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations13_token_history_createSql,
+		"data/migrations/13_token_history_create.sql",
+	)
+}
+
+func dataMigrations13_token_history_createSql() (*asset, error) {
+	bytes, err := dataMigrations13_token_history_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/13_token_history_create.sql", size: 435, mode: os.FileMode(420), modTime: time.Unix(1792047431, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations14_probe_aggregates_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\xcd\x4e\x84\x30\x14\x85\xf7\x7d\x8a\xbb\x84\xc8\x6c\xdc\xba\xea\x0c\x35\x36\x22\x33\x29\x1d\xe3\xac\x26\xd7\x72\x6d\x48\xa4\x90\xd2\x48\x78\x7b\x03\xf8\x8b\x38\xdb\x73\xbe\x9e\xaf\xb9\x9b\x0d\x5c\xd5\x95\xf5\x18\x08\xd2\xa6\x77\xec\x67\x50\x04\x0c\x54\x93\x0b\x5b\xb2\x95\x63\xa9\xda\x1f\x40\xf3\x6d\x26\x40\xde\x82\x78\x92\x85\x2e\xa0\xf5\xcd\x33\x9d\xd1\x5a\x4f\x16\x03\x75\x37\xeb\x0b\xc2\x95\xec\x57\x73\x6c\xd7\xc1\x59\xb5\x53\x82\x6b\xf1\x2d\xcb\xf7\xfa\x3f\x21\x8b\x18\x00\x40\x89\x03\xa4\xe3\x9b\x11\xcd\x8f\x59\x96\x4c\xf1\x4c\x1b\x03\x8f\x5c\xed\xee\xb8\x8a\xae\xe3\x25\xf1\x8a\xe1\xa5\xf1\xf5\x27\xb1\xa8\xd1\x84\xea\x8d\xce\xd3\x4e\x07\x32\xd7\xf3\xae\xa3\xfe\x4f\x76\x50\xf2\x81\xab\x13\xdc\x8b\x13\x44\x25\x0e\xc9\xc7\x5f\x8d\x49\xbe\x2c\x31\x8b\x2f\x5c\xe8\x7d\x00\x1f\x54\x92\x00\x8e\x01\x00\x00")
+
+func dataMigrations14_probe_aggregates_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations14_probe_aggregates_createSql,
+		"data/migrations/14_probe_aggregates_create.sql",
+	)
+}
+
+func dataMigrations14_probe_aggregates_createSql() (*asset, error) {
+	bytes, err := dataMigrations14_probe_aggregates_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/14_probe_aggregates_create.sql", size: 398, mode: os.FileMode(420), modTime: time.Unix(1792047697, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations15_probe_blocklist_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\xcf\x4e\x02\x31\x10\x87\xef\x7d\x8a\xdf\x11\x22\x3c\x81\xa7\x02\x63\x68\xdc\x7f\xe9\x16\x15\x2f\xa4\xc0\x84\x34\xec\xb6\xa4\x54\x7d\x7d\xe3\x36\x46\x4d\x58\x8f\xed\xf7\x65\xbe\xc9\xcc\xe7\xb8\xeb\xdd\x29\xda\xc4\x58\x85\x0f\x2f\x7e\x7f\xb4\xc9\x26\xee\xd9\xa7\x05\x9f\x9c\x17\x2b\x5d\x37\x30\x72\x51\x10\xd4\x03\xe8\x45\xb5\xa6\xc5\x25\x86\x3d\xef\xf6\x5d\x38\x9c\x3b\x77\x4d\xf7\xb7\x07\x90\x3f\x8a\x3f\x64\x73\xb9\x2d\xe6\xd2\x52\x93\x34\xf4\xd3\xaa\x6a\x33\xd2\x13\x13\x01\x00\x67\xe7\x8f\x78\x92\x7a\xb9\x96\x7a\xb0\xab\x4d\x51\xcc\x06\xf4\x6e\xbb\x37\x1e\x61\x91\xed\x35\xf8\x6f\x98\xfd\x43\x64\x9b\x5c\xf0\xbb\xe4\x7a\x86\x51\x25\xb5\x46\x96\x0d\x9e\x95\x59\x0f\x4f\xbc\xd6\x15\x65\xb7\xd1\xaa\x94\x7a\x8b\x47\xda\x62\xf2\xb5\xc3\x2c\xe7\xa6\x62\xfa\xcf\x21\x3e\x07\x00\x86\x22\xbc\xe9\x74\x01\x00\x00")
+
+func dataMigrations15_probe_blocklist_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations15_probe_blocklist_createSql,
+		"data/migrations/15_probe_blocklist_create.sql",
+	)
+}
+
+func dataMigrations15_probe_blocklist_createSql() (*asset, error) {
+	bytes, err := dataMigrations15_probe_blocklist_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/15_probe_blocklist_create.sql", size: 372, mode: os.FileMode(420), modTime: time.Unix(1792047748, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations16_add_probes_deletion_requestedSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x90\xcd\x4a\x03\x31\x14\x85\xf7\x79\x8a\xb3\x54\xa4\x4f\xd0\x55\xda\x5c\x69\x20\x93\x94\x49\x86\x16\x37\x61\x74\x2e\x25\x60\x33\x75\x1a\x7f\x1e\x5f\x1c\x28\x58\x89\x2e\x5c\x26\xf7\x70\xbf\xef\xdc\xc5\x02\x77\xc7\x74\x98\xfa\xc2\x50\xe3\x7b\x16\xdf\x3f\x7c\xe9\x0b\x1f\x39\x97\x15\x1f\x52\x16\xd2\x04\x6a\x11\xe4\xca\x10\xfa\xa7\x92\xde\x38\x9e\xa6\xf1\x91\xcf\x50\xad\xdb\x62\xed\x4c\xd7\x58\xe8\x7b\xd0\x5e\xfb\xe0\x31\xf0\x33\x97\x34\xe6\x38\xf1\xcb\x2b\x9f\x0b\x0f\xb1\x2f\xcb\x3a\x81\xf2\x20\xae\x26\xdd\xe9\x7f\x2a\x52\xa9\x8b\x49\x95\x8f\xa0\x1b\xf2\x41\x36\x5b\xec\x74\xd8\xcc\x4f\x3c\x38\x4b\x4b\xb1\x6e\x49\x06\x82\xb6\x8a\xf6\x5f\x35\xac\x0b\x97\x2a\x57\x8c\x58\x5d\x1c\xd3\xf0\x21\x00\xc0\xd9\x1f\x4a\x37\xd5\xfc\xed\x1c\xde\x6d\xa8\xa5\x5f\x4c\xb5\x9f\x15\x6c\x67\xcc\x1f\x57\xfb\x1c\x00\x78\xc2\x10\x25\xc2\x01\x00\x00")
+
+func dataMigrations16_add_probes_deletion_requestedSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations16_add_probes_deletion_requestedSql,
+		"data/migrations/16_add_probes_deletion_requested.sql",
+	)
+}
+
+func dataMigrations16_add_probes_deletion_requestedSql() (*asset, error) {
+	bytes, err := dataMigrations16_add_probes_deletion_requestedSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/16_add_probes_deletion_requested.sql", size: 450, mode: os.FileMode(420), modTime: time.Unix(1792047868, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations17_settings_overrides_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x90\x3d\x4f\xc3\x30\x10\x86\x77\xff\x8a\x77\x6c\x05\x5d\x58\x99\x9c\xc6\xa8\x86\x7c\xc9\x71\x80\xb2\x44\x21\x39\x22\x0f\xb1\x2b\xdb\x6a\xff\x3e\x22\x2d\x82\xa2\xd2\xf1\xee\xfd\x78\x4e\xb7\x5a\xe1\x66\x32\xa3\xef\x22\x21\x75\x07\xcb\x7e\x2f\xea\xd8\x45\x9a\xc8\xc6\x84\x46\x63\x59\xaa\xca\x0a\x9a\x27\x99\x80\x7c\x80\x78\x95\xb5\xae\x11\x28\x46\x63\xc7\xd0\xba\x3d\x79\x6f\x06\x0a\xf7\x97\x3b\x84\x1d\xd8\x99\xd2\xec\x2e\x1b\x8f\xb0\xb5\x12\x5c\x8b\x1f\x5c\x51\xea\xff\x91\x6c\xc1\x00\xc0\x0c\x68\x1a\x99\xa2\x52\x32\xe7\x6a\x8b\x27\xb1\x9d\x73\x45\x93\x65\xb7\xb3\x63\xe7\xdd\x3b\xb5\x7d\x8f\x67\xae\xd6\x1b\xae\x16\x77\xcb\xa3\x10\xdc\x47\x3c\x74\x9e\xda\x3d\xf9\x60\x9c\xfd\x36\x9c\xd4\x13\x11\x8f\x75\x59\x24\x7f\x3a\x7b\x37\x7d\x9d\x7d\x9e\xe8\x3d\x75\xd1\x38\xdb\x46\x33\x11\xb4\xcc\x45\xad\x79\x5e\xe1\x45\xea\xcd\x3c\xe2\xad\x2c\x04\x5b\x5e\x79\xd6\xe7\x00\x7e\x97\x06\x9c\x9b\x01\x00\x00")
+
+func dataMigrations17_settings_overrides_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations17_settings_overrides_createSql,
+		"data/migrations/17_settings_overrides_create.sql",
+	)
+}
+
+func dataMigrations17_settings_overrides_createSql() (*asset, error) {
+	bytes, err := dataMigrations17_settings_overrides_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/17_settings_overrides_create.sql", size: 411, mode: os.FileMode(420), modTime: time.Unix(1792047947, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations18_add_probes_attestation_levelSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x4c\x2e\xc9\x2c\x4b\x8d\x2f\x28\xca\x4f\x4a\x2d\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2c\x29\x49\x2d\x2e\x49\x2c\xc9\xcc\xcf\x8b\xcf\x49\x2d\x4b\xcd\xb1\xc6\x6e\xba\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x79\xce\x70\x74\x71\x81\xb9\x02\xc3\x6e\x85\x30\xc7\x20\x67\x0f\xc7\x20\x3c\x6e\x00\x0c\x00\x8a\xc3\x39\xea\x0c\x01\x00\x00")
+
+func dataMigrations18_add_probes_attestation_levelSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations18_add_probes_attestation_levelSql,
+		"data/migrations/18_add_probes_attestation_level.sql",
+	)
+}
+
+func dataMigrations18_add_probes_attestation_levelSql() (*asset, error) {
+	bytes, err := dataMigrations18_add_probes_attestation_levelSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/18_add_probes_attestation_level.sql", size: 268, mode: os.FileMode(420), modTime: time.Unix(1792048672, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations19_add_account_rolesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xcc\xb1\x6a\x85\x30\x14\x06\xe0\x3d\x4f\xf1\x6f\x0e\x25\x4f\xe0\x14\x34\x05\x41\x54\x34\x96\x76\x2a\xa1\x3d\x95\x40\x93\x13\x4e\xa2\xbe\x7e\xe9\x76\xd7\xfb\x00\xdf\xa7\x35\x5e\x62\x38\xc4\x57\x42\xcf\x77\x52\x5a\x63\xe1\x52\x0f\xa1\x82\x6f\xa6\x82\xc4\x15\xe5\xcc\x99\xa5\x42\x28\xf2\x15\xd2\x81\xcb\xff\x9e\x54\xf0\x23\x1c\xe1\x13\x28\x9d\x51\xa9\xc7\x6b\xcf\xff\x50\x7c\x2a\xfe\xab\x06\x4e\xca\x8c\xce\xae\x70\x1f\x8b\x85\xe9\xba\x79\x9f\xdc\xe7\x3a\x8f\x16\xa6\xef\xf1\x66\xc6\xdd\x62\x78\xc5\x34\x3b\xd8\xf7\x61\x73\x1b\x9a\x2b\xd0\x4d\xd2\xb4\xcf\x4b\xce\x24\xbe\xb2\x34\xad\xfa\x1b\x00\x7d\xcf\x36\x51\xdf\x00\x00\x00")
+
+func dataMigrations19_add_account_rolesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations19_add_account_rolesSql,
+		"data/migrations/19_add_account_roles.sql",
+	)
+}
+
+func dataMigrations19_add_account_rolesSql() (*asset, error) {
+	bytes, err := dataMigrations19_add_account_rolesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/19_add_account_roles.sql", size: 223, mode: os.FileMode(420), modTime: time.Unix(1792048742, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _dataMigrations1_accounts_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x52\xc1\x8e\xda\x30\x10\xbd\xfb\x2b\xde\x01\x29\xa0\xee\x1e\x7a\x8e\x7a\x30\xc9\x50\xac\x26\x0e\x75\x9c\xee\xd2\x4b\x64\x25\x16\x6b\x09\x4c\x84\x4d\x77\xf7\xef\x2b\x42\xa9\x36\x52\xcb\x6d\xfc\xe6\xcd\x9b\x79\x4f\x7e\x7c\xc4\xa7\x83\xdb\x9d\x4c\xb4\xc8\x8f\xaf\x9e\x7d\x04\xea\x68\xa2\x3d\x58\x1f\x97\x76\xe7\x3c\xcb\x55\xb5\x81\xe6\xcb\x82\x20\x56\xb0\x6f\x2e\xc4\x00\xd3\x75\xc7\xb3\x8f\x21\xfd\xf7\x24\xf9\x9e\x4d\x3a\xcd\x70\x77\x45\x85\xd9\x8c\x01\xc0\x92\xbe\x0a\x39\x56\x62\x05\x59\x69\xd0\xb3\xa8\x75\x8d\x79\x4d\x05\x65\x1a\x9f\xb1\x52\x55\x89\x61\xd7\xc6\xf7\xc1\xe2\x69\x4d\x8a\x10\xdf\x07\x6f\x0e\x16\x5f\x90\xfc\xb9\xab\x3d\x1d\xf7\x36\x59\x40\xaf\xe9\xaa\x96\x29\xe2\x9a\xa0\xb7\x1b\x02\xcf\xb2\xaa\x91\xba\x55\x55\x41\xe0\x35\x48\x36\x25\xe6\x49\x6f\x7f\xb9\xce\x26\x0f\x48\x4c\x7f\x70\xfe\x52\x9c\x83\x3d\x25\x8b\x74\x54\x20\x99\x43\xac\x52\x46\x32\x9f\xcd\x52\xc6\x6e\x8a\xb7\x60\x3e\x1c\x7b\x0b\x87\xcd\xc7\x49\xd7\xa3\x26\x25\x78\x81\x8d\x12\x25\x57\x5b\x7c\xa3\xed\xc8\x97\x4d\x51\x3c\x8c\x9c\xcb\xa6\xd1\xc3\x0f\xae\xb2\x35\x57\x57\x74\x30\x21\xbc\x1e\x4f\x7d\xfb\x62\xc2\xcb\xb4\x15\xcc\x3e\x4e\x91\xbd\x09\xb1\x35\x5d\x67\x43\x80\x16\x25\xd5\x9a\x97\x1b\x3c\x09\xbd\x1e\x9f\xf8\x59\x49\xba\x32\x2f\xe1\x4c\x52\x60\x8b\xf4\xe6\xa7\x91\xe2\x7b\x43\x10\x32\xa7\xe7\xff\xd8\x6a\x5d\xdf\x9e\x9d\xef\xed\x1b\x2a\xf9\x17\xc5\xdc\xf5\x8b\x3b\xdf\xe1\x77\x00\x00\x00\xff\xff\x49\x92\xd5\x50\x73\x02\x00\x00")
 
 func dataMigrations1_accounts_createSqlBytes() ([]byte, error) {
@@ -131,6 +355,286 @@ func dataMigrations1_probe_updates_createSql() (*asset, error) {
 	return a, nil
 }
 
+var _dataMigrations20_api_keys_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x91\xd1\x4e\xf2\x30\x18\x86\xcf\x7b\x15\xdf\x21\xe4\xff\xb9\x02\x8e\x0a\xab\xa1\x11\x3a\xec\x5a\x05\x8d\x69\x2a\xfd\x84\x06\xd7\x2d\x6b\x55\xb8\x7b\x13\xc8\x14\x09\xc3\xc3\xbe\xcf\xd3\xbc\xe9\xdb\xc1\x00\xfe\x95\x7e\xdd\xd8\x84\x90\x55\x9f\x81\x9c\x06\x45\xb2\x09\x4b\x0c\x69\x84\x6b\x1f\x48\x26\xf3\x39\x28\x3a\x9a\x32\xe0\x37\xc0\x16\xbc\x50\x05\xd8\xda\x9b\x2d\xee\xe3\xf0\xf2\x4d\x16\x1c\xf9\x45\x74\x7d\x59\x3c\x56\x8c\x25\xa3\x8a\xfd\x94\x88\x5c\x9d\x17\x91\x1e\x01\x00\xf0\x0e\xb4\xe6\x19\xcc\x25\x9f\x51\xb9\x84\x5b\xb6\x3c\xd8\x42\x4f\xa7\xff\x0f\x46\xb0\x25\xc2\x3d\x95\xe3\x09\x95\x67\x68\x8b\x7b\x53\x37\xf8\xea\x77\x57\x84\x8d\x8d\x9b\x0e\x1c\x57\x55\x8d\xb1\x85\x4f\xcf\x67\x78\xd5\xa0\x4d\xe8\xcc\xcb\xbe\x55\x4e\x72\x5f\x05\x93\x7c\x89\xa0\xf8\x8c\x15\x8a\xce\xe6\xf0\xc0\xd5\xe4\x70\x84\xc7\x5c\xb0\xa3\xfb\x66\x63\x32\xef\x11\xdd\x1f\x5e\x83\x1f\xd5\x16\x9d\xb1\xa9\x53\x24\xfd\x61\x3b\xac\x16\xfc\x4e\x33\xe0\x22\x63\x8b\x8e\x7d\x4d\xfb\x76\xe3\xdd\x0e\x72\xf1\x0d\xa0\xd7\x92\xfe\x95\xcf\xfe\x1a\x00\xc9\x40\x3f\x7d\x51\x02\x00\x00")
+
+func dataMigrations20_api_keys_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations20_api_keys_createSql,
+		"data/migrations/20_api_keys_create.sql",
+	)
+}
+
+func dataMigrations20_api_keys_createSql() (*asset, error) {
+	bytes, err := dataMigrations20_api_keys_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/20_api_keys_create.sql", size: 593, mode: os.FileMode(420), modTime: time.Unix(1792048828, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations21_refresh_tokens_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x93\xc1\x6e\xf2\x30\x10\x84\xef\x7e\x8a\x3d\x82\xfe\x9f\x27\xe0\x14\x88\x2b\xac\x42\x42\x13\xa7\x85\x5e\x2c\xab\x59\xc0\x85\x38\xc8\x36\x2d\x7d\xfb\xaa\x29\x49\x00\x11\xab\x1c\x13\x7f\x9e\x59\xed\x8c\x07\x03\xf8\x57\xa8\xb5\x91\x0e\x21\x2c\x3f\x35\x39\xff\x91\x3a\xe9\xb0\x40\xed\x46\xb8\x56\x9a\x84\x49\x3c\x07\x1e\x8c\xa6\x14\xd8\x03\xd0\x05\x4b\x79\x0a\x06\x57\x06\xed\x46\xb8\x72\x8b\xda\x0e\xbb\xa0\x8f\x72\x8b\x79\x03\xdd\x34\xa1\x3a\x27\x17\xf6\xd9\xde\x37\xcd\x38\xa1\x01\xa7\xad\x55\x14\xf3\xdb\x33\x91\x1e\x01\x00\x50\x39\x64\x19\x0b\x61\x9e\xb0\x59\x90\x2c\xe1\x91\x2e\xab\x3b\x51\x36\x9d\xfe\xaf\x88\x0a\x17\x1b\x69\x37\xf0\x1c\x24\xe3\x49\x90\x5c\x01\x2b\x59\xa8\xdd\x97\xa8\x95\x2e\x0f\x0f\x16\x8d\x96\x05\x76\xdc\x35\xe5\xae\xeb\xe8\xcd\xa0\x74\xaa\xd4\xc2\xa9\x02\x81\xb3\x19\x4d\x79\x30\x9b\xc3\x0b\xe3\x93\xea\x13\x5e\xe3\x88\xfe\xb2\x78\xdc\x2b\x83\x56\x48\xd7\x09\x5e\xa9\x1f\x2c\xe6\x3e\xfc\x34\xde\x29\x21\x0f\x48\xfa\xc3\x7a\xe9\x59\xc4\x9e\x32\x0a\x2c\x0a\xe9\xc2\xbb\x7b\xd1\xee\x54\xa8\xfc\x58\x59\xc5\xd1\x15\x04\xbd\x96\x6a\x3d\xfe\x20\xde\xe4\xe1\xd3\x6e\xa0\xbb\xa4\xeb\x34\x7d\xca\x35\xd3\x1f\x12\x7f\x1b\xcf\xcb\x7f\x6a\xe3\xbb\x53\x4d\x1b\xba\x1b\x79\x4f\xda\x3f\xf1\xdc\x7c\x2e\x54\xe7\xe4\x7b\x00\xea\xdd\x43\x6c\xe7\x03\x00\x00")
+
+func dataMigrations21_refresh_tokens_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations21_refresh_tokens_createSql,
+		"data/migrations/21_refresh_tokens_create.sql",
+	)
+}
+
+func dataMigrations21_refresh_tokens_createSql() (*asset, error) {
+	bytes, err := dataMigrations21_refresh_tokens_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/21_refresh_tokens_create.sql", size: 999, mode: os.FileMode(420), modTime: time.Unix(1792048890, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations22_add_probes_request_secretSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x4c\x2e\xc9\x2c\x4b\x8d\x2f\x28\xca\x4f\x4a\x2d\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4a\x2d\x2c\x4d\x2d\x2e\x89\x2f\x4e\x4d\x2e\x4a\x2d\xb1\xc6\x6e\xb4\x6b\x5e\x0a\x17\x8a\x4c\x68\x01\x79\x6e\x70\x74\x71\x81\x39\x01\xd5\x62\x85\x30\xc7\x20\x67\x0f\xc7\x20\x3c\x0e\x00\x0c\x00\x71\xe9\x81\x38\x06\x01\x00\x00")
+
+func dataMigrations22_add_probes_request_secretSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations22_add_probes_request_secretSql,
+		"data/migrations/22_add_probes_request_secret.sql",
+	)
+}
+
+func dataMigrations22_add_probes_request_secretSql() (*asset, error) {
+	bytes, err := dataMigrations22_add_probes_request_secretSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/22_add_probes_request_secret.sql", size: 262, mode: os.FileMode(420), modTime: time.Unix(1792049166, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations23_sessions_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x91\xcd\x6e\xeb\x20\x14\x84\xf7\x3c\xc5\x59\x26\xba\x37\x4f\x90\x15\x89\xa9\x82\x1a\xff\x08\xe3\x36\xe9\x06\xa1\x72\x64\xa1\xc6\xd8\x02\xd2\xe6\xf1\xab\xda\x72\xdb\x58\x71\xba\x64\xe6\x1b\x46\x0c\xab\x15\xfc\x6b\x6c\xed\x75\x44\x48\xda\x0f\x47\x7e\x0b\x65\xd4\x11\x1b\x74\x71\x83\xb5\x75\x24\x11\x79\x01\x92\x6e\xf6\x0c\xf8\x03\xb0\x03\x2f\x65\x09\x01\x43\xb0\xad\x0b\xeb\xdb\x49\xe6\x0c\xb9\x72\xaa\xee\x36\x38\x54\x6c\x05\xa3\x92\xfd\x94\x64\xb9\x9c\x16\x91\x05\x01\x00\xb0\x06\xaa\x8a\x27\x50\x08\x9e\x52\x71\x84\x47\x76\xec\xe9\xac\xda\xef\xff\xf7\xc4\x39\xa0\x77\xba\x41\x78\xa2\x62\xbb\xa3\x62\x62\xfb\xf6\x34\x67\x7d\x25\x95\xae\xd1\xc5\x11\x18\x74\xdb\x29\x6d\x8c\xc7\x10\xae\xf5\x57\x8f\x3a\xda\xd6\xa9\x68\x1b\x04\xc9\x53\x56\x4a\x9a\x16\xf0\xcc\xe5\xae\x3f\xc2\x4b\x9e\xb1\x81\x3d\xe9\x10\xd5\x39\xa0\xf9\x83\xc3\x4b\x67\x3d\x06\xa5\xe3\x2c\x38\x7d\x10\xbe\xb7\x6f\x68\xee\x25\xc8\x72\x3d\x4e\xcc\xb3\x84\x1d\x66\x26\x56\xe3\x74\xca\x9a\x4b\x7f\x77\x9e\x7d\x9b\xb0\x18\xdd\xe5\x9d\x3f\xff\x1c\x00\xbc\x9e\x49\x07\x58\x02\x00\x00")
+
+func dataMigrations23_sessions_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations23_sessions_createSql,
+		"data/migrations/23_sessions_create.sql",
+	)
+}
+
+func dataMigrations23_sessions_createSql() (*asset, error) {
+	bytes, err := dataMigrations23_sessions_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/23_sessions_create.sql", size: 600, mode: os.FileMode(420), modTime: time.Unix(1792049773, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations24_add_accounts_totpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xd0\xc1\x4a\x03\x31\x10\x06\xe0\xfb\x3e\xc5\xdc\xa5\xe0\x7d\x4f\xd9\x26\xd5\x85\x98\x48\x36\x11\x41\x64\x89\xd9\xb1\x14\xb6\x49\x49\x46\xc5\xb7\x17\xc4\xc2\x16\xc5\x36\xd7\x64\xfe\x7f\x98\x6f\xb5\x82\xab\xfd\x6e\x9b\x3d\x21\xf0\xf4\x11\x9b\xe5\xc3\x40\x9e\x70\x8f\x91\x3a\xdc\xee\x62\xc3\xa4\x15\x06\x2c\xeb\xa4\x00\x1f\x42\x7a\x8b\x54\x80\x1b\x7d\x0f\x6b\x2d\xdd\x9d\x82\x7e\x03\xe2\xb1\x1f\xec\x00\x94\xe8\x30\x16\x0c\x19\xa9\xad\xce\x61\xf4\x2f\x33\x4e\xf5\xc1\xd9\x17\x1a\xbf\xc7\x30\x57\xa5\x33\x86\xf4\x8e\xf9\x73\x0c\x69\xc2\xd2\xfe\x8d\x20\xe2\xd4\x9c\xfc\xb8\x43\xb5\x16\xe3\xfc\xb8\x7d\x41\x04\x0f\xcc\xac\x6f\x99\x69\x2f\x0b\xfd\xf8\x40\xa7\xb5\x14\x4c\x81\xd2\x16\x94\x93\x12\xb8\xd8\x30\x27\x2d\xbc\xfa\xb9\xe0\x85\x65\x4b\x33\xe8\xfa\x9b\x5e\xd9\xdf\x85\xd7\xe7\xcb\x4e\x09\x8f\x17\x3d\x3d\xff\x83\xf9\x35\x00\xfc\xef\xd0\x1d\x7c\x02\x00\x00")
+
+func dataMigrations24_add_accounts_totpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations24_add_accounts_totpSql,
+		"data/migrations/24_add_accounts_totp.sql",
+	)
+}
+
+func dataMigrations24_add_accounts_totpSql() (*asset, error) {
+	bytes, err := dataMigrations24_add_accounts_totpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/24_add_accounts_totp.sql", size: 636, mode: os.FileMode(420), modTime: time.Unix(1792049867, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations25_anomalies_createSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x91\xc1\x4e\xc3\x30\x10\x44\xef\xfe\x8a\x39\xb6\x82\x7e\x41\x4f\x6e\x63\x54\x8b\xc4\x89\x1c\x07\x5a\x2e\x91\xc1\x56\xb5\xa2\x71\xaa\x60\x09\x3e\x1f\x29\x55\x28\x81\x04\x71\xf4\xbe\xf1\xcc\x8e\x76\xb5\xc2\x4d\x43\xc7\xce\x46\x8f\xa4\x7d\x0f\xec\xfb\xa0\x8c\x36\xfa\xc6\x87\xb8\xf1\x47\x0a\x2c\xd1\x79\x01\xc3\x37\xa9\x80\xbc\x83\xd8\xcb\xd2\x94\xb0\xa1\x6d\xec\x89\xfc\xdb\x7a\xfa\xab\x08\x8e\x8d\x48\x75\x9e\x16\x5e\x32\xb6\x5a\x70\x23\xae\x29\x2a\x37\xbf\x92\xd8\x82\x01\x00\x39\x54\x95\x4c\x50\x68\x99\x71\x7d\xc0\xbd\x38\xf4\x72\x55\xa5\xe9\x6d\xaf\x38\x77\xed\xb3\xaf\xc9\xe1\x81\xeb\xed\x8e\xeb\x1f\xf8\x95\xc2\x1c\x72\x3e\x5a\x3a\x0d\xf0\x32\x7b\xe9\xbc\x8d\xd4\x86\x3a\x52\xe3\x61\x64\x26\x4a\xc3\xb3\x02\x8f\xd2\xec\xfa\x27\x9e\x72\x25\xbe\x8c\xd8\x72\x3d\xb4\x91\x2a\x11\xfb\xb9\x36\xf5\xb0\x65\x4d\xee\x03\xb9\xba\x12\x2c\x06\xf4\x5f\xab\xd1\x8a\x13\x7e\x23\xbe\xfc\xe3\x62\x9f\x03\x00\xb1\xd9\x49\x08\x17\x02\x00\x00")
+
+func dataMigrations25_anomalies_createSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations25_anomalies_createSql,
+		"data/migrations/25_anomalies_create.sql",
+	)
+}
+
+func dataMigrations25_anomalies_createSql() (*asset, error) {
+	bytes, err := dataMigrations25_anomalies_createSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/25_anomalies_create.sql", size: 535, mode: os.FileMode(420), modTime: time.Unix(1792050508, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations2_add_probes_localeSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x42\x16\x08\x2e\x49\x2c\x49\xcd\x4d\xcd\x2b\x71\x4a\x4d\xcf\xcc\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x4c\x2e\xc9\x2c\x4b\x8d\x2f\x28\xca\x4f\x4a\x2d\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\xc8\xc9\x4f\x4e\xcc\x49\xb5\x46\xd1\x07\xd6\x10\x5f\x5a\x90\x92\x58\x42\x50\x1f\x56\xa7\xb8\xe6\xa5\x70\xa1\x38\x32\xb4\x80\x3c\x37\x3b\xba\xb8\xc0\xac\x86\x38\x54\x21\xcc\x31\xc8\xd9\xc3\x31\x08\x9f\x83\xf1\x68\xc2\xea\x08\xd7\xbc\x14\x2e\xc0\x00\xe8\x37\x55\xfc\x63\x01\x00\x00")
+
+func dataMigrations2_add_probes_localeSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations2_add_probes_localeSql,
+		"data/migrations/2_add_probes_locale.sql",
+	)
+}
+
+func dataMigrations2_add_probes_localeSql() (*asset, error) {
+	bytes, err := dataMigrations2_add_probes_localeSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/2_add_probes_locale.sql", size: 355, mode: os.FileMode(420), modTime: time.Unix(1792045087, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations3_add_probes_tagsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x70\xc9\x2f\xcf\xe3\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x4c\x2e\xc9\x2c\x4b\x8d\x2f\x28\xca\x4f\x4a\x2d\x56\x70\x09\xf2\x0f\x50\x70\xf6\xf7\x09\xf5\xf5\x53\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x49\x4c\x2f\xb6\xe6\xe2\x42\x36\x27\xb4\x00\x8f\x29\x8e\x2e\x2e\x30\x43\x40\x5a\x15\xc2\x1c\x83\x9c\x3d\x1c\x83\xa2\x63\x15\xfc\xfc\x43\x14\xfc\x42\x7d\x7c\x14\x5c\x5c\xdd\x1c\x43\x7d\x42\x14\xd4\xab\x6b\xd5\xad\xb9\x00\x03\x00\x51\x82\x7a\xd6\xa2\x00\x00\x00")
+
+func dataMigrations3_add_probes_tagsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations3_add_probes_tagsSql,
+		"data/migrations/3_add_probes_tags.sql",
+	)
+}
+
+func dataMigrations3_add_probes_tagsSql() (*asset, error) {
+	bytes, err := dataMigrations3_add_probes_tagsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/3_add_probes_tags.sql", size: 162, mode: os.FileMode(420), modTime: time.Unix(1792045159, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations4_add_probes_locationSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x90\x41\xcb\x82\x40\x10\x86\xef\xfb\x2b\xe6\xfe\xe1\x2f\xf0\xb4\xba\xfb\x91\x60\x19\xab\x46\x37\xd9\x74\x90\x3d\x38\x8a\x4d\x45\xff\x3e\x4a\x82\x16\x0c\xb4\xeb\xcc\x3c\x3c\xf3\xbe\x41\x00\x7f\x9d\x6b\x47\xcb\x08\xaa\xbf\x91\xf8\x1c\xe4\x6c\x19\x3b\x24\x8e\xb0\x75\x24\x64\x5a\x68\x03\x85\x8c\x52\x0d\xb6\x66\x77\xc5\x6a\x18\xfb\x13\x9e\x41\x99\x6c\x0f\x71\x96\x96\xdb\x1d\x24\xff\xa0\x8f\x49\x5e\xe4\x30\x62\xeb\x7a\x0a\x57\x73\xb5\xe3\xbb\x4f\xbd\xce\xab\xcb\xd0\x58\x5e\x65\x5b\xc2\x4d\xb6\xd9\xd8\x9a\x1a\xe1\x6d\xca\xe1\xb7\x7e\xa4\x52\x6f\xf1\x54\x0a\x1c\xa4\x89\x37\xd2\x84\xcb\xa0\xe7\x8f\xf3\x88\x9f\x70\xa1\xe7\x2b\xe4\x7b\x66\xa3\x6a\x6a\xc4\x63\x00\x8d\x6f\xeb\x5c\x35\x02\x00\x00")
+
+func dataMigrations4_add_probes_locationSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations4_add_probes_locationSql,
+		"data/migrations/4_add_probes_location.sql",
+	)
+}
+
+func dataMigrations4_add_probes_locationSql() (*asset, error) {
+	bytes, err := dataMigrations4_add_probes_locationSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/4_add_probes_location.sql", size: 565, mode: os.FileMode(420), modTime: time.Unix(1792045341, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations5_add_probes_callbackSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xcf\xc1\x0a\x82\x40\x10\xc6\xf1\xfb\x3e\xc5\xdc\xc3\x27\xf0\xb4\xba\x1b\x09\x96\xb1\x6a\x74\x93\x75\x1d\x64\x69\x5d\x65\x9d\xea\xf5\x3b\x44\x64\xe0\x25\xaf\x33\xfc\xe1\xf7\x45\x11\xec\x06\xdb\x07\x4d\x08\x62\x7c\x7a\xb6\x3c\x94\xa4\x09\x07\xf4\x94\x60\x6f\x3d\xe3\x79\x25\x15\x54\x3c\xc9\x25\x68\x43\xf6\x81\xcd\x14\xc6\x16\x67\x10\xaa\x38\x43\x5a\xe4\xf5\xf1\x04\xd9\x1e\xe4\x35\x2b\xab\x12\x8c\x76\xae\xd5\xe6\xd6\xdc\x83\x8b\xb7\xd7\x33\x9a\x80\x14\xaf\xcb\xa4\xef\xd8\xcf\xa7\x9e\xb6\x4d\xe0\x42\x7c\x0c\x4b\x37\x5c\xb8\x4a\x0f\x5c\xc5\x7f\xa6\x6f\xf4\xb7\x5e\x35\x49\xdf\xb1\xd7\x00\x67\x3a\xe7\x5e\x81\x01\x00\x00")
+
+func dataMigrations5_add_probes_callbackSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations5_add_probes_callbackSql,
+		"data/migrations/5_add_probes_callback.sql",
+	)
+}
+
+func dataMigrations5_add_probes_callbackSql() (*asset, error) {
+	bytes, err := dataMigrations5_add_probes_callbackSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/5_add_probes_callback.sql", size: 385, mode: os.FileMode(420), modTime: time.Unix(1792045724, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations6_add_probes_quiet_hoursSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xce\xb1\xee\x82\x30\x10\xc7\xf1\xbd\x4f\x71\xfb\x3f\x3c\x01\x53\xa1\xfd\x47\x12\x14\x53\xc0\xb8\x11\x94\x0b\x76\xe8\x15\xcb\xa1\x89\x4f\xef\x44\xc4\x84\x41\x5d\xef\xf2\xcd\xef\x13\x45\xf0\xe7\x6c\x1f\x5a\x46\x50\xfe\x4e\x62\x79\x28\xb9\x65\x74\x48\x9c\x60\x6f\x49\xc8\xbc\xd2\x06\x2a\x99\xe4\x1a\xda\x33\xdb\x1b\x36\x43\xf0\x27\x1c\x41\x99\x62\x0f\x69\x91\xd7\xdb\x1d\x64\xff\xa0\x8f\x59\x59\x95\xc0\xd6\xe1\xc3\x13\xc6\x5f\x97\xd7\xc9\x22\x37\x17\x3f\x85\x31\x5e\x17\x69\xea\xc4\xdb\xa7\x1e\x7e\xa3\x4b\xa5\xe6\xfd\xd9\x0b\x07\x69\xd2\x8d\x34\xf1\x67\xd9\x02\xfb\x2a\x57\x2d\x9a\x3a\xf1\x1c\x00\xbc\x0c\xbd\xd5\x71\x01\x00\x00")
+
+func dataMigrations6_add_probes_quiet_hoursSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations6_add_probes_quiet_hoursSql,
+		"data/migrations/6_add_probes_quiet_hours.sql",
+	)
+}
+
+func dataMigrations6_add_probes_quiet_hoursSql() (*asset, error) {
+	bytes, err := dataMigrations6_add_probes_quiet_hoursSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/6_add_probes_quiet_hours.sql", size: 369, mode: os.FileMode(420), modTime: time.Unix(1792046221, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations7_add_probes_preferencesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xd0\xc1\x4a\xc4\x30\x10\x80\xe1\x7b\x9f\x62\xee\xb2\xe0\xbd\xa7\xe9\x26\xc5\x42\x6c\x24\x49\x45\x10\x09\x71\x77\xb6\x04\x6c\x52\xd2\x60\xed\xdb\x7b\x52\xab\xc8\x42\x7b\x9d\x81\x9f\x99\xef\x70\x80\x9b\xc1\xf7\xc9\x65\x02\x16\xe7\x50\xac\x07\x3a\xbb\x4c\x03\x85\x5c\x51\xef\x43\x81\xc2\x70\x05\x06\x2b\xc1\xc1\x9d\xb2\x7f\x27\x3b\xa6\xf8\x4a\x13\x30\x25\x1f\xe0\x28\x45\x77\xdf\x42\x53\x03\x7f\x6a\xb4\xd1\x10\x62\xf6\x97\xc5\xce\xfe\xe2\x6d\x0c\x6f\x4b\xb9\xb7\x30\xb8\x0f\x3b\x52\xb2\x67\xb7\xbf\x71\x72\x99\xfa\x98\x3c\x4d\xe5\xff\x3f\xf2\x70\x2e\x7e\x6d\xba\x71\x1f\x06\x32\xf6\x75\xc5\x5f\x01\xa8\xa4\x14\x1c\x5b\x60\xbc\xc6\x4e\x18\xa8\x51\x68\x5e\x6e\x8a\xad\x30\xa0\x69\xcd\x77\xea\x76\x5b\xe6\xc7\x03\x1e\x51\x1d\xef\x50\x3d\xbf\x5c\x91\xf9\x1c\x00\x7b\xf9\x3f\x19\x28\x02\x00\x00")
+
+func dataMigrations7_add_probes_preferencesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations7_add_probes_preferencesSql,
+		"data/migrations/7_add_probes_preferences.sql",
+	)
+}
+
+func dataMigrations7_add_probes_preferencesSql() (*asset, error) {
+	bytes, err := dataMigrations7_add_probes_preferencesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/7_add_probes_preferences.sql", size: 552, mode: os.FileMode(420), modTime: time.Unix(1792046269, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations8_add_probes_token_invalidSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\xcf\xcf\x8a\x83\x30\x10\x06\xf0\xbb\x4f\x31\xf7\xc5\x27\xf0\x14\x4d\x16\x03\xfe\x23\x89\xbb\xcb\x5e\x24\xab\x83\x84\xad\x13\xd1\x60\x5f\xbf\xd0\x52\x68\x41\x7a\xb0\xc7\x99\x0f\x3e\xbe\x5f\x1c\xc3\xc7\xe4\xc6\xc5\x06\x04\xee\xcf\x14\x3d\x3e\x74\xb0\x01\x27\xa4\x90\xe2\xe8\x28\x62\x85\x11\x0a\x0c\x4b\x0b\x01\xb6\x0f\x6e\xc3\x6e\x5e\xfc\x1f\xae\xc0\x55\xdd\x40\x56\x17\x6d\x59\x81\xfc\x04\xf1\x23\xb5\xd1\x10\xfc\x3f\x52\xe7\x68\xb3\x27\x37\x74\xab\xa3\x1e\x93\x37\x4b\x16\xb4\xab\xa7\x64\x7f\xa5\xa0\x21\x7a\x4a\xda\xf9\x18\x87\x71\x7e\x1f\xb2\x63\x00\x23\x4b\xa1\x0d\x2b\x1b\xf8\x96\x26\xbf\x9e\xf0\x5b\x57\x22\x39\x52\x79\x13\xc1\x17\x53\x59\xce\xd4\x0b\xd9\x65\x00\x99\xec\x4e\x32\xaa\x01\x00\x00")
+
+func dataMigrations8_add_probes_token_invalidSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations8_add_probes_token_invalidSql,
+		"data/migrations/8_add_probes_token_invalid.sql",
+	)
+}
+
+func dataMigrations8_add_probes_token_invalidSql() (*asset, error) {
+	bytes, err := dataMigrations8_add_probes_token_invalidSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/8_add_probes_token_invalid.sql", size: 426, mode: os.FileMode(420), modTime: time.Unix(1792046808, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dataMigrations9_add_probes_webpushSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xd0\xbd\x0e\x82\x30\x10\xc0\xf1\xbd\x4f\x71\xbb\x61\x31\xd1\x85\xa9\xd0\x1a\x49\x50\x4c\x01\xe3\x46\x8a\xbd\x40\x07\x4a\x03\x45\x5e\xdf\x18\x63\xfc\x08\x8b\x5d\xdb\xfc\x2f\xf7\xbb\x20\x80\x55\xa7\x9b\x41\x3a\x04\xd6\xcf\x86\x7c\x3e\xe4\x4e\x3a\xec\xd0\xb8\x08\x1b\x6d\x08\x4d\x0b\x2e\xa0\xa0\x51\xca\x41\x5e\x9d\xbe\x61\x65\x87\xbe\xc6\x11\x98\xc8\x4e\x10\x67\x69\x79\x38\x42\xb2\x03\x7e\x49\xf2\x22\x87\x19\x6b\x3b\x8d\x6d\x85\x46\xd9\x5e\x1b\x17\x7a\x4f\xb0\xeb\xcd\x56\xb5\xfe\xbd\x9c\x5c\x1b\x2e\xd3\xb8\x51\xe4\xeb\xa7\xb4\x7e\x37\xa0\x8c\xbd\x16\xf8\x85\xc3\x99\x8a\x78\x4f\x45\xf8\x5f\xfe\x54\x7b\xc6\x0f\xf2\x3b\x5d\x14\x71\xa3\xc8\x7d\x00\x1a\xf3\x91\x63\x00\x02\x00\x00")
+
+func dataMigrations9_add_probes_webpushSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dataMigrations9_add_probes_webpushSql,
+		"data/migrations/9_add_probes_webpush.sql",
+	)
+}
+
+func dataMigrations9_add_probes_webpushSql() (*asset, error) {
+	bytes, err := dataMigrations9_add_probes_webpushSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "data/migrations/9_add_probes_webpush.sql", size: 512, mode: os.FileMode(420), modTime: time.Unix(1792046957, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _dataTemplatesHomeTmpl = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x54\xc1\x72\xdb\x36\x10\x3d\x4b\x5f\xb1\x45\x6e\x1d\xd1\x94\xd2\xa6\xb5\x69\x8a\x87\x38\xcd\xc4\x87\xc6\x9e\x3a\x39\xf4\xb8\x24\x96\x24\x1a\x10\x8b\x01\x56\xb2\x94\x4c\xff\xbd\x03\x52\x62\x34\xee\x4c\x7b\xe2\xee\xc3\xc3\xbe\x47\x2c\x16\xe5\x0f\xef\x1e\xee\x3e\xfd\xf9\xf8\x1b\xf4\x32\xd8\x6a\x59\xa6\x0f\x58\x74\xdd\x56\x91\x53\xd5\x12\xa0\xec\x09\xf5\x18\x0c\x24\x08\x4d\x8f\x21\x92\x6c\xd5\x4e\xda\xec\x5a\x7d\x5f\x70\x38\xd0\x56\xed\x0d\x3d\x7b\x0e\xa2\xa0\x61\x27\xe4\x64\xab\x9e\x8d\x96\x7e\xab\x69\x6f\x1a\xca\xc6\x64\x05\xc6\x19\x31\x68\xb3\xd8\xa0\xa5\xed\x46\x55\xcb\x54\x47\x8c\x58\xaa\x1e\x03\x0b\xed\x22\x64\xc0\xec\x8c\x0f\x5c\x13\x70\x68\x7a\x8a\x12\x50\x0c\x3b\x88\xc7\x28\x34\x94\xf9\xc4\x5f\x2e\xca\x28\x47\x4b\x20\x47\x4f\x5b\x25\x74\x90\xbc\x89\x51\x55\xcb\xc5\x8f\xf0\x6d\xb9\x58\x0c\x18\x3a\xe3\x0a\x58\xdf\x2e\x17\x0b\x8f\x5a\x1b\xd7\x9d\xb2\x44\xce\x02\x39\x4d\x61\x04\x3b\xe2\x81\x24\x98\xe6\x31\x50\x63\xa2\x61\x97\x58\x35\x1f\xb2\x68\xbe\x8e\x8c\x9a\x83\xa6\x90\xd5\x7c\xb8\x5d\x2e\xfe\x5e\x2e\x6a\xd6\xc7\xd5\x78\x7a\xa3\x56\xcb\x4e\xb2\x16\x07\x63\x8f\x05\x64\xe8\xbd\xa5\x6c\xb2\xbb\x82\xb7\xd6\xb8\x2f\xbf\x63\xf3\x34\xe6\xef\xd9\xc9\x0a\xd4\x13\x75\x4c\xf0\xf9\x5e\xad\x40\xfd\xc1\x35\x0b\xa7\xe8\xe1\x70\xec\xc8\xa5\xe8\x73\xbd\x73\xb2\x4b\xd1\x1d\x3a\xc1\x40\xd6\xa6\xe4\xbd\x09\x08\x4f\xe8\x62\x4a\xde\x05\x36\x7a\xce\x3e\x90\xdd\x93\x98\x06\xe1\x23\xed\x48\xad\x20\xa2\x8b\x59\xa4\x60\xda\xd1\x32\x00\x40\x72\x0d\xdf\xc6\x10\xa0\xc6\xe6\x4b\x17\x78\xe7\x74\x01\xaf\xda\xb6\xbd\x3d\xe1\xf3\x51\xfd\xb4\xf6\x87\x09\x9c\x76\x0f\x68\xdc\xbc\x7b\xc0\xc3\xd4\xd5\x02\x6e\x5e\xbf\x20\x5e\xf5\x64\x2d\x5f\x50\x53\x23\xb2\x9a\x45\x78\xb8\x2c\x0b\x30\x9e\x5b\x34\x5f\xa9\x80\xcd\xf5\x0b\xf8\x99\x4c\xd7\x4b\x01\xaf\xd7\xeb\x33\x6e\x8d\xa3\xac\x3f\xe1\x2f\xed\xcd\xba\xfd\x66\x96\xbe\xa8\xff\x2f\xd9\x73\xfd\x37\xdf\xeb\x9f\x9c\x0a\xfb\xf1\xa2\x4c\x60\xc3\x96\x43\x01\xaf\xd6\x3f\xff\xf2\xeb\xcd\xcd\xa5\x22\xce\x3a\x33\xe7\xcd\xf5\xf5\xdd\xdb\xf3\xce\xf1\x9a\x69\x6a\x78\xba\xc0\x05\x38\x76\x74\x2e\xb0\x28\xf3\xf1\xfe\x8e\xa3\x94\xcf\xd3\x96\x5a\x54\x8d\x94\x32\x9d\x77\x75\x2a\x55\x6a\xb3\x87\xc6\x62\x8c\x5b\x35\xfe\xa5\x3a\xaf\xa4\x51\xdd\x54\x1f\x12\xb6\x02\xe9\x4d\x04\x13\xc1\x4f\xc3\x94\x05\xea\x4c\x94\x70\x2c\xf3\x7e\x73\xb1\xc1\x57\x1e\x83\x00\xb7\x20\x3d\xfd\xef\xbc\xf9\xd9\x44\xae\xcd\x7e\x4e\x66\xf8\x1e\x70\x80\x1e\xbd\x3f\x82\x30\x44\x0a\x7b\x82\x1e\x9d\xb6\x04\x68\x2d\xb4\x3b\xd7\xa4\x7a\x68\x8d\x1c\x21\x90\x45\x21\x9d\x98\x27\x73\x93\x18\xb7\x30\x7a\x88\x2b\xd8\x79\x8d\x62\x5c\x37\x63\x90\x5e\x1a\x8d\x82\x80\x4e\x83\xe5\xce\xb8\xab\xd9\x92\xbf\x30\xf4\x89\xc1\x12\x06\x07\x03\x07\x02\xac\x79\x27\xf0\xf0\xf0\xf1\x1e\xf6\x26\x1a\x29\xa0\x44\xe8\x03\xb5\x5b\xd5\x8b\xf8\x58\xe4\x79\xfa\xf5\x2b\xe1\xe0\x03\xff\x45\x8d\x5c\x71\xe8\x72\x55\xfd\xd7\x6a\x99\x63\x35\x8b\x96\xf9\xb9\x47\x65\x3e\x35\xae\xcc\xa7\x17\xf5\x9f\x00\x00\x00\xff\xff\x58\x2c\x75\x8f\x62\x05\x00\x00")
 
 func dataTemplatesHomeTmplBytes() ([]byte, error) {
@@ -203,9 +707,33 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
+	"data/migrations/10_add_probe_updates_changed_fields.sql": dataMigrations10_add_probe_updates_changed_fieldsSql,
+	"data/migrations/11_add_probes_last_seen.sql": dataMigrations11_add_probes_last_seenSql,
+	"data/migrations/12_add_probes_deactivated.sql": dataMigrations12_add_probes_deactivatedSql,
+	"data/migrations/13_token_history_create.sql": dataMigrations13_token_history_createSql,
+	"data/migrations/14_probe_aggregates_create.sql": dataMigrations14_probe_aggregates_createSql,
+	"data/migrations/15_probe_blocklist_create.sql": dataMigrations15_probe_blocklist_createSql,
+	"data/migrations/16_add_probes_deletion_requested.sql": dataMigrations16_add_probes_deletion_requestedSql,
+	"data/migrations/17_settings_overrides_create.sql": dataMigrations17_settings_overrides_createSql,
+	"data/migrations/18_add_probes_attestation_level.sql": dataMigrations18_add_probes_attestation_levelSql,
+	"data/migrations/19_add_account_roles.sql": dataMigrations19_add_account_rolesSql,
 	"data/migrations/1_accounts_create.sql": dataMigrations1_accounts_createSql,
 	"data/migrations/1_active_probes_create.sql": dataMigrations1_active_probes_createSql,
 	"data/migrations/1_probe_updates_create.sql": dataMigrations1_probe_updates_createSql,
+	"data/migrations/20_api_keys_create.sql": dataMigrations20_api_keys_createSql,
+	"data/migrations/21_refresh_tokens_create.sql": dataMigrations21_refresh_tokens_createSql,
+	"data/migrations/22_add_probes_request_secret.sql": dataMigrations22_add_probes_request_secretSql,
+	"data/migrations/23_sessions_create.sql": dataMigrations23_sessions_createSql,
+	"data/migrations/24_add_accounts_totp.sql": dataMigrations24_add_accounts_totpSql,
+	"data/migrations/25_anomalies_create.sql": dataMigrations25_anomalies_createSql,
+	"data/migrations/2_add_probes_locale.sql": dataMigrations2_add_probes_localeSql,
+	"data/migrations/3_add_probes_tags.sql": dataMigrations3_add_probes_tagsSql,
+	"data/migrations/4_add_probes_location.sql": dataMigrations4_add_probes_locationSql,
+	"data/migrations/5_add_probes_callback.sql": dataMigrations5_add_probes_callbackSql,
+	"data/migrations/6_add_probes_quiet_hours.sql": dataMigrations6_add_probes_quiet_hoursSql,
+	"data/migrations/7_add_probes_preferences.sql": dataMigrations7_add_probes_preferencesSql,
+	"data/migrations/8_add_probes_token_invalid.sql": dataMigrations8_add_probes_token_invalidSql,
+	"data/migrations/9_add_probes_webpush.sql": dataMigrations9_add_probes_webpushSql,
 	"data/templates/home.tmpl": dataTemplatesHomeTmpl,
 }
 
@@ -251,9 +779,33 @@ type bintree struct {
 var _bintree = &bintree{nil, map[string]*bintree{
 	"data": &bintree{nil, map[string]*bintree{
 		"migrations": &bintree{nil, map[string]*bintree{
+			"10_add_probe_updates_changed_fields.sql": &bintree{dataMigrations10_add_probe_updates_changed_fieldsSql, map[string]*bintree{}},
+			"11_add_probes_last_seen.sql": &bintree{dataMigrations11_add_probes_last_seenSql, map[string]*bintree{}},
+			"12_add_probes_deactivated.sql": &bintree{dataMigrations12_add_probes_deactivatedSql, map[string]*bintree{}},
+			"13_token_history_create.sql": &bintree{dataMigrations13_token_history_createSql, map[string]*bintree{}},
+			"14_probe_aggregates_create.sql": &bintree{dataMigrations14_probe_aggregates_createSql, map[string]*bintree{}},
+			"15_probe_blocklist_create.sql": &bintree{dataMigrations15_probe_blocklist_createSql, map[string]*bintree{}},
+			"16_add_probes_deletion_requested.sql": &bintree{dataMigrations16_add_probes_deletion_requestedSql, map[string]*bintree{}},
+			"17_settings_overrides_create.sql": &bintree{dataMigrations17_settings_overrides_createSql, map[string]*bintree{}},
+			"18_add_probes_attestation_level.sql": &bintree{dataMigrations18_add_probes_attestation_levelSql, map[string]*bintree{}},
+			"19_add_account_roles.sql": &bintree{dataMigrations19_add_account_rolesSql, map[string]*bintree{}},
 			"1_accounts_create.sql": &bintree{dataMigrations1_accounts_createSql, map[string]*bintree{}},
 			"1_active_probes_create.sql": &bintree{dataMigrations1_active_probes_createSql, map[string]*bintree{}},
 			"1_probe_updates_create.sql": &bintree{dataMigrations1_probe_updates_createSql, map[string]*bintree{}},
+			"20_api_keys_create.sql": &bintree{dataMigrations20_api_keys_createSql, map[string]*bintree{}},
+			"21_refresh_tokens_create.sql": &bintree{dataMigrations21_refresh_tokens_createSql, map[string]*bintree{}},
+			"22_add_probes_request_secret.sql": &bintree{dataMigrations22_add_probes_request_secretSql, map[string]*bintree{}},
+			"23_sessions_create.sql": &bintree{dataMigrations23_sessions_createSql, map[string]*bintree{}},
+			"24_add_accounts_totp.sql": &bintree{dataMigrations24_add_accounts_totpSql, map[string]*bintree{}},
+			"25_anomalies_create.sql": &bintree{dataMigrations25_anomalies_createSql, map[string]*bintree{}},
+			"2_add_probes_locale.sql": &bintree{dataMigrations2_add_probes_localeSql, map[string]*bintree{}},
+			"3_add_probes_tags.sql": &bintree{dataMigrations3_add_probes_tagsSql, map[string]*bintree{}},
+			"4_add_probes_location.sql": &bintree{dataMigrations4_add_probes_locationSql, map[string]*bintree{}},
+			"5_add_probes_callback.sql": &bintree{dataMigrations5_add_probes_callbackSql, map[string]*bintree{}},
+			"6_add_probes_quiet_hours.sql": &bintree{dataMigrations6_add_probes_quiet_hoursSql, map[string]*bintree{}},
+			"7_add_probes_preferences.sql": &bintree{dataMigrations7_add_probes_preferencesSql, map[string]*bintree{}},
+			"8_add_probes_token_invalid.sql": &bintree{dataMigrations8_add_probes_token_invalidSql, map[string]*bintree{}},
+			"9_add_probes_webpush.sql": &bintree{dataMigrations9_add_probes_webpushSql, map[string]*bintree{}},
 		}},
 		"templates": &bintree{nil, map[string]*bintree{
 			"home.tmpl": &bintree{dataTemplatesHomeTmpl, map[string]*bintree{}},
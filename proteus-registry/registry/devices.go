@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// DeviceFilter narrows down the devices listed by ListDevices, the empty
+// fields match every device.
+type DeviceFilter struct {
+	ProbeCC			string
+	Platform		string
+	SoftwareVersion	string
+	Tag				string
+	// Only the devices seen since then
+	ActiveSince		time.Time
+}
+
+func (f DeviceFilter) where() (string, []interface{}) {
+	var args []interface{}
+	// Deactivated probes aren't targeted, so they aren't listed either
+	conditions := []string{"deactivated_at IS NULL"}
+	if f.ProbeCC != "" {
+		args = append(args, strings.ToUpper(f.ProbeCC))
+		conditions = append(conditions, fmt.Sprintf("probe_cc = $%d", len(args)))
+	}
+	if f.Platform != "" {
+		args = append(args, f.Platform)
+		conditions = append(conditions, fmt.Sprintf("platform = $%d", len(args)))
+	}
+	if f.SoftwareVersion != "" {
+		args = append(args, f.SoftwareVersion)
+		conditions = append(conditions,
+							fmt.Sprintf("software_version = $%d", len(args)))
+	}
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		conditions = append(conditions, fmt.Sprintf("$%d = ANY(tags)", len(args)))
+	}
+	if !f.ActiveSince.IsZero() {
+		args = append(args, f.ActiveSince)
+		conditions = append(conditions,
+				fmt.Sprintf("COALESCE(last_seen, last_updated) >= $%d", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ListDevices returns a page of the devices matching the filter, the most
+// recently seen first, together with how many match in total.
+func ListDevices(db *sqlx.DB, f DeviceFilter,
+				limit int, offset int) ([]ActiveClient, int64, error) {
+	var (
+		total int64
+		devices = make([]ActiveClient, 0)
+	)
+	table := pq.QuoteIdentifier(viper.GetString("database.active-probes-table"))
+	where, args := f.where()
+
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, table, where)
+	err := db.QueryRow(query, args...).Scan(&total)
+	if err != nil {
+		ctx.WithError(err).Error("failed to count devices")
+		return devices, 0, err
+	}
+
+	args = append(args, limit, offset)
+	query = fmt.Sprintf(`SELECT %s FROM %s
+		WHERE %s
+		ORDER BY COALESCE(last_seen, last_updated) DESC, id
+		LIMIT $%d OFFSET $%d`, clientColumns, table, where,
+		len(args) - 1, len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		ctx.WithError(err).Error("failed to list devices")
+		return devices, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ac, err := scanClient(rows)
+		if err != nil {
+			ctx.WithError(err).Error("failed to iterate over devices")
+			return devices, 0, err
+		}
+		devices = append(devices, ac)
+	}
+	return devices, total, rows.Err()
+}
@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"net"
+	"time"
+
+	"github.com/thetorproject/proteus/proteus-common/anomaly"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP looks up where probes are from when they check in. A nil *GeoIP
+// does no lookups, for when no database is configured.
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+type geoIPRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// OpenGeoIP opens a MaxMind City database, e.g. GeoLite2-City.mmdb
+func OpenGeoIP(path string) (*GeoIP, error) {
+	if path == "" {
+		return nil, nil
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		ctx.WithError(err).Error("failed to open GeoIP database")
+		return nil, err
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+// Lookup returns the region, as an ISO 3166-2 code such as "IR-07", and the
+// English name of the city the address is in. Unknown values are empty.
+func (g *GeoIP) Lookup(addr string) (string, string) {
+	if g == nil {
+		return "", ""
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", ""
+	}
+	var record geoIPRecord
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		ctx.WithError(err).Warn("failed to lookup probe location")
+		return "", ""
+	}
+	var region string
+	if len(record.Subdivisions) > 0 && record.Country.IsoCode != "" {
+		region = record.Country.IsoCode + "-" + record.Subdivisions[0].IsoCode
+	}
+	return region, record.City.Names["en"]
+}
+
+// Country returns the ISO 3166-1 code of the country the address is in, or
+// an empty string.
+func (g *GeoIP) Country(addr string) string {
+	if g == nil {
+		return ""
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	var record geoIPRecord
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		ctx.WithError(err).Warn("failed to lookup probe location")
+		return ""
+	}
+	return record.Country.IsoCode
+}
+
+// ObserveLocation tells the anomaly detector the country the probes make
+// their requests from, it goes after the DeviceAuthorizor middleware.
+func ObserveLocation(g *GeoIP, anomalies *anomaly.Detector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID, ok := c.Get("userID"); ok && anomalies != nil {
+			anomalies.ObserveLocation(userID.(string), g.Country(c.ClientIP()),
+										time.Now())
+		}
+		c.Next()
+	}
+}
+
+func (g *GeoIP) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.reader.Close()
+}
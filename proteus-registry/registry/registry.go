@@ -1,24 +1,32 @@
 package registry
 
 import (
-	"fmt"
-	"time"
+	"context"
+	"database/sql"
 	"errors"
+	"expvar"
+	"fmt"
 	"net/http"
-	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 	
+	"github.com/thetorproject/proteus/proteus-common/anomaly"
+	"github.com/thetorproject/proteus/proteus-common/autotls"
+	"github.com/thetorproject/proteus/proteus-common/secrets"
+	"github.com/thetorproject/proteus/proteus-common/dbconn"
+	"github.com/thetorproject/proteus/proteus-common/schema"
+	"github.com/thetorproject/proteus/proteus-common/probes"
+	"github.com/thetorproject/proteus/proteus-common/settings"
 	"github.com/thetorproject/proteus/proteus-common/middleware"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/apex/log"
-	"github.com/satori/go.uuid"
-	"github.com/rubenv/sql-migrate"
 	"github.com/lib/pq"
 	"github.com/spf13/viper"
 	"github.com/gin-gonic/gin"
 	"github.com/facebookgo/grace/gracehttp"
 	"gopkg.in/gin-contrib/cors.v1"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var ctx = log.WithFields(log.Fields{
@@ -26,294 +34,11 @@ var ctx = log.WithFields(log.Fields{
 })
 
 func initDatabase() (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", viper.GetString("database.url"))
+	db, err := dbconn.Open("postgres")
 	if err != nil {
-		ctx.Error("failed to open database")
 		return nil, err
 	}
-	return db, err
-}
-
-type ClientData struct {
-	ProbeCC string `json:"probe_cc" binding:"required"`
-	ProbeASN string `json:"probe_asn" binding:"required"`
-	Platform string `json:"platform" binding:"required"`
-
-	SoftwareName string `json:"software_name" binding:"required"`
-	SoftwareVersion string `json:"software_version" binding:"required"`
-	SupportedTests []string `json:"supported_tests" binding:"required"`
-
-	NetworkType string `json:"network_type"`
-	AvailableBandwidth string `json:"available_bandwidth"`
-	
-	Token string `json:"token"`
-
-	ProbeFamily string `json:"probe_family"`
-	ProbeID string `json:"probe_id"`
-
-	Password string `json:"password"`
-}
-
-func IsClientRegistered(db *sqlx.DB, clientID string) (bool, error) {
-	var found string
-	query := fmt.Sprintf(`SELECT id FROM %s WHERE id = $1`,
-				pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
-	err := db.QueryRow(query, clientID).Scan(&found)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
-}
-
-func Update(db *sqlx.DB, clientID string, req ClientData) (error) {
-	tx, err := db.Begin()
-	if err != nil {
-		ctx.WithError(err).Error("failed to open transaction")
-		return err
-	}
-
-	// Write into the updates table
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			id, update_time,
-			client_id,
-			probe_cc, probe_asn,
-			platform, software_name,
-			software_version, supported_tests,
-			network_type, available_bandwidth,
-			token, probe_family,
-			probe_id, update_type
-		) VALUES (
-			$1, $2,
-			$3, $4,
-			$5, $6,
-			$7, $8,
-			$9, $10,
-			$11, $12,
-			$13, $14, $15)`,
-			pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")))
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare update probes query")
-			return err
-		}
-
-		updateID := uuid.NewV4().String()
-		_, err = stmt.Exec(updateID, time.Now().UTC(),
-							clientID,
-							req.ProbeCC, req.ProbeASN,
-							req.Platform, req.SoftwareName,
-							req.SoftwareVersion, pq.Array(req.SupportedTests),
-							req.NetworkType, req.AvailableBandwidth,
-							req.Token, req.ProbeFamily,
-							req.ProbeID, "register")
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to add data to update table, rolling back")
-			tx.Rollback()
-			return errors.New("error in adding data to update probes")
-		}
-	}
-
-	// Write into the active probes table
-	{
-		query := fmt.Sprintf(`UPDATE %s SET
-			last_updated = $2,
-			probe_cc = $3,
-			probe_asn = $4,
-			platform = $5,
-			software_name = $6,
-			software_version = $7,
-			supported_tests = $8,
-			network_type = $9,
-			available_bandwidth = $10,
-			token = $11,
-			probe_family = $12,
-			probe_id = $13
-			WHERE id = $1`,
-			pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare update probes query")
-			return err
-		}
-		_, err = stmt.Exec(clientID,
-							time.Now().UTC(),
-							req.ProbeCC,
-							req.ProbeASN,
-							req.Platform,
-							req.SoftwareName,
-							req.SoftwareVersion,
-							pq.Array(req.SupportedTests),
-							req.NetworkType,
-							req.AvailableBandwidth,
-							req.Token,
-							req.ProbeFamily,
-							req.ProbeID)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to update active table, rolling back")
-			tx.Rollback()
-			return errors.New("failed to update active table")
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		ctx.WithError(err).Error("failed to commit transaction, rolling back")
-		return err
-	}
-
-	return nil
-}
-
-
-func Register(db *sqlx.DB, req ClientData) (string, error) {
-	if ((req.Platform == "ios" || req.Platform == "android") && req.Token == "") {
-		return "", errors.New("missing device token")
-	}
-	if (req.Password == "") {
-		return "", errors.New("missing password")
-	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		ctx.WithError(err).Error("failed to open transaction")
-		return "", err
-	}
-
-	var clientID = uuid.NewV4().String()
-
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			id, creation_time,
-			last_updated,
-			probe_cc, probe_asn,
-			platform, software_name,
-			software_version, supported_tests,
-			network_type, available_bandwidth,
-			token, probe_family,
-			probe_id
-		) VALUES (
-			$1, $2,
-			$3, $4,
-			$5, $6,
-			$7, $8,
-			$9, $10,
-			$11, $12,
-			$13, $14)`,
-			pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare active probes query")
-			return "", err
-		}
-		defer stmt.Close()
-
-		_, err = stmt.Exec(clientID, time.Now().UTC(),
-							time.Now().UTC(),
-							req.ProbeCC, req.ProbeASN,
-							req.Platform, req.SoftwareName,
-							req.SoftwareVersion, pq.Array(req.SupportedTests),
-							req.NetworkType, req.AvailableBandwidth,
-							req.Token, req.ProbeFamily,
-							req.ProbeID)
-		if err != nil {
-			tx.Rollback()
-			ctx.WithError(err).Error("failed to insert into active probes table, rolling back")
-			return "", err
-		}
-	}
-
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			id, update_time,
-			client_id,
-			probe_cc, probe_asn,
-			platform, software_name,
-			software_version, supported_tests,
-			network_type, available_bandwidth,
-			token, probe_family,
-			probe_id, update_type
-		) VALUES (
-			$1, $2,
-			$3, $4,
-			$5, $6,
-			$7, $8,
-			$9, $10,
-			$11, $12,
-			$13, $14, $15)`,
-			pq.QuoteIdentifier(viper.GetString("database.probe-updates-table")))
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare update probes query")
-			return "", err
-		}
-		defer stmt.Close()
-
-		updateID := uuid.NewV4().String()
-		_, err = stmt.Exec(updateID, time.Now().UTC(),
-							clientID,
-							req.ProbeCC, req.ProbeASN,
-							req.Platform, req.SoftwareName,
-							req.SoftwareVersion, pq.Array(req.SupportedTests),
-							req.NetworkType, req.AvailableBandwidth,
-							req.Token, req.ProbeFamily,
-							req.ProbeID, "register")
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to add data to update table, rolling back")
-			tx.Rollback()
-			return "", errors.New("error in adding data to update probes")
-		}
-	}
-
-	{
-		query := fmt.Sprintf(`INSERT INTO %s (
-			username,
-			password_hash,
-			last_access,
-			role
-		) VALUES (
-			$1,
-			$2,
-			$3,
-			$4)`,
-			pq.QuoteIdentifier(viper.GetString("database.accounts-table")))
-
-		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			ctx.WithError(err).Error("failed to hash password")
-			return "", err
-		}
-
-		stmt, err := tx.Prepare(query)
-		if (err != nil) {
-			ctx.WithError(err).Error("failed to prepare accounts query")
-			return "", err
-		}
-		defer stmt.Close()
-
-		_, err = stmt.Exec(clientID,
-							string(passwordHash),
-							time.Now().UTC(),
-							"device")
-		if err != nil {
-			tx.Rollback()
-			ctx.WithError(err).Error("failed to insert into accounts table, rolling back")
-			return "", err
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		ctx.WithError(err).Error("failed to commit transaction, rolling back")
-		return "", err
-	}
-
-	return clientID, nil
+	return sqlx.NewDb(db, "postgres"), nil
 }
 
 type ActiveClient struct {
@@ -334,23 +59,62 @@ type ActiveClient struct {
 
 	ProbeFamily			string `json:"probe_family"`
 	ProbeID				string `json:"probe_id"`
+	Locale				string `json:"locale"`
+	Tags				[]string `json:"tags"`
+	Region				string `json:"region"`
+	City				string `json:"city"`
+	CallbackURL			string `json:"callback_url"`
 
 	LastUpdated			time.Time `json:"last_updated"`
+	LastSeen			time.Time `json:"last_seen"`
 	CreationTime		time.Time `json:"creation_time"`
 }
 
 
-func ListClients(db *sqlx.DB) ([]ActiveClient, error) {
-	var activeClients []ActiveClient
-	query := fmt.Sprintf(`SELECT
-			id, creation_time,
+// The columns scanned by scanClient
+const clientColumns = `id, creation_time,
 			last_updated,
+			COALESCE(last_seen, last_updated),
 			probe_cc, probe_asn,
 			platform, software_name,
 			software_version, supported_tests,
 			network_type, available_bandwidth,
 			token, probe_family,
-			probe_id FROM %s`,
+			probe_id,
+			COALESCE(locale, ''),
+			tags,
+			COALESCE(region, ''),
+			COALESCE(city, ''),
+			COALESCE(callback_url, '')`
+
+func scanClient(rows *sql.Rows) (ActiveClient, error) {
+	var ac ActiveClient
+	err := rows.Scan(&ac.ClientID,
+					&ac.CreationTime,
+					&ac.LastUpdated,
+					&ac.LastSeen,
+					&ac.ProbeCC,
+					&ac.ProbeASN,
+					&ac.Platform,
+					&ac.SoftwareName,
+					&ac.SoftwareVersion,
+					&ac.SupportedTests,
+					&ac.NetworkType,
+					&ac.AvailableBandwidth,
+					&ac.Token,
+					&ac.ProbeFamily,
+					&ac.ProbeID,
+					&ac.Locale,
+					pq.Array(&ac.Tags),
+					&ac.Region,
+					&ac.City,
+					&ac.CallbackURL)
+	return ac, err
+}
+
+func ListClients(db *sqlx.DB) ([]ActiveClient, error) {
+	var activeClients []ActiveClient
+	query := fmt.Sprintf(`SELECT %s FROM %s`, clientColumns,
 		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
 
 	rows, err := db.Query(query)
@@ -360,21 +124,7 @@ func ListClients(db *sqlx.DB) ([]ActiveClient, error) {
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var ac ActiveClient
-		err := rows.Scan(&ac.ClientID,
-						&ac.CreationTime,
-						&ac.LastUpdated,
-						&ac.ProbeCC,
-						&ac.ProbeASN,
-						&ac.Platform,
-						&ac.SoftwareName,
-						&ac.SoftwareVersion,
-						&ac.SupportedTests,
-						&ac.NetworkType,
-						&ac.AvailableBandwidth,
-						&ac.Token,
-						&ac.ProbeFamily,
-						&ac.ProbeID)
+		ac, err := scanClient(rows)
 		if err != nil {
 			ctx.WithError(err).Error("failed to iterate over clients")
 			return activeClients, err
@@ -384,21 +134,141 @@ func ListClients(db *sqlx.DB) ([]ActiveClient, error) {
 	return activeClients, nil
 }
 
-func runMigrations(db *sqlx.DB) (error) {
-	migrations := &migrate.AssetMigrationSource{
-		Asset: Asset,
-		AssetDir: AssetDir,
-		Dir: "data/migrations",
+type TagsReq struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+var ErrClientNotFound = probes.ErrClientNotFound
+
+// The most windows GET /admin/probes/stats counts over at once
+const maxStatsWindows = 10
+
+// TokenRotation is sent by a probe whose push service gave it a new token,
+// along with the token it had.
+type TokenRotation struct {
+	OldToken	string `json:"old_token"`
+	Token		string `json:"token" binding:"required"`
+}
+
+// AddClientTags attaches the tags to the probe, the tags it already has are
+// kept.
+func AddClientTags(db *sqlx.DB, clientID string, tags []string) (error) {
+	query := fmt.Sprintf(`UPDATE %s SET
+		tags = ARRAY(SELECT DISTINCT unnest(tags || $2::VARCHAR[]))
+		WHERE id::text = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	res, err := db.Exec(query, clientID, pq.Array(tags))
+	if err != nil {
+		ctx.WithError(err).Error("failed to add client tags")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+func RemoveClientTag(db *sqlx.DB, clientID string, tag string) (error) {
+	query := fmt.Sprintf(`UPDATE %s SET
+		tags = array_remove(tags, $2)
+		WHERE id::text = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	res, err := db.Exec(query, clientID, tag)
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove client tag")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// Preferences are how a device wants to be notified of new tasks, they are
+// enforced by proteus-notify.
+type Preferences struct {
+	// Only push when the device is on a wifi network
+	WifiOnly				bool `json:"wifi_only"`
+	// At most this many notifications in 24 hours, 0 for no limit
+	MaxNotificationsPerDay	int64 `json:"max_notifications_per_day"`
+	// Only push tasks of these categories (e.g. "websites"), all if empty
+	Categories				[]string `json:"categories"`
+}
+
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+func GetPreferences(db *sqlx.DB, clientID string) (Preferences, error) {
+	var p Preferences
+	query := fmt.Sprintf(`SELECT
+		COALESCE(notify_wifi_only, FALSE),
+		COALESCE(notify_max_per_day, 0),
+		COALESCE(notify_categories, '{}')
+		FROM %s WHERE id::text = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	err := db.QueryRow(query, clientID).Scan(&p.WifiOnly,
+											&p.MaxNotificationsPerDay,
+											pq.Array(&p.Categories))
+	if err == sql.ErrNoRows {
+		return p, ErrClientNotFound
+	}
+	if err != nil {
+		ctx.WithError(err).Error("failed to get preferences")
 	}
-	n, err := migrate.Exec(db.DB, "postgres", migrations, migrate.Up)
+	return p, err
+}
+
+func SetPreferences(db *sqlx.DB, clientID string, p Preferences) (error) {
+	if p.MaxNotificationsPerDay < 0 {
+		return ErrInvalidPreferences
+	}
+	query := fmt.Sprintf(`UPDATE %s SET
+		notify_wifi_only = $2,
+		notify_max_per_day = $3,
+		notify_categories = $4
+		WHERE id::text = $1`,
+		pq.QuoteIdentifier(viper.GetString("database.active-probes-table")))
+	res, err := db.Exec(query, clientID, p.WifiOnly, p.MaxNotificationsPerDay,
+						pq.Array(p.Categories))
 	if err != nil {
+		ctx.WithError(err).Error("failed to set preferences")
 		return err
 	}
-	ctx.Infof("performed %d migrations", n)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrClientNotFound
+	}
 	return nil
 }
 
+func newMigrator(db *sql.DB) *schema.Migrator {
+	return schema.NewMigrator(db, viper.GetString("database.schema-version-table"),
+								Asset, AssetDir)
+}
+
+// OpenMigrator connects to the database for the migrate command
+func OpenMigrator() (*schema.Migrator, error) {
+	err := secrets.Load()
+	if err != nil {
+		return nil, err
+	}
+	db, err := initDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db.DB), nil
+}
+
+// runMigrations checks the schema of the database, and brings it up to date
+func runMigrations(db *sqlx.DB) (error) {
+	return newMigrator(db.DB).Startup()
+}
+
 func Start() {
+	err := secrets.Load()
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to load the secrets from vault")
+		return
+	}
+
 	db, err := initDatabase()
 
 	if (err != nil) {
@@ -412,19 +282,47 @@ func Start() {
 		return
 	}
 
+	geoIP, err := OpenGeoIP(viper.GetString("geoip.city-database"))
+	if (err != nil) {
+		ctx.WithError(err).Error("failed to open GeoIP database")
+		return
+	}
+	defer geoIP.Close()
+
+	anomalies := anomaly.DetectorFromConfig(db)
+
+	go RunProbeAggregator(db, viper.GetDuration("analytics.aggregate-interval"))
+
 	authMiddleware, err := proteus_mw.InitAuthMiddleware(db)
 	if (err != nil) {
-		ctx.WithError(err).Error("failed to initialise authMiddlewareDevice")
+		ctx.WithError(err).Error("failed to initialise the auth middleware, refusing to start")
+		return
+	}
+	adminAllowlist, err := proteus_mw.IPAllowlistFromConfig("admin")
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid admin allowlist, refusing to start")
 		return
 	}
 
-	router := gin.Default()
-	router.Use(cors.New(proteus_mw.CorsConfig()))
+	corsConfig, err := proteus_mw.CorsConfig()
+	if (err != nil) {
+		ctx.WithError(err).Error("invalid cors configuration, refusing to start")
+		return
+	}
 
+	router := gin.Default()
+	router.Use(proteus_mw.SecurityHeaders(), cors.New(corsConfig),
+				proteus_mw.LimitBodyFromConfig())
 	v1 := router.Group("/api/v1")
 	v1.POST("/login", authMiddleware.LoginHandler)
+	v1.POST("/refresh", authMiddleware.RefreshHandler)
+	v1.POST("/logout", authMiddleware.LogoutHandler)
+	v1.POST("/totp/enroll", authMiddleware.TOTPEnrollHandler)
+	v1.POST("/totp/confirm", authMiddleware.TOTPConfirmHandler)
+	v1.GET("/oidc/login", authMiddleware.OIDCLoginHandler)
+	v1.GET("/oidc/callback", authMiddleware.OIDCCallbackHandler)
 	v1.POST("/register", func(c *gin.Context) {
-		var registerReq ClientData
+		var registerReq probes.ClientData
 		err := c.BindJSON(&registerReq)
 		if (err != nil) {
 			ctx.WithError(err).Error("invalid request")
@@ -432,21 +330,35 @@ func Start() {
 					gin.H{"error": "invalid request"})
 			return
 		}
+		registerReq.Region, registerReq.City = geoIP.Lookup(c.ClientIP())
 
-		clientID, err := Register(db, registerReq)
+		clientID, err := probes.Register(db, registerReq)
 		if (err != nil) {
 			c.JSON(http.StatusBadRequest,
 					gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"client_id": clientID})
+		probeSettings, _ := settings.Resolve(db, registerReq.ProbeCC,
+											registerReq.SoftwareVersion)
+		c.JSON(http.StatusOK, gin.H{"client_id": clientID,
+									"settings": probeSettings})
 		return
 	})
 
 	admin := v1.Group("/admin")
-	admin.Use(authMiddleware.MiddlewareFunc(proteus_mw.AdminAuthorizor))
+	// Viewers can use the routes that don't require another role
+	admin.Use(adminAllowlist.Handler(),
+				proteus_mw.RequireClientCert(),
+				proteus_mw.RateLimitFromConfig("rate-limit.admin.ip").ByIP(),
+				authMiddleware.StaffMiddlewareFunc(proteus_mw.StaffAuthorizor),
+				proteus_mw.RequireScope(proteus_mw.JobsAdminScope),
+				proteus_mw.RateLimitFromConfig("rate-limit.admin.identity").ByIdentity())
 	{
+		operator := proteus_mw.RequireRole(proteus_mw.OperatorRole)
+		// The latency of the queries along with the runtime metrics, for
+		// monitoring
+		admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 		admin.GET("/clients", func(c *gin.Context) {
 			clientList, err := ListClients(db)
 			if err != nil {
@@ -457,14 +369,620 @@ func Start() {
 			c.JSON(http.StatusOK,
 					gin.H{"active_clients": clientList})
 		})
+		admin.GET("/devices", func(c *gin.Context) {
+			filter := DeviceFilter{
+				ProbeCC: c.Query("country"),
+				Platform: c.Query("platform"),
+				SoftwareVersion: c.Query("version"),
+				Tag: c.Query("tag"),
+			}
+			if c.Query("active_within") != "" {
+				within, err := time.ParseDuration(c.Query("active_within"))
+				if (err != nil || within <= 0) {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid active_within duration"})
+					return
+				}
+				filter.ActiveSince = time.Now().UTC().Add(-within)
+			}
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+			if (err != nil || limit <= 0 || limit > 500) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid limit specified"})
+				return
+			}
+			offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+			if (err != nil || offset < 0) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid offset specified"})
+				return
+			}
+			devices, total, err := ListDevices(db, filter, limit, offset)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"devices": devices,
+						"total": total,
+						"limit": limit,
+						"offset": offset})
+		})
+		admin.GET("/clients/active", func(c *gin.Context) {
+			within, err := time.ParseDuration(c.DefaultQuery("within", "24h"))
+			if (err != nil || within <= 0) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid within duration"})
+				return
+			}
+			counts, err := probes.CountActiveProbes(db, time.Now().UTC().Add(-within))
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			var total int64
+			for _, count := range counts {
+				total += count.Count
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"total": total, "platforms": counts})
+		})
+		admin.GET("/probes/stats", func(c *gin.Context) {
+			labels := strings.Split(c.DefaultQuery("windows", "24h,168h,720h"), ",")
+			if len(labels) > maxStatsWindows {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "too many windows"})
+				return
+			}
+			windows := make([]time.Duration, len(labels))
+			for i, label := range labels {
+				labels[i] = strings.TrimSpace(label)
+				window, err := time.ParseDuration(labels[i])
+				if (err != nil || window <= 0) {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid window duration"})
+					return
+				}
+				windows[i] = window
+			}
+			groups, err := probes.CountActiveByGroup(db, time.Now().UTC(), windows)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			totals := make([]int64, len(windows))
+			for _, g := range groups {
+				for i, count := range g.Counts {
+					totals[i] += count
+				}
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"windows": labels,
+						"totals": totals,
+						"groups": groups})
+		})
+		admin.GET("/probes/aggregates", func(c *gin.Context) {
+			until := time.Now().UTC()
+			since := until.AddDate(0, 0, -30)
+			if c.Query("since") != "" {
+				t, err := time.Parse("2006-01-02", c.Query("since"))
+				if (err != nil) {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid since date"})
+					return
+				}
+				since = t
+			}
+			if c.Query("until") != "" {
+				t, err := time.Parse("2006-01-02", c.Query("until"))
+				if (err != nil) {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid until date"})
+					return
+				}
+				until = t
+			}
+			aggregates, err := ListProbeAggregates(db, since, until)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"k_anonymity": viper.GetInt("analytics.k-anonymity"),
+						"aggregates": aggregates})
+		})
+		admin.GET("/settings/overrides", func(c *gin.Context) {
+			overrides, err := settings.ListOverrides(db)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"defaults": settings.Defaults(),
+						"overrides": overrides})
+		})
+		admin.POST("/settings/override", operator, func(c *gin.Context) {
+			var override settings.Override
+			err := c.BindJSON(&override)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			id, err := settings.AddOverride(db, override)
+			if (err != nil) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"id": id})
+		})
+		admin.DELETE("/settings/override/:id", operator, func(c *gin.Context) {
+			err := settings.DeleteOverride(db, c.Param("id"))
+			if (err != nil) {
+				if err == settings.ErrOverrideNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deleted"})
+		})
+		// Shows what the probes of a country and version get
+		admin.GET("/settings/resolve", func(c *gin.Context) {
+			probeSettings, err := settings.Resolve(db, c.Query("country"),
+													c.Query("version"))
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK, probeSettings)
+		})
+		admin.GET("/anomalies", func(c *gin.Context) {
+			var err error
+			since := time.Now().Add(-7 * 24 * time.Hour)
+			if c.Query("since") != "" {
+				since, err = time.Parse(time.RFC3339, c.Query("since"))
+				if (err != nil) {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": "invalid since specified"})
+					return
+				}
+			}
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+			if (err != nil || limit <= 0) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid limit specified"})
+				return
+			}
+			anomalies, err := anomaly.ListAnomalies(db, c.Query("probe_id"),
+													since, limit)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"anomalies": anomalies})
+		})
+		admin.GET("/blocklist", func(c *gin.Context) {
+			entries, err := probes.ListBlocked(db)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"blocklist": entries})
+		})
+		admin.POST("/blocklist", operator, func(c *gin.Context) {
+			var entry probes.BlockEntry
+			err := c.BindJSON(&entry)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = probes.Block(db, entry)
+			if (err != nil) {
+				if err == probes.ErrInvalidBlockKind {
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "blocked"})
+		})
+		admin.DELETE("/blocklist/:kind/:value", operator, func(c *gin.Context) {
+			err := probes.Unblock(db, c.Param("kind"), c.Param("value"))
+			if (err != nil) {
+				if err == probes.ErrBlockNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "unblocked"})
+		})
+		admin.GET("/client/:client_id/tokens", operator, func(c *gin.Context) {
+			history, err := probes.GetTokenHistory(db, c.Param("client_id"))
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"tokens": history})
+		})
+		admin.POST("/client/:client_id/tags", operator, func(c *gin.Context) {
+			var tagsReq TagsReq
+			err := c.BindJSON(&tagsReq)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = AddClientTags(db, c.Param("client_id"), tagsReq.Tags)
+			if (err != nil) {
+				if err == ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		admin.DELETE("/client/:client_id/tags/:tag", operator, func(c *gin.Context) {
+			err := RemoveClientTag(db, c.Param("client_id"), c.Param("tag"))
+			if (err != nil) {
+				if err == ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		accounts := admin.Group("/")
+		accounts.Use(proteus_mw.RequireRole(proteus_mw.AdminRole))
+		accounts.GET("/accounts", func(c *gin.Context) {
+			accountList, err := ListAccounts(db)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"accounts": accountList})
+		})
+		accounts.POST("/account", func(c *gin.Context) {
+			var accountReq NewStaffAccount
+			err := c.BindJSON(&accountReq)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = CreateAccount(db, accountReq)
+			if (err != nil) {
+				if err == ErrAccountExists {
+					c.JSON(http.StatusConflict,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "created"})
+		})
+		accounts.PUT("/account/:username/role", func(c *gin.Context) {
+			var roleReq RoleReq
+			err := c.BindJSON(&roleReq)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = SetAccountRole(db, c.Param("username"), roleReq.Role)
+			if (err != nil) {
+				if err == ErrAccountNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		accounts.GET("/api-keys", func(c *gin.Context) {
+			keyList, err := proteus_mw.ListAPIKeys(db)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"api_keys": keyList})
+		})
+		accounts.POST("/api-key", func(c *gin.Context) {
+			var keyReq proteus_mw.APIKey
+			err := c.BindJSON(&keyReq)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			account, _ := c.Get("account")
+			key, apiKey, err := proteus_mw.CreateAPIKey(db, keyReq,
+														account.(proteus_mw.Account))
+			if (err != nil) {
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			// The key can't be retrieved later on
+			c.JSON(http.StatusOK,
+					gin.H{"key": key, "api_key": apiKey})
+		})
+		accounts.DELETE("/api-key/:id", func(c *gin.Context) {
+			err := proteus_mw.RevokeAPIKey(db, c.Param("id"))
+			if (err != nil) {
+				if err == proteus_mw.ErrAPIKeyNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "revoked"})
+		})
+		accounts.DELETE("/account/:username", func(c *gin.Context) {
+			err := DeleteAccount(db, c.Param("username"))
+			if (err != nil) {
+				if err == ErrAccountNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "deleted"})
+		})
+		accounts.DELETE("/account/:username/totp", func(c *gin.Context) {
+			err := authMiddleware.TOTP.Reset(c.Param("username"))
+			if (err != nil) {
+				if err == proteus_mw.ErrUnknownAccount {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "reset"})
+		})
+		// The sessions of the staff and of the devices, whose username is
+		// their client_id
+		accounts.GET("/sessions", func(c *gin.Context) {
+			sessionList, err := authMiddleware.Tokens.ListSessions(c.Query("username"))
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"sessions": sessionList})
+		})
+		accounts.DELETE("/session/:id", func(c *gin.Context) {
+			err := authMiddleware.Tokens.RevokeSession(c.Param("id"))
+			if (err != nil) {
+				if err == proteus_mw.ErrSessionNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "revoked"})
+		})
+		accounts.DELETE("/sessions/:username", func(c *gin.Context) {
+			err := authMiddleware.Tokens.RevokeUser(c.Param("username"))
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "revoked"})
+		})
 	}
 
 	device := v1.Group("/")
-	device.Use(authMiddleware.MiddlewareFunc(proteus_mw.DeviceAuthorizor))
+	device.Use(authMiddleware.MiddlewareFunc(proteus_mw.DeviceAuthorizor),
+				proteus_mw.RejectBlocked(func(cx context.Context,
+												clientID string) (bool, error) {
+					return probes.IsBlocked(db, clientID)
+				}),
+				proteus_mw.TrackLastSeen(func(cx context.Context,
+												clientID string) error {
+					return probes.Touch(db, clientID, time.Minute)
+				}),
+				ObserveLocation(geoIP, anomalies))
 	{
+		device.GET("/preferences/:client_id", func(c *gin.Context) {
+			clientID := c.Param("client_id")
+			if c.MustGet("userID").(string) != clientID {
+				c.JSON(http.StatusForbidden,
+						gin.H{"error": "access denied"})
+				return
+			}
+			prefs, err := GetPreferences(db, clientID)
+			if (err != nil) {
+				if err == ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			c.JSON(http.StatusOK, prefs)
+		})
+		device.PUT("/preferences/:client_id", func(c *gin.Context) {
+			var prefs Preferences
+			clientID := c.Param("client_id")
+			if c.MustGet("userID").(string) != clientID {
+				c.JSON(http.StatusForbidden,
+						gin.H{"error": "access denied"})
+				return
+			}
+			err := c.BindJSON(&prefs)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = SetPreferences(db, clientID, prefs)
+			if (err != nil) {
+				if err == ErrClientNotFound {
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		device.PUT("/device/token", func(c *gin.Context) {
+			var rotation TokenRotation
+			err := c.BindJSON(&rotation)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			err = probes.RotateToken(db, c.MustGet("userID").(string),
+									rotation.OldToken, rotation.Token)
+			if (err != nil) {
+				switch err {
+				case ErrClientNotFound:
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+				case probes.ErrTokenMismatch:
+					c.JSON(http.StatusConflict,
+							gin.H{"error": err.Error()})
+				case probes.ErrMissingToken:
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+				}
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok"})
+		})
+		// Probes with nothing else to do ping this to be counted as active,
+		// any other authenticated request does the same
+		device.POST("/device/heartbeat", func(c *gin.Context) {
+			err := probes.Touch(db, c.MustGet("userID").(string), 0)
+			if (err != nil) {
+				c.JSON(http.StatusInternalServerError,
+						gin.H{"error": "server side error"})
+				return
+			}
+			probeSettings, _ := settings.ResolveForProbe(db,
+										c.MustGet("userID").(string))
+			c.JSON(http.StatusOK,
+					gin.H{"status": "ok", "settings": probeSettings})
+		})
+		device.PUT("/device/me", func(c *gin.Context) {
+			var deviceUpdate probes.DeviceUpdate
+			err := c.BindJSON(&deviceUpdate)
+			if (err != nil) {
+				ctx.WithError(err).Error("invalid request")
+				c.JSON(http.StatusBadRequest,
+						gin.H{"error": "invalid request"})
+				return
+			}
+			changed, err := probes.UpdateDevice(db, c.MustGet("userID").(string),
+												deviceUpdate)
+			if (err != nil) {
+				switch err {
+				case ErrClientNotFound:
+					c.JSON(http.StatusNotFound,
+							gin.H{"error": err.Error()})
+				case probes.ErrInvalidCountry:
+					c.JSON(http.StatusBadRequest,
+							gin.H{"error": err.Error()})
+				default:
+					c.JSON(http.StatusInternalServerError,
+							gin.H{"error": "server side error"})
+				}
+				return
+			}
+			c.JSON(http.StatusOK,
+					gin.H{"changed_fields": changed})
+		})
 		// XXX do we also want to support a PATCH method?
 		device.PUT("/update/:client_id", func(c *gin.Context) {
-			var updateReq ClientData
+			var updateReq probes.ClientData
 			clientID := c.Param("client_id")
 			err := c.BindJSON(&updateReq)
 			if (err != nil) {
@@ -473,7 +991,7 @@ func Start() {
 						gin.H{"error": "invalid request"})
 				return
 			}
-			isRegistered, err := IsClientRegistered(db, clientID)
+			isRegistered, err := probes.IsClientRegistered(db, clientID)
 			if (err != nil) {
 				ctx.WithError(err).Error("failed to learn if client is registered")
 				c.JSON(http.StatusBadRequest,
@@ -486,7 +1004,8 @@ func Start() {
 				return
 			}
 
-			err = Update(db, clientID, updateReq)
+			updateReq.Region, updateReq.City = geoIP.Lookup(c.ClientIP())
+			err = probes.Update(db, clientID, updateReq)
 			if (err != nil) {
 				ctx.WithError(err).Error("failed to update")
 				c.JSON(http.StatusBadRequest,
@@ -501,9 +1020,10 @@ func Start() {
 	Addr := fmt.Sprintf("%s:%d", viper.GetString("api.address"),
 								viper.GetInt("api.port"))
 	ctx.Infof("starting on %s", Addr)
-	s := &http.Server{
-		Addr: Addr,
-		Handler: router,
+	servers, err := autotls.Servers(Addr, router)
+	if err != nil {
+		ctx.WithError(err).Error("failed to set up TLS")
+		return
 	}
-	gracehttp.Serve(s)
+	gracehttp.Serve(servers...)
 }